@@ -0,0 +1,37 @@
+package clock
+
+import "time"
+
+// Clock is a source of the current time.  Components that issue or check time-based values, such as
+// token claims, consume a Clock rather than calling time.Now directly, so that an entire application
+// can share a single notion of the current time.
+type Clock interface {
+	Now() time.Time
+}
+
+// Func is a closure type that implements Clock
+type Func func() time.Time
+
+func (f Func) Now() time.Time {
+	return f()
+}
+
+// System returns the Clock that reports the real time
+func System() Clock {
+	return Func(time.Now)
+}
+
+// NowFunc returns the given Clock's Now as a closure.  If c is nil, time.Now is returned.
+func NowFunc(c Clock) func() time.Time {
+	if c == nil {
+		return time.Now
+	}
+
+	return c.Now
+}
+
+// Provide is an uber/fx provider for the system Clock.  Tests can supply some other Clock in its place,
+// e.g. a clocktest.Fake.
+func Provide() Clock {
+	return System()
+}
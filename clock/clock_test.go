@@ -0,0 +1,34 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSystem(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		before = time.Now()
+		now    = System().Now()
+	)
+
+	assert.False(now.Before(before))
+	assert.False(Provide().Now().Before(now))
+}
+
+func TestFunc(t *testing.T) {
+	expected := time.Date(2020, 10, 14, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, expected, Func(func() time.Time { return expected }).Now())
+}
+
+func TestNowFunc(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		expected = time.Date(2020, 10, 14, 12, 0, 0, 0, time.UTC)
+	)
+
+	assert.Equal(expected, NowFunc(Func(func() time.Time { return expected }))())
+	assert.False(NowFunc(nil)().IsZero())
+}
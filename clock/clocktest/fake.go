@@ -0,0 +1,37 @@
+package clocktest
+
+import (
+	"sync"
+	"time"
+)
+
+// Fake is a clock.Clock whose time only changes when told to.  A Fake is safe for concurrent use.
+type Fake struct {
+	lock    sync.Mutex
+	current time.Time
+}
+
+// NewFake creates a Fake that reports the given time
+func NewFake(start time.Time) *Fake {
+	return &Fake{current: start}
+}
+
+func (f *Fake) Now() time.Time {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.current
+}
+
+// Set changes the time this Fake reports
+func (f *Fake) Set(t time.Time) {
+	f.lock.Lock()
+	f.current = t
+	f.lock.Unlock()
+}
+
+// Add advances the time this Fake reports by the given duration, which may be negative
+func (f *Fake) Add(d time.Duration) {
+	f.lock.Lock()
+	f.current = f.current.Add(d)
+	f.lock.Unlock()
+}
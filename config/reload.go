@@ -0,0 +1,95 @@
+package config
+
+import (
+	"sync"
+
+	"github.com/spf13/viper"
+	"go.uber.org/fx"
+)
+
+// Reloadable is a component whose state can be refreshed from configuration while the application is running.
+// Implementations must leave their existing state intact when Reload returns an error.
+type Reloadable interface {
+	Reload(Unmarshaller) error
+}
+
+type ReloadableFunc func(Unmarshaller) error
+
+func (rf ReloadableFunc) Reload(u Unmarshaller) error {
+	return rf(u)
+}
+
+// Reloader is a registry of Reloadable components that are refreshed as a group.  A Reloader is safe
+// for concurrent use.
+type Reloader struct {
+	lock         sync.Mutex
+	refresh      func() error
+	unmarshaller Unmarshaller
+	reloadables  []Reloadable
+}
+
+// NewReloader creates a Reloader which invokes the given refresh closure prior to reloading any components.
+// The refresh closure is typically used to reread configuration sources, and may be nil.  Each registered
+// Reloadable is passed the given Unmarshaller.
+func NewReloader(refresh func() error, u Unmarshaller) *Reloader {
+	return &Reloader{
+		refresh:      refresh,
+		unmarshaller: u,
+	}
+}
+
+// Register adds a component to this Reloader
+func (r *Reloader) Register(rl Reloadable) {
+	r.lock.Lock()
+	r.reloadables = append(r.reloadables, rl)
+	r.lock.Unlock()
+}
+
+// Reload refreshes configuration, then reloads each registered component in the order they were registered.
+// If the refresh fails, no component is reloaded and that single error is returned.  Otherwise, an error from
+// one component does not prevent subsequent components from being reloaded, and all such errors are returned.
+func (r *Reloader) Reload() []error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.refresh != nil {
+		if err := r.refresh(); err != nil {
+			return []error{err}
+		}
+	}
+
+	var errs []error
+	for _, rl := range r.reloadables {
+		if err := rl.Reload(r.unmarshaller); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+// ReloaderIn describes the dependencies for creating a Reloader backed by viper
+type ReloaderIn struct {
+	fx.In
+
+	Viper        *viper.Viper
+	Unmarshaller Unmarshaller
+}
+
+// ProvideReloader is an uber/fx provider that creates a Reloader which rereads the viper configuration file, if any,
+// before reloading components.  If viper was configured from something other than a file, such as an in-memory
+// string, the configuration itself is left as is and components are simply reloaded.
+//
+// An unparseable configuration file leaves viper's current configuration untouched.
+func ProvideReloader(in ReloaderIn) *Reloader {
+	return NewReloader(
+		func() error {
+			if len(in.Viper.ConfigFileUsed()) == 0 {
+				return nil
+			}
+
+			return in.Viper.ReadInConfig()
+		},
+		in.Unmarshaller,
+	)
+}
@@ -39,6 +39,10 @@ servers:
     address: :9999
     disableHTTPKeepAlives: true
 
+  admin:
+    address: :8085
+    disableHTTPKeepAlives: true
+
   health:
     address: :8084
     disableHTTPKeepAlives: true
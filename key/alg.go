@@ -0,0 +1,112 @@
+package key
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"fmt"
+	"strings"
+)
+
+// AlgorithmMismatchError is returned when a Descriptor pins an algorithm that cannot be used with its key
+type AlgorithmMismatchError struct {
+	Kid string
+	Alg string
+}
+
+func (ame AlgorithmMismatchError) Error() string {
+	return fmt.Sprintf("Algorithm %s cannot be used with key %s", ame.Alg, ame.Kid)
+}
+
+// verifyKey returns the public key of a Pair, or the secret for a symmetric Pair
+func verifyKey(p Pair) interface{} {
+	switch k := p.Sign().(type) {
+	case []byte:
+		return k
+	case crypto.Signer:
+		return k.Public()
+	default:
+		return nil
+	}
+}
+
+// pairType returns the Descriptor Type that describes a Pair's key, or the empty string for an unknown key
+func pairType(p Pair) string {
+	switch verifyKey(p).(type) {
+	case []byte:
+		return KeyTypeSecret
+	case *rsa.PublicKey:
+		return KeyTypeRSA
+	case *ecdsa.PublicKey:
+		return KeyTypeECDSA
+	case ed25519.PublicKey:
+		return KeyTypeEd25519
+	default:
+		return ""
+	}
+}
+
+// algorithmFits tests whether a JWS algorithm, as named in RFC 7518, can be used with a Pair
+func algorithmFits(alg string, p Pair) bool {
+	switch k := verifyKey(p).(type) {
+	case []byte:
+		return alg == "HS256" || alg == "HS384" || alg == "HS512"
+
+	case *rsa.PublicKey:
+		switch alg {
+		case "RS256", "RS384", "RS512", "PS256", "PS384", "PS512":
+			return true
+		}
+
+	case *ecdsa.PublicKey:
+		switch alg {
+		case "ES256":
+			return k.Curve == elliptic.P256()
+		case "ES384":
+			return k.Curve == elliptic.P384()
+		case "ES512":
+			return k.Curve == elliptic.P521()
+		}
+
+	case ed25519.PublicKey:
+		return alg == AlgEdDSA
+	}
+
+	return false
+}
+
+// canonicalAlg returns the RFC 7518 or RFC 8037 spelling of a JWS algorithm name, which may be in any case
+func canonicalAlg(alg string) string {
+	if strings.EqualFold(alg, AlgEdDSA) {
+		return AlgEdDSA
+	}
+
+	return strings.ToUpper(alg)
+}
+
+// CheckAlgorithm verifies that a JWS algorithm, named in any case, can be used with a Pair's key type and, for
+// ECDSA keys, its curve.  Pairs whose keys are of no known type, e.g. custom signers, are not checked.
+func CheckAlgorithm(alg string, p Pair) error {
+	if len(pairType(p)) > 0 && !algorithmFits(canonicalAlg(alg), p) {
+		return AlgorithmMismatchError{Kid: p.KID(), Alg: alg}
+	}
+
+	return nil
+}
+
+// pinAlgorithm normalizes the algorithm pinned by a Descriptor and verifies that it fits the Pair.
+// An unpinned Descriptor yields an empty algorithm.
+func pinAlgorithm(d Descriptor, p Pair) (string, error) {
+	if len(d.Alg) == 0 {
+		return "", nil
+	}
+
+	alg := canonicalAlg(d.Alg)
+	if !algorithmFits(alg, p) {
+		return "", AlgorithmMismatchError{Kid: p.KID(), Alg: d.Alg}
+	}
+
+	return alg, nil
+}
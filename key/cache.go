@@ -0,0 +1,329 @@
+package key
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/xmidt-org/themis/config"
+	"github.com/xmidt-org/themis/xlog"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/go-kit/kit/metrics"
+	"go.uber.org/fx"
+)
+
+const (
+	// DefaultCacheRefreshInterval is how often cached remote keys are reloaded when no interval is configured
+	DefaultCacheRefreshInterval = 5 * time.Minute
+
+	// DefaultCacheLoadTimeout is the maximum time a single remote key load may take when no timeout is configured
+	DefaultCacheLoadTimeout = 10 * time.Second
+)
+
+var (
+	ErrNoLoader          = errors.New("Remote keys require a Loader")
+	ErrRemoteKidRequired = errors.New("Remote keys require a kid")
+)
+
+// KeyUnavailableError is returned when a remote key is not cached and could not be loaded
+type KeyUnavailableError struct {
+	Kid string
+	Err error
+}
+
+func (kue KeyUnavailableError) Error() string {
+	return fmt.Sprintf("Key %s is unavailable: %s", kue.Kid, kue.Err)
+}
+
+func (kue KeyUnavailableError) Unwrap() error {
+	return kue.Err
+}
+
+// Loader fetches a key Pair that is held outside the process, such as in a KMS.  The returned Pair's Sign
+// value is whatever handle the configured signing algorithm expects.  Loading is assumed to be slow, so a
+// Loader is only ever used through a LoaderCache.
+type Loader interface {
+	Load(context.Context, Descriptor) (Pair, error)
+}
+
+type LoaderFunc func(context.Context, Descriptor) (Pair, error)
+
+func (lf LoaderFunc) Load(ctx context.Context, d Descriptor) (Pair, error) {
+	return lf(ctx, d)
+}
+
+// CacheOptions is the configuration for a LoaderCache
+type CacheOptions struct {
+	// RefreshInterval is how often every cached key is reloaded in the background.  If unset,
+	// DefaultCacheRefreshInterval is used.
+	RefreshInterval time.Duration
+
+	// LoadTimeout is the maximum time a single load may take.  If unset, DefaultCacheLoadTimeout is used.
+	LoadTimeout time.Duration
+}
+
+// CacheMetrics holds the optional metrics a LoaderCache updates.  Each must accept a KidLabel label.
+type CacheMetrics struct {
+	// Hits is incremented each time a signing key is served from the cache
+	Hits metrics.Counter
+
+	// Misses is incremented each time a signing key had to be loaded before it could be used
+	Misses metrics.Counter
+}
+
+// LoaderCache preloads remote keys through a Loader and serves them from memory, so that signing a token does not
+// pay the cost of a remote call.  Cached keys are reloaded on a schedule once Start is called.  If a reload fails,
+// the previously loaded key continues to be used.  A LoaderCache is safe for concurrent use.
+type LoaderCache struct {
+	loader   Loader
+	interval time.Duration
+	timeout  time.Duration
+	metrics  CacheMetrics
+	logger   log.Logger
+
+	lock    sync.RWMutex
+	entries map[string]Pair
+	remote  map[string]Descriptor
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewLoaderCache creates a LoaderCache around the given Loader.  The logger is optional, and receives reload failures.
+func NewLoaderCache(l Loader, o CacheOptions, m CacheMetrics, logger log.Logger) *LoaderCache {
+	lc := &LoaderCache{
+		loader:   l,
+		interval: o.RefreshInterval,
+		timeout:  o.LoadTimeout,
+		metrics:  m,
+		logger:   logger,
+		entries:  make(map[string]Pair),
+		remote:   make(map[string]Descriptor),
+	}
+
+	if lc.interval <= 0 {
+		lc.interval = DefaultCacheRefreshInterval
+	}
+
+	if lc.timeout <= 0 {
+		lc.timeout = DefaultCacheLoadTimeout
+	}
+
+	if lc.logger == nil {
+		lc.logger = xlog.Default()
+	}
+
+	return lc
+}
+
+func (lc *LoaderCache) load(d Descriptor) (Pair, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), lc.timeout)
+	defer cancel()
+
+	p, err := lc.loader.Load(ctx, d)
+	if err != nil {
+		return nil, KeyUnavailableError{Kid: d.Kid, Err: err}
+	}
+
+	lc.lock.Lock()
+	lc.entries[d.Kid] = p
+	lc.lock.Unlock()
+	return p, nil
+}
+
+// get returns the cached Pair for a remote key, loading it if necessary
+func (lc *LoaderCache) get(d Descriptor) (Pair, error) {
+	lc.lock.RLock()
+	p, ok := lc.entries[d.Kid]
+	lc.lock.RUnlock()
+
+	if ok {
+		if lc.metrics.Hits != nil {
+			lc.metrics.Hits.With(KidLabel, d.Kid).Add(1.0)
+		}
+
+		return p, nil
+	}
+
+	if lc.metrics.Misses != nil {
+		lc.metrics.Misses.With(KidLabel, d.Kid).Add(1.0)
+	}
+
+	return lc.load(d)
+}
+
+// Preload fetches a remote key immediately and returns a Pair that serves it from this cache.  The Descriptor's
+// Kid is required, since the kid of a remote key cannot be known before it is loaded.
+func (lc *LoaderCache) Preload(d Descriptor) (Pair, error) {
+	if len(d.Kid) == 0 {
+		return nil, ErrRemoteKidRequired
+	}
+
+	if _, err := lc.load(d); err != nil {
+		return nil, err
+	}
+
+	lc.lock.Lock()
+	lc.remote[d.Kid] = d
+	lc.lock.Unlock()
+	return cachedPair{cache: lc, descriptor: d}, nil
+}
+
+// Refresh reloads every preloaded key.  Keys that fail to reload are left as they were, and all such errors are returned.
+func (lc *LoaderCache) Refresh() []error {
+	lc.lock.RLock()
+	remote := make([]Descriptor, 0, len(lc.remote))
+	for _, d := range lc.remote {
+		remote = append(remote, d)
+	}
+
+	lc.lock.RUnlock()
+
+	var errs []error
+	for _, d := range remote {
+		if _, err := lc.load(d); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+// Start begins reloading keys every RefreshInterval.  This method is idempotent.
+func (lc *LoaderCache) Start() {
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+	if lc.stop != nil {
+		return
+	}
+
+	lc.stop = make(chan struct{})
+	lc.done = make(chan struct{})
+	go lc.run(lc.stop, lc.done)
+}
+
+// Stop halts the scheduled reloads and waits for any reload in progress to finish.  This method is idempotent.
+func (lc *LoaderCache) Stop() {
+	lc.lock.Lock()
+	stop, done := lc.stop, lc.done
+	lc.stop, lc.done = nil, nil
+	lc.lock.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+func (lc *LoaderCache) run(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(lc.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			for _, err := range lc.Refresh() {
+				lc.logger.Log(
+					level.Key(), level.ErrorValue(),
+					xlog.MessageKey(), "unable to refresh remote key",
+					xlog.ErrorKey(), err,
+				)
+			}
+		}
+	}
+}
+
+// cachedPair is the Pair for a remote key, which delegates to whatever was most recently loaded into a LoaderCache
+type cachedPair struct {
+	cache      *LoaderCache
+	descriptor Descriptor
+}
+
+func (cp cachedPair) KID() string {
+	return cp.descriptor.Kid
+}
+
+// Sign returns the cached signing key.  If the key is unavailable, this method returns nil, which every
+// signing algorithm rejects.
+func (cp cachedPair) Sign() interface{} {
+	p, err := cp.cache.get(cp.descriptor)
+	if err != nil {
+		return nil
+	}
+
+	return p.Sign()
+}
+
+func (cp cachedPair) WriteVerifyPEMTo(w io.Writer) (int64, error) {
+	p, err := cp.cache.get(cp.descriptor)
+	if err != nil {
+		return 0, err
+	}
+
+	return p.WriteVerifyPEMTo(w)
+}
+
+func (cp cachedPair) WriteJWK(w io.Writer) (int64, error) {
+	p, err := cp.cache.get(cp.descriptor)
+	if err != nil {
+		return 0, err
+	}
+
+	return p.WriteJWK(w)
+}
+
+// CacheIn is the set of dependencies for a LoaderCache
+type CacheIn struct {
+	fx.In
+
+	// Loader is the optional strategy for fetching remote keys.  If not supplied, no LoaderCache is created.
+	Loader Loader `optional:"true"`
+
+	Unmarshaller config.Unmarshaller
+	Lifecycle    fx.Lifecycle
+	Logger       log.Logger `optional:"true"`
+
+	// Hits is the optional counter of signing keys served from the cache.  It must accept a KidLabel label.
+	Hits metrics.Counter `name:"key_cache_hits" optional:"true"`
+
+	// Misses is the optional counter of signing keys that had to be loaded.  It must accept a KidLabel label.
+	Misses metrics.Counter `name:"key_cache_misses" optional:"true"`
+}
+
+// UnmarshalCache returns an uber/fx provider of the LoaderCache for remote keys, configured from CacheOptions
+// under the given key.  If the application supplies no Loader, the provided LoaderCache is nil and remote keys
+// cannot be registered.  Scheduled reloads run for the lifetime of the application.
+func UnmarshalCache(configKey string) func(CacheIn) (*LoaderCache, error) {
+	return func(in CacheIn) (*LoaderCache, error) {
+		if in.Loader == nil {
+			return nil, nil
+		}
+
+		var o CacheOptions
+		if err := in.Unmarshaller.UnmarshalKey(configKey, &o); err != nil {
+			return nil, err
+		}
+
+		lc := NewLoaderCache(in.Loader, o, CacheMetrics{Hits: in.Hits, Misses: in.Misses}, in.Logger)
+		in.Lifecycle.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				lc.Start()
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				lc.Stop()
+				return nil
+			},
+		})
+
+		return lc, nil
+	}
+}
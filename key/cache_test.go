@@ -0,0 +1,179 @@
+package key
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingCounter is a metrics.Counter that totals every Add, regardless of labels
+type countingCounter struct {
+	lock  sync.Mutex
+	total float64
+}
+
+func (cc *countingCounter) With(...string) metrics.Counter {
+	return cc
+}
+
+func (cc *countingCounter) Add(delta float64) {
+	cc.lock.Lock()
+	cc.total += delta
+	cc.lock.Unlock()
+}
+
+func (cc *countingCounter) value() float64 {
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+	return cc.total
+}
+
+// slowLoader simulates a remote key service that takes a noticeable amount of time for each load
+type slowLoader struct {
+	delay time.Duration
+	loads int32
+	err   error
+}
+
+func (sl *slowLoader) Load(_ context.Context, d Descriptor) (Pair, error) {
+	atomic.AddInt32(&sl.loads, 1)
+	time.Sleep(sl.delay)
+	if sl.err != nil {
+		return nil, sl.err
+	}
+
+	return GenerateSecretPair(d.Kid, rand.Reader, 256)
+}
+
+func (sl *slowLoader) count() int {
+	return int(atomic.LoadInt32(&sl.loads))
+}
+
+func testLoaderCacheSignsFromCache(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		loader = &slowLoader{delay: 50 * time.Millisecond}
+		hits   = new(countingCounter)
+		misses = new(countingCounter)
+		cache  = NewLoaderCache(loader, CacheOptions{}, CacheMetrics{Hits: hits, Misses: misses}, nil)
+
+		registry = NewCachingRegistry(nil, Metrics{}, cache)
+	)
+
+	p, err := registry.Register(Descriptor{Kid: "remote", Remote: "arn:aws:kms:us-east-1:000000000000:key/test"})
+	require.NoError(err)
+	require.NotNil(p)
+	assert.Equal("remote", p.KID())
+	assert.Equal(1, loader.count())
+
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		assert.NotNil(p.Sign())
+	}
+
+	// a single remote load would take longer than every cached sign put together
+	assert.Less(int64(time.Since(start)), int64(loader.delay))
+	assert.Equal(1, loader.count())
+	assert.Equal(100.0, hits.value())
+	assert.Zero(misses.value())
+}
+
+func testLoaderCacheRefresh(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		loader = &slowLoader{}
+		cache  = NewLoaderCache(loader, CacheOptions{}, CacheMetrics{}, nil)
+	)
+
+	p, err := cache.Preload(Descriptor{Kid: "remote", Remote: "test"})
+	require.NoError(err)
+	first := p.Sign()
+
+	assert.Empty(cache.Refresh())
+	assert.Equal(2, loader.count())
+	assert.NotEqual(first, p.Sign())
+
+	// a failed reload leaves the previously loaded key in place
+	current := p.Sign()
+	loader.err = errors.New("expected")
+	errs := cache.Refresh()
+	require.Len(errs, 1)
+	assert.Equal(KeyUnavailableError{Kid: "remote", Err: loader.err}, errs[0])
+	assert.Equal(current, p.Sign())
+
+	var jwk bytes.Buffer
+	_, err = p.WriteJWK(&jwk)
+	assert.NoError(err)
+	assert.NotEmpty(jwk.String())
+}
+
+func testLoaderCacheScheduled(t *testing.T) {
+	var (
+		require = require.New(t)
+
+		loader = &slowLoader{}
+		cache  = NewLoaderCache(loader, CacheOptions{RefreshInterval: time.Millisecond}, CacheMetrics{}, nil)
+	)
+
+	_, err := cache.Preload(Descriptor{Kid: "remote", Remote: "test"})
+	require.NoError(err)
+
+	cache.Start()
+	cache.Start()
+	require.Eventually(
+		func() bool { return loader.count() > 2 },
+		time.Second,
+		time.Millisecond,
+	)
+
+	cache.Stop()
+	cache.Stop()
+	count := loader.count()
+	time.Sleep(10 * time.Millisecond)
+	require.Equal(count, loader.count())
+}
+
+func testLoaderCachePreloadFailure(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		loader   = &slowLoader{err: errors.New("expected")}
+		registry = NewCachingRegistry(nil, Metrics{}, NewLoaderCache(loader, CacheOptions{}, CacheMetrics{}, nil))
+	)
+
+	p, err := registry.Register(Descriptor{Kid: "remote", Remote: "test"})
+	assert.Nil(p)
+	assert.True(errors.Is(err, loader.err))
+	assert.Empty(registry.Kids())
+
+	p, err = registry.Register(Descriptor{Remote: "test"})
+	assert.Nil(p)
+	assert.Equal(ErrRemoteKidRequired, err)
+}
+
+func testLoaderCacheNoLoader(t *testing.T) {
+	p, err := NewRegistry(nil).Register(Descriptor{Kid: "remote", Remote: "test"})
+	assert.Nil(t, p)
+	assert.Equal(t, ErrNoLoader, err)
+}
+
+func TestLoaderCache(t *testing.T) {
+	t.Run("SignsFromCache", testLoaderCacheSignsFromCache)
+	t.Run("Refresh", testLoaderCacheRefresh)
+	t.Run("Scheduled", testLoaderCacheScheduled)
+	t.Run("PreloadFailure", testLoaderCachePreloadFailure)
+	t.Run("NoLoader", testLoaderCacheNoLoader)
+}
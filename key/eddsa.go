@@ -0,0 +1,96 @@
+package key
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// AlgEdDSA is the RFC 8037 JWS algorithm for Ed25519 keys.  Unlike the RFC 7518 algorithms, its name is mixed case.
+const AlgEdDSA = "EdDSA"
+
+var ErrInvalidEd25519JWK = errors.New("An Ed25519 JWK must be an OKP key with an Ed25519 curve and a 32 byte x member")
+
+// signingMethodEdDSA is the EdDSA signing method for Ed25519 keys, which jwt-go does not provide
+type signingMethodEdDSA struct{}
+
+// SigningMethodEdDSA signs tokens with Ed25519 keys.  It is registered with jwt-go, so any package that imports
+// this one can parse and verify EdDSA tokens with jwt.Parse given an ed25519.PublicKey.
+var SigningMethodEdDSA jwt.SigningMethod = signingMethodEdDSA{}
+
+func init() {
+	jwt.RegisterSigningMethod(AlgEdDSA, func() jwt.SigningMethod {
+		return SigningMethodEdDSA
+	})
+}
+
+func (signingMethodEdDSA) Alg() string {
+	return AlgEdDSA
+}
+
+// Sign accepts an ed25519.PrivateKey, or any crypto.Signer with an Ed25519 public key such as a remote signer
+func (signingMethodEdDSA) Sign(signingString string, key interface{}) (string, error) {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+
+	if _, ok := signer.Public().(ed25519.PublicKey); !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+
+	// Ed25519 signs the message itself rather than a digest, which crypto.Hash(0) indicates
+	signature, err := signer.Sign(nil, []byte(signingString), crypto.Hash(0))
+	if err != nil {
+		return "", err
+	}
+
+	return jwt.EncodeSegment(signature), nil
+}
+
+func (signingMethodEdDSA) Verify(signingString, signature string, key interface{}) error {
+	public, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+
+	decoded, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(public, []byte(signingString), decoded) {
+		return jwt.ErrSignatureInvalid
+	}
+
+	return nil
+}
+
+// ed25519JWK returns the RFC 8037 OKP representation of an Ed25519 public key, with its members in
+// lexicographic order as required for an RFC 7638 thumbprint
+func ed25519JWK(public ed25519.PublicKey) map[string]string {
+	return map[string]string{
+		"crv": "Ed25519",
+		"kty": "OKP",
+		"x":   base64.RawURLEncoding.EncodeToString(public),
+	}
+}
+
+// ParseEd25519JWK extracts the public key from a decoded RFC 8037 OKP JWK.  The JWK libraries this module
+// uses predate RFC 8037, so Ed25519 keys must be parsed with this function instead.
+func ParseEd25519JWK(jwk map[string]interface{}) (ed25519.PublicKey, error) {
+	if jwk["kty"] != "OKP" || jwk["crv"] != "Ed25519" {
+		return nil, ErrInvalidEd25519JWK
+	}
+
+	x, _ := jwk["x"].(string)
+	public, err := base64.RawURLEncoding.DecodeString(x)
+	if err != nil || len(public) != ed25519.PublicKeySize {
+		return nil, ErrInvalidEd25519JWK
+	}
+
+	return ed25519.PublicKey(public), nil
+}
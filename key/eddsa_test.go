@@ -0,0 +1,109 @@
+package key
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSigningMethodEdDSA(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(err)
+
+	assert.Equal(SigningMethodEdDSA, jwt.GetSigningMethod("EdDSA"))
+	signed, err := jwt.NewWithClaims(SigningMethodEdDSA, jwt.MapClaims{"sub": "test"}).SignedString(private)
+	require.NoError(err)
+
+	token, err := jwt.Parse(signed, func(*jwt.Token) (interface{}, error) {
+		return public, nil
+	})
+
+	require.NoError(err)
+	assert.True(token.Valid)
+	assert.Equal("EdDSA", token.Header["alg"])
+
+	// a different key does not verify the token
+	other, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(err)
+	_, err = jwt.Parse(signed, func(*jwt.Token) (interface{}, error) {
+		return other, nil
+	})
+
+	assert.Error(err)
+
+	// keys of other types are rejected
+	_, err = SigningMethodEdDSA.Sign("test", []byte("secret"))
+	assert.Equal(jwt.ErrInvalidKeyType, err)
+	assert.Equal(jwt.ErrInvalidKeyType, SigningMethodEdDSA.Verify("test", "", []byte("secret")))
+}
+
+func TestGenerateEd25519Pair(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	p, err := NewRegistry(nil).Register(Descriptor{Kid: "test", Type: KeyTypeEd25519})
+	require.NoError(err)
+	require.IsType(ed25519.PrivateKey{}, p.Sign())
+
+	var published bytes.Buffer
+	_, err = p.WriteJWK(&published)
+	require.NoError(err)
+
+	var jwk map[string]interface{}
+	require.NoError(json.Unmarshal(published.Bytes(), &jwk))
+	assert.Equal("OKP", jwk["kty"])
+	assert.Equal("Ed25519", jwk["crv"])
+	assert.NotContains(jwk, "d")
+
+	public, err := ParseEd25519JWK(jwk)
+	require.NoError(err)
+	assert.Equal(p.Sign().(ed25519.PrivateKey).Public(), public)
+
+	var pemBlock bytes.Buffer
+	_, err = p.WriteVerifyPEMTo(&pemBlock)
+	require.NoError(err)
+	assert.Contains(pemBlock.String(), "PUBLIC KEY")
+
+	// the key survives a round trip through a key file
+	dir, err := ioutil.TempDir("", "eddsa")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "signing.pem")
+	require.NoError(WritePair(p, file))
+	loaded, err := NewRegistry(nil).Register(Descriptor{Kid: "test", Type: KeyTypeEd25519, File: file})
+	require.NoError(err)
+	assert.Equal(p.Sign(), loaded.Sign())
+}
+
+func TestParseEd25519JWK(t *testing.T) {
+	testData := []map[string]interface{}{
+		{"kty": "RSA", "crv": "Ed25519", "x": "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"},
+		{"kty": "OKP", "crv": "X25519", "x": "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"},
+		{"kty": "OKP", "crv": "Ed25519"},
+		{"kty": "OKP", "crv": "Ed25519", "x": "not base64!"},
+		{"kty": "OKP", "crv": "Ed25519", "x": "AAAA"},
+	}
+
+	for _, jwk := range testData {
+		public, err := ParseEd25519JWK(jwk)
+		assert.Nil(t, public)
+		assert.Equal(t, ErrInvalidEd25519JWK, err)
+	}
+}
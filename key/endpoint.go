@@ -1,9 +1,13 @@
 package key
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"time"
 
 	"github.com/go-kit/kit/endpoint"
 )
@@ -31,3 +35,133 @@ func NewEndpoint(r Registry) endpoint.Endpoint {
 		return pair, nil
 	}
 }
+
+// Usage describes how a single key has been used
+type Usage struct {
+	// LastUsed is the last time the key signed something.  This field is nil if the key has never been used.
+	LastUsed *time.Time `json:"lastUsed"`
+}
+
+// NewUsageEndpoint returns a go-kit endpoint that reports the Usage of every key in a Registry, keyed by kid
+func NewUsageEndpoint(r Registry) endpoint.Endpoint {
+	return func(ctx context.Context, _ interface{}) (interface{}, error) {
+		usage := make(map[string]Usage)
+		for _, kid := range r.Kids() {
+			var u Usage
+			if lastUsed, ok := r.LastUsed(kid); ok {
+				lastUsed = lastUsed.UTC()
+				u.LastUsed = &lastUsed
+			}
+
+			usage[kid] = u
+		}
+
+		return usage, nil
+	}
+}
+
+// KeySet is the JSON Web Key Set representation of the keys in a Registry, as defined by RFC 7517
+type KeySet struct {
+	Keys []map[string]interface{} `json:"keys"`
+
+	// pairs are the published key Pairs, in the same order as Keys
+	pairs []Pair
+
+	// next is the page that follows this one, or nil if this KeySet holds the last of the keys
+	next *KeySetPage
+}
+
+// KeySetPage selects a contiguous run of the published keys, which are ordered by kid.  The zero value selects
+// every key.  A Limit of zero places no bound on the number of keys.
+type KeySetPage struct {
+	Offset int
+	Limit  int
+}
+
+// apply restricts a KeySet holding every published key to this page
+func (p KeySetPage) apply(ks KeySet) KeySet {
+	total := len(ks.Keys)
+	start := p.Offset
+	if start > total {
+		start = total
+	}
+
+	end := total
+	// compared against the remaining keys so that a very large limit cannot overflow
+	if p.Limit > 0 && p.Limit < total-start {
+		end = start + p.Limit
+		ks.next = &KeySetPage{Offset: end, Limit: p.Limit}
+	}
+
+	ks.Keys = ks.Keys[start:end]
+	ks.pairs = ks.pairs[start:end]
+	return ks
+}
+
+// WritePEMTo writes the verify key of each published Pair as a single PEM bundle.  Each PEM block is
+// preceded by a line of explanatory text naming its kid, which PEM parsers ignore.
+func (ks KeySet) WritePEMTo(w io.Writer) (int64, error) {
+	var total int64
+	for _, pair := range ks.pairs {
+		c, err := fmt.Fprintf(w, "kid: %s\n", pair.KID())
+		total += int64(c)
+		if err != nil {
+			return total, err
+		}
+
+		n, err := pair.WriteVerifyPEMTo(w)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+
+	return total, nil
+}
+
+// NewKeySetEndpoint returns a go-kit endpoint that produces a KeySet containing the public portion of every
+// key in a Registry, including staged keys that have not yet been promoted.  Symmetric keys are never
+// published, since their JWK representation would reveal the secret.  Keys with a pinned algorithm are published with it as
+// their alg member.
+//
+// If the request is a KeySetPage, only the keys on that page are produced.  Any other request produces every key.
+func NewKeySetEndpoint(r Registry) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		ks := KeySet{Keys: make([]map[string]interface{}, 0)}
+		for _, kid := range r.Kids() {
+			pair, ok := r.Get(kid)
+			if !ok {
+				continue
+			}
+
+			var buffer bytes.Buffer
+			if _, err := pair.WriteJWK(&buffer); err != nil {
+				return nil, err
+			}
+
+			var jwk map[string]interface{}
+			if err := json.Unmarshal(buffer.Bytes(), &jwk); err != nil {
+				return nil, err
+			}
+
+			if jwk["kty"] == "oct" {
+				continue
+			}
+
+			jwk["kid"] = kid
+			jwk["use"] = "sig"
+			if alg, ok := r.Alg(kid); ok {
+				jwk["alg"] = alg
+			}
+
+			ks.Keys = append(ks.Keys, jwk)
+			ks.pairs = append(ks.pairs, pair)
+		}
+
+		if page, ok := request.(KeySetPage); ok {
+			ks = page.apply(ks)
+		}
+
+		return ks, nil
+	}
+}
@@ -2,6 +2,7 @@ package key
 
 import (
 	"context"
+	"math"
 	"net/http"
 	"testing"
 
@@ -55,3 +56,115 @@ func TestNewEndpoint(t *testing.T) {
 		assert.Equal(http.StatusNotFound, knfe.StatusCode())
 	})
 }
+
+func TestNewUsageEndpoint(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		registry = NewRegistry(nil)
+		endpoint = NewUsageEndpoint(registry)
+	)
+
+	require.NotNil(endpoint)
+	_, err := registry.Register(Descriptor{Kid: "used"})
+	require.NoError(err)
+	_, err = registry.Register(Descriptor{Kid: "unused"})
+	require.NoError(err)
+
+	registry.Used("used")
+	result, err := endpoint(context.Background(), nil)
+	require.NoError(err)
+
+	usage, ok := result.(map[string]Usage)
+	require.True(ok)
+	require.Len(usage, 2)
+	assert.NotNil(usage["used"].LastUsed)
+	assert.Nil(usage["unused"].LastUsed)
+}
+
+func TestNewKeySetEndpoint(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		registry = NewRegistry(nil)
+		endpoint = NewKeySetEndpoint(registry)
+	)
+
+	require.NotNil(endpoint)
+	_, err := registry.Register(Descriptor{Kid: "rsa", Bits: 512})
+	require.NoError(err)
+	_, err = registry.Register(Descriptor{Kid: "secret", Type: KeyTypeSecret})
+	require.NoError(err)
+	_, err = registry.Stage(Descriptor{Kid: "staged", Type: KeyTypeECDSA, Alg: "ES384"})
+	require.NoError(err)
+	_, err = registry.Register(Descriptor{Kid: "sts", Type: KeyTypeEd25519, Alg: "EdDSA"})
+	require.NoError(err)
+
+	result, err := endpoint(context.Background(), nil)
+	require.NoError(err)
+
+	ks, ok := result.(KeySet)
+	require.True(ok)
+	require.Len(ks.Keys, 3)
+
+	assert.Equal("rsa", ks.Keys[0]["kid"])
+	assert.Equal("RSA", ks.Keys[0]["kty"])
+	assert.Equal("sig", ks.Keys[0]["use"])
+	assert.NotContains(ks.Keys[0], "d")
+	assert.NotContains(ks.Keys[0], "alg")
+
+	assert.Equal("staged", ks.Keys[1]["kid"])
+	assert.Equal("EC", ks.Keys[1]["kty"])
+	assert.Equal("sig", ks.Keys[1]["use"])
+	assert.Equal("ES384", ks.Keys[1]["alg"])
+	assert.NotContains(ks.Keys[1], "d")
+
+	assert.Equal("sts", ks.Keys[2]["kid"])
+	assert.Equal("OKP", ks.Keys[2]["kty"])
+	assert.Equal("Ed25519", ks.Keys[2]["crv"])
+	assert.Equal("EdDSA", ks.Keys[2]["alg"])
+	assert.NotContains(ks.Keys[2], "d")
+}
+
+func TestNewKeySetEndpointPage(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		registry = NewRegistry(nil)
+		endpoint = NewKeySetEndpoint(registry)
+	)
+
+	for _, kid := range []string{"a", "b", "c"} {
+		_, err := registry.Register(Descriptor{Kid: kid, Type: KeyTypeECDSA})
+		require.NoError(err)
+	}
+
+	testData := []struct {
+		page     KeySetPage
+		expected []string
+		next     *KeySetPage
+	}{
+		{KeySetPage{}, []string{"a", "b", "c"}, nil},
+		{KeySetPage{Limit: 2}, []string{"a", "b"}, &KeySetPage{Offset: 2, Limit: 2}},
+		{KeySetPage{Offset: 2, Limit: 2}, []string{"c"}, nil},
+		{KeySetPage{Offset: 1, Limit: 2}, []string{"b", "c"}, nil},
+		{KeySetPage{Offset: 5, Limit: 2}, []string{}, nil},
+		{KeySetPage{Offset: 1, Limit: math.MaxInt64}, []string{"b", "c"}, nil},
+		{KeySetPage{Offset: math.MaxInt64, Limit: math.MaxInt64}, []string{}, nil},
+	}
+
+	for _, record := range testData {
+		result, err := endpoint(context.Background(), record.page)
+		require.NoError(err)
+
+		ks := result.(KeySet)
+		kids := make([]string, 0, len(ks.Keys))
+		for _, k := range ks.Keys {
+			kids = append(kids, k["kid"].(string))
+		}
+
+		assert.Equal(record.expected, kids)
+		assert.Len(ks.pairs, len(ks.Keys))
+		assert.Equal(record.next, ks.next)
+	}
+}
@@ -0,0 +1,42 @@
+package key
+
+import "go.uber.org/fx"
+
+// ListenersGroup is the uber/fx value group from which each Registry collects its Listeners
+const ListenersGroup = "key.listeners"
+
+// EventType describes a state transition of a key Pair within a Registry
+type EventType string
+
+const (
+	// EventAdded indicates that a Pair was registered
+	EventAdded EventType = "added"
+
+	// EventStaged indicates that a Pair was staged as the next key
+	EventStaged EventType = "staged"
+
+	// EventActivated indicates that a Pair became the active key, either by being activated or promoted
+	EventActivated EventType = "activated"
+
+	// EventPruned indicates that a Pair was removed
+	EventPruned EventType = "pruned"
+)
+
+// Event is a single state transition of a key Pair
+type Event struct {
+	Kid  string
+	Type EventType
+}
+
+// Listener is a callback invoked for each Event in a Registry.  Listeners are invoked synchronously, after the
+// transition has taken effect, so a slow Listener delays the operation that caused the Event.
+type Listener func(Event)
+
+// Annotated emits this Listener into the ListenersGroup value group, so that it is subscribed to every Registry
+// this package provides
+func (l Listener) Annotated() fx.Annotated {
+	return fx.Annotated{
+		Group:  ListenersGroup,
+		Target: func() Listener { return l },
+	}
+}
@@ -0,0 +1,81 @@
+package key
+
+import (
+	"fmt"
+
+	"github.com/xmidt-org/themis/config"
+
+	"go.uber.org/fx"
+)
+
+// UnknownGroupError indicates that a component referred to a key group that was never configured
+type UnknownGroupError struct {
+	Group string
+}
+
+func (uge UnknownGroupError) Error() string {
+	return fmt.Sprintf("No key group named %s is configured", uge.Group)
+}
+
+// Registries holds a separate Registry for each key group, keyed by group name.  The keys in one group are
+// disjoint from every other group, including the default Registry.
+type Registries map[string]Registry
+
+// Get returns the Registry for the named group, or an UnknownGroupError if there is no such group
+func (rs Registries) Get(group string) (Registry, error) {
+	if r, ok := rs[group]; ok {
+		return r, nil
+	}
+
+	return nil, UnknownGroupError{Group: group}
+}
+
+// KeySetHandlers holds the JWK set handler for each key group, keyed by group name.  Each handler serves only
+// the keys in its own group.
+type KeySetHandlers map[string]HandlerJWKSet
+
+// GroupsIn is the set of dependencies for creating key groups
+type GroupsIn struct {
+	fx.In
+	KeyIn
+
+	Unmarshaller config.Unmarshaller
+}
+
+// GroupsOut is the set of components emitted for key groups
+type GroupsOut struct {
+	fx.Out
+
+	Registries     Registries
+	KeySetHandlers KeySetHandlers
+}
+
+// NewGroups creates a Registry and JWK set handler for each of the given group names.  Each Registry has the
+// same source of randomness and metrics as the default Registry created by Provide.
+func NewGroups(in KeyIn, names ...string) GroupsOut {
+	out := GroupsOut{
+		Registries:     make(Registries, len(names)),
+		KeySetHandlers: make(KeySetHandlers, len(names)),
+	}
+
+	for _, name := range names {
+		registry := in.newRegistry()
+		out.Registries[name] = registry
+		out.KeySetHandlers[name] = NewHandlerJWKSet(NewKeySetEndpoint(registry))
+	}
+
+	return out
+}
+
+// UnmarshalGroups returns an uber/fx provider of key groups.  The configuration key holds the list of group
+// names.  If the configuration key is not present, no groups are created.
+func UnmarshalGroups(configKey string) func(GroupsIn) (GroupsOut, error) {
+	return func(in GroupsIn) (GroupsOut, error) {
+		var names []string
+		if err := in.Unmarshaller.UnmarshalKey(configKey, &names); err != nil {
+			return GroupsOut{}, err
+		}
+
+		return NewGroups(in.KeyIn, names...), nil
+	}
+}
@@ -0,0 +1,151 @@
+package key
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/xmidt-org/themis/config"
+	"github.com/xmidt-org/themis/xlog"
+
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+func TestUnknownGroupError(t *testing.T) {
+	assert.Contains(t, UnknownGroupError{Group: "nosuch"}.Error(), "nosuch")
+}
+
+// publishedKids returns the kids served by a JWK set handler
+func publishedKids(t *testing.T, handler HandlerJWKSet) []string {
+	var (
+		require  = require.New(t)
+		response = httptest.NewRecorder()
+	)
+
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+	require.Equal(http.StatusOK, response.Code)
+
+	set, err := jwk.Parse(response.Body)
+	require.NoError(err)
+
+	var kids []string
+	for _, k := range set.Keys {
+		kids = append(kids, k.KeyID())
+	}
+
+	return kids
+}
+
+func testUnmarshalGroupsSuccess(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		defaultRegistry Registry
+		registries      Registries
+		handlers        KeySetHandlers
+
+		app = fxtest.New(t,
+			fx.Provide(
+				config.ProvideViper(
+					config.Json(`
+						{
+							"keyGroups": ["access", "refresh"]
+						}
+					`),
+				),
+				Provide,
+				UnmarshalGroups("keyGroups"),
+			),
+			fx.Populate(&defaultRegistry, &registries, &handlers),
+		)
+	)
+
+	app.RequireStart()
+	defer app.RequireStop()
+
+	require.Len(registries, 2)
+	require.Len(handlers, 2)
+
+	access, err := registries.Get("access")
+	require.NoError(err)
+	refresh, err := registries.Get("refresh")
+	require.NoError(err)
+
+	_, err = registries.Get("nosuch")
+	assert.Equal(UnknownGroupError{Group: "nosuch"}, err)
+
+	_, err = defaultRegistry.Register(Descriptor{Kid: "default", Bits: 512})
+	require.NoError(err)
+	_, err = access.Register(Descriptor{Kid: "access-1", Bits: 512})
+	require.NoError(err)
+	_, err = access.Register(Descriptor{Kid: "access-2", Bits: 512})
+	require.NoError(err)
+	_, err = refresh.Register(Descriptor{Kid: "refresh-1", Bits: 512})
+	require.NoError(err)
+
+	assert.ElementsMatch([]string{"access-1", "access-2"}, publishedKids(t, handlers["access"]))
+	assert.ElementsMatch([]string{"refresh-1"}, publishedKids(t, handlers["refresh"]))
+
+	_, ok := defaultRegistry.Get("access-1")
+	assert.False(ok)
+	_, ok = access.Get("refresh-1")
+	assert.False(ok)
+}
+
+func testUnmarshalGroupsNotConfigured(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		registries Registries
+		handlers   KeySetHandlers
+
+		app = fxtest.New(t,
+			fx.Provide(
+				config.ProvideViper(),
+				UnmarshalGroups("keyGroups"),
+			),
+			fx.Populate(&registries, &handlers),
+		)
+	)
+
+	app.RequireStart()
+	app.RequireStop()
+	assert.Empty(registries)
+	assert.Empty(handlers)
+}
+
+func testUnmarshalGroupsError(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		registries Registries
+		app        = fx.New(
+			fx.Logger(xlog.DiscardPrinter{}),
+			fx.Provide(
+				config.ProvideViper(
+					config.Json(`
+						{
+							"keyGroups": {"this": {"is": "not a list"}}
+						}
+					`),
+				),
+				UnmarshalGroups("keyGroups"),
+			),
+			fx.Populate(&registries),
+		)
+	)
+
+	assert.Error(app.Err())
+	assert.Nil(registries)
+}
+
+func TestUnmarshalGroups(t *testing.T) {
+	t.Run("Success", testUnmarshalGroupsSuccess)
+	t.Run("NotConfigured", testUnmarshalGroupsNotConfigured)
+	t.Run("Error", testUnmarshalGroupsError)
+}
@@ -2,8 +2,13 @@ package key
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 
 	"github.com/xmidt-org/themis/xlog"
 
@@ -16,12 +21,28 @@ import (
 const (
 	ContentTypePEM = "application/x-pem-file"
 	ContentTypeJWK = "application/json"
+
+	ContentTypeJWKSet = "application/jwk-set+json"
 )
 
 var (
 	ErrNoKidVariable = errors.New("No kid variable in URI definition")
 )
 
+// InvalidPageParameterError indicates that a JWK set request had a limit or offset that was not a valid number
+type InvalidPageParameterError struct {
+	Name  string
+	Value string
+}
+
+func (ippe InvalidPageParameterError) Error() string {
+	return fmt.Sprintf("Invalid %s parameter: %s", ippe.Name, ippe.Value)
+}
+
+func (ippe InvalidPageParameterError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
 type Handler http.Handler
 
 func NewHandler(e endpoint.Endpoint) Handler {
@@ -75,3 +96,140 @@ func NewHandlerJWK(e endpoint.Endpoint) Handler {
 		},
 	)
 }
+
+type UsageHandler http.Handler
+
+// NewUsageHandler produces an http.Handler that serves the usage information from a NewUsageEndpoint
+func NewUsageHandler(e endpoint.Endpoint) UsageHandler {
+	return kithttp.NewServer(
+		e,
+		kithttp.NopRequestDecoder,
+		kithttp.EncodeJSONResponse,
+	)
+}
+
+// acceptQuality returns the highest quality an Accept header assigns to any of the given media types.
+// Wildcard ranges only match if matchWildcards is true.  A missing Accept header accepts everything.
+func acceptQuality(accept string, matchWildcards bool, mediaTypes ...string) float64 {
+	if len(strings.TrimSpace(accept)) == 0 {
+		if matchWildcards {
+			return 1.0
+		}
+
+		return 0.0
+	}
+
+	var best float64
+	for _, r := range strings.Split(accept, ",") {
+		parts := strings.Split(r, ";")
+		mediaRange := strings.ToLower(strings.TrimSpace(parts[0]))
+		matched := matchWildcards && (mediaRange == "*/*" || mediaRange == "application/*")
+		for _, mt := range mediaTypes {
+			matched = matched || mediaRange == mt
+		}
+
+		if !matched {
+			continue
+		}
+
+		q := 1.0
+		for _, p := range parts[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				if v, err := strconv.ParseFloat(p[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+
+		if q > best {
+			best = q
+		}
+	}
+
+	return best
+}
+
+// prefersPEM tests whether an Accept header asks for a PEM bundle at least as strongly as for JSON
+func prefersPEM(accept string) bool {
+	pem := acceptQuality(accept, false, ContentTypePEM)
+	return pem > 0.0 && pem >= acceptQuality(accept, true, ContentTypeJWKSet, ContentTypeJWK)
+}
+
+// decodeKeySetPage produces a KeySetPage from the limit and offset query parameters.  If neither is present,
+// the request is nil so that the full KeySet is served.
+func decodeKeySetPage(_ context.Context, request *http.Request) (interface{}, error) {
+	query := request.URL.Query()
+	if _, ok := query["limit"]; !ok {
+		if _, ok := query["offset"]; !ok {
+			return nil, nil
+		}
+	}
+
+	var page KeySetPage
+	for _, p := range []struct {
+		name  string
+		min   int
+		value *int
+	}{
+		{"limit", 1, &page.Limit},
+		{"offset", 0, &page.Offset},
+	} {
+		v, ok := query[p.name]
+		if !ok {
+			continue
+		}
+
+		n, err := strconv.Atoi(v[0])
+		if err != nil || n < p.min {
+			return nil, InvalidPageParameterError{Name: p.name, Value: v[0]}
+		}
+
+		*p.value = n
+	}
+
+	return page, nil
+}
+
+// nextLink produces the RFC 8288 Link header value for the page following a KeySet
+func nextLink(ctx context.Context, next KeySetPage) string {
+	path, _ := ctx.Value(kithttp.ContextKeyRequestPath).(string)
+	query := url.Values{
+		"limit":  []string{strconv.Itoa(next.Limit)},
+		"offset": []string{strconv.Itoa(next.Offset)},
+	}
+
+	return fmt.Sprintf(`<%s?%s>; rel="next"`, path, query.Encode())
+}
+
+type HandlerJWKSet http.Handler
+
+// NewHandlerJWKSet produces an http.Handler that serves the KeySet from a NewKeySetEndpoint.  The KeySet is written
+// as JSON by default.  If the Accept header prefers application/x-pem-file, the verify keys are instead written as
+// a single PEM bundle.
+//
+// Clients may page through a large KeySet with the limit and offset query parameters.  When more keys follow
+// the requested page, a Link header with a rel of next is written.  With neither parameter, every key is served.
+func NewHandlerJWKSet(e endpoint.Endpoint) HandlerJWKSet {
+	return kithttp.NewServer(
+		e,
+		decodeKeySetPage,
+		func(ctx context.Context, response http.ResponseWriter, value interface{}) error {
+			response.Header().Add("Vary", "Accept")
+			if ks, ok := value.(KeySet); ok && ks.next != nil {
+				response.Header().Set("Link", nextLink(ctx, *ks.next))
+			}
+
+			accept, _ := ctx.Value(kithttp.ContextKeyRequestAccept).(string)
+			if ks, ok := value.(KeySet); ok && prefersPEM(accept) {
+				response.Header().Set("Content-Type", ContentTypePEM)
+				_, err := ks.WritePEMTo(response)
+				return err
+			}
+
+			response.Header().Set("Content-Type", ContentTypeJWKSet)
+			return json.NewEncoder(response).Encode(value)
+		},
+		kithttp.ServerBefore(kithttp.PopulateRequestContext),
+	)
+}
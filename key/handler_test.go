@@ -3,9 +3,12 @@ package key
 import (
 	"context"
 	"encoding/pem"
+	"fmt"
 	"io/ioutil"
+	"math"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/xmidt-org/themis/xlog"
@@ -165,3 +168,249 @@ func TestNewHandlerJWK(t *testing.T) {
 		assert.Equal(http.StatusInternalServerError, response.Code)
 	})
 }
+
+func TestNewUsageHandler(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		registry = NewRegistry(nil)
+		handler  = NewUsageHandler(NewUsageEndpoint(registry))
+		response = httptest.NewRecorder()
+		request  = httptest.NewRequest("GET", "/", nil)
+	)
+
+	_, err := registry.Register(Descriptor{Kid: "test"})
+	require.NoError(err)
+
+	handler.ServeHTTP(response, request)
+	assert.Equal(http.StatusOK, response.Code)
+	assert.JSONEq(`{"test": {"lastUsed": null}}`, response.Body.String())
+}
+
+func TestNewHandlerJWKSet(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		registry = NewRegistry(nil)
+		handler  = NewHandlerJWKSet(NewKeySetEndpoint(registry))
+		response = httptest.NewRecorder()
+		request  = httptest.NewRequest("GET", "/", nil)
+	)
+
+	_, err := registry.Register(Descriptor{Kid: "current", Bits: 512})
+	require.NoError(err)
+	_, err = registry.Stage(Descriptor{Kid: "next", Bits: 512})
+	require.NoError(err)
+
+	handler.ServeHTTP(response, request)
+	assert.Equal(http.StatusOK, response.Code)
+	assert.Equal(ContentTypeJWKSet, response.Header().Get("Content-Type"))
+
+	assert.Empty(response.Header().Get("Link"))
+
+	set, err := jwk.Parse(response.Body)
+	require.NoError(err)
+	assert.Len(set.LookupKeyID("current"), 1)
+	assert.Len(set.LookupKeyID("next"), 1)
+}
+
+func testNewHandlerJWKSetPaginated(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		registry = NewRegistry(nil)
+		handler  = NewHandlerJWKSet(NewKeySetEndpoint(registry))
+	)
+
+	for _, kid := range []string{"a", "b", "c", "d", "e"} {
+		_, err := registry.Register(Descriptor{Kid: kid, Type: KeyTypeECDSA})
+		require.NoError(err)
+	}
+
+	var (
+		kids  []string
+		links []string
+		uri   = "/keys?limit=2"
+	)
+
+	for len(uri) > 0 {
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, httptest.NewRequest("GET", uri, nil))
+		require.Equal(http.StatusOK, response.Code)
+
+		set, err := jwk.Parse(response.Body)
+		require.NoError(err)
+		assert.True(len(set.Keys) <= 2)
+		for _, k := range set.Keys {
+			kids = append(kids, k.KeyID())
+		}
+
+		uri = ""
+		if link := response.Header().Get("Link"); len(link) > 0 {
+			links = append(links, link)
+			require.True(strings.HasPrefix(link, "<"))
+			uri = link[1:strings.IndexByte(link, '>')]
+		}
+	}
+
+	assert.Equal([]string{"a", "b", "c", "d", "e"}, kids)
+	assert.Equal(
+		[]string{
+			`</keys?limit=2&offset=2>; rel="next"`,
+			`</keys?limit=2&offset=4>; rel="next"`,
+		},
+		links,
+	)
+}
+
+func testNewHandlerJWKSetOffsetOnly(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		registry = NewRegistry(nil)
+		handler  = NewHandlerJWKSet(NewKeySetEndpoint(registry))
+		response = httptest.NewRecorder()
+	)
+
+	for _, kid := range []string{"a", "b", "c"} {
+		_, err := registry.Register(Descriptor{Kid: kid, Type: KeyTypeECDSA})
+		require.NoError(err)
+	}
+
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/keys?offset=1", nil))
+	require.Equal(http.StatusOK, response.Code)
+	assert.Empty(response.Header().Get("Link"))
+
+	set, err := jwk.Parse(response.Body)
+	require.NoError(err)
+	require.Len(set.Keys, 2)
+	assert.Equal("b", set.Keys[0].KeyID())
+	assert.Equal("c", set.Keys[1].KeyID())
+}
+
+func testNewHandlerJWKSetMaxLimit(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		registry = NewRegistry(nil)
+		handler  = NewHandlerJWKSet(NewKeySetEndpoint(registry))
+		response = httptest.NewRecorder()
+	)
+
+	for _, kid := range []string{"a", "b", "c"} {
+		_, err := registry.Register(Descriptor{Kid: kid, Type: KeyTypeECDSA})
+		require.NoError(err)
+	}
+
+	handler.ServeHTTP(response, httptest.NewRequest("GET", fmt.Sprintf("/keys?limit=%d&offset=1", math.MaxInt64), nil))
+	require.Equal(http.StatusOK, response.Code)
+	assert.Empty(response.Header().Get("Link"))
+
+	set, err := jwk.Parse(response.Body)
+	require.NoError(err)
+	require.Len(set.Keys, 2)
+	assert.Equal("b", set.Keys[0].KeyID())
+	assert.Equal("c", set.Keys[1].KeyID())
+}
+
+func testNewHandlerJWKSetInvalidPage(t *testing.T) {
+	handler := NewHandlerJWKSet(NewKeySetEndpoint(NewRegistry(nil)))
+	for _, query := range []string{"limit=0", "limit=-1", "limit=abc", "offset=-1", "offset=abc", "limit=2&offset=x"} {
+		t.Run(query, func(t *testing.T) {
+			response := httptest.NewRecorder()
+			handler.ServeHTTP(response, httptest.NewRequest("GET", "/keys?"+query, nil))
+			assert.Equal(t, http.StatusBadRequest, response.Code)
+		})
+	}
+}
+
+func TestNewHandlerJWKSetPagination(t *testing.T) {
+	t.Run("Paginated", testNewHandlerJWKSetPaginated)
+	t.Run("OffsetOnly", testNewHandlerJWKSetOffsetOnly)
+	t.Run("MaxLimit", testNewHandlerJWKSetMaxLimit)
+	t.Run("InvalidPage", testNewHandlerJWKSetInvalidPage)
+}
+
+func TestNewHandlerJWKSetNegotiation(t *testing.T) {
+	var (
+		registry = NewRegistry(nil)
+		handler  = NewHandlerJWKSet(NewKeySetEndpoint(registry))
+	)
+
+	_, err := registry.Register(Descriptor{Kid: "current", Bits: 512})
+	require.NoError(t, err)
+	_, err = registry.Stage(Descriptor{Kid: "next", Type: KeyTypeECDSA})
+	require.NoError(t, err)
+	_, err = registry.Register(Descriptor{Kid: "secret", Type: KeyTypeSecret})
+	require.NoError(t, err)
+
+	testData := []struct {
+		accept   string
+		expected string
+	}{
+		{"", ContentTypeJWKSet},
+		{"application/json", ContentTypeJWKSet},
+		{"application/jwk-set+json", ContentTypeJWKSet},
+		{"*/*", ContentTypeJWKSet},
+		{"text/plain", ContentTypeJWKSet},
+		{"application/json, application/x-pem-file;q=0.5", ContentTypeJWKSet},
+		{"application/x-pem-file", ContentTypePEM},
+		{"application/x-pem-file, */*", ContentTypePEM},
+		{"application/json;q=0.5, application/x-pem-file", ContentTypePEM},
+	}
+
+	for _, record := range testData {
+		t.Run(record.accept, func(t *testing.T) {
+			var (
+				assert  = assert.New(t)
+				require = require.New(t)
+
+				response = httptest.NewRecorder()
+				request  = httptest.NewRequest("GET", "/", nil)
+			)
+
+			if len(record.accept) > 0 {
+				request.Header.Set("Accept", record.accept)
+			}
+
+			handler.ServeHTTP(response, request)
+			assert.Equal(http.StatusOK, response.Code)
+			assert.Equal(record.expected, response.Header().Get("Content-Type"))
+			assert.Equal("Accept", response.Header().Get("Vary"))
+
+			if record.expected == ContentTypeJWKSet {
+				set, err := jwk.Parse(response.Body)
+				require.NoError(err)
+				assert.Len(set.Keys, 2)
+				return
+			}
+
+			var (
+				rest = response.Body.Bytes()
+				kids []string
+			)
+
+			for {
+				var block *pem.Block
+				before := string(rest)
+				block, rest = pem.Decode(rest)
+				if block == nil {
+					break
+				}
+
+				assert.Equal("PUBLIC KEY", block.Type)
+				var kid string
+				_, err := fmt.Sscanf(before, "kid: %s\n", &kid)
+				require.NoError(err)
+				kids = append(kids, kid)
+			}
+
+			assert.Equal([]string{"current", "next"}, kids)
+		})
+	}
+}
@@ -2,6 +2,7 @@ package key
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rsa"
 	"crypto/x509"
@@ -11,6 +12,8 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 
 	"github.com/lestrrat-go/jwx/jwk"
 )
@@ -110,6 +113,25 @@ func NewPair(kid string, key interface{}) (Pair, error) {
 			jsonWebKey: jsonWebKey,
 		}, nil
 
+	case ed25519.PrivateKey:
+		public := k.Public().(ed25519.PublicKey)
+		verifyPEM, err := MarshalPKIXPublicKeyToPEM(public)
+		if err != nil {
+			return nil, err
+		}
+
+		jsonWebKey, err := json.MarshalIndent(ed25519JWK(public), "", "  ")
+		if err != nil {
+			return nil, err
+		}
+
+		return pair{
+			kid:        kid,
+			sign:       key,
+			verifyPEM:  verifyPEM,
+			jsonWebKey: jsonWebKey,
+		}, nil
+
 	case []byte:
 		jwkKey, err := jwk.New(k)
 		if err != nil {
@@ -183,6 +205,10 @@ func ReadPairBytes(kid string, data []byte) (Pair, error) {
 		return NewPair(kid, pkcs8)
 	}
 
+	if ecKey, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return NewPair(kid, ecKey)
+	}
+
 	return nil, ErrUnrecognizedKeyData
 }
 
@@ -228,6 +254,17 @@ func GenerateECDSAPair(kid string, random io.Reader, bits int) (Pair, error) {
 	return NewPair(kid, key)
 }
 
+// GenerateEd25519Pair generates an Ed25519 key, for the EdDSA algorithm.  Ed25519 keys have a fixed size,
+// so there is no bits parameter.
+func GenerateEd25519Pair(kid string, random io.Reader) (Pair, error) {
+	_, key, err := ed25519.GenerateKey(random)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPair(kid, key)
+}
+
 func GenerateSecretPair(kid string, random io.Reader, bits int) (Pair, error) {
 	if bits <= 0 {
 		bits = DefaultSecretBits
@@ -241,6 +278,58 @@ func GenerateSecretPair(kid string, random io.Reader, bits int) (Pair, error) {
 	return NewPair(kid, secret)
 }
 
+// MarshalPrivateKeyToPEM encodes a signing key in the form read by ReadPairBytes.  RSA, ECDSA, and Ed25519 keys are
+// marshalled in PKCS #8 format as a PEM block, while secrets are returned as is.
+func MarshalPrivateKeyToPEM(key interface{}) ([]byte, error) {
+	if secret, ok := key.([]byte); ok {
+		return append([]byte(nil), secret...), nil
+	}
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(
+		&pem.Block{
+			Type:  "PRIVATE KEY",
+			Bytes: pkcs8,
+		},
+	), nil
+}
+
+// WritePair writes the signing key of a Pair to a new file, readable only by its owner, in the form read by
+// ReadPair.  The file is written under a temporary name and then renamed, so a partially written key is never
+// left at the given path.
+func WritePair(p Pair, file string) error {
+	data, err := MarshalPrivateKeyToPEM(p.Sign())
+	if err != nil {
+		return err
+	}
+
+	temp, err := ioutil.TempFile(filepath.Dir(file), "."+filepath.Base(file)+".")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(temp.Name())
+	if err := temp.Chmod(0600); err != nil {
+		temp.Close()
+		return err
+	}
+
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+
+	if err := temp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(temp.Name(), file)
+}
+
 // MarshalPKIXPublicKeyToPEM handles marshalling a public key in PKIX format which is
 // then encoded as a PEM block
 func MarshalPKIXPublicKeyToPEM(key interface{}) ([]byte, error) {
@@ -6,6 +6,8 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
 	"testing"
 
@@ -270,4 +272,23 @@ func TestReadPair(t *testing.T) {
 		assert.NotNil(k)
 		assert.True(ok)
 	})
+
+	t.Run("sec1", func(t *testing.T) {
+		var (
+			assert  = assert.New(t)
+			require = require.New(t)
+		)
+
+		expected, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(err)
+		der, err := x509.MarshalECPrivateKey(expected)
+		require.NoError(err)
+
+		p, err := ReadPairBytes("test", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+		require.NoError(err)
+		require.NotNil(p)
+
+		assert.Equal("test", p.KID())
+		assert.Equal(expected, p.Sign())
+	})
 }
@@ -3,6 +3,9 @@ package key
 import (
 	"io"
 
+	"github.com/xmidt-org/themis/clock"
+
+	"github.com/go-kit/kit/metrics"
 	"go.uber.org/fx"
 )
 
@@ -13,6 +16,49 @@ type KeyIn struct {
 	// Random is the optional source of randomness.  If not present in the container,
 	// crypto/rand.Reader is used.
 	Random io.Reader `optional:"true"`
+
+	// SignCount is the optional counter incremented each time a key signs.  It must accept a KidLabel label.
+	SignCount metrics.Counter `name:"key_sign_count" optional:"true"`
+
+	// LastUsed is the optional gauge holding the Unix time each key last signed.  It must accept a KidLabel label.
+	LastUsed metrics.Gauge `name:"key_last_used_seconds" optional:"true"`
+
+	// FallbackCount is the optional counter incremented each time the fallback key signs in place of a key that
+	// failed.  It must accept a KidLabel label.
+	FallbackCount metrics.Counter `name:"key_fallback_count" optional:"true"`
+
+	// Clock is the optional source of the time at which each key was last used.  If not supplied, the
+	// system time is used.
+	Clock clock.Clock `optional:"true"`
+
+	// Cache is the optional LoaderCache through which Remote keys are registered
+	Cache *LoaderCache `optional:"true"`
+
+	// Listeners are the optional callbacks subscribed to the events of every Registry created by this package
+	Listeners []Listener `group:"key.listeners"`
+}
+
+// newRegistry creates the instrumented Registry described by a KeyIn, subscribing its Listeners
+func (in KeyIn) newRegistry() Registry {
+	r := newRegistry(
+		in.Random,
+		Metrics{
+			SignCount:     in.SignCount,
+			LastUsed:      in.LastUsed,
+			FallbackCount: in.FallbackCount,
+		},
+		clock.NowFunc(in.Clock),
+	)
+
+	r.cache = in.Cache
+
+	for _, l := range in.Listeners {
+		if l != nil {
+			r.OnEvent(l)
+		}
+	}
+
+	return r
 }
 
 // KeyOut is the set of components emitted by this package
@@ -26,11 +72,17 @@ type KeyOut struct {
 	Handler Handler
 
 	HandlerJWK HandlerJWK
+
+	// HandlerJWKSet is the http.Handler which serves every published key, including staged keys, as a JWK set
+	HandlerJWKSet HandlerJWKSet
+
+	// UsageHandler is the http.Handler which reports when each key was last used
+	UsageHandler UsageHandler
 }
 
 // Provide is an uber/fx style provider for this package's components
 func Provide(in KeyIn) KeyOut {
-	registry := NewRegistry(in.Random)
+	registry := in.newRegistry()
 	endpoint := NewEndpoint(registry)
 
 	return KeyOut{
@@ -41,5 +93,11 @@ func Provide(in KeyIn) KeyOut {
 		HandlerJWK: NewHandlerJWK(
 			endpoint,
 		),
+		HandlerJWKSet: NewHandlerJWKSet(
+			NewKeySetEndpoint(registry),
+		),
+		UsageHandler: NewUsageHandler(
+			NewUsageEndpoint(registry),
+		),
 	}
 }
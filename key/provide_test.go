@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/xmidt-org/themis/random"
 	"go.uber.org/fx"
 	"go.uber.org/fx/fxtest"
@@ -54,6 +55,34 @@ func TestProvide(t *testing.T) {
 		assert.NotNil(registry)
 		assert.NotNil(handler)
 
+		app.RequireStop()
+	})
+	t.Run("WithListeners", func(t *testing.T) {
+		var (
+			assert  = assert.New(t)
+			require = require.New(t)
+
+			registry Registry
+			events   []Event
+
+			app = fxtest.New(
+				t,
+				fx.Provide(
+					Provide,
+					Listener(func(e Event) {
+						events = append(events, e)
+					}).Annotated(),
+				),
+				fx.Populate(&registry),
+			)
+		)
+
+		app.RequireStart()
+		_, err := registry.Register(Descriptor{Kid: "test", Bits: 512})
+		require.NoError(err)
+		require.NoError(registry.Activate("test"))
+		assert.Equal([]Event{{Kid: "test", Type: EventAdded}, {Kid: "test", Type: EventActivated}}, events)
+
 		app.RequireStop()
 	})
 }
@@ -0,0 +1,24 @@
+package key
+
+import "errors"
+
+var (
+	ErrNoActiveKey          = errors.New("No active signing key is available")
+	ErrActiveKeyNotSignable = errors.New("The active key cannot sign tokens")
+)
+
+// Ready tests whether a Registry has an active Pair that is able to sign.  This function is suitable
+// for readiness checks, since an application that issues tokens cannot do useful work until its
+// signing key has been loaded.
+func Ready(r Registry) error {
+	p, ok := r.Active()
+	if !ok {
+		return ErrNoActiveKey
+	}
+
+	if p.Sign() == nil {
+		return ErrActiveKeyNotSignable
+	}
+
+	return nil
+}
@@ -0,0 +1,26 @@
+package key
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReady(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		registry = NewRegistry(nil)
+	)
+
+	assert.Equal(ErrNoActiveKey, Ready(registry))
+
+	_, err := registry.Register(Descriptor{Kid: "test", Bits: 512})
+	require.NoError(err)
+	assert.Equal(ErrNoActiveKey, Ready(registry))
+
+	require.NoError(registry.Activate("test"))
+	assert.NoError(Ready(registry))
+}
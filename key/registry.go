@@ -4,13 +4,22 @@ import (
 	"crypto/rand"
 	"fmt"
 	"io"
+	"net/http"
+	"os"
+	"sort"
 	"sync"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
 )
 
 const (
 	KeyTypeRSA    = "rsa"
 	KeyTypeECDSA  = "ecdsa"
 	KeyTypeSecret = "secret"
+
+	// KeyTypeEd25519 is an Ed25519 key, used with the EdDSA algorithm
+	KeyTypeEd25519 = "ed25519"
 )
 
 // Descriptor holds the configurable options for a key Pair
@@ -27,8 +36,89 @@ type Descriptor struct {
 	Bits int
 
 	// File is the system path to a file where the key is stored.  If set, this file must exist and contain
-	// either a secret or a PEM-encoded key pair.  If this field is not set, a key is generated.
+	// either a secret or a PEM-encoded private key, unless Persist is also set.  RSA keys may be PKCS #1 or
+	// PKCS #8, and ECDSA keys may be SEC 1 or PKCS #8.  If Type is set, the key in the file must be of that
+	// type.  If this field is not set, a key is generated.
 	File string
+
+	// Persist indicates that, when File does not exist, a key is generated from Type and Bits and written to
+	// File with permissions that allow only its owner to read it.  Later registrations, e.g. after a restart,
+	// read that same key.  This field is ignored if File is not set.
+	Persist bool
+
+	// Thumbprint indicates that, when Kid is unset, the kid is the RFC 7638 SHA-256 thumbprint of the key.
+	// This makes the kid a stable function of the key itself.  This field is ignored if Kid is set.
+	Thumbprint bool
+
+	// Remote identifies a key held outside the process, such as the ARN or resource name of a KMS key.  If set,
+	// the key is fetched by the Registry's LoaderCache rather than read or generated, and Kid is required.
+	Remote string
+
+	// Alg optionally pins the JWS algorithm, e.g. "ES256", used with this key.  A pinned algorithm is published
+	// as the alg member of the key's JWK, so that verifiers accept only that algorithm.  Registration fails if
+	// the algorithm cannot be used with the key's type or curve.
+	Alg string
+
+	// Replace indicates that registering this Descriptor replaces any existing Pair with the same kid, i.e. the
+	// last registration wins.  By default, registering a kid that is already in use fails with a DuplicateKidError.
+	// If the replaced Pair was the active key, the replacement becomes the active key.  The replacement is passed
+	// to each OnPromote listener, so that whoever signs with the replaced Pair switches to it, unless it is staged
+	// in place of a key that is not active.
+	Replace bool
+
+	// SignTimeout is the optional limit on the time this key may take to sign, e.g. for a Remote key whose backend
+	// can hang.  A signature that takes longer is abandoned with a SignTimeoutError, and the fallback key, if any,
+	// signs instead.  If unset, signing is not limited.
+	SignTimeout time.Duration
+
+	// RotateInterval is the optional period after which a Rotator replaces this key with a newly generated one, whose
+	// kid is derived from Kid and the date, e.g. "signing-2024-06-01".  Only generated keys can be rotated.  If unset,
+	// the key is never rotated.
+	RotateInterval time.Duration
+
+	// RotateOverlap is the period for which a Rotator publishes each newly generated key before promoting it, so
+	// that verifiers which cache the JWK set learn of the new kid before any token carries it.  It must be shorter
+	// than RotateInterval.  If unset, a tenth of RotateInterval is used.
+	RotateOverlap time.Duration
+
+	// RotateRetain is the number of previous keys a Rotator keeps, and thus publishes, after a rotation so that
+	// tokens they signed remain verifiable.  If unset, DefaultRotateRetain is used.
+	RotateRetain int
+}
+
+// SignTimeoutError is returned when a key does not sign within its Descriptor's SignTimeout.  This is a
+// server-side condition, so it produces a 503.
+type SignTimeoutError struct {
+	Kid     string
+	Timeout time.Duration
+}
+
+func (ste SignTimeoutError) Error() string {
+	return fmt.Sprintf("Key %s did not sign within %s", ste.Kid, ste.Timeout)
+}
+
+func (ste SignTimeoutError) StatusCode() int {
+	return http.StatusServiceUnavailable
+}
+
+// KeyTypeMismatchError is returned when a Descriptor's File holds a different type of key than its Type names
+type KeyTypeMismatchError struct {
+	Kid  string
+	File string
+	Type string
+}
+
+func (ktme KeyTypeMismatchError) Error() string {
+	return fmt.Sprintf("Key file %s for key %s does not hold a key of type %s", ktme.File, ktme.Kid, ktme.Type)
+}
+
+// DuplicateKidError is returned when a Descriptor's kid is already used by another Pair in the same Registry
+type DuplicateKidError struct {
+	Kid string
+}
+
+func (dke DuplicateKidError) Error() string {
+	return fmt.Sprintf("Key id already used: %s", dke.Kid)
 }
 
 // Registry holds zero or more key Pairs
@@ -38,25 +128,153 @@ type Registry interface {
 
 	// Register creates a new Pair from a Descriptor and stores it in this registry
 	Register(Descriptor) (Pair, error)
+
+	// Kids returns the key identifiers of all the Pairs in this registry, in sorted order
+	Kids() []string
+
+	// Used records that the Pair with the given kid has just been used to sign something.  Unknown
+	// kids are ignored.
+	Used(kid string)
+
+	// LastUsed returns the last time the Pair with the given kid was used to sign something.  If no such
+	// Pair exists, or if the Pair has never been used, this method returns false.
+	LastUsed(kid string) (time.Time, bool)
+
+	// Stage creates a new Pair from a Descriptor and stores it in this registry as the next key.  A staged
+	// Pair is available via Get and Kids, so that it is published to verifiers before it is ever used to sign.
+	Stage(Descriptor) (Pair, error)
+
+	// StageSuccessor is like Stage, but records that the staged Pair succeeds the Pair with the previous kid,
+	// e.g. as the next key of a Rotator.  When several token factories share a Registry, only the factory
+	// signing with the previous Pair switches to the successor once it is promoted.
+	StageSuccessor(previous string, d Descriptor) (Pair, error)
+
+	// Predecessor returns the kid of the Pair that the Pair with the given kid succeeds.  If the Pair was not
+	// staged with StageSuccessor, this method returns false.
+	Predecessor(kid string) (string, bool)
+
+	// IsStaged tests whether the Pair with the given kid has been staged but not yet promoted
+	IsStaged(kid string) bool
+
+	// Promote makes a previously staged Pair the active key, unless it succeeds a Pair other than the active key.
+	// Each listener registered with OnPromote is invoked with the promoted Pair.  If no staged Pair exists with
+	// the given kid, an error is returned.
+	Promote(kid string) (Pair, error)
+
+	// OnPromote registers a listener that is invoked each time a staged Pair is promoted
+	OnPromote(func(Pair))
+
+	// Activate marks the Pair with the given kid as the active key, i.e. the key currently used to sign
+	// tokens.  Staged Pairs must be promoted rather than activated.  Promote also makes its Pair active.
+	Activate(kid string) error
+
+	// Active returns the Pair currently used to sign tokens.  If no Pair has been activated or promoted,
+	// this method returns false.
+	Active() (Pair, bool)
+
+	// Remove deletes the Pair with the given kid, e.g. when pruning retired keys.  A removed Pair is no longer
+	// published, and if it was the active Pair, there is no active Pair until another is activated or promoted.
+	// This method returns false if no such Pair exists.
+	Remove(kid string) bool
+
+	// OnEvent registers a Listener that is invoked each time a Pair is added, staged, activated, or pruned
+	OnEvent(Listener)
+
+	// SetFallback designates the Pair with the given kid as the fallback key, which signs in place of any key
+	// that fails to sign, e.g. because its KMS backend is unavailable.  An empty kid clears the fallback.
+	// Removing the fallback Pair also clears it.
+	SetFallback(kid string) error
+
+	// Fallback returns the fallback Pair.  If no fallback has been set, this method returns false.
+	Fallback() (Pair, bool)
+
+	// SignWithFallback invokes sign with the given Pair.  If that fails and a fallback Pair other than p has
+	// been set, the FallbackCount metric is incremented for p's kid and sign is invoked again with the fallback.
+	// The Pair passed to the last invocation of sign is returned along with that invocation's error.
+	//
+	// If a Pair's Descriptor has a SignTimeout, an invocation of sign that runs longer fails with a SignTimeoutError.
+	// That invocation is abandoned rather than interrupted, so sign must not share state between invocations.
+	SignWithFallback(p Pair, sign func(Pair) error) (Pair, error)
+
+	// SignWith is like SignWithFallback, but falls back to the given Pair rather than the Registry's fallback,
+	// e.g. for one of several token factories that share a Registry.  A nil fallback disables the fallback.
+	SignWith(p, fallback Pair, sign func(Pair) error) (Pair, error)
+
+	// Alg returns the algorithm pinned to the Pair with the given kid by its Descriptor.  If no algorithm
+	// was pinned, this method returns false.
+	Alg(kid string) (string, bool)
+}
+
+// Metrics holds the optional metrics a Registry updates as keys are used
+type Metrics struct {
+	// SignCount is incremented each time a key is used to sign.  It must accept a KidLabel label.
+	SignCount metrics.Counter
+
+	// LastUsed is set to the Unix time, in seconds, at which a key last signed.  It must accept a KidLabel label.
+	LastUsed metrics.Gauge
+
+	// FallbackCount is incremented each time a key fails to sign and the fallback key signs in its place.
+	// It must accept a KidLabel label, which is the kid of the key that failed.
+	FallbackCount metrics.Counter
 }
 
+// KidLabel is the metric label for the key identifier
+const KidLabel = "kid"
+
 // NewRegistry creates a new key Registry backed by a given source of randomness for generation.
 // If random is nil, crypto/rand.Reader is used.
 func NewRegistry(random io.Reader) Registry {
+	return NewInstrumentedRegistry(random, Metrics{})
+}
+
+// NewInstrumentedRegistry is like NewRegistry, but updates the given metrics as keys are used.
+// Any nil metrics are not updated.
+func NewInstrumentedRegistry(random io.Reader, m Metrics) Registry {
+	return newRegistry(random, m, time.Now)
+}
+
+// NewCachingRegistry is like NewInstrumentedRegistry, but registers Remote keys through the given LoaderCache.
+// Without a LoaderCache, registering a Remote key fails with ErrNoLoader.
+func NewCachingRegistry(random io.Reader, m Metrics, c *LoaderCache) Registry {
+	r := newRegistry(random, m, time.Now)
+	r.cache = c
+	return r
+}
+
+func newRegistry(random io.Reader, m Metrics, now func() time.Time) *registry {
 	if random == nil {
 		random = rand.Reader
 	}
 
 	return &registry{
-		pairs:  make(map[string]Pair),
-		random: random,
+		pairs:    make(map[string]Pair),
+		lastUsed: make(map[string]time.Time),
+		staged:   make(map[string]bool),
+		algs:     make(map[string]string),
+		timeouts: make(map[string]time.Duration),
+		lineage:  make(map[string]string),
+		random:   random,
+		now:      now,
+		metrics:  m,
 	}
 }
 
 type registry struct {
-	lock   sync.RWMutex
-	pairs  map[string]Pair
-	random io.Reader
+	lock     sync.RWMutex
+	pairs    map[string]Pair
+	lastUsed map[string]time.Time
+	staged   map[string]bool
+	algs     map[string]string
+	timeouts map[string]time.Duration
+	lineage  map[string]string
+	active   string
+	fallback string
+	promote  []func(Pair)
+	events   []Listener
+	random   io.Reader
+	now      func() time.Time
+	metrics  Metrics
+	cache    *LoaderCache
 }
 
 func (r *registry) Get(kid string) (Pair, bool) {
@@ -67,10 +285,68 @@ func (r *registry) Get(kid string) (Pair, bool) {
 }
 
 func (r *registry) newPair(d Descriptor) (Pair, error) {
+	p, err := r.generatePair(d)
+	if err != nil || !d.Thumbprint || len(d.Kid) > 0 {
+		return p, err
+	}
+
+	kid, err := Thumbprint(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPair(kid, p.Sign())
+}
+
+func (r *registry) generatePair(d Descriptor) (Pair, error) {
+	if len(d.Remote) > 0 {
+		if r.cache == nil {
+			return nil, ErrNoLoader
+		}
+
+		return r.cache.Preload(d)
+	}
+
 	if len(d.File) > 0 {
-		return ReadPair(d.Kid, d.File)
+		if _, err := os.Stat(d.File); d.Persist && os.IsNotExist(err) {
+			return r.persistPair(d)
+		}
+
+		return readPair(d)
+	}
+
+	return r.generateKey(d)
+}
+
+// readPair reads the key in a Descriptor's File.  If the Descriptor has a Type, the key must be of that type.
+func readPair(d Descriptor) (Pair, error) {
+	p, err := ReadPair(d.Kid, d.File)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(d.Type) > 0 && pairType(p) != d.Type {
+		return nil, KeyTypeMismatchError{Kid: d.Kid, File: d.File, Type: d.Type}
+	}
+
+	return p, nil
+}
+
+// persistPair generates a key and writes it to the Descriptor's File
+func (r *registry) persistPair(d Descriptor) (Pair, error) {
+	p, err := r.generateKey(d)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := WritePair(p, d.File); err != nil {
+		return nil, err
 	}
 
+	return p, nil
+}
+
+func (r *registry) generateKey(d Descriptor) (Pair, error) {
 	switch d.Type {
 	case "":
 		fallthrough
@@ -80,24 +356,317 @@ func (r *registry) newPair(d Descriptor) (Pair, error) {
 		return GenerateECDSAPair(d.Kid, r.random, d.Bits)
 	case KeyTypeSecret:
 		return GenerateSecretPair(d.Kid, r.random, d.Bits)
+	case KeyTypeEd25519:
+		return GenerateEd25519Pair(d.Kid, r.random)
 	default:
 		return nil, fmt.Errorf("Invalid key type: %s", d.Type)
 	}
 }
 
-func (r *registry) Register(d Descriptor) (Pair, error) {
+// emit invokes each Listener with an Event.  This method must be called without holding the lock.
+func (r *registry) emit(kid string, t EventType) {
+	r.lock.RLock()
+	listeners := append([]Listener{}, r.events...)
+	r.lock.RUnlock()
+
+	for _, l := range listeners {
+		l(Event{Kid: kid, Type: t})
+	}
+}
+
+// add stores a new Pair from a Descriptor.  A staged Pair succeeds the Pair with the previous kid, if any.
+func (r *registry) add(d Descriptor, staged bool, previous string) (Pair, error) {
 	p, err := r.newPair(d)
 	if err != nil {
 		return nil, err
 	}
 
-	defer r.lock.Unlock()
+	alg, err := pinAlgorithm(d, p)
+	if err != nil {
+		return nil, err
+	}
+
 	r.lock.Lock()
+	kid := p.KID()
+	_, exists := r.pairs[kid]
+	if exists && !d.Replace {
+		r.lock.Unlock()
+		return nil, DuplicateKidError{Kid: kid}
+	}
+
+	r.pairs[kid] = p
+	delete(r.algs, kid)
+	if len(alg) > 0 {
+		r.algs[kid] = alg
+	}
+
+	delete(r.timeouts, kid)
+	if d.SignTimeout > 0 {
+		r.timeouts[kid] = d.SignTimeout
+	}
+
+	delete(r.lineage, kid)
+	if staged && len(previous) > 0 {
+		r.lineage[kid] = previous
+	}
+
+	var (
+		t         = EventAdded
+		replaced  = exists && r.active == kid
+		listeners []func(Pair)
+	)
 
-	if _, ok := r.pairs[p.KID()]; ok {
-		return nil, fmt.Errorf("Key id already used: %s", p.KID())
+	// the replacement of the active key remains active, even if it was staged
+	delete(r.staged, kid)
+	if staged && !replaced {
+		r.staged[kid] = true
+		t = EventStaged
 	}
 
-	r.pairs[p.KID()] = p
+	if exists {
+		delete(r.lastUsed, kid)
+	}
+
+	if replaced || (exists && !staged) {
+		listeners = append(listeners, r.promote...)
+	}
+
+	r.lock.Unlock()
+	for _, l := range listeners {
+		l(p)
+	}
+
+	r.emit(kid, t)
+	return p, nil
+}
+
+func (r *registry) Register(d Descriptor) (Pair, error) {
+	return r.add(d, false, "")
+}
+
+func (r *registry) Stage(d Descriptor) (Pair, error) {
+	return r.add(d, true, "")
+}
+
+func (r *registry) StageSuccessor(previous string, d Descriptor) (Pair, error) {
+	return r.add(d, true, previous)
+}
+
+func (r *registry) Predecessor(kid string) (string, bool) {
+	r.lock.RLock()
+	previous, ok := r.lineage[kid]
+	r.lock.RUnlock()
+	return previous, ok
+}
+
+func (r *registry) IsStaged(kid string) bool {
+	r.lock.RLock()
+	staged := r.staged[kid]
+	r.lock.RUnlock()
+	return staged
+}
+
+func (r *registry) Promote(kid string) (Pair, error) {
+	r.lock.Lock()
+	if !r.staged[kid] {
+		r.lock.Unlock()
+		return nil, fmt.Errorf("No staged key with kid %s", kid)
+	}
+
+	delete(r.staged, kid)
+
+	// a successor of some other factory's key is promoted without taking over the active key
+	if previous, ok := r.lineage[kid]; !ok || previous == r.active || len(r.active) == 0 {
+		r.active = kid
+	}
+
+	p := r.pairs[kid]
+	listeners := append([]func(Pair){}, r.promote...)
+	r.lock.Unlock()
+
+	for _, l := range listeners {
+		l(p)
+	}
+
+	r.emit(kid, EventActivated)
 	return p, nil
 }
+
+func (r *registry) OnPromote(l func(Pair)) {
+	r.lock.Lock()
+	r.promote = append(r.promote, l)
+	r.lock.Unlock()
+}
+
+func (r *registry) Activate(kid string) error {
+	r.lock.Lock()
+	if _, ok := r.pairs[kid]; !ok {
+		r.lock.Unlock()
+		return fmt.Errorf("No key with kid %s", kid)
+	} else if r.staged[kid] {
+		r.lock.Unlock()
+		return fmt.Errorf("Key %s is staged and must be promoted", kid)
+	}
+
+	r.active = kid
+	r.lock.Unlock()
+	r.emit(kid, EventActivated)
+	return nil
+}
+
+func (r *registry) Active() (Pair, bool) {
+	r.lock.RLock()
+	p, ok := r.pairs[r.active]
+	r.lock.RUnlock()
+	return p, ok
+}
+
+func (r *registry) Remove(kid string) bool {
+	r.lock.Lock()
+	if _, ok := r.pairs[kid]; !ok {
+		r.lock.Unlock()
+		return false
+	}
+
+	delete(r.pairs, kid)
+	delete(r.staged, kid)
+	delete(r.algs, kid)
+	delete(r.timeouts, kid)
+	delete(r.lastUsed, kid)
+	delete(r.lineage, kid)
+	if r.active == kid {
+		r.active = ""
+	}
+
+	if r.fallback == kid {
+		r.fallback = ""
+	}
+
+	r.lock.Unlock()
+	r.emit(kid, EventPruned)
+	return true
+}
+
+func (r *registry) SetFallback(kid string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if len(kid) > 0 {
+		if _, ok := r.pairs[kid]; !ok {
+			return fmt.Errorf("No key with kid %s", kid)
+		}
+	}
+
+	r.fallback = kid
+	return nil
+}
+
+func (r *registry) Fallback() (Pair, bool) {
+	r.lock.RLock()
+	p, ok := r.pairs[r.fallback]
+	r.lock.RUnlock()
+	return p, ok
+}
+
+// signWithTimeout invokes sign with a Pair, abandoning the invocation if it exceeds the Pair's SignTimeout
+func (r *registry) signWithTimeout(p Pair, sign func(Pair) error) error {
+	r.lock.RLock()
+	timeout := r.timeouts[p.KID()]
+	r.lock.RUnlock()
+
+	if timeout <= 0 {
+		return sign(p)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- sign(p)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return SignTimeoutError{Kid: p.KID(), Timeout: timeout}
+	}
+}
+
+func (r *registry) SignWithFallback(p Pair, sign func(Pair) error) (Pair, error) {
+	fallback, _ := r.Fallback()
+	return r.SignWith(p, fallback, sign)
+}
+
+func (r *registry) SignWith(p, fallback Pair, sign func(Pair) error) (Pair, error) {
+	err := r.signWithTimeout(p, sign)
+	if err == nil {
+		return p, nil
+	}
+
+	if fallback == nil || fallback.KID() == p.KID() {
+		return p, err
+	}
+
+	if r.metrics.FallbackCount != nil {
+		r.metrics.FallbackCount.With(KidLabel, p.KID()).Add(1)
+	}
+
+	return fallback, r.signWithTimeout(fallback, sign)
+}
+
+func (r *registry) Alg(kid string) (string, bool) {
+	r.lock.RLock()
+	alg, ok := r.algs[kid]
+	r.lock.RUnlock()
+	return alg, ok
+}
+
+func (r *registry) OnEvent(l Listener) {
+	r.lock.Lock()
+	r.events = append(r.events, l)
+	r.lock.Unlock()
+}
+
+func (r *registry) Kids() []string {
+	r.lock.RLock()
+	kids := make([]string, 0, len(r.pairs))
+	for kid := range r.pairs {
+		kids = append(kids, kid)
+	}
+
+	r.lock.RUnlock()
+	sort.Strings(kids)
+	return kids
+}
+
+func (r *registry) Used(kid string) {
+	now := r.now()
+
+	r.lock.Lock()
+	_, ok := r.pairs[kid]
+	if ok {
+		r.lastUsed[kid] = now
+	}
+
+	r.lock.Unlock()
+	if !ok {
+		return
+	}
+
+	if r.metrics.SignCount != nil {
+		r.metrics.SignCount.With(KidLabel, kid).Add(1.0)
+	}
+
+	if r.metrics.LastUsed != nil {
+		r.metrics.LastUsed.With(KidLabel, kid).Set(float64(now.Unix()))
+	}
+}
+
+func (r *registry) LastUsed(kid string) (time.Time, bool) {
+	r.lock.RLock()
+	t, ok := r.lastUsed[kid]
+	r.lock.RUnlock()
+	return t, ok
+}
@@ -2,9 +2,16 @@ package key
 
 import (
 	"crypto/ecdsa"
+	"crypto/rand"
 	"crypto/rsa"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -47,7 +54,7 @@ func testRegistryValidDescriptor(t *testing.T, d Descriptor) {
 
 	// idempotency
 	pair, err = registry.Register(d)
-	assert.Error(err)
+	assert.Equal(DuplicateKidError{Kid: d.Kid}, err)
 	assert.Nil(pair)
 }
 
@@ -103,3 +110,690 @@ func TestRegistry(t *testing.T) {
 		})
 	})
 }
+
+func TestRegistryUsage(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		expectedNow = time.Now()
+		registry    = NewRegistry(nil).(*registry)
+	)
+
+	registry.now = func() time.Time { return expectedNow }
+
+	_, err := registry.Register(Descriptor{Kid: "test"})
+	require.NoError(err)
+	_, err = registry.Register(Descriptor{Kid: "another"})
+	require.NoError(err)
+	assert.Equal([]string{"another", "test"}, registry.Kids())
+
+	_, ok := registry.LastUsed("test")
+	assert.False(ok)
+
+	registry.Used("test")
+	lastUsed, ok := registry.LastUsed("test")
+	assert.True(ok)
+	assert.Equal(expectedNow, lastUsed)
+
+	_, ok = registry.LastUsed("another")
+	assert.False(ok)
+
+	registry.Used("nosuch")
+	_, ok = registry.LastUsed("nosuch")
+	assert.False(ok)
+}
+
+func TestRegistryStage(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		registry = NewRegistry(nil)
+		promoted []Pair
+	)
+
+	registry.OnPromote(func(p Pair) {
+		promoted = append(promoted, p)
+	})
+
+	_, err := registry.Register(Descriptor{Kid: "current", Bits: 512})
+	require.NoError(err)
+	next, err := registry.Stage(Descriptor{Kid: "next", Bits: 512})
+	require.NoError(err)
+	require.NotNil(next)
+
+	assert.Equal([]string{"current", "next"}, registry.Kids())
+	pair, ok := registry.Get("next")
+	assert.True(ok)
+	assert.Equal(next, pair)
+	assert.True(registry.IsStaged("next"))
+	assert.False(registry.IsStaged("current"))
+
+	_, err = registry.Stage(Descriptor{Kid: "next", Bits: 512})
+	assert.Error(err)
+
+	_, err = registry.Promote("current")
+	assert.Error(err)
+	_, err = registry.Promote("nosuch")
+	assert.Error(err)
+	assert.Empty(promoted)
+
+	pair, err = registry.Promote("next")
+	require.NoError(err)
+	assert.Equal(next, pair)
+	assert.False(registry.IsStaged("next"))
+	assert.Equal([]Pair{next}, promoted)
+
+	_, err = registry.Promote("next")
+	assert.Error(err)
+	assert.Len(promoted, 1)
+}
+
+func TestRegistryStageSuccessor(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		registry = NewRegistry(nil)
+		promoted []Pair
+	)
+
+	registry.OnPromote(func(p Pair) {
+		promoted = append(promoted, p)
+	})
+
+	_, err := registry.Register(Descriptor{Kid: "access", Bits: 512})
+	require.NoError(err)
+	require.NoError(registry.Activate("access"))
+	_, err = registry.Register(Descriptor{Kid: "refresh", Bits: 512})
+	require.NoError(err)
+
+	_, ok := registry.Predecessor("access")
+	assert.False(ok)
+
+	// promoting the successor of a key that is not active leaves the active key alone
+	refreshNext, err := registry.StageSuccessor("refresh", Descriptor{Kid: "refresh-next", Bits: 512})
+	require.NoError(err)
+	assert.True(registry.IsStaged("refresh-next"))
+	previous, ok := registry.Predecessor("refresh-next")
+	assert.True(ok)
+	assert.Equal("refresh", previous)
+
+	_, err = registry.Promote("refresh-next")
+	require.NoError(err)
+	assert.Equal([]Pair{refreshNext}, promoted)
+	active, ok := registry.Active()
+	require.True(ok)
+	assert.Equal("access", active.KID())
+
+	// promoting the successor of the active key activates it
+	accessNext, err := registry.StageSuccessor("access", Descriptor{Kid: "access-next", Bits: 512})
+	require.NoError(err)
+	_, err = registry.Promote("access-next")
+	require.NoError(err)
+	assert.Equal([]Pair{refreshNext, accessNext}, promoted)
+	active, ok = registry.Active()
+	require.True(ok)
+	assert.Equal(accessNext, active)
+
+	assert.True(registry.Remove("refresh-next"))
+	_, ok = registry.Predecessor("refresh-next")
+	assert.False(ok)
+}
+
+func TestRegistryActivate(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		registry = NewRegistry(nil)
+	)
+
+	_, ok := registry.Active()
+	assert.False(ok)
+	assert.Error(registry.Activate("nosuch"))
+
+	current, err := registry.Register(Descriptor{Kid: "current", Bits: 512})
+	require.NoError(err)
+	_, ok = registry.Active()
+	assert.False(ok)
+
+	require.NoError(registry.Activate("current"))
+	active, ok := registry.Active()
+	assert.True(ok)
+	assert.Equal(current, active)
+
+	next, err := registry.Stage(Descriptor{Kid: "next", Bits: 512})
+	require.NoError(err)
+	assert.Error(registry.Activate("next"))
+	active, _ = registry.Active()
+	assert.Equal(current, active)
+
+	_, err = registry.Promote("next")
+	require.NoError(err)
+	active, ok = registry.Active()
+	assert.True(ok)
+	assert.Equal(next, active)
+}
+
+func TestRegistryRemove(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		registry = NewRegistry(nil)
+	)
+
+	assert.False(registry.Remove("nosuch"))
+
+	_, err := registry.Register(Descriptor{Kid: "current", Bits: 512})
+	require.NoError(err)
+	require.NoError(registry.Activate("current"))
+	registry.Used("current")
+	_, err = registry.Stage(Descriptor{Kid: "next", Bits: 512})
+	require.NoError(err)
+
+	assert.True(registry.Remove("next"))
+	assert.False(registry.IsStaged("next"))
+	assert.Equal([]string{"current"}, registry.Kids())
+	_, ok := registry.Active()
+	assert.True(ok)
+
+	assert.True(registry.Remove("current"))
+	assert.Empty(registry.Kids())
+	_, ok = registry.Get("current")
+	assert.False(ok)
+	_, ok = registry.Active()
+	assert.False(ok)
+	_, ok = registry.LastUsed("current")
+	assert.False(ok)
+	assert.Equal(ErrNoActiveKey, Ready(registry))
+}
+
+func TestRegistryDuplicateKid(t *testing.T) {
+	t.Run("Reject", func(t *testing.T) {
+		var (
+			assert   = assert.New(t)
+			require  = require.New(t)
+			registry = NewRegistry(nil)
+		)
+
+		first, err := registry.Register(Descriptor{Kid: "test", Bits: 512})
+		require.NoError(err)
+
+		for _, add := range []func(Descriptor) (Pair, error){registry.Register, registry.Stage} {
+			p, err := add(Descriptor{Kid: "test", Type: KeyTypeECDSA})
+			assert.Nil(p)
+			assert.Equal(DuplicateKidError{Kid: "test"}, err)
+			assert.Contains(err.Error(), "test")
+		}
+
+		// the original registration is left untouched
+		actual, ok := registry.Get("test")
+		require.True(ok)
+		assert.Equal(first, actual)
+		assert.False(registry.IsStaged("test"))
+	})
+
+	t.Run("LastWins", func(t *testing.T) {
+		var (
+			assert   = assert.New(t)
+			require  = require.New(t)
+			registry = NewRegistry(nil)
+
+			events   []Event
+			promoted []Pair
+		)
+
+		registry.OnEvent(func(e Event) { events = append(events, e) })
+		registry.OnPromote(func(p Pair) { promoted = append(promoted, p) })
+
+		_, err := registry.Register(Descriptor{Kid: "test", Bits: 512, Alg: "RS256"})
+		require.NoError(err)
+		require.NoError(registry.Activate("test"))
+		registry.Used("test")
+
+		last, err := registry.Register(Descriptor{Kid: "test", Type: KeyTypeECDSA, Bits: 256, Replace: true})
+		require.NoError(err)
+
+		actual, ok := registry.Get("test")
+		require.True(ok)
+		assert.Equal(last, actual)
+		assert.IsType((*ecdsa.PrivateKey)(nil), actual.Sign())
+		assert.Equal([]string{"test"}, registry.Kids())
+
+		// the replacement is a new key: it is not pinned to the old algorithm and has never been used
+		_, ok = registry.Alg("test")
+		assert.False(ok)
+		_, ok = registry.LastUsed("test")
+		assert.False(ok)
+
+		// replacing the active key activates the replacement
+		active, ok := registry.Active()
+		require.True(ok)
+		assert.Equal(last, active)
+		assert.Equal([]Pair{last}, promoted)
+
+		// a staged replacement of the active key remains active
+		staged, err := registry.Stage(Descriptor{Kid: "test", Bits: 512, Replace: true})
+		require.NoError(err)
+		assert.False(registry.IsStaged("test"))
+		assert.Equal([]Pair{last, staged}, promoted)
+
+		// replacing a key that is not active leaves the active key alone, but its users switch to the replacement
+		_, err = registry.Register(Descriptor{Kid: "other", Bits: 512})
+		require.NoError(err)
+		replacement, err := registry.Register(Descriptor{Kid: "other", Bits: 512, Replace: true})
+		require.NoError(err)
+		assert.Equal([]Pair{last, staged, replacement}, promoted)
+		active, ok = registry.Active()
+		require.True(ok)
+		assert.Equal(staged, active)
+
+		// a staged replacement of a key that is not active is not passed to listeners
+		next, err := registry.Stage(Descriptor{Kid: "other", Bits: 512, Replace: true})
+		require.NoError(err)
+		assert.True(registry.IsStaged("other"))
+		assert.Len(promoted, 3)
+
+		actual, ok = registry.Get("other")
+		require.True(ok)
+		assert.Equal(next, actual)
+
+		assert.Equal(
+			[]Event{
+				{Kid: "test", Type: EventAdded},
+				{Kid: "test", Type: EventActivated},
+				{Kid: "test", Type: EventAdded},
+				{Kid: "test", Type: EventAdded},
+				{Kid: "other", Type: EventAdded},
+				{Kid: "other", Type: EventAdded},
+				{Kid: "other", Type: EventStaged},
+			},
+			events,
+		)
+	})
+}
+
+func TestRegistryAlg(t *testing.T) {
+	t.Run("Fits", func(t *testing.T) {
+		testData := []struct {
+			descriptor Descriptor
+			expected   string
+		}{
+			{Descriptor{Kid: "rsa", Bits: 512, Alg: "rs256"}, "RS256"},
+			{Descriptor{Kid: "pss", Bits: 1024, Alg: "PS384"}, "PS384"},
+			{Descriptor{Kid: "p256", Type: KeyTypeECDSA, Bits: 256, Alg: "ES256"}, "ES256"},
+			{Descriptor{Kid: "p384", Type: KeyTypeECDSA, Alg: "es384"}, "ES384"},
+			{Descriptor{Kid: "p521", Type: KeyTypeECDSA, Bits: 512, Alg: "ES512"}, "ES512"},
+			{Descriptor{Kid: "secret", Type: KeyTypeSecret, Alg: "HS512"}, "HS512"},
+			{Descriptor{Kid: "ed25519", Type: KeyTypeEd25519, Alg: "EDDSA"}, "EdDSA"},
+		}
+
+		for _, record := range testData {
+			t.Run(record.descriptor.Kid, func(t *testing.T) {
+				var (
+					assert   = assert.New(t)
+					require  = require.New(t)
+					registry = NewRegistry(nil)
+				)
+
+				_, err := registry.Register(record.descriptor)
+				require.NoError(err)
+
+				alg, ok := registry.Alg(record.descriptor.Kid)
+				assert.True(ok)
+				assert.Equal(record.expected, alg)
+
+				assert.True(registry.Remove(record.descriptor.Kid))
+				_, ok = registry.Alg(record.descriptor.Kid)
+				assert.False(ok)
+			})
+		}
+	})
+
+	t.Run("Unpinned", func(t *testing.T) {
+		registry := NewRegistry(nil)
+		_, err := registry.Register(Descriptor{Kid: "test", Bits: 512})
+		require.NoError(t, err)
+
+		alg, ok := registry.Alg("test")
+		assert.Empty(t, alg)
+		assert.False(t, ok)
+	})
+
+	t.Run("Mismatch", func(t *testing.T) {
+		testData := []Descriptor{
+			{Kid: "rsa", Bits: 512, Alg: "ES256"},
+			{Kid: "curve", Type: KeyTypeECDSA, Bits: 256, Alg: "ES384"},
+			{Kid: "ecdsa", Type: KeyTypeECDSA, Alg: "RS256"},
+			{Kid: "secret", Type: KeyTypeSecret, Alg: "RS256"},
+			{Kid: "ed25519", Type: KeyTypeEd25519, Alg: "ES256"},
+			{Kid: "eddsa", Bits: 512, Alg: "EdDSA"},
+			{Kid: "unknown", Bits: 512, Alg: "nosuch"},
+		}
+
+		for _, d := range testData {
+			t.Run(d.Kid, func(t *testing.T) {
+				var (
+					assert   = assert.New(t)
+					registry = NewRegistry(nil)
+				)
+
+				p, err := registry.Register(d)
+				assert.Nil(p)
+				assert.Equal(AlgorithmMismatchError{Kid: d.Kid, Alg: d.Alg}, err)
+				assert.NotEmpty(err.Error())
+				assert.Empty(registry.Kids())
+			})
+		}
+	})
+}
+
+func TestRegistrySignTimeout(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		fallbackCount = new(countingCounter)
+		registry      = NewInstrumentedRegistry(nil, Metrics{FallbackCount: fallbackCount})
+		release       = make(chan struct{})
+	)
+
+	defer close(release)
+
+	slow, err := registry.Register(Descriptor{Kid: "slow", Bits: 512, SignTimeout: 10 * time.Millisecond})
+	require.NoError(err)
+	_, err = registry.Register(Descriptor{Kid: "fallback", Bits: 512})
+	require.NoError(err)
+
+	hangSlow := func(p Pair) error {
+		if p.KID() == "slow" {
+			<-release
+		}
+
+		return nil
+	}
+
+	// a key that hangs is abandoned once its timeout elapses
+	used, err := registry.SignWithFallback(slow, hangSlow)
+	assert.Equal("slow", used.KID())
+	require.Equal(SignTimeoutError{Kid: "slow", Timeout: 10 * time.Millisecond}, err)
+	assert.Equal(http.StatusServiceUnavailable, err.(SignTimeoutError).StatusCode())
+	assert.Contains(err.Error(), "slow")
+
+	// a key that signs within its timeout is unaffected
+	used, err = registry.SignWithFallback(slow, func(Pair) error { return nil })
+	assert.NoError(err)
+	assert.Equal("slow", used.KID())
+
+	// with a fallback, the fallback signs after the timeout
+	require.NoError(registry.SetFallback("fallback"))
+	used, err = registry.SignWithFallback(slow, hangSlow)
+	assert.NoError(err)
+	assert.Equal("fallback", used.KID())
+	assert.Equal(1.0, fallbackCount.value())
+
+	// replacing the key clears its timeout
+	_, err = registry.Register(Descriptor{Kid: "slow", Bits: 512, Replace: true})
+	require.NoError(err)
+	replaced, ok := registry.Get("slow")
+	require.True(ok)
+
+	used, err = registry.SignWithFallback(replaced, func(Pair) error {
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	})
+
+	assert.NoError(err)
+	assert.Equal("slow", used.KID())
+}
+
+func TestRegistryFallback(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		fallbackCount = new(countingCounter)
+		registry      = NewInstrumentedRegistry(nil, Metrics{FallbackCount: fallbackCount})
+		expectedErr   = errors.New("expected")
+	)
+
+	active, err := registry.Register(Descriptor{Kid: "active", Bits: 512})
+	require.NoError(err)
+	_, err = registry.Register(Descriptor{Kid: "fallback", Bits: 512})
+	require.NoError(err)
+
+	var signers []string
+	failActive := func(p Pair) error {
+		signers = append(signers, p.KID())
+		if p.KID() == "active" {
+			return expectedErr
+		}
+
+		return nil
+	}
+
+	// without a fallback, a failure is simply returned
+	_, ok := registry.Fallback()
+	assert.False(ok)
+	used, err := registry.SignWithFallback(active, failActive)
+	assert.Equal(expectedErr, err)
+	assert.Equal("active", used.KID())
+	assert.Equal([]string{"active"}, signers)
+	assert.Zero(fallbackCount.value())
+
+	assert.Error(registry.SetFallback("nosuch"))
+	require.NoError(registry.SetFallback("fallback"))
+	fallback, ok := registry.Fallback()
+	require.True(ok)
+	assert.Equal("fallback", fallback.KID())
+
+	signers = nil
+	used, err = registry.SignWithFallback(active, failActive)
+	assert.NoError(err)
+	assert.Equal("fallback", used.KID())
+	assert.Equal([]string{"active", "fallback"}, signers)
+	assert.Equal(1.0, fallbackCount.value())
+
+	// a key that signs successfully never touches the fallback
+	signers = nil
+	used, err = registry.SignWithFallback(fallback, failActive)
+	assert.NoError(err)
+	assert.Equal("fallback", used.KID())
+	assert.Equal([]string{"fallback"}, signers)
+
+	// the fallback does not retry itself
+	signers = nil
+	_, err = registry.SignWithFallback(fallback, func(p Pair) error {
+		signers = append(signers, p.KID())
+		return expectedErr
+	})
+
+	assert.Equal(expectedErr, err)
+	assert.Equal([]string{"fallback"}, signers)
+	assert.Equal(1.0, fallbackCount.value())
+
+	// an explicit fallback takes the place of the registry's fallback
+	other, err := registry.Register(Descriptor{Kid: "other", Bits: 512})
+	require.NoError(err)
+	signers = nil
+	used, err = registry.SignWith(active, other, failActive)
+	assert.NoError(err)
+	assert.Equal("other", used.KID())
+	assert.Equal([]string{"active", "other"}, signers)
+	assert.Equal(2.0, fallbackCount.value())
+
+	signers = nil
+	used, err = registry.SignWith(active, nil, failActive)
+	assert.Equal(expectedErr, err)
+	assert.Equal("active", used.KID())
+	assert.Equal([]string{"active"}, signers)
+
+	// removing the fallback clears it, and an empty kid clears it as well
+	assert.True(registry.Remove("fallback"))
+	_, ok = registry.Fallback()
+	assert.False(ok)
+
+	require.NoError(registry.SetFallback("active"))
+	require.NoError(registry.SetFallback(""))
+	_, ok = registry.Fallback()
+	assert.False(ok)
+}
+
+func TestRegistryOnEvent(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		registry = NewRegistry(nil)
+		events   []Event
+	)
+
+	registry.OnEvent(func(e Event) {
+		events = append(events, e)
+	})
+
+	_, err := registry.Register(Descriptor{Kid: "current", Bits: 512})
+	require.NoError(err)
+	require.NoError(registry.Activate("current"))
+	_, err = registry.Stage(Descriptor{Kid: "next", Bits: 512})
+	require.NoError(err)
+	_, err = registry.Promote("next")
+	require.NoError(err)
+	require.True(registry.Remove("current"))
+
+	// failed transitions emit nothing
+	_, err = registry.Register(Descriptor{Kid: "next", Bits: 512})
+	require.Error(err)
+	require.Error(registry.Activate("current"))
+	_, err = registry.Promote("next")
+	require.Error(err)
+	require.False(registry.Remove("current"))
+
+	assert.Equal(
+		[]Event{
+			{Kid: "current", Type: EventAdded},
+			{Kid: "current", Type: EventActivated},
+			{Kid: "next", Type: EventStaged},
+			{Kid: "next", Type: EventActivated},
+			{Kid: "current", Type: EventPruned},
+		},
+		events,
+	)
+}
+
+func testRegistryPersistGenerate(t *testing.T, keyType string) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	dir, err := ioutil.TempDir("", "registry")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	var (
+		file = filepath.Join(dir, "signing.key")
+		d    = Descriptor{Kid: "persisted", Type: keyType, Bits: 256, File: file, Persist: true}
+	)
+
+	generated, err := NewRegistry(nil).Register(d)
+	require.NoError(err)
+
+	info, err := os.Stat(file)
+	require.NoError(err)
+	assert.Equal(os.FileMode(0600), info.Mode().Perm())
+
+	// a restart must read the same key rather than generating another
+	loaded, err := NewRegistry(nil).Register(d)
+	require.NoError(err)
+	assert.Equal(generated.Sign(), loaded.Sign())
+
+	leftovers, err := ioutil.ReadDir(dir)
+	require.NoError(err)
+	assert.Len(leftovers, 1)
+}
+
+func testRegistryPersistExisting(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	dir, err := ioutil.TempDir("", "registry")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	existing, err := GenerateRSAPair("existing", rand.Reader, 512)
+	require.NoError(err)
+
+	file := filepath.Join(dir, "signing.pem")
+	require.NoError(WritePair(existing, file))
+	before, err := ioutil.ReadFile(file)
+	require.NoError(err)
+
+	loaded, err := NewRegistry(nil).Register(Descriptor{Kid: "existing", File: file, Persist: true})
+	require.NoError(err)
+	assert.Equal(existing.Sign(), loaded.Sign())
+
+	after, err := ioutil.ReadFile(file)
+	require.NoError(err)
+	assert.Equal(before, after)
+}
+
+func testRegistryPersistDisabled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "missing.pem")
+	_, err = NewRegistry(nil).Register(Descriptor{Kid: "missing", File: file})
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = os.Stat(file)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRegistryKeyFile(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	dir, err := ioutil.TempDir("", "registry")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	existing, err := GenerateECDSAPair("shared", rand.Reader, 256)
+	require.NoError(err)
+
+	file := filepath.Join(dir, "shared.pem")
+	require.NoError(WritePair(existing, file))
+
+	// every instance pointed at the file signs with the same key
+	for _, r := range []Registry{NewRegistry(nil), NewRegistry(nil)} {
+		loaded, err := r.Register(Descriptor{Kid: "shared", Type: KeyTypeECDSA, File: file, Alg: "ES256"})
+		require.NoError(err)
+		assert.Equal(existing.Sign(), loaded.Sign())
+	}
+
+	_, err = NewRegistry(nil).Register(Descriptor{Kid: "shared", Type: KeyTypeRSA, File: file})
+	assert.Equal(KeyTypeMismatchError{Kid: "shared", File: file, Type: KeyTypeRSA}, err)
+	assert.Contains(err.Error(), file)
+
+	_, err = NewRegistry(nil).Register(Descriptor{Kid: "shared", File: file, Alg: "RS256"})
+	assert.Equal(AlgorithmMismatchError{Kid: "shared", Alg: "RS256"}, err)
+}
+
+func TestRegistryPersist(t *testing.T) {
+	for _, keyType := range []string{KeyTypeRSA, KeyTypeECDSA, KeyTypeSecret} {
+		t.Run("Generate/"+keyType, func(t *testing.T) {
+			testRegistryPersistGenerate(t, keyType)
+		})
+	}
+
+	t.Run("Existing", testRegistryPersistExisting)
+	t.Run("Disabled", testRegistryPersistDisabled)
+}
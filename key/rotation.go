@@ -0,0 +1,254 @@
+package key
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultRotateRetain is the number of previous keys retained by a Rotator when no count is configured
+	DefaultRotateRetain = 1
+)
+
+var (
+	ErrRotateIntervalRequired = errors.New("Key rotation requires a positive interval")
+	ErrRotateOverlapInvalid   = errors.New("Key rotation overlap must be shorter than the rotation interval")
+	ErrRotateGeneratedOnly    = errors.New("Only generated keys can be rotated, not keys read from a file or held remotely")
+	ErrRotateAlreadyStaged    = errors.New("A rotated key is already staged and awaiting promotion")
+	ErrRotateNotStaged        = errors.New("No rotated key is staged")
+)
+
+// RotatedKid derives the kid of a key generated by rotation at time t from a base kid.  A daily or longer interval
+// appends the UTC date, e.g. "signing-2024-06-01", while a shorter interval also appends the UTC time of day.
+func RotatedKid(base string, t time.Time, interval time.Duration) string {
+	t = t.UTC()
+	if interval%(24*time.Hour) == 0 {
+		return base + "-" + t.Format("2006-01-02")
+	}
+
+	return base + "-" + t.Format("2006-01-02T150405Z")
+}
+
+// Rotator periodically replaces the active key of a Registry with a newly generated one.  Each new key is staged,
+// so that it is published, and then promoted once the Descriptor's RotateOverlap has elapsed.  The previous keys
+// remain in the Registry, and thus in its JWK set, so that tokens they signed can still be verified until they
+// are rotated out.
+type Rotator struct {
+	lock       sync.Mutex
+	registry   Registry
+	descriptor Descriptor
+	base       string
+	interval   time.Duration
+	overlap    time.Duration
+	retain     int
+	now        func() time.Time
+	kids       []string
+	staged     string
+	stop       chan struct{}
+}
+
+// NewRotator creates a Rotator that generates keys from a Descriptor, whose RotateInterval, RotateOverlap, and
+// RotateRetain control rotation.  The kid of each new key is derived from the Descriptor's Kid via RotatedKid,
+// or is the key's thumbprint when Kid is unset and Thumbprint is set.  The active parameter is the kid of the
+// key currently in use, which counts as the newest retained key.  If now is nil, time.Now is used.  Keys
+// are not rotated until Start is called.
+func NewRotator(r Registry, d Descriptor, active string, now func() time.Time) (*Rotator, error) {
+	if d.RotateInterval <= 0 {
+		return nil, ErrRotateIntervalRequired
+	}
+
+	if d.RotateOverlap < 0 || d.RotateOverlap >= d.RotateInterval {
+		return nil, ErrRotateOverlapInvalid
+	}
+
+	if len(d.File) > 0 || len(d.Remote) > 0 {
+		return nil, ErrRotateGeneratedOnly
+	}
+
+	if now == nil {
+		now = time.Now
+	}
+
+	rr := &Rotator{
+		registry:   r,
+		descriptor: d,
+		base:       d.Kid,
+		interval:   d.RotateInterval,
+		overlap:    d.RotateOverlap,
+		retain:     d.RotateRetain,
+		now:        now,
+	}
+
+	// each rotated key replaces the active key, so it must never replace any other key by kid
+	rr.descriptor.Replace = false
+	if len(rr.base) == 0 && !d.Thumbprint {
+		rr.base = active
+	}
+
+	if rr.overlap == 0 {
+		rr.overlap = rr.interval / 10
+	}
+
+	if rr.retain < 1 {
+		rr.retain = DefaultRotateRetain
+	}
+
+	if len(active) > 0 {
+		rr.kids = []string{active}
+	}
+
+	return rr, nil
+}
+
+// nextKid returns the kid for a key generated now.  When a key with the date-derived kid already exists, e.g.
+// because the key was rotated twice on the same date, a numeric suffix is appended.
+func (rr *Rotator) nextKid() string {
+	kid := RotatedKid(rr.base, rr.now(), rr.interval)
+	for n, next := 2, kid; ; n++ {
+		if _, exists := rr.registry.Get(next); !exists {
+			return next
+		}
+
+		next = kid + "-" + strconv.Itoa(n)
+	}
+}
+
+// stage generates and stages a new key.  The caller must hold the lock.
+func (rr *Rotator) stage() (Pair, error) {
+	if len(rr.staged) > 0 {
+		return nil, ErrRotateAlreadyStaged
+	}
+
+	d := rr.descriptor
+	if len(rr.base) > 0 {
+		d.Kid = rr.nextKid()
+	}
+
+	var (
+		p   Pair
+		err error
+	)
+
+	// the new key succeeds the current one, so that only the current key's users switch to it
+	if len(rr.kids) > 0 {
+		p, err = rr.registry.StageSuccessor(rr.kids[0], d)
+	} else {
+		p, err = rr.registry.Stage(d)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	rr.staged = p.KID()
+	return p, nil
+}
+
+// promote promotes the staged key, then removes the oldest keys beyond the number retained.  The caller
+// must hold the lock.
+func (rr *Rotator) promote() (Pair, error) {
+	if len(rr.staged) == 0 {
+		return nil, ErrRotateNotStaged
+	}
+
+	kid := rr.staged
+	rr.staged = ""
+	p, err := rr.registry.Promote(kid)
+	if err != nil {
+		rr.registry.Remove(kid)
+		return nil, err
+	}
+
+	rr.kids = append([]string{kid}, rr.kids...)
+	for len(rr.kids) > rr.retain+1 {
+		last := len(rr.kids) - 1
+		rr.registry.Remove(rr.kids[last])
+		rr.kids = rr.kids[:last]
+	}
+
+	return p, nil
+}
+
+// Stage generates and stages a new key, which is published but not used to sign until Promote is called.
+// Only one key can be staged at a time.
+func (rr *Rotator) Stage() (Pair, error) {
+	rr.lock.Lock()
+	defer rr.lock.Unlock()
+	return rr.stage()
+}
+
+// Promote makes the staged key the active key, then removes the oldest keys beyond the number retained
+func (rr *Rotator) Promote() (Pair, error) {
+	rr.lock.Lock()
+	defer rr.lock.Unlock()
+	return rr.promote()
+}
+
+// Rotate immediately promotes a new key, staging it first unless one is already staged.  Unlike the rotation
+// done by Start, this skips the overlap, e.g. to replace a compromised key.
+func (rr *Rotator) Rotate() (Pair, error) {
+	rr.lock.Lock()
+	defer rr.lock.Unlock()
+
+	if len(rr.staged) == 0 {
+		if _, err := rr.stage(); err != nil {
+			return nil, err
+		}
+	}
+
+	return rr.promote()
+}
+
+// Kids returns the kids of the active key and the retained previous keys, newest first
+func (rr *Rotator) Kids() []string {
+	rr.lock.Lock()
+	defer rr.lock.Unlock()
+	return append([]string{}, rr.kids...)
+}
+
+// Start begins rotating keys on the configured interval.  Calling Start on a running Rotator does nothing.
+func (rr *Rotator) Start() {
+	rr.lock.Lock()
+	defer rr.lock.Unlock()
+
+	if rr.stop != nil {
+		return
+	}
+
+	rr.stop = make(chan struct{})
+	go func(stop <-chan struct{}) {
+		ticker := time.NewTicker(rr.interval)
+		defer ticker.Stop()
+
+		// promote is nil, and so never fires, unless a key is staged and waiting out the overlap
+		var promote <-chan time.Time
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				// on failure, keep signing with the current key and try again on the next tick.  A key left staged
+				// by an earlier Stop is promoted after the overlap like a new one.
+				if _, err := rr.Stage(); err == nil || err == ErrRotateAlreadyStaged {
+					promote = time.After(rr.overlap)
+				}
+			case <-promote:
+				promote = nil
+				rr.Promote()
+			}
+		}
+	}(rr.stop)
+}
+
+// Stop halts key rotation.  The current keys remain in the Registry.
+func (rr *Rotator) Stop() {
+	rr.lock.Lock()
+	defer rr.lock.Unlock()
+
+	if rr.stop != nil {
+		close(rr.stop)
+		rr.stop = nil
+	}
+}
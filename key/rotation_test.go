@@ -0,0 +1,233 @@
+package key
+
+import (
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotatedKid(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		when   = time.Date(2024, 6, 1, 13, 4, 5, 0, time.FixedZone("test", -5*60*60))
+	)
+
+	assert.Equal("signing-2024-06-01", RotatedKid("signing", when, 24*time.Hour))
+	assert.Equal("signing-2024-06-01", RotatedKid("signing", when, 7*24*time.Hour))
+	assert.Equal("signing-2024-06-01T180405Z", RotatedKid("signing", when, time.Hour))
+}
+
+func testNewRotatorInvalid(t *testing.T) {
+	testData := []struct {
+		name       string
+		descriptor Descriptor
+		expected   error
+	}{
+		{"NoInterval", Descriptor{Kid: "signing"}, ErrRotateIntervalRequired},
+		{"NegativeOverlap", Descriptor{Kid: "signing", RotateInterval: time.Hour, RotateOverlap: -time.Minute}, ErrRotateOverlapInvalid},
+		{"LongOverlap", Descriptor{Kid: "signing", RotateInterval: time.Hour, RotateOverlap: time.Hour}, ErrRotateOverlapInvalid},
+		{"File", Descriptor{Kid: "signing", File: "signing.pem", RotateInterval: time.Hour}, ErrRotateGeneratedOnly},
+		{"Remote", Descriptor{Kid: "signing", Remote: "arn:test", RotateInterval: time.Hour}, ErrRotateGeneratedOnly},
+	}
+
+	for _, record := range testData {
+		t.Run(record.name, func(t *testing.T) {
+			assert := assert.New(t)
+			rr, err := NewRotator(NewRegistry(rand.Reader), record.descriptor, "signing", nil)
+			assert.Nil(rr)
+			assert.Equal(record.expected, err)
+		})
+	}
+}
+
+func testRotatorRotate(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		now        = time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+		registry   = NewRegistry(rand.Reader)
+		descriptor = Descriptor{Kid: "signing", Bits: 512, RotateInterval: 24 * time.Hour, RotateRetain: 2}
+
+		events   []Event
+		promoted []string
+	)
+
+	initial, err := registry.Register(descriptor)
+	require.NoError(err)
+	require.NoError(registry.Activate(initial.KID()))
+
+	registry.OnEvent(func(e Event) { events = append(events, e) })
+	registry.OnPromote(func(p Pair) { promoted = append(promoted, p.KID()) })
+
+	rr, err := NewRotator(registry, descriptor, initial.KID(), func() time.Time { return now })
+	require.NoError(err)
+	assert.Equal([]string{"signing"}, rr.Kids())
+
+	for i := 0; i < 3; i++ {
+		now = now.Add(24 * time.Hour)
+		p, err := rr.Rotate()
+		require.NoError(err)
+		require.NotNil(p)
+
+		active, ok := registry.Active()
+		require.True(ok)
+		assert.Equal(p.KID(), active.KID())
+		assert.False(registry.IsStaged(p.KID()))
+	}
+
+	kids := []string{"signing-2024-06-04", "signing-2024-06-03", "signing-2024-06-02"}
+	assert.Equal(kids, rr.Kids())
+	assert.Equal([]string{"signing-2024-06-02", "signing-2024-06-03", "signing-2024-06-04"}, registry.Kids())
+	assert.Equal([]string{"signing-2024-06-02", "signing-2024-06-03", "signing-2024-06-04"}, promoted)
+	assert.Contains(events, Event{Kid: "signing", Type: EventPruned})
+	assert.Contains(events, Event{Kid: "signing-2024-06-04", Type: EventStaged})
+	assert.Contains(events, Event{Kid: "signing-2024-06-04", Type: EventActivated})
+
+	// a second rotation within the same period gets a suffixed kid rather than colliding with the first
+	p, err := rr.Rotate()
+	require.NoError(err)
+	assert.Equal("signing-2024-06-04-2", p.KID())
+	p, err = rr.Rotate()
+	require.NoError(err)
+	assert.Equal("signing-2024-06-04-3", p.KID())
+	assert.Equal([]string{"signing-2024-06-04-3", "signing-2024-06-04-2", "signing-2024-06-04"}, rr.Kids())
+	active, ok := registry.Active()
+	require.True(ok)
+	assert.Equal("signing-2024-06-04-3", active.KID())
+}
+
+func testRotatorOverlap(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		now        = time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+		registry   = NewRegistry(rand.Reader)
+		descriptor = Descriptor{Kid: "signing", Bits: 512, RotateInterval: 24 * time.Hour, RotateOverlap: time.Hour}
+	)
+
+	initial, err := registry.Register(descriptor)
+	require.NoError(err)
+	require.NoError(registry.Activate(initial.KID()))
+
+	rr, err := NewRotator(registry, descriptor, initial.KID(), func() time.Time { return now })
+	require.NoError(err)
+
+	_, err = rr.Promote()
+	assert.Equal(ErrRotateNotStaged, err)
+
+	// a staged key is published, but the current key keeps signing until the staged key is promoted
+	staged, err := rr.Stage()
+	require.NoError(err)
+	assert.Equal("signing-2024-06-01", staged.KID())
+	assert.True(registry.IsStaged(staged.KID()))
+	assert.Equal([]string{"signing", "signing-2024-06-01"}, registry.Kids())
+	active, ok := registry.Active()
+	require.True(ok)
+	assert.Equal("signing", active.KID())
+	assert.Equal([]string{"signing"}, rr.Kids())
+
+	_, err = rr.Stage()
+	assert.Equal(ErrRotateAlreadyStaged, err)
+
+	p, err := rr.Promote()
+	require.NoError(err)
+	assert.Equal(staged.KID(), p.KID())
+	assert.False(registry.IsStaged(p.KID()))
+	active, ok = registry.Active()
+	require.True(ok)
+	assert.Equal(p.KID(), active.KID())
+	assert.Equal([]string{"signing-2024-06-01", "signing"}, rr.Kids())
+
+	// Rotate promotes a staged key rather than generating another
+	staged, err = rr.Stage()
+	require.NoError(err)
+	assert.Equal("signing-2024-06-01-2", staged.KID())
+	p, err = rr.Rotate()
+	require.NoError(err)
+	assert.Equal(staged.KID(), p.KID())
+	assert.Equal([]string{"signing-2024-06-01-2", "signing-2024-06-01"}, rr.Kids())
+	assert.Equal([]string{"signing-2024-06-01", "signing-2024-06-01-2"}, registry.Kids())
+}
+
+func testRotatorThumbprint(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		registry   = NewRegistry(rand.Reader)
+		descriptor = Descriptor{Bits: 512, Thumbprint: true, RotateInterval: time.Hour}
+	)
+
+	initial, err := registry.Register(descriptor)
+	require.NoError(err)
+
+	rr, err := NewRotator(registry, descriptor, initial.KID(), nil)
+	require.NoError(err)
+
+	p, err := rr.Rotate()
+	require.NoError(err)
+
+	thumbprint, err := Thumbprint(p)
+	require.NoError(err)
+	assert.Equal(thumbprint, p.KID())
+	assert.Equal([]string{p.KID(), initial.KID()}, rr.Kids(), "the default retains one previous key")
+}
+
+func testRotatorStartStop(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		registry   = NewRegistry(rand.Reader)
+		descriptor = Descriptor{Kid: "signing", Bits: 512, RotateInterval: 20 * time.Millisecond, RotateOverlap: 10 * time.Millisecond}
+	)
+
+	initial, err := registry.Register(descriptor)
+	require.NoError(err)
+	require.NoError(registry.Activate(initial.KID()))
+
+	rr, err := NewRotator(registry, descriptor, initial.KID(), nil)
+	require.NoError(err)
+
+	var (
+		events = make(chan Event, 100)
+		order  []EventType
+	)
+
+	registry.OnEvent(func(e Event) { events <- e })
+	rr.Start()
+	rr.Start() // idempotent
+
+	// the new key must be staged, and thus published, before it is activated
+	timeout := time.After(5 * time.Second)
+	for len(order) == 0 || order[len(order)-1] != EventActivated {
+		select {
+		case e := <-events:
+			if e.Kid != "signing" {
+				order = append(order, e.Type)
+			}
+		case <-timeout:
+			assert.FailNow("the key was not rotated")
+		}
+	}
+
+	assert.Equal(EventStaged, order[0])
+	rr.Stop()
+	rr.Stop() // idempotent
+	stopped := rr.Kids()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(stopped, rr.Kids())
+}
+
+func TestRotator(t *testing.T) {
+	t.Run("Invalid", testNewRotatorInvalid)
+	t.Run("Rotate", testRotatorRotate)
+	t.Run("Overlap", testRotatorOverlap)
+	t.Run("Thumbprint", testRotatorThumbprint)
+	t.Run("StartStop", testRotatorStartStop)
+}
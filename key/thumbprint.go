@@ -0,0 +1,46 @@
+package key
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+// Thumbprint computes the RFC 7638 JWK thumbprint of a Pair's verify key, using SHA-256.  The result is
+// base64url-encoded without padding, which is the form typically used as a kid.
+func Thumbprint(p Pair) (string, error) {
+	verify := p.Sign()
+	switch k := verify.(type) {
+	case *rsa.PrivateKey:
+		verify = &k.PublicKey
+	case *ecdsa.PrivateKey:
+		verify = &k.PublicKey
+	case ed25519.PrivateKey:
+		// the OKP members are already in the order RFC 7638 requires, and encoding/json sorts map keys
+		data, err := json.Marshal(ed25519JWK(k.Public().(ed25519.PublicKey)))
+		if err != nil {
+			return "", err
+		}
+
+		thumbprint := sha256.Sum256(data)
+		return base64.RawURLEncoding.EncodeToString(thumbprint[:]), nil
+	}
+
+	jwkKey, err := jwk.New(verify)
+	if err != nil {
+		return "", err
+	}
+
+	thumbprint, err := jwkKey.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(thumbprint), nil
+}
@@ -0,0 +1,135 @@
+package key
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func encodeThumbprintMember(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// expectedThumbprint computes an RFC 7638 thumbprint directly from the required members, in lexicographic order
+func expectedThumbprint(t *testing.T, sign interface{}) string {
+	var canonical string
+	switch k := sign.(type) {
+	case *rsa.PrivateKey:
+		canonical = fmt.Sprintf(
+			`{"e":"%s","kty":"RSA","n":"%s"}`,
+			encodeThumbprintMember(big.NewInt(int64(k.E)).Bytes()),
+			encodeThumbprintMember(k.N.Bytes()),
+		)
+
+	case *ecdsa.PrivateKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		x, y := make([]byte, size), make([]byte, size)
+		k.X.FillBytes(x)
+		k.Y.FillBytes(y)
+		canonical = fmt.Sprintf(
+			`{"crv":"%s","kty":"EC","x":"%s","y":"%s"}`,
+			k.Curve.Params().Name,
+			encodeThumbprintMember(x),
+			encodeThumbprintMember(y),
+		)
+
+	default:
+		t.Fatalf("Unsupported key type: %T", sign)
+	}
+
+	digest := sha256.Sum256([]byte(canonical))
+	return encodeThumbprintMember(digest[:])
+}
+
+func testThumbprintIndependent(t *testing.T, d Descriptor) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		registry = NewRegistry(nil)
+	)
+
+	d.Thumbprint = true
+	pair, err := registry.Register(d)
+	require.NoError(err)
+
+	expected := expectedThumbprint(t, pair.Sign())
+	assert.Equal(expected, pair.KID())
+
+	actual, err := Thumbprint(pair)
+	require.NoError(err)
+	assert.Equal(expected, actual)
+
+	registered, ok := registry.Get(expected)
+	require.True(ok)
+	assert.Equal(pair, registered)
+}
+
+func testThumbprintStable(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	first, err := NewRegistry(nil).Register(Descriptor{File: "test.pkcs1.pem", Thumbprint: true})
+	require.NoError(err)
+
+	second, err := NewRegistry(nil).Register(Descriptor{File: "test.pkcs1.pem", Thumbprint: true})
+	require.NoError(err)
+
+	assert.NotEmpty(first.KID())
+	assert.Equal(first.KID(), second.KID())
+
+	// the same key in a different encoding has the same thumbprint
+	third, err := NewRegistry(nil).Register(Descriptor{File: "test.pkcs8.pem", Thumbprint: true})
+	require.NoError(err)
+	assert.Equal(first.KID(), third.KID())
+}
+
+func testThumbprintExplicitKid(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	pair, err := NewRegistry(nil).Register(Descriptor{Kid: "explicit", Bits: 512, Thumbprint: true})
+	require.NoError(err)
+	assert.Equal("explicit", pair.KID())
+}
+
+func TestThumbprint(t *testing.T) {
+	t.Run("RSA", func(t *testing.T) {
+		testThumbprintIndependent(t, Descriptor{Bits: 512})
+	})
+
+	t.Run("ECDSA", func(t *testing.T) {
+		testThumbprintIndependent(t, Descriptor{Type: KeyTypeECDSA, Bits: 256})
+	})
+
+	t.Run("RSAFile", func(t *testing.T) {
+		testThumbprintIndependent(t, Descriptor{File: "test.pkcs1.pem"})
+	})
+
+	t.Run("Ed25519", func(t *testing.T) {
+		// the example from RFC 8037, appendix A.3
+		seed, err := base64.RawURLEncoding.DecodeString("nWGxne_9WmC6hEr0kuwsxERJxWl7MmkZcDusAxyuf2A")
+		require.NoError(t, err)
+		pair, err := NewPair("test", ed25519.NewKeyFromSeed(seed))
+		require.NoError(t, err)
+
+		thumbprint, err := Thumbprint(pair)
+		require.NoError(t, err)
+		assert.Equal(t, "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k", thumbprint)
+	})
+
+	t.Run("Stable", testThumbprintStable)
+	t.Run("ExplicitKid", testThumbprintExplicitKid)
+}
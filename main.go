@@ -24,9 +24,11 @@ import (
 
 	"github.com/InVisionApp/go-health"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/xmidt-org/themis/clock"
 	"github.com/xmidt-org/themis/config"
 	"github.com/xmidt-org/themis/key"
 	"github.com/xmidt-org/themis/random"
+	"github.com/xmidt-org/themis/revocation"
 	"github.com/xmidt-org/themis/token"
 	"github.com/xmidt-org/themis/xhealth"
 	"github.com/xmidt-org/themis/xhttp/xhttpclient"
@@ -100,22 +102,30 @@ func main() {
 		provideMetrics(),
 		fx.Provide(
 			config.ProvideViper(setupViper),
+			config.ProvideReloader,
+			clock.Provide,
 			xlog.Unmarshal("log"),
 			xloghttp.ProvideStandardBuilders,
 			xhealth.Unmarshal("health"),
-			random.Provide,
+			random.Unmarshal("noncer"),
+			key.UnmarshalCache("keyCache"),
 			key.Provide,
+			key.UnmarshalGroups("keyGroups"),
 			token.Unmarshal("token"),
+			revocation.Unmarshal("revocation"),
 			xmetricshttp.Unmarshal("prometheus", promhttp.HandlerOpts{}),
 			provideClientChain,
 			provideServerChainFactory,
+			xhttpserver.NewServerCounters,
 			xhttpclient.Unmarshal{Key: "client"}.Provide,
+			xhttpserver.UnmarshalAuthenticators("authentication"),
 			xhttpserver.Unmarshal{Key: "servers.key", Optional: true}.Annotated(),
 			xhttpserver.Unmarshal{Key: "servers.issuer", Optional: true}.Annotated(),
 			xhttpserver.Unmarshal{Key: "servers.claims", Optional: true}.Annotated(),
 			xhttpserver.Unmarshal{Key: "servers.metrics", Optional: true}.Annotated(),
 			xhttpserver.Unmarshal{Key: "servers.health", Optional: true}.Annotated(),
 			xhttpserver.Unmarshal{Key: "servers.pprof", Optional: true}.Annotated(),
+			xhttpserver.Unmarshal{Key: "servers.admin", Optional: true}.Annotated(),
 		),
 		fx.Invoke(
 			xhealth.ApplyChecks(
@@ -135,7 +145,12 @@ func main() {
 			BuildMetricsRoutes,
 			BuildHealthRoutes,
 			BuildPprofRoutes,
+			BuildAdminRoutes,
+			HandleReloadSignal,
 			CheckServerRequirements,
+			CheckAuthenticators,
+			// this must come after every server is created, so that draining happens before any server stops
+			xhealth.PreDrain,
 		),
 	)
 
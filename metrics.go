@@ -1,6 +1,7 @@
 package main
 
 import (
+	"github.com/xmidt-org/themis/key"
 	"github.com/xmidt-org/themis/xmetrics"
 	"github.com/xmidt-org/themis/xmetrics/xmetricshttp"
 
@@ -61,5 +62,40 @@ func provideMetrics() fx.Option {
 				Help: "tracks the current number of incoming requests being processed",
 			},
 		),
+		xmetrics.ProvideCounter(
+			prometheus.CounterOpts{
+				Name: "key_sign_count",
+				Help: "total signatures performed by each key",
+			},
+			key.KidLabel,
+		),
+		xmetrics.ProvideGauge(
+			prometheus.GaugeOpts{
+				Name: "key_last_used_seconds",
+				Help: "the Unix time at which each key last signed",
+			},
+			key.KidLabel,
+		),
+		xmetrics.ProvideCounter(
+			prometheus.CounterOpts{
+				Name: "key_cache_hits",
+				Help: "total signatures served by each remote key from the cache",
+			},
+			key.KidLabel,
+		),
+		xmetrics.ProvideCounter(
+			prometheus.CounterOpts{
+				Name: "key_cache_misses",
+				Help: "total times each remote key had to be loaded before it could sign",
+			},
+			key.KidLabel,
+		),
+		xmetrics.ProvideCounter(
+			prometheus.CounterOpts{
+				Name: "key_fallback_count",
+				Help: "total signatures by the fallback key in place of each key that failed to sign",
+			},
+			key.KidLabel,
+		),
 	)
 }
@@ -3,10 +3,19 @@ package random
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/binary"
+	"fmt"
 	"io"
+	"strings"
+	"time"
 )
 
-const DefaultNonceSize = 16
+const (
+	DefaultNonceSize = 16
+
+	// TimestampSize is the number of bytes used by the timestamp prefix of a timestamp noncer
+	TimestampSize = 8
+)
 
 // Noncer is a strategy for creating nonces for JWTs, to be stored in the jti claim.
 type Noncer interface {
@@ -53,3 +62,111 @@ func NewBase64Noncer(random io.Reader, size int, encoding *base64.Encoding) Nonc
 		encoding: encoding,
 	}
 }
+
+type timestampNoncer struct {
+	now      func() time.Time
+	random   io.Reader
+	size     int
+	encoding *base64.Encoding
+}
+
+func (n timestampNoncer) Nonce() (string, error) {
+	b := make([]byte, TimestampSize+n.size)
+	binary.BigEndian.PutUint64(b, uint64(n.now().UnixNano()/int64(time.Millisecond)))
+	if _, err := io.ReadFull(n.random, b[TimestampSize:]); err != nil {
+		return "", err
+	}
+
+	return n.encoding.EncodeToString(b), nil
+}
+
+// NewTimestampNoncer creates a Noncer whose nonces are a big-endian timestamp, in milliseconds since
+// the epoch, followed by size random bytes.  The entire byte sequence is encoded via the given base64 encoding.
+// Decoded nonces are both unique and roughly sortable by creation time, which is useful for downstream
+// stores that evict by age.  Parameters have the same defaults as NewBase64Noncer.
+func NewTimestampNoncer(random io.Reader, size int, encoding *base64.Encoding) Noncer {
+	if random == nil {
+		random = rand.Reader
+	}
+
+	if size <= 0 {
+		size = DefaultNonceSize
+	}
+
+	if encoding == nil {
+		encoding = base64.RawURLEncoding
+	}
+
+	return timestampNoncer{
+		now:      time.Now,
+		random:   random,
+		size:     size,
+		encoding: encoding,
+	}
+}
+
+// NewEncoding returns the base64 encoding associated with the given name.  An empty name
+// results in base64.RawURLEncoding.
+func NewEncoding(name string) (*base64.Encoding, error) {
+	switch strings.ToLower(name) {
+	case "":
+		fallthrough
+	case EncodingRawURL:
+		return base64.RawURLEncoding, nil
+	case EncodingURL:
+		return base64.URLEncoding, nil
+	case EncodingRawStd:
+		return base64.RawStdEncoding, nil
+	case EncodingStd:
+		return base64.StdEncoding, nil
+	default:
+		return nil, fmt.Errorf("Invalid nonce encoding: %s", name)
+	}
+}
+
+// NonceLengthError indicates that a noncer's configuration would produce nonces longer than the configured maximum
+type NonceLengthError struct {
+	Length    int
+	MaxLength int
+}
+
+func (nle NonceLengthError) Error() string {
+	return fmt.Sprintf(
+		"Nonces would be %d characters long, which exceeds the maximum length of %d.  Reduce the size or use a more compact encoding.",
+		nle.Length,
+		nle.MaxLength,
+	)
+}
+
+// NewNoncer creates a Noncer from a set of configuration options.  If random is nil, crypto/rand.Reader is used.
+// If o.MaxLength is positive and the encoded nonces would be longer, a NonceLengthError is returned.
+func NewNoncer(o Options, random io.Reader) (Noncer, error) {
+	encoding, err := NewEncoding(o.Encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	size := o.Size
+	if size <= 0 {
+		size = DefaultNonceSize
+	}
+
+	var n Noncer
+	switch strings.ToLower(o.Type) {
+	case "":
+		fallthrough
+	case NoncerTypeRandom:
+		n = NewBase64Noncer(random, size, encoding)
+	case NoncerTypeTimestamp:
+		n = NewTimestampNoncer(random, size, encoding)
+		size += TimestampSize
+	default:
+		return nil, fmt.Errorf("Invalid noncer type: %s", o.Type)
+	}
+
+	if length := encoding.EncodedLen(size); o.MaxLength > 0 && length > o.MaxLength {
+		return nil, NonceLengthError{Length: length, MaxLength: o.MaxLength}
+	}
+
+	return n, nil
+}
@@ -3,8 +3,10 @@ package random
 import (
 	"bytes"
 	"encoding/base64"
+	"encoding/binary"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -78,3 +80,138 @@ func TestNewBase64Noncer(t *testing.T) {
 		})
 	}
 }
+
+func TestNewTimestampNoncer(t *testing.T) {
+	t.Run("ReadError", func(t *testing.T) {
+		var (
+			assert  = assert.New(t)
+			require = require.New(t)
+			empty   bytes.Buffer
+			noncer  = NewTimestampNoncer(&empty, 0, nil)
+		)
+
+		require.NotNil(noncer)
+		n, err := noncer.Nonce()
+		assert.Empty(n)
+		assert.Error(err)
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		var (
+			assert  = assert.New(t)
+			require = require.New(t)
+			noncer  = NewTimestampNoncer(nil, 0, nil)
+			before  = time.Now().Add(-time.Second)
+		)
+
+		require.NotNil(noncer)
+		first, err := noncer.Nonce()
+		require.NoError(err)
+		second, err := noncer.Nonce()
+		require.NoError(err)
+
+		d1, err := base64.RawURLEncoding.DecodeString(first)
+		require.NoError(err)
+		require.Len(d1, TimestampSize+DefaultNonceSize)
+
+		d2, err := base64.RawURLEncoding.DecodeString(second)
+		require.NoError(err)
+		require.Len(d2, TimestampSize+DefaultNonceSize)
+
+		ms := int64(binary.BigEndian.Uint64(d1[:TimestampSize]))
+		timestamp := time.Unix(0, ms*int64(time.Millisecond))
+		assert.True(timestamp.After(before))
+		assert.False(timestamp.After(time.Now()))
+
+		assert.NotEqual(d1[TimestampSize:], d2[TimestampSize:])
+	})
+}
+
+func TestNewNoncer(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		var (
+			assert  = assert.New(t)
+			require = require.New(t)
+		)
+
+		noncer, err := NewNoncer(Options{}, nil)
+		require.NoError(err)
+		require.NotNil(noncer)
+		assert.IsType(base64Noncer{}, noncer)
+	})
+
+	t.Run("Timestamp", func(t *testing.T) {
+		var (
+			assert  = assert.New(t)
+			require = require.New(t)
+		)
+
+		noncer, err := NewNoncer(Options{Type: NoncerTypeTimestamp, Size: 4, Encoding: EncodingStd}, nil)
+		require.NoError(err)
+		require.NotNil(noncer)
+
+		n, err := noncer.Nonce()
+		require.NoError(err)
+		d, err := base64.StdEncoding.DecodeString(n)
+		require.NoError(err)
+		assert.Len(d, TimestampSize+4)
+	})
+
+	t.Run("InvalidType", func(t *testing.T) {
+		assert := assert.New(t)
+		noncer, err := NewNoncer(Options{Type: "nosuch"}, nil)
+		assert.Nil(noncer)
+		assert.Error(err)
+	})
+
+	t.Run("InvalidEncoding", func(t *testing.T) {
+		assert := assert.New(t)
+		noncer, err := NewNoncer(Options{Encoding: "nosuch"}, nil)
+		assert.Nil(noncer)
+		assert.Error(err)
+	})
+	t.Run("MaxLength", func(t *testing.T) {
+		testData := []struct {
+			options        Options
+			expectedLength int
+		}{
+			{Options{MaxLength: 22}, 22},
+			{Options{Size: 32, Encoding: EncodingStd, MaxLength: 44}, 44},
+			{Options{Type: NoncerTypeTimestamp, Size: 4, MaxLength: 100}, 16},
+		}
+
+		for _, record := range testData {
+			var (
+				assert  = assert.New(t)
+				require = require.New(t)
+			)
+
+			noncer, err := NewNoncer(record.options, nil)
+			require.NoError(err)
+			require.NotNil(noncer)
+
+			n, err := noncer.Nonce()
+			require.NoError(err)
+			assert.Len(n, record.expectedLength)
+		}
+	})
+
+	t.Run("TooLong", func(t *testing.T) {
+		testData := []struct {
+			options  Options
+			expected NonceLengthError
+		}{
+			{Options{MaxLength: 21}, NonceLengthError{Length: 22, MaxLength: 21}},
+			{Options{Size: 16, Encoding: EncodingURL, MaxLength: 22}, NonceLengthError{Length: 24, MaxLength: 22}},
+			{Options{Type: NoncerTypeTimestamp, MaxLength: 22}, NonceLengthError{Length: 32, MaxLength: 22}},
+		}
+
+		for _, record := range testData {
+			assert := assert.New(t)
+			noncer, err := NewNoncer(record.options, nil)
+			assert.Nil(noncer)
+			assert.Equal(record.expected, err)
+			assert.Contains(err.Error(), "exceeds the maximum length")
+		}
+	})
+}
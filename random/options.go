@@ -0,0 +1,31 @@
+package random
+
+const (
+	NoncerTypeRandom    = "random"
+	NoncerTypeTimestamp = "timestamp"
+
+	EncodingRawURL = "rawurl"
+	EncodingURL    = "url"
+	EncodingRawStd = "rawstd"
+	EncodingStd    = "std"
+)
+
+// Options holds the configurable information for the Noncer emitted by this package
+type Options struct {
+	// Type is the kind of Noncer to create.  The default is "random", which produces nonces that
+	// are purely random bytes.  The "timestamp" type prefixes the random bytes with a millisecond timestamp.
+	Type string
+
+	// Size is the number of random bytes in each nonce.  If nonpositive, DefaultNonceSize is used.
+	// For timestamp noncers, this does not include the TimestampSize bytes of the timestamp prefix.
+	Size int
+
+	// Encoding is the base64 encoding applied to nonces.  Valid values are "rawurl", "url", "rawstd", and "std".
+	// The default is "rawurl".
+	Encoding string
+
+	// MaxLength is the optional maximum number of characters in an encoded nonce, for downstream stores
+	// that cap the length of the jti claim.  If positive, creating a Noncer fails when the Type, Size, and
+	// Encoding would produce longer nonces.
+	MaxLength int
+}
@@ -0,0 +1,37 @@
+package random
+
+import (
+	"crypto/rand"
+
+	"github.com/xmidt-org/themis/config"
+
+	"go.uber.org/fx"
+)
+
+// RandomIn describes the dependencies for unmarshalling this package's components
+type RandomIn struct {
+	fx.In
+
+	Unmarshaller config.Unmarshaller
+}
+
+// Unmarshal returns an uber/fx provider that reads Options from the given configuration key and emits
+// the same components as Provide.  If the configuration key is not present, the default Noncer is created.
+func Unmarshal(configKey string) func(RandomIn) (RandomOut, error) {
+	return func(in RandomIn) (RandomOut, error) {
+		var o Options
+		if err := in.Unmarshaller.UnmarshalKey(configKey, &o); err != nil {
+			return RandomOut{}, err
+		}
+
+		n, err := NewNoncer(o, rand.Reader)
+		if err != nil {
+			return RandomOut{}, err
+		}
+
+		return RandomOut{
+			Random: rand.Reader,
+			Noncer: n,
+		}, nil
+	}
+}
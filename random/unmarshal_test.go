@@ -0,0 +1,96 @@
+package random
+
+import (
+	"io"
+	"testing"
+
+	"github.com/xmidt-org/themis/config"
+	"github.com/xmidt-org/themis/xlog"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+func TestUnmarshal(t *testing.T) {
+	t.Run("Default", func(t *testing.T) {
+		var (
+			assert = assert.New(t)
+
+			randomness io.Reader
+			noncer     Noncer
+
+			app = fxtest.New(
+				t,
+				fx.Provide(
+					config.ProvideViper(),
+					Unmarshal("nonce"),
+				),
+				fx.Populate(&randomness, &noncer),
+			)
+		)
+
+		app.RequireStart()
+		assert.NotNil(randomness)
+		assert.IsType(base64Noncer{}, noncer)
+		app.RequireStop()
+	})
+
+	t.Run("Timestamp", func(t *testing.T) {
+		var (
+			assert = assert.New(t)
+
+			noncer Noncer
+
+			app = fxtest.New(
+				t,
+				fx.Provide(
+					config.ProvideViper(
+						config.Json(`
+							{
+								"nonce": {
+									"type": "timestamp",
+									"size": 8
+								}
+							}
+						`),
+					),
+					Unmarshal("nonce"),
+				),
+				fx.Populate(&noncer),
+			)
+		)
+
+		app.RequireStart()
+		assert.IsType(timestampNoncer{}, noncer)
+		app.RequireStop()
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		var (
+			assert = assert.New(t)
+
+			noncer Noncer
+
+			app = fx.New(
+				fx.Logger(xlog.DiscardPrinter{}),
+				fx.Provide(
+					config.ProvideViper(
+						config.Json(`
+							{
+								"nonce": {
+									"type": "nosuch"
+								}
+							}
+						`),
+					),
+					Unmarshal("nonce"),
+				),
+				fx.Populate(&noncer),
+			)
+		)
+
+		assert.Error(app.Err())
+		assert.Nil(noncer)
+	})
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/xmidt-org/themis/config"
+	"github.com/xmidt-org/themis/xlog"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"go.uber.org/fx"
+)
+
+type ReloadSignalIn struct {
+	fx.In
+
+	Logger    log.Logger
+	Lifecycle fx.Lifecycle
+	Reloader  *config.Reloader
+}
+
+// handleReloads invokes the reloader each time a signal arrives, logging any errors.  Reload errors never
+// stop the application, as each component retains its prior state when its reload fails.
+func handleReloads(logger log.Logger, r *config.Reloader, signals <-chan os.Signal) {
+	for range signals {
+		logger.Log(level.Key(), level.InfoValue(), xlog.MessageKey(), "reloading")
+		for _, err := range r.Reload() {
+			logger.Log(
+				level.Key(), level.ErrorValue(),
+				xlog.MessageKey(), "reload failed",
+				xlog.ErrorKey(), err,
+			)
+		}
+	}
+}
+
+// HandleReloadSignal installs a SIGHUP handler for the lifetime of the application that rereads configuration
+// and reloads any components registered with the Reloader, such as TLS server certificates.
+func HandleReloadSignal(in ReloadSignalIn) {
+	signals := make(chan os.Signal, 1)
+	in.Lifecycle.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			signal.Notify(signals, syscall.SIGHUP)
+			go handleReloads(in.Logger, in.Reloader, signals)
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			signal.Stop(signals)
+			close(signals)
+			return nil
+		},
+	})
+}
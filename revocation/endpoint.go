@@ -0,0 +1,123 @@
+package revocation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+var (
+	ErrJTIRequired = errors.New("A jti is required")
+)
+
+// BadRequestError indicates a revocation request that could not be decoded
+type BadRequestError struct {
+	Err error
+}
+
+func (bre BadRequestError) Error() string {
+	return bre.Err.Error()
+}
+
+func (bre BadRequestError) Unwrap() error {
+	return bre.Err
+}
+
+func (bre BadRequestError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// InvalidTTLError indicates that a revocation request specified a TTL that is nonpositive or
+// longer than the configured maximum
+type InvalidTTLError struct {
+	TTL    time.Duration
+	MaxTTL time.Duration
+}
+
+func (ite InvalidTTLError) Error() string {
+	if ite.TTL <= 0 {
+		return fmt.Sprintf("The TTL %s must be positive", ite.TTL)
+	}
+
+	return fmt.Sprintf("The TTL %s exceeds the maximum TTL %s", ite.TTL, ite.MaxTTL)
+}
+
+func (ite InvalidTTLError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// RevokeRequest is the decoded request to add a jti to the revocation list
+type RevokeRequest struct {
+	// JTI is the required jti claim of the token to revoke
+	JTI string `json:"jti"`
+
+	// TTL is how long the jti is published, in the format accepted by time.ParseDuration.  If unset,
+	// the configured default is used.
+	TTL string `json:"ttl,omitempty"`
+}
+
+// List is the published revocation list
+type List struct {
+	Revoked []Entry `json:"revoked"`
+}
+
+// NewListEndpoint returns a go-kit endpoint that produces the current List from a Store
+func NewListEndpoint(s Store) endpoint.Endpoint {
+	return func(_ context.Context, _ interface{}) (interface{}, error) {
+		entries, err := s.List()
+		if err != nil {
+			return nil, err
+		}
+
+		return List{Revoked: entries}, nil
+	}
+}
+
+// ttl computes the TTL for a request, enforcing the configured maximum
+func (o Options) ttl(rr RevokeRequest) (time.Duration, error) {
+	if len(rr.TTL) == 0 {
+		return o.defaultTTL(), nil
+	}
+
+	ttl, err := time.ParseDuration(rr.TTL)
+	if err != nil {
+		return 0, BadRequestError{Err: err}
+	}
+
+	if ttl <= 0 || (o.MaxTTL > 0 && ttl > o.MaxTTL) {
+		return 0, InvalidTTLError{TTL: ttl, MaxTTL: o.MaxTTL}
+	}
+
+	return ttl, nil
+}
+
+// NewRevokeEndpoint returns a go-kit endpoint that adds the jti from a RevokeRequest to a Store.
+// The response is the Entry that was stored.
+func NewRevokeEndpoint(s Store, o Options) endpoint.Endpoint {
+	return newRevokeEndpoint(s, o, time.Now)
+}
+
+func newRevokeEndpoint(s Store, o Options, now func() time.Time) endpoint.Endpoint {
+	return func(_ context.Context, v interface{}) (interface{}, error) {
+		rr := v.(RevokeRequest)
+		if len(rr.JTI) == 0 {
+			return nil, BadRequestError{Err: ErrJTIRequired}
+		}
+
+		ttl, err := o.ttl(rr)
+		if err != nil {
+			return nil, err
+		}
+
+		expires := now().Add(ttl)
+		if err := s.Revoke(rr.JTI, expires); err != nil {
+			return nil, err
+		}
+
+		return Entry{JTI: rr.JTI, Expires: expires.Unix()}, nil
+	}
+}
@@ -0,0 +1,112 @@
+package revocation
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBadRequestError(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		cause       = errors.New("expected")
+		err   error = BadRequestError{Err: cause}
+	)
+
+	assert.Equal("expected", err.Error())
+	assert.True(errors.Is(err, cause))
+	assert.Equal(http.StatusBadRequest, err.(BadRequestError).StatusCode())
+}
+
+func TestInvalidTTLError(t *testing.T) {
+	var (
+		assert = assert.New(t)
+	)
+
+	assert.Contains(InvalidTTLError{TTL: -time.Second}.Error(), "positive")
+	assert.Contains(InvalidTTLError{TTL: 2 * time.Hour, MaxTTL: time.Hour}.Error(), "1h0m0s")
+	assert.Equal(http.StatusBadRequest, InvalidTTLError{}.StatusCode())
+}
+
+func testNewRevokeEndpointSuccess(t *testing.T) {
+	testData := []struct {
+		options     Options
+		ttl         string
+		expectedTTL time.Duration
+	}{
+		{Options{}, "", DefaultTTL},
+		{Options{DefaultTTL: time.Hour}, "", time.Hour},
+		{Options{DefaultTTL: time.Hour}, "15m", 15 * time.Minute},
+		{Options{MaxTTL: time.Hour}, "1h", time.Hour},
+	}
+
+	for _, record := range testData {
+		t.Run(record.ttl, func(t *testing.T) {
+			var (
+				assert  = assert.New(t)
+				require = require.New(t)
+
+				store  = NewMemoryStore()
+				revoke = NewRevokeEndpoint(store, record.options)
+				before = time.Now()
+			)
+
+			v, err := revoke(context.Background(), RevokeRequest{JTI: "test", TTL: record.ttl})
+			require.NoError(err)
+			require.IsType(Entry{}, v)
+
+			entry := v.(Entry)
+			assert.Equal("test", entry.JTI)
+			assert.True(entry.Expires >= before.Add(record.expectedTTL).Unix())
+			assert.True(entry.Expires <= time.Now().Add(record.expectedTTL).Unix())
+
+			list, err := NewListEndpoint(store)(context.Background(), nil)
+			require.NoError(err)
+			assert.Equal(List{Revoked: []Entry{entry}}, list)
+		})
+	}
+}
+
+func testNewRevokeEndpointFailure(t *testing.T) {
+	testData := []struct {
+		request  RevokeRequest
+		expected interface{}
+	}{
+		{RevokeRequest{}, BadRequestError{}},
+		{RevokeRequest{JTI: "test", TTL: "this is not a duration"}, BadRequestError{}},
+		{RevokeRequest{JTI: "test", TTL: "-1h"}, InvalidTTLError{}},
+		{RevokeRequest{JTI: "test", TTL: "2h"}, InvalidTTLError{}},
+	}
+
+	for _, record := range testData {
+		t.Run(record.request.TTL, func(t *testing.T) {
+			var (
+				assert  = assert.New(t)
+				require = require.New(t)
+
+				store  = NewMemoryStore()
+				revoke = NewRevokeEndpoint(store, Options{MaxTTL: time.Hour})
+			)
+
+			v, err := revoke(context.Background(), record.request)
+			assert.Nil(v)
+			require.Error(err)
+			assert.IsType(record.expected, err)
+
+			entries, err := store.List()
+			require.NoError(err)
+			assert.Empty(entries)
+		})
+	}
+}
+
+func TestNewRevokeEndpoint(t *testing.T) {
+	t.Run("Success", testNewRevokeEndpointSuccess)
+	t.Run("Failure", testNewRevokeEndpointFailure)
+}
@@ -0,0 +1,44 @@
+package revocation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+// ListHandler is the http.Handler that publishes the revocation list
+type ListHandler http.Handler
+
+// NewListHandler produces an http.Handler that serves the List from a NewListEndpoint
+func NewListHandler(e endpoint.Endpoint) ListHandler {
+	return kithttp.NewServer(
+		e,
+		kithttp.NopRequestDecoder,
+		kithttp.EncodeJSONResponse,
+	)
+}
+
+// RevokeHandler is the http.Handler that adds a jti to the revocation list
+type RevokeHandler http.Handler
+
+// DecodeRevokeRequest decodes a RevokeRequest from a JSON request body
+func DecodeRevokeRequest(_ context.Context, request *http.Request) (interface{}, error) {
+	var rr RevokeRequest
+	if err := json.NewDecoder(request.Body).Decode(&rr); err != nil {
+		return nil, BadRequestError{Err: err}
+	}
+
+	return rr, nil
+}
+
+// NewRevokeHandler produces an http.Handler that serves a NewRevokeEndpoint
+func NewRevokeHandler(e endpoint.Endpoint) RevokeHandler {
+	return kithttp.NewServer(
+		e,
+		DecodeRevokeRequest,
+		kithttp.EncodeJSONResponse,
+	)
+}
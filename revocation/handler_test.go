@@ -0,0 +1,50 @@
+package revocation
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlers(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		store  = NewMemoryStore()
+		list   = NewListHandler(NewListEndpoint(store))
+		revoke = NewRevokeHandler(NewRevokeEndpoint(store, Options{}))
+	)
+
+	response := httptest.NewRecorder()
+	revoke.ServeHTTP(response, httptest.NewRequest("POST", "/revocations", strings.NewReader(`{"jti": "test", "ttl": "1h"}`)))
+	require.Equal(http.StatusOK, response.Code)
+
+	var entry Entry
+	require.NoError(json.Unmarshal(response.Body.Bytes(), &entry))
+	assert.Equal("test", entry.JTI)
+	assert.InDelta(time.Now().Add(time.Hour).Unix(), entry.Expires, 2)
+
+	response = httptest.NewRecorder()
+	list.ServeHTTP(response, httptest.NewRequest("GET", "/revocations", nil))
+	require.Equal(http.StatusOK, response.Code)
+	assert.Equal("application/json; charset=utf-8", response.Header().Get("Content-Type"))
+
+	var l List
+	require.NoError(json.Unmarshal(response.Body.Bytes(), &l))
+	assert.Equal(List{Revoked: []Entry{entry}}, l)
+
+	response = httptest.NewRecorder()
+	revoke.ServeHTTP(response, httptest.NewRequest("POST", "/revocations", strings.NewReader(`this is not JSON`)))
+	assert.Equal(http.StatusBadRequest, response.Code)
+
+	response = httptest.NewRecorder()
+	revoke.ServeHTTP(response, httptest.NewRequest("POST", "/revocations", strings.NewReader(`{"ttl": "1h"}`)))
+	assert.Equal(http.StatusBadRequest, response.Code)
+}
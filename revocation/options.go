@@ -0,0 +1,26 @@
+package revocation
+
+import "time"
+
+// DefaultTTL is how long a revoked jti is published when neither the request nor the configuration specifies a TTL
+const DefaultTTL time.Duration = 24 * time.Hour
+
+// Options describes the configuration for publishing a revocation list
+type Options struct {
+	// DefaultTTL is how long a revoked jti is published when the revocation request does not specify a TTL.
+	// If unset, the package-level DefaultTTL is used.  This should usually be at least the lifetime of issued
+	// tokens, since a revoked token that outlives its entry is once again accepted by verifiers.
+	DefaultTTL time.Duration
+
+	// MaxTTL is the optional upper bound on the TTL a revocation request may specify.  A longer TTL is
+	// rejected with a 400.  If unset, any TTL is permitted.
+	MaxTTL time.Duration
+}
+
+func (o Options) defaultTTL() time.Duration {
+	if o.DefaultTTL > 0 {
+		return o.DefaultTTL
+	}
+
+	return DefaultTTL
+}
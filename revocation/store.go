@@ -0,0 +1,81 @@
+package revocation
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Entry is a single revoked token, as published to verifiers
+type Entry struct {
+	// JTI is the jti claim of the revoked token
+	JTI string `json:"jti"`
+
+	// Expires is the time, in seconds since the epoch, after which this entry is no longer published
+	Expires int64 `json:"exp"`
+}
+
+// Store is the storage strategy for revoked jti values.  Implementations must be safe for concurrent use.
+type Store interface {
+	// Revoke adds a jti to the revocation list until the given expiry.  Revoking a jti that is already
+	// present replaces its expiry.
+	Revoke(jti string, expires time.Time) error
+
+	// List returns the unexpired entries.  The order of the entries is unspecified.
+	List() ([]Entry, error)
+}
+
+// memoryStore is the in-memory Store
+type memoryStore struct {
+	lock    sync.Mutex
+	now     func() time.Time
+	expires map[string]time.Time
+}
+
+// NewMemoryStore creates a Store that holds revoked jti values in memory.  Entries are not shared across
+// processes and do not survive a restart.
+func NewMemoryStore() Store {
+	return newMemoryStore(time.Now)
+}
+
+func newMemoryStore(now func() time.Time) *memoryStore {
+	return &memoryStore{
+		now:     now,
+		expires: make(map[string]time.Time),
+	}
+}
+
+// prune removes expired entries.  The lock must be held.
+func (m *memoryStore) prune(now time.Time) {
+	for jti, expires := range m.expires {
+		if !now.Before(expires) {
+			delete(m.expires, jti)
+		}
+	}
+}
+
+func (m *memoryStore) Revoke(jti string, expires time.Time) error {
+	m.lock.Lock()
+	m.prune(m.now())
+	m.expires[jti] = expires
+	m.lock.Unlock()
+
+	return nil
+}
+
+func (m *memoryStore) List() ([]Entry, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.prune(m.now())
+	entries := make([]Entry, 0, len(m.expires))
+	for jti, expires := range m.expires {
+		entries = append(entries, Entry{JTI: jti, Expires: expires.Unix()})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].JTI < entries[j].JTI
+	})
+
+	return entries, nil
+}
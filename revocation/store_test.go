@@ -0,0 +1,51 @@
+package revocation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		now   = time.Unix(1000, 0)
+		store = NewMemoryStore()
+	)
+
+	store.(*memoryStore).now = func() time.Time { return now }
+
+	entries, err := store.List()
+	require.NoError(err)
+	assert.Empty(entries)
+	assert.NotNil(entries)
+
+	require.NoError(store.Revoke("second", now.Add(time.Hour)))
+	require.NoError(store.Revoke("first", now.Add(time.Minute)))
+	entries, err = store.List()
+	require.NoError(err)
+	assert.Equal(
+		[]Entry{
+			{JTI: "first", Expires: 1060},
+			{JTI: "second", Expires: 4600},
+		},
+		entries,
+	)
+
+	// revoking again replaces the expiry
+	require.NoError(store.Revoke("first", now.Add(2*time.Hour)))
+
+	now = now.Add(time.Hour)
+	entries, err = store.List()
+	require.NoError(err)
+	assert.Equal([]Entry{{JTI: "first", Expires: 8200}}, entries)
+
+	now = now.Add(time.Hour)
+	entries, err = store.List()
+	require.NoError(err)
+	assert.Empty(entries)
+}
@@ -0,0 +1,65 @@
+package revocation
+
+import (
+	"github.com/xmidt-org/themis/clock"
+	"github.com/xmidt-org/themis/config"
+
+	"go.uber.org/fx"
+)
+
+// RevocationIn describes the dependencies for unmarshalling a revocation list
+type RevocationIn struct {
+	fx.In
+
+	Unmarshaller config.Unmarshaller
+
+	// Store is the optional storage for revoked jti values.  If not supplied, an in-memory store is used.
+	Store Store `optional:"true"`
+
+	// Clock is the optional source of the current time for revocation expiries.  If not supplied, the
+	// system time is used.
+	Clock clock.Clock `optional:"true"`
+}
+
+// RevocationOut describes the components emitted for a revocation list.  When the revocation list is not
+// configured, all of these components are nil.
+type RevocationOut struct {
+	fx.Out
+
+	ListHandler   ListHandler
+	RevokeHandler RevokeHandler
+}
+
+// Unmarshal returns an uber/fx provider that reads Options from the given configuration key and emits the
+// handlers that publish and add to the revocation list.  Themis only publishes this list.  Enforcing it is
+// left to verifiers.
+func Unmarshal(configKey string) func(RevocationIn) (RevocationOut, error) {
+	return func(in RevocationIn) (RevocationOut, error) {
+		if !in.Unmarshaller.IsSet(configKey) {
+			return RevocationOut{}, nil
+		}
+
+		var o Options
+		if err := in.Unmarshaller.UnmarshalKey(configKey, &o); err != nil {
+			return RevocationOut{}, err
+		}
+
+		if o.MaxTTL > 0 && o.defaultTTL() > o.MaxTTL {
+			return RevocationOut{}, InvalidTTLError{TTL: o.defaultTTL(), MaxTTL: o.MaxTTL}
+		}
+
+		var (
+			now = clock.NowFunc(in.Clock)
+			s   = in.Store
+		)
+
+		if s == nil {
+			s = newMemoryStore(now)
+		}
+
+		return RevocationOut{
+			ListHandler:   NewListHandler(NewListEndpoint(s)),
+			RevokeHandler: NewRevokeHandler(newRevokeEndpoint(s, o, now)),
+		}, nil
+	}
+}
@@ -0,0 +1,186 @@
+package revocation
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xmidt-org/themis/clock"
+	"github.com/xmidt-org/themis/clock/clocktest"
+	"github.com/xmidt-org/themis/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+type testStore struct {
+	Store
+	revoked []string
+}
+
+func (ts *testStore) Revoke(jti string, expires time.Time) error {
+	ts.revoked = append(ts.revoked, jti)
+	return ts.Store.Revoke(jti, expires)
+}
+
+func testUnmarshalNotConfigured(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		out RevocationOut
+		app = fxtest.New(t,
+			fx.Provide(
+				config.ProvideViper(config.Json(`{}`)),
+				Unmarshal("revocation"),
+			),
+			fx.Invoke(func(l ListHandler, r RevokeHandler) {
+				out.ListHandler, out.RevokeHandler = l, r
+			}),
+		)
+	)
+
+	assert.NoError(app.Err())
+	assert.Nil(out.ListHandler)
+	assert.Nil(out.RevokeHandler)
+}
+
+func testUnmarshalConfigured(t *testing.T, store Store) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		list   ListHandler
+		revoke RevokeHandler
+		app    = fxtest.New(t,
+			fx.Provide(
+				config.ProvideViper(config.Json(`{"revocation": {"defaultTTL": "1h", "maxTTL": "2h"}}`)),
+				func() Store { return store },
+				Unmarshal("revocation"),
+			),
+			fx.Populate(&list, &revoke),
+		)
+	)
+
+	require.NoError(app.Err())
+	assert.NotNil(list)
+	assert.NotNil(revoke)
+}
+
+func testUnmarshalCustomStore(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		store  = &testStore{Store: NewMemoryStore()}
+
+		revoke RevokeHandler
+		app    = fxtest.New(t,
+			fx.Provide(
+				config.ProvideViper(config.Json(`{"revocation": {"defaultTTL": "1h", "maxTTL": "2h"}}`)),
+				func() Store { return store },
+				Unmarshal("revocation"),
+			),
+			fx.Populate(&revoke),
+		)
+	)
+
+	require.NoError(t, app.Err())
+
+	response := httptest.NewRecorder()
+	revoke.ServeHTTP(response, httptest.NewRequest("POST", "/revocations", strings.NewReader(`{"jti": "test"}`)))
+	assert.Equal(http.StatusOK, response.Code)
+	assert.Equal([]string{"test"}, store.revoked)
+
+	// the configured maximum is enforced
+	response = httptest.NewRecorder()
+	revoke.ServeHTTP(response, httptest.NewRequest("POST", "/revocations", strings.NewReader(`{"jti": "test", "ttl": "3h"}`)))
+	assert.Equal(http.StatusBadRequest, response.Code)
+}
+
+func testUnmarshalError(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		app = fx.New(
+			fx.Provide(
+				config.ProvideViper(config.Json(`{"revocation": {"defaultTTL": "this is not a duration"}}`)),
+				Unmarshal("revocation"),
+			),
+			fx.Invoke(func(ListHandler) {}),
+		)
+	)
+
+	assert.Error(app.Err())
+}
+
+func testUnmarshalDefaultTTLTooLong(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		app = fx.New(
+			fx.Provide(
+				config.ProvideViper(config.Json(`{"revocation": {"maxTTL": "2h"}}`)),
+				Unmarshal("revocation"),
+			),
+			fx.Invoke(func(ListHandler) {}),
+		)
+	)
+
+	assert.Error(app.Err())
+}
+
+func testUnmarshalClock(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		start   = time.Date(2020, 10, 14, 12, 0, 0, 0, time.UTC)
+		fake    = clocktest.NewFake(start)
+
+		list   ListHandler
+		revoke RevokeHandler
+		app    = fxtest.New(t,
+			fx.Provide(
+				config.ProvideViper(config.Json(`{"revocation": {"defaultTTL": "1h"}}`)),
+				func() clock.Clock { return fake },
+				Unmarshal("revocation"),
+			),
+			fx.Populate(&list, &revoke),
+		)
+
+		entries = func() []Entry {
+			response := httptest.NewRecorder()
+			list.ServeHTTP(response, httptest.NewRequest("GET", "/revocations", nil))
+			require.Equal(http.StatusOK, response.Code)
+
+			var l List
+			require.NoError(json.Unmarshal(response.Body.Bytes(), &l))
+			return l.Revoked
+		}
+	)
+
+	require.NoError(app.Err())
+
+	response := httptest.NewRecorder()
+	revoke.ServeHTTP(response, httptest.NewRequest("POST", "/revocations", strings.NewReader(`{"jti": "test"}`)))
+	require.Equal(http.StatusOK, response.Code)
+	assert.Equal([]Entry{{JTI: "test", Expires: start.Add(time.Hour).Unix()}}, entries())
+
+	// the store prunes according to the same clock
+	fake.Add(time.Hour)
+	assert.Empty(entries())
+}
+
+func TestUnmarshal(t *testing.T) {
+	t.Run("NotConfigured", testUnmarshalNotConfigured)
+	t.Run("Configured", func(t *testing.T) {
+		testUnmarshalConfigured(t, nil)
+		testUnmarshalConfigured(t, NewMemoryStore())
+	})
+	t.Run("CustomStore", testUnmarshalCustomStore)
+	t.Run("Error", testUnmarshalError)
+	t.Run("DefaultTTLTooLong", testUnmarshalDefaultTTLTooLong)
+	t.Run("Clock", testUnmarshalClock)
+}
@@ -2,8 +2,10 @@ package main
 
 import (
 	"errors"
+	"net/http"
 
 	"github.com/xmidt-org/themis/key"
+	"github.com/xmidt-org/themis/revocation"
 	"github.com/xmidt-org/themis/token"
 	"github.com/xmidt-org/themis/xhealth"
 	"github.com/xmidt-org/themis/xhttp/xhttpserver"
@@ -69,34 +71,89 @@ func provideServerChainFactory(in ServerChainIn) xhttpserver.ChainFactory {
 	})
 }
 
+// authenticatedRoutes are the routes that the authentication configuration can protect.  The key routes are
+// protected as a whole: /keys/{kid} covers every key and /groups/{group}/keys covers every group's key set.
+var authenticatedRoutes = []string{
+	"/keys",
+	"/keys/{kid}",
+	"/groups/{group}/keys",
+	"/issue",
+	"/issue/batch",
+	"/issue/pair",
+	"/issue/challenge",
+	"/claims",
+	"/keys/usage",
+	"/revocations",
+}
+
 type KeyRoutesIn struct {
 	fx.In
-	Router     *mux.Router `name:"servers.key"`
-	Handler    key.Handler
-	HandlerJWK key.HandlerJWK
+	Router        *mux.Router `name:"servers.key"`
+	Handler       key.Handler
+	HandlerJWK    key.HandlerJWK
+	HandlerJWKSet key.HandlerJWKSet `optional:"true"`
+
+	KeySetHandlers key.KeySetHandlers `optional:"true"`
+
+	RevocationListHandler revocation.ListHandler `optional:"true"`
+
+	Authenticators xhttpserver.Authenticators `optional:"true"`
 }
 
 func BuildKeyRoutes(in KeyRoutesIn) {
 	if in.Router != nil {
-		keys := in.Router.PathPrefix("/keys/{kid}").Methods("GET").Subrouter()
+		if in.HandlerJWKSet != nil {
+			in.Router.Handle("/keys", in.Authenticators.Then("/keys", in.HandlerJWKSet)).Methods("GET")
+		}
+
+		for group, handler := range in.KeySetHandlers {
+			in.Router.Handle("/groups/"+group+"/keys", in.Authenticators.Then("/groups/{group}/keys", handler)).Methods("GET")
+		}
+
+		if in.RevocationListHandler != nil {
+			in.Router.Handle("/revocations", in.Authenticators.Then("/revocations", in.RevocationListHandler)).Methods("GET")
+		}
+
+		var (
+			keys       = in.Router.PathPrefix("/keys/{kid}").Methods("GET").Subrouter()
+			handler    = in.Authenticators.Then("/keys/{kid}", in.Handler)
+			handlerJWK = in.Authenticators.Then("/keys/{kid}", in.HandlerJWK)
+		)
 
-		keys.Headers("Accept", key.ContentTypePEM).Handler(in.Handler)
-		keys.Headers("Accept", key.ContentTypeJWK).Handler(in.HandlerJWK)
-		keys.Path("").Handler(in.Handler) // default
-		keys.Path("/key.pem").Handler(in.Handler)
-		keys.Path("/key.json").Handler(in.HandlerJWK)
+		keys.Headers("Accept", key.ContentTypePEM).Handler(handler)
+		keys.Headers("Accept", key.ContentTypeJWK).Handler(handlerJWK)
+		keys.Path("").Handler(handler) // default
+		keys.Path("/key.pem").Handler(handler)
+		keys.Path("/key.json").Handler(handlerJWK)
 	}
 }
 
 type IssuerRoutesIn struct {
 	fx.In
-	Router  *mux.Router `name:"servers.issuer"`
-	Handler token.IssueHandler
+	Router       *mux.Router `name:"servers.issuer"`
+	Handler      token.IssueHandler
+	BatchHandler token.BatchHandler `optional:"true"`
+	PairHandler  token.PairHandler  `optional:"true"`
+
+	ChallengeHandler token.ChallengeHandler `optional:"true"`
+
+	Authenticators xhttpserver.Authenticators `optional:"true"`
 }
 
 func BuildIssuerRoutes(in IssuerRoutesIn) {
 	if in.Router != nil && in.Handler != nil {
-		in.Router.Handle("/issue", in.Handler).Methods("GET")
+		in.Router.Handle("/issue", in.Authenticators.Then("/issue", in.Handler)) // the handler enforces the configured methods
+		if in.BatchHandler != nil {
+			in.Router.Handle("/issue/batch", in.Authenticators.Then("/issue/batch", in.BatchHandler)).Methods("POST")
+		}
+
+		if in.PairHandler != nil {
+			in.Router.Handle("/issue/pair", in.Authenticators.Then("/issue/pair", in.PairHandler)) // the handler enforces the configured methods
+		}
+
+		if in.ChallengeHandler != nil {
+			in.Router.Handle("/issue/challenge", in.Authenticators.Then("/issue/challenge", in.ChallengeHandler)).Methods("GET")
+		}
 	}
 }
 
@@ -104,19 +161,21 @@ type ClaimsRoutesIn struct {
 	fx.In
 	Router  *mux.Router `name:"servers.claims"`
 	Handler token.ClaimsHandler
+
+	Authenticators xhttpserver.Authenticators `optional:"true"`
 }
 
 func BuildClaimsRoutes(in ClaimsRoutesIn) {
 	if in.Router != nil && in.Handler != nil {
-		in.Router.Handle("/claims", in.Handler).Methods("GET")
+		in.Router.Handle("/claims", in.Authenticators.Then("/claims", in.Handler)).Methods("GET")
 	}
 }
 
 // CheckServerRequirements is an fx.Invoke function that does post-configuration verification
 // that we have required servers.  The valid server configurations are:
 //
-//    Both keys and issuer present.  Claims is optional in this case
-//    Neither keys or issuer present.  Claims is required in this case
+//	Both keys and issuer present.  Claims is optional in this case
+//	Neither keys or issuer present.  Claims is required in this case
 //
 // Any other arrangements results in an error.
 func CheckServerRequirements(k KeyRoutesIn, i IssuerRoutesIn, c ClaimsRoutesIn) error {
@@ -145,6 +204,17 @@ func CheckServerRequirements(k KeyRoutesIn, i IssuerRoutesIn, c ClaimsRoutesIn)
 	return nil
 }
 
+type AuthenticatorsCheckIn struct {
+	fx.In
+	Authenticators xhttpserver.Authenticators `optional:"true"`
+}
+
+// CheckAuthenticators is an fx.Invoke function that refuses to start when authentication is configured for a
+// route that themis does not serve, since that route would silently be left unprotected
+func CheckAuthenticators(in AuthenticatorsCheckIn) error {
+	return in.Authenticators.CheckRoutes(authenticatedRoutes...)
+}
+
 type MetricsRoutesIn struct {
 	fx.In
 	Router  *mux.Router `name:"servers.metrics"`
@@ -161,11 +231,32 @@ type HealthRoutesIn struct {
 	fx.In
 	Router  *mux.Router `name:"servers.health"`
 	Handler xhealth.Handler
+	Keys    key.Registry     `optional:"true"`
+	Drainer *xhealth.Drainer `optional:"true"`
 }
 
 func BuildHealthRoutes(in HealthRoutesIn) {
 	if in.Router != nil && in.Handler != nil {
-		in.Router.Handle("/health", in.Handler).Methods("GET")
+		var handler http.Handler = in.Handler
+		if in.Drainer != nil {
+			handler = in.Drainer.Then(handler)
+		}
+
+		in.Router.Handle("/health", handler).Methods("GET")
+	}
+
+	if in.Router != nil && in.Keys != nil {
+		checks := []xhealth.ReadyCheck{
+			func() error {
+				return key.Ready(in.Keys)
+			},
+		}
+
+		if in.Drainer != nil {
+			checks = append(checks, in.Drainer.Check)
+		}
+
+		in.Router.Handle("/ready", xhealth.NewReadyHandler(checks...)).Methods("GET")
 	}
 }
 
@@ -179,3 +270,22 @@ func BuildPprofRoutes(in PprofRoutesIn) {
 		pprof.BuildRoutes(in.Router)
 	}
 }
+
+type AdminRoutesIn struct {
+	fx.In
+	Router       *mux.Router `name:"servers.admin"`
+	UsageHandler key.UsageHandler
+
+	RevokeHandler revocation.RevokeHandler `optional:"true"`
+
+	Authenticators xhttpserver.Authenticators `optional:"true"`
+}
+
+func BuildAdminRoutes(in AdminRoutesIn) {
+	if in.Router != nil {
+		in.Router.Handle("/keys/usage", in.Authenticators.Then("/keys/usage", in.UsageHandler)).Methods("GET")
+		if in.RevokeHandler != nil {
+			in.Router.Handle("/revocations", in.Authenticators.Then("/revocations", in.RevokeHandler)).Methods("POST")
+		}
+	}
+}
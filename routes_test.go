@@ -1,13 +1,22 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/go-kit/kit/log"
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/xmidt-org/themis/key"
+	"github.com/xmidt-org/themis/xhealth"
+	"github.com/xmidt-org/themis/xhttp/xhttpserver"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
 )
 
 func TestBuildKeyRoutes(t *testing.T) {
@@ -32,13 +41,73 @@ func TestBuildKeyRoutes(t *testing.T) {
 			response.Write([]byte("jwk"))
 		})
 
+		handlerJWKSet = http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			response.Header().Set("Content-Type", key.ContentTypeJWKSet)
+			response.Write([]byte("jwkset"))
+		})
+
+		groupHandler = func(group string) key.HandlerJWKSet {
+			return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+				response.Header().Set("Content-Type", key.ContentTypeJWKSet)
+				response.Write([]byte(group))
+			})
+		}
+
 		router = mux.NewRouter()
 	)
 
 	BuildKeyRoutes(KeyRoutesIn{
-		Router:     router,
-		Handler:    handlerPEM,
-		HandlerJWK: handlerJWK,
+		Router:        router,
+		Handler:       handlerPEM,
+		HandlerJWK:    handlerJWK,
+		HandlerJWKSet: handlerJWKSet,
+		KeySetHandlers: key.KeySetHandlers{
+			"access":  groupHandler("access"),
+			"refresh": groupHandler("refresh"),
+		},
+		RevocationListHandler: http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			response.Write([]byte("revocations"))
+		}),
+	})
+
+	t.Run("KeySet", func(t *testing.T) {
+		var (
+			assert   = assert.New(t)
+			response = httptest.NewRecorder()
+			request  = httptest.NewRequest("GET", "/keys", nil)
+		)
+
+		router.ServeHTTP(response, request)
+		assert.Equal(http.StatusOK, response.Code)
+		assert.Equal(key.ContentTypeJWKSet, response.Header().Get("Content-Type"))
+		assert.Equal("jwkset", response.Body.String())
+	})
+
+	t.Run("GroupKeySet", func(t *testing.T) {
+		for _, group := range []string{"access", "refresh"} {
+			var (
+				assert   = assert.New(t)
+				response = httptest.NewRecorder()
+				request  = httptest.NewRequest("GET", "/groups/"+group+"/keys", nil)
+			)
+
+			router.ServeHTTP(response, request)
+			assert.Equal(http.StatusOK, response.Code)
+			assert.Equal(key.ContentTypeJWKSet, response.Header().Get("Content-Type"))
+			assert.Equal(group, response.Body.String())
+		}
+	})
+
+	t.Run("Revocations", func(t *testing.T) {
+		var (
+			assert   = assert.New(t)
+			response = httptest.NewRecorder()
+			request  = httptest.NewRequest("GET", "/revocations", nil)
+		)
+
+		router.ServeHTTP(response, request)
+		assert.Equal(http.StatusOK, response.Code)
+		assert.Equal("revocations", response.Body.String())
 	})
 
 	t.Run("Default", func(t *testing.T) {
@@ -121,3 +190,188 @@ func TestBuildKeyRoutes(t *testing.T) {
 		assert.Equal(http.StatusMethodNotAllowed, response.Code)
 	})
 }
+
+func TestBuildKeyRoutesAuthenticated(t *testing.T) {
+	var (
+		ok = http.HandlerFunc(func(response http.ResponseWriter, _ *http.Request) {
+			response.Write([]byte("ok"))
+		})
+
+		apiKey, err = xhttpserver.APIKey{Header: "X-Api-Key", Keys: []string{"secret"}}.NewAuthenticator()
+		router      = mux.NewRouter()
+	)
+
+	require.NoError(t, err)
+	BuildKeyRoutes(KeyRoutesIn{
+		Router:         router,
+		Handler:        ok,
+		HandlerJWK:     ok,
+		HandlerJWKSet:  ok,
+		KeySetHandlers: key.KeySetHandlers{"access": ok},
+
+		RevocationListHandler: ok,
+		Authenticators: xhttpserver.Authenticators{
+			"/keys":                apiKey,
+			"/keys/{kid}":          apiKey,
+			"/groups/{group}/keys": apiKey,
+			"/revocations":         apiKey,
+		},
+	})
+
+	for _, path := range []string{"/keys", "/keys/test", "/keys/test/key.pem", "/keys/test/key.json", "/groups/access/keys", "/revocations"} {
+		t.Run(path, func(t *testing.T) {
+			var (
+				assert   = assert.New(t)
+				response = httptest.NewRecorder()
+			)
+
+			router.ServeHTTP(response, httptest.NewRequest("GET", path, nil))
+			assert.Equal(http.StatusUnauthorized, response.Code)
+
+			response = httptest.NewRecorder()
+			request := httptest.NewRequest("GET", path, nil)
+			request.Header.Set("X-Api-Key", "secret")
+			router.ServeHTTP(response, request)
+			assert.Equal(http.StatusOK, response.Code)
+			assert.Equal("ok", response.Body.String())
+		})
+	}
+}
+
+func TestCheckAuthenticators(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		allow  = xhttpserver.AuthenticatorFunc(func(*http.Request) error { return nil })
+	)
+
+	assert.NoError(CheckAuthenticators(AuthenticatorsCheckIn{}))
+	assert.NoError(CheckAuthenticators(AuthenticatorsCheckIn{
+		Authenticators: xhttpserver.Authenticators{"/issue": allow, "/keys": allow, "/groups/{group}/keys": allow},
+	}))
+
+	assert.Equal(
+		xhttpserver.UnknownRouteError{Route: "/isue"},
+		CheckAuthenticators(AuthenticatorsCheckIn{Authenticators: xhttpserver.Authenticators{"/isue": allow}}),
+	)
+}
+
+func TestBuildHealthRoutesReady(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		router   = mux.NewRouter()
+		registry = key.NewRegistry(nil)
+		loaded   = make(chan error, 1)
+
+		ready = func() int {
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, httptest.NewRequest("GET", "/ready", nil))
+			return response.Code
+		}
+	)
+
+	BuildHealthRoutes(HealthRoutesIn{
+		Router: router,
+		Keys:   registry,
+	})
+
+	assert.Equal(http.StatusServiceUnavailable, ready())
+
+	// simulate a signing key that arrives some time after startup, e.g. from a remote KMS
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		if _, err := registry.Register(key.Descriptor{Kid: "delayed", Bits: 512}); err != nil {
+			loaded <- err
+			return
+		}
+
+		loaded <- registry.Activate("delayed")
+	}()
+
+	assert.Equal(http.StatusServiceUnavailable, ready())
+	require.NoError(<-loaded)
+	assert.Equal(http.StatusOK, ready())
+}
+
+func TestBuildHealthRoutesPreDrain(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		router   = mux.NewRouter()
+		registry = key.NewRegistry(nil)
+		drainer  = xhealth.NewDrainer(200 * time.Millisecond)
+		server   = httptest.NewServer(router)
+
+		lifecycle = fxtest.NewLifecycle(t)
+		closed    = make(chan struct{})
+	)
+
+	_, err := registry.Register(key.Descriptor{Kid: "test", Bits: 512})
+	require.NoError(err)
+	require.NoError(registry.Activate("test"))
+
+	BuildHealthRoutes(HealthRoutesIn{
+		Router: router,
+		Handler: http.HandlerFunc(func(response http.ResponseWriter, _ *http.Request) {
+			response.WriteHeader(http.StatusOK)
+		}),
+		Keys:    registry,
+		Drainer: drainer,
+	})
+
+	get := func(path string) int {
+		response, err := http.Get(server.URL + path)
+		require.NoError(err)
+		defer response.Body.Close()
+		return response.StatusCode
+	}
+
+	// the server's hook is appended first, just as servers are created before PreDrain is invoked
+	lifecycle.Append(fx.Hook{
+		OnStop: func(context.Context) error {
+			server.Close()
+			close(closed)
+			return nil
+		},
+	})
+
+	xhealth.PreDrain(xhealth.PreDrainIn{
+		Logger:    log.NewNopLogger(),
+		Lifecycle: lifecycle,
+		Drainer:   drainer,
+	})
+
+	lifecycle.RequireStart()
+	assert.Equal(http.StatusOK, get("/health"))
+	assert.Equal(http.StatusOK, get("/ready"))
+
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- lifecycle.Stop(context.Background())
+	}()
+
+	require.Eventually(drainer.Draining, time.Second, time.Millisecond)
+
+	// during the pre-drain window, the server still accepts connections but reports itself unhealthy
+	assert.Equal(http.StatusServiceUnavailable, get("/health"))
+
+	response, err := http.Get(server.URL + "/ready")
+	require.NoError(err)
+	defer response.Body.Close()
+	assert.Equal(http.StatusServiceUnavailable, response.StatusCode)
+
+	var r xhealth.Readiness
+	require.NoError(json.NewDecoder(response.Body).Decode(&r))
+	assert.Equal([]string{xhealth.ErrDraining.Error()}, r.Errors)
+
+	select {
+	case <-closed:
+		assert.Fail("The server was closed before the grace period elapsed")
+	default:
+	}
+
+	require.NoError(<-stopped)
+	<-closed
+}
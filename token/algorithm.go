@@ -0,0 +1,124 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/xmidt-org/themis/key"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// AlgorithmMetadata is the Request.Metadata key holding the requested signing algorithm, when algorithms are configured
+const AlgorithmMetadata = "alg"
+
+var (
+	ErrAlgorithmSourceRequired = errors.New("An algorithm header or parameter is required")
+	ErrAlgorithmsWithTenants   = errors.New("Per-request algorithms cannot be combined with tenant keys")
+)
+
+// UnsupportedAlgorithmError is returned when a token request asks for a signing algorithm that is not in the allow-list
+type UnsupportedAlgorithmError struct {
+	Alg interface{}
+}
+
+func (uae UnsupportedAlgorithmError) Error() string {
+	return fmt.Sprintf("Unsupported signing algorithm: %v", uae.Alg)
+}
+
+func (uae UnsupportedAlgorithmError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// Algorithms describes how a token request may select a signing algorithm other than the factory's Alg.  The
+// algorithm name is taken from the Header, or the Parameter if the header is absent.  Requests that do not name
+// an algorithm are signed with the factory's Alg and Key as usual.
+type Algorithms struct {
+	// Header is the HTTP header containing the algorithm name
+	Header string
+
+	// Parameter is the HTTP parameter containing the algorithm name
+	Parameter string
+
+	// Keys is the allow-list of algorithms.  It maps each algorithm name, e.g. ES256, onto the descriptor for
+	// the key that signs with that algorithm.  Algorithm names are matched case insensitively.  If a descriptor
+	// has no Kid, the algorithm name is used as the kid unless the descriptor requests a thumbprint kid.
+	//
+	// The factory's own Alg is always allowed and need not appear here.
+	Keys map[string]key.Descriptor
+}
+
+// signer is a signing method together with the key that signs with it
+type signer struct {
+	method jwt.SigningMethod
+	pair   key.Pair
+}
+
+// getSigningMethod looks up a signing method by algorithm name in any case, since configuration keys are
+// case insensitive
+func getSigningMethod(alg string) jwt.SigningMethod {
+	if strings.EqualFold(alg, key.AlgEdDSA) {
+		return key.SigningMethodEdDSA
+	}
+
+	return jwt.GetSigningMethod(strings.ToUpper(alg))
+}
+
+// newAlgorithmSigners registers a key for each allowed algorithm.  The returned map is keyed by uppercased algorithm name.
+func newAlgorithmSigners(o Options, kr key.Registry) (map[string]signer, error) {
+	if o.Tenant != nil {
+		return nil, ErrAlgorithmsWithTenants
+	}
+
+	signers := make(map[string]signer, len(o.Algorithms.Keys))
+	for alg, d := range o.Algorithms.Keys {
+		method := getSigningMethod(alg)
+		if method == nil {
+			return nil, fmt.Errorf("No such signing method: %s", alg)
+		}
+
+		if o.DeterministicSignatures {
+			if m, err := newDeterministicMethod(method); err == nil {
+				method = m
+			}
+		}
+
+		if len(d.Kid) == 0 && !d.Thumbprint {
+			d.Kid = method.Alg()
+		}
+
+		pair, err := kr.Register(d)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := checkAlgorithm(kr, pair.KID(), method); err != nil {
+			return nil, err
+		}
+
+		signers[strings.ToUpper(method.Alg())] = signer{method: method, pair: pair}
+	}
+
+	return signers, nil
+}
+
+// signingMethod selects the signing method and key pair for the given request.  Requests which do not name an
+// algorithm, or which name the factory's own algorithm, fall through to the usual key selection.
+func (f *factory) signingMethod(r *Request) (jwt.SigningMethod, key.Pair, error) {
+	if len(f.algorithms) > 0 {
+		if requested, ok := r.Metadata[AlgorithmMetadata]; ok {
+			alg, _ := requested.(string)
+			alg = strings.ToUpper(alg)
+			if s, ok := f.algorithms[alg]; ok {
+				return s.method, s.pair, nil
+			} else if alg != strings.ToUpper(f.method.Alg()) {
+				return nil, nil, UnsupportedAlgorithmError{Alg: requested}
+			}
+		}
+	}
+
+	pair, err := f.signingPair(r)
+	return f.method, pair, err
+}
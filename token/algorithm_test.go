@@ -0,0 +1,184 @@
+package token
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/xmidt-org/themis/key"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testAlgorithmsSelect(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		registry = key.NewRegistry(rand.Reader)
+
+		o = Options{
+			Alg: "RS256",
+			Key: key.Descriptor{Kid: "default", Bits: 512},
+			Algorithms: &Algorithms{
+				Header:    "X-Alg",
+				Parameter: "alg",
+				Keys: map[string]key.Descriptor{
+					"es256": key.Descriptor{Type: key.KeyTypeECDSA, Bits: 256},
+					"HS256": key.Descriptor{Kid: "hmac", Type: key.KeyTypeSecret},
+				},
+			},
+		}
+	)
+
+	factory, err := NewFactory(o, ClaimBuilders{requestClaimBuilder{}}, registry)
+	require.NoError(err)
+	assert.Equal([]string{"ES256", "default", "hmac"}, registry.Kids())
+
+	rb, err := NewRequestBuilders(o)
+	require.NoError(err)
+
+	testData := []struct {
+		target      string
+		header      string
+		expectedAlg string
+		expectedKid string
+	}{
+		{"/", "", "RS256", "default"},
+		{"/", "RS256", "RS256", "default"},
+		{"/", "ES256", "ES256", "ES256"},
+		{"/?alg=es256", "", "ES256", "ES256"},
+		{"/", "hs256", "HS256", "hmac"},
+		{"/?alg=ES256", "HS256", "HS256", "hmac"},
+	}
+
+	for _, record := range testData {
+		t.Run(record.target+record.header, func(t *testing.T) {
+			original := httptest.NewRequest("GET", record.target, nil)
+			if len(record.header) > 0 {
+				original.Header.Set("X-Alg", record.header)
+			}
+
+			require.NoError(original.ParseForm())
+			tr, err := BuildRequest(original, rb)
+			require.NoError(err)
+
+			signed, err := factory.NewToken(context.Background(), tr)
+			require.NoError(err)
+
+			parsed, err := jwt.Parse(signed, func(token *jwt.Token) (interface{}, error) {
+				pair, ok := registry.Get(token.Header["kid"].(string))
+				require.True(ok)
+
+				switch k := pair.Sign().(type) {
+				case *rsa.PrivateKey:
+					return &k.PublicKey, nil
+				case *ecdsa.PrivateKey:
+					return &k.PublicKey, nil
+				default:
+					return k, nil
+				}
+			})
+
+			require.NoError(err)
+			assert.True(parsed.Valid)
+			assert.Equal(record.expectedAlg, parsed.Method.Alg())
+			assert.Equal(record.expectedKid, parsed.Header["kid"])
+		})
+	}
+}
+
+func testAlgorithmsUnsupported(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		o = Options{
+			Key: key.Descriptor{Kid: "default", Bits: 512},
+			Algorithms: &Algorithms{
+				Header: "X-Alg",
+				Keys: map[string]key.Descriptor{
+					"ES256": key.Descriptor{Type: key.KeyTypeECDSA, Bits: 256},
+				},
+			},
+		}
+	)
+
+	factory, err := NewFactory(o, ClaimBuilders{}, key.NewRegistry(rand.Reader))
+	require.NoError(err)
+
+	rb, err := NewRequestBuilders(o)
+	require.NoError(err)
+
+	for _, alg := range []string{"ES384", "none", ""} {
+		original := httptest.NewRequest("GET", "/", nil)
+		original.Header.Set("X-Alg", alg)
+		tr, err := BuildRequest(original, rb)
+		require.NoError(err)
+
+		signed, err := factory.NewToken(context.Background(), tr)
+		assert.Empty(signed)
+		assert.Equal(UnsupportedAlgorithmError{Alg: alg}, err)
+		assert.Equal(http.StatusBadRequest, err.(UnsupportedAlgorithmError).StatusCode())
+	}
+}
+
+func testAlgorithmsNoSuchMethod(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		registry = key.NewRegistry(rand.Reader)
+	)
+
+	factory, err := NewFactory(
+		Options{
+			Key: key.Descriptor{Kid: "default", Bits: 512},
+			Algorithms: &Algorithms{
+				Header: "X-Alg",
+				Keys: map[string]key.Descriptor{
+					"XX256": key.Descriptor{Bits: 512},
+				},
+			},
+		},
+		ClaimBuilders{},
+		registry,
+	)
+
+	assert.Nil(factory)
+	assert.Error(err)
+}
+
+func testAlgorithmsWithTenants(t *testing.T) {
+	assert := assert.New(t)
+	factory, err := NewFactory(
+		Options{
+			Key:        key.Descriptor{Kid: "default", Bits: 512},
+			Tenant:     &Tenant{Header: "X-Tenant"},
+			Algorithms: &Algorithms{Header: "X-Alg"},
+		},
+		ClaimBuilders{},
+		key.NewRegistry(rand.Reader),
+	)
+
+	assert.Nil(factory)
+	assert.Equal(ErrAlgorithmsWithTenants, err)
+}
+
+func testAlgorithmsNoSource(t *testing.T) {
+	assert := assert.New(t)
+	rb, err := NewRequestBuilders(Options{Algorithms: &Algorithms{}})
+	assert.Empty(rb)
+	assert.Equal(ErrAlgorithmSourceRequired, err)
+}
+
+func TestAlgorithms(t *testing.T) {
+	t.Run("Select", testAlgorithmsSelect)
+	t.Run("Unsupported", testAlgorithmsUnsupported)
+	t.Run("NoSuchMethod", testAlgorithmsNoSuchMethod)
+	t.Run("WithTenants", testAlgorithmsWithTenants)
+	t.Run("NoSource", testAlgorithmsNoSource)
+}
@@ -0,0 +1,112 @@
+package token
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultAMRClaim is the name of the OIDC authentication methods claim when none is configured
+	DefaultAMRClaim = "amr"
+
+	// DefaultAMRMutualTLS is the authentication method recorded for a client certificate when none is configured
+	DefaultAMRMutualTLS = "mtls"
+
+	// DefaultAMRHeaderMethod is the authentication method recorded for the AMR header when none is configured
+	DefaultAMRHeaderMethod = "mfa"
+)
+
+// InvalidAMRHeaderError is returned when the header indicating an authentication method is not a boolean
+type InvalidAMRHeaderError struct {
+	Header string
+	Value  string
+}
+
+func (iahe InvalidAMRHeaderError) Error() string {
+	return fmt.Sprintf("Invalid authentication method indicator in header %s: %s", iahe.Header, iahe.Value)
+}
+
+func (iahe InvalidAMRHeaderError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// AMR describes how to derive an OIDC amr claim, i.e. the array of methods used to authenticate the subject.
+// Methods are derived from characteristics of the token request, in the order of the fields below.  A token
+// request for which no method applies has no amr claim.
+type AMR struct {
+	// Claim is the name of the claim key for the authentication methods.  If unset, DefaultAMRClaim is used.
+	Claim string
+
+	// MutualTLS is the method recorded when the client presented a certificate over mutual TLS.  If unset,
+	// DefaultAMRMutualTLS is used.
+	MutualTLS string
+
+	// DisableMutualTLS prevents a client certificate from contributing a method
+	DisableMutualTLS bool
+
+	// Header is the HTTP header, set by a trusted upstream, that indicates an additional method such as
+	// multi-factor authentication.  Its value is a boolean, and the method is recorded only when it is true.
+	// A value that is not a boolean is rejected with a 400 status.  If unset, no header is consulted.
+	Header string
+
+	// HeaderMethod is the method recorded when the Header is true.  If unset, DefaultAMRHeaderMethod is used.
+	HeaderMethod string
+}
+
+type amrRequestBuilder struct {
+	claim        string
+	mutualTLS    string
+	header       string
+	headerMethod string
+}
+
+func (arb amrRequestBuilder) Build(original *http.Request, tr *Request) error {
+	var methods []string
+	if len(arb.mutualTLS) > 0 && original.TLS != nil && len(original.TLS.PeerCertificates) > 0 {
+		methods = append(methods, arb.mutualTLS)
+	}
+
+	if len(arb.header) > 0 {
+		if v := strings.TrimSpace(original.Header.Get(arb.header)); len(v) > 0 {
+			indicated, err := strconv.ParseBool(v)
+			if err != nil {
+				return InvalidAMRHeaderError{Header: arb.header, Value: v}
+			} else if indicated {
+				methods = append(methods, arb.headerMethod)
+			}
+		}
+	}
+
+	if len(methods) > 0 {
+		tr.Claims[arb.claim] = methods
+	}
+
+	return nil
+}
+
+func newAMRRequestBuilder(a AMR) amrRequestBuilder {
+	arb := amrRequestBuilder{
+		claim:        a.Claim,
+		mutualTLS:    a.MutualTLS,
+		header:       http.CanonicalHeaderKey(a.Header),
+		headerMethod: a.HeaderMethod,
+	}
+
+	if len(arb.claim) == 0 {
+		arb.claim = DefaultAMRClaim
+	}
+
+	if a.DisableMutualTLS {
+		arb.mutualTLS = ""
+	} else if len(arb.mutualTLS) == 0 {
+		arb.mutualTLS = DefaultAMRMutualTLS
+	}
+
+	if len(arb.headerMethod) == 0 {
+		arb.headerMethod = DefaultAMRHeaderMethod
+	}
+
+	return arb
+}
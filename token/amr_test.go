@@ -0,0 +1,120 @@
+package token
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAMR(t *testing.T) {
+	testData := []struct {
+		amr      AMR
+		mtls     bool
+		header   string
+		expected interface{}
+		err      error
+	}{
+		{
+			amr:      AMR{},
+			mtls:     true,
+			expected: []string{"mtls"},
+		},
+		{
+			amr: AMR{},
+		},
+		{
+			amr:      AMR{MutualTLS: "hwk"},
+			mtls:     true,
+			expected: []string{"hwk"},
+		},
+		{
+			amr:  AMR{DisableMutualTLS: true},
+			mtls: true,
+		},
+		{
+			amr:      AMR{Header: "X-MFA"},
+			header:   "true",
+			expected: []string{"mfa"},
+		},
+		{
+			amr:    AMR{Header: "X-MFA"},
+			header: "false",
+		},
+		{
+			amr:      AMR{Header: "x-mfa", HeaderMethod: "otp"},
+			mtls:     true,
+			header:   "1",
+			expected: []string{"mtls", "otp"},
+		},
+		{
+			amr:      AMR{Header: "X-MFA"},
+			mtls:     true,
+			expected: []string{"mtls"},
+		},
+		{
+			amr:    AMR{Header: "X-MFA"},
+			header: "sometimes",
+			err:    InvalidAMRHeaderError{Header: "X-Mfa", Value: "sometimes"},
+		},
+	}
+
+	for i, record := range testData {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			var (
+				assert  = assert.New(t)
+				require = require.New(t)
+
+				builder = newAMRRequestBuilder(record.amr)
+				request = httptest.NewRequest("GET", "/", nil)
+				tr      = NewRequest()
+			)
+
+			if record.mtls {
+				request.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{new(x509.Certificate)}}
+			}
+
+			if len(record.header) > 0 {
+				request.Header.Set("X-MFA", record.header)
+			}
+
+			err := builder.Build(request, tr)
+			if record.err != nil {
+				assert.Equal(record.err, err)
+				assert.Equal(http.StatusBadRequest, err.(InvalidAMRHeaderError).StatusCode())
+				assert.Empty(tr.Claims)
+				return
+			}
+
+			require.NoError(err)
+			if record.expected == nil {
+				assert.Empty(tr.Claims)
+			} else {
+				assert.Equal(map[string]interface{}{DefaultAMRClaim: record.expected}, tr.Claims)
+			}
+		})
+	}
+}
+
+func TestNewRequestBuildersAMR(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		request = httptest.NewRequest("GET", "/", nil)
+	)
+
+	rb, err := NewRequestBuilders(Options{AMR: &AMR{Claim: "methods", Header: "X-MFA"}})
+	require.NoError(err)
+
+	request.TLS = &tls.ConnectionState{}
+	request.Header.Set("X-MFA", "true")
+	tr, err := BuildRequest(request, rb)
+	require.NoError(err)
+	assert.Equal([]string{"mfa"}, tr.Claims["methods"])
+}
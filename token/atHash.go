@@ -0,0 +1,152 @@
+package token
+
+import (
+	"crypto"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/xmidt-org/themis/xhttp/xhttpserver"
+
+	// the hashes used by at_hash must be linked in
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// DefaultAtHashClaim is the name of the OIDC access token hash claim when none is configured
+const DefaultAtHashClaim = "at_hash"
+
+var (
+	ErrAtHashSourceRequired = errors.New("An at_hash claim requires a header or parameter holding the access token")
+)
+
+// UnsupportedAtHashAlgorithmError is returned when no digest is defined for a signing algorithm, so an at_hash
+// claim cannot be computed for tokens signed with it
+type UnsupportedAtHashAlgorithmError struct {
+	Alg string
+}
+
+func (uahae UnsupportedAtHashAlgorithmError) Error() string {
+	return fmt.Sprintf("No at_hash digest for signing algorithm %s", uahae.Alg)
+}
+
+// atHashDigest returns the hash that OIDC pairs with a JWS algorithm: the hash used by the algorithm itself,
+// or SHA-512 for EdDSA
+func atHashDigest(alg string) (crypto.Hash, error) {
+	alg = strings.ToUpper(alg)
+	switch {
+	case alg == "EDDSA":
+		return crypto.SHA512, nil
+	case alg == "NONE":
+		break
+	case strings.HasSuffix(alg, "256"):
+		return crypto.SHA256, nil
+	case strings.HasSuffix(alg, "384"):
+		return crypto.SHA384, nil
+	case strings.HasSuffix(alg, "512"):
+		return crypto.SHA512, nil
+	}
+
+	return 0, UnsupportedAtHashAlgorithmError{Alg: alg}
+}
+
+// AtHashValue computes the OIDC at_hash of an access token for an ID token signed with the given algorithm:
+// the base64url encoding of the left-most half of the digest of the token's ASCII octets.  See OpenID Connect
+// Core 1.0, section 3.1.3.6.
+func AtHashValue(alg, accessToken string) (string, error) {
+	h, err := atHashDigest(alg)
+	if err != nil {
+		return "", err
+	}
+
+	hasher := h.New()
+	hasher.Write([]byte(accessToken))
+	sum := hasher.Sum(nil)
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2]), nil
+}
+
+// AtHash describes how to derive an OIDC at_hash claim, which binds an ID token to the access token issued
+// alongside it.  The access token is taken from the Header, or the Parameter if the header is absent.  The digest
+// is selected by the algorithm that signs the token, which is the factory's Alg unless the token request selects
+// another one.
+type AtHash struct {
+	// Claim is the name of the claim key for the access token hash.  If unset, DefaultAtHashClaim is used.
+	Claim string
+
+	// Header is the HTTP header containing the access token
+	Header string
+
+	// Parameter is the URL query parameter containing the access token
+	Parameter string
+
+	// Required indicates that token requests without an access token are rejected.  By default, such
+	// requests are issued tokens without an at_hash claim.
+	Required bool
+}
+
+type atHashRequestBuilder struct {
+	claim     string
+	header    string
+	parameter string
+	required  bool
+	alg       string
+}
+
+func (ahrb atHashRequestBuilder) Build(original *http.Request, tr *Request) error {
+	var accessToken string
+	if len(ahrb.header) > 0 {
+		accessToken = original.Header.Get(ahrb.header)
+	}
+
+	if len(accessToken) == 0 && len(ahrb.parameter) > 0 {
+		accessToken = original.Form.Get(ahrb.parameter)
+	}
+
+	if len(accessToken) == 0 {
+		if ahrb.required {
+			return xhttpserver.MissingValueError{Header: ahrb.header, Parameter: ahrb.parameter}
+		}
+
+		return nil
+	}
+
+	alg := ahrb.alg
+	if requested, ok := tr.Metadata[AlgorithmMetadata].(string); ok && len(requested) > 0 {
+		alg = requested
+	}
+
+	value, err := AtHashValue(alg, accessToken)
+	if err != nil {
+		return UnsupportedAlgorithmError{Alg: alg}
+	}
+
+	tr.Claims[ahrb.claim] = value
+	return nil
+}
+
+// newAtHashRequestBuilder validates an AtHash against the algorithm that signs tokens by default
+func newAtHashRequestBuilder(ah AtHash, alg string) (atHashRequestBuilder, error) {
+	if len(ah.Header) == 0 && len(ah.Parameter) == 0 {
+		return atHashRequestBuilder{}, ErrAtHashSourceRequired
+	}
+
+	if _, err := atHashDigest(alg); err != nil {
+		return atHashRequestBuilder{}, err
+	}
+
+	ahrb := atHashRequestBuilder{
+		claim:     ah.Claim,
+		header:    http.CanonicalHeaderKey(ah.Header),
+		parameter: ah.Parameter,
+		required:  ah.Required,
+		alg:       alg,
+	}
+
+	if len(ahrb.claim) == 0 {
+		ahrb.claim = DefaultAtHashClaim
+	}
+
+	return ahrb, nil
+}
@@ -0,0 +1,233 @@
+package token
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/xmidt-org/themis/key"
+	"github.com/xmidt-org/themis/xhttp/xhttpserver"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// oidcAccessToken and oidcAtHash are the RS256 example from OpenID Connect Core 1.0, appendix A.4
+const (
+	oidcAccessToken = "jHkWEdUXMU1BwAsC4vtUsZwnNvTIxEl0z9K3vx5KF0Y"
+	oidcAtHash      = "77QmUPtjPfzWtF2AnpK9RQ"
+)
+
+func testAtHashValue(t *testing.T) {
+	assert := assert.New(t)
+
+	sum256 := sha256.Sum256([]byte(oidcAccessToken))
+	sum384 := sha512.Sum384([]byte(oidcAccessToken))
+	sum512 := sha512.Sum512([]byte(oidcAccessToken))
+
+	testData := []struct {
+		alg      string
+		expected string
+	}{
+		{"RS256", oidcAtHash},
+		{"RS256", base64.RawURLEncoding.EncodeToString(sum256[:16])},
+		{"ES256", base64.RawURLEncoding.EncodeToString(sum256[:16])},
+		{"PS384", base64.RawURLEncoding.EncodeToString(sum384[:24])},
+		{"hs512", base64.RawURLEncoding.EncodeToString(sum512[:32])},
+		{"EdDSA", base64.RawURLEncoding.EncodeToString(sum512[:32])},
+	}
+
+	for _, record := range testData {
+		t.Run(record.alg, func(t *testing.T) {
+			actual, err := AtHashValue(record.alg, oidcAccessToken)
+			assert.NoError(err)
+			assert.Equal(record.expected, actual)
+		})
+	}
+
+	for _, alg := range []string{"none", "XYZ"} {
+		actual, err := AtHashValue(alg, oidcAccessToken)
+		assert.Empty(actual)
+		assert.IsType(UnsupportedAtHashAlgorithmError{}, err)
+		assert.NotEmpty(err.Error())
+	}
+}
+
+func testAtHashRequestBuilder(t *testing.T) {
+	testData := []struct {
+		atHash   AtHash
+		header   string
+		query    string
+		alg      string
+		expected interface{}
+		err      error
+	}{
+		{
+			atHash:   AtHash{Header: "X-Access-Token"},
+			header:   oidcAccessToken,
+			expected: oidcAtHash,
+		},
+		{
+			atHash:   AtHash{Claim: "ath", Parameter: "access_token"},
+			query:    oidcAccessToken,
+			expected: oidcAtHash,
+		},
+		{
+			atHash: AtHash{Header: "X-Access-Token"},
+		},
+		{
+			atHash: AtHash{Header: "X-Access-Token", Parameter: "access_token", Required: true},
+			err:    xhttpserver.MissingValueError{Header: "X-Access-Token", Parameter: "access_token"},
+		},
+		{
+			atHash: AtHash{Header: "X-Access-Token"},
+			header: oidcAccessToken,
+			alg:    "none",
+			err:    UnsupportedAlgorithmError{Alg: "none"},
+		},
+	}
+
+	for _, record := range testData {
+		t.Run(record.atHash.Header+record.atHash.Parameter, func(t *testing.T) {
+			var (
+				assert  = assert.New(t)
+				require = require.New(t)
+				tr      = NewRequest()
+			)
+
+			ahrb, err := newAtHashRequestBuilder(record.atHash, DefaultAlg)
+			require.NoError(err)
+
+			original := httptest.NewRequest("GET", "/?access_token="+record.query, nil)
+			require.NoError(original.ParseForm())
+			if len(record.header) > 0 {
+				original.Header.Set(record.atHash.Header, record.header)
+			}
+
+			if len(record.alg) > 0 {
+				tr.Metadata[AlgorithmMetadata] = record.alg
+			}
+
+			err = ahrb.Build(original, tr)
+			if record.err != nil {
+				assert.Equal(record.err, err)
+				return
+			}
+
+			require.NoError(err)
+			claim := record.atHash.Claim
+			if len(claim) == 0 {
+				claim = DefaultAtHashClaim
+			}
+
+			if record.expected == nil {
+				assert.NotContains(tr.Claims, claim)
+			} else {
+				assert.Equal(record.expected, tr.Claims[claim])
+			}
+		})
+	}
+}
+
+func testAtHashInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := newAtHashRequestBuilder(AtHash{}, "RS256")
+	assert.Equal(ErrAtHashSourceRequired, err)
+
+	_, err = newAtHashRequestBuilder(AtHash{Header: "X-Access-Token"}, "none")
+	assert.Equal(UnsupportedAtHashAlgorithmError{Alg: "NONE"}, err)
+
+	_, err = NewRequestBuilders(Options{AtHash: &AtHash{}})
+	assert.Equal(ErrAtHashSourceRequired, err)
+}
+
+func testAtHashToken(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		o = Options{
+			Alg:    "RS256",
+			Key:    key.Descriptor{Kid: "test", Bits: 1024},
+			AtHash: &AtHash{Header: "X-Access-Token"},
+		}
+	)
+
+	rb, err := NewRequestBuilders(o)
+	require.NoError(err)
+
+	factory, err := NewFactory(o, ClaimBuilders{requestClaimBuilder{}}, key.NewRegistry(nil))
+	require.NoError(err)
+
+	original := httptest.NewRequest("GET", "/", nil)
+	original.Header.Set("X-Access-Token", oidcAccessToken)
+	tr, err := BuildRequest(original, rb)
+	require.NoError(err)
+
+	signed, err := factory.NewToken(context.Background(), tr)
+	require.NoError(err)
+
+	claims := jwt.MapClaims{}
+	_, _, err = new(jwt.Parser).ParseUnverified(signed, claims)
+	require.NoError(err)
+	assert.Equal(oidcAtHash, claims[DefaultAtHashClaim])
+}
+
+func testAtHashPinnedKey(t *testing.T) {
+	for _, pinned := range []struct {
+		alg  string
+		bits int
+	}{
+		{"ES384", 384},
+		{"ES512", 512},
+	} {
+		t.Run(pinned.alg, func(t *testing.T) {
+			var (
+				assert  = assert.New(t)
+				require = require.New(t)
+
+				o = Options{
+					Key:    key.Descriptor{Kid: "pinned", Type: key.KeyTypeECDSA, Bits: pinned.bits, Alg: pinned.alg},
+					AtHash: &AtHash{Header: "X-Access-Token"},
+				}
+			)
+
+			expected, err := AtHashValue(pinned.alg, oidcAccessToken)
+			require.NoError(err)
+
+			rb, err := NewRequestBuilders(o)
+			require.NoError(err)
+
+			factory, err := NewFactory(o, ClaimBuilders{requestClaimBuilder{}}, key.NewRegistry(nil))
+			require.NoError(err)
+
+			original := httptest.NewRequest("GET", "/", nil)
+			original.Header.Set("X-Access-Token", oidcAccessToken)
+			tr, err := BuildRequest(original, rb)
+			require.NoError(err)
+
+			signed, err := factory.NewToken(context.Background(), tr)
+			require.NoError(err)
+
+			claims := jwt.MapClaims{}
+			token, _, err := new(jwt.Parser).ParseUnverified(signed, claims)
+			require.NoError(err)
+			assert.Equal(pinned.alg, token.Header["alg"])
+			assert.Equal(expected, claims[DefaultAtHashClaim])
+			assert.NotEqual(oidcAtHash, claims[DefaultAtHashClaim])
+		})
+	}
+}
+
+func TestAtHash(t *testing.T) {
+	t.Run("Value", testAtHashValue)
+	t.Run("RequestBuilder", testAtHashRequestBuilder)
+	t.Run("Invalid", testAtHashInvalid)
+	t.Run("Token", testAtHashToken)
+	t.Run("PinnedKey", testAtHashPinnedKey)
+}
@@ -0,0 +1,114 @@
+package token
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// AuditError is returned when the record of an issued token could not be persisted and the Audit
+// configuration does not allow issuance to proceed without it
+type AuditError struct {
+	Err error
+}
+
+func (ae AuditError) Error() string {
+	return fmt.Sprintf("Unable to record the issued token: %s", ae.Err)
+}
+
+func (ae AuditError) Unwrap() error {
+	return ae.Err
+}
+
+func (ae AuditError) StatusCode() int {
+	return http.StatusServiceUnavailable
+}
+
+// AuditRecord is the minimal record of an issued token that is needed to correlate it with later activity.
+// Fields for claims that the token does not have are left as zero values.
+type AuditRecord struct {
+	JTI       string
+	Subject   string
+	Kid       string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// AuditStore persists an AuditRecord for each issued token.  Implementations must be safe for concurrent use.
+type AuditStore interface {
+	Record(context.Context, AuditRecord) error
+}
+
+// NopAuditStore is an AuditStore that discards every record.  This is the default when auditing is
+// configured but no AuditStore is supplied.
+type NopAuditStore struct{}
+
+func (NopAuditStore) Record(context.Context, AuditRecord) error {
+	return nil
+}
+
+// MemoryAuditStore is an AuditStore that retains every record in memory.  It is primarily useful for testing.
+type MemoryAuditStore struct {
+	lock    sync.Mutex
+	records []AuditRecord
+}
+
+// NewMemoryAuditStore creates an empty in-memory AuditStore
+func NewMemoryAuditStore() *MemoryAuditStore {
+	return new(MemoryAuditStore)
+}
+
+func (m *MemoryAuditStore) Record(_ context.Context, r AuditRecord) error {
+	m.lock.Lock()
+	m.records = append(m.records, r)
+	m.lock.Unlock()
+	return nil
+}
+
+// Records returns a copy of every record, in the order they were recorded
+func (m *MemoryAuditStore) Records() []AuditRecord {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return append([]AuditRecord(nil), m.records...)
+}
+
+// Audit describes how a record of each issued token is persisted to an AuditStore
+type Audit struct {
+	// FailOpen allows a token to be issued even when its record could not be persisted.  The failure is
+	// logged instead.  By default, such a token is withheld and the request fails with a 503 status.
+	FailOpen bool
+}
+
+// auditTime converts a numeric date claim, as produced by this package or decoded from JSON, into a time.Time
+func auditTime(v interface{}) time.Time {
+	switch t := v.(type) {
+	case int64:
+		return time.Unix(t, 0).UTC()
+	case int:
+		return time.Unix(int64(t), 0).UTC()
+	case float64:
+		return time.Unix(int64(t), 0).UTC()
+	case json.Number:
+		if n, err := t.Int64(); err == nil {
+			return time.Unix(n, 0).UTC()
+		}
+	}
+
+	return time.Time{}
+}
+
+// newAuditRecord extracts the audited claims from the claims of a signed token
+func newAuditRecord(kid string, claims map[string]interface{}) AuditRecord {
+	r := AuditRecord{
+		Kid:       kid,
+		IssuedAt:  auditTime(claims["iat"]),
+		ExpiresAt: auditTime(claims["exp"]),
+	}
+
+	r.JTI, _ = claims["jti"].(string)
+	r.Subject, _ = claims["sub"].(string)
+	return r
+}
@@ -0,0 +1,118 @@
+package token
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/xmidt-org/themis/clock/clocktest"
+	"github.com/xmidt-org/themis/key"
+	"github.com/xmidt-org/themis/random"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type failingAuditStore struct {
+	err error
+}
+
+func (f failingAuditStore) Record(context.Context, AuditRecord) error {
+	return f.err
+}
+
+func newTestAuditFactory(t *testing.T, a Audit, store AuditStore) Factory {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	o := Options{
+		Key:        key.Descriptor{Kid: "audit", Bits: 512},
+		Nonce:      true,
+		Duration:   time.Hour,
+		Audit:      &a,
+		clock:      clocktest.NewFake(now),
+		auditStore: store,
+		Claims: map[string]Value{
+			"sub": Value{Value: "device"},
+		},
+	}
+
+	cb, err := NewClaimBuilders(random.NewBase64Noncer(rand.Reader, 16, base64.RawURLEncoding), nil, o)
+	require.NoError(t, err)
+
+	f, err := NewFactory(o, cb, key.NewRegistry(nil))
+	require.NoError(t, err)
+	return f
+}
+
+func testAuditRecorded(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		store   = NewMemoryAuditStore()
+		factory = newTestAuditFactory(t, Audit{}, store)
+	)
+
+	signed, err := factory.NewToken(context.Background(), NewRequest())
+	require.NoError(err)
+
+	_, claims, err := decodeUnverified(signed)
+	require.NoError(err)
+
+	records := store.Records()
+	require.Len(records, 1)
+	assert.Equal(
+		AuditRecord{
+			JTI:       claims["jti"].(string),
+			Subject:   "device",
+			Kid:       "audit",
+			IssuedAt:  time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+			ExpiresAt: time.Date(2026, 3, 1, 13, 0, 0, 0, time.UTC),
+		},
+		records[0],
+	)
+
+	assert.NotEmpty(records[0].JTI)
+}
+
+func testAuditFailClosed(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		expected = errors.New("expected")
+		factory  = newTestAuditFactory(t, Audit{}, failingAuditStore{err: expected})
+	)
+
+	signed, err := factory.NewToken(context.Background(), NewRequest())
+	assert.Empty(signed)
+	assert.True(errors.Is(err, expected))
+
+	var ae AuditError
+	require.True(t, errors.As(err, &ae))
+	assert.Equal(http.StatusServiceUnavailable, ae.StatusCode())
+}
+
+func testAuditFailOpen(t *testing.T) {
+	factory := newTestAuditFactory(t, Audit{FailOpen: true}, failingAuditStore{err: errors.New("expected")})
+
+	signed, err := factory.NewToken(context.Background(), NewRequest())
+	assert.NoError(t, err)
+	assert.NotEmpty(t, signed)
+}
+
+func testAuditNopDefault(t *testing.T) {
+	f := newTestAuditFactory(t, Audit{}, nil)
+
+	signed, err := f.NewToken(context.Background(), NewRequest())
+	assert.NoError(t, err)
+	assert.NotEmpty(t, signed)
+	assert.Equal(t, NopAuditStore{}, f.(*factory).audit)
+}
+
+func TestAudit(t *testing.T) {
+	t.Run("Recorded", testAuditRecorded)
+	t.Run("FailClosed", testAuditFailClosed)
+	t.Run("FailOpen", testAuditFailOpen)
+	t.Run("NopDefault", testAuditNopDefault)
+}
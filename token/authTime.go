@@ -0,0 +1,97 @@
+package token
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultAuthTimeClaim is the name of the OIDC authentication time claim when none is configured
+const DefaultAuthTimeClaim = "auth_time"
+
+// InvalidAuthTimeError is returned when the authentication time header cannot be parsed as a time
+type InvalidAuthTimeError struct {
+	Header string
+	Value  string
+}
+
+func (iate InvalidAuthTimeError) Error() string {
+	return fmt.Sprintf("Invalid authentication time in header %s: %s", iate.Header, iate.Value)
+}
+
+func (iate InvalidAuthTimeError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// AuthTime describes how to derive an OIDC auth_time claim, i.e. the time at which the client authenticated.
+// The claim is a NumericDate, the number of seconds since the Unix epoch.
+type AuthTime struct {
+	// Claim is the name of the claim key for the authentication time.  If unset, DefaultAuthTimeClaim is used.
+	Claim string
+
+	// Header is the HTTP header, set by a trusted upstream, from which the authentication time is taken.  The
+	// value may be either a NumericDate or an RFC 3339 time.  If unset, the current time is always used.
+	Header string
+
+	// FallbackToNow causes the current time to be used when the Header is missing or cannot be parsed.  By
+	// default, a token request with a missing header has no auth_time claim, and a token request with an
+	// unparseable header is rejected with a 400 status.
+	FallbackToNow bool
+}
+
+type authTimeRequestBuilder struct {
+	claim         string
+	header        string
+	fallbackToNow bool
+	now           func() time.Time
+}
+
+// parseAuthTime parses a header value as either a NumericDate or an RFC 3339 time
+func parseAuthTime(v string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+
+	return time.Parse(time.RFC3339, v)
+}
+
+func (atrb authTimeRequestBuilder) Build(original *http.Request, tr *Request) error {
+	if len(atrb.header) == 0 {
+		tr.Claims[atrb.claim] = atrb.now().Unix()
+		return nil
+	}
+
+	v := strings.TrimSpace(original.Header.Get(atrb.header))
+	if len(v) > 0 {
+		t, err := parseAuthTime(v)
+		if err == nil {
+			tr.Claims[atrb.claim] = t.Unix()
+			return nil
+		} else if !atrb.fallbackToNow {
+			return InvalidAuthTimeError{Header: atrb.header, Value: v}
+		}
+	}
+
+	if atrb.fallbackToNow {
+		tr.Claims[atrb.claim] = atrb.now().Unix()
+	}
+
+	return nil
+}
+
+func newAuthTimeRequestBuilder(at AuthTime, now func() time.Time) authTimeRequestBuilder {
+	atrb := authTimeRequestBuilder{
+		claim:         at.Claim,
+		header:        http.CanonicalHeaderKey(at.Header),
+		fallbackToNow: at.FallbackToNow,
+		now:           now,
+	}
+
+	if len(atrb.claim) == 0 {
+		atrb.claim = DefaultAuthTimeClaim
+	}
+
+	return atrb
+}
@@ -0,0 +1,112 @@
+package token
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthTime(t *testing.T) {
+	var (
+		now      = time.Date(2020, 10, 14, 12, 0, 0, 0, time.UTC)
+		provided = time.Date(2020, 10, 14, 11, 30, 0, 0, time.UTC)
+	)
+
+	testData := []struct {
+		authTime AuthTime
+		header   string
+		expected interface{}
+		err      error
+	}{
+		{
+			authTime: AuthTime{Header: "X-Auth-Time"},
+			header:   strconv.FormatInt(provided.Unix(), 10),
+			expected: provided.Unix(),
+		},
+		{
+			authTime: AuthTime{Header: "X-Auth-Time", FallbackToNow: true},
+			header:   provided.Format(time.RFC3339),
+			expected: provided.Unix(),
+		},
+		{
+			authTime: AuthTime{Header: "X-Auth-Time"},
+		},
+		{
+			authTime: AuthTime{Header: "X-Auth-Time", FallbackToNow: true},
+			expected: now.Unix(),
+		},
+		{
+			authTime: AuthTime{Header: "X-Auth-Time"},
+			header:   "yesterday",
+			err:      InvalidAuthTimeError{Header: "X-Auth-Time", Value: "yesterday"},
+		},
+		{
+			authTime: AuthTime{Header: "X-Auth-Time", FallbackToNow: true},
+			header:   "yesterday",
+			expected: now.Unix(),
+		},
+		{
+			authTime: AuthTime{Claim: "authenticated"},
+			expected: now.Unix(),
+		},
+	}
+
+	for i, record := range testData {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			var (
+				assert  = assert.New(t)
+				require = require.New(t)
+
+				builder = newAuthTimeRequestBuilder(record.authTime, func() time.Time { return now })
+				request = httptest.NewRequest("GET", "/", nil)
+				tr      = NewRequest()
+			)
+
+			if len(record.header) > 0 {
+				request.Header.Set("X-Auth-Time", record.header)
+			}
+
+			err := builder.Build(request, tr)
+			if record.err != nil {
+				assert.Equal(record.err, err)
+				assert.Equal(http.StatusBadRequest, err.(InvalidAuthTimeError).StatusCode())
+				assert.Empty(tr.Claims)
+				return
+			}
+
+			require.NoError(err)
+			claim := record.authTime.Claim
+			if len(claim) == 0 {
+				claim = DefaultAuthTimeClaim
+			}
+
+			if record.expected == nil {
+				assert.Empty(tr.Claims)
+			} else {
+				assert.Equal(map[string]interface{}{claim: record.expected}, tr.Claims)
+			}
+		})
+	}
+}
+
+func TestNewRequestBuildersAuthTime(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		request = httptest.NewRequest("GET", "/", nil)
+	)
+
+	rb, err := NewRequestBuilders(Options{AuthTime: &AuthTime{Header: "x-auth-time"}})
+	require.NoError(err)
+
+	request.Header.Set("X-Auth-Time", "1602676800")
+	tr, err := BuildRequest(request, rb)
+	require.NoError(err)
+	assert.Equal(int64(1602676800), tr.Claims[DefaultAuthTimeClaim])
+}
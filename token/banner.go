@@ -0,0 +1,135 @@
+package token
+
+import (
+	"encoding/json"
+	"net/url"
+
+	"github.com/xmidt-org/themis/key"
+)
+
+// redactValues returns a copy of the given values with the static value of each redacted name replaced by Redacted
+func (r Redactor) redactValues(values map[string]Value) map[string]Value {
+	if len(values) == 0 {
+		return values
+	}
+
+	redacted := make(map[string]Value, len(values))
+	for name, v := range values {
+		if r[name] && v.Value != nil {
+			v.Value = Redacted
+		}
+
+		redacted[name] = v
+	}
+
+	return redacted
+}
+
+// redactURL masks any password in a URL's userinfo
+func redactURL(v string) string {
+	u, err := url.Parse(v)
+	if err != nil || u.User == nil {
+		return v
+	}
+
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), Redacted)
+	}
+
+	return u.String()
+}
+
+// redactDescriptors returns copies of key descriptors with any Remote URL redacted
+func redactDescriptors(d map[string]key.Descriptor) map[string]key.Descriptor {
+	if d == nil {
+		return nil
+	}
+
+	redacted := make(map[string]key.Descriptor, len(d))
+	for name, kd := range d {
+		kd.Remote = redactURL(kd.Remote)
+		redacted[name] = kd
+	}
+
+	return redacted
+}
+
+// Redacted returns a copy of these Options that is safe to log.  Basic auth client secrets, the signed cookie
+// secret, any password in the remote claims, webhook, and remote key URLs, and the static
+// values of claims listed in RedactClaims are replaced with Redacted.
+// Key descriptors otherwise refer to key files by path and never hold key material, so they are left as is.
+// The original Options are never modified.
+func (o Options) Redacted() Options {
+	r := NewRedactor(o.RedactClaims)
+	o.Claims = r.redactValues(o.Claims)
+	o.Metadata = r.redactValues(o.Metadata)
+
+	if o.BasicAuth != nil {
+		ba := *o.BasicAuth
+		ba.Clients = make([]Client, len(o.BasicAuth.Clients))
+		for i, c := range o.BasicAuth.Clients {
+			if len(c.Secret) > 0 {
+				c.Secret = Redacted
+			}
+
+			ba.Clients[i] = c
+		}
+
+		o.BasicAuth = &ba
+	}
+
+	if o.SignedCookie != nil && len(o.SignedCookie.Secret) > 0 {
+		sc := *o.SignedCookie
+		sc.Secret = Redacted
+		o.SignedCookie = &sc
+	}
+
+	if o.Remote != nil {
+		remote := *o.Remote
+		remote.URL = redactURL(remote.URL)
+		o.Remote = &remote
+	}
+
+	if o.Webhook != nil {
+		webhook := *o.Webhook
+		webhook.URL = redactURL(webhook.URL)
+		o.Webhook = &webhook
+	}
+
+	o.Key.Remote = redactURL(o.Key.Remote)
+	if o.Fallback != nil {
+		fallback := *o.Fallback
+		fallback.Remote = redactURL(fallback.Remote)
+		o.Fallback = &fallback
+	}
+
+	if o.Tenant != nil {
+		tenant := *o.Tenant
+		tenant.Keys = redactDescriptors(tenant.Keys)
+		o.Tenant = &tenant
+	}
+
+	if o.Algorithms != nil {
+		algorithms := *o.Algorithms
+		algorithms.Keys = redactDescriptors(algorithms.Keys)
+		o.Algorithms = &algorithms
+	}
+
+	if o.Refresh != nil {
+		refresh := o.Refresh.Redacted()
+		o.Refresh = &refresh
+	}
+
+	return o
+}
+
+// LogValue produces the representation of these Options used in the startup banner.  This is the JSON
+// form of the Redacted Options.
+func (o Options) LogValue() string {
+	data, err := json.Marshal(o.Redacted())
+	if err != nil {
+		return err.Error()
+	}
+
+	return string(data)
+}
@@ -0,0 +1,167 @@
+package token
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DefaultBasicAuthClaim is the name of the claim holding the client id when none is configured
+const DefaultBasicAuthClaim = "client_id"
+
+var (
+	ErrClientIDRequired = errors.New("Each basic auth client must have an id")
+)
+
+// DuplicateClientError indicates that the same client id was configured more than once
+type DuplicateClientError struct {
+	ID string
+}
+
+func (dce DuplicateClientError) Error() string {
+	return fmt.Sprintf("Duplicate basic auth client %s", dce.ID)
+}
+
+// BasicAuthError indicates that a token request's basic auth credentials were missing, malformed, or rejected.
+// This error produces a 401 response with a WWW-Authenticate challenge.
+type BasicAuthError struct {
+	Reason string
+	Realm  string
+}
+
+func (bae BasicAuthError) Error() string {
+	return fmt.Sprintf("Invalid basic auth credentials: %s", bae.Reason)
+}
+
+func (bae BasicAuthError) StatusCode() int {
+	return http.StatusUnauthorized
+}
+
+func (bae BasicAuthError) Headers() http.Header {
+	return http.Header{
+		"Www-Authenticate": []string{fmt.Sprintf("Basic realm=%q", bae.Realm)},
+	}
+}
+
+// Client is a single client accepted via basic auth
+type Client struct {
+	// ID is the client id, which is the basic auth username
+	ID string
+
+	// Secret is the client secret, which is the basic auth password
+	Secret string
+}
+
+// BasicAuth describes how to derive a client id claim from the HTTP basic auth credentials of a token
+// request, as used by the OAuth 2.0 client credentials flow
+type BasicAuth struct {
+	// Claim is the name of the claim key for the client id.  If unset, DefaultBasicAuthClaim is used.
+	Claim string
+
+	// Metadata is the optional name of the metadata key for the client id
+	Metadata string
+
+	// Required indicates that token requests must send basic auth credentials.  By default, requests
+	// without an Authorization header, or with some other authorization scheme, have no client id.
+	// A Basic Authorization header that cannot be decoded is always rejected.
+	Required bool
+
+	// Realm is the realm sent in the WWW-Authenticate challenge of a 401 response.  If unset, the challenge
+	// has an empty realm.
+	Realm string
+
+	// Clients is the optional set of accepted clients.  If set, the client id must be one of these clients
+	// and the password must be that client's secret.  If unset, the password is not checked.
+	Clients []Client
+}
+
+type basicAuthRequestBuilder struct {
+	claim    string
+	metadata string
+	required bool
+	realm    string
+
+	// secrets maps each client id onto its secret.  If nil, secrets are not checked.
+	secrets map[string][]byte
+}
+
+func (barb basicAuthRequestBuilder) unauthorized(reason string) error {
+	return BasicAuthError{Reason: reason, Realm: barb.realm}
+}
+
+// clientID returns the validated client id from a request, or the empty string if the request did not use basic auth
+func (barb basicAuthRequestBuilder) clientID(original *http.Request) (string, error) {
+	scheme := original.Header.Get("Authorization")
+	if i := strings.IndexByte(scheme, ' '); i >= 0 {
+		scheme = scheme[:i]
+	}
+
+	if !strings.EqualFold(scheme, "Basic") {
+		if barb.required {
+			return "", barb.unauthorized("missing credentials")
+		}
+
+		return "", nil
+	}
+
+	clientID, secret, ok := original.BasicAuth()
+	if !ok || len(clientID) == 0 {
+		return "", barb.unauthorized("malformed credentials")
+	}
+
+	if barb.secrets != nil {
+		expected, ok := barb.secrets[clientID]
+		if !ok || subtle.ConstantTimeCompare(expected, []byte(secret)) != 1 {
+			return "", barb.unauthorized("unknown client or incorrect secret")
+		}
+	}
+
+	return clientID, nil
+}
+
+func (barb basicAuthRequestBuilder) Build(original *http.Request, tr *Request) error {
+	clientID, err := barb.clientID(original)
+	if err != nil || len(clientID) == 0 {
+		return err
+	}
+
+	tr.Claims[barb.claim] = clientID
+	if len(barb.metadata) > 0 {
+		tr.Metadata[barb.metadata] = clientID
+	}
+
+	return nil
+}
+
+// newBasicAuthRequestBuilder creates the RequestBuilder for the given client id configuration
+func newBasicAuthRequestBuilder(ba BasicAuth) (RequestBuilder, error) {
+	barb := basicAuthRequestBuilder{
+		claim:    ba.Claim,
+		metadata: ba.Metadata,
+		required: ba.Required,
+		realm:    ba.Realm,
+	}
+
+	if len(barb.claim) == 0 {
+		barb.claim = DefaultBasicAuthClaim
+	}
+
+	if len(ba.Clients) > 0 {
+		barb.secrets = make(map[string][]byte, len(ba.Clients))
+		for _, c := range ba.Clients {
+			if len(c.ID) == 0 {
+				return nil, ErrClientIDRequired
+			}
+
+			if _, ok := barb.secrets[c.ID]; ok {
+				return nil, DuplicateClientError{ID: c.ID}
+			}
+
+			barb.secrets[c.ID] = []byte(c.Secret)
+		}
+	}
+
+	return barb, nil
+}
@@ -0,0 +1,179 @@
+package token
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDuplicateClientError(t *testing.T) {
+	assert.Contains(t, DuplicateClientError{ID: "test"}.Error(), "test")
+}
+
+func TestBasicAuthError(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		err = BasicAuthError{Reason: "expected", Realm: "themis"}
+	)
+
+	assert.Contains(err.Error(), "expected")
+	assert.Equal(http.StatusUnauthorized, err.StatusCode())
+	assert.Equal(`Basic realm="themis"`, err.Headers().Get("WWW-Authenticate"))
+}
+
+func basicAuthRequest(header string) *http.Request {
+	request := httptest.NewRequest("GET", "/", nil)
+	if len(header) > 0 {
+		request.Header.Set("Authorization", header)
+	}
+
+	return request
+}
+
+func testBasicAuthMapped(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		rb, err = NewRequestBuilders(Options{
+			BasicAuth: &BasicAuth{},
+		})
+	)
+
+	require.NoError(err)
+
+	original := basicAuthRequest("")
+	original.SetBasicAuth("my-client", "anything")
+	tr, err := BuildRequest(original, rb)
+	require.NoError(err)
+	assert.Equal("my-client", tr.Claims[DefaultBasicAuthClaim])
+	assert.Empty(tr.Metadata)
+
+	// requests without basic auth are issued tokens without a client id
+	for _, header := range []string{"", "Bearer eyJhbGciOiJub25lIn0"} {
+		tr, err = BuildRequest(basicAuthRequest(header), rb)
+		require.NoError(err)
+		assert.NotContains(tr.Claims, DefaultBasicAuthClaim)
+	}
+}
+
+func testBasicAuthCustomClaim(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		rb, err = NewRequestBuilders(Options{
+			BasicAuth: &BasicAuth{Claim: "azp", Metadata: "client"},
+		})
+	)
+
+	require.NoError(err)
+
+	original := basicAuthRequest("")
+	original.SetBasicAuth("my-client", "")
+	tr, err := BuildRequest(original, rb)
+	require.NoError(err)
+	assert.Equal("my-client", tr.Claims["azp"])
+	assert.Equal("my-client", tr.Metadata["client"])
+	assert.NotContains(tr.Claims, DefaultBasicAuthClaim)
+}
+
+func testBasicAuthUnauthorized(t *testing.T, ba BasicAuth, header string) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		rb, err = NewRequestBuilders(Options{BasicAuth: &ba})
+	)
+
+	require.NoError(err)
+	tr, err := BuildRequest(basicAuthRequest(header), rb)
+	assert.Nil(tr)
+	require.Error(err)
+
+	response := httptest.NewRecorder()
+	kithttp.DefaultErrorEncoder(context.Background(), err, response)
+	assert.Equal(http.StatusUnauthorized, response.Code)
+	assert.Equal(`Basic realm="themis"`, response.Header().Get("WWW-Authenticate"))
+}
+
+func testBasicAuthClients(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		ba = BasicAuth{
+			Realm: "themis",
+			Clients: []Client{
+				{ID: "first", Secret: "first-secret"},
+				{ID: "Second", Secret: "second-secret"},
+			},
+		}
+
+		rb, err = NewRequestBuilders(Options{BasicAuth: &ba})
+	)
+
+	require.NoError(err)
+
+	original := basicAuthRequest("")
+	original.SetBasicAuth("Second", "second-secret")
+	tr, err := BuildRequest(original, rb)
+	require.NoError(err)
+	assert.Equal("Second", tr.Claims[DefaultBasicAuthClaim])
+
+	t.Run("WrongSecret", func(t *testing.T) {
+		original := basicAuthRequest("")
+		original.SetBasicAuth("first", "second-secret")
+		testBasicAuthUnauthorized(t, ba, original.Header.Get("Authorization"))
+	})
+
+	t.Run("UnknownClient", func(t *testing.T) {
+		original := basicAuthRequest("")
+		original.SetBasicAuth("second", "second-secret")
+		testBasicAuthUnauthorized(t, ba, original.Header.Get("Authorization"))
+	})
+}
+
+func testBasicAuthInvalidClients(t *testing.T) {
+	var (
+		assert = assert.New(t)
+	)
+
+	_, err := NewRequestBuilders(Options{
+		BasicAuth: &BasicAuth{Clients: []Client{{Secret: "secret"}}},
+	})
+
+	assert.Equal(ErrClientIDRequired, err)
+
+	_, err = NewRequestBuilders(Options{
+		BasicAuth: &BasicAuth{Clients: []Client{{ID: "test"}, {ID: "test"}}},
+	})
+
+	assert.Equal(DuplicateClientError{ID: "test"}, err)
+}
+
+func TestBasicAuth(t *testing.T) {
+	t.Run("Mapped", testBasicAuthMapped)
+	t.Run("CustomClaim", testBasicAuthCustomClaim)
+	t.Run("Clients", testBasicAuthClients)
+	t.Run("InvalidClients", testBasicAuthInvalidClients)
+
+	t.Run("Malformed", func(t *testing.T) {
+		for _, header := range []string{"Basic", "Basic !!!not base64!!!", "basic bm9jb2xvbg==", "Basic OnNlY3JldA=="} {
+			t.Run(header, func(t *testing.T) {
+				testBasicAuthUnauthorized(t, BasicAuth{Realm: "themis"}, header)
+			})
+		}
+	})
+
+	t.Run("Required", func(t *testing.T) {
+		testBasicAuthUnauthorized(t, BasicAuth{Realm: "themis", Required: true}, "")
+		testBasicAuthUnauthorized(t, BasicAuth{Realm: "themis", Required: true}, "Bearer eyJhbGciOiJub25lIn0")
+	})
+}
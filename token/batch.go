@@ -0,0 +1,271 @@
+package token
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+const (
+	ContentTypeJSON   = "application/json"
+	ContentTypeNDJSON = "application/x-ndjson"
+)
+
+var (
+	ErrInvalidBatch = errors.New("A batch request must be a JSON array of claim objects")
+)
+
+// BatchError is returned when a batch request body cannot be decoded
+type BatchError struct {
+	Err error
+}
+
+func (be BatchError) Error() string {
+	return be.Err.Error()
+}
+
+func (be BatchError) Unwrap() error {
+	return be.Err
+}
+
+func (be BatchError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// Batch describes the configuration for batch token issuance
+type Batch struct {
+	// AbortOnError controls what happens when a single entry in a batch cannot be issued.  By default,
+	// an error result is emitted for that entry and processing continues with the next entry.  If this
+	// field is true, processing stops at the first error.
+	AbortOnError bool
+
+	// errorEncoder writes errors that fail the whole batch.  If unset, kithttp.DefaultErrorEncoder is used.
+	errorEncoder kithttp.ErrorEncoder
+
+	// maxBodySize is the largest batch request body, in bytes, which is the issue handler's MaxBodySize.
+	// If unset or not positive, DefaultMaxBodySize is used.
+	maxBodySize int64
+}
+
+// BatchResult is the outcome of issuing a token for a single entry in a batch.  Exactly one of
+// Token or Error will be set.
+type BatchResult struct {
+	// Index is the zero-based position of the entry within the batch request
+	Index int `json:"index"`
+
+	// Token is the signed token, if issuance was successful
+	Token string `json:"token,omitempty"`
+
+	// Error is the error text, if issuance failed
+	Error string `json:"error,omitempty"`
+
+	err error
+}
+
+// BatchHandler is an http.Handler that issues a token for each entry in a JSON array of claims
+type BatchHandler http.Handler
+
+type batchHandler struct {
+	factory      Factory
+	builders     RequestBuilders
+	abortOnError bool
+	errorEncoder kithttp.ErrorEncoder
+	maxBodySize  int64
+}
+
+// acceptsNDJSON tests whether the client asked for a newline-delimited JSON stream of results
+func acceptsNDJSON(request *http.Request) bool {
+	for _, v := range request.Header["Accept"] {
+		for _, mediaType := range strings.Split(v, ",") {
+			if i := strings.IndexRune(mediaType, ';'); i >= 0 {
+				mediaType = mediaType[:i]
+			}
+
+			if strings.EqualFold(strings.TrimSpace(mediaType), ContentTypeNDJSON) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// decode reads the claims for each entry in a batch.  The entire body is decoded before any tokens are issued,
+// since HTTP/1.x servers do not permit reading the request body once a streamed response has been started.
+// Numbers are decoded as json.Number so that integers beyond the precision of a float64 are issued exactly.
+func decodeBatch(request *http.Request) ([]map[string]interface{}, error) {
+	decoder := json.NewDecoder(request.Body)
+	decoder.UseNumber()
+	if t, err := decoder.Token(); err != nil {
+		return nil, BatchError{Err: err}
+	} else if d, ok := t.(json.Delim); !ok || d != '[' {
+		return nil, BatchError{Err: ErrInvalidBatch}
+	}
+
+	var entries []map[string]interface{}
+	for decoder.More() {
+		var claims map[string]interface{}
+		if err := decoder.Decode(&claims); err != nil {
+			return nil, BatchError{Err: err}
+		}
+
+		entries = append(entries, claims)
+	}
+
+	return entries, nil
+}
+
+// issue creates a token for each entry in turn, passing each result to the supplied closure as soon
+// as it is available.  The returned error will be non-nil only if the body itself is malformed.
+func (bh *batchHandler) issue(request *http.Request, each func(BatchResult) bool) error {
+	// the body is buffered so that it can be replayed to the RequestBuilders, e.g. for body paths, after
+	// the entries are decoded.  Every entry shares one decoding of the replayed body.
+	data, err := ioutil.ReadAll(request.Body)
+	request.Body.Close()
+	if err != nil {
+		return BatchError{Err: err}
+	}
+
+	request.Body = ioutil.NopCloser(bytes.NewReader(data))
+	entries, err := decodeBatch(request)
+	if err != nil {
+		return err
+	}
+
+	request.Body = ioutil.NopCloser(bytes.NewReader(data))
+	request = withDecodedBody(request)
+
+	for index, claims := range entries {
+		result := BatchResult{Index: index}
+		tr, err := BuildRequest(request, bh.builders)
+		if err == nil {
+			// an entry cannot replace claims derived from the HTTP request, e.g. a partner id or client id
+			for k, v := range claims {
+				if _, exists := tr.Claims[k]; !exists {
+					tr.Claims[k] = v
+				}
+			}
+
+			result.Token, err = bh.factory.NewToken(request.Context(), tr)
+		}
+
+		if err != nil {
+			result.Error = err.Error()
+			result.err = err
+		}
+
+		if !each(result) || (err != nil && bh.abortOnError) {
+			break
+		}
+	}
+
+	return nil
+}
+
+func (bh *batchHandler) serveArray(response http.ResponseWriter, request *http.Request) {
+	var (
+		results  = make([]BatchResult, 0)
+		firstErr error
+	)
+
+	err := bh.issue(request, func(r BatchResult) bool {
+		if len(r.Error) > 0 && bh.abortOnError {
+			firstErr = r.err
+			return false
+		}
+
+		results = append(results, r)
+		return true
+	})
+
+	if err == nil {
+		err = firstErr
+	}
+
+	if err != nil {
+		bh.errorEncoder(request.Context(), err, response)
+		return
+	}
+
+	response.Header().Set("Content-Type", ContentTypeJSON)
+	json.NewEncoder(response).Encode(results)
+}
+
+func (bh *batchHandler) serveNDJSON(response http.ResponseWriter, request *http.Request) {
+	var (
+		encoder    = json.NewEncoder(response)
+		flusher, _ = response.(http.Flusher)
+	)
+
+	err := bh.issue(request, func(r BatchResult) bool {
+		response.Header().Set("Content-Type", ContentTypeNDJSON)
+		if encoder.Encode(r) != nil {
+			// the client has gone away, so there's no point in continuing
+			return false
+		}
+
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		return true
+	})
+
+	if err != nil {
+		bh.errorEncoder(request.Context(), err, response)
+	}
+}
+
+func (bh *batchHandler) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	if request.ContentLength > bh.maxBodySize {
+		response.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	request.Body = http.MaxBytesReader(response, request.Body, bh.maxBodySize)
+	if err := request.ParseForm(); err != nil {
+		bh.errorEncoder(request.Context(), err, response)
+		return
+	}
+
+	if acceptsNDJSON(request) {
+		bh.serveNDJSON(response, request)
+	} else {
+		bh.serveArray(response, request)
+	}
+}
+
+// NewBatchHandler creates an http.Handler that issues tokens for a batch of claim sets.  The request body
+// must be a JSON array of objects, each of which is a set of claims for one token.  Each set of claims is
+// merged into a token Request built from the HTTP request via the given RequestBuilders, although an entry
+// cannot replace any claim that the RequestBuilders produced.  A body path of the RequestBuilders selects from
+// the whole request body, i.e. the JSON array, and resolves to the same value for every entry.
+//
+// By default, the response is a JSON array of BatchResult objects.  If the client sends an Accept header
+// of application/x-ndjson, each BatchResult is instead written as a separate line as soon as the token is
+// signed, which allows clients to process very large batches incrementally without the server holding
+// every token in memory.  As with the issue handler, a body larger than DefaultMaxBodySize is rejected.
+func NewBatchHandler(f Factory, rb RequestBuilders, b Batch) BatchHandler {
+	bh := &batchHandler{
+		factory:      f,
+		builders:     rb,
+		abortOnError: b.AbortOnError,
+		errorEncoder: b.errorEncoder,
+		maxBodySize:  b.maxBodySize,
+	}
+
+	if bh.errorEncoder == nil {
+		bh.errorEncoder = kithttp.DefaultErrorEncoder
+	}
+
+	if bh.maxBodySize <= 0 {
+		bh.maxBodySize = DefaultMaxBodySize
+	}
+
+	return bh
+}
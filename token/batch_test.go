@@ -0,0 +1,337 @@
+package token
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/xmidt-org/themis/key"
+
+	jwt "github.com/dgrijalva/jwt-go"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestBatchHandler(t *testing.T, b Batch) BatchHandler {
+	factory, err := NewFactory(
+		Options{
+			Key: key.Descriptor{Kid: "test", Bits: 512},
+		},
+		ClaimBuilders{
+			audienceClaimBuilder{"allowed": true},
+			requestClaimBuilder{},
+		},
+		key.NewRegistry(nil),
+	)
+
+	require.NoError(t, err)
+	return NewBatchHandler(
+		factory,
+		RequestBuilders{
+			RequestBuilderFunc(func(original *http.Request, r *Request) error {
+				r.Claims["fromHeader"] = original.Header.Get("X-Claim")
+				return nil
+			}),
+		},
+		b,
+	)
+}
+
+func testBatchHandlerArray(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		handler  = newTestBatchHandler(t, Batch{})
+		response = httptest.NewRecorder()
+		request  = httptest.NewRequest("POST", "/", strings.NewReader(`[{"sub": "first"}, {"aud": "disallowed"}, {"sub": "third"}]`))
+	)
+
+	request.Header.Set("X-Claim", "value")
+	handler.ServeHTTP(response, request)
+	assert.Equal(http.StatusOK, response.Code)
+	assert.Equal(ContentTypeJSON, response.Header().Get("Content-Type"))
+
+	var results []BatchResult
+	require.NoError(json.Unmarshal(response.Body.Bytes(), &results))
+	require.Len(results, 3)
+
+	assert.Equal(0, results[0].Index)
+	assert.NotEmpty(results[0].Token)
+	assert.Empty(results[0].Error)
+
+	assert.Equal(1, results[1].Index)
+	assert.Empty(results[1].Token)
+	assert.NotEmpty(results[1].Error)
+
+	assert.Equal(2, results[2].Index)
+	assert.NotEmpty(results[2].Token)
+	assert.Empty(results[2].Error)
+}
+
+func testBatchHandlerArrayAbortOnError(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		handler  = newTestBatchHandler(t, Batch{AbortOnError: true})
+		response = httptest.NewRecorder()
+		request  = httptest.NewRequest("POST", "/", strings.NewReader(`[{"sub": "first"}, {"aud": "disallowed"}, {"sub": "third"}]`))
+	)
+
+	handler.ServeHTTP(response, request)
+	assert.Equal(http.StatusBadRequest, response.Code)
+}
+
+func testBatchHandlerNDJSON(t *testing.T, b Batch, expectedTokens, expectedErrors int) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		server = httptest.NewServer(newTestBatchHandler(t, b))
+	)
+
+	defer server.Close()
+	request, err := http.NewRequest(
+		"POST",
+		server.URL,
+		strings.NewReader(`[{"sub": "1"}, {"sub": "2"}, {"aud": "disallowed"}, {"sub": "4"}, {"sub": "5"}]`),
+	)
+
+	require.NoError(err)
+	request.Header.Set("Accept", ContentTypeNDJSON)
+
+	response, err := http.DefaultClient.Do(request)
+	require.NoError(err)
+	defer response.Body.Close()
+
+	assert.Equal(http.StatusOK, response.StatusCode)
+	assert.Equal(ContentTypeNDJSON, response.Header.Get("Content-Type"))
+
+	var (
+		tokens  int
+		errs    int
+		scanner = bufio.NewScanner(response.Body)
+	)
+
+	for scanner.Scan() {
+		var result BatchResult
+		require.NoError(json.Unmarshal(scanner.Bytes(), &result))
+		if len(result.Token) > 0 {
+			tokens++
+		} else {
+			assert.NotEmpty(result.Error)
+			errs++
+		}
+	}
+
+	require.NoError(scanner.Err())
+	assert.Equal(expectedTokens, tokens)
+	assert.Equal(expectedErrors, errs)
+}
+
+func testBatchHandlerLargeIntegers(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		handler  = newTestBatchHandler(t, Batch{})
+		response = httptest.NewRecorder()
+		request  = httptest.NewRequest("POST", "/", strings.NewReader(`[{"deviceId": 9007199254740993, "serial": 18446744073709551615}]`))
+	)
+
+	handler.ServeHTTP(response, request)
+	require.Equal(http.StatusOK, response.Code)
+
+	var results []BatchResult
+	require.NoError(json.Unmarshal(response.Body.Bytes(), &results))
+	require.Len(results, 1)
+	require.Empty(results[0].Error)
+
+	claims := jwt.MapClaims{}
+	_, _, err := (&jwt.Parser{UseJSONNumber: true}).ParseUnverified(results[0].Token, claims)
+	require.NoError(err)
+	assert.Equal(json.Number("9007199254740993"), claims["deviceId"])
+	assert.Equal(json.Number("18446744073709551615"), claims["serial"])
+}
+
+func testBatchHandlerRequestClaims(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		handler  = newTestBatchHandler(t, Batch{})
+		response = httptest.NewRecorder()
+		request  = httptest.NewRequest("POST", "/", strings.NewReader(`[{"sub": "first", "fromHeader": "forged"}]`))
+	)
+
+	request.Header.Set("X-Claim", "value")
+	handler.ServeHTTP(response, request)
+	require.Equal(http.StatusOK, response.Code)
+
+	var results []BatchResult
+	require.NoError(json.Unmarshal(response.Body.Bytes(), &results))
+	require.Len(results, 1)
+
+	claims := make(jwt.MapClaims)
+	_, _, err := new(jwt.Parser).ParseUnverified(results[0].Token, claims)
+	require.NoError(err)
+	assert.Equal("first", claims["sub"])
+	assert.Equal("value", claims["fromHeader"], "an entry must not replace a request-derived claim")
+}
+
+func testBatchHandlerBodyPath(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	factory, err := NewFactory(
+		Options{
+			Key: key.Descriptor{Kid: "test", Bits: 512},
+		},
+		requestClaimBuilder{},
+		key.NewRegistry(nil),
+	)
+
+	require.NoError(err)
+	rb, err := NewRequestBuilders(Options{
+		Claims: map[string]Value{
+			"device":   {Body: "$[0].device", Required: true},
+			"optional": {Body: "$[1].sub"},
+		},
+	})
+
+	require.NoError(err)
+
+	var (
+		handler  = NewBatchHandler(factory, rb, Batch{AbortOnError: true})
+		response = httptest.NewRecorder()
+		request  = httptest.NewRequest("POST", "/", strings.NewReader(`[{"sub": "first", "device": "mac:112233445566"}, {"sub": "second"}]`))
+	)
+
+	handler.ServeHTTP(response, request)
+	require.Equal(http.StatusOK, response.Code)
+
+	var results []BatchResult
+	require.NoError(json.Unmarshal(response.Body.Bytes(), &results))
+	require.Len(results, 2)
+
+	for i, expected := range []string{"first", "second"} {
+		require.Empty(results[i].Error)
+		claims := make(jwt.MapClaims)
+		_, _, err := new(jwt.Parser).ParseUnverified(results[i].Token, claims)
+		require.NoError(err)
+		assert.Equal(expected, claims["sub"])
+		assert.Equal("mac:112233445566", claims["device"])
+		assert.Equal("second", claims["optional"])
+	}
+}
+
+func testBatchHandlerErrorEncoder(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		handler  = newTestBatchHandler(t, Batch{AbortOnError: true, errorEncoder: NewProblemErrorEncoder()})
+		response = httptest.NewRecorder()
+		request  = httptest.NewRequest("POST", "/", strings.NewReader(`[{"aud": "disallowed"}]`))
+	)
+
+	handler.ServeHTTP(response, request)
+	assert.Equal(http.StatusBadRequest, response.Code)
+	assert.Equal(ContentTypeProblemJSON, response.Header().Get("Content-Type"))
+}
+
+func testBatchHandlerMaxBodySize(t *testing.T) {
+	var (
+		entry = `{"sub": "entry"}`
+		body  = "[" + strings.Repeat(entry+",", 99) + entry + "]"
+	)
+
+	t.Run("ContentLength", func(t *testing.T) {
+		var (
+			assert = assert.New(t)
+
+			handler  = newTestBatchHandler(t, Batch{maxBodySize: int64(len(body) - 1)})
+			response = httptest.NewRecorder()
+			request  = httptest.NewRequest("POST", "/", strings.NewReader(body))
+		)
+
+		handler.ServeHTTP(response, request)
+		assert.Equal(http.StatusRequestEntityTooLarge, response.Code)
+		assert.Empty(response.Body.String())
+	})
+
+	t.Run("Chunked", func(t *testing.T) {
+		var (
+			assert = assert.New(t)
+
+			handler  = newTestBatchHandler(t, Batch{maxBodySize: int64(len(body) - 1)})
+			response = httptest.NewRecorder()
+			request  = httptest.NewRequest("POST", "/", strings.NewReader(body))
+		)
+
+		request.ContentLength = -1
+		handler.ServeHTTP(response, request)
+		assert.Equal(http.StatusBadRequest, response.Code)
+		assert.NotContains(response.Body.String(), "token")
+	})
+
+	t.Run("WithinLimit", func(t *testing.T) {
+		var (
+			assert  = assert.New(t)
+			require = require.New(t)
+
+			handler  = newTestBatchHandler(t, Batch{maxBodySize: int64(len(body))})
+			response = httptest.NewRecorder()
+			request  = httptest.NewRequest("POST", "/", strings.NewReader(body))
+		)
+
+		handler.ServeHTTP(response, request)
+		require.Equal(http.StatusOK, response.Code)
+
+		var results []BatchResult
+		require.NoError(json.Unmarshal(response.Body.Bytes(), &results))
+		assert.Len(results, 100)
+	})
+}
+
+func testBatchHandlerInvalidBody(t *testing.T, accept, body string) {
+	var (
+		assert = assert.New(t)
+
+		handler  = newTestBatchHandler(t, Batch{})
+		response = httptest.NewRecorder()
+		request  = httptest.NewRequest("POST", "/", strings.NewReader(body))
+	)
+
+	request.Header.Set("Accept", accept)
+	handler.ServeHTTP(response, request)
+	assert.Equal(http.StatusBadRequest, response.Code)
+}
+
+func TestBatchHandler(t *testing.T) {
+	t.Run("Array", testBatchHandlerArray)
+	t.Run("ArrayAbortOnError", testBatchHandlerArrayAbortOnError)
+
+	t.Run("NDJSON", func(t *testing.T) {
+		testBatchHandlerNDJSON(t, Batch{}, 4, 1)
+	})
+
+	t.Run("NDJSONAbortOnError", func(t *testing.T) {
+		testBatchHandlerNDJSON(t, Batch{AbortOnError: true}, 2, 1)
+	})
+
+	t.Run("LargeIntegers", testBatchHandlerLargeIntegers)
+	t.Run("RequestClaims", testBatchHandlerRequestClaims)
+	t.Run("BodyPath", testBatchHandlerBodyPath)
+	t.Run("ErrorEncoder", testBatchHandlerErrorEncoder)
+	t.Run("MaxBodySize", testBatchHandlerMaxBodySize)
+	t.Run("InvalidBody", func(t *testing.T) {
+		testBatchHandlerInvalidBody(t, ContentTypeJSON, `{"sub": "not an array"}`)
+		testBatchHandlerInvalidBody(t, ContentTypeNDJSON, `this is not JSON`)
+	})
+}
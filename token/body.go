@@ -0,0 +1,266 @@
+package token
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrBodyNotAllowed = errors.New("A body path cannot be combined with a header, parameter, cookie, variable, server name, client IP, or scheme")
+)
+
+// InvalidJSONPathError indicates that a configured body path could not be parsed
+type InvalidJSONPathError struct {
+	Path string
+}
+
+func (ijpe InvalidJSONPathError) Error() string {
+	return fmt.Sprintf("Invalid body path: %s", ijpe.Path)
+}
+
+// MissingBodyValueError is returned when a required value is not present at its path within the request body
+type MissingBodyValueError struct {
+	Path string
+}
+
+func (mbve MissingBodyValueError) Error() string {
+	return fmt.Sprintf("Missing value from body path '%s'", mbve.Path)
+}
+
+func (mbve MissingBodyValueError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// jsonPath is a parsed body path.  Each step is either a string, which selects a field of an object, or
+// an int, which selects an element of an array.
+type jsonPath []interface{}
+
+// parseJSONPath parses a JSONPath-like expression consisting of dotted field names and array indexes, e.g.
+// $.device.ids[0] or device['serial number'].  The leading $ is optional.
+func parseJSONPath(expr string) (jsonPath, error) {
+	var (
+		path   jsonPath
+		s      = strings.TrimSpace(expr)
+		rooted = strings.HasPrefix(s, "$")
+	)
+
+	s = strings.TrimPrefix(s, "$")
+
+	for i := 0; i < len(s); {
+		switch {
+		case s[i] == '[':
+			end := strings.IndexByte(s[i:], ']')
+			if end < 0 {
+				return nil, InvalidJSONPathError{Path: expr}
+			}
+
+			inner := s[i+1 : i+end]
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				path = append(path, inner[1:len(inner)-1])
+			} else if index, err := strconv.Atoi(inner); err == nil && index >= 0 {
+				path = append(path, index)
+			} else {
+				return nil, InvalidJSONPathError{Path: expr}
+			}
+
+			i += end + 1
+
+		case s[i] == '.' || (i == 0 && !rooted):
+			if s[i] == '.' {
+				i++
+			}
+
+			end := strings.IndexAny(s[i:], ".[")
+			if end < 0 {
+				end = len(s) - i
+			}
+
+			if end == 0 {
+				return nil, InvalidJSONPathError{Path: expr}
+			}
+
+			path = append(path, s[i:i+end])
+			i += end
+
+		default:
+			return nil, InvalidJSONPathError{Path: expr}
+		}
+	}
+
+	if len(path) == 0 {
+		return nil, InvalidJSONPathError{Path: expr}
+	}
+
+	return path, nil
+}
+
+// evaluate walks this path through a decoded JSON document.  A path that does not resolve returns false.
+func (jp jsonPath) evaluate(v interface{}) (interface{}, bool) {
+	for _, step := range jp {
+		switch s := step.(type) {
+		case string:
+			object, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+
+			if v, ok = object[s]; !ok {
+				return nil, false
+			}
+
+		case int:
+			array, ok := v.([]interface{})
+			if !ok || s >= len(array) {
+				return nil, false
+			}
+
+			v = array[s]
+		}
+	}
+
+	return v, v != nil
+}
+
+// decodedBody holds the result of decoding a request body, so that every body path of a request shares it
+type decodedBody struct {
+	once sync.Once
+	body interface{}
+	err  error
+}
+
+type decodedBodyKey struct{}
+
+// withDecodedBody returns a shallow copy of a request whose body, when first needed, is decoded only once for
+// every RequestBuilder that uses the copy.  A request that already shares a decoded body is returned as is.
+func withDecodedBody(original *http.Request) *http.Request {
+	if _, ok := original.Context().Value(decodedBodyKey{}).(*decodedBody); ok {
+		return original
+	}
+
+	return original.WithContext(context.WithValue(original.Context(), decodedBodyKey{}, new(decodedBody)))
+}
+
+// requestBody returns the decoded JSON body of a request.  When the request shares a decoded body via
+// withDecodedBody, the body is decoded only on the first call.
+func requestBody(original *http.Request) (interface{}, error) {
+	db, ok := original.Context().Value(decodedBodyKey{}).(*decodedBody)
+	if !ok {
+		return decodeRequestBody(original)
+	}
+
+	db.once.Do(func() {
+		db.body, db.err = decodeRequestBody(original)
+	})
+
+	return db.body, db.err
+}
+
+// decodeRequestBody decodes the JSON body of a request, leaving the body in place so that it may be read again.
+// Numbers are decoded as json.Number.  An absent or empty body decodes as nil.
+func decodeRequestBody(original *http.Request) (interface{}, error) {
+	if original.Body == nil {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadAll(original.Body)
+	original.Body.Close()
+	original.Body = ioutil.NopCloser(bytes.NewReader(data))
+	if err != nil {
+		return nil, InvalidBodyError{Err: err}
+	}
+
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil
+	}
+
+	var (
+		body    interface{}
+		decoder = json.NewDecoder(bytes.NewReader(data))
+	)
+
+	decoder.UseNumber()
+	if err := decoder.Decode(&body); err != nil {
+		return nil, InvalidBodyError{Err: err}
+	}
+
+	return body, nil
+}
+
+type bodyRequestBuilder struct {
+	key          string
+	expr         string
+	path         jsonPath
+	required     bool
+	defaultValue interface{}
+	normalize    func(string) (string, error)
+	setter       func(string, interface{}, *Request)
+}
+
+func (brb bodyRequestBuilder) Build(original *http.Request, tr *Request) error {
+	body, err := requestBody(original)
+	if err != nil {
+		return err
+	}
+
+	if value, ok := brb.path.evaluate(body); ok {
+		s, isString := value.(string)
+		if !isString {
+			brb.setter(brb.key, value, tr)
+			return nil
+		}
+
+		s, ok, err := normalize(brb.normalize, brb.required, s)
+		if err != nil {
+			return err
+		} else if ok {
+			brb.setter(brb.key, s, tr)
+			return nil
+		}
+	}
+
+	if brb.defaultValue != nil {
+		brb.setter(brb.key, brb.defaultValue, tr)
+		return nil
+	}
+
+	if brb.required {
+		return MissingBodyValueError{Path: brb.expr}
+	}
+
+	return nil
+}
+
+// newBodyRequestBuilder creates the RequestBuilder for a Value taken from a JSON request body
+func newBodyRequestBuilder(name string, value Value, setter func(string, interface{}, *Request)) (RequestBuilder, error) {
+	if len(value.Header) > 0 || len(value.Parameter) > 0 || len(value.Cookie) > 0 || len(value.Variable) > 0 || value.ServerName || value.ClientIP || value.Scheme {
+		return nil, ErrBodyNotAllowed
+	}
+
+	path, err := parseJSONPath(value.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := value.normalizer()
+	if err != nil {
+		return nil, err
+	}
+
+	return bodyRequestBuilder{
+		key:          name,
+		expr:         value.Body,
+		path:         path,
+		required:     value.Required,
+		defaultValue: value.Value,
+		normalize:    n,
+		setter:       setter,
+	}, nil
+}
@@ -0,0 +1,196 @@
+package token
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseJSONPath(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		testData := []struct {
+			expr     string
+			expected jsonPath
+		}{
+			{"device", jsonPath{"device"}},
+			{"$.device", jsonPath{"device"}},
+			{"$.device.id", jsonPath{"device", "id"}},
+			{"device.ids[1]", jsonPath{"device", "ids", 1}},
+			{"$['serial number']", jsonPath{"serial number"}},
+			{`$.devices[0]["mac"]`, jsonPath{"devices", 0, "mac"}},
+			{"$[2][0].name", jsonPath{2, 0, "name"}},
+		}
+
+		for _, record := range testData {
+			t.Run(record.expr, func(t *testing.T) {
+				path, err := parseJSONPath(record.expr)
+				assert.NoError(t, err)
+				assert.Equal(t, record.expected, path)
+			})
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, expr := range []string{"", "$", "$.", "device..id", "device[", "device[-1]", "device[x]", "$device"} {
+			t.Run(expr, func(t *testing.T) {
+				path, err := parseJSONPath(expr)
+				assert.Nil(t, path)
+				assert.Equal(t, InvalidJSONPathError{Path: expr}, err)
+			})
+		}
+	})
+}
+
+func testBodyRequestBuilder(t *testing.T, value Value, body string) (*Request, error) {
+	rb, err := NewRequestBuilders(Options{
+		Claims: map[string]Value{"claim": value},
+	})
+
+	require.NoError(t, err)
+	require.Len(t, rb, 1)
+
+	original := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	original.Header.Set("Content-Type", "application/json")
+	require.NoError(t, ParseJSON(original))
+	return BuildRequest(original, rb)
+}
+
+func TestBodyRequestBuilder(t *testing.T) {
+	const body = `{"device": {"id": "mac:112233445566", "serial": 12345678901234567890, "tags": ["a", "b"]}}`
+
+	t.Run("NestedHit", func(t *testing.T) {
+		testData := []struct {
+			path     string
+			expected interface{}
+		}{
+			{"$.device.id", "mac:112233445566"},
+			{"device.serial", json.Number("12345678901234567890")},
+			{"$.device.tags[1]", "b"},
+			{"$.device.tags", []interface{}{"a", "b"}},
+		}
+
+		for _, record := range testData {
+			t.Run(record.path, func(t *testing.T) {
+				tr, err := testBodyRequestBuilder(t, Value{Body: record.path}, body)
+				require.NoError(t, err)
+				assert.Equal(t, record.expected, tr.Claims["claim"])
+			})
+		}
+	})
+
+	t.Run("Capture", func(t *testing.T) {
+		tr, err := testBodyRequestBuilder(t, Value{Body: "$.device.id", Capture: &Capture{Pattern: "^mac:(.+)$"}}, body)
+		require.NoError(t, err)
+		assert.Equal(t, "112233445566", tr.Claims["claim"])
+	})
+
+	t.Run("Miss", func(t *testing.T) {
+		for _, path := range []string{"$.device.name", "$.device.tags[2]", "$.device.id.value", "$.missing[0]"} {
+			t.Run(path, func(t *testing.T) {
+				tr, err := testBodyRequestBuilder(t, Value{Body: path}, body)
+				require.NoError(t, err)
+				assert.NotContains(t, tr.Claims, "claim")
+			})
+		}
+	})
+
+	t.Run("MissDefault", func(t *testing.T) {
+		tr, err := testBodyRequestBuilder(t, Value{Body: "$.device.name", Value: "unknown"}, body)
+		require.NoError(t, err)
+		assert.Equal(t, "unknown", tr.Claims["claim"])
+	})
+
+	t.Run("MissRequired", func(t *testing.T) {
+		tr, err := testBodyRequestBuilder(t, Value{Body: "$.device.name", Required: true}, body)
+		assert.Nil(t, tr)
+
+		var mbve MissingBodyValueError
+		require.True(t, errors.As(err, &mbve))
+		assert.Equal(t, "$.device.name", mbve.Path)
+		assert.Equal(t, http.StatusBadRequest, err.(BuildError).StatusCode())
+	})
+
+	t.Run("EmptyBody", func(t *testing.T) {
+		tr, err := testBodyRequestBuilder(t, Value{Body: "$.device.id"}, "")
+		require.NoError(t, err)
+		assert.NotContains(t, tr.Claims, "claim")
+	})
+
+	t.Run("InvalidJSON", func(t *testing.T) {
+		rb, err := NewRequestBuilders(Options{
+			Claims: map[string]Value{"claim": {Body: "$.device.id"}},
+		})
+
+		require.NoError(t, err)
+
+		// the form parser leaves JSON bodies alone, so the body path is the first to see the malformed body
+		original := httptest.NewRequest("POST", "/", strings.NewReader(`{"device": `))
+		original.Header.Set("Content-Type", "application/json")
+		require.NoError(t, ParseForm(original))
+
+		tr, err := BuildRequest(original, rb)
+		assert.Nil(t, tr)
+
+		var ibe InvalidBodyError
+		require.True(t, errors.As(err, &ibe))
+		assert.Equal(t, http.StatusBadRequest, err.(BuildError).StatusCode())
+	})
+
+	t.Run("DecodedOnce", func(t *testing.T) {
+		var (
+			assert  = assert.New(t)
+			require = require.New(t)
+
+			original = withDecodedBody(httptest.NewRequest("POST", "/", strings.NewReader(body)))
+		)
+
+		assert.Equal(original, withDecodedBody(original), "a request that shares a decoded body is not copied again")
+
+		first, err := requestBody(original)
+		require.NoError(err)
+
+		// later body paths use the first decoding rather than reading the body again
+		original.Body = ioutil.NopCloser(strings.NewReader(`{"device": {"id": "something else"}}`))
+		second, err := requestBody(original)
+		require.NoError(err)
+		assert.Equal(first, second)
+
+		rb, err := NewRequestBuilders(Options{
+			Claims: map[string]Value{
+				"id":     {Body: "$.device.id"},
+				"serial": {Body: "$.device.serial"},
+			},
+		})
+
+		require.NoError(err)
+		tr, err := BuildRequest(httptest.NewRequest("POST", "/", strings.NewReader(body)), rb)
+		require.NoError(err)
+		assert.Equal("mac:112233445566", tr.Claims["id"])
+		assert.Equal(json.Number("12345678901234567890"), tr.Claims["serial"])
+	})
+
+	t.Run("NotAllowed", func(t *testing.T) {
+		rb, err := NewRequestBuilders(Options{
+			Claims: map[string]Value{"claim": {Body: "$.device.id", Header: "X-Device"}},
+		})
+
+		assert.Empty(t, rb)
+		assert.Equal(t, ErrBodyNotAllowed, err)
+	})
+
+	t.Run("InvalidPath", func(t *testing.T) {
+		rb, err := NewRequestBuilders(Options{
+			Claims: map[string]Value{"claim": {Body: "$.device["}},
+		})
+
+		assert.Empty(t, rb)
+		assert.Equal(t, InvalidJSONPathError{Path: "$.device["}, err)
+	})
+}
@@ -0,0 +1,70 @@
+package token
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// CanonicalJSON marshals a value into a canonical JSON form:  object keys are sorted at every level,
+// there is no insignificant whitespace, and no HTML escaping is performed.  Values that are structs or other
+// custom types are first normalized into their generic JSON representation, so two values that marshal to
+// equivalent JSON will always produce identical bytes.  Numbers retain the textual form produced by encoding/json.
+func CanonicalJSON(v interface{}) ([]byte, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		generic interface{}
+		decoder = json.NewDecoder(bytes.NewReader(raw))
+	)
+
+	decoder.UseNumber()
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, err
+	}
+
+	var (
+		output  bytes.Buffer
+		encoder = json.NewEncoder(&output)
+	)
+
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(generic); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSuffix(output.Bytes(), []byte{'\n'}), nil
+}
+
+// canonicalSignedString produces the same compact serialization as jwt.Token.SignedString, except that both
+// the header and the claims are encoded via CanonicalJSON.  The result is an ordinary JWS that any standard
+// JWT library can verify.
+func canonicalSignedString(method jwt.SigningMethod, header map[string]interface{}, claims map[string]interface{}, key interface{}) (string, error) {
+	h, err := CanonicalJSON(header)
+	if err != nil {
+		return "", err
+	}
+
+	c, err := CanonicalJSON(claims)
+	if err != nil {
+		return "", err
+	}
+
+	return signSegments(method, h, c, key)
+}
+
+// signSegments produces the compact serialization of a JWS from an already serialized header and payload
+func signSegments(method jwt.SigningMethod, header, payload []byte, key interface{}) (string, error) {
+	signingString := strings.Join([]string{jwt.EncodeSegment(header), jwt.EncodeSegment(payload)}, ".")
+	signature, err := method.Sign(signingString, key)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Join([]string{signingString, signature}, "."), nil
+}
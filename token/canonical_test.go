@@ -0,0 +1,113 @@
+package token
+
+import (
+	"context"
+	"crypto/rsa"
+	"strings"
+	"testing"
+
+	"github.com/xmidt-org/themis/key"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonicalJSON(t *testing.T) {
+	type nested struct {
+		Zebra string `json:"zebra"`
+		Apple int    `json:"apple"`
+	}
+
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	first, err := CanonicalJSON(map[string]interface{}{
+		"sub":    "a<b>&c",
+		"nested": nested{Zebra: "z", Apple: 1},
+		"list":   []interface{}{3, "two", 1.5},
+	})
+
+	require.NoError(err)
+	assert.Equal(`{"list":[3,"two",1.5],"nested":{"apple":1,"zebra":"z"},"sub":"a<b>&c"}`, string(first))
+
+	second, err := CanonicalJSON(map[string]interface{}{
+		"list":   []int{3}, // deliberately different
+		"nested": map[string]interface{}{"apple": 1, "zebra": "z"},
+		"sub":    "a<b>&c",
+	})
+
+	require.NoError(err)
+	assert.NotEqual(first, second)
+
+	_, err = CanonicalJSON(func() {})
+	assert.Error(err)
+}
+
+func newCanonicalFactory(t *testing.T, registry key.Registry, kid string) Factory {
+	f, err := NewFactory(
+		Options{
+			Key:             key.Descriptor{Kid: kid, Bits: 512},
+			CanonicalClaims: true,
+		},
+		ClaimBuilders{requestClaimBuilder{}},
+		registry,
+	)
+
+	require.NoError(t, err)
+	return f
+}
+
+func TestFactoryCanonicalClaims(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		registry = key.NewRegistry(nil)
+		factory  = newCanonicalFactory(t, registry, "test")
+	)
+
+	first, err := factory.NewToken(context.Background(), &Request{
+		Claims: map[string]interface{}{
+			"sub":   "test<subject>",
+			"aud":   []string{"one", "two"},
+			"extra": map[string]interface{}{"b": 2, "a": 1},
+		},
+	})
+
+	require.NoError(err)
+
+	second, err := factory.NewToken(context.Background(), &Request{
+		Claims: map[string]interface{}{
+			"extra": map[string]interface{}{"a": 1, "b": 2},
+			"aud":   []interface{}{"one", "two"},
+			"sub":   "test<subject>",
+		},
+	})
+
+	require.NoError(err)
+
+	firstParts := strings.Split(first, ".")
+	secondParts := strings.Split(second, ".")
+	require.Len(firstParts, 3)
+	require.Len(secondParts, 3)
+	assert.Equal(firstParts[0], secondParts[0])
+	assert.Equal(firstParts[1], secondParts[1])
+
+	payload, err := jwt.DecodeSegment(firstParts[1])
+	require.NoError(err)
+	assert.Equal(`{"aud":["one","two"],"extra":{"a":1,"b":2},"sub":"test<subject>"}`, string(payload))
+
+	pair, ok := registry.Get("test")
+	require.True(ok)
+
+	parsed, err := jwt.Parse(first, func(token *jwt.Token) (interface{}, error) {
+		assert.Equal("test", token.Header["kid"])
+		return &pair.Sign().(*rsa.PrivateKey).PublicKey, nil
+	})
+
+	require.NoError(err)
+	assert.True(parsed.Valid)
+	assert.Equal("test<subject>", parsed.Claims.(jwt.MapClaims)["sub"])
+}
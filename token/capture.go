@@ -0,0 +1,60 @@
+package token
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+// NoMatchError indicates that a value taken from the HTTP request did not match its Capture pattern
+type NoMatchError struct {
+	Value   string
+	Pattern string
+}
+
+func (nme NoMatchError) Error() string {
+	return fmt.Sprintf("Value %q does not match pattern %s", nme.Value, nme.Pattern)
+}
+
+func (nme NoMatchError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// Capture describes how to extract part of a value taken from the HTTP request, e.g. the ID from "device:12345".
+// A value that does not match is rejected with a 400 status if the Value is required, and is omitted otherwise.
+type Capture struct {
+	// Pattern is the regular expression matched against the raw value.  Unless the pattern is anchored,
+	// it may match anywhere within the value.
+	Pattern string
+
+	// Template produces the transformed value from the match, using the regexp.Expand syntax, e.g. $1 or ${id}.
+	// If unset, the first capture group is used, or the entire match if the pattern has no capture groups.
+	Template string
+}
+
+// NewTransform compiles this Capture into a function that transforms raw values.  The returned
+// function returns a NoMatchError for values that do not match the Pattern.
+func (c Capture) NewTransform() (func(string) (string, error), error) {
+	re, err := regexp.Compile(c.Pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	template := c.Template
+	if len(template) == 0 {
+		if re.NumSubexp() > 0 {
+			template = "${1}"
+		} else {
+			template = "${0}"
+		}
+	}
+
+	return func(v string) (string, error) {
+		match := re.FindStringSubmatchIndex(v)
+		if match == nil {
+			return "", NoMatchError{Value: v, Pattern: c.Pattern}
+		}
+
+		return string(re.ExpandString(nil, template, v, match)), nil
+	}, nil
+}
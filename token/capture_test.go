@@ -0,0 +1,179 @@
+package token
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNoMatchError(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		err error = NoMatchError{Value: "unknown:12345", Pattern: `^device:(\d+)$`}
+	)
+
+	assert.Contains(err.Error(), "unknown:12345")
+	assert.Contains(err.Error(), `^device:(\d+)$`)
+	assert.Equal(http.StatusBadRequest, err.(NoMatchError).StatusCode())
+}
+
+func TestCaptureNewTransform(t *testing.T) {
+	testData := []struct {
+		name     string
+		capture  Capture
+		value    string
+		expected string
+	}{
+		{"FirstGroup", Capture{Pattern: `^device:(\d+)$`}, "device:12345", "12345"},
+		{"Unanchored", Capture{Pattern: `id=(\w+)`}, "type=device;id=abc;", "abc"},
+		{"NoGroups", Capture{Pattern: `\d+`}, "device:12345", "12345"},
+		{"NamedGroups", Capture{Pattern: `^(?P<type>\w+):(?P<id>\d+)$`, Template: "${id}@${type}"}, "device:12345", "12345@device"},
+		{"NumberedTemplate", Capture{Pattern: `^(\w+):(\d+)$`, Template: "$2-$1"}, "device:12345", "12345-device"},
+	}
+
+	for _, record := range testData {
+		t.Run(record.name, func(t *testing.T) {
+			var (
+				assert  = assert.New(t)
+				require = require.New(t)
+			)
+
+			transform, err := record.capture.NewTransform()
+			require.NoError(err)
+			require.NotNil(transform)
+
+			actual, err := transform(record.value)
+			assert.NoError(err)
+			assert.Equal(record.expected, actual)
+		})
+	}
+
+	t.Run("NoMatch", func(t *testing.T) {
+		var (
+			assert  = assert.New(t)
+			require = require.New(t)
+		)
+
+		transform, err := Capture{Pattern: `^device:(\d+)$`}.NewTransform()
+		require.NoError(err)
+
+		actual, err := transform("device:abc")
+		assert.Empty(actual)
+		assert.Equal(NoMatchError{Value: "device:abc", Pattern: `^device:(\d+)$`}, err)
+	})
+
+	t.Run("InvalidPattern", func(t *testing.T) {
+		assert := assert.New(t)
+		transform, err := Capture{Pattern: `device:(`}.NewTransform()
+		assert.Nil(transform)
+		assert.Error(err)
+	})
+}
+
+func newCaptureRequestBuilders(t *testing.T) RequestBuilders {
+	rb, err := NewRequestBuilders(Options{
+		Claims: map[string]Value{
+			"deviceID": Value{
+				Header:   "X-Device",
+				Required: true,
+				Capture:  &Capture{Pattern: `^device:(\d+)$`},
+			},
+			"mac": Value{
+				Parameter: "id",
+				Capture:   &Capture{Pattern: `^mac:(.+)$`},
+				MAC:       &MAC{Separator: ":"},
+			},
+		},
+		Metadata: map[string]Value{
+			"partner": Value{
+				Variable: "partner",
+				Capture:  &Capture{Pattern: `^partner-(?P<name>\w+)$`, Template: "${name}"},
+			},
+		},
+	})
+
+	require.NoError(t, err)
+	return rb
+}
+
+func testCaptureRequestBuilderSuccess(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		rb       = newCaptureRequestBuilders(t)
+		original = mux.SetURLVars(
+			httptest.NewRequest("GET", "/test?id=mac:11-22-33-AA-BB-CC", nil),
+			map[string]string{"partner": "partner-comcast"},
+		)
+	)
+
+	original.Header.Set("X-Device", "device:12345")
+	require.NoError(original.ParseForm())
+
+	tr, err := BuildRequest(original, rb)
+	require.NoError(err)
+	assert.Equal("12345", tr.Claims["deviceID"])
+	assert.Equal("11:22:33:aa:bb:cc", tr.Claims["mac"])
+	assert.Equal("comcast", tr.Metadata["partner"])
+}
+
+func testCaptureRequestBuilderNoMatch(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		rb       = newCaptureRequestBuilders(t)
+		original = mux.SetURLVars(
+			httptest.NewRequest("GET", "/test?id=serial:1234", nil),
+			map[string]string{"partner": "comcast"},
+		)
+	)
+
+	original.Header.Set("X-Device", "device:12345")
+	require.NoError(original.ParseForm())
+
+	// optional values that do not match are omitted
+	tr, err := BuildRequest(original, rb)
+	require.NoError(err)
+	assert.Equal("12345", tr.Claims["deviceID"])
+	assert.NotContains(tr.Claims, "mac")
+	assert.NotContains(tr.Metadata, "partner")
+
+	// required values that do not match are rejected
+	original.Header.Set("X-Device", "unknown:12345")
+	tr, err = BuildRequest(original, rb)
+	assert.Nil(tr)
+	require.Error(err)
+	assert.Equal(http.StatusBadRequest, err.(BuildError).StatusCode())
+	assert.Equal(NoMatchError{Value: "unknown:12345", Pattern: `^device:(\d+)$`}, err.(BuildError).Err)
+}
+
+func testCaptureRequestBuilderInvalidPattern(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		rb, err = NewRequestBuilders(Options{
+			Claims: map[string]Value{
+				"bad": Value{
+					Header:  "X-Bad",
+					Capture: &Capture{Pattern: `(`},
+				},
+			},
+		})
+	)
+
+	assert.Empty(rb)
+	assert.Error(err)
+}
+
+func TestCaptureRequestBuilder(t *testing.T) {
+	t.Run("Success", testCaptureRequestBuilderSuccess)
+	t.Run("NoMatch", testCaptureRequestBuilderNoMatch)
+	t.Run("InvalidPattern", testCaptureRequestBuilderInvalidPattern)
+}
@@ -0,0 +1,255 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/xmidt-org/themis/clock"
+	"github.com/xmidt-org/themis/random"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+const (
+	// DefaultChallengeHeader is the HTTP header that carries challenge nonces when no header is configured
+	DefaultChallengeHeader = "X-Themis-Nonce"
+
+	// DefaultChallengeTTL is how long an issued challenge nonce may be echoed back when no TTL is configured
+	DefaultChallengeTTL time.Duration = 5 * time.Minute
+
+	// DefaultChallengeMaxOutstanding is the most unredeemed, unexpired nonces the in-memory store holds when no
+	// maximum is configured
+	DefaultChallengeMaxOutstanding = 10000
+)
+
+var (
+	ErrChallengeRequiresNoncer = errors.New("A challenge requires a noncer")
+)
+
+// ChallengeError indicates that a token request did not echo a challenge nonce that the server issued,
+// either because the nonce is missing, unknown, expired, or already redeemed
+type ChallengeError struct {
+	Nonce string
+}
+
+func (ce ChallengeError) Error() string {
+	if len(ce.Nonce) == 0 {
+		return "A challenge nonce is required"
+	}
+
+	return fmt.Sprintf("The challenge nonce %s is unknown, expired, or already used", ce.Nonce)
+}
+
+func (ce ChallengeError) StatusCode() int {
+	return http.StatusUnauthorized
+}
+
+// ChallengeLimitError indicates that the in-memory ChallengeStore already holds as many unredeemed, unexpired
+// nonces as it allows, so no more can be issued until some are redeemed or expire
+type ChallengeLimitError struct {
+	Max int
+}
+
+func (cle ChallengeLimitError) Error() string {
+	return fmt.Sprintf("No more than %d challenge nonces can be outstanding", cle.Max)
+}
+
+func (cle ChallengeLimitError) StatusCode() int {
+	return http.StatusTooManyRequests
+}
+
+// ChallengeStore records the challenge nonces issued by the server until they are redeemed
+type ChallengeStore interface {
+	// Issue records a newly issued challenge nonce
+	Issue(nonce string) error
+
+	// Redeem consumes a challenge nonce.  If the nonce was never issued, has expired, or has already been
+	// redeemed, this method returns false.  Implementations must be safe for concurrent use, and checking
+	// and consuming a nonce must be atomic.
+	Redeem(nonce string) (bool, error)
+}
+
+// memoryChallengeStore is the in-memory ChallengeStore
+type memoryChallengeStore struct {
+	lock      sync.Mutex
+	ttl       time.Duration
+	max       int
+	now       func() time.Time
+	expires   map[string]time.Time
+	lastPrune time.Time
+}
+
+// NewMemoryChallengeStore creates a ChallengeStore that holds each nonce, in memory, for the given TTL.  At most
+// max nonces may be outstanding at once, after which Issue returns a ChallengeLimitError.  If ttl is nonpositive,
+// DefaultChallengeTTL is used, and if max is nonpositive, DefaultChallengeMaxOutstanding is used.  Expiry is
+// judged by the given Clock, or by the system time if c is nil.  Nonces are not shared across processes.
+func NewMemoryChallengeStore(ttl time.Duration, max int, c clock.Clock) ChallengeStore {
+	return newMemoryChallengeStore(ttl, max, clock.NowFunc(c))
+}
+
+func newMemoryChallengeStore(ttl time.Duration, max int, now func() time.Time) *memoryChallengeStore {
+	if ttl <= 0 {
+		ttl = DefaultChallengeTTL
+	}
+
+	if max <= 0 {
+		max = DefaultChallengeMaxOutstanding
+	}
+
+	return &memoryChallengeStore{
+		ttl:     ttl,
+		max:     max,
+		now:     now,
+		expires: make(map[string]time.Time),
+	}
+}
+
+// prune removes expired nonces.  To bound the cost, this is done at most once per TTL unless the store is full.
+func (m *memoryChallengeStore) prune(now time.Time) {
+	if len(m.expires) < m.max && now.Sub(m.lastPrune) < m.ttl {
+		return
+	}
+
+	for nonce, expires := range m.expires {
+		if !now.Before(expires) {
+			delete(m.expires, nonce)
+		}
+	}
+
+	m.lastPrune = now
+}
+
+func (m *memoryChallengeStore) Issue(nonce string) error {
+	now := m.now()
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.prune(now)
+	if len(m.expires) >= m.max {
+		return ChallengeLimitError{Max: m.max}
+	}
+
+	m.expires[nonce] = now.Add(m.ttl)
+	return nil
+}
+
+func (m *memoryChallengeStore) Redeem(nonce string) (bool, error) {
+	now := m.now()
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	expires, ok := m.expires[nonce]
+	delete(m.expires, nonce)
+	return ok && now.Before(expires), nil
+}
+
+// Challenge describes a challenge-response flow, in which a client first obtains a nonce from the challenge
+// endpoint and must then echo that nonce on its token request
+type Challenge struct {
+	// Header is the HTTP header in which the challenge endpoint returns each nonce, and in which token
+	// requests must echo it.  If unset, DefaultChallengeHeader is used.
+	Header string
+
+	// TTL is how long an issued nonce may be echoed back.  If unset, DefaultChallengeTTL is used.
+	// This field is ignored when a custom ChallengeStore is supplied.
+	TTL time.Duration
+
+	// MaxOutstanding is the most nonces that may be issued but neither redeemed nor expired.  Once it is
+	// reached, the challenge endpoint responds with a 429.  If unset, DefaultChallengeMaxOutstanding is used.
+	// This field is ignored when a custom ChallengeStore is supplied.
+	MaxOutstanding int
+}
+
+func (c Challenge) header() string {
+	if len(c.Header) > 0 {
+		return c.Header
+	}
+
+	return DefaultChallengeHeader
+}
+
+// ChallengeHandler is an http.Handler that issues challenge nonces
+type ChallengeHandler http.Handler
+
+// NewChallengeHandler creates an http.Handler that generates a nonce with the given Noncer, records it in
+// the store, and returns it in the configured header of an empty 204 response.  The given ErrorEncoder,
+// or kithttp.DefaultErrorEncoder if nil, writes any failure.
+func NewChallengeHandler(c Challenge, n random.Noncer, store ChallengeStore, encoder kithttp.ErrorEncoder) ChallengeHandler {
+	if encoder == nil {
+		encoder = kithttp.DefaultErrorEncoder
+	}
+
+	header := c.header()
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		nonce, err := n.Nonce()
+		if err == nil {
+			err = store.Issue(nonce)
+		}
+
+		if err != nil {
+			encoder(request.Context(), err, response)
+			return
+		}
+
+		response.Header().Set(header, nonce)
+		response.Header().Set("Cache-Control", "no-store")
+		response.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// ChallengeGuard is an Alice-style decorator that rejects token requests which do not echo an issued,
+// unexpired challenge nonce.  Each nonce can be redeemed only once.  Requests without a nonce are rejected
+// immediately, but the nonce itself is redeemed when the decorated handler calls RedeemNonces.
+type ChallengeGuard struct {
+	Challenge
+
+	// Store is the required store of issued nonces
+	Store ChallengeStore
+
+	// ErrorEncoder writes any rejection.  If unset, kithttp.DefaultErrorEncoder is used.
+	ErrorEncoder kithttp.ErrorEncoder
+}
+
+func (cg ChallengeGuard) redeem(nonce string) error {
+	ok, err := cg.Store.Redeem(nonce)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return ChallengeError{Nonce: nonce}
+	}
+
+	return nil
+}
+
+func (cg ChallengeGuard) Then(next http.Handler) http.Handler {
+	encoder := cg.ErrorEncoder
+	if encoder == nil {
+		encoder = kithttp.DefaultErrorEncoder
+	}
+
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		nonce := request.Header.Get(cg.header())
+		if len(nonce) == 0 {
+			encoder(request.Context(), ChallengeError{}, response)
+			return
+		}
+
+		next.ServeHTTP(
+			response,
+			request.WithContext(
+				withRedemption(request.Context(), func() error { return cg.redeem(nonce) }),
+			),
+		)
+	})
+}
+
+func (cg ChallengeGuard) ThenFunc(next http.HandlerFunc) http.Handler {
+	return cg.Then(next)
+}
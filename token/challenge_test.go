@@ -0,0 +1,258 @@
+package token
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/xmidt-org/themis/clock/clocktest"
+	"github.com/xmidt-org/themis/random/randomtest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fixedNow returns a function yielding the time pointed to, so tests can advance the clock
+func fixedNow(now *time.Time) func() time.Time {
+	return func() time.Time { return *now }
+}
+
+func testMemoryChallengeStoreTTL(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		now   = time.Now()
+		store = newMemoryChallengeStore(time.Minute, 0, fixedNow(&now))
+	)
+
+	require.NoError(store.Issue("first"))
+	require.NoError(store.Issue("second"))
+
+	ok, err := store.Redeem("first")
+	require.NoError(err)
+	assert.True(ok)
+
+	ok, err = store.Redeem("first")
+	require.NoError(err)
+	assert.False(ok, "a nonce can only be redeemed once")
+
+	ok, err = store.Redeem("unknown")
+	require.NoError(err)
+	assert.False(ok)
+
+	now = now.Add(time.Minute)
+	ok, err = store.Redeem("second")
+	require.NoError(err)
+	assert.False(ok, "an expired nonce cannot be redeemed")
+
+	require.NoError(store.Issue("stale"))
+	now = now.Add(2 * time.Minute)
+	require.NoError(store.Issue("third"))
+	assert.Len(store.expires, 1, "expired nonces should have been pruned")
+}
+
+func testMemoryChallengeStoreDefaultTTL(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(DefaultChallengeTTL, NewMemoryChallengeStore(0, 0, nil).(*memoryChallengeStore).ttl)
+	assert.Equal(DefaultChallengeMaxOutstanding, NewMemoryChallengeStore(0, 0, nil).(*memoryChallengeStore).max)
+}
+
+func testMemoryChallengeStoreMaxOutstanding(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		now   = time.Now()
+		store = newMemoryChallengeStore(time.Minute, 2, fixedNow(&now))
+	)
+
+	require.NoError(store.Issue("first"))
+	require.NoError(store.Issue("second"))
+	assert.Equal(ChallengeLimitError{Max: 2}, store.Issue("third"))
+
+	// redeeming a nonce frees its slot
+	ok, err := store.Redeem("first")
+	require.NoError(err)
+	require.True(ok)
+	require.NoError(store.Issue("third"))
+	assert.Equal(ChallengeLimitError{Max: 2}, store.Issue("fourth"))
+
+	// a full store prunes expired nonces right away rather than waiting out the TTL
+	now = now.Add(time.Minute)
+	assert.NoError(store.Issue("fourth"))
+	assert.Len(store.expires, 1)
+}
+
+func testMemoryChallengeStoreClock(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		now   = clocktest.NewFake(time.Now())
+		store = NewMemoryChallengeStore(time.Minute, 0, now)
+	)
+
+	require.NoError(store.Issue("first"))
+	now.Add(time.Minute)
+	ok, err := store.Redeem("first")
+	require.NoError(err)
+	assert.False(ok, "the store should judge expiry by the supplied clock")
+}
+
+func TestMemoryChallengeStore(t *testing.T) {
+	t.Run("TTL", testMemoryChallengeStoreTTL)
+	t.Run("DefaultTTL", testMemoryChallengeStoreDefaultTTL)
+	t.Run("MaxOutstanding", testMemoryChallengeStoreMaxOutstanding)
+	t.Run("Clock", testMemoryChallengeStoreClock)
+}
+
+func serveChallengeGuard(handler http.Handler, header, nonce string) *httptest.ResponseRecorder {
+	var (
+		response = httptest.NewRecorder()
+		request  = httptest.NewRequest("GET", "/issue", nil)
+	)
+
+	if len(nonce) > 0 {
+		request.Header.Set(header, nonce)
+	}
+
+	handler.ServeHTTP(response, request)
+	return response
+}
+
+func testChallengeIssue(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		noncer  = new(randomtest.Noncer)
+		store   = NewMemoryChallengeStore(time.Minute, 0, nil)
+		handler = NewChallengeHandler(Challenge{}, noncer, store, nil)
+
+		response = httptest.NewRecorder()
+	)
+
+	noncer.ExpectNonce().Return("abc", error(nil)).Once()
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/issue/challenge", nil))
+	assert.Equal(http.StatusNoContent, response.Code)
+	assert.Equal("abc", response.Header().Get(DefaultChallengeHeader))
+	assert.Equal("no-store", response.Header().Get("Cache-Control"))
+	assert.Empty(response.Body.String())
+
+	ok, err := store.Redeem("abc")
+	require.NoError(err)
+	assert.True(ok, "the issued nonce should have been stored")
+	noncer.AssertExpectations(t)
+}
+
+func testChallengeIssueError(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		noncer  = new(randomtest.Noncer)
+		handler = NewChallengeHandler(Challenge{Header: "X-Nonce"}, noncer, NewMemoryChallengeStore(time.Minute, 0, nil), nil)
+
+		response = httptest.NewRecorder()
+	)
+
+	noncer.ExpectNonce().Return("", errors.New("expected")).Once()
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/issue/challenge", nil))
+	assert.Equal(http.StatusInternalServerError, response.Code)
+	assert.Empty(response.Header().Get("X-Nonce"))
+	noncer.AssertExpectations(t)
+}
+
+func testChallengeEcho(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		noncer    = new(randomtest.Noncer)
+		now       = time.Now()
+		store     = newMemoryChallengeStore(time.Minute, 0, fixedNow(&now))
+		challenge = Challenge{Header: "X-Nonce"}
+		issuer    = NewChallengeHandler(challenge, noncer, store, nil)
+
+		handler = ChallengeGuard{
+			Challenge:    challenge,
+			Store:        store,
+			ErrorEncoder: NewProblemErrorEncoder(),
+		}.ThenFunc(func(response http.ResponseWriter, request *http.Request) {
+			if request.Header.Get("X-Invalid") == "true" {
+				response.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			if err := RedeemNonces(request.Context()); err != nil {
+				NewProblemErrorEncoder()(request.Context(), err, response)
+				return
+			}
+
+			response.WriteHeader(299)
+		})
+	)
+
+	noncer.ExpectNonce().Return("first", error(nil)).Once()
+	noncer.ExpectNonce().Return("second", error(nil)).Once()
+
+	issued := httptest.NewRecorder()
+	issuer.ServeHTTP(issued, httptest.NewRequest("GET", "/issue/challenge", nil))
+	require.Equal(http.StatusNoContent, issued.Code)
+	nonce := issued.Header().Get("X-Nonce")
+	require.Equal("first", nonce)
+
+	// a request rejected for another reason doesn't use up the nonce
+	invalid := httptest.NewRequest("GET", "/issue", nil)
+	invalid.Header.Set("X-Nonce", nonce)
+	invalid.Header.Set("X-Invalid", "true")
+	rejected := httptest.NewRecorder()
+	handler.ServeHTTP(rejected, invalid)
+	assert.Equal(http.StatusBadRequest, rejected.Code)
+
+	// the echoed nonce is accepted exactly once
+	assert.Equal(299, serveChallengeGuard(handler, "X-Nonce", nonce).Code)
+	replayed := serveChallengeGuard(handler, "X-Nonce", nonce)
+	assert.Equal(http.StatusUnauthorized, replayed.Code)
+	assert.Contains(replayed.Body.String(), ErrorCodeInvalidNonce)
+
+	// unknown and missing nonces are rejected
+	assert.Equal(http.StatusUnauthorized, serveChallengeGuard(handler, "X-Nonce", "unknown").Code)
+	assert.Equal(http.StatusUnauthorized, serveChallengeGuard(handler, "X-Nonce", "").Code)
+
+	// a nonce echoed after its TTL is rejected
+	issued = httptest.NewRecorder()
+	issuer.ServeHTTP(issued, httptest.NewRequest("GET", "/issue/challenge", nil))
+	require.Equal("second", issued.Header().Get("X-Nonce"))
+	now = now.Add(time.Minute)
+	assert.Equal(http.StatusUnauthorized, serveChallengeGuard(handler, "X-Nonce", "second").Code)
+
+	noncer.AssertExpectations(t)
+}
+
+func TestChallenge(t *testing.T) {
+	t.Run("Issue", testChallengeIssue)
+	t.Run("IssueError", testChallengeIssueError)
+	t.Run("Echo", testChallengeEcho)
+}
+
+func TestChallengeError(t *testing.T) {
+	assert := assert.New(t)
+
+	err := ChallengeError{Nonce: "abc"}
+	assert.Contains(err.Error(), "abc")
+	assert.Equal(http.StatusUnauthorized, err.StatusCode())
+	assert.NotEmpty(ChallengeError{}.Error())
+	assert.Equal(ErrorCodeInvalidNonce, ErrorCode(err))
+}
+
+func TestChallengeLimitError(t *testing.T) {
+	assert := assert.New(t)
+
+	err := ChallengeLimitError{Max: 12}
+	assert.Contains(err.Error(), "12")
+	assert.Equal(http.StatusTooManyRequests, err.StatusCode())
+	assert.Equal(ErrorCodeRateLimited, ErrorCode(err))
+}
@@ -10,8 +10,10 @@ import (
 
 	"github.com/xmidt-org/themis/random"
 	"github.com/xmidt-org/themis/xhttp/xhttpclient"
+	"github.com/xmidt-org/themis/xlog"
 
 	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log/level"
 	kithttp "github.com/go-kit/kit/transport/http"
 )
 
@@ -65,10 +67,64 @@ func (sc staticClaimBuilder) AddClaims(_ context.Context, r *Request, target map
 	return nil
 }
 
+// InvalidAudienceError is returned when a requested audience is not in the configured allow-list
+type InvalidAudienceError struct {
+	Audience interface{}
+}
+
+func (iae InvalidAudienceError) Error() string {
+	return fmt.Sprintf("Audience not allowed: %v", iae.Audience)
+}
+
+func (iae InvalidAudienceError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// audienceClaimBuilder is a ClaimBuilder that verifies any aud claim in the Request against an allow-list.
+// This builder does not modify the target claims.
+type audienceClaimBuilder map[string]bool
+
+func (ac audienceClaimBuilder) check(aud interface{}) error {
+	if s, ok := aud.(string); ok && ac[s] {
+		return nil
+	}
+
+	return InvalidAudienceError{Audience: aud}
+}
+
+func (ac audienceClaimBuilder) AddClaims(_ context.Context, r *Request, _ map[string]interface{}) error {
+	aud, ok := r.Claims["aud"]
+	if !ok {
+		return nil
+	}
+
+	switch v := aud.(type) {
+	case []string:
+		for _, e := range v {
+			if err := ac.check(e); err != nil {
+				return err
+			}
+		}
+
+	case []interface{}:
+		for _, e := range v {
+			if err := ac.check(e); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return ac.check(v)
+	}
+
+	return nil
+}
+
 // timeClaimBuilder is a ClaimBuilder which handles time-based claims
 type timeClaimBuilder struct {
 	now              func() time.Time
 	duration         time.Duration
+	jitter           func() time.Duration
 	disableNotBefore bool
 	notBeforeDelta   time.Duration
 }
@@ -78,7 +134,12 @@ func (tc *timeClaimBuilder) AddClaims(_ context.Context, r *Request, target map[
 	target["iat"] = now.Unix()
 
 	if tc.duration > 0 {
-		target["exp"] = now.Add(tc.duration).Unix()
+		exp := now.Add(tc.duration)
+		if tc.jitter != nil {
+			exp = exp.Add(tc.jitter())
+		}
+
+		target["exp"] = exp.Unix()
 	}
 
 	if !tc.disableNotBefore {
@@ -113,6 +174,7 @@ type remoteClaimBuilder struct {
 	endpoint endpoint.Endpoint
 	url      string
 	extra    map[string]interface{}
+	failOpen bool
 }
 
 func (rc *remoteClaimBuilder) AddClaims(ctx context.Context, r *Request, target map[string]interface{}) error {
@@ -130,7 +192,18 @@ func (rc *remoteClaimBuilder) AddClaims(ctx context.Context, r *Request, target
 
 	result, err := rc.endpoint(ctx, metadata)
 	if err != nil {
-		return err
+		if !rc.failOpen {
+			return err
+		}
+
+		xlog.Get(ctx).Log(
+			level.Key(), level.ErrorValue(),
+			xlog.MessageKey(), "unable to fetch remote claims",
+			"url", redactURL(rc.url),
+			xlog.ErrorKey(), err,
+		)
+
+		return nil
 	}
 
 	for k, v := range result.(map[string]interface{}) {
@@ -170,7 +243,7 @@ func newRemoteClaimBuilder(client xhttpclient.Interface, metadata map[string]int
 		),
 	)
 
-	return &remoteClaimBuilder{endpoint: c.Endpoint(), url: r.URL, extra: metadata}, nil
+	return &remoteClaimBuilder{endpoint: c.Endpoint(), url: r.URL, extra: metadata, failOpen: r.FailOpen}, nil
 }
 
 // NewClaimBuilders constructs a ClaimBuilders from configuration.  The returned instance is typically
@@ -185,19 +258,34 @@ func NewClaimBuilders(n random.Noncer, client xhttpclient.Interface, o Options)
 		staticClaimBuilder = make(staticClaimBuilder)
 	)
 
+	if aud, ok := o.Claims["aud"]; len(o.AllowedAudiences) > 0 && (!ok || aud.fromRequest()) {
+		// validate requested audiences before anything else, particularly before invoking any remote system
+		allowed := make(audienceClaimBuilder, len(o.AllowedAudiences))
+		for _, a := range o.AllowedAudiences {
+			allowed[a] = true
+		}
+
+		builders = append(ClaimBuilders{allowed}, builders...)
+	}
+
 	if o.Remote != nil {
 		// scan the metadata looking for static values that should be applied when invoking the remote server
 		metadata := make(map[string]interface{})
 		for name, value := range o.Metadata {
-			if len(value.Header) != 0 || len(value.Parameter) != 0 || len(value.Variable) != 0 {
+			if value.fromRequest() && len(value.Env) == 0 {
 				continue
 			}
 
-			if value.Value == nil {
+			if value.Value == nil && len(value.Env) == 0 {
 				return nil, fmt.Errorf("A value is required for the static metadata: %s", name)
 			}
 
-			metadata[name] = value.Value
+			v, err := value.static(name)
+			if err != nil {
+				return nil, err
+			} else if v != nil {
+				metadata[name] = v
+			}
 		}
 
 		remoteClaimBuilder, err := newRemoteClaimBuilder(client, metadata, o.Remote)
@@ -205,40 +293,61 @@ func NewClaimBuilders(n random.Noncer, client xhttpclient.Interface, o Options)
 			return nil, err
 		}
 
-		builders = append(builders, remoteClaimBuilder)
+		builders = append(builders, o.merged(remoteClaimBuilder))
 	}
 
 	for name, value := range o.Claims {
-		if len(value.Header) != 0 || len(value.Parameter) != 0 || len(value.Variable) != 0 {
+		if value.fromRequest() && len(value.Env) == 0 {
 			// skip any claims derived from HTTP requests
 			continue
 		}
 
-		if value.Value == nil {
+		if value.Value == nil && len(value.Env) == 0 {
 			return nil, fmt.Errorf("A value is required for the static claim: %s", name)
 		}
 
-		staticClaimBuilder[name] = value.Value
+		v, err := value.static(name)
+		if err != nil {
+			return nil, err
+		} else if v != nil {
+			staticClaimBuilder[name] = v
+		}
 	}
 
 	if len(staticClaimBuilder) > 0 {
-		builders = append(builders, staticClaimBuilder)
+		builders = append(builders, o.merged(staticClaimBuilder))
 	}
 
-	if o.Nonce && n != nil {
+	if o.Scope != nil {
+		builders = append(builders, newScopeClaimBuilder(*o.Scope))
+	}
+
+	if o.Profile == ProfileRFC9068 && n == nil {
+		return nil, ErrProfileRequiresNoncer
+	}
+
+	if (o.Nonce || o.Profile == ProfileRFC9068) && n != nil {
 		builders = append(builders, nonceClaimBuilder{n: n})
 	}
 
 	if !o.DisableTime {
-		builders = append(
-			builders,
-			&timeClaimBuilder{
-				now:              time.Now,
-				duration:         o.Duration,
-				disableNotBefore: o.DisableNotBefore,
-				notBeforeDelta:   o.NotBeforeDelta,
-			},
-		)
+		duration, window, err := o.lifetime()
+		if err != nil {
+			return nil, err
+		}
+
+		tc := &timeClaimBuilder{
+			now:              o.now(),
+			duration:         duration,
+			disableNotBefore: o.DisableNotBefore,
+			notBeforeDelta:   o.NotBeforeDelta,
+		}
+
+		if window > 0 {
+			tc.jitter = newExpirationJitter(window, nil)
+		}
+
+		builders = append(builders, tc)
 	}
 
 	return builders, nil
@@ -1,19 +1,23 @@
 package token
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strconv"
 	"testing"
 	"time"
 
 	"github.com/xmidt-org/themis/random/randomtest"
 	"github.com/xmidt-org/themis/xhttp/xhttpclient"
+	"github.com/xmidt-org/themis/xlog"
 
+	"github.com/go-kit/kit/log"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -320,9 +324,43 @@ func testRemoteClaimBuilderRemoteError(t *testing.T) {
 	assert.Error(builder.AddClaims(context.Background(), new(Request), make(map[string]interface{})))
 }
 
+func testRemoteClaimBuilderFailOpen(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		handler = http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			response.WriteHeader(http.StatusServiceUnavailable)
+		})
+	)
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	remoteURL, err := url.Parse(server.URL)
+	require.NoError(err)
+	remoteURL.User = url.UserPassword("user", "secret")
+
+	builder, err := newRemoteClaimBuilder(nil, nil, &RemoteClaims{URL: remoteURL.String(), FailOpen: true})
+	require.NoError(err)
+	require.NotNil(builder)
+
+	var (
+		output bytes.Buffer
+		ctx    = xlog.With(context.Background(), log.NewJSONLogger(&output))
+		target = map[string]interface{}{"existing": "value"}
+	)
+
+	assert.NoError(builder.AddClaims(ctx, new(Request), target))
+	assert.Equal(map[string]interface{}{"existing": "value"}, target)
+	assert.Contains(output.String(), "unable to fetch remote claims")
+	assert.NotContains(output.String(), "secret", "the logged URL should be redacted")
+}
+
 func TestRemoteClaimBuilder(t *testing.T) {
 	t.Run("AddClaims", testRemoteClaimBuilderAddClaims)
 	t.Run("RemoteError", testRemoteClaimBuilderRemoteError)
+	t.Run("FailOpen", testRemoteClaimBuilderFailOpen)
 }
 
 func testNewClaimBuildersMinimum(t *testing.T) {
@@ -395,6 +433,18 @@ func testNewClaimBuildersStatic(t *testing.T) {
 			"http1": Value{
 				Header: "X-Ignore-Me",
 			},
+			"http2": Value{
+				Cookie: "ignoreMe",
+			},
+			"serverName": Value{
+				ServerName: true,
+			},
+			"clientIP": Value{
+				ClientIP: true,
+			},
+			"scheme": Value{
+				Scheme: true,
+			},
 		},
 	})
 
@@ -563,10 +613,218 @@ func testNewClaimBuildersFull(t *testing.T) {
 	noncer.AssertExpectations(t)
 }
 
+func testNewClaimBuildersDeepMerge(t *testing.T, concatenateArrays bool, expectedRoles []interface{}) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		noncer = new(randomtest.Noncer)
+	)
+
+	builder, err := NewClaimBuilders(noncer, nil, Options{
+		DisableTime:       true,
+		DeepMerge:         true,
+		ConcatenateArrays: concatenateArrays,
+		Claims: map[string]Value{
+			"profile": Value{
+				Value: map[string]interface{}{
+					"tier":  "gold",
+					"roles": []interface{}{"reader"},
+				},
+			},
+		},
+	})
+
+	require.NoError(err)
+
+	actual := make(map[string]interface{})
+	assert.NoError(
+		builder.AddClaims(
+			context.Background(),
+			&Request{
+				Claims: map[string]interface{}{
+					"profile": map[string]interface{}{
+						"region": "east",
+						"roles":  []interface{}{"writer"},
+					},
+				},
+			},
+			actual,
+		),
+	)
+
+	assert.Equal(
+		map[string]interface{}{
+			"profile": map[string]interface{}{
+				"tier":   "gold",
+				"region": "east",
+				"roles":  expectedRoles,
+			},
+		},
+		actual,
+	)
+
+	noncer.AssertExpectations(t)
+}
+
 func TestNewClaimBuilders(t *testing.T) {
 	t.Run("Minimal", testNewClaimBuildersMinimum)
 	t.Run("BadValue", testNewClaimBuildersBadValue)
 	t.Run("Static", testNewClaimBuildersStatic)
 	t.Run("NoRemote", testNewClaimBuildersNoRemote)
 	t.Run("Full", testNewClaimBuildersFull)
+	t.Run("AllowedAudiences", testNewClaimBuildersAllowedAudiences)
+
+	t.Run("DeepMerge", func(t *testing.T) {
+		testNewClaimBuildersDeepMerge(t, false, []interface{}{"reader"})
+	})
+
+	t.Run("DeepMergeConcatenateArrays", func(t *testing.T) {
+		testNewClaimBuildersDeepMerge(t, true, []interface{}{"writer", "reader"})
+	})
+}
+
+func TestAudienceClaimBuilder(t *testing.T) {
+	testData := []struct {
+		request  *Request
+		expected error
+	}{
+		{
+			request: NewRequest(),
+		},
+		{
+			request: &Request{Claims: map[string]interface{}{"aud": "allowed"}},
+		},
+		{
+			request: &Request{Claims: map[string]interface{}{"aud": []interface{}{"allowed", "another"}}},
+		},
+		{
+			request:  &Request{Claims: map[string]interface{}{"aud": "disallowed"}},
+			expected: InvalidAudienceError{Audience: "disallowed"},
+		},
+		{
+			request:  &Request{Claims: map[string]interface{}{"aud": []string{"allowed", "disallowed"}}},
+			expected: InvalidAudienceError{Audience: "disallowed"},
+		},
+		{
+			request:  &Request{Claims: map[string]interface{}{"aud": 123}},
+			expected: InvalidAudienceError{Audience: 123},
+		},
+	}
+
+	for i, record := range testData {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			var (
+				assert  = assert.New(t)
+				builder = audienceClaimBuilder{"allowed": true, "another": true}
+				actual  = make(map[string]interface{})
+			)
+
+			assert.Equal(record.expected, builder.AddClaims(context.Background(), record.request, actual))
+			assert.Empty(actual)
+		})
+	}
+}
+
+func testNewClaimBuildersAllowedAudiences(t *testing.T) {
+	t.Run("Allowed", func(t *testing.T) {
+		var (
+			assert  = assert.New(t)
+			require = require.New(t)
+		)
+
+		builder, err := NewClaimBuilders(nil, nil, Options{
+			DisableTime:      true,
+			AllowedAudiences: []string{"allowed"},
+			Claims: map[string]Value{
+				"aud": Value{Header: "X-Audience"},
+			},
+		})
+
+		require.NoError(err)
+		actual := make(map[string]interface{})
+		assert.NoError(
+			builder.AddClaims(context.Background(), &Request{Claims: map[string]interface{}{"aud": "allowed"}}, actual),
+		)
+
+		assert.Equal(map[string]interface{}{"aud": "allowed"}, actual)
+	})
+
+	t.Run("Disallowed", func(t *testing.T) {
+		var (
+			assert  = assert.New(t)
+			require = require.New(t)
+		)
+
+		builder, err := NewClaimBuilders(nil, nil, Options{
+			DisableTime:      true,
+			AllowedAudiences: []string{"allowed"},
+			Claims: map[string]Value{
+				"aud": Value{Header: "X-Audience"},
+			},
+		})
+
+		require.NoError(err)
+		err = builder.AddClaims(context.Background(), &Request{Claims: map[string]interface{}{"aud": "disallowed"}}, make(map[string]interface{}))
+		require.Error(err)
+
+		iae, ok := err.(InvalidAudienceError)
+		require.True(ok)
+		assert.NotEmpty(iae.Error())
+		assert.Equal(http.StatusBadRequest, iae.StatusCode())
+	})
+
+	t.Run("HeaderWithDefault", func(t *testing.T) {
+		var (
+			assert  = assert.New(t)
+			require = require.New(t)
+
+			options = Options{
+				DisableTime:      true,
+				AllowedAudiences: []string{"allowed"},
+				Claims: map[string]Value{
+					"aud": Value{Header: "X-Audience", Value: "allowed"},
+				},
+			}
+		)
+
+		builder, err := NewClaimBuilders(nil, nil, options)
+		require.NoError(err)
+		rb, err := NewRequestBuilders(options)
+		require.NoError(err)
+
+		request := httptest.NewRequest("GET", "/", nil)
+		request.Header.Set("X-Audience", "disallowed")
+		tr, err := BuildRequest(request, rb)
+		require.NoError(err)
+		assert.IsType(InvalidAudienceError{}, builder.AddClaims(context.Background(), tr, make(map[string]interface{})))
+
+		request = httptest.NewRequest("GET", "/", nil)
+		request.Header.Set("X-Audience", "allowed")
+		tr, err = BuildRequest(request, rb)
+		require.NoError(err)
+		actual := make(map[string]interface{})
+		assert.NoError(builder.AddClaims(context.Background(), tr, actual))
+		assert.Equal(map[string]interface{}{"aud": "allowed"}, actual)
+	})
+
+	t.Run("Static", func(t *testing.T) {
+		var (
+			assert  = assert.New(t)
+			require = require.New(t)
+		)
+
+		builder, err := NewClaimBuilders(nil, nil, Options{
+			DisableTime:      true,
+			AllowedAudiences: []string{"allowed"},
+			Claims: map[string]Value{
+				"aud": Value{Value: "static"},
+			},
+		})
+
+		require.NoError(err)
+		actual := make(map[string]interface{})
+		assert.NoError(builder.AddClaims(context.Background(), NewRequest(), actual))
+		assert.Equal(map[string]interface{}{"aud": "static"}, actual)
+	})
 }
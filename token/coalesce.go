@@ -0,0 +1,108 @@
+package token
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"sync"
+	"time"
+)
+
+// signedToken is a serialized token together with the kid of the key that signed it
+type signedToken struct {
+	signed string
+	kid    string
+}
+
+// coalescedCall is a signing operation in progress, shared by every identical request that arrives before it finishes
+type coalescedCall struct {
+	done   chan struct{}
+	dups   int
+	result signedToken
+	err    error
+}
+
+// coalescer is a singleflight-style group of signing operations keyed by the hash of the token's header and claims
+type coalescer struct {
+	lock  sync.Mutex
+	calls map[string]*coalescedCall
+}
+
+func newCoalescer() *coalescer {
+	return &coalescer{
+		calls: make(map[string]*coalescedCall),
+	}
+}
+
+// detachedContext carries the values of its parent, such as the logger, but none of its deadline or cancellation
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// isContextError tests if an error is due to a canceled or expired context
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// do invokes sign unless a call with the same key is already in progress, in which case it shares that call's
+// result instead.  The shared call runs under a context that has the values of the ctx that started it but not
+// its cancellation, so that the caller that happened to start it cannot fail the others by giving up.  Each caller
+// stops waiting once its own ctx is done.  If the shared call fails with a context error anyway, a caller whose
+// ctx is still live tries once more.  Results are not retained once a call finishes.
+func (c *coalescer) do(ctx context.Context, key string, sign func(context.Context) (signedToken, error)) (signedToken, error) {
+	for retried := false; ; retried = true {
+		c.lock.Lock()
+		call, ok := c.calls[key]
+		if ok {
+			call.dups++
+		} else {
+			call = &coalescedCall{done: make(chan struct{})}
+			c.calls[key] = call
+			go c.run(detachedContext{ctx}, key, call, sign)
+		}
+
+		c.lock.Unlock()
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return signedToken{}, ctx.Err()
+		}
+
+		if retried || !isContextError(call.err) || ctx.Err() != nil {
+			return call.result, call.err
+		}
+	}
+}
+
+// run performs a shared call, then removes it so that the next identical request is signed anew
+func (c *coalescer) run(ctx context.Context, key string, call *coalescedCall, sign func(context.Context) (signedToken, error)) {
+	defer func() {
+		c.lock.Lock()
+		delete(c.calls, key)
+		c.lock.Unlock()
+		close(call.done)
+	}()
+
+	call.result, call.err = sign(ctx)
+}
+
+// coalesceKey hashes the canonical form of a token's header and claims.  The second return is false if this
+// factory does not coalesce requests, or if the token cannot be canonicalized.
+func (f *factory) coalesceKey(header, claims map[string]interface{}) (string, bool) {
+	if f.coalescer == nil {
+		return "", false
+	}
+
+	data, err := CanonicalJSON(map[string]interface{}{"header": header, "claims": claims})
+	if err != nil {
+		return "", false
+	}
+
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), true
+}
@@ -0,0 +1,285 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xmidt-org/themis/key"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pending returns the number of requests waiting on the in-progress call for a key
+func (c *coalescer) pending(key string) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if call, ok := c.calls[key]; ok {
+		return call.dups
+	}
+
+	return -1
+}
+
+// blockingMethod is a jwt.SigningMethod that counts signing operations and blocks each one until released
+type blockingMethod struct {
+	jwt.SigningMethod
+	calls   int32
+	release chan struct{}
+}
+
+func (bm *blockingMethod) Sign(signingString string, key interface{}) (string, error) {
+	atomic.AddInt32(&bm.calls, 1)
+	<-bm.release
+	return bm.SigningMethod.Sign(signingString, key)
+}
+
+func testCoalesceConcurrent(t *testing.T) {
+	const requests = 10
+
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	tf, err := NewFactory(
+		Options{
+			Key:      key.Descriptor{Kid: "test", Bits: 512},
+			Coalesce: true,
+		},
+		ClaimBuilders{requestClaimBuilder{}},
+		key.NewRegistry(nil),
+	)
+
+	require.NoError(err)
+	var (
+		f      = tf.(*factory)
+		method = &blockingMethod{SigningMethod: f.method, release: make(chan struct{})}
+	)
+
+	f.method = method
+	ck, ok := f.coalesceKey(
+		map[string]interface{}{"alg": method.Alg(), "kid": "test", "typ": "JWT"},
+		map[string]interface{}{"sub": "device"},
+	)
+
+	require.True(ok)
+
+	var (
+		wg     sync.WaitGroup
+		tokens = make([]string, requests)
+		errs   = make([]error, requests)
+	)
+
+	wg.Add(requests)
+	for i := 0; i < requests; i++ {
+		go func(i int) {
+			defer wg.Done()
+			r := NewRequest()
+			r.Claims["sub"] = "device"
+			tokens[i], errs[i] = tf.NewToken(context.Background(), r)
+		}(i)
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); f.coalescer.pending(ck) < requests-1; time.Sleep(time.Millisecond) {
+		require.True(time.Now().Before(deadline), "timed out waiting for requests to be coalesced")
+	}
+
+	close(method.release)
+	wg.Wait()
+
+	assert.Equal(int32(1), atomic.LoadInt32(&method.calls))
+	for i := 0; i < requests; i++ {
+		assert.NoError(errs[i])
+		assert.NotEmpty(tokens[i])
+		assert.Equal(tokens[0], tokens[i])
+	}
+
+	// once the call finishes, the next identical request is signed anew
+	assert.Equal(-1, f.coalescer.pending(ck))
+	r := NewRequest()
+	r.Claims["sub"] = "device"
+	_, err = tf.NewToken(context.Background(), r)
+	assert.NoError(err)
+	assert.Equal(int32(2), atomic.LoadInt32(&method.calls))
+}
+
+func testCoalesceDistinct(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		c      = newCoalescer()
+
+		release = make(chan struct{})
+		started = make(chan struct{})
+		calls   int32
+		results = make(chan string, 2)
+	)
+
+	go func() {
+		st, _ := c.do(context.Background(), "a", func(context.Context) (signedToken, error) {
+			atomic.AddInt32(&calls, 1)
+			close(started)
+			<-release
+			return signedToken{signed: "token-a"}, nil
+		})
+
+		results <- st.signed
+	}()
+
+	<-started
+
+	// a request with a different key is never held up by, or given the result of, another call
+	st, err := c.do(context.Background(), "b", func(context.Context) (signedToken, error) {
+		atomic.AddInt32(&calls, 1)
+		return signedToken{signed: "token-b"}, nil
+	})
+
+	assert.NoError(err)
+	assert.Equal("token-b", st.signed)
+
+	close(release)
+	assert.Equal("token-a", <-results)
+	assert.Equal(int32(2), atomic.LoadInt32(&calls))
+}
+
+func testCoalesceError(t *testing.T) {
+	var (
+		assert      = assert.New(t)
+		c           = newCoalescer()
+		expectedErr = errors.New("expected")
+	)
+
+	st, err := c.do(context.Background(), "a", func(context.Context) (signedToken, error) { return signedToken{}, expectedErr })
+	assert.Empty(st.signed)
+	assert.Equal(expectedErr, err)
+
+	// failures are not retained
+	st, err = c.do(context.Background(), "a", func(context.Context) (signedToken, error) { return signedToken{signed: "token", kid: "test"}, nil })
+	assert.NoError(err)
+	assert.Equal(signedToken{signed: "token", kid: "test"}, st)
+}
+
+func testCoalesceCanceled(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		c       = newCoalescer()
+
+		release = make(chan struct{})
+		started = make(chan struct{})
+
+		first, cancel = context.WithCancel(context.Background())
+		firstErr      = make(chan error, 1)
+	)
+
+	go func() {
+		_, err := c.do(first, "a", func(ctx context.Context) (signedToken, error) {
+			close(started)
+			select {
+			case <-release:
+				return signedToken{signed: "token"}, nil
+			case <-ctx.Done():
+				return signedToken{}, ctx.Err()
+			}
+		})
+
+		firstErr <- err
+	}()
+
+	<-started
+
+	// the caller that started the shared call gives up, but the call itself carries on for everyone else
+	cancel()
+	assert.Equal(context.Canceled, <-firstErr)
+
+	second := make(chan signedToken, 1)
+	go func() {
+		st, err := c.do(context.Background(), "a", func(context.Context) (signedToken, error) {
+			return signedToken{signed: "unexpected"}, nil
+		})
+
+		assert.NoError(err)
+		second <- st
+	}()
+
+	for deadline := time.Now().Add(5 * time.Second); c.pending("a") < 1; time.Sleep(time.Millisecond) {
+		require.True(time.Now().Before(deadline), "timed out waiting for the request to be coalesced")
+	}
+
+	// a waiter whose own context ends stops waiting
+	expired, expiredCancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer expiredCancel()
+	_, err := c.do(expired, "a", func(context.Context) (signedToken, error) { return signedToken{}, nil })
+	assert.Equal(context.DeadlineExceeded, err)
+
+	close(release)
+	assert.Equal("token", (<-second).signed)
+}
+
+func testCoalesceContextErrorRetry(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		c      = newCoalescer()
+		calls  int32
+	)
+
+	// a shared call that fails with a context error is retried once
+	st, err := c.do(context.Background(), "a", func(context.Context) (signedToken, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return signedToken{}, context.DeadlineExceeded
+		}
+
+		return signedToken{signed: "token"}, nil
+	})
+
+	assert.NoError(err)
+	assert.Equal("token", st.signed)
+	assert.Equal(int32(2), atomic.LoadInt32(&calls))
+
+	// but not indefinitely
+	atomic.StoreInt32(&calls, 0)
+	_, err = c.do(context.Background(), "a", func(context.Context) (signedToken, error) {
+		atomic.AddInt32(&calls, 1)
+		return signedToken{}, context.Canceled
+	})
+
+	assert.Equal(context.Canceled, err)
+	assert.Equal(int32(2), atomic.LoadInt32(&calls))
+}
+
+func testCoalesceDisabled(t *testing.T) {
+	assert := assert.New(t)
+	f := new(factory)
+	ck, ok := f.coalesceKey(map[string]interface{}{}, map[string]interface{}{})
+	assert.Empty(ck)
+	assert.False(ok)
+
+	f.coalescer = newCoalescer()
+	ck, ok = f.coalesceKey(map[string]interface{}{}, map[string]interface{}{"bad": make(chan int)})
+	assert.Empty(ck)
+	assert.False(ok)
+
+	tf, err := NewFactory(
+		Options{Key: key.Descriptor{Kid: "test", Bits: 512}, Coalesce: true, Nonce: true},
+		ClaimBuilders{requestClaimBuilder{}},
+		key.NewRegistry(nil),
+	)
+
+	require.NoError(t, err)
+	assert.Nil(tf.(*factory).coalescer, "tokens with nonces are never coalesced")
+}
+
+func TestCoalesce(t *testing.T) {
+	t.Run("Concurrent", testCoalesceConcurrent)
+	t.Run("Distinct", testCoalesceDistinct)
+	t.Run("Error", testCoalesceError)
+	t.Run("Canceled", testCoalesceCanceled)
+	t.Run("ContextErrorRetry", testCoalesceContextErrorRetry)
+	t.Run("Disabled", testCoalesceDisabled)
+}
@@ -0,0 +1,70 @@
+package token
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/json"
+	"io/ioutil"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+const (
+	// ZipHeader is the JOSE header that names the compression algorithm applied to the payload
+	ZipHeader = "zip"
+
+	// ZipDeflate is the ZipHeader value for a payload compressed with raw DEFLATE, as defined by RFC 1951
+	ZipDeflate = "DEF"
+)
+
+// Deflate compresses a token payload with raw DEFLATE, which is the compression indicated by a zip header of DEF
+func Deflate(payload []byte) ([]byte, error) {
+	var output bytes.Buffer
+	w, err := flate.NewWriter(&output, flate.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(payload); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return output.Bytes(), nil
+}
+
+// Inflate decompresses a token payload that was compressed with Deflate.  Consumers of tokens with a zip header
+// of DEF must verify the signature over the compressed payload, then use this function to recover the claims.
+func Inflate(payload []byte) ([]byte, error) {
+	return ioutil.ReadAll(flate.NewReader(bytes.NewReader(payload)))
+}
+
+// compressedSignedString produces a JWS whose payload is the DEFLATE-compressed JSON claims.  The zip header is
+// added to the given header, and both are serialized as canonical JSON if requested.
+func compressedSignedString(method jwt.SigningMethod, header map[string]interface{}, claims map[string]interface{}, canonical bool, key interface{}) (string, error) {
+	marshal := json.Marshal
+	if canonical {
+		marshal = CanonicalJSON
+	}
+
+	header[ZipHeader] = ZipDeflate
+	h, err := marshal(header)
+	if err != nil {
+		return "", err
+	}
+
+	c, err := marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	compressed, err := Deflate(c)
+	if err != nil {
+		return "", err
+	}
+
+	return signSegments(method, h, compressed, key)
+}
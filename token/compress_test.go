@@ -0,0 +1,136 @@
+package token
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/xmidt-org/themis/key"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeflate(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		payload = []byte(strings.Repeat(`{"capabilities":["x1:issuer:test:.*:all"]}`, 20))
+	)
+
+	compressed, err := Deflate(payload)
+	require.NoError(err)
+	assert.True(len(compressed) < len(payload))
+
+	inflated, err := Inflate(compressed)
+	require.NoError(err)
+	assert.Equal(payload, inflated)
+
+	_, err = Inflate([]byte("this is not deflated"))
+	assert.Error(err)
+}
+
+func testCompressClaimsRoundTrip(t *testing.T, canonical bool) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		registry = key.NewRegistry(nil)
+
+		claims = map[string]interface{}{
+			"sub":          "device",
+			"capabilities": []interface{}{"x1:issuer:test:.*:all", "x1:issuer:ping:.*:get"},
+		}
+	)
+
+	f, err := NewFactory(
+		Options{
+			Key:             key.Descriptor{Kid: "compressed", Bits: 512},
+			CanonicalClaims: canonical,
+			CompressClaims:  true,
+		},
+		ClaimBuilders{requestClaimBuilder{}},
+		registry,
+	)
+
+	require.NoError(err)
+	signed, err := f.NewToken(context.Background(), &Request{Claims: claims, Metadata: map[string]interface{}{}})
+	require.NoError(err)
+
+	segments := strings.Split(signed, ".")
+	require.Len(segments, 3)
+
+	// the signature covers the compressed payload, exactly as it appears in the token
+	require.NoError(
+		jwt.SigningMethodRS256.Verify(
+			strings.Join(segments[:2], "."),
+			segments[2],
+			publishedKey(t, registry, "compressed"),
+		),
+	)
+
+	rawHeader, err := jwt.DecodeSegment(segments[0])
+	require.NoError(err)
+
+	var header map[string]interface{}
+	require.NoError(json.Unmarshal(rawHeader, &header))
+	assert.Equal(ZipDeflate, header[ZipHeader])
+	assert.Equal("compressed", header["kid"])
+	assert.Equal("RS256", header["alg"])
+
+	compressed, err := jwt.DecodeSegment(segments[1])
+	require.NoError(err)
+
+	payload, err := Inflate(compressed)
+	require.NoError(err)
+
+	var actual map[string]interface{}
+	require.NoError(json.Unmarshal(payload, &actual))
+	assert.Equal(claims, actual)
+
+	if canonical {
+		expected, err := CanonicalJSON(claims)
+		require.NoError(err)
+		assert.Equal(expected, payload)
+	}
+}
+
+func testCompressClaimsDisabled(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		registry = key.NewRegistry(nil)
+	)
+
+	f, err := NewFactory(
+		Options{Key: key.Descriptor{Kid: "uncompressed", Bits: 512}},
+		ClaimBuilders{requestClaimBuilder{}},
+		registry,
+	)
+
+	require.NoError(err)
+	signed, err := f.NewToken(context.Background(), &Request{Claims: map[string]interface{}{"sub": "device"}, Metadata: map[string]interface{}{}})
+	require.NoError(err)
+
+	token, err := jwt.Parse(signed, func(*jwt.Token) (interface{}, error) {
+		return publishedKey(t, registry, "uncompressed"), nil
+	})
+
+	require.NoError(err)
+	assert.NotContains(token.Header, ZipHeader)
+	assert.Equal("device", token.Claims.(jwt.MapClaims)["sub"])
+}
+
+func TestCompressClaims(t *testing.T) {
+	t.Run("RoundTrip", func(t *testing.T) {
+		testCompressClaimsRoundTrip(t, false)
+	})
+
+	t.Run("Canonical", func(t *testing.T) {
+		testCompressClaimsRoundTrip(t, true)
+	})
+
+	t.Run("Disabled", testCompressClaimsDisabled)
+}
@@ -0,0 +1,196 @@
+package token
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// strideScale is the stride of a tenant with a weight of 1.  Heavier tenants have proportionally smaller strides.
+const strideScale = 1 << 20
+
+// ConcurrencyTimeoutError is returned when a token request waited longer than the configured QueueTimeout
+// for a signing slot
+type ConcurrencyTimeoutError struct {
+	Tenant string
+}
+
+func (cte ConcurrencyTimeoutError) Error() string {
+	if len(cte.Tenant) > 0 {
+		return fmt.Sprintf("Timed out waiting to sign a token for tenant %s", cte.Tenant)
+	}
+
+	return "Timed out waiting to sign a token"
+}
+
+func (cte ConcurrencyTimeoutError) StatusCode() int {
+	return http.StatusServiceUnavailable
+}
+
+// Concurrency caps the number of tokens a factory signs at once, which protects a slow signing resource such
+// as a KMS.  When requests are waiting for a slot, slots are handed out fairly across tenants in proportion to
+// their weights, so a tenant with a burst of requests cannot starve the others.  Requests from the same tenant
+// are served in the order they arrived.
+type Concurrency struct {
+	// MaxInFlight is the maximum number of tokens signed at once, across all tenants.  A signature abandoned
+	// for exceeding its key's SignTimeout keeps its slot until it actually returns.  If nonpositive, no limit
+	// is enforced.
+	MaxInFlight int
+
+	// Weights is the relative share of signing slots for each tenant under contention.  Tenants that are
+	// not listed, including requests without a tenant, have a weight of 1.
+	Weights map[string]int
+
+	// QueueTimeout is the maximum time a token request waits for a slot.  Requests that time out are
+	// rejected with a 503 status.  If unset, a request waits until a slot is available or it is canceled.
+	QueueTimeout time.Duration
+}
+
+// fairWaiter is a single token request waiting for a slot
+type fairWaiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+// fairSemaphore is a counting semaphore that uses stride scheduling to grant slots across tenants.  Each
+// grant advances the tenant's pass by its stride, and the waiting tenant with the lowest pass is granted
+// next.  A tenant that was idle resumes at the current pass, so it cannot bank credit while not waiting.
+type fairSemaphore struct {
+	lock     sync.Mutex
+	capacity int
+	inFlight int
+	timeout  time.Duration
+
+	weights map[string]int
+	queues  map[string][]*fairWaiter
+	pass    map[string]uint64
+	virtual uint64
+}
+
+func newFairSemaphore(c Concurrency) *fairSemaphore {
+	fs := &fairSemaphore{
+		capacity: c.MaxInFlight,
+		timeout:  c.QueueTimeout,
+		weights:  make(map[string]int, len(c.Weights)),
+		queues:   make(map[string][]*fairWaiter),
+		pass:     make(map[string]uint64),
+	}
+
+	for tenant, w := range c.Weights {
+		fs.weights[strings.ToLower(tenant)] = w
+	}
+
+	return fs
+}
+
+func (fs *fairSemaphore) stride(tenant string) uint64 {
+	if w := fs.weights[tenant]; w > 1 {
+		return strideScale / uint64(w)
+	}
+
+	return strideScale
+}
+
+// grant must be executed under the lock
+func (fs *fairSemaphore) grant(tenant string) {
+	fs.inFlight++
+	fs.pass[tenant] += fs.stride(tenant)
+}
+
+// dispatch hands free slots to waiters.  This method must be executed under the lock.
+func (fs *fairSemaphore) dispatch() {
+	for fs.inFlight < fs.capacity && len(fs.queues) > 0 {
+		var next string
+		first := true
+		for tenant := range fs.queues {
+			if first || fs.pass[tenant] < fs.pass[next] || (fs.pass[tenant] == fs.pass[next] && tenant < next) {
+				next, first = tenant, false
+			}
+		}
+
+		w := fs.queues[next][0]
+		if len(fs.queues[next]) == 1 {
+			delete(fs.queues, next)
+		} else {
+			fs.queues[next] = fs.queues[next][1:]
+		}
+
+		fs.virtual = fs.pass[next]
+		fs.grant(next)
+		w.granted = true
+		close(w.ready)
+	}
+}
+
+// remove abandons a waiter's place in its tenant's queue.  This method must be executed under the lock.
+func (fs *fairSemaphore) remove(tenant string, w *fairWaiter) {
+	queue := fs.queues[tenant]
+	for i, candidate := range queue {
+		if candidate == w {
+			queue = append(queue[:i:i], queue[i+1:]...)
+			break
+		}
+	}
+
+	if len(queue) == 0 {
+		delete(fs.queues, tenant)
+	} else {
+		fs.queues[tenant] = queue
+	}
+}
+
+// acquire waits for a slot on behalf of the given tenant.  Every successful acquire must be followed by a release.
+func (fs *fairSemaphore) acquire(ctx context.Context, tenant string) error {
+	tenant = strings.ToLower(tenant)
+	fs.lock.Lock()
+	if fs.inFlight < fs.capacity && len(fs.queues) == 0 {
+		fs.grant(tenant)
+		fs.lock.Unlock()
+		return nil
+	}
+
+	if _, waiting := fs.queues[tenant]; !waiting && fs.pass[tenant] < fs.virtual {
+		fs.pass[tenant] = fs.virtual
+	}
+
+	w := &fairWaiter{ready: make(chan struct{})}
+	fs.queues[tenant] = append(fs.queues[tenant], w)
+	fs.lock.Unlock()
+
+	var expired <-chan time.Time
+	if fs.timeout > 0 {
+		timer := time.NewTimer(fs.timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	var err error
+	select {
+	case <-w.ready:
+		return nil
+	case <-expired:
+		err = ConcurrencyTimeoutError{Tenant: tenant}
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	if w.granted {
+		// the slot was granted while giving up, so take it rather than leak it
+		return nil
+	}
+
+	fs.remove(tenant, w)
+	return err
+}
+
+func (fs *fairSemaphore) release() {
+	fs.lock.Lock()
+	fs.inFlight--
+	fs.dispatch()
+	fs.lock.Unlock()
+}
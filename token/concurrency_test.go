@@ -0,0 +1,238 @@
+package token
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xmidt-org/themis/key"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// waiting returns the number of queued token requests across all tenants
+func (fs *fairSemaphore) waiting() int {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	var count int
+	for _, queue := range fs.queues {
+		count += len(queue)
+	}
+
+	return count
+}
+
+// contend holds the only slot of a semaphore while the given number of requests for each tenant queue up behind it.
+// The slot is then released, and each request that obtains it reports its tenant before releasing it for the next.
+// The tenants, in the order they were granted the slot, are returned.
+func contend(t *testing.T, c Concurrency, requests map[string]int) []string {
+	require := require.New(t)
+	c.MaxInFlight = 1
+	fs := newFairSemaphore(c)
+	require.NoError(fs.acquire(context.Background(), "holder"))
+
+	var (
+		total   int
+		granted = make(chan string)
+	)
+
+	for tenant, count := range requests {
+		total += count
+		for i := 0; i < count; i++ {
+			go func(tenant string) {
+				if fs.acquire(context.Background(), tenant) == nil {
+					granted <- tenant
+				}
+			}(tenant)
+		}
+	}
+
+	require.Eventually(
+		func() bool { return fs.waiting() == total },
+		time.Second,
+		time.Millisecond,
+	)
+
+	var order []string
+	fs.release()
+	for len(order) < total {
+		select {
+		case tenant := <-granted:
+			order = append(order, tenant)
+			fs.release()
+		case <-time.After(time.Second):
+			require.FailNow("timed out waiting for a grant", "order so far: %v", order)
+		}
+	}
+
+	return order
+}
+
+func testFairSemaphoreNoStarvation(t *testing.T) {
+	order := contend(t, Concurrency{}, map[string]int{"a": 10, "b": 3})
+	require.Len(t, order, 13)
+
+	// the tenant with the burst of requests does not delay the other tenant until it has finished
+	assert.Equal(t, []string{"a", "b", "a", "b", "a", "b"}, order[:6])
+	for _, tenant := range order[6:] {
+		assert.Equal(t, "a", tenant)
+	}
+}
+
+func testFairSemaphoreWeighted(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		order  = contend(t, Concurrency{Weights: map[string]int{"A": 2}}, map[string]int{"a": 12, "b": 12})
+		counts = make(map[string]int)
+	)
+
+	for _, tenant := range order[:12] {
+		counts[tenant]++
+	}
+
+	// under contention, tenant a receives twice the share of tenant b, yet b still makes progress
+	assert.Equal(map[string]int{"a": 8, "b": 4}, counts)
+}
+
+func testFairSemaphoreTimeout(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		fs      = newFairSemaphore(Concurrency{MaxInFlight: 1, QueueTimeout: 10 * time.Millisecond})
+	)
+
+	require.NoError(fs.acquire(context.Background(), "a"))
+
+	err := fs.acquire(context.Background(), "B")
+	assert.Equal(ConcurrencyTimeoutError{Tenant: "b"}, err)
+	assert.Contains(err.Error(), "tenant b")
+	assert.Zero(fs.waiting())
+
+	fs.release()
+	assert.NoError(fs.acquire(context.Background(), "b"))
+}
+
+func testFairSemaphoreCanceled(t *testing.T) {
+	var (
+		assert      = assert.New(t)
+		require     = require.New(t)
+		fs          = newFairSemaphore(Concurrency{MaxInFlight: 1})
+		ctx, cancel = context.WithCancel(context.Background())
+		result      = make(chan error, 1)
+	)
+
+	require.NoError(fs.acquire(context.Background(), ""))
+	go func() {
+		result <- fs.acquire(ctx, "")
+	}()
+
+	require.Eventually(
+		func() bool { return fs.waiting() == 1 },
+		time.Second,
+		time.Millisecond,
+	)
+
+	cancel()
+	assert.Equal(context.Canceled, <-result)
+	assert.Zero(fs.waiting())
+}
+
+func testConcurrencyFactory(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	f, err := NewFactory(
+		Options{
+			Key:         key.Descriptor{Kid: "test", Bits: 512},
+			Concurrency: &Concurrency{MaxInFlight: 2},
+		},
+		ClaimBuilders{requestClaimBuilder{}},
+		key.NewRegistry(nil),
+	)
+
+	require.NoError(err)
+
+	var (
+		wg     sync.WaitGroup
+		tokens = make(chan string, 10)
+	)
+
+	for i := 0; i < cap(tokens); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			signed, err := f.NewToken(context.Background(), NewRequest())
+			assert.NoError(err)
+			tokens <- signed
+		}()
+	}
+
+	wg.Wait()
+	close(tokens)
+	for signed := range tokens {
+		assert.NotEmpty(signed)
+	}
+
+	assert.Zero(f.(*factory).semaphore.inFlight)
+}
+
+// inFlightCount returns the number of slots currently held
+func (fs *fairSemaphore) inFlightCount() int {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	return fs.inFlight
+}
+
+func testConcurrencyAbandonedSign(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		registry = key.NewRegistry(nil)
+		release  = make(chan struct{})
+	)
+
+	tf, err := NewFactory(
+		Options{
+			Key:         key.Descriptor{Kid: "slow", Bits: 512, SignTimeout: 10 * time.Millisecond},
+			Concurrency: &Concurrency{MaxInFlight: 1, QueueTimeout: 10 * time.Millisecond},
+		},
+		ClaimBuilders{requestClaimBuilder{}},
+		registry,
+	)
+
+	require.NoError(err)
+	active, ok := registry.Active()
+	require.True(ok)
+
+	f := tf.(*factory)
+	f.method = slowMethod{SigningMethod: f.method, slow: active.Sign(), release: release}
+
+	_, err = tf.NewToken(context.Background(), NewRequest())
+	assert.Equal(key.SignTimeoutError{Kid: "slow", Timeout: 10 * time.Millisecond}, err)
+
+	// the abandoned signature still holds the only slot
+	assert.Equal(1, f.semaphore.inFlightCount())
+	_, err = tf.NewToken(context.Background(), NewRequest())
+	assert.Equal(ConcurrencyTimeoutError{}, err)
+
+	close(release)
+	require.Eventually(
+		func() bool { return f.semaphore.inFlightCount() == 0 },
+		5*time.Second,
+		10*time.Millisecond,
+	)
+}
+
+func TestConcurrency(t *testing.T) {
+	t.Run("NoStarvation", testFairSemaphoreNoStarvation)
+	t.Run("Weighted", testFairSemaphoreWeighted)
+	t.Run("Timeout", testFairSemaphoreTimeout)
+	t.Run("Canceled", testFairSemaphoreCanceled)
+	t.Run("Factory", testConcurrencyFactory)
+	t.Run("AbandonedSign", testConcurrencyAbandonedSign)
+}
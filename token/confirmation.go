@@ -0,0 +1,293 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/xmidt-org/themis/xhttp/xhttpserver"
+
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+const (
+	// DefaultConfirmationClaim is the name of the RFC 7800 confirmation claim when none is configured
+	DefaultConfirmationClaim = "cnf"
+
+	// CertificateThumbprintConfirmation is the confirmation method member holding the SHA-256 thumbprint of
+	// an X.509 certificate, as defined by RFC 8705
+	CertificateThumbprintConfirmation = "x5t#S256"
+
+	// JWKThumbprintConfirmation is the confirmation method member holding the RFC 7638 SHA-256 thumbprint of
+	// a JWK submitted by the client
+	JWKThumbprintConfirmation = "jkt"
+
+	// DefaultMinConfirmationRSABits is the smallest RSA modulus accepted for a submitted key when none is configured
+	DefaultMinConfirmationRSABits = 2048
+)
+
+var (
+	ErrConfirmationKeyNotObject  = errors.New("A confirmation key must be a JWK object")
+	ErrConfirmationKeyType       = errors.New("A confirmation key must be an RSA or EC public key")
+	ErrConfirmationKeyPrivate    = errors.New("A confirmation key must not contain private key material")
+	ErrConfirmationKeyNotOnCurve = errors.New("A confirmation key is not a point on its curve")
+	ErrConfirmationKeyExponent   = errors.New("A confirmation key has an invalid RSA public exponent")
+)
+
+// MissingClientCertificateError is returned when a token request must be bound to a client certificate,
+// but the client did not present one over mutual TLS
+type MissingClientCertificateError struct{}
+
+func (mcce MissingClientCertificateError) Error() string {
+	return "A client certificate is required"
+}
+
+func (mcce MissingClientCertificateError) StatusCode() int {
+	return http.StatusUnauthorized
+}
+
+// InvalidConfirmationKeyError is returned when the public key submitted with a token request is malformed or too weak
+type InvalidConfirmationKeyError struct {
+	Err error
+}
+
+func (icke InvalidConfirmationKeyError) Error() string {
+	return fmt.Sprintf("Invalid confirmation key: %s", icke.Err)
+}
+
+func (icke InvalidConfirmationKeyError) Unwrap() error {
+	return icke.Err
+}
+
+func (icke InvalidConfirmationKeyError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// WeakConfirmationKeyError indicates that a submitted RSA key is smaller than the configured minimum
+type WeakConfirmationKeyError struct {
+	Bits    int
+	MinBits int
+}
+
+func (wcke WeakConfirmationKeyError) Error() string {
+	return fmt.Sprintf("RSA key of %d bits is smaller than the minimum of %d bits", wcke.Bits, wcke.MinBits)
+}
+
+// Confirmation describes how to bind tokens to a key the client can prove possession of.  By default, tokens
+// are bound to the client certificate presented over mutual TLS.  The confirmation claim is an object whose
+// x5t#S256 member is the base64url-encoded SHA-256 thumbprint of the DER-encoded certificate, so that resource
+// servers can require the same certificate.  See RFC 8705.
+//
+// If JWK is set, tokens are instead bound to a public key submitted in the request body, and the confirmation
+// claim's jkt member is the RFC 7638 thumbprint of that key.
+type Confirmation struct {
+	// Claim is the name of the claim key for the confirmation.  If unset, DefaultConfirmationClaim is used.
+	Claim string
+
+	// Required indicates that token requests must present a client certificate, or submit a key if JWK is set.
+	// By default, a token request without one is issued a token without a confirmation claim.
+	Required bool
+
+	// JWK is the optional JSONPath-like expression, as used by Value.Body, that selects a public JWK from a JSON
+	// request body, e.g. $.jwk.  Only RSA and EC public keys are accepted.  Symmetric keys, keys that include
+	// private material, EC points that are not on their curve, and RSA keys smaller than MinRSABits are
+	// rejected with a 400 status.
+	JWK string
+
+	// MinRSABits is the smallest RSA modulus accepted for a submitted key.  If unset, DefaultMinConfirmationRSABits is used.
+	MinRSABits int
+}
+
+type confirmationRequestBuilder struct {
+	claim      string
+	required   bool
+	thumbprint func([]byte) string
+}
+
+// certificateThumbprint computes the x5t#S256 value for a DER-encoded certificate
+func certificateThumbprint(raw []byte) string {
+	sum := sha256.Sum256(raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// peerIdentity is the thumbprint of a connection's client certificate, together with the
+// certificate it was computed from
+type peerIdentity struct {
+	leaf       *x509.Certificate
+	thumbprint string
+}
+
+type peerIdentityKey struct{}
+
+// peerThumbprint returns the thumbprint of a request's client certificate.  If the server caches connection
+// values, the thumbprint is computed once per connection and reused until the connection presents a different
+// certificate, e.g. after a renegotiation.
+func (crb confirmationRequestBuilder) peerThumbprint(original *http.Request) string {
+	leaf := original.TLS.PeerCertificates[0]
+	cc, ok := xhttpserver.GetConnCache(original.Context())
+	if ok {
+		if v, ok := cc.Get(peerIdentityKey{}); ok {
+			if pi := v.(peerIdentity); pi.leaf == leaf {
+				return pi.thumbprint
+			}
+		}
+	}
+
+	pi := peerIdentity{leaf: leaf, thumbprint: crb.thumbprint(leaf.Raw)}
+	if ok {
+		cc.Set(peerIdentityKey{}, pi)
+	}
+
+	return pi.thumbprint
+}
+
+func (crb confirmationRequestBuilder) Build(original *http.Request, tr *Request) error {
+	if original.TLS == nil || len(original.TLS.PeerCertificates) == 0 {
+		if crb.required {
+			return MissingClientCertificateError{}
+		}
+
+		return nil
+	}
+
+	tr.Claims[crb.claim] = map[string]interface{}{
+		CertificateThumbprintConfirmation: crb.peerThumbprint(original),
+	}
+
+	return nil
+}
+
+type jwkConfirmationRequestBuilder struct {
+	claim      string
+	required   bool
+	expr       string
+	path       jsonPath
+	minRSABits int
+}
+
+// jwkThumbprint validates a submitted public key and computes its RFC 7638 thumbprint
+func (jcrb jwkConfirmationRequestBuilder) jwkThumbprint(v interface{}) (string, error) {
+	if _, ok := v.(map[string]interface{}); !ok {
+		return "", ErrConfirmationKeyNotObject
+	}
+
+	// the key is parsed from a copy, since parsing consumes the members of the decoded object
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	set, err := jwk.ParseBytes(data)
+	if err != nil {
+		return "", err
+	}
+
+	if len(set.Keys) != 1 {
+		return "", ErrConfirmationKeyNotObject
+	}
+
+	k := set.Keys[0]
+	switch k.(type) {
+	case *jwk.RSAPrivateKey, *jwk.ECDSAPrivateKey:
+		return "", ErrConfirmationKeyPrivate
+	}
+
+	public, err := k.Materialize()
+	if err != nil {
+		return "", err
+	}
+
+	switch p := public.(type) {
+	case *rsa.PublicKey:
+		if p.E < 3 || p.E%2 == 0 {
+			return "", ErrConfirmationKeyExponent
+		}
+
+		if bits := p.N.BitLen(); bits < jcrb.minRSABits {
+			return "", WeakConfirmationKeyError{Bits: bits, MinBits: jcrb.minRSABits}
+		}
+
+	case *ecdsa.PublicKey:
+		if !p.Curve.IsOnCurve(p.X, p.Y) {
+			return "", ErrConfirmationKeyNotOnCurve
+		}
+
+	default:
+		return "", ErrConfirmationKeyType
+	}
+
+	thumbprint, err := k.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(thumbprint), nil
+}
+
+func (jcrb jwkConfirmationRequestBuilder) Build(original *http.Request, tr *Request) error {
+	body, err := requestBody(original)
+	if err != nil {
+		return err
+	}
+
+	submitted, ok := jcrb.path.evaluate(body)
+	if !ok || submitted == nil {
+		if jcrb.required {
+			return MissingBodyValueError{Path: jcrb.expr}
+		}
+
+		return nil
+	}
+
+	thumbprint, err := jcrb.jwkThumbprint(submitted)
+	if err != nil {
+		return InvalidConfirmationKeyError{Err: err}
+	}
+
+	tr.Claims[jcrb.claim] = map[string]interface{}{
+		JWKThumbprintConfirmation: thumbprint,
+	}
+
+	return nil
+}
+
+func newConfirmationRequestBuilder(c Confirmation) (RequestBuilder, error) {
+	claim := c.Claim
+	if len(claim) == 0 {
+		claim = DefaultConfirmationClaim
+	}
+
+	if len(c.JWK) == 0 {
+		return confirmationRequestBuilder{
+			claim:      claim,
+			required:   c.Required,
+			thumbprint: certificateThumbprint,
+		}, nil
+	}
+
+	path, err := parseJSONPath(c.JWK)
+	if err != nil {
+		return nil, err
+	}
+
+	jcrb := jwkConfirmationRequestBuilder{
+		claim:      claim,
+		required:   c.Required,
+		expr:       c.JWK,
+		path:       path,
+		minRSABits: c.MinRSABits,
+	}
+
+	if jcrb.minRSABits <= 0 {
+		jcrb.minRSABits = DefaultMinConfirmationRSABits
+	}
+
+	return jcrb, nil
+}
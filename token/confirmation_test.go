@@ -0,0 +1,416 @@
+package token
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xmidt-org/themis/key"
+	"github.com/xmidt-org/themis/xhttp/xhttpserver"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClientCertificate(t *testing.T) *x509.Certificate {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "device"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+func testConfirmationThumbprint(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		cert     = newTestClientCertificate(t)
+		sum      = sha256.Sum256(cert.Raw)
+		expected = base64.RawURLEncoding.EncodeToString(sum[:])
+		registry = key.NewRegistry(rand.Reader)
+
+		o = Options{
+			Key:          key.Descriptor{Kid: "test", Bits: 512},
+			Confirmation: &Confirmation{Required: true},
+		}
+	)
+
+	rb, err := NewRequestBuilders(o)
+	require.NoError(err)
+
+	factory, err := NewFactory(o, ClaimBuilders{requestClaimBuilder{}}, registry)
+	require.NoError(err)
+
+	original := httptest.NewRequest("GET", "/", nil)
+	original.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	tr, err := BuildRequest(original, rb)
+	require.NoError(err)
+
+	signed, err := factory.NewToken(context.Background(), tr)
+	require.NoError(err)
+
+	pair, ok := registry.Get("test")
+	require.True(ok)
+	parsed, err := jwt.Parse(signed, func(*jwt.Token) (interface{}, error) {
+		return &pair.Sign().(*rsa.PrivateKey).PublicKey, nil
+	})
+
+	require.NoError(err)
+	assert.Equal(
+		map[string]interface{}{"x5t#S256": expected},
+		parsed.Claims.(jwt.MapClaims)["cnf"],
+	)
+}
+
+// countingThumbprint replaces a confirmation builder's thumbprint function with one that counts its invocations
+func countingThumbprint(t *testing.T, rb RequestBuilder) (RequestBuilder, *int32) {
+	crb, ok := rb.(confirmationRequestBuilder)
+	require.True(t, ok)
+
+	var calls int32
+	crb.thumbprint = func(raw []byte) string {
+		atomic.AddInt32(&calls, 1)
+		return certificateThumbprint(raw)
+	}
+
+	return crb, &calls
+}
+
+func testConfirmationConnectionCache(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	rb, err := newConfirmationRequestBuilder(Confirmation{Required: true})
+	require.NoError(err)
+	rb, calls := countingThumbprint(t, rb)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		tr, err := BuildRequest(request, RequestBuilders{rb})
+		if err != nil {
+			response.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		response.Write([]byte(tr.Claims[DefaultConfirmationClaim].(map[string]interface{})[CertificateThumbprintConfirmation].(string)))
+	}))
+
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.Config.ConnContext = xhttpserver.NewConnContext
+	server.StartTLS()
+	defer server.Close()
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "device"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+	require.NoError(err)
+
+	var (
+		client    = server.Client()
+		transport = client.Transport.(*http.Transport)
+		sum       = sha256.Sum256(der)
+		expected  = base64.RawURLEncoding.EncodeToString(sum[:])
+	)
+
+	transport.TLSClientConfig.Certificates = []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: priv}}
+	get := func() {
+		response, err := client.Get(server.URL)
+		require.NoError(err)
+		defer response.Body.Close()
+
+		body, err := ioutil.ReadAll(response.Body)
+		require.NoError(err)
+		assert.Equal(http.StatusOK, response.StatusCode)
+		assert.Equal(expected, string(body))
+	}
+
+	// every request over the same kept-alive connection reuses the thumbprint
+	for i := 0; i < 3; i++ {
+		get()
+	}
+
+	assert.Equal(int32(1), atomic.LoadInt32(calls))
+
+	// a new connection computes it anew
+	transport.CloseIdleConnections()
+	get()
+	assert.Equal(int32(2), atomic.LoadInt32(calls))
+}
+
+func testConfirmationConnectionCacheRenegotiated(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		first  = newTestClientCertificate(t)
+		second = newTestClientCertificate(t)
+		ctx    = xhttpserver.NewConnContext(context.Background(), nil)
+	)
+
+	rb, err := newConfirmationRequestBuilder(Confirmation{})
+	require.NoError(err)
+	rb, calls := countingThumbprint(t, rb)
+
+	build := func(cert *x509.Certificate) interface{} {
+		original := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+		original.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+		tr, err := BuildRequest(original, RequestBuilders{rb})
+		require.NoError(err)
+		return tr.Claims[DefaultConfirmationClaim]
+	}
+
+	build(first)
+	assert.Equal(map[string]interface{}{CertificateThumbprintConfirmation: certificateThumbprint(first.Raw)}, build(first))
+	assert.Equal(int32(1), atomic.LoadInt32(calls))
+
+	// once the connection presents a different certificate, the cached thumbprint is replaced
+	assert.Equal(map[string]interface{}{CertificateThumbprintConfirmation: certificateThumbprint(second.Raw)}, build(second))
+	assert.Equal(map[string]interface{}{CertificateThumbprintConfirmation: certificateThumbprint(second.Raw)}, build(second))
+	assert.Equal(int32(2), atomic.LoadInt32(calls))
+
+	// without a connection cache, the thumbprint is computed for each request
+	original := httptest.NewRequest("GET", "/", nil)
+	original.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{first}}
+	_, err = BuildRequest(original, RequestBuilders{rb})
+	require.NoError(err)
+	_, err = BuildRequest(original, RequestBuilders{rb})
+	require.NoError(err)
+	assert.Equal(int32(4), atomic.LoadInt32(calls))
+}
+
+func testConfirmationCustomClaim(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		cert    = newTestClientCertificate(t)
+	)
+
+	rb, err := NewRequestBuilders(Options{Confirmation: &Confirmation{Claim: "binding"}})
+	require.NoError(err)
+
+	original := httptest.NewRequest("GET", "/", nil)
+	original.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	tr, err := BuildRequest(original, rb)
+	require.NoError(err)
+	assert.Equal(
+		map[string]interface{}{CertificateThumbprintConfirmation: certificateThumbprint(cert.Raw)},
+		tr.Claims["binding"],
+	)
+
+	assert.NotContains(tr.Claims, DefaultConfirmationClaim)
+}
+
+func testConfirmationMissing(t *testing.T) {
+	testData := []struct {
+		name  string
+		state *tls.ConnectionState
+	}{
+		{"NoTLS", nil},
+		{"NoPeerCertificates", &tls.ConnectionState{}},
+	}
+
+	for _, record := range testData {
+		t.Run(record.name, func(t *testing.T) {
+			t.Run("Optional", func(t *testing.T) {
+				rb, err := NewRequestBuilders(Options{Confirmation: &Confirmation{}})
+				require.NoError(t, err)
+
+				original := httptest.NewRequest("GET", "/", nil)
+				original.TLS = record.state
+				tr, err := BuildRequest(original, rb)
+				require.NoError(t, err)
+				assert.Empty(t, tr.Claims)
+			})
+
+			t.Run("Required", func(t *testing.T) {
+				rb, err := NewRequestBuilders(Options{Confirmation: &Confirmation{Required: true}})
+				require.NoError(t, err)
+
+				original := httptest.NewRequest("GET", "/", nil)
+				original.TLS = record.state
+				tr, err := BuildRequest(original, rb)
+				assert.Nil(t, tr)
+				assert.True(t, errors.As(err, new(MissingClientCertificateError)))
+				assert.Equal(t, http.StatusUnauthorized, err.(BuildError).StatusCode())
+			})
+		})
+	}
+}
+
+// newTestJWKBody produces a JSON request body with the JWK form of the given key in its jwk field
+func newTestJWKBody(t *testing.T, k interface{}) string {
+	jwkKey, err := jwk.New(k)
+	require.NoError(t, err)
+
+	data, err := json.Marshal(map[string]interface{}{"jwk": jwkKey})
+	require.NoError(t, err)
+	return string(data)
+}
+
+func testConfirmationJWK(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		registry = key.NewRegistry(rand.Reader)
+
+		o = Options{
+			Key:          key.Descriptor{Kid: "test", Bits: 512},
+			Confirmation: &Confirmation{JWK: "$.jwk", Required: true},
+		}
+	)
+
+	submitted, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(err)
+
+	jwkKey, err := jwk.New(&submitted.PublicKey)
+	require.NoError(err)
+	thumbprint, err := jwkKey.Thumbprint(crypto.SHA256)
+	require.NoError(err)
+
+	rb, err := NewRequestBuilders(o)
+	require.NoError(err)
+
+	factory, err := NewFactory(o, ClaimBuilders{requestClaimBuilder{}}, registry)
+	require.NoError(err)
+
+	original := httptest.NewRequest("POST", "/", strings.NewReader(newTestJWKBody(t, &submitted.PublicKey)))
+	tr, err := BuildRequest(original, rb)
+	require.NoError(err)
+
+	signed, err := factory.NewToken(context.Background(), tr)
+	require.NoError(err)
+
+	pair, ok := registry.Get("test")
+	require.True(ok)
+	parsed, err := jwt.Parse(signed, func(*jwt.Token) (interface{}, error) {
+		return &pair.Sign().(*rsa.PrivateKey).PublicKey, nil
+	})
+
+	require.NoError(err)
+	assert.Equal(
+		map[string]interface{}{"jkt": base64.RawURLEncoding.EncodeToString(thumbprint)},
+		parsed.Claims.(jwt.MapClaims)["cnf"],
+	)
+}
+
+func testConfirmationJWKRejected(t *testing.T) {
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	strong, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	ec, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	testData := []struct {
+		name     string
+		body     string
+		expected error
+	}{
+		{"WeakRSA", newTestJWKBody(t, &weak.PublicKey), WeakConfirmationKeyError{Bits: 1024, MinBits: DefaultMinConfirmationRSABits}},
+		{"PrivateRSA", newTestJWKBody(t, strong), ErrConfirmationKeyPrivate},
+		{"PrivateEC", newTestJWKBody(t, ec), ErrConfirmationKeyPrivate},
+		{"Symmetric", newTestJWKBody(t, []byte("this is a shared secret")), ErrConfirmationKeyType},
+		{"NotOnCurve", `{"jwk": {"kty": "EC", "crv": "P-256", "x": "AQ", "y": "AQ"}}`, ErrConfirmationKeyNotOnCurve},
+		{"NotObject", `{"jwk": "not a key"}`, ErrConfirmationKeyNotObject},
+		{"Malformed", `{"jwk": {"kty": "RSA"}}`, nil},
+	}
+
+	rb, err := NewRequestBuilders(Options{Confirmation: &Confirmation{JWK: "$.jwk"}})
+	require.NoError(t, err)
+
+	for _, record := range testData {
+		t.Run(record.name, func(t *testing.T) {
+			assert := assert.New(t)
+			tr, err := BuildRequest(httptest.NewRequest("POST", "/", strings.NewReader(record.body)), rb)
+			assert.Nil(tr)
+
+			var icke InvalidConfirmationKeyError
+			if assert.True(errors.As(err, &icke)) && record.expected != nil {
+				assert.Equal(record.expected, icke.Err)
+			}
+
+			assert.Equal(http.StatusBadRequest, err.(BuildError).StatusCode())
+		})
+	}
+}
+
+func testConfirmationJWKMissing(t *testing.T) {
+	t.Run("Optional", func(t *testing.T) {
+		rb, err := NewRequestBuilders(Options{Confirmation: &Confirmation{JWK: "$.jwk"}})
+		require.NoError(t, err)
+
+		tr, err := BuildRequest(httptest.NewRequest("POST", "/", strings.NewReader(`{}`)), rb)
+		require.NoError(t, err)
+		assert.Empty(t, tr.Claims)
+	})
+
+	t.Run("Required", func(t *testing.T) {
+		rb, err := NewRequestBuilders(Options{Confirmation: &Confirmation{JWK: "$.jwk", Required: true}})
+		require.NoError(t, err)
+
+		tr, err := BuildRequest(httptest.NewRequest("POST", "/", strings.NewReader(`{}`)), rb)
+		assert.Nil(t, tr)
+		assert.True(t, errors.As(err, new(MissingBodyValueError)))
+	})
+}
+
+func testConfirmationJWKInvalidPath(t *testing.T) {
+	rb, err := NewRequestBuilders(Options{Confirmation: &Confirmation{JWK: "$.["}})
+	assert.Nil(t, rb)
+	assert.Equal(t, InvalidJSONPathError{Path: "$.["}, err)
+}
+
+func TestConfirmation(t *testing.T) {
+	t.Run("Thumbprint", testConfirmationThumbprint)
+	t.Run("ConnectionCache", testConfirmationConnectionCache)
+	t.Run("ConnectionCacheRenegotiated", testConfirmationConnectionCacheRenegotiated)
+	t.Run("CustomClaim", testConfirmationCustomClaim)
+	t.Run("Missing", testConfirmationMissing)
+	t.Run("JWK", testConfirmationJWK)
+	t.Run("JWKRejected", testConfirmationJWKRejected)
+	t.Run("JWKMissing", testConfirmationJWKMissing)
+	t.Run("JWKInvalidPath", testConfirmationJWKInvalidPath)
+}
@@ -0,0 +1,168 @@
+package token
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// FormContentType is the media type of form-encoded request bodies
+	FormContentType = "application/x-www-form-urlencoded"
+
+	// JSONContentType is the media type of JSON request bodies
+	JSONContentType = "application/json"
+)
+
+// UnsupportedBodyError is returned when a request body has a media type for which no BodyDecoder is registered
+type UnsupportedBodyError struct {
+	ContentType string
+}
+
+func (ube UnsupportedBodyError) Error() string {
+	return fmt.Sprintf("No decoder for request body of type '%s'", ube.ContentType)
+}
+
+func (ube UnsupportedBodyError) StatusCode() int {
+	return http.StatusUnsupportedMediaType
+}
+
+// BodyDecoder decodes a request body of a particular media type into its top-level fields.  Field values
+// must be types that encoding/json can marshal.
+type BodyDecoder func([]byte) (map[string]interface{}, error)
+
+// DecodeJSONBody is the BodyDecoder for JSON object bodies.  Numbers are decoded as json.Number.
+func DecodeJSONBody(data []byte) (map[string]interface{}, error) {
+	var (
+		fields  map[string]interface{}
+		decoder = json.NewDecoder(bytes.NewReader(data))
+	)
+
+	decoder.UseNumber()
+	if err := decoder.Decode(&fields); err != nil {
+		return nil, err
+	} else if fields == nil {
+		return nil, ErrBodyNotObject
+	}
+
+	return fields, nil
+}
+
+// DecodeFormBody is the BodyDecoder for form-encoded bodies.  A field with a single value decodes as a string,
+// while a repeated field decodes as an array of strings.
+func DecodeFormBody(data []byte) (map[string]interface{}, error) {
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]interface{}, len(values))
+	for name, v := range values {
+		if len(v) == 1 {
+			fields[name] = v[0]
+			continue
+		}
+
+		array := make([]interface{}, len(v))
+		for i := range v {
+			array[i] = v[i]
+		}
+
+		fields[name] = array
+	}
+
+	return fields, nil
+}
+
+// BodyDecoders is a registry of BodyDecoder strategies keyed by media type.  Applications can register
+// additional formats, such as msgpack, alongside the defaults.
+type BodyDecoders map[string]BodyDecoder
+
+// DefaultBodyDecoders returns a new registry holding the JSON and form-encoded decoders
+func DefaultBodyDecoders() BodyDecoders {
+	return BodyDecoders{
+		JSONContentType: DecodeJSONBody,
+		FormContentType: DecodeFormBody,
+	}
+}
+
+// merge returns a copy of the defaults overlaid with these decoders.  Media types are matched case insensitively.
+func (bd BodyDecoders) merge() BodyDecoders {
+	merged := DefaultBodyDecoders()
+	for mediaType, d := range bd {
+		merged[strings.ToLower(mediaType)] = d
+	}
+
+	return merged
+}
+
+// ParseContent returns a RequestParser that decodes the body with the decoder, merged with the defaults, registered
+// for its Content-Type.  As with ParseJSON, each top-level field is merged into the URL query, with non-string fields
+// using their JSON text.  The body is then replaced with the JSON encoding of its fields, so that body path claims
+// select from the same fields regardless of the original format.  An empty body is permitted.
+func ParseContent(bd BodyDecoders) RequestParser {
+	decoders := bd.merge()
+	return func(request *http.Request) error {
+		if err := ParseQuery(request); err != nil {
+			return err
+		}
+
+		if request.Body == nil {
+			return nil
+		}
+
+		data, err := ioutil.ReadAll(request.Body)
+		request.Body.Close()
+		request.Body = ioutil.NopCloser(bytes.NewReader(data))
+		if err != nil {
+			return InvalidBodyError{Err: err}
+		}
+
+		if len(bytes.TrimSpace(data)) == 0 {
+			return nil
+		}
+
+		contentType := request.Header.Get("Content-Type")
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			return UnsupportedBodyError{ContentType: contentType}
+		}
+
+		decoder, ok := decoders[mediaType]
+		if !ok {
+			return UnsupportedBodyError{ContentType: mediaType}
+		}
+
+		fields, err := decoder(data)
+		if err != nil {
+			return InvalidBodyError{Err: err}
+		}
+
+		for name, v := range fields {
+			if s, ok := v.(string); ok {
+				request.Form.Add(name, s)
+				continue
+			}
+
+			text, err := json.Marshal(v)
+			if err != nil {
+				return InvalidBodyError{Err: err}
+			}
+
+			request.Form.Add(name, parameterValue(text))
+		}
+
+		normalized, err := json.Marshal(fields)
+		if err != nil {
+			return InvalidBodyError{Err: err}
+		}
+
+		request.Body = ioutil.NopCloser(bytes.NewReader(normalized))
+		return nil
+	}
+}
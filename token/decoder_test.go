@@ -0,0 +1,132 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestContentDecoder(t *testing.T, bd BodyDecoders) func(context.Context, *http.Request) (interface{}, error) {
+	rb, err := NewRequestBuilders(Options{
+		Claims: map[string]Value{
+			"mac":    Value{Parameter: "mac"},
+			"serial": Value{Body: "$.serial"},
+			"roles":  Value{Body: "$.roles"},
+		},
+	})
+
+	require.NoError(t, err)
+	return DecodeServerRequestWith(ParseContent(bd), rb)
+}
+
+func testParseContentSameClaims(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		decode  = newTestContentDecoder(t, nil)
+
+		bodies = map[string]string{
+			JSONContentType:                     `{"mac": "112233445566", "serial": "abc", "roles": ["a", "b"]}`,
+			FormContentType:                     "mac=112233445566&serial=abc&roles=a&roles=b",
+			FormContentType + "; charset=utf-8": "mac=112233445566&serial=abc&roles=a&roles=b",
+		}
+
+		expected = map[string]interface{}{
+			"mac":    "112233445566",
+			"serial": "abc",
+			"roles":  []interface{}{"a", "b"},
+		}
+	)
+
+	for contentType, body := range bodies {
+		request := httptest.NewRequest("POST", "/issue", strings.NewReader(body))
+		request.Header.Set("Content-Type", contentType)
+
+		tr, err := decode(context.Background(), request)
+		require.NoError(err, contentType)
+		assert.Equal(expected, tr.(*Request).Claims, contentType)
+	}
+}
+
+func testParseContentCustomDecoder(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		// a stand-in for a binary format such as msgpack
+		decode = newTestContentDecoder(t, BodyDecoders{
+			"Application/X-Pairs": func(data []byte) (map[string]interface{}, error) {
+				fields := make(map[string]interface{})
+				for _, pair := range strings.Fields(string(data)) {
+					kv := strings.SplitN(pair, ":", 2)
+					fields[kv[0]] = kv[1]
+				}
+
+				return fields, nil
+			},
+		})
+
+		request = httptest.NewRequest("POST", "/issue", strings.NewReader("mac:112233445566 serial:abc"))
+	)
+
+	request.Header.Set("Content-Type", "application/x-pairs")
+	tr, err := decode(context.Background(), request)
+	require.NoError(err)
+	assert.Equal(map[string]interface{}{"mac": "112233445566", "serial": "abc"}, tr.(*Request).Claims)
+}
+
+func testParseContentUnsupported(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		decode  = newTestContentDecoder(t, nil)
+		request = httptest.NewRequest("POST", "/issue", strings.NewReader("<serial>abc</serial>"))
+	)
+
+	request.Header.Set("Content-Type", "application/xml")
+	_, err := decode(context.Background(), request)
+
+	var ube UnsupportedBodyError
+	require.True(t, errors.As(err, &ube))
+	assert.Equal("application/xml", ube.ContentType)
+	assert.Equal(http.StatusUnsupportedMediaType, ube.StatusCode())
+}
+
+func testParseContentInvalid(t *testing.T) {
+	var (
+		decode  = newTestContentDecoder(t, nil)
+		request = httptest.NewRequest("POST", "/issue", strings.NewReader(`["not", "an", "object"]`))
+	)
+
+	request.Header.Set("Content-Type", JSONContentType)
+	_, err := decode(context.Background(), request)
+
+	var ibe InvalidBodyError
+	assert.True(t, errors.As(err, &ibe))
+}
+
+func testParseContentEmpty(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		decode  = newTestContentDecoder(t, nil)
+		request = httptest.NewRequest("POST", "/issue?mac=112233445566", nil)
+	)
+
+	tr, err := decode(context.Background(), request)
+	require.NoError(err)
+	assert.Equal(map[string]interface{}{"mac": "112233445566"}, tr.(*Request).Claims)
+}
+
+func TestParseContent(t *testing.T) {
+	t.Run("SameClaims", testParseContentSameClaims)
+	t.Run("CustomDecoder", testParseContentCustomDecoder)
+	t.Run("Unsupported", testParseContentUnsupported)
+	t.Run("Invalid", testParseContentInvalid)
+	t.Run("Empty", testParseContentEmpty)
+}
@@ -0,0 +1,140 @@
+package token
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"math/big"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+var (
+	ErrDeterministicRequiresECDSA = errors.New("Deterministic signatures require an ECDSA signing algorithm")
+)
+
+// deterministicECDSA is a jwt.SigningMethod that signs with nonces derived from the private key and the
+// message per RFC 6979, rather than from a source of randomness.  Identical input therefore always produces
+// identical signatures.  The signatures are ordinary ECDSA signatures, so verification is unchanged.
+type deterministicECDSA struct {
+	*jwt.SigningMethodECDSA
+}
+
+func (d deterministicECDSA) Sign(signingString string, key interface{}) (string, error) {
+	priv, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+
+	if !d.Hash.Available() {
+		return "", jwt.ErrHashUnavailable
+	}
+
+	if priv.Curve.Params().BitSize != d.CurveBits {
+		return "", jwt.ErrInvalidKey
+	}
+
+	hasher := d.Hash.New()
+	hasher.Write([]byte(signingString))
+	r, s := signRFC6979(priv, d.Hash, hasher.Sum(nil))
+
+	keyBytes := (d.CurveBits + 7) / 8
+	out := make([]byte, 2*keyBytes)
+	r.FillBytes(out[:keyBytes])
+	s.FillBytes(out[keyBytes:])
+	return jwt.EncodeSegment(out), nil
+}
+
+// newDeterministicMethod wraps an ECDSA signing method so that it signs deterministically
+func newDeterministicMethod(m jwt.SigningMethod) (jwt.SigningMethod, error) {
+	ecdsaMethod, ok := m.(*jwt.SigningMethodECDSA)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrDeterministicRequiresECDSA, m.Alg())
+	}
+
+	return deterministicECDSA{SigningMethodECDSA: ecdsaMethod}, nil
+}
+
+// bits2int converts a bit string into an integer of at most qlen bits, as defined by RFC 6979 section 2.3.2
+func bits2int(b []byte, qlen int) *big.Int {
+	x := new(big.Int).SetBytes(b)
+	if blen := len(b) * 8; blen > qlen {
+		x.Rsh(x, uint(blen-qlen))
+	}
+
+	return x
+}
+
+// int2octets converts an integer into a fixed length octet string, as defined by RFC 6979 section 2.3.3
+func int2octets(x *big.Int, rolen int) []byte {
+	return x.FillBytes(make([]byte, rolen))
+}
+
+// bits2octets converts a hash into an octet string reduced modulo q, as defined by RFC 6979 section 2.3.4
+func bits2octets(b []byte, q *big.Int, qlen, rolen int) []byte {
+	z := bits2int(b, qlen)
+	if z.Cmp(q) >= 0 {
+		z.Sub(z, q)
+	}
+
+	return int2octets(z, rolen)
+}
+
+func hmacSum(h crypto.Hash, key []byte, data ...[]byte) []byte {
+	mac := hmac.New(h.New, key)
+	for _, d := range data {
+		mac.Write(d)
+	}
+
+	return mac.Sum(nil)
+}
+
+// signRFC6979 produces an ECDSA signature using the nonce generation of RFC 6979 section 3.2
+func signRFC6979(priv *ecdsa.PrivateKey, h crypto.Hash, digest []byte) (*big.Int, *big.Int) {
+	var (
+		curve = priv.Curve
+		q     = curve.Params().N
+		qlen  = q.BitLen()
+		rolen = (qlen + 7) / 8
+		x     = int2octets(priv.D, rolen)
+		z     = bits2octets(digest, q, qlen, rolen)
+		e     = bits2int(digest, qlen)
+
+		v = bytes.Repeat([]byte{0x01}, h.Size())
+		k = make([]byte, h.Size())
+	)
+
+	k = hmacSum(h, k, v, []byte{0x00}, x, z)
+	v = hmacSum(h, k, v)
+	k = hmacSum(h, k, v, []byte{0x01}, x, z)
+	v = hmacSum(h, k, v)
+
+	for {
+		var t []byte
+		for len(t)*8 < qlen {
+			v = hmacSum(h, k, v)
+			t = append(t, v...)
+		}
+
+		nonce := bits2int(t, qlen)
+		if nonce.Sign() > 0 && nonce.Cmp(q) < 0 {
+			rx, _ := curve.ScalarBaseMult(int2octets(nonce, rolen))
+			r := new(big.Int).Mod(rx, q)
+			if r.Sign() > 0 {
+				s := new(big.Int).Mul(r, priv.D)
+				s.Add(s, e)
+				s.Mul(s, new(big.Int).ModInverse(nonce, q))
+				s.Mod(s, q)
+				if s.Sign() > 0 {
+					return r, s
+				}
+			}
+		}
+
+		k = hmacSum(h, k, v, []byte{0x00})
+		v = hmacSum(h, k, v)
+	}
+}
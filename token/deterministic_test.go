@@ -0,0 +1,146 @@
+package token
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+	"strconv"
+	"testing"
+
+	"github.com/xmidt-org/themis/key"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func hexInt(t *testing.T, v string) *big.Int {
+	i, ok := new(big.Int).SetString(v, 16)
+	require.True(t, ok)
+	return i
+}
+
+// TestSignRFC6979 uses the P-256, SHA-256 test vector for the message "sample" from RFC 6979 appendix A.2.5
+func TestSignRFC6979(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		priv   = &ecdsa.PrivateKey{D: hexInt(t, "C9AFA9D845BA75166B5C215767B1D6934E50C3DB36E89B127B8A622B120F6721")}
+		digest = sha256.Sum256([]byte("sample"))
+	)
+
+	priv.Curve = elliptic.P256()
+	priv.X, priv.Y = priv.Curve.ScalarBaseMult(priv.D.Bytes())
+
+	r, s := signRFC6979(priv, crypto.SHA256, digest[:])
+	assert.Equal(hexInt(t, "EFD48B2AACB6A8FD1140DD9CD45E81D69D2C877B56AAF991C34D0EA84EAF3716"), r)
+	assert.Equal(hexInt(t, "F7CB1C942D657C41D436C7A1B6E29F65F3E900DBB9AFF4064DC4AB2F843ACDA8"), s)
+	assert.True(ecdsa.Verify(&priv.PublicKey, digest[:], r, s))
+}
+
+func testDeterministicSignaturesIdentical(t *testing.T, alg string, bits int) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		registry = key.NewRegistry(nil)
+	)
+
+	factory, err := NewFactory(
+		Options{
+			Alg:                     alg,
+			Key:                     key.Descriptor{Kid: "deterministic", Type: key.KeyTypeECDSA, Bits: bits},
+			DeterministicSignatures: true,
+		},
+		ClaimBuilders{requestClaimBuilder{}},
+		registry,
+	)
+
+	require.NoError(err)
+
+	newToken := func() string {
+		request := NewRequest()
+		request.Claims["sub"] = "device"
+		signed, err := factory.NewToken(context.Background(), request)
+		require.NoError(err)
+		return signed
+	}
+
+	first, second := newToken(), newToken()
+	assert.Equal(first, second)
+
+	pair, ok := registry.Get("deterministic")
+	require.True(ok)
+	parsed, err := jwt.Parse(first, func(*jwt.Token) (interface{}, error) {
+		return &pair.Sign().(*ecdsa.PrivateKey).PublicKey, nil
+	})
+
+	require.NoError(err)
+	assert.True(parsed.Valid)
+	assert.Equal(alg, parsed.Method.Alg())
+	assert.Equal("device", parsed.Claims.(jwt.MapClaims)["sub"])
+}
+
+func testDeterministicSignaturesOff(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	factory, err := NewFactory(
+		Options{
+			Alg: "ES256",
+			Key: key.Descriptor{Kid: "random", Type: key.KeyTypeECDSA, Bits: 256},
+		},
+		ClaimBuilders{},
+		key.NewRegistry(nil),
+	)
+
+	require.NoError(err)
+	first, err := factory.NewToken(context.Background(), NewRequest())
+	require.NoError(err)
+	second, err := factory.NewToken(context.Background(), NewRequest())
+	require.NoError(err)
+	assert.NotEqual(first, second)
+}
+
+func testDeterministicSignaturesNotECDSA(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		registry = key.NewRegistry(nil)
+	)
+
+	factory, err := NewFactory(
+		Options{
+			Alg:                     "RS256",
+			Key:                     key.Descriptor{Kid: "rsa", Bits: 512},
+			DeterministicSignatures: true,
+		},
+		ClaimBuilders{},
+		registry,
+	)
+
+	assert.Nil(factory)
+	assert.True(errors.Is(err, ErrDeterministicRequiresECDSA))
+	assert.Empty(registry.Kids())
+}
+
+func TestDeterministicSignatures(t *testing.T) {
+	for _, record := range []struct {
+		alg  string
+		bits int
+	}{
+		{"ES256", 256},
+		{"ES384", 384},
+		{"ES512", 512},
+	} {
+		t.Run(record.alg+"-"+strconv.Itoa(record.bits), func(t *testing.T) {
+			testDeterministicSignaturesIdentical(t, record.alg, record.bits)
+		})
+	}
+
+	t.Run("Off", testDeterministicSignaturesOff)
+	t.Run("NotECDSA", testDeterministicSignaturesNotECDSA)
+}
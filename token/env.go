@@ -0,0 +1,44 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+var (
+	ErrEnvNotAllowed = errors.New("An environment variable cannot be combined with a header, parameter, cookie, variable, server name, client IP, scheme, body, or sources")
+)
+
+// MissingEnvironmentError is returned at startup when a required value's environment variable is unset or empty
+type MissingEnvironmentError struct {
+	Name string
+	Env  string
+}
+
+func (mee MissingEnvironmentError) Error() string {
+	return fmt.Sprintf("The environment variable %s is required for %s", mee.Env, mee.Name)
+}
+
+// static resolves a statically configured Value.  A value taken from the environment is read once, when this
+// method is called, and falls back to Value if the variable is unset or empty.  A nil result with no error
+// means that an optional environment variable was not set, and the value should be omitted.
+func (v Value) static(name string) (interface{}, error) {
+	if len(v.Env) == 0 {
+		return v.Value, nil
+	}
+
+	if v.fromRequest() {
+		return nil, ErrEnvNotAllowed
+	}
+
+	if s := os.Getenv(v.Env); len(s) > 0 {
+		return s, nil
+	}
+
+	if v.Value == nil && v.Required {
+		return nil, MissingEnvironmentError{Name: name, Env: v.Env}
+	}
+
+	return v.Value, nil
+}
@@ -0,0 +1,123 @@
+package token
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/xmidt-org/themis/key"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setenv sets an environment variable for the duration of a test
+func setenv(t *testing.T, name, value string) {
+	previous, existed := os.LookupEnv(name)
+	require.NoError(t, os.Setenv(name, value))
+	t.Cleanup(func() {
+		if existed {
+			os.Setenv(name, previous)
+		} else {
+			os.Unsetenv(name)
+		}
+	})
+}
+
+func testEnvIssued(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		registry = key.NewRegistry(rand.Reader)
+
+		o = Options{
+			Key: key.Descriptor{Kid: "test", Bits: 512},
+			Claims: map[string]Value{
+				"region":  Value{Env: "THEMIS_TEST_REGION", Required: true},
+				"cluster": Value{Env: "THEMIS_TEST_CLUSTER", Value: "default-cluster"},
+				"zone":    Value{Env: "THEMIS_TEST_ZONE"},
+			},
+			DisableTime: true,
+		}
+	)
+
+	setenv(t, "THEMIS_TEST_REGION", "us-east-1")
+	os.Unsetenv("THEMIS_TEST_CLUSTER")
+	os.Unsetenv("THEMIS_TEST_ZONE")
+
+	cb, err := NewClaimBuilders(nil, nil, o)
+	require.NoError(err)
+
+	// the environment is read once, when the claim builders are created
+	setenv(t, "THEMIS_TEST_REGION", "eu-west-1")
+
+	factory, err := NewFactory(o, cb, registry)
+	require.NoError(err)
+
+	signed, err := factory.NewToken(context.Background(), NewRequest())
+	require.NoError(err)
+
+	pair, ok := registry.Get("test")
+	require.True(ok)
+	parsed, err := jwt.Parse(signed, func(*jwt.Token) (interface{}, error) {
+		return &pair.Sign().(*rsa.PrivateKey).PublicKey, nil
+	})
+
+	require.NoError(err)
+	assert.Equal(
+		jwt.MapClaims{"region": "us-east-1", "cluster": "default-cluster"},
+		parsed.Claims,
+	)
+}
+
+func testEnvStatic(t *testing.T) {
+	assert := assert.New(t)
+	setenv(t, "THEMIS_TEST_REGION", "us-east-1")
+
+	v, err := Value{Env: "THEMIS_TEST_REGION"}.static("region")
+	assert.NoError(err)
+	assert.Equal("us-east-1", v)
+}
+
+func testEnvMissingRequired(t *testing.T) {
+	assert := assert.New(t)
+	os.Unsetenv("THEMIS_TEST_REGION")
+
+	cb, err := NewClaimBuilders(nil, nil, Options{
+		Claims: map[string]Value{
+			"region": Value{Env: "THEMIS_TEST_REGION", Required: true},
+		},
+	})
+
+	assert.Nil(cb)
+	assert.Equal(MissingEnvironmentError{Name: "region", Env: "THEMIS_TEST_REGION"}, err)
+	assert.Contains(err.Error(), "THEMIS_TEST_REGION")
+}
+
+func testEnvNotAllowed(t *testing.T) {
+	assert := assert.New(t)
+	o := Options{
+		Claims: map[string]Value{
+			"region": Value{Env: "THEMIS_TEST_REGION", Header: "X-Region"},
+		},
+	}
+
+	cb, err := NewClaimBuilders(nil, nil, o)
+	assert.Nil(cb)
+	assert.True(errors.Is(err, ErrEnvNotAllowed))
+
+	rb, err := NewRequestBuilders(o)
+	assert.Nil(rb)
+	assert.True(errors.Is(err, ErrEnvNotAllowed))
+}
+
+func TestEnv(t *testing.T) {
+	t.Run("Issued", testEnvIssued)
+	t.Run("Static", testEnvStatic)
+	t.Run("MissingRequired", testEnvMissingRequired)
+	t.Run("NotAllowed", testEnvNotAllowed)
+}
@@ -0,0 +1,218 @@
+package token
+
+import (
+	"github.com/xmidt-org/themis/key"
+	"github.com/xmidt-org/themis/xhttp/xhttpserver"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+	"go.uber.org/multierr"
+)
+
+// Error codes are the stable, machine-readable values of a Problem's code member.  Unlike the detail text,
+// these values will not change between releases, so clients may rely on them to distinguish failures that
+// share an HTTP status.
+const (
+	// ErrorCodeMissingClaim indicates that a value required to build the token was not supplied
+	ErrorCodeMissingClaim = "missing_claim"
+
+	// ErrorCodeInvalidClaim indicates that a supplied value was malformed or failed validation
+	ErrorCodeInvalidClaim = "invalid_claim"
+
+	// ErrorCodeSchemaViolation indicates that the token's claims did not conform to the configured claims schema
+	ErrorCodeSchemaViolation = "schema_violation"
+
+	// ErrorCodeNoClaims indicates that strict mode rejected a request that supplied none of the request claims
+	ErrorCodeNoClaims = "no_claims"
+
+	// ErrorCodeInvalidBody indicates that the request body could not be parsed
+	ErrorCodeInvalidBody = "invalid_body"
+
+	// ErrorCodeUnsupportedMediaType indicates that the request body's content type is not accepted
+	ErrorCodeUnsupportedMediaType = "unsupported_media_type"
+
+	// ErrorCodeInvalidAudience indicates that a requested audience is not allowed
+	ErrorCodeInvalidAudience = "invalid_audience"
+
+	// ErrorCodeInvalidScope indicates that none of the requested scopes are allowed
+	ErrorCodeInvalidScope = "invalid_scope"
+
+	// ErrorCodeUnknownTenant indicates that the requested tenant has no signing key
+	ErrorCodeUnknownTenant = "unknown_tenant"
+
+	// ErrorCodeUnsupportedAlgorithm indicates that the requested signing algorithm is not allowed
+	ErrorCodeUnsupportedAlgorithm = "unsupported_algorithm"
+
+	// ErrorCodeInvalidConfirmationKey indicates that a proof-of-possession key could not be used
+	ErrorCodeInvalidConfirmationKey = "invalid_confirmation_key"
+
+	// ErrorCodeLimitExceeded indicates that a request had too many claims or too large a payload
+	ErrorCodeLimitExceeded = "limit_exceeded"
+
+	// ErrorCodeUnauthorized indicates that the client's credentials were missing or rejected
+	ErrorCodeUnauthorized = "unauthorized"
+
+	// ErrorCodeForbidden indicates that the client is authenticated but not permitted to make the request
+	ErrorCodeForbidden = "forbidden"
+
+	// ErrorCodeReplay indicates that a client nonce has already been used
+	ErrorCodeReplay = "replay"
+
+	// ErrorCodeInvalidNonce indicates that a token request did not echo a valid challenge nonce
+	ErrorCodeInvalidNonce = "invalid_nonce"
+
+	// ErrorCodeRateLimited indicates that the issuance rate limit has been reached
+	ErrorCodeRateLimited = "rate_limited"
+
+	// ErrorCodeQuotaExceeded indicates that a per-claim issuance quota has been used up
+	ErrorCodeQuotaExceeded = "quota_exceeded"
+
+	// ErrorCodeTimeout indicates that the server was too busy to complete the request in time
+	ErrorCodeTimeout = "timeout"
+
+	// ErrorCodeNoSigningKey indicates that no key was available to sign the token
+	ErrorCodeNoSigningKey = "no_signing_key"
+
+	// ErrorCodeAuditFailed indicates that the token could not be recorded in the audit store
+	ErrorCodeAuditFailed = "audit_failed"
+
+	// ErrorCodeInvalidRequest is the code for any other error with a 4xx status
+	ErrorCodeInvalidRequest = "invalid_request"
+
+	// ErrorCodeServerError is the code for any other error, including errors with no status
+	ErrorCodeServerError = "server_error"
+)
+
+// ErrorCoder is implemented by errors that supply their own Problem code.  Custom ClaimBuilders
+// can return such errors to give clients a code other than the defaults.
+type ErrorCoder interface {
+	ErrorCode() string
+}
+
+// knownErrorCode maps the errors produced by this package and by xhttpserver onto their codes
+func knownErrorCode(err error) (string, bool) {
+	switch err.(type) {
+	case xhttpserver.MissingValueError, MissingBodyValueError, MissingSourcesError, MissingProfileClaimError:
+		return ErrorCodeMissingClaim, true
+
+	case InvalidMACError, NoMatchError, InvalidPartnerIDError, InvalidAuthTimeError, InvalidAMRHeaderError, TemplateClaimError:
+		return ErrorCodeInvalidClaim, true
+
+	case SchemaValidationError:
+		return ErrorCodeSchemaViolation, true
+
+	case NoClaimsError:
+		return ErrorCodeNoClaims, true
+
+	case InvalidBodyError, BatchError:
+		return ErrorCodeInvalidBody, true
+
+	case UnsupportedBodyError:
+		return ErrorCodeUnsupportedMediaType, true
+
+	case InvalidAudienceError:
+		return ErrorCodeInvalidAudience, true
+
+	case EmptyScopeError:
+		return ErrorCodeInvalidScope, true
+
+	case UnknownTenantError:
+		return ErrorCodeUnknownTenant, true
+
+	case UnsupportedAlgorithmError:
+		return ErrorCodeUnsupportedAlgorithm, true
+
+	case InvalidConfirmationKeyError:
+		return ErrorCodeInvalidConfirmationKey, true
+
+	case TooManyClaimsError, PayloadTooLargeError:
+		return ErrorCodeLimitExceeded, true
+
+	case BasicAuthError, SignedCookieError, MissingClientCertificateError, xhttpserver.UnauthorizedError:
+		return ErrorCodeUnauthorized, true
+
+	case xhttpserver.ForbiddenError:
+		return ErrorCodeForbidden, true
+
+	case ReplayError:
+		return ErrorCodeReplay, true
+
+	case ChallengeError:
+		return ErrorCodeInvalidNonce, true
+
+	case RateLimitedError, ChallengeLimitError:
+		return ErrorCodeRateLimited, true
+
+	case QuotaExceededError:
+		return ErrorCodeQuotaExceeded, true
+
+	case ConcurrencyTimeoutError, xhttpserver.RequestTimeoutError, key.SignTimeoutError:
+		return ErrorCodeTimeout, true
+
+	case NoSigningKeyError:
+		return ErrorCodeNoSigningKey, true
+
+	case AuditError:
+		return ErrorCodeAuditFailed, true
+
+	default:
+		return "", false
+	}
+}
+
+// severest returns the embedded error with the largest status code, so that a BuildError's code
+// agrees with its status
+func severest(err error) error {
+	var (
+		result error
+		status = -1
+	)
+
+	for _, e := range multierr.Errors(err) {
+		sc := 0
+		if coder, ok := e.(kithttp.StatusCoder); ok {
+			sc = coder.StatusCode()
+		}
+
+		if status < sc {
+			result, status = e, sc
+		}
+	}
+
+	return result
+}
+
+// ErrorCode returns the stable code for an error.  Errors that implement ErrorCoder supply their
+// own code.  Otherwise, the code is determined by the error's type, looking through BuildErrors
+// and wrapped errors.  Errors of any other type are given ErrorCodeInvalidRequest if they report
+// a 4xx status, and ErrorCodeServerError otherwise.
+func ErrorCode(err error) string {
+	for e := err; e != nil; {
+		if coder, ok := e.(ErrorCoder); ok {
+			return coder.ErrorCode()
+		}
+
+		if code, ok := knownErrorCode(e); ok {
+			return code
+		}
+
+		if be, ok := e.(BuildError); ok {
+			e = severest(be.Err)
+		} else if u, ok := e.(interface{ Unwrap() error }); ok {
+			e = u.Unwrap()
+		} else {
+			break
+		}
+	}
+
+	if sc, ok := err.(kithttp.StatusCoder); ok && sc.StatusCode() >= 400 && sc.StatusCode() < 500 {
+		return ErrorCodeInvalidRequest
+	}
+
+	return ErrorCodeServerError
+}
+
+// NewProblemErrorEncoder creates a go-kit error encoder that writes each error as an unsigned
+// application/problem+json body
+func NewProblemErrorEncoder() kithttp.ErrorEncoder {
+	return NewSignedErrorEncoder(nil)
+}
@@ -3,17 +3,89 @@ package token
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/xmidt-org/themis/key"
+	"github.com/xmidt-org/themis/xlog"
 
 	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/go-kit/kit/log/level"
 )
 
 const (
 	DefaultAlg = "RS256"
+
+	// TenantMetadata is the Request.Metadata key holding the tenant name, when tenants are configured
+	TenantMetadata = "tenant"
 )
 
+// UnknownTenantError is returned when a token request names a tenant that has no signing key
+type UnknownTenantError struct {
+	Tenant interface{}
+}
+
+func (ute UnknownTenantError) Error() string {
+	return fmt.Sprintf("Unknown tenant: %v", ute.Tenant)
+}
+
+func (ute UnknownTenantError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// InvalidJKUError is returned when the configured jku is not an absolute https URL
+type InvalidJKUError struct {
+	JKU string
+}
+
+func (ije InvalidJKUError) Error() string {
+	return fmt.Sprintf("Invalid jku %q: must be an absolute https URL", ije.JKU)
+}
+
+// PinnedAlgorithmError is returned at startup when a key's Descriptor pins an algorithm other than the one
+// the factory would sign with using that key
+type PinnedAlgorithmError struct {
+	Kid    string
+	Pinned string
+	Alg    string
+}
+
+func (pae PinnedAlgorithmError) Error() string {
+	return fmt.Sprintf("Key %s is pinned to algorithm %s, but would sign with %s", pae.Kid, pae.Pinned, pae.Alg)
+}
+
+// checkAlgorithm verifies that a key can sign with the given method's algorithm, i.e. that the key either has no
+// pinned algorithm or is pinned to that algorithm, and that the algorithm fits the key's type and curve
+func checkAlgorithm(kr key.Registry, kid string, method jwt.SigningMethod) error {
+	if pinned, ok := kr.Alg(kid); ok && pinned != method.Alg() {
+		return PinnedAlgorithmError{Kid: kid, Pinned: pinned, Alg: method.Alg()}
+	}
+
+	if p, ok := kr.Get(kid); ok {
+		return key.CheckAlgorithm(method.Alg(), p)
+	}
+
+	return nil
+}
+
+// NoSigningKeyError is returned when a token's signing key is no longer in the key Registry, e.g. because
+// it was pruned.  This is a server-side condition, so it produces a 503 until a new key is promoted.
+type NoSigningKeyError struct {
+	Kid string
+}
+
+func (nske NoSigningKeyError) Error() string {
+	return fmt.Sprintf("No signing key is available: key %s has been removed", nske.Kid)
+}
+
+func (nske NoSigningKeyError) StatusCode() int {
+	return http.StatusServiceUnavailable
+}
+
 // Request is a token creation request.  Clients can pass in arbitrary claims, typically things like "iss",
 // to merge and override anything set on the factory via configuration.
 type Request struct {
@@ -43,45 +115,543 @@ type Factory interface {
 type factory struct {
 	method       jwt.SigningMethod
 	claimBuilder ClaimBuilder
+	keys         key.Registry
+	canonical    bool
+	compress     bool
+	redactor     Redactor
+	limits       Limits
+	rateLimiter  *rateLimiter
+	quota        *quotaGuard
+	semaphore    *fairSemaphore
+	jku          string
+
+	// headers are the custom parameters, including any crit parameter, added to every token's JOSE header
+	headers map[string]interface{}
+
+	// profile is the standard profile that every token must conform to, or nil if none is configured
+	profile *tokenProfile
+
+	// schema is the JSON Schema that every token's claims must conform to, or nil if none is configured
+	schema *schema
+
+	// audit is the store that receives a record of each issued token, or nil if auditing is not configured
+	audit         AuditStore
+	auditFailOpen bool
+
+	// webhook is notified of each issued token, or nil if no webhook is configured
+	webhook *webhookNotifier
+
+	// general signs every token with several keys, or is nil if tokens have a single signature
+	general *generalJWS
+
+	// coalescer shares one signing operation among identical concurrent token requests, or is nil if
+	// requests are not coalesced
+	coalescer *coalescer
+
+	// logStats adds each token's size and the time taken to sign and to issue it to the issuance log
+	logStats bool
+	now      func() time.Time
 
-	// pair is an atomic value so that future updates can implement key rotation
+	// pair is an atomic value so that the key can be rotated while tokens are issued
 	pair atomic.Value
+
+	// rotator periodically replaces pair with a newly generated key, or is nil if the key is not rotated
+	rotator *key.Rotator
+
+	// primary indicates that this factory's key was the first activated in its Registry, in which case the
+	// factory also follows keys that are promoted without a predecessor
+	primary bool
+
+	// fallback is the kid of this factory's fallback key, or empty if it has none
+	fallback string
+
+	// tenants holds the signing key for each tenant, keyed by lowercased tenant name.
+	// If empty, the pair field is used to sign every token.
+	tenants map[string]key.Pair
+
+	// algorithms holds the signer for each algorithm a request may select, keyed by algorithm name
+	algorithms map[string]signer
+}
+
+// signingPair selects the key pair used to sign the token for the given request
+func (f *factory) signingPair(r *Request) (key.Pair, error) {
+	if len(f.tenants) == 0 {
+		return f.pair.Load().(key.Pair), nil
+	}
+
+	tenant, _ := r.Metadata[TenantMetadata].(string)
+	if pair, ok := f.tenants[strings.ToLower(tenant)]; ok {
+		return pair, nil
+	}
+
+	return nil, UnknownTenantError{Tenant: r.Metadata[TenantMetadata]}
 }
 
 func (f *factory) NewToken(ctx context.Context, r *Request) (string, error) {
+	var start time.Time
+	if f.logStats {
+		start = f.now()
+	}
+
+	method, pair, err := f.signingMethod(r)
+	if err != nil {
+		return "", err
+	}
+
+	if _, ok := f.keys.Get(pair.KID()); !ok {
+		xlog.Get(ctx).Log(
+			level.Key(), level.ErrorValue(),
+			xlog.MessageKey(), "no signing key available",
+			"kid", pair.KID(),
+		)
+
+		return "", NoSigningKeyError{Kid: pair.KID()}
+	}
+
 	merged := make(map[string]interface{}, len(r.Claims))
 	if err := f.claimBuilder.AddClaims(ctx, r, merged); err != nil {
 		return "", err
 	}
 
-	token := jwt.NewWithClaims(f.method, jwt.MapClaims(merged))
-	pair := f.pair.Load().(key.Pair)
+	if f.profile != nil {
+		if err := f.profile.check(merged); err != nil {
+			return "", err
+		}
+	}
+
+	if f.schema != nil {
+		if err := f.schema.check(merged); err != nil {
+			return "", err
+		}
+	}
+
+	if err := f.limits.check(merged); err != nil {
+		return "", err
+	}
+
+	// a request that is not issued a token, e.g. because signing failed, counts against neither the rate
+	// limit nor the quota
+	var issued bool
+	if f.rateLimiter != nil {
+		if err := f.rateLimiter.allow(merged); err != nil {
+			return "", err
+		}
+
+		defer func() {
+			if !issued {
+				f.rateLimiter.refund(merged)
+			}
+		}()
+	}
+
+	if f.quota != nil {
+		if err := f.quota.take(merged); err != nil {
+			return "", err
+		}
+
+		defer func() {
+			if issued {
+				return
+			}
+
+			if err := f.quota.refund(merged); err != nil {
+				xlog.Get(ctx).Log(
+					level.Key(), level.WarnValue(),
+					xlog.MessageKey(), "unable to refund quota",
+					xlog.ErrorKey(), err,
+				)
+			}
+		}()
+	}
+
+	if err := RedeemNonces(ctx); err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(method, jwt.MapClaims(merged))
+	for k, v := range f.headers {
+		token.Header[k] = v
+	}
+
 	token.Header["kid"] = pair.KID()
-	return token.SignedString(pair.Sign())
+	if len(f.jku) > 0 {
+		token.Header["jku"] = f.jku
+	}
+
+	if f.profile != nil {
+		token.Header["typ"] = f.profile.typ
+	}
+
+	var (
+		st          signedToken
+		signingTime time.Time
+	)
+
+	if f.logStats {
+		signingTime = f.now()
+	}
+
+	if ck, ok := f.coalesceKey(token.Header, merged); ok {
+		st, err = f.coalescer.do(ctx, ck, func(ctx context.Context) (signedToken, error) {
+			return f.sign(ctx, r, method, token, merged, pair)
+		})
+	} else {
+		st, err = f.sign(ctx, r, method, token, merged, pair)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	signed, kid := st.signed, st.kid
+	var signDuration time.Duration
+	if f.logStats {
+		signDuration = f.now().Sub(signingTime)
+	}
+
+	if f.audit != nil {
+		if err := f.audit.Record(ctx, newAuditRecord(kid, merged)); err != nil {
+			if !f.auditFailOpen {
+				return "", AuditError{Err: err}
+			}
+
+			xlog.Get(ctx).Log(
+				level.Key(), level.ErrorValue(),
+				xlog.MessageKey(), "unable to record issued token",
+				"kid", kid,
+				xlog.ErrorKey(), err,
+			)
+		}
+	}
+
+	if f.webhook != nil {
+		f.webhook.notify(newWebhookEvent(kid, merged))
+	}
+
+	if f.general != nil {
+		for _, s := range f.general.signers {
+			f.keys.Used(s.kid)
+		}
+	} else {
+		f.keys.Used(kid)
+	}
+
+	keyvals := []interface{}{
+		level.Key(), level.DebugValue(),
+		xlog.MessageKey(), "issued token",
+		"kid", kid,
+		"claims", f.redactor.LogValue(merged),
+	}
+
+	if f.logStats {
+		keyvals = append(keyvals,
+			"size", len(signed),
+			"signDuration", signDuration,
+			"duration", f.now().Sub(start),
+		)
+	}
+
+	xlog.Get(ctx).Log(keyvals...)
+
+	issued = true
+	return signed, nil
+}
+
+// serialize signs a token with a single key pair
+func (f *factory) serialize(method jwt.SigningMethod, token *jwt.Token, merged map[string]interface{}, pair key.Pair) (string, error) {
+	switch {
+	case f.compress:
+		return compressedSignedString(method, token.Header, merged, f.canonical, pair.Sign())
+	case f.canonical:
+		return canonicalSignedString(method, token.Header, merged, pair.Sign())
+	default:
+		return token.SignedString(pair.Sign())
+	}
+}
+
+// sign produces the serialized token, waiting for a signing slot if concurrency is limited.  If the given
+// pair fails to sign and the key Registry has a fallback key, the token is signed with the fallback instead.
+func (f *factory) sign(ctx context.Context, r *Request, method jwt.SigningMethod, token *jwt.Token, merged map[string]interface{}, pair key.Pair) (signedToken, error) {
+	var tenant string
+	if f.semaphore != nil {
+		if len(f.tenants) > 0 {
+			tenant, _ = r.Metadata[TenantMetadata].(string)
+		}
+
+		if err := f.semaphore.acquire(ctx, tenant); err != nil {
+			return signedToken{}, err
+		}
+	}
+
+	if f.general != nil {
+		if f.semaphore != nil {
+			defer f.semaphore.release()
+		}
+
+		signed, err := f.general.sign(token.Header, merged)
+		return signedToken{signed: signed, kid: f.general.kid()}, err
+	}
+
+	// an attempt that exceeds the key's signing timeout keeps running after SignWithFallback returns,
+	// so each attempt signs its own copy of the token and results are recorded under a lock.  Each attempt
+	// also holds its own signing slot until it returns, so that abandoned attempts count against MaxInFlight.
+	var (
+		lock     sync.Mutex
+		signed   = make(map[string]string, 2)
+		firstErr error
+		attempts int32
+	)
+
+	base := make(map[string]interface{}, len(token.Header))
+	for k, v := range token.Header {
+		base[k] = v
+	}
+
+	// factories that share a Registry each have their own fallback key
+	var fallback key.Pair
+	if len(f.fallback) > 0 {
+		fallback, _ = f.keys.Get(f.fallback)
+	}
+
+	used, err := f.keys.SignWith(pair, fallback, func(p key.Pair) error {
+		if f.semaphore != nil {
+			// the first attempt uses the slot acquired above
+			if atomic.AddInt32(&attempts, 1) > 1 {
+				if err := f.semaphore.acquire(ctx, tenant); err != nil {
+					lock.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+
+					lock.Unlock()
+					return err
+				}
+			}
+
+			defer f.semaphore.release()
+		}
+
+		header := make(map[string]interface{}, len(base))
+		for k, v := range base {
+			header[k] = v
+		}
+
+		header["kid"] = p.KID()
+		value, err := f.serialize(method, &jwt.Token{Header: header, Claims: token.Claims, Method: token.Method}, merged, p)
+
+		lock.Lock()
+		signed[p.KID()] = value
+		if firstErr == nil {
+			firstErr = err
+		}
+
+		lock.Unlock()
+		return err
+	})
+
+	token.Header["kid"] = used.KID()
+	lock.Lock()
+	result, logErr := signed[used.KID()], firstErr
+	lock.Unlock()
+
+	if used.KID() != pair.KID() {
+		xlog.Get(ctx).Log(
+			level.Key(), level.WarnValue(),
+			xlog.MessageKey(), "signing key failed, signing with the fallback key",
+			"kid", pair.KID(),
+			"fallback", used.KID(),
+			xlog.ErrorKey(), logErr,
+		)
+	}
+
+	if err != nil {
+		result = ""
+	}
+
+	return signedToken{signed: result, kid: used.KID()}, err
 }
 
 // NewFactory creates a token Factory from a Descriptor.  The supplied Noncer is used if and only
 // if d.Nonce is true.  Alternatively, supplying a nil Noncer will disable nonce creation altogether.
-// The token's key pair is registered with the given key Registry.
+// The token's key pair is registered with the given key Registry and becomes its active key, unless another factory's key
+// already is.  Whenever a staged key that succeeds the Factory's key is promoted in that Registry, the Factory begins
+// signing tokens with the promoted key.  The first Factory in a Registry also follows staged keys promoted without a predecessor.
 func NewFactory(o Options, cb ClaimBuilder, kr key.Registry) (Factory, error) {
-	if len(o.Alg) == 0 {
-		o.Alg = DefaultAlg
-	}
-
+	o.Alg = o.alg()
 	f := &factory{
-		method:       jwt.GetSigningMethod(o.Alg),
+		method:       getSigningMethod(o.Alg),
 		claimBuilder: cb,
+		keys:         kr,
+		canonical:    o.CanonicalClaims,
+		compress:     o.CompressClaims,
+		redactor:     NewRedactor(o.RedactClaims),
+		limits:       o.Limits,
+		jku:          o.JKU,
+		logStats:     o.LogTokenStats,
+		now:          o.now(),
 	}
 
 	if f.method == nil {
 		return nil, fmt.Errorf("No such signing method: %s", o.Alg)
 	}
 
+	if o.DeterministicSignatures {
+		m, err := newDeterministicMethod(f.method)
+		if err != nil {
+			return nil, err
+		}
+
+		f.method = m
+	}
+
+	profile, err := newTokenProfile(o)
+	if err != nil {
+		return nil, err
+	}
+
+	f.profile = profile
+	if len(o.ClaimsSchema) > 0 {
+		if f.schema, err = loadClaimsSchema(o.ClaimsSchema); err != nil {
+			return nil, err
+		}
+	}
+
+	if o.RateLimit != nil {
+		var err error
+		if f.rateLimiter, err = newRateLimiter(*o.RateLimit, o.now()); err != nil {
+			return nil, err
+		}
+	}
+
+	if o.Quota != nil {
+		var err error
+		if f.quota, err = newQuotaGuard(*o.Quota, o.quotaStore, o.now()); err != nil {
+			return nil, err
+		}
+	}
+
+	if o.Audit != nil {
+		f.audit = o.auditStore
+		f.auditFailOpen = o.Audit.FailOpen
+		if f.audit == nil {
+			f.audit = NopAuditStore{}
+		}
+	}
+
+	if o.Webhook != nil {
+		var err error
+		if f.webhook, err = newWebhookNotifier(*o.Webhook, o.client); err != nil {
+			return nil, err
+		}
+	}
+
+	// every token with a nonce is unique, so there would never be a request to coalesce
+	if o.Coalesce && !o.Nonce {
+		f.coalescer = newCoalescer()
+	}
+
+	if o.Concurrency != nil && o.Concurrency.MaxInFlight > 0 {
+		f.semaphore = newFairSemaphore(*o.Concurrency)
+	}
+
+	if f.headers, err = newHeaders(o); err != nil {
+		return nil, err
+	}
+
+	if len(o.JKU) > 0 {
+		if u, err := url.Parse(o.JKU); err != nil || u.Scheme != "https" || len(u.Host) == 0 {
+			return nil, InvalidJKUError{JKU: o.JKU}
+		}
+	}
+
 	pair, err := kr.Register(o.Key)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := checkAlgorithm(kr, pair.KID(), f.method); err != nil {
+		return nil, err
+	}
+
+	// the Registry's active key and fallback are those of the first factory, e.g. for readiness checks, when
+	// several factories share the Registry
+	if _, ok := kr.Active(); !ok {
+		if err := kr.Activate(pair.KID()); err != nil {
+			return nil, err
+		}
+
+		f.primary = true
+	}
+
+	if o.Fallback != nil {
+		fallback, err := kr.Register(*o.Fallback)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := checkAlgorithm(kr, fallback.KID(), f.method); err != nil {
+			return nil, err
+		}
+
+		if _, ok := kr.Fallback(); !ok {
+			if err := kr.SetFallback(fallback.KID()); err != nil {
+				return nil, err
+			}
+		}
+
+		f.fallback = fallback.KID()
+	}
+
 	f.pair.Store(pair)
+	kr.OnPromote(func(p key.Pair) {
+		// ignore keys that succeed another factory's key
+		current := f.pair.Load().(key.Pair).KID()
+		if previous, ok := kr.Predecessor(p.KID()); ok {
+			if previous == current {
+				f.pair.Store(p)
+			}
+		} else if p.KID() == current || f.primary {
+			f.pair.Store(p)
+		}
+	})
+
+	if o.Key.RotateInterval > 0 {
+		if f.rotator, err = key.NewRotator(kr, o.Key, pair.KID(), o.now()); err != nil {
+			return nil, err
+		}
+	}
+
+	if o.Tenant != nil {
+		f.tenants = make(map[string]key.Pair, len(o.Tenant.Keys))
+		for tenant, d := range o.Tenant.Keys {
+			if len(d.Kid) == 0 && !d.Thumbprint {
+				d.Kid = tenant
+			}
+
+			tp, err := kr.Register(d)
+			if err != nil {
+				return nil, err
+			}
+
+			if err := checkAlgorithm(kr, tp.KID(), f.method); err != nil {
+				return nil, err
+			}
+
+			f.tenants[strings.ToLower(tenant)] = tp
+		}
+	}
+
+	if o.Algorithms != nil {
+		if f.algorithms, err = newAlgorithmSigners(o, kr); err != nil {
+			return nil, err
+		}
+	}
+
+	if o.Signatures != nil {
+		if f.general, err = newGeneralJWS(o, f.method, kr); err != nil {
+			return nil, err
+		}
+	}
+
 	return f, nil
 }
@@ -1,13 +1,28 @@
 package token
 
 import (
+	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/xmidt-org/themis/clock/clocktest"
 	"github.com/xmidt-org/themis/key"
 	"github.com/xmidt-org/themis/random"
+	"github.com/xmidt-org/themis/xlog"
 
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/go-kit/kit/log"
+	"github.com/lestrrat-go/jwx/jwk"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -70,13 +85,755 @@ func testNewFactorySuccess(t *testing.T) {
 	require.NoError(err)
 	require.NotNil(factory)
 
+	_, ok := registry.LastUsed("test")
+	assert.False(ok)
+
 	token, err := factory.NewToken(context.Background(), new(Request))
 	require.NoError(err)
 	assert.True(len(token) > 0)
+
+	lastUsed, ok := registry.LastUsed("test")
+	assert.True(ok)
+	assert.False(lastUsed.IsZero())
+}
+
+func testNewFactoryAlgorithm(t *testing.T, alg string, d key.Descriptor, public func(key.Pair) interface{}) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		registry = key.NewRegistry(rand.Reader)
+	)
+
+	tf, err := NewFactory(Options{Alg: alg, Key: d, SelfTest: true}, ClaimBuilders{requestClaimBuilder{}}, registry)
+	require.NoError(err)
+	require.NoError(tf.(SelfTester).SelfTest())
+
+	r := NewRequest()
+	r.Claims["sub"] = "device"
+	signed, err := tf.NewToken(context.Background(), r)
+	require.NoError(err)
+
+	pair, ok := registry.Get(d.Kid)
+	require.True(ok)
+
+	token, err := jwt.Parse(signed, func(*jwt.Token) (interface{}, error) {
+		return public(pair), nil
+	})
+
+	require.NoError(err)
+	assert.True(token.Valid)
+	assert.Equal(tf.(*factory).method.Alg(), token.Header["alg"])
+	assert.Equal("device", token.Claims.(jwt.MapClaims)["sub"])
+}
+
+func testNewFactoryAlgorithms(t *testing.T) {
+	ecdsaPublic := func(p key.Pair) interface{} { return &p.Sign().(*ecdsa.PrivateKey).PublicKey }
+	testData := []struct {
+		alg    string
+		d      key.Descriptor
+		public func(key.Pair) interface{}
+	}{
+		{"ES256", key.Descriptor{Kid: "es256", Type: key.KeyTypeECDSA, Bits: 256}, ecdsaPublic},
+		{"ES384", key.Descriptor{Kid: "es384", Type: key.KeyTypeECDSA, Bits: 384}, ecdsaPublic},
+		{"ES512", key.Descriptor{Kid: "es512", Type: key.KeyTypeECDSA, Bits: 512}, ecdsaPublic},
+		{
+			"EdDSA",
+			key.Descriptor{Kid: "eddsa", Type: key.KeyTypeEd25519},
+			func(p key.Pair) interface{} { return p.Sign().(ed25519.PrivateKey).Public() },
+		},
+		{
+			"eddsa",
+			key.Descriptor{Kid: "pinned", Type: key.KeyTypeEd25519, Alg: "EDDSA"},
+			func(p key.Pair) interface{} { return p.Sign().(ed25519.PrivateKey).Public() },
+		},
+	}
+
+	for _, record := range testData {
+		t.Run(record.alg, func(t *testing.T) {
+			testNewFactoryAlgorithm(t, record.alg, record.d, record.public)
+		})
+	}
+}
+
+func testNewFactoryTenants(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		registry = key.NewRegistry(rand.Reader)
+
+		o = Options{
+			Key: key.Descriptor{Kid: "default", Bits: 512},
+			Tenant: &Tenant{
+				Header: "X-Tenant",
+				Keys: map[string]key.Descriptor{
+					"acme":   key.Descriptor{Bits: 512},
+					"globex": key.Descriptor{Kid: "globex-key", Bits: 512},
+				},
+			},
+		}
+	)
+
+	factory, err := NewFactory(o, ClaimBuilders{requestClaimBuilder{}}, registry)
+	require.NoError(err)
+	assert.Equal([]string{"acme", "default", "globex-key"}, registry.Kids())
+
+	rb, err := NewRequestBuilders(o)
+	require.NoError(err)
+
+	issue := func(tenant string) (string, error) {
+		original := httptest.NewRequest("GET", "/", nil)
+		if len(tenant) > 0 {
+			original.Header.Set("X-Tenant", tenant)
+		}
+
+		require.NoError(original.ParseForm())
+		tr, err := BuildRequest(original, rb)
+		if err != nil {
+			return "", err
+		}
+
+		return factory.NewToken(context.Background(), tr)
+	}
+
+	for tenant, expectedKid := range map[string]string{"acme": "acme", "GLOBEX": "globex-key"} {
+		signed, err := issue(tenant)
+		require.NoError(err)
+
+		parsed, err := jwt.Parse(signed, func(token *jwt.Token) (interface{}, error) {
+			pair, ok := registry.Get(token.Header["kid"].(string))
+			require.True(ok)
+			return &pair.Sign().(*rsa.PrivateKey).PublicKey, nil
+		})
+
+		require.NoError(err)
+		assert.True(parsed.Valid)
+		assert.Equal(expectedKid, parsed.Header["kid"])
+	}
+
+	_, ok := registry.LastUsed("default")
+	assert.False(ok)
+
+	_, err = issue("initech")
+	require.Error(err)
+	assert.Equal(UnknownTenantError{Tenant: "initech"}, err)
+	assert.Equal(http.StatusBadRequest, err.(UnknownTenantError).StatusCode())
+
+	_, err = issue("")
+	require.Error(err)
+	assert.Equal(http.StatusBadRequest, err.(BuildError).StatusCode())
+}
+
+func testNewFactoryStagedKey(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		registry = key.NewRegistry(rand.Reader)
+		keySet   = key.NewHandlerJWKSet(key.NewKeySetEndpoint(registry))
+	)
+
+	factory, err := NewFactory(Options{Key: key.Descriptor{Kid: "current", Bits: 512}}, ClaimBuilders{}, registry)
+	require.NoError(err)
+
+	_, err = registry.Stage(key.Descriptor{Kid: "next", Bits: 512})
+	require.NoError(err)
+
+	response := httptest.NewRecorder()
+	keySet.ServeHTTP(response, httptest.NewRequest("GET", "/keys", nil))
+	require.Equal(http.StatusOK, response.Code)
+	set, err := jwk.Parse(response.Body)
+	require.NoError(err)
+	assert.Len(set.LookupKeyID("current"), 1)
+	assert.Len(set.LookupKeyID("next"), 1)
+
+	signingKid := func() interface{} {
+		signed, err := factory.NewToken(context.Background(), new(Request))
+		require.NoError(err)
+
+		parsed, _, err := new(jwt.Parser).ParseUnverified(signed, jwt.MapClaims{})
+		require.NoError(err)
+		return parsed.Header["kid"]
+	}
+
+	assert.Equal("current", signingKid())
+	_, ok := registry.LastUsed("next")
+	assert.False(ok)
+
+	_, err = registry.Promote("next")
+	require.NoError(err)
+	assert.Equal("next", signingKid())
+}
+
+func testNewFactoryRotation(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		registry = key.NewRegistry(rand.Reader)
+		keySet   = key.NewHandlerJWKSet(key.NewKeySetEndpoint(registry))
+		now      = clocktest.NewFake(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+	)
+
+	tf, err := NewFactory(
+		Options{
+			Key:   key.Descriptor{Kid: "test", Bits: 512, RotateInterval: 24 * time.Hour},
+			clock: now,
+		},
+		ClaimBuilders{},
+		registry,
+	)
+
+	require.NoError(err)
+	rotator := tf.(*factory).rotator
+	require.NotNil(rotator)
+
+	signingKid := func() interface{} {
+		signed, err := tf.NewToken(context.Background(), new(Request))
+		require.NoError(err)
+
+		parsed, _, err := new(jwt.Parser).ParseUnverified(signed, jwt.MapClaims{})
+		require.NoError(err)
+		return parsed.Header["kid"]
+	}
+
+	assert.Equal("test", signingKid())
+
+	// a staged key is published before it signs anything
+	_, err = rotator.Stage()
+	require.NoError(err)
+	assert.Equal("test", signingKid())
+	response := httptest.NewRecorder()
+	keySet.ServeHTTP(response, httptest.NewRequest("GET", "/keys", nil))
+	require.Equal(http.StatusOK, response.Code)
+	set, err := jwk.Parse(response.Body)
+	require.NoError(err)
+	assert.Len(set.LookupKeyID("test-2024-06-01"), 1)
+
+	_, err = rotator.Promote()
+	require.NoError(err)
+	assert.Equal("test-2024-06-01", signingKid())
+
+	// the previous key is still published, so that tokens it signed remain verifiable
+	response = httptest.NewRecorder()
+	keySet.ServeHTTP(response, httptest.NewRequest("GET", "/keys", nil))
+	require.Equal(http.StatusOK, response.Code)
+	set, err = jwk.Parse(response.Body)
+	require.NoError(err)
+	assert.Len(set.LookupKeyID("test"), 1)
+	assert.Len(set.LookupKeyID("test-2024-06-01"), 1)
+
+	now.Add(24 * time.Hour)
+	_, err = rotator.Rotate()
+	require.NoError(err)
+	assert.Equal("test-2024-06-02", signingKid())
+	assert.Equal([]string{"test-2024-06-01", "test-2024-06-02"}, registry.Kids())
+}
+
+func testNewFactoryThumbprintKid(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		registry = key.NewRegistry(rand.Reader)
+	)
+
+	factory, err := NewFactory(Options{Key: key.Descriptor{Bits: 512, Thumbprint: true}}, ClaimBuilders{}, registry)
+	require.NoError(err)
+
+	kids := registry.Kids()
+	require.Len(kids, 1)
+	pair, _ := registry.Get(kids[0])
+	thumbprint, err := key.Thumbprint(pair)
+	require.NoError(err)
+	assert.Equal(thumbprint, kids[0])
+
+	signed, err := factory.NewToken(context.Background(), new(Request))
+	require.NoError(err)
+	parsed, _, err := new(jwt.Parser).ParseUnverified(signed, jwt.MapClaims{})
+	require.NoError(err)
+	assert.Equal(thumbprint, parsed.Header["kid"])
+
+	// the published JWK set must use the same kid
+	assert.NotNil(publishedKey(t, registry, thumbprint))
+}
+
+func testNewFactoryJKU(t *testing.T) {
+	const jku = "https://keys.example.com/keys"
+	for _, o := range []Options{{}, {CanonicalClaims: true}, {CompressClaims: true}} {
+		var (
+			assert  = assert.New(t)
+			require = require.New(t)
+		)
+
+		o.Key = key.Descriptor{Kid: "jku", Bits: 512}
+		o.JKU = jku
+		factory, err := NewFactory(o, ClaimBuilders{}, key.NewRegistry(rand.Reader))
+		require.NoError(err)
+
+		signed, err := factory.NewToken(context.Background(), NewRequest())
+		require.NoError(err)
+
+		// decode the header directly, since a compressed payload isn't JSON
+		segment, err := jwt.DecodeSegment(strings.Split(signed, ".")[0])
+		require.NoError(err)
+		var header map[string]interface{}
+		require.NoError(json.Unmarshal(segment, &header))
+		assert.Equal("jku", header["kid"])
+		assert.Equal(jku, header["jku"])
+	}
+}
+
+func testNewFactoryInvalidJKU(t *testing.T) {
+	for _, jku := range []string{"http://keys.example.com/keys", "/keys", "keys.example.com/keys", "https:///keys", "https://%zz"} {
+		var (
+			assert   = assert.New(t)
+			registry = key.NewRegistry(rand.Reader)
+		)
+
+		factory, err := NewFactory(Options{Key: key.Descriptor{Kid: "jku", Bits: 512}, JKU: jku}, ClaimBuilders{}, registry)
+		assert.Nil(factory, jku)
+		assert.Equal(InvalidJKUError{JKU: jku}, err, jku)
+		assert.Empty(registry.Kids())
+	}
+}
+
+func testNewFactoryEmptiedRegistry(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		registry = key.NewRegistry(rand.Reader)
+		output   bytes.Buffer
+		logger   = log.NewJSONLogger(&output)
+	)
+
+	factory, err := NewFactory(Options{Key: key.Descriptor{Kid: "pruned", Bits: 512}}, ClaimBuilders{}, registry)
+	require.NoError(err)
+
+	for _, kid := range registry.Kids() {
+		require.True(registry.Remove(kid))
+	}
+
+	require.Empty(registry.Kids())
+
+	var signed string
+	require.NotPanics(func() {
+		signed, err = factory.NewToken(xlog.With(context.Background(), logger), NewRequest())
+	})
+
+	assert.Empty(signed)
+	assert.Equal(NoSigningKeyError{Kid: "pruned"}, err)
+
+	response := httptest.NewRecorder()
+	NewIssueHandler(NewIssueEndpoint(factory), RequestBuilders{}).ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(http.StatusServiceUnavailable, response.Code)
+	assert.Contains(response.Body.String(), "No signing key is available")
+
+	assert.Contains(output.String(), `"level":"error"`)
+	assert.Contains(output.String(), `"kid":"pruned"`)
+}
+
+func testNewFactoryTenantsNoSource(t *testing.T) {
+	assert := assert.New(t)
+	rb, err := NewRequestBuilders(Options{Tenant: &Tenant{}})
+	assert.Empty(rb)
+	assert.Equal(ErrTenantSourceRequired, err)
+}
+
+// unavailableMethod is a jwt.SigningMethod that fails whenever it is given a particular signing key, as if that
+// key's backend were unavailable
+type unavailableMethod struct {
+	jwt.SigningMethod
+	unavailable interface{}
+}
+
+func (um unavailableMethod) Sign(signingString string, key interface{}) (string, error) {
+	if key == um.unavailable {
+		return "", errors.New("key backend unavailable")
+	}
+
+	return um.SigningMethod.Sign(signingString, key)
+}
+
+func testNewFactoryFallback(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		registry = key.NewRegistry(rand.Reader)
+		output   bytes.Buffer
+		logger   = log.NewJSONLogger(&output)
+	)
+
+	tf, err := NewFactory(
+		Options{
+			Key:      key.Descriptor{Kid: "active", Bits: 512},
+			Fallback: &key.Descriptor{Kid: "secondary", Bits: 512},
+		},
+		ClaimBuilders{requestClaimBuilder{}},
+		registry,
+	)
+
+	require.NoError(err)
+	active, ok := registry.Active()
+	require.True(ok)
+	assert.Equal("active", active.KID())
+	secondary, ok := registry.Fallback()
+	require.True(ok)
+	assert.Equal("secondary", secondary.KID())
+
+	f := tf.(*factory)
+	f.method = unavailableMethod{SigningMethod: f.method, unavailable: active.Sign()}
+
+	signed, err := tf.NewToken(xlog.With(context.Background(), logger), NewRequest())
+	require.NoError(err)
+
+	// the token verifies against the fallback key and names it as the signer
+	token, err := jwt.Parse(signed, func(*jwt.Token) (interface{}, error) {
+		return &secondary.Sign().(*rsa.PrivateKey).PublicKey, nil
+	})
+
+	require.NoError(err)
+	assert.Equal("secondary", token.Header["kid"])
+
+	_, ok = registry.LastUsed("secondary")
+	assert.True(ok)
+	_, ok = registry.LastUsed("active")
+	assert.False(ok)
+
+	assert.Contains(output.String(), `"level":"warn"`)
+	assert.Contains(output.String(), `"kid":"active"`)
+	assert.Contains(output.String(), `"fallback":"secondary"`)
+	assert.Contains(output.String(), "key backend unavailable")
+
+	// when the active key recovers, it signs again
+	f.method = f.method.(unavailableMethod).SigningMethod
+	signed, err = tf.NewToken(context.Background(), NewRequest())
+	require.NoError(err)
+	token, _, err = new(jwt.Parser).ParseUnverified(signed, jwt.MapClaims{})
+	require.NoError(err)
+	assert.Equal("active", token.Header["kid"])
+}
+
+// slowMethod is a jwt.SigningMethod that hangs whenever it is given a particular signing key, until released
+type slowMethod struct {
+	jwt.SigningMethod
+	slow    interface{}
+	release <-chan struct{}
+}
+
+func (sm slowMethod) Sign(signingString string, key interface{}) (string, error) {
+	if key == sm.slow {
+		<-sm.release
+	}
+
+	return sm.SigningMethod.Sign(signingString, key)
+}
+
+func testNewFactorySignTimeout(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		registry = key.NewRegistry(rand.Reader)
+		release  = make(chan struct{})
+	)
+
+	defer close(release)
+
+	tf, err := NewFactory(
+		Options{Key: key.Descriptor{Kid: "slow", Bits: 512, SignTimeout: 10 * time.Millisecond}},
+		ClaimBuilders{requestClaimBuilder{}},
+		registry,
+	)
+
+	require.NoError(err)
+	active, ok := registry.Active()
+	require.True(ok)
+
+	f := tf.(*factory)
+	f.method = slowMethod{SigningMethod: f.method, slow: active.Sign(), release: release}
+
+	signed, err := tf.NewToken(context.Background(), NewRequest())
+	assert.Empty(signed)
+	assert.Equal(key.SignTimeoutError{Kid: "slow", Timeout: 10 * time.Millisecond}, err)
+	assert.Equal(ErrorCodeTimeout, ErrorCode(err))
+
+	response := httptest.NewRecorder()
+	NewIssueHandler(NewIssueEndpoint(tf), RequestBuilders{}).ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(http.StatusServiceUnavailable, response.Code)
+	assert.Contains(response.Body.String(), "did not sign within")
+}
+
+func testNewFactorySignTimeoutFallback(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		registry = key.NewRegistry(rand.Reader)
+		release  = make(chan struct{})
+	)
+
+	defer close(release)
+
+	tf, err := NewFactory(
+		Options{
+			Key:      key.Descriptor{Kid: "slow", Bits: 512, SignTimeout: 10 * time.Millisecond},
+			Fallback: &key.Descriptor{Kid: "secondary", Bits: 512},
+		},
+		ClaimBuilders{requestClaimBuilder{}},
+		registry,
+	)
+
+	require.NoError(err)
+	active, ok := registry.Active()
+	require.True(ok)
+	secondary, ok := registry.Fallback()
+	require.True(ok)
+
+	f := tf.(*factory)
+	f.method = slowMethod{SigningMethod: f.method, slow: active.Sign(), release: release}
+
+	signed, err := tf.NewToken(context.Background(), NewRequest())
+	require.NoError(err)
+
+	token, err := jwt.Parse(signed, func(*jwt.Token) (interface{}, error) {
+		return &secondary.Sign().(*rsa.PrivateKey).PublicKey, nil
+	})
+
+	require.NoError(err)
+	assert.Equal("secondary", token.Header["kid"])
+}
+
+func testNewFactoryLogTokenStats(t *testing.T, logStats bool) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		output bytes.Buffer
+		logger = log.NewJSONLogger(&output)
+	)
+
+	tf, err := NewFactory(
+		Options{
+			Key:           key.Descriptor{Kid: "test", Bits: 512},
+			LogTokenStats: logStats,
+		},
+		ClaimBuilders{requestClaimBuilder{}},
+		key.NewRegistry(nil),
+	)
+
+	require.NoError(err)
+
+	// each reading of the clock advances it by a millisecond
+	current := time.Now()
+	tf.(*factory).now = func() time.Time {
+		current = current.Add(time.Millisecond)
+		return current
+	}
+
+	r := NewRequest()
+	r.Claims["sub"] = "device"
+	signed, err := tf.NewToken(xlog.With(context.Background(), logger), r)
+	require.NoError(err)
+	require.NotEmpty(signed)
+
+	var logged map[string]interface{}
+	require.NoError(json.Unmarshal(output.Bytes(), &logged))
+	assert.Equal("issued token", logged["msg"])
+
+	if logStats {
+		assert.Equal(float64(len(signed)), logged["size"])
+		assert.Equal("1ms", logged["signDuration"])
+		assert.Equal("3ms", logged["duration"])
+	} else {
+		assert.NotContains(logged, "size")
+		assert.NotContains(logged, "signDuration")
+		assert.NotContains(logged, "duration")
+	}
+}
+
+func testNewFactoryPinnedAlg(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		registry = key.NewRegistry(nil)
+	)
+
+	// with no Alg, the factory signs with the key's pinned algorithm
+	f, err := NewFactory(
+		Options{Key: key.Descriptor{Kid: "pinned", Type: key.KeyTypeECDSA, Bits: 256, Alg: "ES256"}},
+		ClaimBuilders{},
+		registry,
+	)
+
+	require.NoError(err)
+	signed, err := f.NewToken(context.Background(), NewRequest())
+	require.NoError(err)
+
+	token, _, err := new(jwt.Parser).ParseUnverified(signed, jwt.MapClaims{})
+	require.NoError(err)
+	assert.Equal("ES256", token.Header["alg"])
+
+	result, err := key.NewKeySetEndpoint(registry)(context.Background(), nil)
+	require.NoError(err)
+	ks := result.(key.KeySet)
+	require.Len(ks.Keys, 1)
+	assert.Equal("pinned", ks.Keys[0]["kid"])
+	assert.Equal("ES256", ks.Keys[0]["alg"])
+}
+
+func testNewFactoryPinnedAlgMismatch(t *testing.T) {
+	testData := []struct {
+		name     string
+		options  Options
+		expected error
+	}{
+		{
+			name:     "Factory",
+			options:  Options{Alg: "ES384", Key: key.Descriptor{Kid: "pinned", Type: key.KeyTypeECDSA, Bits: 256, Alg: "ES256"}},
+			expected: PinnedAlgorithmError{Kid: "pinned", Pinned: "ES256", Alg: "ES384"},
+		},
+		{
+			name: "Fallback",
+			options: Options{
+				Alg:      "RS256",
+				Key:      key.Descriptor{Kid: "primary", Bits: 512},
+				Fallback: &key.Descriptor{Kid: "fallback", Bits: 512, Alg: "PS256"},
+			},
+			expected: PinnedAlgorithmError{Kid: "fallback", Pinned: "PS256", Alg: "RS256"},
+		},
+		{
+			name:     "KeyType",
+			options:  Options{Key: key.Descriptor{Kid: "pinned", Bits: 512, Alg: "ES256"}},
+			expected: key.AlgorithmMismatchError{Kid: "pinned", Alg: "ES256"},
+		},
+	}
+
+	for _, record := range testData {
+		t.Run(record.name, func(t *testing.T) {
+			f, err := NewFactory(record.options, ClaimBuilders{}, key.NewRegistry(nil))
+			assert.Nil(t, f)
+			assert.Equal(t, record.expected, err)
+			assert.NotEmpty(t, err.Error())
+		})
+	}
+}
+
+func testNewFactoryKeyTypeMismatch(t *testing.T) {
+	testData := []struct {
+		name     string
+		options  Options
+		expected error
+	}{
+		{
+			name:     "Primary",
+			options:  Options{Alg: "RS256", Key: key.Descriptor{Kid: "primary", Type: key.KeyTypeECDSA, Bits: 256}},
+			expected: key.AlgorithmMismatchError{Kid: "primary", Alg: "RS256"},
+		},
+		{
+			name:     "Secret",
+			options:  Options{Alg: "RS256", Key: key.Descriptor{Kid: "primary", Type: key.KeyTypeSecret}},
+			expected: key.AlgorithmMismatchError{Kid: "primary", Alg: "RS256"},
+		},
+		{
+			name: "Fallback",
+			options: Options{
+				Alg:      "RS256",
+				Key:      key.Descriptor{Kid: "primary", Bits: 512},
+				Fallback: &key.Descriptor{Kid: "fallback", Type: key.KeyTypeSecret},
+			},
+			expected: key.AlgorithmMismatchError{Kid: "fallback", Alg: "RS256"},
+		},
+		{
+			name: "Tenant",
+			options: Options{
+				Alg: "RS256",
+				Key: key.Descriptor{Kid: "primary", Bits: 512},
+				Tenant: &Tenant{
+					Header: "X-Tenant",
+					Keys: map[string]key.Descriptor{
+						"acme": key.Descriptor{Kid: "acme", Type: key.KeyTypeECDSA, Bits: 256},
+					},
+				},
+			},
+			expected: key.AlgorithmMismatchError{Kid: "acme", Alg: "RS256"},
+		},
+		{
+			name: "Algorithm",
+			options: Options{
+				Alg: "RS256",
+				Key: key.Descriptor{Kid: "primary", Bits: 512},
+				Algorithms: &Algorithms{
+					Header: "X-Alg",
+					Keys: map[string]key.Descriptor{
+						"ES256": key.Descriptor{Kid: "es256", Bits: 512},
+					},
+				},
+			},
+			expected: key.AlgorithmMismatchError{Kid: "es256", Alg: "ES256"},
+		},
+		{
+			name: "Signatures",
+			options: Options{
+				Alg:        "RS256",
+				Key:        key.Descriptor{Kid: "primary", Bits: 512},
+				Signatures: &Signatures{Kids: []string{"primary", "second"}},
+			},
+			expected: key.AlgorithmMismatchError{Kid: "second", Alg: "RS256"},
+		},
+	}
+
+	for _, record := range testData {
+		t.Run(record.name, func(t *testing.T) {
+			registry := key.NewRegistry(nil)
+			_, err := registry.Register(key.Descriptor{Kid: "second", Type: key.KeyTypeSecret})
+			require.NoError(t, err)
+
+			f, err := NewFactory(record.options, ClaimBuilders{}, registry)
+			assert.Nil(t, f)
+			assert.Equal(t, record.expected, err)
+			assert.NotEmpty(t, err.Error())
+		})
+	}
+}
+
+func testNewFactoryCurveMismatch(t *testing.T) {
+	testData := []struct {
+		name       string
+		alg        string
+		descriptor key.Descriptor
+	}{
+		{"ES256WithP384", "ES256", key.Descriptor{Kid: "test", Type: key.KeyTypeECDSA, Bits: 384}},
+		{"ES384WithP256", "ES384", key.Descriptor{Kid: "test", Type: key.KeyTypeECDSA, Bits: 256}},
+		{"ES512WithP384", "ES512", key.Descriptor{Kid: "test", Type: key.KeyTypeECDSA, Bits: 384}},
+		{"ES256WithEd25519", "ES256", key.Descriptor{Kid: "test", Type: key.KeyTypeEd25519}},
+		{"EdDSAWithECDSA", "EdDSA", key.Descriptor{Kid: "test", Type: key.KeyTypeECDSA, Bits: 256}},
+		{"EdDSAWithRSA", "EdDSA", key.Descriptor{Kid: "test", Bits: 512}},
+	}
+
+	for _, record := range testData {
+		t.Run(record.name, func(t *testing.T) {
+			f, err := NewFactory(Options{Alg: record.alg, Key: record.descriptor}, ClaimBuilders{}, key.NewRegistry(nil))
+			assert.Nil(t, f)
+			assert.Equal(t, key.AlgorithmMismatchError{Kid: "test", Alg: record.alg}, err)
+		})
+	}
 }
 
 func TestNewFactory(t *testing.T) {
 	t.Run("InvalidAlg", testNewFactoryInvalidAlg)
 	t.Run("InvalidKeyType", testNewFactoryInvalidKeyType)
 	t.Run("Success", testNewFactorySuccess)
+	t.Run("Algorithms", testNewFactoryAlgorithms)
+	t.Run("Tenants", testNewFactoryTenants)
+	t.Run("TenantsNoSource", testNewFactoryTenantsNoSource)
+	t.Run("StagedKey", testNewFactoryStagedKey)
+	t.Run("Rotation", testNewFactoryRotation)
+	t.Run("ThumbprintKid", testNewFactoryThumbprintKid)
+	t.Run("JKU", testNewFactoryJKU)
+	t.Run("InvalidJKU", testNewFactoryInvalidJKU)
+	t.Run("EmptiedRegistry", testNewFactoryEmptiedRegistry)
+	t.Run("Fallback", testNewFactoryFallback)
+	t.Run("SignTimeout", testNewFactorySignTimeout)
+	t.Run("SignTimeoutFallback", testNewFactorySignTimeoutFallback)
+	t.Run("LogTokenStats", func(t *testing.T) { testNewFactoryLogTokenStats(t, true) })
+	t.Run("NoTokenStats", func(t *testing.T) { testNewFactoryLogTokenStats(t, false) })
+	t.Run("PinnedAlg", testNewFactoryPinnedAlg)
+	t.Run("PinnedAlgMismatch", testNewFactoryPinnedAlgMismatch)
+	t.Run("KeyTypeMismatch", testNewFactoryKeyTypeMismatch)
+	t.Run("CurveMismatch", testNewFactoryCurveMismatch)
 }
@@ -0,0 +1,190 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DefaultGRPCMetadataPrefix is the header prefix used by gRPC gateways to forward metadata over HTTP
+const DefaultGRPCMetadataPrefix = "Grpc-Metadata-"
+
+var (
+	ErrGRPCMetadataKeysRequired = errors.New("gRPC metadata requires an explicit list of keys")
+)
+
+// GRPCMetadataKeyError indicates that a forwarded gRPC metadata key would set a claim or metadata key that is
+// registered by RFC 7519 or produced by another part of the token configuration
+type GRPCMetadataKeyError struct {
+	Key string
+}
+
+func (gmke GRPCMetadataKeyError) Error() string {
+	return fmt.Sprintf("The gRPC metadata key %s collides with a reserved or configured name", gmke.Key)
+}
+
+// registeredClaims are the claim names defined by RFC 7519, which forwarded metadata can never set
+var registeredClaims = []string{"iss", "sub", "aud", "exp", "nbf", "iat", "jti"}
+
+// nameOr returns name, or def if name is unset
+func nameOr(name, def string) string {
+	if len(name) > 0 {
+		return name
+	}
+
+	return def
+}
+
+// ownedNames returns the claim names, or the metadata names if metadata is true, that something other than
+// forwarded gRPC metadata produces
+func ownedNames(o Options, metadata bool) map[string]bool {
+	owned := make(map[string]bool)
+	add := func(names ...string) {
+		for _, n := range names {
+			if len(n) > 0 {
+				owned[strings.ToLower(n)] = true
+			}
+		}
+	}
+
+	if metadata {
+		for name := range o.Metadata {
+			add(name)
+		}
+
+		add(TenantMetadata, AlgorithmMetadata)
+		if o.PartnerID != nil {
+			add(o.PartnerID.Metadata)
+		}
+
+		if o.BasicAuth != nil {
+			add(o.BasicAuth.Metadata)
+		}
+
+		return owned
+	}
+
+	add(registeredClaims...)
+	for name := range o.Claims {
+		add(name)
+	}
+
+	if o.PartnerID != nil {
+		add(o.PartnerID.Claim)
+	}
+
+	if o.BasicAuth != nil {
+		add(nameOr(o.BasicAuth.Claim, DefaultBasicAuthClaim))
+	}
+
+	if o.Locale != nil {
+		add(nameOr(o.Locale.Claim, DefaultLocaleClaim))
+	}
+
+	if o.AuthTime != nil {
+		add(nameOr(o.AuthTime.Claim, DefaultAuthTimeClaim))
+	}
+
+	if o.AMR != nil {
+		add(nameOr(o.AMR.Claim, DefaultAMRClaim))
+	}
+
+	if o.AtHash != nil {
+		add(nameOr(o.AtHash.Claim, DefaultAtHashClaim))
+	}
+
+	if o.Confirmation != nil {
+		add(nameOr(o.Confirmation.Claim, DefaultConfirmationClaim))
+	}
+
+	if o.Sequence != nil {
+		add(nameOr(o.Sequence.Claim, DefaultSequenceClaim))
+	}
+
+	if o.Scope != nil {
+		add(nameOr(o.Scope.Claim, DefaultScopeClaim))
+	}
+
+	if o.SignedCookie != nil {
+		for name := range o.SignedCookie.Claims {
+			add(name)
+		}
+	}
+
+	return owned
+}
+
+// GRPCMetadata describes how to map gRPC metadata, forwarded by a gateway as prefixed HTTP headers,
+// into claims.  The prefix is stripped and the remainder of the header name, lowercased as gRPC metadata
+// keys are, becomes the claim name.  For example, a Grpc-Metadata-Device-Id header produces a device-id claim.
+type GRPCMetadata struct {
+	// Prefix is the header prefix that marks forwarded metadata.  It is matched case insensitively.
+	// If unset, DefaultGRPCMetadataPrefix is used.
+	Prefix string
+
+	// Keys lists the metadata keys that are mapped, e.g. device-id.  Any other forwarded key is ignored.
+	// This field is required, and no key may name an RFC 7519 registered claim or a claim, or metadata key,
+	// that is produced by another part of the configuration.
+	Keys []string
+
+	// Metadata indicates that forwarded keys are set as token metadata rather than as claims,
+	// so that they are only transmitted to a remote claims server
+	Metadata bool
+}
+
+type grpcMetadataRequestBuilder struct {
+	prefix string
+	keys   map[string]bool
+	setter func(string, interface{}, *Request)
+}
+
+func (gmrb grpcMetadataRequestBuilder) Build(original *http.Request, tr *Request) error {
+	for name, values := range original.Header {
+		if len(name) <= len(gmrb.prefix) || len(values) == 0 || !strings.EqualFold(name[:len(gmrb.prefix)], gmrb.prefix) {
+			continue
+		}
+
+		key := strings.ToLower(name[len(gmrb.prefix):])
+		if !gmrb.keys[key] {
+			continue
+		}
+
+		gmrb.setter(key, values[0], tr)
+	}
+
+	return nil
+}
+
+func newGRPCMetadataRequestBuilder(o Options) (RequestBuilder, error) {
+	gm := *o.GRPCMetadata
+	if len(gm.Keys) == 0 {
+		return nil, ErrGRPCMetadataKeysRequired
+	}
+
+	gmrb := grpcMetadataRequestBuilder{
+		prefix: gm.Prefix,
+		keys:   make(map[string]bool, len(gm.Keys)),
+		setter: claimsSetter,
+	}
+
+	if len(gmrb.prefix) == 0 {
+		gmrb.prefix = DefaultGRPCMetadataPrefix
+	}
+
+	if gm.Metadata {
+		gmrb.setter = metadataSetter
+	}
+
+	owned := ownedNames(o, gm.Metadata)
+	for _, k := range gm.Keys {
+		k = strings.ToLower(k)
+		if owned[k] {
+			return nil, GRPCMetadataKeyError{Key: k}
+		}
+
+		gmrb.keys[k] = true
+	}
+
+	return gmrb, nil
+}
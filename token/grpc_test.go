@@ -0,0 +1,145 @@
+package token
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testGRPCMetadataKeysRequired(t *testing.T) {
+	assert := assert.New(t)
+	rb, err := NewRequestBuilders(Options{GRPCMetadata: &GRPCMetadata{}})
+	assert.Nil(rb)
+	assert.Equal(ErrGRPCMetadataKeysRequired, err)
+}
+
+func testGRPCMetadataKeys(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		request = httptest.NewRequest("GET", "/", nil)
+	)
+
+	rb, err := NewRequestBuilders(Options{
+		GRPCMetadata: &GRPCMetadata{
+			Keys: []string{"device-id", "firmware"},
+		},
+	})
+
+	require.NoError(err)
+	request.Header.Set("Grpc-Metadata-Device-Id", "mac:112233445566")
+	request.Header.Set("grpc-metadata-firmware", "1.2.3")
+	request.Header.Set("Grpc-Metadata-Region", "not listed")
+	request.Header.Set("X-Device-Id", "not forwarded metadata")
+	request.Header.Set("Grpc-Metadata-", "empty key")
+
+	tr, err := BuildRequest(request, rb)
+	require.NoError(err)
+	assert.Equal(
+		map[string]interface{}{
+			"device-id": "mac:112233445566",
+			"firmware":  "1.2.3",
+		},
+		tr.Claims,
+	)
+
+	assert.Empty(tr.Metadata)
+}
+
+func testGRPCMetadataOwnedKeys(t *testing.T) {
+	testData := []struct {
+		name    string
+		options Options
+		key     string
+	}{
+		{"Registered", Options{}, "sub"},
+		{"RegisteredCase", Options{}, "AUD"},
+		{"Claim", Options{Claims: map[string]Value{"region": {Header: "X-Region"}}}, "region"},
+		{"BasicAuth", Options{BasicAuth: &BasicAuth{}}, DefaultBasicAuthClaim},
+		{"PartnerID", Options{PartnerID: &PartnerID{Claim: "partner-id", Header: "X-Partner"}}, "partner-id"},
+		{"Locale", Options{Locale: &Locale{}}, DefaultLocaleClaim},
+		{"Confirmation", Options{Confirmation: &Confirmation{}}, DefaultConfirmationClaim},
+		{"Tenant", Options{Tenant: &Tenant{Header: "X-Tenant"}, GRPCMetadata: &GRPCMetadata{Metadata: true}}, TenantMetadata},
+		{"Metadata", Options{Metadata: map[string]Value{"pid": {Header: "X-Pid"}}, GRPCMetadata: &GRPCMetadata{Metadata: true}}, "pid"},
+	}
+
+	for _, record := range testData {
+		t.Run(record.name, func(t *testing.T) {
+			assert := assert.New(t)
+			if record.options.GRPCMetadata == nil {
+				record.options.GRPCMetadata = new(GRPCMetadata)
+			}
+
+			record.options.GRPCMetadata.Keys = []string{"device-id", record.key}
+			rb, err := NewRequestBuilders(record.options)
+			assert.Nil(rb)
+			assert.Equal(GRPCMetadataKeyError{Key: strings.ToLower(record.key)}, err)
+			assert.Contains(err.Error(), strings.ToLower(record.key))
+		})
+	}
+}
+
+// testGRPCMetadataForgedClaims verifies that forwarded headers cannot supply claims that another
+// builder owns, e.g. a client_id that would otherwise require basic auth credentials
+func testGRPCMetadataForgedClaims(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		request = httptest.NewRequest("GET", "/", nil)
+	)
+
+	rb, err := NewRequestBuilders(Options{
+		GRPCMetadata: &GRPCMetadata{Keys: []string{"device-id"}},
+		PartnerID:    &PartnerID{Claim: "partner-id", Header: "X-Partner-Id"},
+		BasicAuth:    &BasicAuth{Clients: []Client{{ID: "admin", Secret: "secret"}}},
+	})
+
+	require.NoError(err)
+	request.Header.Set("Grpc-Metadata-Device-Id", "mac:112233445566")
+	request.Header.Set("Grpc-Metadata-Client_id", "admin")
+	request.Header.Set("Grpc-Metadata-Partner-Id", "victim")
+
+	tr, err := BuildRequest(request, rb)
+	require.NoError(err)
+	assert.Equal(map[string]interface{}{"device-id": "mac:112233445566"}, tr.Claims)
+}
+
+func testGRPCMetadataSelectedKeys(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		request = httptest.NewRequest("GET", "/", nil)
+	)
+
+	rb, err := NewRequestBuilders(Options{
+		GRPCMetadata: &GRPCMetadata{
+			Prefix:   "x-gw-",
+			Keys:     []string{"Device-Id"},
+			Metadata: true,
+		},
+	})
+
+	require.NoError(err)
+	request.Header.Set("X-Gw-Device-Id", "mac:112233445566")
+	request.Header.Set("X-Gw-Firmware", "1.2.3")
+	request.Header.Set("Grpc-Metadata-Device-Id", "wrong prefix")
+
+	tr, err := BuildRequest(request, rb)
+	require.NoError(err)
+	assert.Empty(tr.Claims)
+	assert.Equal(map[string]interface{}{"device-id": "mac:112233445566"}, tr.Metadata)
+}
+
+func TestGRPCMetadata(t *testing.T) {
+	t.Run("KeysRequired", testGRPCMetadataKeysRequired)
+	t.Run("Keys", testGRPCMetadataKeys)
+	t.Run("OwnedKeys", testGRPCMetadataOwnedKeys)
+	t.Run("ForgedClaims", testGRPCMetadataForgedClaims)
+	t.Run("SelectedKeys", testGRPCMetadataSelectedKeys)
+}
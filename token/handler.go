@@ -19,10 +19,11 @@ func NewIssueHandler(e endpoint.Endpoint, rb RequestBuilders) IssueHandler {
 
 type ClaimsHandler http.Handler
 
-func NewClaimsHandler(e endpoint.Endpoint, rb RequestBuilders) ClaimsHandler {
+func NewClaimsHandler(e endpoint.Endpoint, rb RequestBuilders, options ...kithttp.ServerOption) ClaimsHandler {
 	return kithttp.NewServer(
 		e,
 		DecodeServerRequest(rb),
 		kithttp.EncodeJSONResponse,
+		options...,
 	)
 }
@@ -44,7 +44,7 @@ func TestNewIssueHandler(t *testing.T) {
 	require.NotNil(handler)
 	request.Header.Set("Claim", "fromHeader")
 	handler.ServeHTTP(response, request)
-	assert.Equal("application/jose", response.HeaderMap.Get("Content-Type"))
+	assert.Equal(DefaultResponseContentType, response.HeaderMap.Get("Content-Type"))
 	assert.Equal("endpoint=run,claim=fromHeader", response.Body.String())
 }
 
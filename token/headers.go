@@ -0,0 +1,79 @@
+package token
+
+import (
+	"fmt"
+)
+
+// reservedHeaders are the JOSE header parameters that the factory sets itself, or that RFC 7515, 7516, or 7797
+// define, and which therefore can neither be configured as custom headers nor marked critical.  In particular,
+// zip and b64 describe how the payload is encoded, so a verifier would misread a token that carried them.
+var reservedHeaders = map[string]bool{
+	"alg":      true,
+	"jku":      true,
+	"jwk":      true,
+	"kid":      true,
+	"x5u":      true,
+	"x5c":      true,
+	"x5t":      true,
+	"x5t#S256": true,
+	"typ":      true,
+	"cty":      true,
+	"crit":     true,
+	"zip":      true,
+	"b64":      true,
+}
+
+// ReservedHeaderError is returned at startup when a configured custom header is one of the
+// header parameters defined by RFC 7515, 7516, or 7797
+type ReservedHeaderError struct {
+	Name string
+}
+
+func (rhe ReservedHeaderError) Error() string {
+	return fmt.Sprintf("Header %s is reserved and cannot be configured", rhe.Name)
+}
+
+// InvalidCriticalHeaderError is returned at startup when a name listed as critical is not one of the
+// configured custom headers, or is listed more than once
+type InvalidCriticalHeaderError struct {
+	Name string
+}
+
+func (iche InvalidCriticalHeaderError) Error() string {
+	return fmt.Sprintf("Critical header %s must be a configured custom header, listed only once", iche.Name)
+}
+
+// newHeaders validates the configured custom headers and critical header names, returning the
+// parameters added to every token's JOSE header.  The crit parameter is included if any headers
+// are critical.  If no custom headers are configured, this function returns nil.
+func newHeaders(o Options) (map[string]interface{}, error) {
+	if len(o.Headers) == 0 && len(o.Crit) == 0 {
+		return nil, nil
+	}
+
+	headers := make(map[string]interface{}, len(o.Headers)+1)
+	for name, value := range o.Headers {
+		if reservedHeaders[name] {
+			return nil, ReservedHeaderError{Name: name}
+		}
+
+		headers[name] = value
+	}
+
+	if len(o.Crit) > 0 {
+		crit := make([]string, 0, len(o.Crit))
+		seen := make(map[string]bool, len(o.Crit))
+		for _, name := range o.Crit {
+			if _, ok := o.Headers[name]; !ok || seen[name] {
+				return nil, InvalidCriticalHeaderError{Name: name}
+			}
+
+			seen[name] = true
+			crit = append(crit, name)
+		}
+
+		headers["crit"] = crit
+	}
+
+	return headers, nil
+}
@@ -0,0 +1,143 @@
+package token
+
+import (
+	"context"
+	"testing"
+
+	"github.com/xmidt-org/themis/key"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testHeadersCrit(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	f, err := NewFactory(
+		Options{
+			Key: key.Descriptor{Kid: "test", Bits: 512},
+			Headers: map[string]interface{}{
+				"exp-policy": "strict",
+				"tenant-id":  "initech",
+				"optional":   true,
+			},
+			Crit: []string{"tenant-id", "exp-policy"},
+		},
+		ClaimBuilders{},
+		key.NewRegistry(nil),
+	)
+
+	require.NoError(err)
+	signed, err := f.NewToken(context.Background(), NewRequest())
+	require.NoError(err)
+
+	token, _, err := new(jwt.Parser).ParseUnverified(signed, jwt.MapClaims{})
+	require.NoError(err)
+	assert.Equal([]interface{}{"tenant-id", "exp-policy"}, token.Header["crit"])
+	assert.Equal("strict", token.Header["exp-policy"])
+	assert.Equal("initech", token.Header["tenant-id"])
+	assert.Equal(true, token.Header["optional"])
+	assert.Equal("test", token.Header["kid"])
+	assert.Equal(DefaultAlg, token.Header["alg"])
+}
+
+func testHeadersNoCrit(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	f, err := NewFactory(
+		Options{
+			Key:     key.Descriptor{Kid: "test", Bits: 512},
+			Headers: map[string]interface{}{"optional": "value"},
+		},
+		ClaimBuilders{},
+		key.NewRegistry(nil),
+	)
+
+	require.NoError(err)
+	signed, err := f.NewToken(context.Background(), NewRequest())
+	require.NoError(err)
+
+	token, _, err := new(jwt.Parser).ParseUnverified(signed, jwt.MapClaims{})
+	require.NoError(err)
+	assert.Equal("value", token.Header["optional"])
+	assert.NotContains(token.Header, "crit")
+}
+
+func testHeadersInvalid(t *testing.T) {
+	testData := []struct {
+		name     string
+		headers  map[string]interface{}
+		crit     []string
+		expected error
+	}{
+		{
+			name:     "CritNotPresent",
+			headers:  map[string]interface{}{"tenant-id": "initech"},
+			crit:     []string{"missing"},
+			expected: InvalidCriticalHeaderError{Name: "missing"},
+		},
+		{
+			name:     "CritWithoutHeaders",
+			crit:     []string{"tenant-id"},
+			expected: InvalidCriticalHeaderError{Name: "tenant-id"},
+		},
+		{
+			name:     "CritDuplicate",
+			headers:  map[string]interface{}{"tenant-id": "initech"},
+			crit:     []string{"tenant-id", "tenant-id"},
+			expected: InvalidCriticalHeaderError{Name: "tenant-id"},
+		},
+		{
+			name:     "CritReserved",
+			headers:  map[string]interface{}{"tenant-id": "initech"},
+			crit:     []string{"kid"},
+			expected: InvalidCriticalHeaderError{Name: "kid"},
+		},
+		{
+			name:     "ReservedHeader",
+			headers:  map[string]interface{}{"alg": "none"},
+			expected: ReservedHeaderError{Name: "alg"},
+		},
+		{
+			name:     "CompressionHeader",
+			headers:  map[string]interface{}{"zip": "DEF"},
+			expected: ReservedHeaderError{Name: "zip"},
+		},
+		{
+			name:     "UnencodedPayloadHeader",
+			headers:  map[string]interface{}{"b64": false},
+			expected: ReservedHeaderError{Name: "b64"},
+		},
+	}
+
+	for _, record := range testData {
+		t.Run(record.name, func(t *testing.T) {
+			f, err := NewFactory(
+				Options{
+					Key:     key.Descriptor{Kid: "test", Bits: 512},
+					Headers: record.headers,
+					Crit:    record.crit,
+				},
+				ClaimBuilders{},
+				key.NewRegistry(nil),
+			)
+
+			assert.Nil(t, f)
+			assert.Equal(t, record.expected, err)
+			assert.NotEmpty(t, err.Error())
+		})
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	t.Run("Crit", testHeadersCrit)
+	t.Run("NoCrit", testHeadersNoCrit)
+	t.Run("Invalid", testHeadersInvalid)
+}
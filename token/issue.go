@@ -0,0 +1,344 @@
+package token
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/xmidt-org/themis/clock"
+
+	"github.com/go-kit/kit/endpoint"
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+const (
+	// BodyForm parses the URL query along with any form-encoded body.  This is the default.
+	BodyForm = "form"
+
+	// BodyJSON parses the URL query along with a JSON object body.  Each top-level field in the body is
+	// available as a parameter, just as if it had been sent as a form field.
+	BodyJSON = "json"
+
+	// BodyQuery parses only the URL query.  Any body is ignored.
+	BodyQuery = "query"
+
+	// BodyContent parses the URL query along with a body decoded according to its Content-Type.  Each
+	// top-level field is available both as a parameter and to body path claims, whatever the body's format.
+	BodyContent = "content"
+
+	// DefaultMaxBodySize is the largest request body, in bytes, accepted by the issue handler when none is configured
+	DefaultMaxBodySize int64 = 1 << 20
+)
+
+var (
+	ErrBodyNotObject = errors.New("A JSON request body must be an object")
+)
+
+// InvalidBodyError indicates that a token request body could not be parsed
+type InvalidBodyError struct {
+	Err error
+}
+
+func (ibe InvalidBodyError) Error() string {
+	return fmt.Sprintf("Invalid request body: %s", ibe.Err)
+}
+
+func (ibe InvalidBodyError) Unwrap() error {
+	return ibe.Err
+}
+
+func (ibe InvalidBodyError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// RequestParser is a strategy for preparing an HTTP request's Form prior to running RequestBuilders
+type RequestParser func(*http.Request) error
+
+// ParseForm is the default RequestParser, which uses http.Request.ParseForm
+func ParseForm(request *http.Request) error {
+	return request.ParseForm()
+}
+
+// ParseQuery is a RequestParser that only uses the URL query
+func ParseQuery(request *http.Request) error {
+	query, err := url.ParseQuery(request.URL.RawQuery)
+	if err != nil {
+		return err
+	}
+
+	request.Form = query
+	return nil
+}
+
+// parameterValue converts a JSON value into the string form used for HTTP parameters
+func parameterValue(v json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(v, &s); err == nil {
+		return s
+	}
+
+	return string(v)
+}
+
+// ParseJSON is a RequestParser that merges the fields of a JSON object body into the URL query.  String
+// fields are used as is, while other fields, e.g. numbers, use their JSON text.  An empty body is permitted.
+func ParseJSON(request *http.Request) error {
+	if err := ParseQuery(request); err != nil {
+		return err
+	}
+
+	if request.Body == nil {
+		return nil
+	}
+
+	// the body is left in place so that body path claims can be taken from it
+	data, err := ioutil.ReadAll(request.Body)
+	request.Body.Close()
+	request.Body = ioutil.NopCloser(bytes.NewReader(data))
+	if err != nil {
+		return InvalidBodyError{Err: err}
+	}
+
+	var body map[string]json.RawMessage
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&body); err == io.EOF {
+		return nil
+	} else if err != nil {
+		return InvalidBodyError{Err: err}
+	} else if body == nil {
+		return InvalidBodyError{Err: ErrBodyNotObject}
+	}
+
+	for k, v := range body {
+		request.Form.Add(k, parameterValue(v))
+	}
+
+	return nil
+}
+
+// NewRequestParser returns the RequestParser for the given body mode
+func NewRequestParser(body string) (RequestParser, error) {
+	switch body {
+	case "":
+		fallthrough
+	case BodyForm:
+		return ParseForm, nil
+
+	case BodyJSON:
+		return ParseJSON, nil
+
+	case BodyQuery:
+		return ParseQuery, nil
+
+	case BodyContent:
+		return ParseContent(nil), nil
+
+	default:
+		return nil, fmt.Errorf("Invalid body mode: %s", body)
+	}
+}
+
+// Issue describes the HTTP methods and request bodies accepted by the issue handler.  Regardless of
+// the method or body, claims and metadata are resolved in the same way from headers and parameters.
+type Issue struct {
+	// Methods are the HTTP methods accepted by the issue handler.  If unset, only GET is accepted.
+	Methods []string
+
+	// Body is how the request body is parsed, and must be one of BodyForm, BodyJSON, BodyQuery, or BodyContent.
+	// If unset, BodyForm is used.
+	Body string
+
+	// ResponseContentType is the media type of issued tokens, for clients that insist on something other
+	// than the default, such as text/plain.  If unset, DefaultResponseContentType is used.
+	ResponseContentType string
+
+	// ResponseHeaders controls which of an issued token's kid and exp are mirrored in response headers
+	ResponseHeaders ResponseHeaders
+
+	// Cookie is the optional configuration that delivers issued tokens in a Set-Cookie header instead of
+	// the response body.  If set, ResponseContentType is ignored.
+	Cookie *TokenCookie
+
+	// ContentTypes is the optional list of media types accepted for the body of POST, PUT, and PATCH requests,
+	// e.g. application/json.  Such requests with any other Content-Type, or none at all, are rejected with
+	// http.StatusUnsupportedMediaType.  Parameters such as charset are ignored.  If unset, any Content-Type is accepted.
+	ContentTypes []string
+
+	// MaxBodySize is the largest request body, in bytes, that the issue handler reads.  A request that declares a
+	// larger Content-Length is rejected with http.StatusRequestEntityTooLarge, and reading any other body stops
+	// at this size with a 400.  If unset or not positive, DefaultMaxBodySize is used.
+	MaxBodySize int64
+
+	// decoders are the optional BodyDecoders, supplied by the application, that are used with BodyContent
+	// in addition to the defaults
+	decoders BodyDecoders
+
+	// clock is the application's Clock, supplied by the application.  If nil, the system time is used.
+	clock clock.Clock
+}
+
+// requestParser returns the RequestParser for the configured body mode
+func (i Issue) requestParser() (RequestParser, error) {
+	if i.Body == BodyContent {
+		return ParseContent(i.decoders), nil
+	}
+
+	return NewRequestParser(i.Body)
+}
+
+// InvalidContentTypeError indicates that a configured response content type is not a valid media type
+type InvalidContentTypeError struct {
+	ContentType string
+}
+
+func (icte InvalidContentTypeError) Error() string {
+	return fmt.Sprintf("Invalid response content type: %s", icte.ContentType)
+}
+
+// newEncoder validates the configured token cookie or response content type and returns the encoder for issued tokens
+func (i Issue) newEncoder() (kithttp.EncodeResponseFunc, error) {
+	if i.Cookie != nil {
+		return i.Cookie.newEncoder(clock.NowFunc(i.clock))
+	}
+
+	if len(i.ResponseContentType) == 0 {
+		return EncodeIssueResponse, nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(i.ResponseContentType)
+	if err != nil {
+		return nil, InvalidContentTypeError{ContentType: i.ResponseContentType}
+	}
+
+	if slash := strings.IndexByte(mediaType, '/'); slash <= 0 || slash == len(mediaType)-1 || strings.Contains(mediaType, "*") {
+		return nil, InvalidContentTypeError{ContentType: i.ResponseContentType}
+	}
+
+	return NewEncodeIssueResponse(i.ResponseContentType), nil
+}
+
+// methodHandler rejects requests that do not use one of a set of HTTP methods, or that send a body
+// with an unaccepted media type or that is too large
+type methodHandler struct {
+	next         http.Handler
+	methods      map[string]bool
+	allow        string
+	contentTypes map[string]bool
+	maxBodySize  int64
+}
+
+// acceptsContentType tests if a request's body, if any, has one of the accepted media types
+func (mh methodHandler) acceptsContentType(request *http.Request) bool {
+	if len(mh.contentTypes) == 0 {
+		return true
+	}
+
+	switch request.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	return err == nil && mh.contentTypes[mediaType]
+}
+
+func (mh methodHandler) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	if !mh.methods[request.Method] {
+		response.Header().Set("Allow", mh.allow)
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !mh.acceptsContentType(request) {
+		response.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	if request.ContentLength > mh.maxBodySize {
+		response.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if request.Body != nil {
+		request.Body = http.MaxBytesReader(response, request.Body, mh.maxBodySize)
+	}
+
+	mh.next.ServeHTTP(response, request)
+}
+
+// NewHandler creates an IssueHandler that accepts the configured methods and body.  Requests using any
+// other method are rejected with http.StatusMethodNotAllowed.  Any supplied options are applied to the
+// underlying go-kit server.
+func (i Issue) NewHandler(e endpoint.Endpoint, rb RequestBuilders, options ...kithttp.ServerOption) (IssueHandler, error) {
+	p, err := i.requestParser()
+	if err != nil {
+		return nil, err
+	}
+
+	encoder, err := i.newEncoder()
+	if err != nil {
+		return nil, err
+	}
+
+	mh, err := i.methodHandler(
+		kithttp.NewServer(
+			e,
+			DecodeServerRequestWith(p, rb),
+			i.ResponseHeaders.decorate(encoder),
+			options...,
+		),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return mh, nil
+}
+
+// methodHandler decorates a handler so that it only accepts the configured methods and content types
+func (i Issue) methodHandler(next http.Handler) (methodHandler, error) {
+	methods := i.Methods
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet}
+	}
+
+	mh := methodHandler{
+		next:        next,
+		methods:     make(map[string]bool, len(methods)),
+		maxBodySize: i.MaxBodySize,
+	}
+
+	if mh.maxBodySize <= 0 {
+		mh.maxBodySize = DefaultMaxBodySize
+	}
+
+	allow := make([]string, 0, len(methods))
+	for _, m := range methods {
+		m = strings.ToUpper(m)
+		mh.methods[m] = true
+		allow = append(allow, m)
+	}
+
+	mh.allow = strings.Join(allow, ", ")
+	if len(i.ContentTypes) > 0 {
+		mh.contentTypes = make(map[string]bool, len(i.ContentTypes))
+		for _, ct := range i.ContentTypes {
+			mediaType, _, err := mime.ParseMediaType(ct)
+			if err != nil {
+				return methodHandler{}, InvalidContentTypeError{ContentType: ct}
+			}
+
+			mh.contentTypes[mediaType] = true
+		}
+	}
+
+	return mh, nil
+}
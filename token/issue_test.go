@@ -0,0 +1,317 @@
+package token
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestIssueHandler creates an issue handler whose endpoint returns the request claims as JSON
+func newTestIssueHandler(t *testing.T, i Issue) IssueHandler {
+	rb, err := NewRequestBuilders(Options{
+		Claims: map[string]Value{
+			"mac":   Value{Parameter: "mac"},
+			"count": Value{Parameter: "count"},
+			"trust": Value{Header: "X-Trust"},
+		},
+	})
+
+	require.NoError(t, err)
+	handler, err := i.NewHandler(
+		endpoint.Endpoint(func(_ context.Context, v interface{}) (interface{}, error) {
+			data, err := json.Marshal(v.(*Request).Claims)
+			return string(data), err
+		}),
+		rb,
+	)
+
+	require.NoError(t, err)
+	require.NotNil(t, handler)
+	return handler
+}
+
+func testIssueGetWithQuery(t *testing.T, body string) {
+	var (
+		assert = assert.New(t)
+
+		handler  = newTestIssueHandler(t, Issue{Body: body})
+		response = httptest.NewRecorder()
+		request  = httptest.NewRequest("GET", "/issue?mac=112233445566&count=3", nil)
+	)
+
+	request.Header.Set("X-Trust", "1000")
+	handler.ServeHTTP(response, request)
+	assert.Equal(http.StatusOK, response.Code)
+	assert.Equal(DefaultResponseContentType, response.Header().Get("Content-Type"))
+	assert.JSONEq(`{"mac": "112233445566", "count": "3", "trust": "1000"}`, response.Body.String())
+}
+
+func testIssuePostWithJSONBody(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		handler  = newTestIssueHandler(t, Issue{Methods: []string{"post"}, Body: BodyJSON})
+		response = httptest.NewRecorder()
+		request  = httptest.NewRequest("POST", "/issue?count=3", strings.NewReader(`{"mac": "112233445566", "ignored": {"nested": true}}`))
+	)
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Trust", "1000")
+	handler.ServeHTTP(response, request)
+	assert.Equal(http.StatusOK, response.Code)
+	assert.JSONEq(`{"mac": "112233445566", "count": "3", "trust": "1000"}`, response.Body.String())
+}
+
+func testIssueJSONNonStringValues(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		handler  = newTestIssueHandler(t, Issue{Methods: []string{"POST"}, Body: BodyJSON})
+		response = httptest.NewRecorder()
+		request  = httptest.NewRequest("POST", "/issue", strings.NewReader(`{"count": 3}`))
+	)
+
+	handler.ServeHTTP(response, request)
+	assert.Equal(http.StatusOK, response.Code)
+	assert.JSONEq(`{"count": "3"}`, response.Body.String())
+}
+
+func testIssueQueryIgnoresBody(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		handler  = newTestIssueHandler(t, Issue{Methods: []string{"POST"}, Body: BodyQuery})
+		response = httptest.NewRecorder()
+		request  = httptest.NewRequest("POST", "/issue?count=3", strings.NewReader("mac=112233445566"))
+	)
+
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	handler.ServeHTTP(response, request)
+	assert.Equal(http.StatusOK, response.Code)
+	assert.JSONEq(`{"count": "3"}`, response.Body.String())
+}
+
+func testIssueInvalidJSONBody(t *testing.T, body string) {
+	var (
+		assert = assert.New(t)
+
+		handler  = newTestIssueHandler(t, Issue{Methods: []string{"POST"}, Body: BodyJSON})
+		response = httptest.NewRecorder()
+		request  = httptest.NewRequest("POST", "/issue", strings.NewReader(body))
+	)
+
+	handler.ServeHTTP(response, request)
+	assert.Equal(http.StatusBadRequest, response.Code)
+}
+
+func testIssueMethodNotAllowed(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		handler  = newTestIssueHandler(t, Issue{})
+		response = httptest.NewRecorder()
+		request  = httptest.NewRequest("POST", "/issue", nil)
+	)
+
+	handler.ServeHTTP(response, request)
+	assert.Equal(http.StatusMethodNotAllowed, response.Code)
+	assert.Equal("GET", response.Header().Get("Allow"))
+}
+
+func testIssueInvalidBodyMode(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		handler, err = Issue{Body: "xml"}.NewHandler(
+			endpoint.Nop,
+			RequestBuilders{},
+		)
+	)
+
+	assert.Nil(handler)
+	assert.Error(err)
+}
+
+func testIssueResponseContentType(t *testing.T, contentType string) {
+	var (
+		assert = assert.New(t)
+
+		handler  = newTestIssueHandler(t, Issue{ResponseContentType: contentType})
+		response = httptest.NewRecorder()
+		request  = httptest.NewRequest("GET", "/issue?mac=112233445566", nil)
+	)
+
+	handler.ServeHTTP(response, request)
+	assert.Equal(http.StatusOK, response.Code)
+	assert.Equal(contentType, response.Header().Get("Content-Type"))
+}
+
+func testIssueInvalidResponseContentType(t *testing.T, contentType string) {
+	var (
+		assert = assert.New(t)
+
+		handler, err = Issue{ResponseContentType: contentType}.NewHandler(
+			endpoint.Nop,
+			RequestBuilders{},
+		)
+	)
+
+	assert.Nil(handler)
+	assert.Equal(InvalidContentTypeError{ContentType: contentType}, err)
+	assert.Contains(err.Error(), contentType)
+}
+
+func testIssueContentType(t *testing.T, method, contentType string, expected int) {
+	var (
+		assert = assert.New(t)
+
+		handler = newTestIssueHandler(t, Issue{
+			Methods:      []string{"GET", "POST"},
+			Body:         BodyJSON,
+			ContentTypes: []string{"application/json", "application/x-www-form-urlencoded"},
+		})
+
+		response = httptest.NewRecorder()
+		request  = httptest.NewRequest(method, "/issue", strings.NewReader(`{"mac": "112233445566"}`))
+	)
+
+	if len(contentType) > 0 {
+		request.Header.Set("Content-Type", contentType)
+	}
+
+	handler.ServeHTTP(response, request)
+	assert.Equal(expected, response.Code)
+	if expected == http.StatusOK && method == "POST" {
+		assert.JSONEq(`{"mac": "112233445566"}`, response.Body.String())
+	}
+}
+
+func testIssueInvalidContentTypes(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		handler, err = Issue{ContentTypes: []string{"application/json", "not a media type;"}}.NewHandler(
+			endpoint.Nop,
+			RequestBuilders{},
+		)
+	)
+
+	assert.Nil(handler)
+	assert.Equal(InvalidContentTypeError{ContentType: "not a media type;"}, err)
+}
+
+func testIssueMaxBodySize(t *testing.T) {
+	var (
+		handler = newTestIssueHandler(t, Issue{
+			Methods:     []string{"POST"},
+			Body:        BodyJSON,
+			MaxBodySize: 32,
+		})
+
+		body = `{"mac": "112233445566", "padding": "more than the limit"}`
+	)
+
+	t.Run("WithinLimit", func(t *testing.T) {
+		var (
+			assert   = assert.New(t)
+			response = httptest.NewRecorder()
+		)
+
+		handler.ServeHTTP(response, httptest.NewRequest("POST", "/issue", strings.NewReader(`{"mac": "112233445566"}`)))
+		assert.Equal(http.StatusOK, response.Code)
+	})
+
+	t.Run("ContentLength", func(t *testing.T) {
+		var (
+			assert   = assert.New(t)
+			response = httptest.NewRecorder()
+		)
+
+		handler.ServeHTTP(response, httptest.NewRequest("POST", "/issue", strings.NewReader(body)))
+		assert.Equal(http.StatusRequestEntityTooLarge, response.Code)
+	})
+
+	t.Run("Chunked", func(t *testing.T) {
+		var (
+			assert   = assert.New(t)
+			response = httptest.NewRecorder()
+			request  = httptest.NewRequest("POST", "/issue", strings.NewReader(body))
+		)
+
+		// a body without a declared length is cut off at the limit
+		request.ContentLength = -1
+		handler.ServeHTTP(response, request)
+		assert.Equal(http.StatusBadRequest, response.Code)
+	})
+}
+
+func TestIssue(t *testing.T) {
+	t.Run("GetWithQuery", func(t *testing.T) {
+		for _, body := range []string{"", BodyForm, BodyJSON, BodyQuery, BodyContent} {
+			t.Run(body, func(t *testing.T) {
+				testIssueGetWithQuery(t, body)
+			})
+		}
+	})
+
+	t.Run("PostWithJSONBody", testIssuePostWithJSONBody)
+	t.Run("JSONNonStringValues", testIssueJSONNonStringValues)
+	t.Run("QueryIgnoresBody", testIssueQueryIgnoresBody)
+
+	t.Run("InvalidJSONBody", func(t *testing.T) {
+		testIssueInvalidJSONBody(t, `[1, 2, 3]`)
+		testIssueInvalidJSONBody(t, `null`)
+		testIssueInvalidJSONBody(t, `this is not JSON`)
+	})
+
+	t.Run("MethodNotAllowed", testIssueMethodNotAllowed)
+
+	t.Run("ContentType", func(t *testing.T) {
+		testData := []struct {
+			name        string
+			method      string
+			contentType string
+			expected    int
+		}{
+			{"Accepted", "POST", "application/json", http.StatusOK},
+			{"AcceptedWithCharset", "POST", "Application/JSON; charset=utf-8", http.StatusOK},
+			{"Rejected", "POST", "text/plain", http.StatusUnsupportedMediaType},
+			{"Missing", "POST", "", http.StatusUnsupportedMediaType},
+			{"Malformed", "POST", "application/", http.StatusUnsupportedMediaType},
+			{"GetIgnored", "GET", "", http.StatusOK},
+		}
+
+		for _, record := range testData {
+			t.Run(record.name, func(t *testing.T) {
+				testIssueContentType(t, record.method, record.contentType, record.expected)
+			})
+		}
+	})
+
+	t.Run("InvalidContentTypes", testIssueInvalidContentTypes)
+	t.Run("MaxBodySize", testIssueMaxBodySize)
+	t.Run("InvalidBodyMode", testIssueInvalidBodyMode)
+
+	t.Run("ResponseContentType", func(t *testing.T) {
+		for _, contentType := range []string{"text/plain", "text/plain; charset=utf-8", "application/jose"} {
+			t.Run(contentType, func(t *testing.T) {
+				testIssueResponseContentType(t, contentType)
+			})
+		}
+	})
+
+	t.Run("InvalidResponseContentType", func(t *testing.T) {
+		for _, contentType := range []string{"text", "text/", "/plain", "*/*", "text/plain; charset", "not a media type"} {
+			t.Run(contentType, func(t *testing.T) {
+				testIssueInvalidResponseContentType(t, contentType)
+			})
+		}
+	})
+}
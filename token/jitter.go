@@ -0,0 +1,53 @@
+package token
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var (
+	ErrDurationExceedsMax      = errors.New("The token duration cannot exceed the maximum duration")
+	ErrInvalidExpirationJitter = errors.New("The expiration jitter must be shorter than the token duration")
+)
+
+// lifetime computes the shortest token lifetime and the width of the window over which each token's lifetime is
+// randomly spread.  Jitter lengthens lifetimes beyond Duration, unless that would exceed MaxDuration, in which case
+// the window is moved earlier so that it ends at MaxDuration.
+func (o Options) lifetime() (time.Duration, time.Duration, error) {
+	if o.MaxDuration > 0 && o.Duration > o.MaxDuration {
+		return 0, 0, ErrDurationExceedsMax
+	}
+
+	if o.ExpirationJitter <= 0 || o.Duration <= 0 {
+		return o.Duration, 0, nil
+	}
+
+	if o.ExpirationJitter >= o.Duration {
+		return 0, 0, ErrInvalidExpirationJitter
+	}
+
+	lower := o.Duration
+	if o.MaxDuration > 0 && lower+o.ExpirationJitter > o.MaxDuration {
+		lower = o.MaxDuration - o.ExpirationJitter
+	}
+
+	return lower, o.ExpirationJitter, nil
+}
+
+// newExpirationJitter returns a function producing random offsets in [0, window], safe for concurrent use.
+// If random is nil, a source seeded from the current time is used.
+func newExpirationJitter(window time.Duration, random *rand.Rand) func() time.Duration {
+	if random == nil {
+		random = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	var lock sync.Mutex
+	return func() time.Duration {
+		lock.Lock()
+		offset := random.Int63n(int64(window) + 1)
+		lock.Unlock()
+		return time.Duration(offset)
+	}
+}
@@ -0,0 +1,99 @@
+package token
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/xmidt-org/themis/clock/clocktest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptionsLifetime(t *testing.T) {
+	testData := []struct {
+		name   string
+		o      Options
+		lower  time.Duration
+		window time.Duration
+		err    error
+	}{
+		{name: "NoJitter", o: Options{Duration: time.Hour}, lower: time.Hour},
+		{name: "Jitter", o: Options{Duration: time.Hour, ExpirationJitter: time.Minute}, lower: time.Hour, window: time.Minute},
+		{
+			name:   "WithinMax",
+			o:      Options{Duration: time.Hour, MaxDuration: 2 * time.Hour, ExpirationJitter: time.Minute},
+			lower:  time.Hour,
+			window: time.Minute,
+		},
+		{
+			name:   "ShiftedBelowMax",
+			o:      Options{Duration: time.Hour, MaxDuration: time.Hour, ExpirationJitter: 10 * time.Minute},
+			lower:  50 * time.Minute,
+			window: 10 * time.Minute,
+		},
+		{name: "NoDuration", o: Options{ExpirationJitter: time.Minute}},
+		{name: "ExceedsMax", o: Options{Duration: 2 * time.Hour, MaxDuration: time.Hour}, err: ErrDurationExceedsMax},
+		{name: "JitterTooLong", o: Options{Duration: time.Hour, ExpirationJitter: time.Hour}, err: ErrInvalidExpirationJitter},
+	}
+
+	for _, record := range testData {
+		t.Run(record.name, func(t *testing.T) {
+			assert := assert.New(t)
+			lower, window, err := record.o.lifetime()
+			assert.Equal(record.err, err)
+			assert.Equal(record.lower, lower)
+			assert.Equal(record.window, window)
+		})
+	}
+}
+
+func TestExpirationJitter(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		now = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+		o   = Options{
+			Duration:         time.Hour,
+			MaxDuration:      time.Hour + 5*time.Minute,
+			ExpirationJitter: 10 * time.Minute,
+			clock:            clocktest.NewFake(now),
+		}
+	)
+
+	builders, err := NewClaimBuilders(nil, nil, o)
+	require.NoError(err)
+
+	for _, b := range builders {
+		if tc, ok := b.(*timeClaimBuilder); ok {
+			tc.jitter = newExpirationJitter(10*time.Minute, rand.New(rand.NewSource(1234)))
+		}
+	}
+
+	var (
+		lower    = now.Add(55 * time.Minute).Unix()
+		upper    = now.Add(time.Hour + 5*time.Minute).Unix()
+		distinct = make(map[int64]bool)
+	)
+
+	for i := 0; i < 100; i++ {
+		claims := make(map[string]interface{})
+		require.NoError(builders.AddClaims(context.Background(), NewRequest(), claims))
+
+		exp := claims["exp"].(int64)
+		assert.True(exp >= lower && exp <= upper, "exp %d is outside [%d, %d]", exp, lower, upper)
+		distinct[exp] = true
+	}
+
+	// 100 draws over a 600 second window are all but certain to produce many distinct expirations
+	assert.True(len(distinct) > 10, "only %d distinct exp values", len(distinct))
+}
+
+func TestNewClaimBuildersInvalidLifetime(t *testing.T) {
+	builders, err := NewClaimBuilders(nil, nil, Options{Duration: time.Hour, ExpirationJitter: 2 * time.Hour})
+	assert.Empty(t, builders)
+	assert.Equal(t, ErrInvalidExpirationJitter, err)
+}
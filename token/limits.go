@@ -0,0 +1,66 @@
+package token
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Limits bounds the size of the tokens a Factory will sign.  Limits are checked after all claims
+// have been merged, so they apply to claims from every source.  Zero fields impose no limit.
+type Limits struct {
+	// MaxClaims is the maximum number of top-level claims a token may have
+	MaxClaims int
+
+	// MaxPayloadSize is the maximum size, in bytes, of a token's claims serialized as JSON.  This is
+	// measured before any compression.
+	MaxPayloadSize int
+}
+
+// TooManyClaimsError is returned when a token would have more than Limits.MaxClaims claims
+type TooManyClaimsError struct {
+	Count int
+	Max   int
+}
+
+func (tmce TooManyClaimsError) Error() string {
+	return fmt.Sprintf("Token has %d claims, which exceeds the maximum of %d", tmce.Count, tmce.Max)
+}
+
+func (tmce TooManyClaimsError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// PayloadTooLargeError is returned when a token's serialized claims would exceed Limits.MaxPayloadSize
+type PayloadTooLargeError struct {
+	Size int
+	Max  int
+}
+
+func (ptle PayloadTooLargeError) Error() string {
+	return fmt.Sprintf("Token payload is %d bytes, which exceeds the maximum of %d", ptle.Size, ptle.Max)
+}
+
+func (ptle PayloadTooLargeError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// check verifies that a set of claims is within these limits
+func (l Limits) check(claims map[string]interface{}) error {
+	if l.MaxClaims > 0 && len(claims) > l.MaxClaims {
+		return TooManyClaimsError{Count: len(claims), Max: l.MaxClaims}
+	}
+
+	if l.MaxPayloadSize > 0 {
+		payload, err := json.Marshal(claims)
+		if err != nil {
+			return err
+		}
+
+		if len(payload) > l.MaxPayloadSize {
+			return PayloadTooLargeError{Size: len(payload), Max: l.MaxPayloadSize}
+		}
+	}
+
+	return nil
+}
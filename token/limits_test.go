@@ -0,0 +1,98 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/xmidt-org/themis/key"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newLimitsFactory(t *testing.T, l Limits) Factory {
+	f, err := NewFactory(
+		Options{
+			Key:    key.Descriptor{Kid: "limits", Bits: 512},
+			Limits: l,
+		},
+		ClaimBuilders{requestClaimBuilder{}},
+		key.NewRegistry(nil),
+	)
+
+	require.NoError(t, err)
+	return f
+}
+
+func testLimitsNone(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		factory = newLimitsFactory(t, Limits{})
+		request = NewRequest()
+	)
+
+	for _, name := range []string{"a", "b", "c", "d"} {
+		request.Claims[name] = strings.Repeat(name, 100)
+	}
+
+	signed, err := factory.NewToken(context.Background(), request)
+	assert.NoError(err)
+	assert.NotEmpty(signed)
+}
+
+func testLimitsMaxClaims(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		factory = newLimitsFactory(t, Limits{MaxClaims: 2})
+		request = NewRequest()
+	)
+
+	request.Claims["a"] = "1"
+	request.Claims["b"] = "2"
+	signed, err := factory.NewToken(context.Background(), request)
+	require.NoError(err)
+	assert.NotEmpty(signed)
+
+	request.Claims["c"] = "3"
+	signed, err = factory.NewToken(context.Background(), request)
+	assert.Empty(signed)
+
+	var tmce TooManyClaimsError
+	require.True(errors.As(err, &tmce))
+	assert.Equal(TooManyClaimsError{Count: 3, Max: 2}, tmce)
+	assert.Equal(http.StatusBadRequest, tmce.StatusCode())
+}
+
+func testLimitsMaxPayloadSize(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		factory = newLimitsFactory(t, Limits{MaxPayloadSize: 64})
+		request = NewRequest()
+	)
+
+	request.Claims["sub"] = "small"
+	signed, err := factory.NewToken(context.Background(), request)
+	require.NoError(err)
+	assert.NotEmpty(signed)
+
+	request.Claims["sub"] = strings.Repeat("x", 64)
+	signed, err = factory.NewToken(context.Background(), request)
+	assert.Empty(signed)
+
+	var ptle PayloadTooLargeError
+	require.True(errors.As(err, &ptle))
+	assert.Equal(64, ptle.Max)
+	assert.True(ptle.Size > 64)
+	assert.Equal(http.StatusBadRequest, ptle.StatusCode())
+}
+
+func TestLimits(t *testing.T) {
+	t.Run("None", testLimitsNone)
+	t.Run("MaxClaims", testLimitsMaxClaims)
+	t.Run("MaxPayloadSize", testLimitsMaxPayloadSize)
+}
@@ -0,0 +1,135 @@
+package token
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultLocaleClaim is the name of the locale claim when none is configured
+const DefaultLocaleClaim = "locale"
+
+// Locale describes how to derive a locale claim from the Accept-Language header of a token request
+type Locale struct {
+	// Claim is the name of the claim key for the locale.  If unset, DefaultLocaleClaim is used.
+	Claim string
+
+	// Metadata is the optional name of the metadata key for the locale
+	Metadata string
+
+	// Supported is the list of locales that may appear in tokens, in order of preference.  Language
+	// tags are matched case insensitively, and the configured form is what appears in the token.
+	Supported []string
+
+	// Default is the locale used when the request has no Accept-Language header or when no requested
+	// language matches a supported locale.  If unset, no locale is set in that case.
+	Default string
+}
+
+// acceptedLanguage is a single language range from an Accept-Language header
+type acceptedLanguage struct {
+	tag     string
+	quality float64
+}
+
+// parseAcceptLanguage parses Accept-Language header values into language ranges sorted by descending
+// quality.  Ranges with equal quality retain the order in which they appeared.  Ranges with a zero
+// or unparseable quality are dropped.
+func parseAcceptLanguage(values []string) []acceptedLanguage {
+	var accepted []acceptedLanguage
+	for _, v := range values {
+		for _, r := range strings.Split(v, ",") {
+			parts := strings.Split(r, ";")
+			al := acceptedLanguage{tag: strings.TrimSpace(parts[0]), quality: 1.0}
+			if len(al.tag) == 0 {
+				continue
+			}
+
+			for _, p := range parts[1:] {
+				p = strings.TrimSpace(p)
+				if strings.HasPrefix(p, "q=") {
+					q, err := strconv.ParseFloat(p[2:], 64)
+					if err != nil {
+						q = 0.0
+					}
+
+					al.quality = q
+				}
+			}
+
+			if al.quality > 0.0 {
+				accepted = append(accepted, al)
+			}
+		}
+	}
+
+	sort.SliceStable(accepted, func(i, j int) bool {
+		return accepted[i].quality > accepted[j].quality
+	})
+
+	return accepted
+}
+
+// primaryTag returns the primary language subtag, e.g. "en" for "en-US"
+func primaryTag(tag string) string {
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		return tag[:i]
+	}
+
+	return tag
+}
+
+type localeRequestBuilder struct {
+	Locale
+}
+
+// match selects the supported locale for a single language range.  An exact match is preferred,
+// followed by a supported locale with the same primary language subtag.  The "*" range matches the
+// first supported locale.
+func (lrb localeRequestBuilder) match(tag string) (string, bool) {
+	if tag == "*" {
+		if len(lrb.Supported) > 0 {
+			return lrb.Supported[0], true
+		}
+
+		return "", false
+	}
+
+	for _, s := range lrb.Supported {
+		if strings.EqualFold(s, tag) {
+			return s, true
+		}
+	}
+
+	primary := primaryTag(tag)
+	for _, s := range lrb.Supported {
+		if strings.EqualFold(primaryTag(s), primary) {
+			return s, true
+		}
+	}
+
+	return "", false
+}
+
+func (lrb localeRequestBuilder) getLocale(original *http.Request) string {
+	for _, al := range parseAcceptLanguage(original.Header["Accept-Language"]) {
+		if locale, ok := lrb.match(al.tag); ok {
+			return locale
+		}
+	}
+
+	return lrb.Default
+}
+
+func (lrb localeRequestBuilder) Build(original *http.Request, tr *Request) error {
+	locale := lrb.getLocale(original)
+	if len(locale) > 0 {
+		tr.Claims[lrb.Claim] = locale
+		if len(lrb.Metadata) > 0 {
+			tr.Metadata[lrb.Metadata] = locale
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package token
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testLocaleRequestBuilder(t *testing.T, acceptLanguage []string, expected interface{}) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		o = Options{
+			Locale: &Locale{
+				Metadata:  "lang",
+				Supported: []string{"en-US", "fr", "de-DE"},
+				Default:   "en-US",
+			},
+		}
+	)
+
+	rb, err := NewRequestBuilders(o)
+	require.NoError(err)
+	require.Len(rb, 1)
+
+	original := httptest.NewRequest("GET", "/", nil)
+	for _, v := range acceptLanguage {
+		original.Header.Add("Accept-Language", v)
+	}
+
+	tr, err := BuildRequest(original, rb)
+	require.NoError(err)
+	assert.Equal(expected, tr.Claims[DefaultLocaleClaim])
+	assert.Equal(expected, tr.Metadata["lang"])
+}
+
+func testLocaleRequestBuilderNoDefault(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	rb, err := NewRequestBuilders(Options{Locale: &Locale{Claim: "lc", Supported: []string{"fr"}}})
+	require.NoError(err)
+
+	original := httptest.NewRequest("GET", "/", nil)
+	original.Header.Set("Accept-Language", "ja")
+	tr, err := BuildRequest(original, rb)
+	require.NoError(err)
+	assert.NotContains(tr.Claims, "lc")
+	assert.NotContains(tr.Claims, DefaultLocaleClaim)
+}
+
+func TestLocaleRequestBuilder(t *testing.T) {
+	testData := []struct {
+		name           string
+		acceptLanguage []string
+		expected       interface{}
+	}{
+		{"Exact", []string{"fr"}, "fr"},
+		{"CaseInsensitive", []string{"DE-de"}, "de-DE"},
+		{"PrimaryTag", []string{"fr-CA"}, "fr"},
+		{"QualityWeighted", []string{"ja;q=0.9, de-DE;q=0.5, fr;q=0.8"}, "fr"},
+		{"QualityWeightedMultipleHeaders", []string{"en-US;q=0.1", "de-DE"}, "de-DE"},
+		{"ZeroQuality", []string{"fr;q=0, de"}, "de-DE"},
+		{"Wildcard", []string{"ja, *;q=0.5"}, "en-US"},
+		{"DefaultNoMatch", []string{"ja, zh;q=0.5"}, "en-US"},
+		{"DefaultNoHeader", nil, "en-US"},
+	}
+
+	for _, record := range testData {
+		t.Run(record.name, func(t *testing.T) {
+			testLocaleRequestBuilder(t, record.acceptLanguage, record.expected)
+		})
+	}
+
+	t.Run("NoDefault", testLocaleRequestBuilderNoDefault)
+}
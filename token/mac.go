@@ -0,0 +1,67 @@
+package token
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// InvalidMACError indicates that a value normalized as a MAC address was not a valid MAC address
+type InvalidMACError struct {
+	Value string
+}
+
+func (ime InvalidMACError) Error() string {
+	return fmt.Sprintf("Invalid MAC address: %s", ime.Value)
+}
+
+func (ime InvalidMACError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// MAC describes the canonical format for MAC address values.  Incoming values may use colons, dashes, or dots
+// between hex digits, or no separators at all, and may be in any case.  Each value must contain exactly 12 hex digits.
+type MAC struct {
+	// Separator is placed between each octet of the normalized value, e.g. ":" or "-".  If unset,
+	// the octets are not separated.
+	Separator string
+
+	// Uppercase indicates that the normalized value uses uppercase hex digits.  By default,
+	// lowercase is used.
+	Uppercase bool
+}
+
+// Normalize converts a MAC address into this MAC format.  An InvalidMACError is returned
+// if the value is not a MAC address.
+func (m MAC) Normalize(v string) (string, error) {
+	digits := make([]byte, 0, 12)
+	for i := 0; i < len(v); i++ {
+		c := v[i]
+		switch {
+		case c >= '0' && c <= '9', c >= 'a' && c <= 'f':
+			digits = append(digits, c)
+		case c >= 'A' && c <= 'F':
+			digits = append(digits, c+('a'-'A'))
+		case c == ':' || c == '-' || c == '.':
+			// separators are discarded
+		default:
+			return "", InvalidMACError{Value: v}
+		}
+	}
+
+	if len(digits) != 12 {
+		return "", InvalidMACError{Value: v}
+	}
+
+	octets := make([]string, 0, 6)
+	for i := 0; i < len(digits); i += 2 {
+		octets = append(octets, string(digits[i:i+2]))
+	}
+
+	normalized := strings.Join(octets, m.Separator)
+	if m.Uppercase {
+		normalized = strings.ToUpper(normalized)
+	}
+
+	return normalized, nil
+}
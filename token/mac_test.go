@@ -0,0 +1,117 @@
+package token
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMACNormalize(t *testing.T) {
+	testData := []struct {
+		name     string
+		format   MAC
+		value    string
+		expected string
+	}{
+		{"Colon", MAC{Separator: ":"}, "11:22:33:AA:BB:CC", "11:22:33:aa:bb:cc"},
+		{"Dash", MAC{Separator: ":"}, "11-22-33-aa-bb-cc", "11:22:33:aa:bb:cc"},
+		{"Dot", MAC{Separator: ":"}, "1122.33aa.bbcc", "11:22:33:aa:bb:cc"},
+		{"Bare", MAC{Separator: ":"}, "112233aabbcc", "11:22:33:aa:bb:cc"},
+		{"ToDash", MAC{Separator: "-", Uppercase: true}, "11:22:33:aa:bb:cc", "11-22-33-AA-BB-CC"},
+		{"ToBare", MAC{}, "11:22:33:AA:BB:CC", "112233aabbcc"},
+	}
+
+	for _, record := range testData {
+		t.Run(record.name, func(t *testing.T) {
+			assert := assert.New(t)
+			actual, err := record.format.Normalize(record.value)
+			assert.NoError(err)
+			assert.Equal(record.expected, actual)
+		})
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, value := range []string{"", "11:22:33:aa:bb", "11:22:33:aa:bb:cc:dd", "11:22:33:aa:bb:cg", "11 22 33 aa bb cc", "not a mac"} {
+			assert := assert.New(t)
+			actual, err := MAC{Separator: ":"}.Normalize(value)
+			assert.Empty(actual)
+			assert.Equal(InvalidMACError{Value: value}, err, value)
+		}
+	})
+}
+
+func testMACRequestBuilderHeader(t *testing.T, value string, expected interface{}, expectedStatusCode int) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		rb, err = NewRequestBuilders(Options{
+			Claims: map[string]Value{
+				"mac": Value{Header: "X-Mac", MAC: &MAC{Separator: ":"}},
+			},
+			Metadata: map[string]Value{
+				"mac": Value{Parameter: "mac", MAC: &MAC{Uppercase: true}},
+			},
+		})
+	)
+
+	require.NoError(err)
+	original := httptest.NewRequest("GET", "/?mac="+value, nil)
+	original.Header.Set("X-Mac", value)
+	require.NoError(original.ParseForm())
+
+	tr, err := BuildRequest(original, rb)
+	if expectedStatusCode > 0 {
+		require.Error(err)
+		assert.Equal(expectedStatusCode, err.(BuildError).StatusCode())
+		return
+	}
+
+	require.NoError(err)
+	assert.Equal(expected, tr.Claims["mac"])
+	assert.Equal("112233AABBCC", tr.Metadata["mac"])
+}
+
+func testMACRequestBuilderVariable(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		rb, err = NewRequestBuilders(Options{
+			Claims: map[string]Value{
+				"mac": Value{Variable: "mac", MAC: &MAC{Separator: "-"}},
+			},
+		})
+	)
+
+	require.NoError(err)
+	original := mux.SetURLVars(httptest.NewRequest("GET", "/", nil), map[string]string{"mac": "11:22:33:AA:BB:CC"})
+	tr, err := BuildRequest(original, rb)
+	require.NoError(err)
+	assert.Equal("11-22-33-aa-bb-cc", tr.Claims["mac"])
+
+	original = mux.SetURLVars(httptest.NewRequest("GET", "/", nil), map[string]string{"mac": "invalid"})
+	_, err = BuildRequest(original, rb)
+	require.Error(err)
+	assert.Equal(http.StatusBadRequest, err.(BuildError).StatusCode())
+}
+
+func TestMACRequestBuilder(t *testing.T) {
+	t.Run("Colon", func(t *testing.T) {
+		testMACRequestBuilderHeader(t, "11:22:33:aa:bb:cc", "11:22:33:aa:bb:cc", 0)
+	})
+
+	t.Run("Dash", func(t *testing.T) {
+		testMACRequestBuilderHeader(t, "11-22-33-AA-BB-CC", "11:22:33:aa:bb:cc", 0)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		testMACRequestBuilderHeader(t, "11-22-33-AA-BB", nil, http.StatusBadRequest)
+	})
+
+	t.Run("Variable", testMACRequestBuilderVariable)
+}
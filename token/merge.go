@@ -0,0 +1,98 @@
+package token
+
+import "context"
+
+// deepMerger combines claim values such that nested objects are merged key by key.  Values are never
+// modified in place, since they may be shared with configuration or other requests.
+type deepMerger struct {
+	concatenateArrays bool
+}
+
+// toSlice returns the elements of the common JSON array representations
+func toSlice(v interface{}) ([]interface{}, bool) {
+	switch a := v.(type) {
+	case []interface{}:
+		return a, true
+
+	case []string:
+		s := make([]interface{}, len(a))
+		for i, e := range a {
+			s[i] = e
+		}
+
+		return s, true
+
+	default:
+		return nil, false
+	}
+}
+
+// merge returns the result of merging value into existing.  When both are objects, a new object containing
+// the keys of both is returned, with nested objects merged recursively.  Arrays are concatenated if so configured.
+// In all other cases, value replaces existing.
+func (dm deepMerger) merge(existing, value interface{}) interface{} {
+	if vm, ok := value.(map[string]interface{}); ok {
+		if em, ok := existing.(map[string]interface{}); ok {
+			merged := make(map[string]interface{}, len(em)+len(vm))
+			for k, e := range em {
+				merged[k] = e
+			}
+
+			for k, v := range vm {
+				if e, ok := merged[k]; ok {
+					merged[k] = dm.merge(e, v)
+				} else {
+					merged[k] = v
+				}
+			}
+
+			return merged
+		}
+	}
+
+	if dm.concatenateArrays {
+		if va, ok := toSlice(value); ok {
+			if ea, ok := toSlice(existing); ok {
+				return append(append(make([]interface{}, 0, len(ea)+len(va)), ea...), va...)
+			}
+		}
+	}
+
+	return value
+}
+
+// deepMergeClaimBuilder decorates another ClaimBuilder so that its claims are deep merged into the
+// target rather than overwriting any existing claims
+type deepMergeClaimBuilder struct {
+	ClaimBuilder
+	deepMerger
+}
+
+func (dmc deepMergeClaimBuilder) AddClaims(ctx context.Context, r *Request, target map[string]interface{}) error {
+	claims := make(map[string]interface{})
+	if err := dmc.ClaimBuilder.AddClaims(ctx, r, claims); err != nil {
+		return err
+	}
+
+	for k, v := range claims {
+		if existing, ok := target[k]; ok {
+			target[k] = dmc.merge(existing, v)
+		} else {
+			target[k] = v
+		}
+	}
+
+	return nil
+}
+
+// merged decorates a ClaimBuilder according to the merge semantics configured in these Options
+func (o Options) merged(cb ClaimBuilder) ClaimBuilder {
+	if !o.DeepMerge {
+		return cb
+	}
+
+	return deepMergeClaimBuilder{
+		ClaimBuilder: cb,
+		deepMerger:   deepMerger{concatenateArrays: o.ConcatenateArrays},
+	}
+}
@@ -0,0 +1,146 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeepMerger(t *testing.T) {
+	testData := []struct {
+		merger   deepMerger
+		existing interface{}
+		value    interface{}
+		expected interface{}
+	}{
+		{
+			existing: "old",
+			value:    "new",
+			expected: "new",
+		},
+		{
+			existing: map[string]interface{}{"a": 1},
+			value:    "new",
+			expected: "new",
+		},
+		{
+			existing: "old",
+			value:    map[string]interface{}{"a": 1},
+			expected: map[string]interface{}{"a": 1},
+		},
+		{
+			existing: map[string]interface{}{
+				"a": 1,
+				"nested": map[string]interface{}{
+					"b": 2,
+					"c": 3,
+				},
+			},
+			value: map[string]interface{}{
+				"d": 4,
+				"nested": map[string]interface{}{
+					"c": "replaced",
+					"e": 5,
+				},
+			},
+			expected: map[string]interface{}{
+				"a": 1,
+				"d": 4,
+				"nested": map[string]interface{}{
+					"b": 2,
+					"c": "replaced",
+					"e": 5,
+				},
+			},
+		},
+		{
+			existing: map[string]interface{}{"list": []interface{}{1, 2}},
+			value:    map[string]interface{}{"list": []interface{}{3}},
+			expected: map[string]interface{}{"list": []interface{}{3}},
+		},
+		{
+			merger:   deepMerger{concatenateArrays: true},
+			existing: map[string]interface{}{"list": []interface{}{1, 2}},
+			value:    map[string]interface{}{"list": []string{"three"}},
+			expected: map[string]interface{}{"list": []interface{}{1, 2, "three"}},
+		},
+		{
+			merger:   deepMerger{concatenateArrays: true},
+			existing: "old",
+			value:    []interface{}{1},
+			expected: []interface{}{1},
+		},
+	}
+
+	for i, record := range testData {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, record.expected, record.merger.merge(record.existing, record.value))
+		})
+	}
+}
+
+func TestDeepMergeClaimBuilder(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		var (
+			assert = assert.New(t)
+
+			defaults = map[string]interface{}{
+				"profile": map[string]interface{}{
+					"tier":  "gold",
+					"roles": []interface{}{"reader"},
+				},
+			}
+
+			builder = deepMergeClaimBuilder{
+				ClaimBuilder: staticClaimBuilder(defaults),
+			}
+
+			target = map[string]interface{}{
+				"sub": "test",
+				"profile": map[string]interface{}{
+					"region": "east",
+					"roles":  []interface{}{"writer"},
+				},
+			}
+		)
+
+		assert.NoError(builder.AddClaims(context.Background(), NewRequest(), target))
+		assert.Equal(
+			map[string]interface{}{
+				"sub": "test",
+				"profile": map[string]interface{}{
+					"tier":   "gold",
+					"region": "east",
+					"roles":  []interface{}{"reader"},
+				},
+			},
+			target,
+		)
+
+		// the configured defaults must not have been modified
+		assert.Equal(
+			map[string]interface{}{
+				"tier":  "gold",
+				"roles": []interface{}{"reader"},
+			},
+			defaults["profile"],
+		)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		var (
+			assert      = assert.New(t)
+			expectedErr = errors.New("expected")
+			builder     = deepMergeClaimBuilder{
+				ClaimBuilder: ClaimBuilderFunc(func(context.Context, *Request, map[string]interface{}) error {
+					return expectedErr
+				}),
+			}
+		)
+
+		assert.Equal(expectedErr, builder.AddClaims(context.Background(), NewRequest(), make(map[string]interface{})))
+	})
+}
@@ -30,3 +30,24 @@ func (m *mockClaimBuilder) AddClaims(ctx context.Context, r *Request, target map
 func (m *mockClaimBuilder) ExpectAddClaims(ctx context.Context, r *Request, target map[string]interface{}) *mock.Call {
 	return m.On("AddClaims", ctx, r, target)
 }
+
+type mockSequenceStore struct {
+	mock.Mock
+}
+
+func (m *mockSequenceStore) Load() (uint64, error) {
+	arguments := m.Called()
+	return arguments.Get(0).(uint64), arguments.Error(1)
+}
+
+func (m *mockSequenceStore) ExpectLoad() *mock.Call {
+	return m.On("Load")
+}
+
+func (m *mockSequenceStore) Save(v uint64) error {
+	return m.Called(v).Error(0)
+}
+
+func (m *mockSequenceStore) ExpectSave(v uint64) *mock.Call {
+	return m.On("Save", v)
+}
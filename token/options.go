@@ -3,7 +3,9 @@ package token
 import (
 	"time"
 
+	"github.com/xmidt-org/themis/clock"
 	"github.com/xmidt-org/themis/key"
+	"github.com/xmidt-org/themis/xhttp/xhttpclient"
 )
 
 // RemoteClaims describes a remote HTTP endpoint that can produce claims given the
@@ -15,6 +17,11 @@ type RemoteClaims struct {
 	// URL is the remote endpoint that is expected to receive Request.Metadata and return a JSON document
 	// which is merged into the token claims
 	URL string
+
+	// FailOpen allows a token to be issued without the remote claims when the remote endpoint fails, e.g. because
+	// it is unreachable or returns a non-2xx status.  The failure is logged instead.  By default, the token
+	// request fails.
+	FailOpen bool
 }
 
 // Value represents information pulled from either the HTTP request or statically, via config.
@@ -28,10 +35,67 @@ type Value struct {
 	// Variable is a URL gorilla/mux variable from with the value is pulled
 	Variable string
 
+	// Cookie is the name of an HTTP cookie from which the value is pulled.  If Header or Parameter are also
+	// set, they take precedence over the cookie.
+	Cookie string
+
+	// ServerName indicates that the value is the TLS server name the client requested via SNI.  This source
+	// is only used when Header, Parameter, and Cookie supply nothing.  Requests that do not use TLS, or that
+	// did not send SNI, have no server name.
+	ServerName bool
+
+	// ClientIP indicates that the value is the IP address of the client.  When the server has TrustedProxies
+	// configured, this is the client described by a trusted proxy's Forwarded header.  Like ServerName, this source
+	// is only used when Header, Parameter, and Cookie supply nothing.
+	ClientIP bool
+
+	// Scheme indicates that the value is the URI scheme, http or https, the client used.  When the server has
+	// TrustedProxies configured, this is the proto described by a trusted proxy's Forwarded header.  This source is
+	// only used when no other source supplies a value.
+	Scheme bool
+
+	// Body is a JSONPath-like expression that selects this value from a JSON request body, e.g. $.device.id
+	// or $.devices[0]['serial number'].  Strings, numbers, booleans, arrays, and objects are all used as is,
+	// though Capture and MAC only apply to strings.  A request body that is not valid JSON is rejected with
+	// a 400 status.  If the path does not resolve, Value is used as a default.  Body cannot be combined with
+	// Header, Parameter, Cookie, Variable, ServerName, ClientIP, or Scheme.
+	Body string
+
+	// Sources is an ordered list of places to look for this value, each described by its own Header, Parameter,
+	// Cookie, Variable, ServerName, ClientIP, or Scheme.  The first source that supplies a non-empty value is used,
+	// which lets a single claim accept whichever header or parameter a particular caller sends.  Sources cannot be
+	// combined with those fields on this Value.  If no source supplies anything, Value is used as a default.
+	Sources []Value
+
+	// Env is the name of an environment variable from which this value is read once, at startup, and then used
+	// as a constant for every token.  This suits values that are fixed for a deployment, such as a region or
+	// cluster.  If the variable is unset or empty, Value is used as a default.  Env cannot be combined with any
+	// of the sources taken from the HTTP request.
+	Env string
+
+	// Required indicates that an HTTP request must supply this value via one of Header, Parameter, Cookie,
+	// Variable, ServerName, ClientIP, Scheme, Body, or Sources.  A request without the value is rejected with
+	// a 400 status.  By default, a missing value is simply omitted.  For a value taken from Env, the application
+	// fails to start if the variable is unset or empty and there is no default.
+	Required bool
+
+	// Capture, if set, extracts part of a value taken from the HTTP request using a regular expression.
+	// Capture is applied before MAC normalization.
+	Capture *Capture
+
+	// MAC, if set, normalizes a value taken from the HTTP request as a MAC address.  Requests with
+	// a value that is not a MAC address are rejected with a 400 status.
+	MAC *MAC
+
 	// Value is the statically assigned value from configuration
 	Value interface{}
 }
 
+// fromRequest tests if this Value is taken from the HTTP request rather than statically configured
+func (v Value) fromRequest() bool {
+	return len(v.Header) > 0 || len(v.Parameter) > 0 || len(v.Cookie) > 0 || v.ServerName || v.ClientIP || v.Scheme || len(v.Variable) > 0 || len(v.Body) > 0 || len(v.Sources) > 0
+}
+
 // PartnerID describes how to extract the partner id from an HTTP request.  Partner IDs
 // require some special processing.
 type PartnerID struct {
@@ -52,14 +116,47 @@ type PartnerID struct {
 	Default string
 }
 
+// Tenant describes how to select a signing key based on the tenant making a token request.  The tenant
+// name is taken from the Header, or the Parameter if the header is absent.  A tenant name is required on
+// each token request, and must be one of the configured Keys.
+type Tenant struct {
+	// Header is the HTTP header containing the tenant name
+	Header string
+
+	// Parameter is the HTTP parameter containing the tenant name
+	Parameter string
+
+	// ServerName indicates that the TLS server name requested via SNI names the tenant.  Header and
+	// Parameter take precedence when they are also set.
+	ServerName bool
+
+	// Keys maps each tenant name to the descriptor for that tenant's signing key.  Tenant names are
+	// matched case insensitively.  If a descriptor has no Kid, the tenant name is used as the kid unless
+	// the descriptor requests a thumbprint kid.
+	//
+	// Each key must be compatible with the factory's Alg.
+	Keys map[string]key.Descriptor
+}
+
 // Options holds the configurable information for a token Factory
 type Options struct {
-	// Alg is the required JWT signing algorithm to use
+	// Alg is the required JWT signing algorithm to use.  If unset, the algorithm pinned by Key.Alg is used, or
+	// DefaultAlg if Key does not pin one.  If Key does pin an algorithm, Alg must match it.
 	Alg string
 
 	// Key describes the signing key to use
 	Key key.Descriptor
 
+	// Fallback is the optional descriptor for a secondary key, registered alongside Key, that signs tokens
+	// whenever the key selected for a token fails to sign, e.g. because a remote KMS is momentarily unavailable.
+	// It must be usable with Alg.  Each such downgrade is logged and counted by the key_fallback_count metric.
+	Fallback *key.Descriptor
+
+	// KeyGroup is the optional name of the key group whose Registry holds this factory's keys, including any
+	// tenant keys.  Keys in a group are published only by that group's JWK set.  If unset, the default Registry
+	// is used.
+	KeyGroup string
+
 	// Claims is an optional map of claims to add to every token emitted by this factory.
 	// Any claims here can be overridden by claims within a token Request.
 	//
@@ -74,6 +171,50 @@ type Options struct {
 	// performed, though a partner id may still be configured as part of the claims.
 	PartnerID *PartnerID
 
+	// Locale is the optional configuration for a locale claim derived from the Accept-Language header
+	Locale *Locale
+
+	// AuthTime is the optional configuration for an OIDC auth_time claim, taken from a trusted header or the current time
+	AuthTime *AuthTime
+
+	// AMR is the optional configuration for an OIDC amr claim, derived from the client certificate and a trusted header
+	AMR *AMR
+
+	// AtHash is the optional configuration for an OIDC at_hash claim, the hash of an access token supplied with the request
+	AtHash *AtHash
+
+	// SignedCookie is the optional configuration for claims taken from an HMAC-signed cookie, as used by double-submit
+	// browser flows.  A cookie that fails verification is rejected with a 401 status.
+	SignedCookie *SignedCookie
+
+	// Confirmation is the optional configuration for a cnf claim that binds each token to the client certificate
+	// presented over mutual TLS, or to a public key submitted in the request body
+	Confirmation *Confirmation
+
+	// GRPCMetadata is the optional configuration for claims taken from gRPC metadata that a gateway has forwarded
+	// as prefixed HTTP headers.  Its Keys cannot collide with reserved or otherwise configured claims.
+	GRPCMetadata *GRPCMetadata
+
+	// BasicAuth is the optional configuration for a client id claim derived from HTTP basic auth credentials
+	BasicAuth *BasicAuth
+
+	// AllowedAudiences is an optional allow-list for the aud claim.  When the aud claim is derived from
+	// the token request, e.g. from an HTTP header, each requested audience must appear in this list or the
+	// request is rejected.  This applies even when the aud claim also has a Value, e.g. as the default for
+	// its Sources.  If the aud claim is statically configured, or if this field is empty, no
+	// audience validation is performed.
+	AllowedAudiences []string
+
+	// Templates are the optional claims rendered with text/template, keyed by claim name.  Each template is
+	// rendered after every other claim has been built, with those claims as its data, e.g. {{.sub}}@{{.region}}.
+	// A token request missing a claim that a template refers to is rejected with a 400 status.  When the
+	// application supplies a config.Reloader, templates are reread on each reload.
+	Templates map[string]string
+
+	// Scope is the optional configuration that restricts the requested scope claim to the scopes allowed
+	// for each tenant
+	Scope *Scope
+
 	// Nonce indicates whether a nonce (jti) should be applied to each token emitted
 	// by this factory.
 	Nonce bool
@@ -86,6 +227,15 @@ type Options struct {
 	// using this duration from the current time if this field is positive.
 	Duration time.Duration
 
+	// MaxDuration is the optional ceiling on the lifetime of every token.  Duration may not exceed it, and
+	// ExpirationJitter never extends a token's lifetime beyond it.
+	MaxDuration time.Duration
+
+	// ExpirationJitter is the optional width of a window over which each token's exp is randomly spread, so that
+	// tokens issued together do not all expire together.  Each token's lifetime falls between Duration and
+	// Duration plus this jitter, shifted earlier as needed to stay within MaxDuration.  It must be shorter than Duration.
+	ExpirationJitter time.Duration
+
 	// DisableNotBefore specifically controls the nbf claim.
 	DisableNotBefore bool
 
@@ -100,4 +250,190 @@ type Options struct {
 	// and returns a set of claims to be merged into tokens returned by the Factory.  Returned
 	// claims from the remote system do not override claims configured on the Factory.
 	Remote *RemoteClaims
+
+	// CanonicalClaims indicates whether the token header and payload are serialized as canonical JSON, i.e.
+	// with sorted keys at every level, no whitespace, and no HTML escaping.  This makes the signed payload
+	// byte-for-byte reproducible for identical claims, which is useful for verifiers that hash the payload.
+	// Tokens produced this way are still standard JWTs.
+	CanonicalClaims bool
+
+	// CompressClaims indicates whether the token payload is compressed with DEFLATE before signing.  Compressed
+	// tokens carry a zip header of DEF, and the signature covers the compressed payload.  Only consumers that
+	// understand the zip header can read the claims, so this is off by default.  See Inflate.
+	CompressClaims bool
+
+	// DeepMerge controls how claims from different sources, i.e. the token request, the remote system, and
+	// static configuration, are combined.  By default, a claim from a later source replaces the same claim
+	// from an earlier source wholesale.  If this field is true, nested JSON objects are instead merged key by key.
+	DeepMerge bool
+
+	// ConcatenateArrays causes arrays from different sources to be concatenated rather than replaced.
+	// This field is ignored unless DeepMerge is true.
+	ConcatenateArrays bool
+
+	// Tenant is the optional configuration for per-tenant signing keys.  If set, each token is signed
+	// with the key of the tenant named in the token request, and requests without a known tenant are rejected.
+	// The Key field is still registered in this case, but is not used to sign tokens.
+	Tenant *Tenant
+
+	// Algorithms is the optional allow-list of signing algorithms that a token request may select in place of Alg,
+	// each with its own signing key.  Requests naming any other algorithm are rejected.  This cannot be combined
+	// with Tenant.
+	Algorithms *Algorithms
+
+	// Sequence is the optional configuration for a sequence claim.  The sequence is per-process unless
+	// a SequenceStore is supplied.  See NewSequenceClaimBuilder.
+	Sequence *Sequence
+
+	// Issue controls the HTTP methods and request bodies accepted by the issue handler.  By default, only
+	// GET requests are accepted and parameters are parsed from the query and any form-encoded body.
+	Issue Issue
+
+	// RedactClaims lists the names of claims whose values must never appear in logs.  Wherever claims are
+	// logged, the values of these claims are replaced with Redacted, though their names are still logged.
+	RedactClaims []string
+
+	// LogTokenStats adds the signed token's size in bytes, the time spent signing it, and the total time
+	// spent issuing it to the "issued token" log entry, as the size, signDuration, and duration fields.
+	// The sign duration includes any wait for a signing slot or for a coalesced request.
+	LogTokenStats bool
+
+	// Replay is the optional configuration for replay protection.  If set, each client nonce may only be
+	// used once by the issue and batch handlers within the configured TTL.
+	Replay *Replay
+
+	// Challenge is the optional configuration for a challenge-response flow.  If set, the challenge endpoint
+	// issues nonces using the noncer, and the issue, batch, and pair handlers reject any request that does not
+	// echo one of those nonces.
+	Challenge *Challenge
+
+	// SignErrors causes error responses from the issue and claims handlers to be written as application/problem+json
+	// with a detached JWS signature, produced with the factory's active key, in the SignatureHeader.  This allows
+	// clients to detect spoofed error responses.  By default, errors are not signed.
+	SignErrors bool
+
+	// ProblemErrors causes error responses from the issue and claims handlers to be written as unsigned
+	// application/problem+json, including each error's stable code.  This is implied by SignErrors.
+	ProblemErrors bool
+
+	// Batch is the optional configuration for batch issuance.  If unset, no BatchHandler is created.
+	Batch *Batch
+
+	// SelfTest causes each factory to issue a throwaway token with every signing key when the application starts,
+	// verifying each token against the key's published form.  If any key fails, the application does not start.
+	// This catches key and algorithm combinations that would otherwise fail on the first token request.
+	SelfTest bool
+
+	// Strict rejects token requests with a 400 status when none of the claims configured to come from the HTTP
+	// request, including any partner id claim, were supplied.  This guards against issuing nearly empty tokens
+	// when an upstream component is misconfigured.  By default, such requests are issued tokens with only the
+	// static and time-based claims.
+	Strict bool
+
+	// Signatures is the optional configuration that signs each token with several keys at once, producing the
+	// JWS general JSON serialization instead of a compact token.  This cannot be combined with CompressClaims,
+	// Tenant, or Algorithms.
+	Signatures *Signatures
+
+	// DeterministicSignatures causes ECDSA signatures to use nonces derived from the key and the token per
+	// RFC 6979, rather than random nonces, so that identical tokens have byte-identical signatures.  This is
+	// useful for reproducible test vectors.  Verification is unaffected.  Alg must be one of the ES algorithms.
+	DeterministicSignatures bool
+
+	// JKU is the optional public URL of the JWK set that holds this factory's keys.  If set, it is emitted as the
+	// jku header of every token, alongside the kid, so that verifiers can discover keys on their own.  This must be an
+	// absolute https URL.
+	JKU string
+
+	// ClaimsSchema is the optional path to a file holding a JSON Schema that every token's claims, once merged,
+	// must conform to.  Tokens whose claims do not conform are rejected with a 400 status, listing each violation.
+	// The schema is loaded at startup, and an unreadable or invalid schema prevents startup.
+	//
+	// The supported validation keywords are type, properties, required, additionalProperties, items, minItems,
+	// maxItems, enum, const, minLength, maxLength, pattern, minimum, and maximum.  A schema with any other
+	// keyword, apart from annotations such as title and description, is rejected rather than partially enforced.
+	ClaimsSchema string
+
+	// Headers are optional custom parameters added to the JOSE header of every token.  They cannot replace
+	// the header parameters defined by RFC 7515, such as alg, kid, or typ.
+	Headers map[string]interface{}
+
+	// Crit lists the names of custom Headers that verifiers must understand in order to accept a token.  These
+	// names are emitted, in order, as the token's crit header parameter.  Each name must be one of Headers.
+	Crit []string
+
+	// Profile is the optional standard profile that issued tokens must conform to.  The only profile is
+	// ProfileRFC9068, which emits a typ header of at+jwt, always emits a jti claim, and rejects a token request
+	// with a 400 status unless every one of AccessTokenProfileClaims is resolved.  It requires a Duration.
+	Profile string
+
+	// Webhook is the optional external system that is notified, in the background, of each issued token
+	Webhook *Webhook
+
+	// Limits restricts the number of claims and the payload size of each token.  Token requests that exceed
+	// a limit are rejected with a 400 status before anything is signed, which protects verifiers from
+	// oversized tokens.  By default, there are no limits.
+	Limits Limits
+
+	// RateLimit is the optional configuration that limits how often tokens are issued for each value of a claim,
+	// e.g. each device id.  Token requests over the limit are rejected with a 429 status.
+	RateLimit *RateLimit
+
+	// Quota is the optional configuration that caps how many tokens are issued for each value of a claim,
+	// e.g. each subject, within a window.  Token requests over the quota are rejected with a 429 status.
+	Quota *Quota
+
+	// Coalesce causes identical token requests that arrive while one of them is being signed to share that
+	// request's token, rather than each being signed.  Requests are identical when their signed header and every
+	// claim, including iat and exp, match.  Since the jti differs for every token, this field is ignored when
+	// Nonce is true.  Each request is still counted by RateLimit, Quota, and Audit.
+	Coalesce bool
+
+	// Concurrency is the optional configuration that caps how many tokens are signed at once, sharing the
+	// signing capacity fairly across tenants
+	Concurrency *Concurrency
+
+	// Audit is the optional configuration that persists a minimal record of each issued token, for forensic
+	// correlation.  The records are written to the AuditStore supplied to the application, if any.
+	Audit *Audit
+
+	// Refresh is the optional configuration for a refresh token issued alongside each access token.  It is
+	// an independent set of Options, with its own key, claims, and duration, so the refresh token's aud, iss,
+	// typ, and exp can all differ from the access token's.  Only the fields that describe the token itself
+	// are used.  The issue configuration of the enclosing Options applies to both tokens.  If unset, no
+	// PairHandler is created.
+	Refresh *Options
+
+	// clock is the application's Clock, supplied by Unmarshal rather than configuration.  If nil, the
+	// system time is used.
+	clock clock.Clock
+
+	// auditStore is the application's AuditStore, supplied by Unmarshal rather than configuration.  It is
+	// ignored unless Audit is set.
+	auditStore AuditStore
+
+	// quotaStore is the application's QuotaStore, supplied by Unmarshal rather than configuration.  It is
+	// ignored unless Quota is set.
+	quotaStore QuotaStore
+
+	// client is the application's HTTP client, supplied by Unmarshal rather than configuration.  It is ignored
+	// unless Webhook is set.
+	client xhttpclient.Interface
+}
+
+// alg returns the algorithm that signs tokens by default: Alg, else the algorithm pinned by Key, else DefaultAlg
+func (o Options) alg() string {
+	switch {
+	case len(o.Alg) > 0:
+		return o.Alg
+	case len(o.Key.Alg) > 0:
+		return o.Key.Alg
+	default:
+		return DefaultAlg
+	}
+}
+
+// now returns the source of the current time for everything built from these Options
+func (o Options) now() func() time.Time {
+	return clock.NowFunc(o.clock)
 }
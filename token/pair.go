@@ -0,0 +1,98 @@
+package token
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+// TokenPair is an access token issued together with its refresh token
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// PairRequest holds the separately built token Requests for each token in a pair
+type PairRequest struct {
+	Access  *Request
+	Refresh *Request
+}
+
+// NewPairEndpoint returns a go-kit endpoint that issues an access token and a refresh token from
+// separate factories.  Since each factory has its own Options, the two tokens can carry different
+// claims, such as aud, iss, or typ, and can expire at different times.
+func NewPairEndpoint(access, refresh Factory) endpoint.Endpoint {
+	return func(ctx context.Context, v interface{}) (interface{}, error) {
+		pr := v.(*PairRequest)
+		accessToken, err := access.NewToken(ctx, pr.Access)
+		if err != nil {
+			return nil, err
+		}
+
+		refreshToken, err := refresh.NewToken(ctx, pr.Refresh)
+		if err != nil {
+			return nil, err
+		}
+
+		return TokenPair{
+			AccessToken:  accessToken,
+			RefreshToken: refreshToken,
+		}, nil
+	}
+}
+
+// DecodePairRequestWith prepares the HTTP request with a RequestParser, then builds the token Request for
+// each token in the pair with its own RequestBuilders
+func DecodePairRequestWith(p RequestParser, access, refresh RequestBuilders) func(context.Context, *http.Request) (interface{}, error) {
+	return func(ctx context.Context, hr *http.Request) (interface{}, error) {
+		if err := p(hr); err != nil {
+			return nil, err
+		}
+
+		// both tokens share a single decoding of the body
+		hr = withDecodedBody(hr)
+		accessRequest, err := BuildRequest(hr, access)
+		if err != nil {
+			return nil, err
+		}
+
+		refreshRequest, err := BuildRequest(hr, refresh)
+		if err != nil {
+			return nil, err
+		}
+
+		return &PairRequest{
+			Access:  accessRequest,
+			Refresh: refreshRequest,
+		}, nil
+	}
+}
+
+// PairHandler is an http.Handler that issues an access token and a refresh token in a single JSON response
+type PairHandler http.Handler
+
+// NewPairHandler creates a PairHandler that accepts the same methods and body as the issue handler.  The access
+// and refresh RequestBuilders are used to build each token's Request from the same HTTP request.
+func (i Issue) NewPairHandler(e endpoint.Endpoint, access, refresh RequestBuilders, options ...kithttp.ServerOption) (PairHandler, error) {
+	p, err := i.requestParser()
+	if err != nil {
+		return nil, err
+	}
+
+	mh, err := i.methodHandler(
+		kithttp.NewServer(
+			e,
+			DecodePairRequestWith(p, access, refresh),
+			kithttp.EncodeJSONResponse,
+			options...,
+		),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return mh, nil
+}
@@ -0,0 +1,255 @@
+package token
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/xmidt-org/themis/config"
+	"github.com/xmidt-org/themis/key"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+func testPairHandlerSuccess(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		registry key.Registry
+		handler  PairHandler
+		app      = fxtest.New(t,
+			fx.Provide(
+				config.ProvideViper(
+					config.Json(`
+						{
+							"token": {
+								"key": {"kid": "access", "bits": 512},
+								"duration": "5m",
+								"claims": {
+									"aud": {"value": "api"},
+									"iss": {"value": "themis"},
+									"typ": {"value": "access"},
+									"sub": {"header": "X-Subject"}
+								},
+								"refresh": {
+									"key": {"kid": "refresh", "bits": 512},
+									"duration": "24h",
+									"claims": {
+										"aud": {"value": "refresh-service"},
+										"iss": {"value": "themis-refresh"},
+										"typ": {"value": "refresh"},
+										"sub": {"header": "X-Subject"}
+									}
+								}
+							}
+						}
+					`),
+				),
+				func() key.Registry { return key.NewRegistry(nil) },
+				Unmarshal("token"),
+			),
+			fx.Populate(&registry, &handler),
+		)
+	)
+
+	require.NotNil(handler)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	var (
+		response = httptest.NewRecorder()
+		request  = httptest.NewRequest("GET", "/issue/pair", nil)
+	)
+
+	request.Header.Set("X-Subject", "device")
+	handler.ServeHTTP(response, request)
+	require.Equal(http.StatusOK, response.Code)
+
+	var pair TokenPair
+	require.NoError(json.Unmarshal(response.Body.Bytes(), &pair))
+
+	parse := func(signed, kid string) jwt.MapClaims {
+		claims := jwt.MapClaims{}
+		token, err := jwt.ParseWithClaims(signed, claims, func(token *jwt.Token) (interface{}, error) {
+			assert.Equal(kid, token.Header["kid"])
+			return publishedKey(t, registry, kid), nil
+		})
+
+		require.NoError(err)
+		require.True(token.Valid)
+		return claims
+	}
+
+	access := parse(pair.AccessToken, "access")
+	assert.Equal("api", access["aud"])
+	assert.Equal("themis", access["iss"])
+	assert.Equal("access", access["typ"])
+	assert.Equal("device", access["sub"])
+	assert.Equal(float64(300), access["exp"].(float64)-access["iat"].(float64))
+
+	refresh := parse(pair.RefreshToken, "refresh")
+	assert.Equal("refresh-service", refresh["aud"])
+	assert.Equal("themis-refresh", refresh["iss"])
+	assert.Equal("refresh", refresh["typ"])
+	assert.Equal("device", refresh["sub"])
+	assert.Equal(float64(86400), refresh["exp"].(float64)-refresh["iat"].(float64))
+}
+
+func testPairHandlerNotConfigured(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		handler PairHandler
+		app     = fxtest.New(t,
+			fx.Provide(
+				config.ProvideViper(
+					config.Json(`
+						{
+							"token": {
+								"key": {"kid": "access", "bits": 512}
+							}
+						}
+					`),
+				),
+				func() key.Registry { return key.NewRegistry(nil) },
+				Unmarshal("token"),
+			),
+			fx.Populate(&handler),
+		)
+	)
+
+	app.RequireStart()
+	app.RequireStop()
+	assert.Nil(handler)
+}
+
+func testPairHandlerRotation(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		registry key.Registry
+		access   Factory
+		handler  PairHandler
+		app      = fxtest.New(t,
+			fx.Provide(
+				config.ProvideViper(
+					config.Json(`
+						{
+							"token": {
+								"key": {"kid": "access", "bits": 512, "rotateInterval": "24h"},
+								"fallback": {"kid": "access-fallback", "bits": 512},
+								"refresh": {
+									"key": {"kid": "refresh", "bits": 512},
+									"fallback": {"kid": "refresh-fallback", "bits": 512}
+								}
+							}
+						}
+					`),
+				),
+				func() key.Registry { return key.NewRegistry(nil) },
+				Unmarshal("token"),
+			),
+			fx.Populate(&registry, &access, &handler),
+		)
+	)
+
+	require.NotNil(handler)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	kids := func() (string, string) {
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, httptest.NewRequest("GET", "/issue/pair", nil))
+		require.Equal(http.StatusOK, response.Code)
+
+		var pair TokenPair
+		require.NoError(json.Unmarshal(response.Body.Bytes(), &pair))
+
+		accessHeader, _, err := decodeUnverified(pair.AccessToken)
+		require.NoError(err)
+		refreshHeader, _, err := decodeUnverified(pair.RefreshToken)
+		require.NoError(err)
+		return accessHeader["kid"].(string), refreshHeader["kid"].(string)
+	}
+
+	accessKid, refreshKid := kids()
+	assert.Equal("access", accessKid)
+	assert.Equal("refresh", refreshKid)
+
+	// the refresh factory shares the registry, but the registry's active key and fallback stay the access ones
+	active, ok := registry.Active()
+	require.True(ok)
+	assert.Equal("access", active.KID())
+	fallback, ok := registry.Fallback()
+	require.True(ok)
+	assert.Equal("access-fallback", fallback.KID())
+
+	rotated, err := access.(*factory).rotator.Rotate()
+	require.NoError(err)
+	accessKid, refreshKid = kids()
+	assert.Equal(rotated.KID(), accessKid)
+	assert.Equal("refresh", refreshKid, "rotating the access key must not change the refresh key")
+
+	active, ok = registry.Active()
+	require.True(ok)
+	assert.Equal(rotated.KID(), active.KID())
+}
+
+func TestPairHandler(t *testing.T) {
+	t.Run("Success", testPairHandlerSuccess)
+	t.Run("NotConfigured", testPairHandlerNotConfigured)
+	t.Run("Rotation", testPairHandlerRotation)
+}
+
+func TestNewPairEndpoint(t *testing.T) {
+	var (
+		expectedErr = errors.New("expected")
+
+		access  = new(mockFactory)
+		refresh = new(mockFactory)
+		pr      = &PairRequest{Access: NewRequest(), Refresh: NewRequest()}
+
+		e = NewPairEndpoint(access, refresh)
+	)
+
+	access.ExpectNewToken(context.Background(), pr.Access).Return("access token", error(nil)).Once()
+	refresh.ExpectNewToken(context.Background(), pr.Refresh).Return("refresh token", error(nil)).Once()
+
+	t.Run("Success", func(t *testing.T) {
+		assert := assert.New(t)
+		v, err := e(context.Background(), pr)
+		assert.NoError(err)
+		assert.Equal(TokenPair{AccessToken: "access token", RefreshToken: "refresh token"}, v)
+	})
+
+	t.Run("AccessError", func(t *testing.T) {
+		assert := assert.New(t)
+		access.ExpectNewToken(context.Background(), pr.Access).Return("", expectedErr).Once()
+
+		v, err := e(context.Background(), pr)
+		assert.Nil(v)
+		assert.Equal(expectedErr, err)
+	})
+
+	t.Run("RefreshError", func(t *testing.T) {
+		assert := assert.New(t)
+		access.ExpectNewToken(context.Background(), pr.Access).Return("access token", error(nil)).Once()
+		refresh.ExpectNewToken(context.Background(), pr.Refresh).Return("", expectedErr).Once()
+
+		v, err := e(context.Background(), pr)
+		assert.Nil(v)
+		assert.Equal(expectedErr, err)
+	})
+
+	access.AssertExpectations(t)
+	refresh.AssertExpectations(t)
+}
@@ -0,0 +1,109 @@
+package token
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/xmidt-org/themis/key"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+const (
+	ContentTypeProblemJSON = "application/problem+json"
+
+	// SignatureHeader is the HTTP response header holding the detached JWS signature of a signed error body
+	SignatureHeader = "X-JWS-Signature"
+)
+
+// Problem is the RFC 7807 representation of an error response
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+
+	// Code is the stable, machine-readable code for the error.  See ErrorCode.
+	Code string `json:"code,omitempty"`
+}
+
+// DetachedSigner produces detached JWS signatures, as described in RFC 7515 appendix F
+type DetachedSigner interface {
+	// SignDetached returns the compact JWS serialization of the given payload with the payload
+	// segment omitted, i.e. header..signature
+	SignDetached(payload []byte) (string, error)
+}
+
+// SignDetached signs an arbitrary payload with this factory's active key.  Tenant keys are never used.
+func (f *factory) SignDetached(payload []byte) (string, error) {
+	pair := f.pair.Load().(key.Pair)
+	h, err := CanonicalJSON(map[string]interface{}{
+		"alg": f.method.Alg(),
+		"kid": pair.KID(),
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	header := jwt.EncodeSegment(h)
+	signature, err := f.method.Sign(strings.Join([]string{header, jwt.EncodeSegment(payload)}, "."), pair.Sign())
+	if err != nil {
+		return "", err
+	}
+
+	f.keys.Used(pair.KID())
+	return header + ".." + signature, nil
+}
+
+// NewProblem produces the Problem for an error.  The status is taken from the error's StatusCode
+// method, if present, and defaults to http.StatusInternalServerError.  The code is taken from ErrorCode.
+func NewProblem(err error) Problem {
+	status := http.StatusInternalServerError
+	if sc, ok := err.(kithttp.StatusCoder); ok {
+		status = sc.StatusCode()
+	}
+
+	return Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: err.Error(),
+		Code:   ErrorCode(err),
+	}
+}
+
+// NewSignedErrorEncoder creates a go-kit error encoder that writes each error as an application/problem+json
+// body whose detached JWS signature is written to the SignatureHeader.  Clients can verify the signature
+// using the same published key used to verify tokens.  If the signature cannot be produced, or if s is nil,
+// the body is written without a SignatureHeader.
+func NewSignedErrorEncoder(s DetachedSigner) kithttp.ErrorEncoder {
+	return func(ctx context.Context, err error, response http.ResponseWriter) {
+		problem := NewProblem(err)
+		body, marshalErr := CanonicalJSON(problem)
+		if marshalErr != nil {
+			kithttp.DefaultErrorEncoder(ctx, err, response)
+			return
+		}
+
+		if h, ok := err.(kithttp.Headerer); ok {
+			for k, values := range h.Headers() {
+				for _, v := range values {
+					response.Header().Add(k, v)
+				}
+			}
+		}
+
+		if s != nil {
+			if signature, signErr := s.SignDetached(body); signErr == nil {
+				response.Header().Set(SignatureHeader, signature)
+			}
+		}
+
+		response.Header().Set("Content-Type", ContentTypeProblemJSON)
+		response.WriteHeader(problem.Status)
+		response.Write(body)
+	}
+}
@@ -0,0 +1,202 @@
+package token
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xmidt-org/themis/key"
+	"github.com/xmidt-org/themis/xhttp/xhttpserver"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/multierr"
+)
+
+func testNewProblemDefault(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(
+		Problem{
+			Type:   "about:blank",
+			Title:  http.StatusText(http.StatusInternalServerError),
+			Status: http.StatusInternalServerError,
+			Detail: "expected",
+			Code:   ErrorCodeServerError,
+		},
+		NewProblem(errors.New("expected")),
+	)
+}
+
+func testNewProblemStatusCoder(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		problem = NewProblem(UnknownTenantError{Tenant: "initech"})
+	)
+
+	assert.Equal(http.StatusBadRequest, problem.Status)
+	assert.Equal(http.StatusText(http.StatusBadRequest), problem.Title)
+	assert.Equal("Unknown tenant: initech", problem.Detail)
+	assert.Equal(ErrorCodeUnknownTenant, problem.Code)
+}
+
+// customCodeError is an error that supplies its own code
+type customCodeError struct{}
+
+func (cce customCodeError) Error() string     { return "custom" }
+func (cce customCodeError) StatusCode() int   { return http.StatusBadRequest }
+func (cce customCodeError) ErrorCode() string { return "custom_code" }
+
+// notFoundError is an error with a status but no code
+type notFoundError struct{}
+
+func (nfe notFoundError) Error() string   { return "not found" }
+func (nfe notFoundError) StatusCode() int { return http.StatusNotFound }
+
+func testNewProblemCode(t *testing.T) {
+	testData := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"MissingClaim", xhttpserver.MissingValueError{Header: "X-Device"}, ErrorCodeMissingClaim},
+		{"MissingBodyValue", MissingBodyValueError{Path: "device.id"}, ErrorCodeMissingClaim},
+		{"RateLimited", RateLimitedError{RetryAfter: time.Second}, ErrorCodeRateLimited},
+		{"QuotaExceeded", QuotaExceededError{Claim: "sub", Value: "device", Limit: 1}, ErrorCodeQuotaExceeded},
+		{"Replay", ReplayError{Nonce: "abc"}, ErrorCodeReplay},
+		{"UnsupportedBody", UnsupportedBodyError{ContentType: "text/plain"}, ErrorCodeUnsupportedMediaType},
+		{"NoSigningKey", NoSigningKeyError{Kid: "test"}, ErrorCodeNoSigningKey},
+		{"Custom", customCodeError{}, "custom_code"},
+		{"BuildError", BuildError{Err: xhttpserver.MissingValueError{Header: "X-Device"}}, ErrorCodeMissingClaim},
+		{
+			"BuildErrorSeverest",
+			BuildError{Err: multierr.Combine(xhttpserver.MissingValueError{Header: "X-Device"}, NoSigningKeyError{Kid: "test"})},
+			ErrorCodeNoSigningKey,
+		},
+		{"Wrapped", fmt.Errorf("wrapped: %w", ReplayError{Nonce: "abc"}), ErrorCodeReplay},
+		{"UnmappedServerError", xhttpserver.MissingVariableError{Variable: "id"}, ErrorCodeServerError},
+		{"UnmappedClientError", notFoundError{}, ErrorCodeInvalidRequest},
+		{"NoStatus", errors.New("expected"), ErrorCodeServerError},
+	}
+
+	for _, record := range testData {
+		t.Run(record.name, func(t *testing.T) {
+			assert := assert.New(t)
+			assert.Equal(record.expected, ErrorCode(record.err))
+			assert.Equal(record.expected, NewProblem(record.err).Code)
+		})
+	}
+}
+
+func testNewProblemErrorEncoder(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		response = httptest.NewRecorder()
+	)
+
+	NewProblemErrorEncoder()(context.Background(), RateLimitedError{RetryAfter: 2 * time.Second}, response)
+	assert.Equal(http.StatusTooManyRequests, response.Code)
+	assert.Equal(ContentTypeProblemJSON, response.HeaderMap.Get("Content-Type"))
+	assert.Equal("2", response.HeaderMap.Get("Retry-After"))
+	assert.Empty(response.HeaderMap.Get(SignatureHeader))
+
+	var problem Problem
+	require.NoError(json.Unmarshal(response.Body.Bytes(), &problem))
+	assert.Equal(http.StatusTooManyRequests, problem.Status)
+	assert.Equal(ErrorCodeRateLimited, problem.Code)
+}
+
+func TestNewProblem(t *testing.T) {
+	t.Run("Default", testNewProblemDefault)
+	t.Run("StatusCoder", testNewProblemStatusCoder)
+	t.Run("Code", testNewProblemCode)
+	t.Run("ErrorEncoder", testNewProblemErrorEncoder)
+}
+
+// publishedKey retrieves a public key the same way a client would, via the JWK set
+func publishedKey(t *testing.T, registry key.Registry, kid string) interface{} {
+	var (
+		require  = require.New(t)
+		handler  = key.NewHandlerJWKSet(key.NewKeySetEndpoint(registry))
+		response = httptest.NewRecorder()
+	)
+
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/keys", nil))
+	require.Equal(http.StatusOK, response.Code)
+
+	set, err := jwk.Parse(response.Body)
+	require.NoError(err)
+
+	keys := set.LookupKeyID(kid)
+	require.Len(keys, 1)
+
+	public, err := keys[0].Materialize()
+	require.NoError(err)
+	return public
+}
+
+func testNewSignedErrorEncoder(t *testing.T, alg string, d key.Descriptor) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		registry = key.NewRegistry(nil)
+	)
+
+	f, err := NewFactory(Options{Alg: alg, Key: d}, ClaimBuilders{}, registry)
+	require.NoError(err)
+
+	handler, err := Issue{}.NewHandler(
+		func(context.Context, interface{}) (interface{}, error) {
+			return nil, UnknownTenantError{Tenant: "initech"}
+		},
+		RequestBuilders{},
+		kithttp.ServerErrorEncoder(NewSignedErrorEncoder(f.(DetachedSigner))),
+	)
+
+	require.NoError(err)
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+
+	assert.Equal(http.StatusBadRequest, response.Code)
+	assert.Equal(ContentTypeProblemJSON, response.Header().Get("Content-Type"))
+
+	var problem Problem
+	require.NoError(json.Unmarshal(response.Body.Bytes(), &problem))
+	assert.Equal(http.StatusBadRequest, problem.Status)
+
+	parts := strings.Split(response.Header().Get(SignatureHeader), ".")
+	require.Len(parts, 3)
+	assert.Empty(parts[1])
+
+	h, err := jwt.DecodeSegment(parts[0])
+	require.NoError(err)
+
+	var header map[string]interface{}
+	require.NoError(json.Unmarshal(h, &header))
+	assert.Equal(alg, header["alg"])
+	assert.Equal(d.Kid, header["kid"])
+
+	signingString := parts[0] + "." + jwt.EncodeSegment(response.Body.Bytes())
+	method := jwt.GetSigningMethod(alg)
+	assert.NoError(method.Verify(signingString, parts[2], publishedKey(t, registry, d.Kid)))
+	assert.Error(method.Verify(parts[0]+"."+jwt.EncodeSegment([]byte(`{"status":200}`)), parts[2], publishedKey(t, registry, d.Kid)))
+}
+
+func TestNewSignedErrorEncoder(t *testing.T) {
+	t.Run("RS256", func(t *testing.T) {
+		testNewSignedErrorEncoder(t, "RS256", key.Descriptor{Kid: "test", Bits: 512})
+	})
+
+	t.Run("ES256", func(t *testing.T) {
+		testNewSignedErrorEncoder(t, "ES256", key.Descriptor{Kid: "test", Type: key.KeyTypeECDSA, Bits: 256})
+	})
+}
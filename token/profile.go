@@ -0,0 +1,107 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+const (
+	// ProfileRFC9068 is the Profile that enforces the RFC 9068 JWT profile for OAuth 2.0 access tokens
+	ProfileRFC9068 = "rfc9068"
+
+	// AccessTokenType is the typ header of tokens issued under ProfileRFC9068
+	AccessTokenType = "at+jwt"
+)
+
+var (
+	ErrProfileRequiresNoncer = errors.New("The RFC 9068 profile requires a noncer for the jti claim")
+)
+
+// AccessTokenProfileClaims are the claims that every RFC 9068 access token must have
+var AccessTokenProfileClaims = []string{"iss", "exp", "aud", "sub", "client_id", "iat", "jti"}
+
+// InvalidProfileError indicates that a token profile is unknown, or that the rest of the configuration
+// cannot satisfy it
+type InvalidProfileError struct {
+	Profile string
+	Reason  string
+}
+
+func (ipe InvalidProfileError) Error() string {
+	return fmt.Sprintf("Invalid token profile %s: %s", ipe.Profile, ipe.Reason)
+}
+
+// MissingProfileClaimError is returned when a token request does not resolve a claim that the configured
+// profile requires, so the token is not issued
+type MissingProfileClaimError struct {
+	Profile string
+	Claim   string
+}
+
+func (mpce MissingProfileClaimError) Error() string {
+	return fmt.Sprintf("Token profile %s requires the %s claim", mpce.Profile, mpce.Claim)
+}
+
+func (mpce MissingProfileClaimError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// tokenProfile is the validated form of a configured profile
+type tokenProfile struct {
+	name     string
+	typ      string
+	required []string
+}
+
+// newTokenProfile validates the configured Profile against the rest of the Options.  If no profile is
+// configured, this function returns nil.
+func newTokenProfile(o Options) (*tokenProfile, error) {
+	switch o.Profile {
+	case "":
+		return nil, nil
+
+	case ProfileRFC9068:
+		if o.DisableTime {
+			return nil, InvalidProfileError{Profile: o.Profile, Reason: "time claims cannot be disabled"}
+		} else if o.Duration <= 0 {
+			return nil, InvalidProfileError{Profile: o.Profile, Reason: "a duration is required for the exp claim"}
+		}
+
+		return &tokenProfile{
+			name:     o.Profile,
+			typ:      AccessTokenType,
+			required: AccessTokenProfileClaims,
+		}, nil
+
+	default:
+		return nil, InvalidProfileError{Profile: o.Profile, Reason: "unknown profile"}
+	}
+}
+
+// resolved tests if a claim value is present and not empty
+func resolved(v interface{}) bool {
+	switch t := v.(type) {
+	case nil:
+		return false
+	case string:
+		return len(t) > 0
+	case []interface{}:
+		return len(t) > 0
+	case []string:
+		return len(t) > 0
+	default:
+		return true
+	}
+}
+
+// check verifies that the merged claims of a token include every claim this profile requires
+func (tp *tokenProfile) check(claims map[string]interface{}) error {
+	for _, name := range tp.required {
+		if !resolved(claims[name]) {
+			return MissingProfileClaimError{Profile: tp.name, Claim: name}
+		}
+	}
+
+	return nil
+}
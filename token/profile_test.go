@@ -0,0 +1,102 @@
+package token
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/xmidt-org/themis/key"
+	"github.com/xmidt-org/themis/random"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestProfileFactory(t *testing.T) Factory {
+	o := Options{
+		Key:      key.Descriptor{Kid: "profile", Bits: 512},
+		Profile:  ProfileRFC9068,
+		Duration: 5 * time.Minute,
+		Claims: map[string]Value{
+			"iss": Value{Value: "https://themis.example.com"},
+			"aud": Value{Value: []interface{}{"https://api.example.com"}},
+		},
+	}
+
+	cb, err := NewClaimBuilders(random.NewBase64Noncer(rand.Reader, 16, base64.RawURLEncoding), nil, o)
+	require.NoError(t, err)
+
+	f, err := NewFactory(o, cb, key.NewRegistry(nil))
+	require.NoError(t, err)
+	return f
+}
+
+func testProfileCompliant(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		f       = newTestProfileFactory(t)
+		r       = NewRequest()
+	)
+
+	r.Claims["sub"] = "device-123"
+	r.Claims["client_id"] = "gateway"
+	signed, err := f.NewToken(context.Background(), r)
+	require.NoError(err)
+
+	header, claims, err := decodeUnverified(signed)
+	require.NoError(err)
+	assert.Equal(AccessTokenType, header["typ"])
+	for _, name := range AccessTokenProfileClaims {
+		assert.Contains(claims, name)
+	}
+
+	assert.NotEmpty(claims["jti"])
+	assert.Equal("gateway", claims["client_id"])
+}
+
+func testProfileMissingClientID(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		f      = newTestProfileFactory(t)
+		r      = NewRequest()
+	)
+
+	r.Claims["sub"] = "device-123"
+	signed, err := f.NewToken(context.Background(), r)
+	assert.Empty(signed)
+	assert.Equal(MissingProfileClaimError{Profile: ProfileRFC9068, Claim: "client_id"}, err)
+	assert.Equal(http.StatusBadRequest, err.(MissingProfileClaimError).StatusCode())
+}
+
+func testProfileInvalidConfiguration(t *testing.T) {
+	testData := map[string]Options{
+		"Unknown":     Options{Profile: "rfc0000", Duration: time.Minute},
+		"NoDuration":  Options{Profile: ProfileRFC9068},
+		"DisableTime": Options{Profile: ProfileRFC9068, Duration: time.Minute, DisableTime: true},
+	}
+
+	for name, o := range testData {
+		t.Run(name, func(t *testing.T) {
+			o.Key = key.Descriptor{Kid: "profile", Bits: 512}
+			f, err := NewFactory(o, ClaimBuilders{}, key.NewRegistry(nil))
+			assert.Nil(t, f)
+			assert.IsType(t, InvalidProfileError{}, err)
+		})
+	}
+
+	t.Run("NoNoncer", func(t *testing.T) {
+		cb, err := NewClaimBuilders(nil, nil, Options{Profile: ProfileRFC9068, Duration: time.Minute})
+		assert.Nil(t, cb)
+		assert.Equal(t, ErrProfileRequiresNoncer, err)
+	})
+}
+
+func TestProfile(t *testing.T) {
+	t.Run("Compliant", testProfileCompliant)
+	t.Run("MissingClientID", testProfileMissingClientID)
+	t.Run("InvalidConfiguration", testProfileInvalidConfiguration)
+}
@@ -0,0 +1,234 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/xmidt-org/themis/clock"
+)
+
+// DefaultQuotaClaim is the claim whose value is counted against a quota when none is configured
+const DefaultQuotaClaim = "sub"
+
+var (
+	ErrInvalidQuotaLimit  = errors.New("A quota must have a positive limit")
+	ErrInvalidQuotaWindow = errors.New("A quota must have a positive window")
+)
+
+// QuotaExceededError is returned when the claim value of a token request has been issued its quota of
+// tokens for the current window
+type QuotaExceededError struct {
+	Claim string
+	Value string
+	Limit int
+	Reset time.Time
+
+	// RetryAfter is the time remaining until Reset, when the error was returned
+	RetryAfter time.Duration
+}
+
+func (qee QuotaExceededError) Error() string {
+	return fmt.Sprintf("The quota of %d tokens for %s %s is exhausted", qee.Limit, qee.Claim, qee.Value)
+}
+
+func (qee QuotaExceededError) StatusCode() int {
+	return http.StatusTooManyRequests
+}
+
+// Headers supplies the Retry-After header, in whole seconds
+func (qee QuotaExceededError) Headers() http.Header {
+	return http.Header{
+		"Retry-After": {strconv.Itoa(int(math.Ceil(qee.RetryAfter.Seconds())))},
+	}
+}
+
+// QuotaStore counts the tokens issued for each claim value within a window
+type QuotaStore interface {
+	// Take counts one token against a key, unless the key has already been issued limit tokens in its
+	// current window.  The returned time is when the key's current window ends.  A window begins with the
+	// first token taken after the previous window ended.  Implementations must be safe for concurrent use,
+	// and checking and counting a token must be atomic.
+	Take(key string, limit int, window time.Duration) (bool, time.Time, error)
+}
+
+// QuotaRefunder is optionally implemented by a QuotaStore that can give back a token taken for a request that
+// was then not issued a token, e.g. because signing failed.  Without it, such requests still count against the quota.
+type QuotaRefunder interface {
+	// Refund uncounts one token from a key's current window, if that window has not ended
+	Refund(key string) error
+}
+
+type quotaWindow struct {
+	count int
+	reset time.Time
+}
+
+// memoryQuotaStore is the in-memory QuotaStore
+type memoryQuotaStore struct {
+	lock      sync.Mutex
+	now       func() time.Time
+	windows   map[string]*quotaWindow
+	lastPrune time.Time
+}
+
+// NewMemoryQuotaStore creates a QuotaStore that keeps its counts in memory, timing windows with the given Clock.
+// If c is nil, the system time is used.  Counts are not shared across processes.
+func NewMemoryQuotaStore(c clock.Clock) QuotaStore {
+	return newMemoryQuotaStore(clock.NowFunc(c))
+}
+
+func newMemoryQuotaStore(now func() time.Time) *memoryQuotaStore {
+	return &memoryQuotaStore{
+		now:     now,
+		windows: make(map[string]*quotaWindow),
+	}
+}
+
+// prune removes ended windows.  To bound the cost, this is done at most once per window.
+func (m *memoryQuotaStore) prune(now time.Time, window time.Duration) {
+	if now.Sub(m.lastPrune) < window {
+		return
+	}
+
+	for key, w := range m.windows {
+		if !now.Before(w.reset) {
+			delete(m.windows, key)
+		}
+	}
+
+	m.lastPrune = now
+}
+
+func (m *memoryQuotaStore) Take(key string, limit int, window time.Duration) (bool, time.Time, error) {
+	now := m.now()
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.prune(now, window)
+	w, ok := m.windows[key]
+	if !ok || !now.Before(w.reset) {
+		w = &quotaWindow{reset: now.Add(window)}
+		m.windows[key] = w
+	}
+
+	if w.count >= limit {
+		return false, w.reset, nil
+	}
+
+	w.count++
+	return true, w.reset, nil
+}
+
+func (m *memoryQuotaStore) Refund(key string) error {
+	now := m.now()
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if w, ok := m.windows[key]; ok && now.Before(w.reset) && w.count > 0 {
+		w.count--
+	}
+
+	return nil
+}
+
+// Quota describes a hard cap on the number of tokens issued per value of a claim within each window, e.g. 1000
+// tokens per subject per day.  Unlike RateLimit, which smooths bursts, a quota does not refill gradually: once a
+// value has been issued Limit tokens, its requests are rejected until the window ends.  The quota applies after
+// all claims have been merged, so the claim may come from any source.  Token requests without the claim are not
+// counted.
+type Quota struct {
+	// Claim is the name of the claim whose value is counted.  If unset, DefaultQuotaClaim is used.
+	Claim string
+
+	// Limit is the number of tokens each claim value may be issued per window
+	Limit int
+
+	// Window is the length of each quota window
+	Window time.Duration
+}
+
+// quotaGuard enforces a Quota against a QuotaStore
+type quotaGuard struct {
+	claim  string
+	limit  int
+	window time.Duration
+	store  QuotaStore
+	now    func() time.Time
+}
+
+// newQuotaGuard validates a Quota.  If store is nil, an in-memory store is used.
+func newQuotaGuard(q Quota, store QuotaStore, now func() time.Time) (*quotaGuard, error) {
+	if q.Limit <= 0 {
+		return nil, ErrInvalidQuotaLimit
+	}
+
+	if q.Window <= 0 {
+		return nil, ErrInvalidQuotaWindow
+	}
+
+	qg := &quotaGuard{
+		claim:  q.Claim,
+		limit:  q.Limit,
+		window: q.Window,
+		store:  store,
+		now:    now,
+	}
+
+	if len(qg.claim) == 0 {
+		qg.claim = DefaultQuotaClaim
+	}
+
+	if qg.store == nil {
+		qg.store = newMemoryQuotaStore(now)
+	}
+
+	return qg, nil
+}
+
+// take counts a token against the claim value in the given claims
+func (qg *quotaGuard) take(claims map[string]interface{}) error {
+	value, ok := claims[qg.claim]
+	if !ok || value == nil {
+		return nil
+	}
+
+	key := fmt.Sprint(value)
+	ok, reset, err := qg.store.Take(key, qg.limit, qg.window)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return QuotaExceededError{
+			Claim:      qg.claim,
+			Value:      key,
+			Limit:      qg.limit,
+			Reset:      reset,
+			RetryAfter: reset.Sub(qg.now()),
+		}
+	}
+
+	return nil
+}
+
+// refund gives back the token counted by take for a request that was then not issued a token, if the store
+// supports refunds
+func (qg *quotaGuard) refund(claims map[string]interface{}) error {
+	value, ok := claims[qg.claim]
+	if !ok || value == nil {
+		return nil
+	}
+
+	if r, ok := qg.store.(QuotaRefunder); ok {
+		return r.Refund(fmt.Sprint(value))
+	}
+
+	return nil
+}
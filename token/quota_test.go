@@ -0,0 +1,286 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/xmidt-org/themis/clock/clocktest"
+	"github.com/xmidt-org/themis/key"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func subject(sub string) map[string]interface{} {
+	return map[string]interface{}{"sub": sub}
+}
+
+func newTestQuotaGuard(t *testing.T, q Quota) (*quotaGuard, *testClock) {
+	clock := &testClock{current: time.Date(2020, 10, 14, 12, 0, 0, 0, time.UTC)}
+	qg, err := newQuotaGuard(q, nil, clock.now)
+	require.NoError(t, err)
+	return qg, clock
+}
+
+func testQuotaUnderLimit(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		qg, _  = newTestQuotaGuard(t, Quota{Limit: 3, Window: time.Hour})
+	)
+
+	assert.NoError(qg.take(subject("a")))
+	assert.NoError(qg.take(subject("a")))
+	assert.NoError(qg.take(subject("a")))
+
+	// another subject has its own quota
+	assert.NoError(qg.take(subject("b")))
+
+	// requests without the claim are not counted
+	for i := 0; i < 5; i++ {
+		assert.NoError(qg.take(map[string]interface{}{}))
+	}
+}
+
+func testQuotaExceeded(t *testing.T) {
+	var (
+		assert    = assert.New(t)
+		require   = require.New(t)
+		qg, clock = newTestQuotaGuard(t, Quota{Limit: 2, Window: time.Hour})
+		start     = clock.current
+	)
+
+	require.NoError(qg.take(subject("a")))
+	clock.current = clock.current.Add(10 * time.Minute)
+	require.NoError(qg.take(subject("a")))
+
+	clock.current = clock.current.Add(20 * time.Minute)
+	err := qg.take(subject("a"))
+	require.Error(err)
+	assert.Equal(
+		QuotaExceededError{
+			Claim:      "sub",
+			Value:      "a",
+			Limit:      2,
+			Reset:      start.Add(time.Hour),
+			RetryAfter: 30 * time.Minute,
+		},
+		err,
+	)
+
+	assert.Equal(http.StatusTooManyRequests, err.(QuotaExceededError).StatusCode())
+	assert.Equal("1800", err.(QuotaExceededError).Headers().Get("Retry-After"))
+	assert.NotEmpty(err.Error())
+
+	// rejected requests are not counted, and the quota holds until the window ends
+	clock.current = start.Add(time.Hour - time.Second)
+	assert.Error(qg.take(subject("a")))
+}
+
+func testQuotaReset(t *testing.T) {
+	var (
+		assert    = assert.New(t)
+		qg, clock = newTestQuotaGuard(t, Quota{Claim: "device", Limit: 1, Window: time.Hour})
+		start     = clock.current
+	)
+
+	assert.NoError(qg.take(device("a")))
+	assert.Error(qg.take(device("a")))
+
+	// the quota resets exactly on the window boundary
+	clock.current = start.Add(time.Hour)
+	assert.NoError(qg.take(device("a")))
+	assert.Error(qg.take(device("a")))
+
+	// and the new window began with that request
+	clock.current = start.Add(2*time.Hour - time.Nanosecond)
+	assert.Error(qg.take(device("a")))
+	clock.current = start.Add(2 * time.Hour)
+	assert.NoError(qg.take(device("a")))
+}
+
+func testQuotaPrune(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		clock  = &testClock{current: time.Date(2020, 10, 14, 12, 0, 0, 0, time.UTC)}
+		m      = newMemoryQuotaStore(clock.now)
+	)
+
+	for _, key := range []string{"a", "b", "c"} {
+		ok, _, err := m.Take(key, 1, time.Minute)
+		assert.True(ok)
+		assert.NoError(err)
+	}
+
+	clock.current = clock.current.Add(time.Minute)
+	ok, _, err := m.Take("d", 1, time.Minute)
+	assert.True(ok)
+	assert.NoError(err)
+	assert.Len(m.windows, 1)
+}
+
+func testQuotaRefund(t *testing.T) {
+	var (
+		assert    = assert.New(t)
+		qg, clock = newTestQuotaGuard(t, Quota{Limit: 1, Window: time.Hour})
+	)
+
+	assert.NoError(qg.take(subject("a")))
+	assert.Error(qg.take(subject("a")))
+
+	assert.NoError(qg.refund(subject("a")))
+	assert.NoError(qg.take(subject("a")))
+
+	// a refund never takes a count below zero, and refunds after the window ended are ignored
+	clock.current = clock.current.Add(time.Hour)
+	assert.NoError(qg.refund(subject("a")))
+	assert.NoError(qg.refund(subject("unknown")))
+	assert.NoError(qg.refund(map[string]interface{}{}))
+	assert.NoError(qg.take(subject("a")))
+	assert.Error(qg.take(subject("a")))
+
+	// stores that cannot refund are left alone
+	qg.store = errorQuotaStore{err: errors.New("unexpected")}
+	assert.NoError(qg.refund(subject("a")))
+}
+
+func testQuotaStoreClock(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		now    = clocktest.NewFake(time.Date(2020, 10, 14, 12, 0, 0, 0, time.UTC))
+		store  = NewMemoryQuotaStore(now)
+	)
+
+	ok, reset, err := store.Take("a", 1, time.Hour)
+	assert.True(ok)
+	assert.NoError(err)
+	assert.Equal(now.Now().Add(time.Hour), reset)
+
+	now.Add(time.Hour)
+	ok, _, err = store.Take("a", 1, time.Hour)
+	assert.True(ok, "the window should have ended by the supplied clock")
+	assert.NoError(err)
+}
+
+type errorQuotaStore struct {
+	err error
+}
+
+func (eqs errorQuotaStore) Take(string, int, time.Duration) (bool, time.Time, error) {
+	return false, time.Time{}, eqs.err
+}
+
+func testQuotaStoreError(t *testing.T) {
+	var (
+		assert      = assert.New(t)
+		expectedErr = errors.New("expected")
+		qg, err     = newQuotaGuard(Quota{Limit: 1, Window: time.Hour}, errorQuotaStore{err: expectedErr}, time.Now)
+	)
+
+	require.NoError(t, err)
+	assert.Equal(expectedErr, qg.take(subject("a")))
+}
+
+func testQuotaInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	qg, err := newQuotaGuard(Quota{Window: time.Hour}, nil, time.Now)
+	assert.Nil(qg)
+	assert.Equal(ErrInvalidQuotaLimit, err)
+
+	qg, err = newQuotaGuard(Quota{Limit: 1}, nil, time.Now)
+	assert.Nil(qg)
+	assert.Equal(ErrInvalidQuotaWindow, err)
+}
+
+func testQuotaFactory(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	factory, err := NewFactory(
+		Options{
+			Key:   key.Descriptor{Kid: "test", Bits: 512},
+			Quota: &Quota{Limit: 1, Window: 24 * time.Hour},
+		},
+		ClaimBuilders{requestClaimBuilder{}},
+		key.NewRegistry(nil),
+	)
+
+	require.NoError(err)
+	issue := func(sub string) (string, error) {
+		r := NewRequest()
+		r.Claims["sub"] = sub
+		return factory.NewToken(context.Background(), r)
+	}
+
+	signed, err := issue("greedy")
+	require.NoError(err)
+	assert.NotEmpty(signed)
+
+	signed, err = issue("greedy")
+	assert.Empty(signed)
+	require.IsType(QuotaExceededError{}, err)
+	assert.Equal(http.StatusTooManyRequests, err.(QuotaExceededError).StatusCode())
+
+	signed, err = issue("modest")
+	assert.NoError(err)
+	assert.NotEmpty(signed)
+}
+
+func testQuotaFactorySignError(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		registry = key.NewRegistry(nil)
+	)
+
+	tf, err := NewFactory(
+		Options{
+			Key:   key.Descriptor{Kid: "test", Bits: 512},
+			Quota: &Quota{Limit: 1, Window: 24 * time.Hour},
+		},
+		ClaimBuilders{requestClaimBuilder{}},
+		registry,
+	)
+
+	require.NoError(err)
+	active, ok := registry.Active()
+	require.True(ok)
+
+	var (
+		f      = tf.(*factory)
+		method = f.method
+		r      = NewRequest()
+	)
+
+	r.Claims["sub"] = "unlucky"
+	f.method = unavailableMethod{SigningMethod: method, unavailable: active.Sign()}
+	_, err = tf.NewToken(context.Background(), r)
+	require.Error(err)
+
+	// the failed request did not use up the quota
+	f.method = method
+	signed, err := tf.NewToken(context.Background(), r)
+	assert.NoError(err)
+	assert.NotEmpty(signed)
+
+	_, err = tf.NewToken(context.Background(), r)
+	assert.IsType(QuotaExceededError{}, err)
+}
+
+func TestQuota(t *testing.T) {
+	t.Run("UnderLimit", testQuotaUnderLimit)
+	t.Run("Exceeded", testQuotaExceeded)
+	t.Run("Reset", testQuotaReset)
+	t.Run("Prune", testQuotaPrune)
+	t.Run("Refund", testQuotaRefund)
+	t.Run("StoreClock", testQuotaStoreClock)
+	t.Run("StoreError", testQuotaStoreError)
+	t.Run("Invalid", testQuotaInvalid)
+	t.Run("Factory", testQuotaFactory)
+	t.Run("FactorySignError", testQuotaFactorySignError)
+}
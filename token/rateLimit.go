@@ -0,0 +1,179 @@
+package token
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultRateLimitMaxKeys is the number of claim values whose buckets are retained when none is configured
+const DefaultRateLimitMaxKeys = 10000
+
+var (
+	ErrRateLimitClaimRequired = errors.New("A rate limit claim is required")
+	ErrInvalidRate            = errors.New("A rate limit must have a positive rate")
+)
+
+// RateLimitedError is returned when the claim value of a token request has exhausted its bucket
+type RateLimitedError struct {
+	Claim      string
+	Value      string
+	RetryAfter time.Duration
+}
+
+func (rle RateLimitedError) Error() string {
+	return fmt.Sprintf("Too many token requests for %s %s", rle.Claim, rle.Value)
+}
+
+func (rle RateLimitedError) StatusCode() int {
+	return http.StatusTooManyRequests
+}
+
+// Headers supplies the Retry-After header, in whole seconds
+func (rle RateLimitedError) Headers() http.Header {
+	return http.Header{
+		"Retry-After": {strconv.Itoa(int(math.Ceil(rle.RetryAfter.Seconds())))},
+	}
+}
+
+// RateLimit describes how token issuance is limited per value of a claim, e.g. per device id, so that a
+// single client cannot flood the issuer.  Each distinct value has its own token bucket.  The limit applies
+// after all claims have been merged, so the claim may come from any source.  Token requests without the
+// claim are not limited.
+type RateLimit struct {
+	// Claim is the name of the claim whose value selects a bucket
+	Claim string
+
+	// Rate is the number of tokens per second that each claim value may be issued, on average
+	Rate float64
+
+	// Burst is the number of tokens a claim value may be issued at once.  If unset, the Rate rounded up is used.
+	Burst int
+
+	// MaxKeys bounds the number of buckets held in memory.  When a new claim value arrives and this
+	// many buckets already exist, the least recently used bucket is discarded.  If unset,
+	// DefaultRateLimitMaxKeys is used.
+	MaxKeys int
+}
+
+type bucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter is a set of token buckets, keyed by claim value, bounded by an LRU
+type rateLimiter struct {
+	claim   string
+	rate    float64
+	burst   float64
+	maxKeys int
+	now     func() time.Time
+
+	lock    sync.Mutex
+	buckets map[string]*list.Element
+	lru     *list.List
+}
+
+func newRateLimiter(rl RateLimit, now func() time.Time) (*rateLimiter, error) {
+	if len(rl.Claim) == 0 {
+		return nil, ErrRateLimitClaimRequired
+	}
+
+	if rl.Rate <= 0 {
+		return nil, ErrInvalidRate
+	}
+
+	r := &rateLimiter{
+		claim:   rl.Claim,
+		rate:    rl.Rate,
+		burst:   float64(rl.Burst),
+		maxKeys: rl.MaxKeys,
+		now:     now,
+		buckets: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+
+	if r.burst <= 0 {
+		r.burst = math.Ceil(r.rate)
+	}
+
+	if r.maxKeys <= 0 {
+		r.maxKeys = DefaultRateLimitMaxKeys
+	}
+
+	return r, nil
+}
+
+// get returns the bucket for a key, creating a full bucket and evicting the least recently used one as necessary
+func (r *rateLimiter) get(key string, now time.Time) *bucket {
+	if e, ok := r.buckets[key]; ok {
+		r.lru.MoveToFront(e)
+		return e.Value.(*bucket)
+	}
+
+	if r.lru.Len() >= r.maxKeys {
+		oldest := r.lru.Back()
+		r.lru.Remove(oldest)
+		delete(r.buckets, oldest.Value.(*bucket).key)
+	}
+
+	b := &bucket{key: key, tokens: r.burst, last: now}
+	r.buckets[key] = r.lru.PushFront(b)
+	return b
+}
+
+// allow takes a token from the bucket of the claim value in the given claims
+func (r *rateLimiter) allow(claims map[string]interface{}) error {
+	value, ok := claims[r.claim]
+	if !ok || value == nil {
+		return nil
+	}
+
+	var (
+		key = fmt.Sprint(value)
+		now = r.now()
+	)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	b := r.get(key, now)
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(r.burst, b.tokens+elapsed*r.rate)
+	}
+
+	b.last = now
+	if b.tokens < 1 {
+		return RateLimitedError{
+			Claim:      r.claim,
+			Value:      key,
+			RetryAfter: time.Duration((1 - b.tokens) / r.rate * float64(time.Second)),
+		}
+	}
+
+	b.tokens--
+	return nil
+}
+
+// refund returns the token taken by allow for a request that was then not issued a token, e.g. because signing
+// failed.  A bucket that has since been evicted is not recreated.
+func (r *rateLimiter) refund(claims map[string]interface{}) {
+	value, ok := claims[r.claim]
+	if !ok || value == nil {
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if e, ok := r.buckets[fmt.Sprint(value)]; ok {
+		b := e.Value.(*bucket)
+		b.tokens = math.Min(r.burst, b.tokens+1)
+	}
+}
@@ -0,0 +1,223 @@
+package token
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/xmidt-org/themis/key"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testClock struct {
+	current time.Time
+}
+
+func (tc *testClock) now() time.Time {
+	return tc.current
+}
+
+func newTestRateLimiter(t *testing.T, rl RateLimit) (*rateLimiter, *testClock) {
+	clock := &testClock{current: time.Date(2020, 10, 14, 12, 0, 0, 0, time.UTC)}
+	r, err := newRateLimiter(rl, clock.now)
+	require.NoError(t, err)
+	return r, clock
+}
+
+func device(id string) map[string]interface{} {
+	return map[string]interface{}{"device": id}
+}
+
+func testRateLimiterPerKey(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		r, _    = newTestRateLimiter(t, RateLimit{Claim: "device", Rate: 1, Burst: 2})
+	)
+
+	require.NoError(r.allow(device("a")))
+	require.NoError(r.allow(device("a")))
+
+	err := r.allow(device("a"))
+	require.Error(err)
+	assert.Equal(RateLimitedError{Claim: "device", Value: "a", RetryAfter: time.Second}, err)
+
+	// another device has its own bucket
+	assert.NoError(r.allow(device("b")))
+	assert.NoError(r.allow(device("b")))
+	assert.Error(r.allow(device("b")))
+
+	// requests without the claim are not limited
+	for i := 0; i < 5; i++ {
+		assert.NoError(r.allow(map[string]interface{}{}))
+	}
+}
+
+func testRateLimiterRefill(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		r, clock = newTestRateLimiter(t, RateLimit{Claim: "device", Rate: 2})
+	)
+
+	assert.NoError(r.allow(device("a")))
+	assert.NoError(r.allow(device("a")))
+
+	err := r.allow(device("a"))
+	assert.Equal(500*time.Millisecond, err.(RateLimitedError).RetryAfter)
+
+	clock.current = clock.current.Add(500 * time.Millisecond)
+	assert.NoError(r.allow(device("a")))
+	assert.Error(r.allow(device("a")))
+
+	// a long idle period never refills beyond the burst
+	clock.current = clock.current.Add(time.Hour)
+	assert.NoError(r.allow(device("a")))
+	assert.NoError(r.allow(device("a")))
+	assert.Error(r.allow(device("a")))
+}
+
+func testRateLimiterLRU(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		r, _   = newTestRateLimiter(t, RateLimit{Claim: "device", Rate: 1, MaxKeys: 2})
+	)
+
+	assert.NoError(r.allow(device("a")))
+	assert.NoError(r.allow(device("b")))
+	assert.Error(r.allow(device("a")))
+
+	// a is the most recently used, so c evicts b
+	assert.NoError(r.allow(device("c")))
+	assert.Equal(2, r.lru.Len())
+	assert.Len(r.buckets, 2)
+	assert.Error(r.allow(device("a")))
+
+	// b was forgotten, so it starts with a full bucket ...
+	assert.NoError(r.allow(device("b")))
+
+	// ... which evicted c
+	assert.NotContains(r.buckets, "c")
+}
+
+func testRateLimiterInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	r, err := newRateLimiter(RateLimit{Rate: 1}, time.Now)
+	assert.Nil(r)
+	assert.Equal(ErrRateLimitClaimRequired, err)
+
+	r, err = newRateLimiter(RateLimit{Claim: "device"}, time.Now)
+	assert.Nil(r)
+	assert.Equal(ErrInvalidRate, err)
+}
+
+func testRateLimitFactory(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	factory, err := NewFactory(
+		Options{
+			Key:       key.Descriptor{Kid: "test", Bits: 512},
+			RateLimit: &RateLimit{Claim: "device", Rate: 0.5},
+		},
+		ClaimBuilders{requestClaimBuilder{}},
+		key.NewRegistry(nil),
+	)
+
+	require.NoError(err)
+	issue := func(id string) (string, error) {
+		r := NewRequest()
+		r.Claims["device"] = id
+		return factory.NewToken(context.Background(), r)
+	}
+
+	signed, err := issue("flooder")
+	require.NoError(err)
+	assert.NotEmpty(signed)
+
+	signed, err = issue("flooder")
+	assert.Empty(signed)
+	require.IsType(RateLimitedError{}, err)
+	assert.Equal(http.StatusTooManyRequests, err.(RateLimitedError).StatusCode())
+	assert.Equal("2", err.(RateLimitedError).Headers().Get("Retry-After"))
+
+	signed, err = issue("quiet")
+	assert.NoError(err)
+	assert.NotEmpty(signed)
+}
+
+func testRateLimiterRefund(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		r, _    = newTestRateLimiter(t, RateLimit{Claim: "device", Rate: 1, Burst: 1})
+	)
+
+	require.NoError(r.allow(device("a")))
+	require.Error(r.allow(device("a")))
+
+	r.refund(device("a"))
+	assert.NoError(r.allow(device("a")))
+
+	// a refund never overfills a bucket, and unknown or missing values are ignored
+	r.refund(device("a"))
+	r.refund(device("a"))
+	r.refund(device("unknown"))
+	r.refund(map[string]interface{}{})
+	assert.NoError(r.allow(device("a")))
+	assert.Error(r.allow(device("a")))
+	assert.Len(r.buckets, 1)
+}
+
+func testRateLimitFactorySignError(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		registry = key.NewRegistry(nil)
+	)
+
+	tf, err := NewFactory(
+		Options{
+			Key:       key.Descriptor{Kid: "test", Bits: 512},
+			RateLimit: &RateLimit{Claim: "device", Rate: 0.5},
+		},
+		ClaimBuilders{requestClaimBuilder{}},
+		registry,
+	)
+
+	require.NoError(err)
+	active, ok := registry.Active()
+	require.True(ok)
+
+	var (
+		f      = tf.(*factory)
+		method = f.method
+		r      = NewRequest()
+	)
+
+	r.Claims["device"] = "unlucky"
+	f.method = unavailableMethod{SigningMethod: method, unavailable: active.Sign()}
+	_, err = tf.NewToken(context.Background(), r)
+	require.Error(err)
+
+	// the failed request did not use up the only token
+	f.method = method
+	signed, err := tf.NewToken(context.Background(), r)
+	assert.NoError(err)
+	assert.NotEmpty(signed)
+}
+
+func TestRateLimit(t *testing.T) {
+	t.Run("PerKey", testRateLimiterPerKey)
+	t.Run("Refill", testRateLimiterRefill)
+	t.Run("LRU", testRateLimiterLRU)
+	t.Run("Invalid", testRateLimiterInvalid)
+	t.Run("Refund", testRateLimiterRefund)
+	t.Run("Factory", testRateLimitFactory)
+	t.Run("FactorySignError", testRateLimitFactorySignError)
+}
@@ -0,0 +1,45 @@
+package token
+
+// Redacted is the value logged in place of a redacted claim
+const Redacted = "***"
+
+// Redactor masks the values of sensitive claims before claims are logged.  The names of redacted
+// claims still appear, so logs continue to show which claims were present.
+type Redactor map[string]bool
+
+// NewRedactor creates a Redactor for the given claim names.  If no names are supplied, the returned
+// Redactor leaves every claim as is.
+func NewRedactor(names []string) Redactor {
+	r := make(Redactor, len(names))
+	for _, n := range names {
+		r[n] = true
+	}
+
+	return r
+}
+
+// Claims returns a copy of the given claims with each redacted claim's value replaced by Redacted.
+// The original claims are never modified.
+func (r Redactor) Claims(claims map[string]interface{}) map[string]interface{} {
+	redacted := make(map[string]interface{}, len(claims))
+	for k, v := range claims {
+		if r[k] {
+			redacted[k] = Redacted
+		} else {
+			redacted[k] = v
+		}
+	}
+
+	return redacted
+}
+
+// LogValue produces the representation of claims used in log output.  This is the canonical JSON
+// form of the redacted claims, which works with both the logfmt and JSON loggers.
+func (r Redactor) LogValue(claims map[string]interface{}) string {
+	data, err := CanonicalJSON(r.Claims(claims))
+	if err != nil {
+		return err.Error()
+	}
+
+	return string(data)
+}
@@ -0,0 +1,98 @@
+package token
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/xmidt-org/themis/key"
+	"github.com/xmidt-org/themis/xlog"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testRedactorClaims(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		redactor = NewRedactor([]string{"password", "missing"})
+		claims   = map[string]interface{}{"password": "s3cr3t", "sub": "test"}
+	)
+
+	assert.Equal(
+		map[string]interface{}{"password": Redacted, "sub": "test"},
+		redactor.Claims(claims),
+	)
+
+	// the original claims must be untouched
+	assert.Equal("s3cr3t", claims["password"])
+	assert.Equal(`{"password":"***","sub":"test"}`, redactor.LogValue(claims))
+}
+
+func testRedactorEmpty(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		claims = map[string]interface{}{"password": "s3cr3t"}
+	)
+
+	assert.Equal(claims, NewRedactor(nil).Claims(claims))
+}
+
+func testRedactorFactory(t *testing.T, json bool) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		output bytes.Buffer
+		logger = log.NewLogfmtLogger(&output)
+	)
+
+	if json {
+		logger = log.NewJSONLogger(&output)
+	}
+
+	f, err := NewFactory(
+		Options{
+			Key:          key.Descriptor{Kid: "test", Bits: 512},
+			RedactClaims: []string{"serial", "mac"},
+		},
+		ClaimBuilders{requestClaimBuilder{}},
+		key.NewRegistry(nil),
+	)
+
+	require.NoError(err)
+	signed, err := f.NewToken(
+		xlog.With(context.Background(), logger),
+		&Request{
+			Claims: map[string]interface{}{
+				"serial": "SN-0123456789",
+				"mac":    "112233445566",
+				"sub":    "device",
+			},
+			Metadata: map[string]interface{}{},
+		},
+	)
+
+	require.NoError(err)
+	require.NotEmpty(signed)
+
+	logged := output.String()
+	assert.Contains(logged, "issued token")
+	assert.Contains(logged, "serial")
+	assert.Contains(logged, "mac")
+	assert.Contains(logged, Redacted)
+	assert.Contains(logged, "device")
+	assert.NotContains(logged, "SN-0123456789")
+	assert.NotContains(logged, "112233445566")
+}
+
+func TestRedactor(t *testing.T) {
+	t.Run("Claims", testRedactorClaims)
+	t.Run("Empty", testRedactorEmpty)
+
+	t.Run("Factory", func(t *testing.T) {
+		t.Run("Logfmt", func(t *testing.T) { testRedactorFactory(t, false) })
+		t.Run("JSON", func(t *testing.T) { testRedactorFactory(t, true) })
+	})
+}
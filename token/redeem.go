@@ -0,0 +1,40 @@
+package token
+
+import (
+	"context"
+	"sync"
+)
+
+// redemption is the deferred use of a nonce that guards a token request.  Redemptions attached by nested
+// guards are chained through the request context.
+type redemption struct {
+	parent *redemption
+	use    func() error
+	once   sync.Once
+	err    error
+}
+
+type redemptionKey struct{}
+
+// withRedemption returns a context that carries the given deferred use of a nonce, in addition to any
+// that the parent context already carries
+func withRedemption(ctx context.Context, use func() error) context.Context {
+	parent, _ := ctx.Value(redemptionKey{}).(*redemption)
+	return context.WithValue(ctx, redemptionKey{}, &redemption{parent: parent, use: use})
+}
+
+// RedeemNonces uses the nonces that guards such as ChallengeGuard and ReplayGuard attached to a request's context.  Guards defer
+// this work so that a request rejected for any other reason does not use up its nonce.  The token factories call
+// this function just before signing, and each nonce is used at most once per request no matter how many tokens
+// the request issues.  Handlers other than the ones in this package must call it themselves before doing any
+// work the nonce guards.
+func RedeemNonces(ctx context.Context) error {
+	for r, _ := ctx.Value(redemptionKey{}).(*redemption); r != nil; r = r.parent {
+		r.once.Do(func() { r.err = r.use() })
+		if r.err != nil {
+			return r.err
+		}
+	}
+
+	return nil
+}
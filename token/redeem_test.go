@@ -0,0 +1,46 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedeemNonces(t *testing.T) {
+	t.Run("None", func(t *testing.T) {
+		assert.NoError(t, RedeemNonces(context.Background()))
+	})
+
+	t.Run("Once", func(t *testing.T) {
+		var (
+			assert = assert.New(t)
+
+			outer, inner int
+			ctx          = withRedemption(
+				withRedemption(context.Background(), func() error { outer++; return nil }),
+				func() error { inner++; return nil },
+			)
+		)
+
+		assert.NoError(RedeemNonces(ctx))
+		assert.NoError(RedeemNonces(ctx))
+		assert.Equal(1, outer)
+		assert.Equal(1, inner)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		var (
+			assert = assert.New(t)
+
+			expected = errors.New("expected")
+			calls    int
+			ctx      = withRedemption(context.Background(), func() error { calls++; return expected })
+		)
+
+		assert.Equal(expected, RedeemNonces(ctx))
+		assert.Equal(expected, RedeemNonces(ctx), "a failed redemption is not retried")
+		assert.Equal(1, calls)
+	})
+}
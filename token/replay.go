@@ -0,0 +1,182 @@
+package token
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/xmidt-org/themis/clock"
+	"github.com/xmidt-org/themis/xhttp/xhttpserver"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+// DefaultReplayTTL is how long a client nonce is remembered when no TTL is configured
+const DefaultReplayTTL time.Duration = 5 * time.Minute
+
+// ReplayError indicates that a token request reused a client nonce
+type ReplayError struct {
+	Nonce string
+}
+
+func (re ReplayError) Error() string {
+	return fmt.Sprintf("The nonce %s has already been used", re.Nonce)
+}
+
+func (re ReplayError) StatusCode() int {
+	return http.StatusConflict
+}
+
+// ReplayStore records client nonces so that replayed token requests can be detected
+type ReplayStore interface {
+	// Use records that a nonce has been used.  If the nonce was already used and has not yet
+	// expired, this method returns false.  Implementations must be safe for concurrent use, and
+	// checking and recording a nonce must be atomic.
+	Use(nonce string) (bool, error)
+}
+
+// memoryReplayStore is the in-memory ReplayStore
+type memoryReplayStore struct {
+	lock      sync.Mutex
+	ttl       time.Duration
+	now       func() time.Time
+	expires   map[string]time.Time
+	lastPrune time.Time
+}
+
+// NewMemoryReplayStore creates a ReplayStore that remembers each nonce, in memory, for the given TTL.
+// If ttl is nonpositive, DefaultReplayTTL is used.  Expiry is judged by the given Clock, or by the system time if
+// c is nil.  Nonces are not shared across processes.
+func NewMemoryReplayStore(ttl time.Duration, c clock.Clock) ReplayStore {
+	return newMemoryReplayStore(ttl, clock.NowFunc(c))
+}
+
+func newMemoryReplayStore(ttl time.Duration, now func() time.Time) *memoryReplayStore {
+	if ttl <= 0 {
+		ttl = DefaultReplayTTL
+	}
+
+	return &memoryReplayStore{
+		ttl:     ttl,
+		now:     now,
+		expires: make(map[string]time.Time),
+	}
+}
+
+// prune removes expired nonces.  To bound the cost, this is done at most once per TTL.
+func (m *memoryReplayStore) prune(now time.Time) {
+	if now.Sub(m.lastPrune) < m.ttl {
+		return
+	}
+
+	for nonce, expires := range m.expires {
+		if !now.Before(expires) {
+			delete(m.expires, nonce)
+		}
+	}
+
+	m.lastPrune = now
+}
+
+func (m *memoryReplayStore) Use(nonce string) (bool, error) {
+	now := m.now()
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.prune(now)
+	if expires, ok := m.expires[nonce]; ok && now.Before(expires) {
+		return false, nil
+	}
+
+	m.expires[nonce] = now.Add(m.ttl)
+	return true, nil
+}
+
+// Replay describes how to obtain a client nonce from a token request for replay protection
+type Replay struct {
+	// Header is the HTTP header containing the client nonce
+	Header string
+
+	// Parameter is the URL query parameter containing the client nonce.  The header takes precedence.
+	Parameter string
+
+	// Required indicates that requests without a client nonce are rejected.  By default, such
+	// requests are issued tokens without any replay check.
+	Required bool
+
+	// TTL is how long the in-memory store remembers each nonce.  If unset, DefaultReplayTTL is used.
+	// This field is ignored when a custom ReplayStore is supplied.
+	TTL time.Duration
+}
+
+// ReplayGuard is an Alice-style decorator that rejects token requests whose client nonce has already been used.
+// Requests missing a required nonce are rejected immediately, but the nonce itself is used when the decorated
+// handler calls RedeemNonces, so that a request rejected for any other reason does not use up its nonce.
+type ReplayGuard struct {
+	Replay
+
+	// Store is the required store of used nonces
+	Store ReplayStore
+
+	// ErrorEncoder writes any rejection.  If unset, kithttp.DefaultErrorEncoder is used.
+	ErrorEncoder kithttp.ErrorEncoder
+}
+
+func (rg ReplayGuard) nonce(request *http.Request) string {
+	var nonce string
+	if len(rg.Header) > 0 {
+		nonce = request.Header.Get(rg.Header)
+	}
+
+	if len(nonce) == 0 && len(rg.Parameter) > 0 {
+		nonce = request.URL.Query().Get(rg.Parameter)
+	}
+
+	return nonce
+}
+
+func (rg ReplayGuard) use(nonce string) error {
+	ok, err := rg.Store.Use(nonce)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return ReplayError{Nonce: nonce}
+	}
+
+	return nil
+}
+
+func (rg ReplayGuard) Then(next http.Handler) http.Handler {
+	encoder := rg.ErrorEncoder
+	if encoder == nil {
+		encoder = kithttp.DefaultErrorEncoder
+	}
+
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		nonce := rg.nonce(request)
+		if len(nonce) == 0 {
+			if rg.Required {
+				encoder(request.Context(), xhttpserver.MissingValueError{Header: rg.Header, Parameter: rg.Parameter}, response)
+				return
+			}
+
+			next.ServeHTTP(response, request)
+			return
+		}
+
+		next.ServeHTTP(
+			response,
+			request.WithContext(
+				withRedemption(request.Context(), func() error { return rg.use(nonce) }),
+			),
+		)
+	})
+}
+
+func (rg ReplayGuard) ThenFunc(next http.HandlerFunc) http.Handler {
+	return rg.Then(next)
+}
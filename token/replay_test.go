@@ -0,0 +1,185 @@
+package token
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/xmidt-org/themis/clock/clocktest"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type replayStoreFunc func(string) (bool, error)
+
+func (rsf replayStoreFunc) Use(nonce string) (bool, error) {
+	return rsf(nonce)
+}
+
+func testMemoryReplayStoreTTL(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		now   = clocktest.NewFake(time.Now())
+		store = NewMemoryReplayStore(time.Minute, now).(*memoryReplayStore)
+	)
+
+	ok, err := store.Use("first")
+	require.NoError(err)
+	assert.True(ok)
+
+	ok, err = store.Use("second")
+	require.NoError(err)
+	assert.True(ok)
+
+	now.Add(30 * time.Second)
+	ok, err = store.Use("first")
+	require.NoError(err)
+	assert.False(ok)
+
+	now.Add(30 * time.Second)
+	ok, err = store.Use("first")
+	require.NoError(err)
+	assert.True(ok, "a nonce should be usable again once it expires")
+	assert.Len(store.expires, 1, "expired nonces should have been pruned")
+}
+
+func testMemoryReplayStoreDefaultTTL(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(DefaultReplayTTL, NewMemoryReplayStore(0, nil).(*memoryReplayStore).ttl)
+}
+
+func TestMemoryReplayStore(t *testing.T) {
+	t.Run("TTL", testMemoryReplayStoreTTL)
+	t.Run("DefaultTTL", testMemoryReplayStoreDefaultTTL)
+}
+
+func serveReplayGuard(handler http.Handler, header, parameter string) *httptest.ResponseRecorder {
+	var (
+		response = httptest.NewRecorder()
+		request  = httptest.NewRequest("GET", "/issue", nil)
+	)
+
+	if len(header) > 0 {
+		request.Header.Set("X-Nonce", header)
+	}
+
+	if len(parameter) > 0 {
+		request.URL.RawQuery = "nonce=" + parameter
+	}
+
+	handler.ServeHTTP(response, request)
+	return response
+}
+
+// redeemNonces is a handler that, like the token factories, uses the request's nonces before succeeding
+func redeemNonces(response http.ResponseWriter, request *http.Request) {
+	if request.Header.Get("X-Invalid") == "true" {
+		response.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := RedeemNonces(request.Context()); err != nil {
+		kithttp.DefaultErrorEncoder(request.Context(), err, response)
+		return
+	}
+
+	response.WriteHeader(299)
+}
+
+func testReplayGuardDefault(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		handler = ReplayGuard{
+			Replay: Replay{Header: "X-Nonce", Parameter: "nonce"},
+			Store:  NewMemoryReplayStore(time.Minute, nil),
+		}.ThenFunc(redeemNonces)
+	)
+
+	assert.Equal(299, serveReplayGuard(handler, "abc", "").Code)
+
+	replayed := serveReplayGuard(handler, "abc", "")
+	assert.Equal(http.StatusConflict, replayed.Code)
+	assert.Contains(replayed.Body.String(), "abc")
+
+	// the same nonce sent as a parameter is still a replay
+	assert.Equal(http.StatusConflict, serveReplayGuard(handler, "", "abc").Code)
+	assert.Equal(299, serveReplayGuard(handler, "", "def").Code)
+
+	// without a nonce, there is nothing to check
+	assert.Equal(299, serveReplayGuard(handler, "", "").Code)
+	assert.Equal(299, serveReplayGuard(handler, "", "").Code)
+}
+
+func testReplayGuardRequired(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		handler = ReplayGuard{
+			Replay: Replay{Header: "X-Nonce", Required: true},
+			Store:  NewMemoryReplayStore(time.Minute, nil),
+		}.ThenFunc(redeemNonces)
+	)
+
+	assert.Equal(http.StatusBadRequest, serveReplayGuard(handler, "", "").Code)
+	assert.Equal(299, serveReplayGuard(handler, "abc", "").Code)
+	assert.Equal(http.StatusConflict, serveReplayGuard(handler, "abc", "").Code)
+}
+
+func testReplayGuardStoreError(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		handler = ReplayGuard{
+			Replay: Replay{Header: "X-Nonce"},
+			Store: replayStoreFunc(func(string) (bool, error) {
+				return false, errors.New("expected")
+			}),
+		}.ThenFunc(redeemNonces)
+	)
+
+	assert.Equal(http.StatusInternalServerError, serveReplayGuard(handler, "abc", "").Code)
+}
+
+func testReplayGuardInvalidRequest(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		handler = ReplayGuard{
+			Replay: Replay{Header: "X-Nonce"},
+			Store:  NewMemoryReplayStore(time.Minute, nil),
+		}.ThenFunc(redeemNonces)
+
+		invalid = httptest.NewRecorder()
+		request = httptest.NewRequest("GET", "/issue", nil)
+	)
+
+	// a request rejected for another reason does not use up its nonce
+	request.Header.Set("X-Nonce", "abc")
+	request.Header.Set("X-Invalid", "true")
+	handler.ServeHTTP(invalid, request)
+	assert.Equal(http.StatusBadRequest, invalid.Code)
+
+	assert.Equal(299, serveReplayGuard(handler, "abc", "").Code)
+	assert.Equal(http.StatusConflict, serveReplayGuard(handler, "abc", "").Code)
+}
+
+func TestReplayGuard(t *testing.T) {
+	t.Run("Default", testReplayGuardDefault)
+	t.Run("Required", testReplayGuardRequired)
+	t.Run("StoreError", testReplayGuardStoreError)
+	t.Run("InvalidRequest", testReplayGuardInvalidRequest)
+}
+
+func TestReplayError(t *testing.T) {
+	assert := assert.New(t)
+	err := ReplayError{Nonce: "abc"}
+	assert.Contains(err.Error(), "abc")
+	assert.Equal(http.StatusConflict, err.StatusCode())
+}
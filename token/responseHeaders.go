@@ -0,0 +1,109 @@
+package token
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+const (
+	// KidResponseHeader is the response header that mirrors the kid of an issued token
+	KidResponseHeader = "X-Themis-Kid"
+
+	// ExpiresResponseHeader is the response header that mirrors the exp claim of an issued token, in seconds since the epoch
+	ExpiresResponseHeader = "X-Themis-Expires"
+)
+
+var (
+	ErrMalformedToken = errors.New("A signed token must have exactly three segments")
+)
+
+// ResponseHeaders controls which metadata about an issued token is copied into response headers, for clients
+// that would rather not decode the token.  By default, no headers are written.
+type ResponseHeaders struct {
+	// Kid causes the token's kid header to be written as the KidResponseHeader
+	Kid bool
+
+	// Expires causes the token's exp claim to be written as the ExpiresResponseHeader.  Tokens without
+	// an exp claim, e.g. when DisableTime is set, have no such header.
+	Expires bool
+}
+
+// decodeUnverified returns the JOSE header and claims of a signed token that this server produced.  The signature is
+// not checked.  Compressed payloads are inflated, and numbers are decoded as json.Number so they are copied exactly.
+// For a token in the JWS general JSON serialization, the header is the first signature's protected header.
+func decodeUnverified(signed string) (map[string]interface{}, map[string]interface{}, error) {
+	segments := strings.Split(signed, ".")
+	if strings.HasPrefix(signed, "{") {
+		var g generalSerialization
+		if err := json.Unmarshal([]byte(signed), &g); err != nil || len(g.Signatures) == 0 {
+			return nil, nil, ErrMalformedToken
+		}
+
+		segments = []string{g.Signatures[0].Protected, g.Payload, g.Signatures[0].Signature}
+	}
+
+	if len(segments) != 3 {
+		return nil, nil, ErrMalformedToken
+	}
+
+	decode := func(segment string, inflate bool) (map[string]interface{}, error) {
+		data, err := jwt.DecodeSegment(segment)
+		if err == nil && inflate {
+			data, err = Inflate(data)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		var v map[string]interface{}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		err = decoder.Decode(&v)
+		return v, err
+	}
+
+	header, err := decode(segments[0], false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	claims, err := decode(segments[1], header[ZipHeader] == ZipDeflate)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return header, claims, nil
+}
+
+// decorate returns an encoder that writes the configured response headers prior to invoking the given encoder
+func (rh ResponseHeaders) decorate(next kithttp.EncodeResponseFunc) kithttp.EncodeResponseFunc {
+	if !rh.Kid && !rh.Expires {
+		return next
+	}
+
+	return func(ctx context.Context, response http.ResponseWriter, value interface{}) error {
+		header, claims, err := decodeUnverified(value.(string))
+		if err != nil {
+			return err
+		}
+
+		if kid, ok := header["kid"].(string); rh.Kid && ok {
+			response.Header().Set(KidResponseHeader, kid)
+		}
+
+		if exp, ok := claims["exp"]; rh.Expires && ok {
+			response.Header().Set(ExpiresResponseHeader, fmt.Sprint(exp))
+		}
+
+		return next(ctx, response, value)
+	}
+}
@@ -0,0 +1,135 @@
+package token
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/xmidt-org/themis/key"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestResponseHeadersHandler(t *testing.T, o Options) IssueHandler {
+	require := require.New(t)
+	cb, err := NewClaimBuilders(nil, nil, o)
+	require.NoError(err)
+
+	f, err := NewFactory(o, cb, key.NewRegistry(nil))
+	require.NoError(err)
+
+	rb, err := NewRequestBuilders(o)
+	require.NoError(err)
+
+	handler, err := o.Issue.NewHandler(NewIssueEndpoint(f), rb)
+	require.NoError(err)
+	return handler
+}
+
+func testResponseHeadersEnabled(t *testing.T, compress bool) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		handler = newTestResponseHeadersHandler(t, Options{
+			Alg:            "RS256",
+			Key:            key.Descriptor{Kid: "headers", Bits: 512},
+			Duration:       time.Hour,
+			CompressClaims: compress,
+			Issue: Issue{
+				ResponseHeaders: ResponseHeaders{Kid: true, Expires: true},
+			},
+		})
+
+		response = httptest.NewRecorder()
+	)
+
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/issue", nil))
+	require.Equal(http.StatusOK, response.Code)
+
+	exp, err := strconv.ParseInt(response.Header().Get(ExpiresResponseHeader), 10, 64)
+	require.NoError(err)
+	assert.InDelta(time.Now().Add(time.Hour).Unix(), exp, 5)
+
+	header, claims, err := decodeUnverified(response.Body.String())
+	require.NoError(err)
+
+	assert.Equal("headers", header["kid"])
+	assert.Equal("headers", response.Header().Get(KidResponseHeader))
+	if !compress {
+		token, _, err := new(jwt.Parser).ParseUnverified(response.Body.String(), jwt.MapClaims{})
+		require.NoError(err)
+		assert.Equal(token.Header["kid"], response.Header().Get(KidResponseHeader))
+		assert.Equal(token.Claims.(jwt.MapClaims)["exp"], float64(exp))
+	}
+
+	assert.Equal(claims["exp"].(fmt.Stringer).String(), response.Header().Get(ExpiresResponseHeader))
+
+}
+
+func testResponseHeadersNoExpiration(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		handler = newTestResponseHeadersHandler(t, Options{
+			Alg:         "RS256",
+			Key:         key.Descriptor{Kid: "headers", Bits: 512},
+			DisableTime: true,
+			Issue: Issue{
+				ResponseHeaders: ResponseHeaders{Kid: true, Expires: true},
+			},
+		})
+
+		response = httptest.NewRecorder()
+	)
+
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/issue", nil))
+	require.Equal(http.StatusOK, response.Code)
+	assert.Equal("headers", response.Header().Get(KidResponseHeader))
+	assert.NotContains(response.Header(), ExpiresResponseHeader)
+}
+
+func testResponseHeadersDisabled(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		handler = newTestResponseHeadersHandler(t, Options{
+			Alg:      "RS256",
+			Key:      key.Descriptor{Kid: "headers", Bits: 512},
+			Duration: time.Hour,
+		})
+
+		response = httptest.NewRecorder()
+	)
+
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/issue", nil))
+	require.Equal(http.StatusOK, response.Code)
+	assert.NotContains(response.Header(), KidResponseHeader)
+	assert.NotContains(response.Header(), ExpiresResponseHeader)
+}
+
+func testDecodeUnverifiedMalformed(t *testing.T) {
+	_, _, err := decodeUnverified("not.a token")
+	assert.Equal(t, ErrMalformedToken, err)
+}
+
+func TestResponseHeaders(t *testing.T) {
+	t.Run("Enabled", func(t *testing.T) {
+		testResponseHeadersEnabled(t, false)
+	})
+
+	t.Run("Compressed", func(t *testing.T) {
+		testResponseHeadersEnabled(t, true)
+	})
+
+	t.Run("NoExpiration", testResponseHeadersNoExpiration)
+	t.Run("Disabled", testResponseHeadersDisabled)
+	t.Run("Malformed", testDecodeUnverifiedMalformed)
+}
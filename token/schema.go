@@ -0,0 +1,417 @@
+package token
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// annotationKeywords are the JSON Schema keywords that describe a schema without constraining values
+var annotationKeywords = map[string]bool{
+	"$schema":     true,
+	"$id":         true,
+	"$comment":    true,
+	"title":       true,
+	"description": true,
+	"default":     true,
+	"examples":    true,
+}
+
+// InvalidSchemaError is returned at startup when the claims schema cannot be read or compiled
+type InvalidSchemaError struct {
+	File string
+	Err  error
+}
+
+func (ise InvalidSchemaError) Error() string {
+	return fmt.Sprintf("Invalid claims schema %s: %s", ise.File, ise.Err)
+}
+
+func (ise InvalidSchemaError) Unwrap() error {
+	return ise.Err
+}
+
+// SchemaValidationError is returned when the claims of a token do not conform to the claims schema.
+// This error produces a 400 response.
+type SchemaValidationError struct {
+	// Errors describe each violation, prefixed with the JSONPath-like location of the offending value
+	Errors []string
+}
+
+func (sve SchemaValidationError) Error() string {
+	return fmt.Sprintf("Claims do not conform to the schema: %s", strings.Join(sve.Errors, "; "))
+}
+
+func (sve SchemaValidationError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// schema is a compiled JSON Schema.  Only the validation keywords listed in Options.ClaimsSchema are supported.
+type schema struct {
+	types []string
+
+	properties           map[string]*schema
+	required             []string
+	additionalProperties *schema
+	noAdditional         bool
+
+	items    *schema
+	minItems *int
+	maxItems *int
+
+	enum     []interface{}
+	hasConst bool
+	constant interface{}
+
+	minLength *int
+	maxLength *int
+	pattern   *regexp.Regexp
+
+	minimum *float64
+	maximum *float64
+}
+
+// loadClaimsSchema reads and compiles the JSON Schema in the given file
+func loadClaimsSchema(file string) (*schema, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, InvalidSchemaError{File: file, Err: err}
+	}
+
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, InvalidSchemaError{File: file, Err: err}
+	}
+
+	s, err := compileSchema(raw, "$")
+	if err != nil {
+		return nil, InvalidSchemaError{File: file, Err: err}
+	}
+
+	return s, nil
+}
+
+func schemaInt(v interface{}, keyword, path string) (*int, error) {
+	f, ok := v.(float64)
+	if !ok || f < 0 || f != math.Trunc(f) {
+		return nil, fmt.Errorf("%s: %s must be a non-negative integer", path, keyword)
+	}
+
+	i := int(f)
+	return &i, nil
+}
+
+func schemaNumber(v interface{}, keyword, path string) (*float64, error) {
+	f, ok := v.(float64)
+	if !ok {
+		return nil, fmt.Errorf("%s: %s must be a number", path, keyword)
+	}
+
+	return &f, nil
+}
+
+// compileSchema compiles a decoded JSON Schema.  The path locates the schema within the document, for errors.
+func compileSchema(raw interface{}, path string) (*schema, error) {
+	if b, ok := raw.(bool); ok {
+		// the boolean schemas: true accepts everything, false accepts nothing
+		if b {
+			return &schema{}, nil
+		}
+
+		return &schema{types: []string{}}, nil
+	}
+
+	object, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: a schema must be an object or a boolean", path)
+	}
+
+	var (
+		s   = new(schema)
+		err error
+	)
+
+	for keyword, v := range object {
+		switch keyword {
+		case "type":
+			switch t := v.(type) {
+			case string:
+				s.types = []string{t}
+			case []interface{}:
+				s.types = make([]string, 0, len(t))
+				for _, e := range t {
+					name, ok := e.(string)
+					if !ok {
+						return nil, fmt.Errorf("%s: type must be a string or an array of strings", path)
+					}
+
+					s.types = append(s.types, name)
+				}
+			default:
+				return nil, fmt.Errorf("%s: type must be a string or an array of strings", path)
+			}
+
+			for _, name := range s.types {
+				switch name {
+				case "null", "boolean", "object", "array", "number", "integer", "string":
+				default:
+					return nil, fmt.Errorf("%s: unknown type %s", path, name)
+				}
+			}
+
+		case "properties":
+			properties, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: properties must be an object", path)
+			}
+
+			s.properties = make(map[string]*schema, len(properties))
+			for name, ps := range properties {
+				if s.properties[name], err = compileSchema(ps, path+"."+name); err != nil {
+					return nil, err
+				}
+			}
+
+		case "required":
+			required, ok := v.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: required must be an array of strings", path)
+			}
+
+			for _, e := range required {
+				name, ok := e.(string)
+				if !ok {
+					return nil, fmt.Errorf("%s: required must be an array of strings", path)
+				}
+
+				s.required = append(s.required, name)
+			}
+
+		case "additionalProperties":
+			if b, ok := v.(bool); ok {
+				s.noAdditional = !b
+			} else if s.additionalProperties, err = compileSchema(v, path+".*"); err != nil {
+				return nil, err
+			}
+
+		case "items":
+			if s.items, err = compileSchema(v, path+"[*]"); err != nil {
+				return nil, err
+			}
+
+		case "minItems":
+			if s.minItems, err = schemaInt(v, keyword, path); err != nil {
+				return nil, err
+			}
+
+		case "maxItems":
+			if s.maxItems, err = schemaInt(v, keyword, path); err != nil {
+				return nil, err
+			}
+
+		case "enum":
+			enum, ok := v.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: enum must be an array", path)
+			}
+
+			s.enum = enum
+
+		case "const":
+			s.hasConst = true
+			s.constant = v
+
+		case "minLength":
+			if s.minLength, err = schemaInt(v, keyword, path); err != nil {
+				return nil, err
+			}
+
+		case "maxLength":
+			if s.maxLength, err = schemaInt(v, keyword, path); err != nil {
+				return nil, err
+			}
+
+		case "pattern":
+			expr, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: pattern must be a string", path)
+			}
+
+			if s.pattern, err = regexp.Compile(expr); err != nil {
+				return nil, fmt.Errorf("%s: invalid pattern: %s", path, err)
+			}
+
+		case "minimum":
+			if s.minimum, err = schemaNumber(v, keyword, path); err != nil {
+				return nil, err
+			}
+
+		case "maximum":
+			if s.maximum, err = schemaNumber(v, keyword, path); err != nil {
+				return nil, err
+			}
+
+		default:
+			if !annotationKeywords[keyword] {
+				return nil, fmt.Errorf("%s: unsupported keyword %s", path, keyword)
+			}
+		}
+	}
+
+	return s, nil
+}
+
+// jsonType returns the JSON Schema type name of a decoded JSON value.  Integral numbers are reported as integer.
+func jsonType(v interface{}) string {
+	switch n := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case float64:
+		if n == math.Trunc(n) {
+			return "integer"
+		}
+
+		return "number"
+	case string:
+		return "string"
+	default:
+		return "unknown"
+	}
+}
+
+// validate appends a description of each violation of this schema by a decoded JSON value to errs
+func (s *schema) validate(v interface{}, path string, errs []string) []string {
+	if s.types != nil {
+		actual, matched := jsonType(v), false
+		for _, t := range s.types {
+			if t == actual || (t == "number" && actual == "integer") {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			if len(s.types) == 0 {
+				return append(errs, fmt.Sprintf("%s: no value is allowed", path))
+			}
+
+			return append(errs, fmt.Sprintf("%s: expected %s, got %s", path, strings.Join(s.types, " or "), actual))
+		}
+	}
+
+	if s.enum != nil {
+		found := false
+		for _, e := range s.enum {
+			if reflect.DeepEqual(e, v) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			errs = append(errs, fmt.Sprintf("%s: value is not one of the allowed values", path))
+		}
+	}
+
+	if s.hasConst && !reflect.DeepEqual(s.constant, v) {
+		errs = append(errs, fmt.Sprintf("%s: value does not equal the required constant", path))
+	}
+
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for _, name := range s.required {
+			if _, ok := value[name]; !ok {
+				errs = append(errs, fmt.Sprintf("%s: missing required property %s", path, name))
+			}
+		}
+
+		names := make([]string, 0, len(value))
+		for name := range value {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+		for _, name := range names {
+			if ps, ok := s.properties[name]; ok {
+				errs = ps.validate(value[name], path+"."+name, errs)
+			} else if s.noAdditional {
+				errs = append(errs, fmt.Sprintf("%s.%s: property is not allowed", path, name))
+			} else if s.additionalProperties != nil {
+				errs = s.additionalProperties.validate(value[name], path+"."+name, errs)
+			}
+		}
+
+	case []interface{}:
+		if s.minItems != nil && len(value) < *s.minItems {
+			errs = append(errs, fmt.Sprintf("%s: expected at least %d items, got %d", path, *s.minItems, len(value)))
+		}
+
+		if s.maxItems != nil && len(value) > *s.maxItems {
+			errs = append(errs, fmt.Sprintf("%s: expected at most %d items, got %d", path, *s.maxItems, len(value)))
+		}
+
+		if s.items != nil {
+			for i, e := range value {
+				errs = s.items.validate(e, fmt.Sprintf("%s[%d]", path, i), errs)
+			}
+		}
+
+	case string:
+		length := utf8.RuneCountInString(value)
+		if s.minLength != nil && length < *s.minLength {
+			errs = append(errs, fmt.Sprintf("%s: expected at least %d characters, got %d", path, *s.minLength, length))
+		}
+
+		if s.maxLength != nil && length > *s.maxLength {
+			errs = append(errs, fmt.Sprintf("%s: expected at most %d characters, got %d", path, *s.maxLength, length))
+		}
+
+		if s.pattern != nil && !s.pattern.MatchString(value) {
+			errs = append(errs, fmt.Sprintf("%s: value does not match the pattern %s", path, s.pattern))
+		}
+
+	case float64:
+		if s.minimum != nil && value < *s.minimum {
+			errs = append(errs, fmt.Sprintf("%s: expected at least %v, got %v", path, *s.minimum, value))
+		}
+
+		if s.maximum != nil && value > *s.maximum {
+			errs = append(errs, fmt.Sprintf("%s: expected at most %v, got %v", path, *s.maximum, value))
+		}
+	}
+
+	return errs
+}
+
+// check validates a token's claims.  The claims are first converted to their JSON form, so that they are
+// validated exactly as they will appear in the token.
+func (s *schema) check(claims map[string]interface{}) error {
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return err
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	if errs := s.validate(decoded, "$", nil); len(errs) > 0 {
+		return SchemaValidationError{Errors: errs}
+	}
+
+	return nil
+}
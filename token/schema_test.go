@@ -0,0 +1,215 @@
+package token
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xmidt-org/themis/key"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testClaimsSchema = `{
+	"$schema": "http://json-schema.org/draft-07/schema#",
+	"title": "device token claims",
+	"type": "object",
+	"required": ["sub"],
+	"additionalProperties": false,
+	"properties": {
+		"sub": {"type": "string", "pattern": "^mac:[0-9a-f]{12}$"},
+		"exp": {"type": "integer"},
+		"iat": {"type": "integer"},
+		"partner": {"enum": ["comcast", "cox"]},
+		"trust": {"type": "integer", "minimum": 0, "maximum": 1000},
+		"capabilities": {
+			"type": "array",
+			"minItems": 1,
+			"maxItems": 3,
+			"items": {"type": "string", "minLength": 1, "maxLength": 16}
+		},
+		"version": {"const": "v1"},
+		"labels": {"type": "object", "additionalProperties": {"type": "string"}}
+	}
+}`
+
+func writeTestSchema(t *testing.T, contents string) string {
+	dir, err := ioutil.TempDir("", "schema")
+	require.NoError(t, err)
+
+	file := filepath.Join(dir, "claims.json")
+	require.NoError(t, ioutil.WriteFile(file, []byte(contents), 0600))
+	return file
+}
+
+func newTestSchemaFactory(t *testing.T) Factory {
+	file := writeTestSchema(t, testClaimsSchema)
+	defer os.RemoveAll(filepath.Dir(file))
+
+	f, err := NewFactory(
+		Options{
+			Key:          key.Descriptor{Kid: "test", Bits: 512},
+			ClaimsSchema: file,
+		},
+		ClaimBuilders{requestClaimBuilder{}},
+		key.NewRegistry(nil),
+	)
+
+	require.NoError(t, err)
+	return f
+}
+
+func testSchemaConforming(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		f      = newTestSchemaFactory(t)
+		r      = NewRequest()
+	)
+
+	r.Claims["sub"] = "mac:112233445566"
+	r.Claims["exp"] = 1772370000
+	r.Claims["partner"] = "comcast"
+	r.Claims["trust"] = 1000
+	r.Claims["capabilities"] = []string{"xmidt", "webpa"}
+	r.Claims["version"] = "v1"
+	r.Claims["labels"] = map[string]interface{}{"region": "east"}
+
+	signed, err := f.NewToken(context.Background(), r)
+	assert.NoError(err)
+	assert.NotEmpty(signed)
+}
+
+func testSchemaNonConforming(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		f       = newTestSchemaFactory(t)
+		r       = NewRequest()
+	)
+
+	r.Claims["sub"] = "device"
+	r.Claims["partner"] = "initech"
+	r.Claims["trust"] = 1000.5
+	r.Claims["capabilities"] = []interface{}{"", 17}
+	r.Claims["version"] = "v2"
+	r.Claims["labels"] = map[string]interface{}{"region": 1}
+	r.Claims["extra"] = true
+
+	signed, err := f.NewToken(context.Background(), r)
+	assert.Empty(signed)
+	require.IsType(SchemaValidationError{}, err)
+	assert.Equal(
+		[]string{
+			"$.capabilities[0]: expected at least 1 characters, got 0",
+			"$.capabilities[1]: expected string, got integer",
+			"$.extra: property is not allowed",
+			"$.labels.region: expected string, got integer",
+			"$.partner: value is not one of the allowed values",
+			"$.sub: value does not match the pattern ^mac:[0-9a-f]{12}$",
+			"$.trust: expected integer, got number",
+			"$.version: value does not equal the required constant",
+		},
+		err.(SchemaValidationError).Errors,
+	)
+
+	assert.Equal(http.StatusBadRequest, err.(SchemaValidationError).StatusCode())
+	assert.Contains(err.Error(), "$.sub")
+	assert.Equal(ErrorCodeSchemaViolation, ErrorCode(err))
+
+	// missing required claims and out of range values are reported too
+	r = NewRequest()
+	r.Claims["trust"] = -1
+	r.Claims["capabilities"] = []string{}
+	_, err = f.NewToken(context.Background(), r)
+	require.IsType(SchemaValidationError{}, err)
+	assert.Equal(
+		[]string{
+			"$: missing required property sub",
+			"$.capabilities: expected at least 1 items, got 0",
+			"$.trust: expected at least 0, got -1",
+		},
+		err.(SchemaValidationError).Errors,
+	)
+}
+
+func testSchemaBoolean(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := compileSchema(map[string]interface{}{
+		"properties": map[string]interface{}{
+			"anything": true,
+			"nothing":  false,
+		},
+	}, "$")
+
+	assert.NoError(err)
+	assert.NoError(s.check(map[string]interface{}{"anything": []int{1}}))
+	assert.Equal(
+		SchemaValidationError{Errors: []string{"$.nothing: no value is allowed"}},
+		s.check(map[string]interface{}{"nothing": "value"}),
+	)
+}
+
+func testSchemaInvalid(t *testing.T) {
+	testData := []struct {
+		name     string
+		contents string
+	}{
+		{"Malformed", `{"type": `},
+		{"NotObject", `[]`},
+		{"UnsupportedKeyword", `{"oneOf": [{"type": "string"}]}`},
+		{"UnknownType", `{"type": "date"}`},
+		{"InvalidType", `{"type": 1}`},
+		{"InvalidProperties", `{"properties": []}`},
+		{"InvalidPropertySchema", `{"properties": {"sub": "string"}}`},
+		{"InvalidRequired", `{"required": [1]}`},
+		{"InvalidPattern", `{"pattern": "["}`},
+		{"InvalidMinLength", `{"minLength": -1}`},
+		{"InvalidMaximum", `{"maximum": "10"}`},
+		{"InvalidEnum", `{"enum": "value"}`},
+		{"InvalidItems", `{"items": 1}`},
+	}
+
+	for _, record := range testData {
+		t.Run(record.name, func(t *testing.T) {
+			var (
+				assert = assert.New(t)
+				file   = writeTestSchema(t, record.contents)
+			)
+
+			defer os.RemoveAll(filepath.Dir(file))
+
+			f, err := NewFactory(
+				Options{Key: key.Descriptor{Kid: "test", Bits: 512}, ClaimsSchema: file},
+				ClaimBuilders{},
+				key.NewRegistry(nil),
+			)
+
+			assert.Nil(f)
+			assert.IsType(InvalidSchemaError{}, err)
+			assert.Contains(err.Error(), file)
+		})
+	}
+
+	t.Run("Missing", func(t *testing.T) {
+		f, err := NewFactory(
+			Options{Key: key.Descriptor{Kid: "test", Bits: 512}, ClaimsSchema: "/nosuch/claims.json"},
+			ClaimBuilders{},
+			key.NewRegistry(nil),
+		)
+
+		assert.Nil(t, f)
+		assert.IsType(t, InvalidSchemaError{}, err)
+	})
+}
+
+func TestSchema(t *testing.T) {
+	t.Run("Conforming", testSchemaConforming)
+	t.Run("NonConforming", testSchemaNonConforming)
+	t.Run("Boolean", testSchemaBoolean)
+	t.Run("Invalid", testSchemaInvalid)
+}
@@ -0,0 +1,153 @@
+package token
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DefaultScopeClaim is the name of the scope claim when none is configured
+const DefaultScopeClaim = "scope"
+
+// EmptyScopeError is returned when none of the requested scopes are allowed for a token's tenant
+type EmptyScopeError struct {
+	Requested []string
+	Tenant    string
+}
+
+func (ese EmptyScopeError) Error() string {
+	if len(ese.Tenant) > 0 {
+		return fmt.Sprintf("None of the requested scopes [%s] are allowed for tenant %s", strings.Join(ese.Requested, " "), ese.Tenant)
+	}
+
+	return fmt.Sprintf("None of the requested scopes [%s] are allowed", strings.Join(ese.Requested, " "))
+}
+
+func (ese EmptyScopeError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// Scope describes how the scope claim requested for a token is restricted to the scopes its tenant is allowed.
+// The requested scope may be a space-delimited string, as in OAuth 2.0, or an array of strings.  The emitted
+// claim has the same form as the request, and contains only the requested scopes that are allowed.
+type Scope struct {
+	// Claim is the name of the scope claim.  If unset, DefaultScopeClaim is used.
+	Claim string
+
+	// Allowed maps each tenant name onto the scopes that tenant's tokens may carry.  Tenant names are
+	// matched case insensitively.
+	Allowed map[string][]string
+
+	// Default is the set of scopes allowed for tokens whose tenant does not appear in Allowed, including
+	// tokens issued without any tenant.  If unset, such tokens may not carry any scope.
+	Default []string
+
+	// AllowEmpty controls what happens when none of the requested scopes are allowed.  By default, the
+	// request is rejected with a 400.  If this field is true, the token is issued without a scope claim.
+	AllowEmpty bool
+}
+
+type scopeSet map[string]bool
+
+func newScopeSet(scopes []string) scopeSet {
+	ss := make(scopeSet, len(scopes))
+	for _, s := range scopes {
+		ss[s] = true
+	}
+
+	return ss
+}
+
+// scopeClaimBuilder is a ClaimBuilder that replaces the scope claim with its intersection with the allowed scopes.
+// It must run after every other ClaimBuilder that sets the scope claim.
+type scopeClaimBuilder struct {
+	claim          string
+	allowed        map[string]scopeSet
+	defaultAllowed scopeSet
+	allowEmpty     bool
+}
+
+// requestedScopes parses a scope claim value.  The returned bool indicates whether the value was a string.
+func requestedScopes(v interface{}) ([]string, bool) {
+	switch s := v.(type) {
+	case string:
+		return strings.Fields(s), true
+
+	case []string:
+		return s, false
+
+	case []interface{}:
+		scopes := make([]string, 0, len(s))
+		for _, e := range s {
+			scopes = append(scopes, fmt.Sprint(e))
+		}
+
+		return scopes, false
+
+	default:
+		return []string{fmt.Sprint(v)}, true
+	}
+}
+
+func (sc scopeClaimBuilder) AddClaims(_ context.Context, r *Request, target map[string]interface{}) error {
+	v, ok := target[sc.claim]
+	if !ok {
+		return nil
+	}
+
+	tenant, _ := r.Metadata[TenantMetadata].(string)
+	allowed, ok := sc.allowed[strings.ToLower(tenant)]
+	if !ok {
+		allowed = sc.defaultAllowed
+	}
+
+	var (
+		requested, asString = requestedScopes(v)
+		granted             = make([]string, 0, len(requested))
+		seen                = make(scopeSet, len(requested))
+	)
+
+	for _, s := range requested {
+		if allowed[s] && !seen[s] {
+			granted = append(granted, s)
+			seen[s] = true
+		}
+	}
+
+	switch {
+	case len(granted) == 0 && !sc.allowEmpty:
+		return EmptyScopeError{Requested: requested, Tenant: tenant}
+
+	case len(granted) == 0:
+		delete(target, sc.claim)
+
+	case asString:
+		target[sc.claim] = strings.Join(granted, " ")
+
+	default:
+		target[sc.claim] = granted
+	}
+
+	return nil
+}
+
+// newScopeClaimBuilder creates the ClaimBuilder that enforces the given scope configuration
+func newScopeClaimBuilder(s Scope) ClaimBuilder {
+	sc := scopeClaimBuilder{
+		claim:          s.Claim,
+		allowed:        make(map[string]scopeSet, len(s.Allowed)),
+		defaultAllowed: newScopeSet(s.Default),
+		allowEmpty:     s.AllowEmpty,
+	}
+
+	if len(sc.claim) == 0 {
+		sc.claim = DefaultScopeClaim
+	}
+
+	for tenant, scopes := range s.Allowed {
+		sc.allowed[strings.ToLower(tenant)] = newScopeSet(scopes)
+	}
+
+	return sc
+}
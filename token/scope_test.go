@@ -0,0 +1,142 @@
+package token
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmptyScopeError(t *testing.T) {
+	var (
+		assert = assert.New(t)
+	)
+
+	err := EmptyScopeError{Requested: []string{"read", "write"}, Tenant: "acme"}
+	assert.Contains(err.Error(), "read write")
+	assert.Contains(err.Error(), "acme")
+	assert.Equal(http.StatusBadRequest, err.StatusCode())
+
+	err = EmptyScopeError{Requested: []string{"read"}}
+	assert.Contains(err.Error(), "read")
+	assert.NotContains(err.Error(), "tenant")
+}
+
+func newTestScope() Scope {
+	return Scope{
+		Allowed: map[string][]string{
+			"acme":   []string{"read", "write"},
+			"Globex": []string{"read"},
+		},
+		Default: []string{"public"},
+	}
+}
+
+func testScopeClaimBuilderIntersection(t *testing.T) {
+	testData := []struct {
+		name      string
+		tenant    interface{}
+		requested interface{}
+		expected  interface{}
+	}{
+		{"String", "acme", "write admin read", "write read"},
+		{"Duplicates", "acme", "read read write", "read write"},
+		{"CaseInsensitiveTenant", "GLOBEX", "read write", "read"},
+		{"StringArray", "acme", []string{"admin", "read"}, []string{"read"}},
+		{"Array", "globex", []interface{}{"read", "write"}, []string{"read"}},
+		{"UnknownTenant", "initech", "public read", "public"},
+		{"NoTenant", nil, "read public", "public"},
+	}
+
+	for _, record := range testData {
+		t.Run(record.name, func(t *testing.T) {
+			var (
+				assert  = assert.New(t)
+				require = require.New(t)
+
+				builder = newScopeClaimBuilder(newTestScope())
+				request = NewRequest()
+				target  = map[string]interface{}{DefaultScopeClaim: record.requested}
+			)
+
+			if record.tenant != nil {
+				request.Metadata[TenantMetadata] = record.tenant
+			}
+
+			require.NoError(builder.AddClaims(context.Background(), request, target))
+			assert.Equal(record.expected, target[DefaultScopeClaim])
+		})
+	}
+}
+
+func testScopeClaimBuilderNotRequested(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		builder = newScopeClaimBuilder(Scope{Claim: "scp"})
+		target  = map[string]interface{}{DefaultScopeClaim: "untouched"}
+	)
+
+	assert.NoError(builder.AddClaims(context.Background(), NewRequest(), target))
+	assert.Equal(map[string]interface{}{DefaultScopeClaim: "untouched"}, target)
+}
+
+func testScopeClaimBuilderEmpty(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		request = NewRequest()
+	)
+
+	request.Metadata[TenantMetadata] = "globex"
+
+	target := map[string]interface{}{DefaultScopeClaim: "write admin"}
+	err := newScopeClaimBuilder(newTestScope()).AddClaims(context.Background(), request, target)
+	require.Error(err)
+	assert.Equal(EmptyScopeError{Requested: []string{"write", "admin"}, Tenant: "globex"}, err)
+
+	allowEmpty := newTestScope()
+	allowEmpty.AllowEmpty = true
+	target = map[string]interface{}{DefaultScopeClaim: "write admin", "sub": "test"}
+	require.NoError(newScopeClaimBuilder(allowEmpty).AddClaims(context.Background(), request, target))
+	assert.Equal(map[string]interface{}{"sub": "test"}, target)
+}
+
+func testScopeNewClaimBuilders(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		scope = newTestScope()
+
+		builders, err = NewClaimBuilders(nil, nil, Options{
+			DisableTime: true,
+			Scope:       &scope,
+		})
+
+		request = NewRequest()
+	)
+
+	require.NoError(err)
+	request.Claims[DefaultScopeClaim] = "admin write read"
+	request.Metadata[TenantMetadata] = "acme"
+
+	target := make(map[string]interface{})
+	require.NoError(builders.AddClaims(context.Background(), request, target))
+	assert.Equal(map[string]interface{}{DefaultScopeClaim: "write read"}, target)
+
+	request.Claims[DefaultScopeClaim] = "admin"
+	target = make(map[string]interface{})
+	err = builders.AddClaims(context.Background(), request, target)
+	assert.IsType(EmptyScopeError{}, err)
+}
+
+func TestScopeClaimBuilder(t *testing.T) {
+	t.Run("Intersection", testScopeClaimBuilderIntersection)
+	t.Run("NotRequested", testScopeClaimBuilderNotRequested)
+	t.Run("Empty", testScopeClaimBuilderEmpty)
+	t.Run("NewClaimBuilders", testScopeNewClaimBuilders)
+}
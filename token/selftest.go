@@ -0,0 +1,134 @@
+package token
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/xmidt-org/themis/key"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+// SelfTestClaim is the only claim in the throwaway tokens issued by a factory's self test
+const SelfTestClaim = "selfTest"
+
+// SelfTestError indicates that a factory could not issue a token with one of its keys and then verify that
+// token against the key it publishes.  This usually means the key does not suit the signing algorithm.
+type SelfTestError struct {
+	Kid string
+	Err error
+}
+
+func (ste SelfTestError) Error() string {
+	return fmt.Sprintf("Self test failed for key %s: %s", ste.Kid, ste.Err)
+}
+
+func (ste SelfTestError) Unwrap() error {
+	return ste.Err
+}
+
+// SelfTester is implemented by a Factory that can check its own configuration
+type SelfTester interface {
+	// SelfTest issues a throwaway token with each signing key and verifies it against that key's published
+	// form.  A SelfTestError is returned for the first key that fails.
+	SelfTest() error
+}
+
+// verifyKey derives the verification key from the JWK a Pair publishes
+func verifyKey(pair key.Pair) (interface{}, error) {
+	var buffer bytes.Buffer
+	if _, err := pair.WriteJWK(&buffer); err != nil {
+		return nil, err
+	}
+
+	var okp map[string]interface{}
+	if err := json.Unmarshal(buffer.Bytes(), &okp); err == nil && okp["kty"] == "OKP" {
+		return key.ParseEd25519JWK(okp)
+	}
+
+	set, err := jwk.Parse(&buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(set.Keys) != 1 {
+		return nil, fmt.Errorf("Expected exactly one published key, found %d", len(set.Keys))
+	}
+
+	return set.Keys[0].Materialize()
+}
+
+func (f *factory) selfTest(method jwt.SigningMethod, pair key.Pair) error {
+	token := jwt.NewWithClaims(method, jwt.MapClaims{SelfTestClaim: true})
+	token.Header["kid"] = pair.KID()
+	signed, err := token.SignedString(pair.Sign())
+	if err != nil {
+		return err
+	}
+
+	verify, err := verifyKey(pair)
+	if err != nil {
+		return err
+	}
+
+	parsed, err := jwt.Parse(signed, func(*jwt.Token) (interface{}, error) {
+		return verify, nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if parsed.Method.Alg() != method.Alg() || parsed.Claims.(jwt.MapClaims)[SelfTestClaim] != true {
+		return fmt.Errorf("Verified token does not match the issued token")
+	}
+
+	return nil
+}
+
+// SelfTest checks the active key, every tenant key, the key for each allowed algorithm, and every key that
+// signs tokens with multiple signatures.  Self test tokens are not recorded as key usage.
+func (f *factory) SelfTest() error {
+	signers := []signer{{method: f.method, pair: f.pair.Load().(key.Pair)}}
+	tenants := make([]string, 0, len(f.tenants))
+	for tenant := range f.tenants {
+		tenants = append(tenants, tenant)
+	}
+
+	sort.Strings(tenants)
+	for _, tenant := range tenants {
+		signers = append(signers, signer{method: f.method, pair: f.tenants[tenant]})
+	}
+
+	algorithms := make([]string, 0, len(f.algorithms))
+	for alg := range f.algorithms {
+		algorithms = append(algorithms, alg)
+	}
+
+	sort.Strings(algorithms)
+	for _, alg := range algorithms {
+		signers = append(signers, f.algorithms[alg])
+	}
+
+	if f.general != nil {
+		for _, gs := range f.general.signers {
+			pair, ok := f.keys.Get(gs.kid)
+			if !ok {
+				return SelfTestError{Kid: gs.kid, Err: NoSigningKeyError{Kid: gs.kid}}
+			}
+
+			signers = append(signers, signer{method: gs.method, pair: pair})
+		}
+	}
+
+	for _, s := range signers {
+		if err := f.selfTest(s.method, s.pair); err != nil {
+			return SelfTestError{Kid: s.pair.KID(), Err: err}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,294 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/xmidt-org/themis/config"
+	"github.com/xmidt-org/themis/key"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+func TestSelfTestError(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		cause       = errors.New("expected")
+		err   error = SelfTestError{Kid: "test", Err: cause}
+	)
+
+	assert.Contains(err.Error(), "test")
+	assert.Contains(err.Error(), "expected")
+	assert.True(errors.Is(err, cause))
+}
+
+func testSelfTestSuccess(t *testing.T, o Options) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		registry = key.NewRegistry(nil)
+	)
+
+	f, err := NewFactory(o, ClaimBuilders{}, registry)
+	require.NoError(err)
+	require.Implements((*SelfTester)(nil), f)
+	assert.NoError(f.(SelfTester).SelfTest())
+
+	// self test tokens are not key usage
+	for _, kid := range registry.Kids() {
+		_, ok := registry.LastUsed(kid)
+		assert.False(ok)
+	}
+}
+
+func testSelfTestFailure(t *testing.T, o Options, replacement key.Descriptor) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		registry = key.NewRegistry(nil)
+	)
+
+	f, err := NewFactory(o, ClaimBuilders{}, registry)
+	require.NoError(err)
+
+	// a key that doesn't fit is rejected by NewFactory, so swap one in afterwards
+	replacement.Replace = true
+	_, err = registry.Register(replacement)
+	require.NoError(err)
+
+	err = f.(SelfTester).SelfTest()
+	require.Error(err)
+	require.IsType(SelfTestError{}, err)
+	assert.Equal(replacement.Kid, err.(SelfTestError).Kid)
+}
+
+// newMismatchedPair registers a key that the factory under test could not have accepted at startup
+func newMismatchedPair(t *testing.T, kr key.Registry, kid string) key.Pair {
+	p, err := kr.Register(key.Descriptor{Kid: kid, Type: key.KeyTypeSecret})
+	require.NoError(t, err)
+	return p
+}
+
+func testSelfTestTenantFailure(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		registry = key.NewRegistry(nil)
+	)
+
+	f, err := NewFactory(
+		Options{
+			Alg: "RS256",
+			Key: key.Descriptor{Kid: "default", Bits: 512},
+			Tenant: &Tenant{
+				Header: "X-Tenant",
+				Keys: map[string]key.Descriptor{
+					"acme":   key.Descriptor{Bits: 512},
+					"globex": key.Descriptor{Bits: 512},
+				},
+			},
+		},
+		ClaimBuilders{},
+		registry,
+	)
+
+	require.NoError(err)
+
+	// tenant keys are held by the factory, so replacing them in the registry has no effect
+	f.(*factory).tenants["globex"] = newMismatchedPair(t, registry, "mismatched")
+	err = f.(SelfTester).SelfTest()
+	require.IsType(SelfTestError{}, err)
+	assert.Equal("mismatched", err.(SelfTestError).Kid)
+}
+
+func testSelfTestAlgorithmFailure(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		registry = key.NewRegistry(nil)
+	)
+
+	f, err := NewFactory(
+		Options{
+			Alg: "RS256",
+			Key: key.Descriptor{Kid: "default", Bits: 512},
+			Algorithms: &Algorithms{
+				Header: "X-Alg",
+				Keys: map[string]key.Descriptor{
+					"ES256": key.Descriptor{Kid: "es256", Type: key.KeyTypeECDSA, Bits: 256},
+				},
+			},
+		},
+		ClaimBuilders{},
+		registry,
+	)
+
+	require.NoError(err)
+
+	s := f.(*factory).algorithms["ES256"]
+	s.pair = newMismatchedPair(t, registry, "mismatched")
+	f.(*factory).algorithms["ES256"] = s
+	err = f.(SelfTester).SelfTest()
+	require.IsType(SelfTestError{}, err)
+	assert.Equal("mismatched", err.(SelfTestError).Kid)
+}
+
+func TestSelfTest(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		testData := []struct {
+			name    string
+			options Options
+		}{
+			{"RSA", Options{Alg: "RS256", Key: key.Descriptor{Kid: "rsa", Bits: 512}}},
+			{"ECDSA", Options{Alg: "ES256", Key: key.Descriptor{Kid: "ecdsa", Type: key.KeyTypeECDSA, Bits: 256}}},
+			{"Secret", Options{Alg: "HS256", Key: key.Descriptor{Kid: "secret", Type: key.KeyTypeSecret}}},
+			{"Ed25519", Options{Alg: "EdDSA", Key: key.Descriptor{Kid: "ed25519", Type: key.KeyTypeEd25519}}},
+			{
+				"Tenants",
+				Options{
+					Key: key.Descriptor{Kid: "default", Bits: 512},
+					Tenant: &Tenant{
+						Header: "X-Tenant",
+						Keys: map[string]key.Descriptor{
+							"acme": key.Descriptor{Bits: 512},
+						},
+					},
+				},
+			},
+			{
+				"Algorithms",
+				Options{
+					Key: key.Descriptor{Kid: "default", Bits: 512},
+					Algorithms: &Algorithms{
+						Header: "X-Alg",
+						Keys: map[string]key.Descriptor{
+							"ES256": key.Descriptor{Type: key.KeyTypeECDSA, Bits: 256},
+						},
+					},
+				},
+			},
+		}
+
+		for _, record := range testData {
+			t.Run(record.name, func(t *testing.T) {
+				testSelfTestSuccess(t, record.options)
+			})
+		}
+	})
+
+	t.Run("Failure", func(t *testing.T) {
+		testData := []struct {
+			name        string
+			options     Options
+			replacement key.Descriptor
+		}{
+			{
+				"RSAKeyWithECDSA",
+				Options{Alg: "ES256", Key: key.Descriptor{Kid: "test", Type: key.KeyTypeECDSA, Bits: 256}},
+				key.Descriptor{Kid: "test", Bits: 512},
+			},
+			{
+				"WrongCurve",
+				Options{Alg: "ES256", Key: key.Descriptor{Kid: "test", Type: key.KeyTypeECDSA, Bits: 256}},
+				key.Descriptor{Kid: "test", Type: key.KeyTypeECDSA, Bits: 384},
+			},
+			{
+				"SecretWithRSA",
+				Options{Alg: "RS256", Key: key.Descriptor{Kid: "test", Bits: 512}},
+				key.Descriptor{Kid: "test", Type: key.KeyTypeSecret},
+			},
+			{
+				"Ed25519WithECDSA",
+				Options{Alg: "ES256", Key: key.Descriptor{Kid: "test", Type: key.KeyTypeECDSA, Bits: 256}},
+				key.Descriptor{Kid: "test", Type: key.KeyTypeEd25519},
+			},
+		}
+
+		for _, record := range testData {
+			t.Run(record.name, func(t *testing.T) {
+				testSelfTestFailure(t, record.options, record.replacement)
+			})
+		}
+
+		t.Run("Tenant", testSelfTestTenantFailure)
+		t.Run("Algorithm", testSelfTestAlgorithmFailure)
+	})
+}
+
+func testUnmarshalSelfTest(t *testing.T, configuration string, replacement *key.Descriptor, expectStartError bool) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		factory Factory
+		app     = fxtest.New(t,
+			fx.Provide(
+				config.ProvideViper(config.Json(configuration)),
+				func() key.Registry { return key.NewRegistry(nil) },
+				Unmarshal("token"),
+			),
+			fx.Populate(&factory),
+			fx.Invoke(
+				func(kr key.Registry) error {
+					if replacement == nil {
+						return nil
+					}
+
+					d := *replacement
+					d.Replace = true
+					_, err := kr.Register(d)
+					return err
+				},
+			),
+		)
+	)
+
+	require.NoError(app.Err())
+	require.NotNil(factory)
+
+	err := app.Start(context.Background())
+	if expectStartError {
+		assert.IsType(SelfTestError{}, err)
+	} else {
+		assert.NoError(err)
+		app.RequireStop()
+	}
+}
+
+func TestUnmarshalSelfTest(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		testUnmarshalSelfTest(t, `{"token": {"selfTest": true, "key": {"kid": "test", "bits": 512}}}`, nil, false)
+	})
+
+	t.Run("BrokenKey", func(t *testing.T) {
+		testUnmarshalSelfTest(
+			t,
+			`{"token": {"selfTest": true, "alg": "ES256", "key": {"kid": "test", "type": "ecdsa", "bits": 256}}}`,
+			&key.Descriptor{Kid: "test", Bits: 512},
+			true,
+		)
+	})
+
+	t.Run("BrokenRefreshKey", func(t *testing.T) {
+		testUnmarshalSelfTest(
+			t,
+			`{"token": {"key": {"kid": "access", "bits": 512}, "refresh": {"selfTest": true, "alg": "HS256", "key": {"kid": "refresh", "type": "secret"}}}}`,
+			&key.Descriptor{Kid: "refresh", Bits: 512},
+			true,
+		)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		testUnmarshalSelfTest(
+			t,
+			`{"token": {"alg": "ES256", "key": {"kid": "test", "type": "ecdsa", "bits": 256}}}`,
+			&key.Descriptor{Kid: "test", Bits: 512},
+			false,
+		)
+	})
+}
@@ -0,0 +1,145 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/xmidt-org/themis/key"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSequenceFactory(t *testing.T, s Sequence, store SequenceStore) Factory {
+	sb, err := NewSequenceClaimBuilder(s, store)
+	require.NoError(t, err)
+
+	f, err := NewFactory(
+		Options{Key: key.Descriptor{Kid: "test", Bits: 512}},
+		ClaimBuilders{requestClaimBuilder{}, sb},
+		key.NewRegistry(nil),
+	)
+
+	require.NoError(t, err)
+	return f
+}
+
+func issueSequence(t *testing.T, f Factory, claim string) (interface{}, error) {
+	signed, err := f.NewToken(context.Background(), new(Request))
+	if err != nil {
+		return nil, err
+	}
+
+	claims := make(jwt.MapClaims)
+	_, _, err = new(jwt.Parser).ParseUnverified(signed, claims)
+	require.NoError(t, err)
+	return claims[claim], nil
+}
+
+func testSequenceDefault(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		f      = newSequenceFactory(t, Sequence{}, nil)
+	)
+
+	for expected := 1.0; expected <= 5.0; expected++ {
+		actual, err := issueSequence(t, f, DefaultSequenceClaim)
+		assert.NoError(err)
+		assert.Equal(expected, actual)
+	}
+}
+
+func testSequenceSeed(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		f      = newSequenceFactory(t, Sequence{Claim: "counter", Seed: 100}, nil)
+	)
+
+	for expected := 101.0; expected <= 103.0; expected++ {
+		actual, err := issueSequence(t, f, "counter")
+		assert.NoError(err)
+		assert.Equal(expected, actual)
+	}
+}
+
+func testSequenceStore(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		store  = new(mockSequenceStore)
+	)
+
+	store.ExpectLoad().Return(uint64(42), nil).Once()
+	store.ExpectSave(43).Return(nil).Once()
+	store.ExpectSave(44).Return(nil).Once()
+	f := newSequenceFactory(t, Sequence{Seed: 10}, store)
+
+	actual, err := issueSequence(t, f, DefaultSequenceClaim)
+	assert.NoError(err)
+	assert.Equal(43.0, actual)
+
+	actual, err = issueSequence(t, f, DefaultSequenceClaim)
+	assert.NoError(err)
+	assert.Equal(44.0, actual)
+
+	store.AssertExpectations(t)
+}
+
+func testSequenceStoreSeedWins(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		store  = new(mockSequenceStore)
+	)
+
+	store.ExpectLoad().Return(uint64(5), nil).Once()
+	store.ExpectSave(11).Return(nil).Once()
+	f := newSequenceFactory(t, Sequence{Seed: 10}, store)
+
+	actual, err := issueSequence(t, f, DefaultSequenceClaim)
+	assert.NoError(err)
+	assert.Equal(11.0, actual)
+
+	store.AssertExpectations(t)
+}
+
+func testSequenceStoreLoadError(t *testing.T) {
+	var (
+		assert        = assert.New(t)
+		store         = new(mockSequenceStore)
+		expectedError = errors.New("expected")
+	)
+
+	store.ExpectLoad().Return(uint64(0), expectedError).Once()
+	sb, err := NewSequenceClaimBuilder(Sequence{}, store)
+	assert.Nil(sb)
+	assert.Equal(expectedError, err)
+
+	store.AssertExpectations(t)
+}
+
+func testSequenceStoreSaveError(t *testing.T) {
+	var (
+		assert        = assert.New(t)
+		store         = new(mockSequenceStore)
+		expectedError = errors.New("expected")
+	)
+
+	store.ExpectLoad().Return(uint64(0), nil).Once()
+	store.ExpectSave(1).Return(expectedError).Once()
+	f := newSequenceFactory(t, Sequence{}, store)
+
+	_, err := issueSequence(t, f, DefaultSequenceClaim)
+	assert.Equal(expectedError, err)
+
+	store.AssertExpectations(t)
+}
+
+func TestSequence(t *testing.T) {
+	t.Run("Default", testSequenceDefault)
+	t.Run("Seed", testSequenceSeed)
+	t.Run("Store", testSequenceStore)
+	t.Run("StoreSeedWins", testSequenceStoreSeedWins)
+	t.Run("StoreLoadError", testSequenceStoreLoadError)
+	t.Run("StoreSaveError", testSequenceStoreSaveError)
+}
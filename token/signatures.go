@@ -0,0 +1,193 @@
+package token
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/xmidt-org/themis/key"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// GeneralJWSContentType is the media type of tokens in the JWS general JSON serialization
+const GeneralJWSContentType = "application/jose+json"
+
+var (
+	ErrSignaturesKidRequired        = errors.New("At least one kid is required for multiple signatures")
+	ErrSignaturesWithCompression    = errors.New("Multiple signatures cannot be combined with compressed claims")
+	ErrSignaturesWithTenants        = errors.New("Multiple signatures cannot be combined with tenant keys")
+	ErrSignaturesWithAlgorithms     = errors.New("Multiple signatures cannot be combined with per-request algorithms")
+	ErrSignaturesWithRotation       = errors.New("Multiple signatures cannot be combined with key rotation")
+	ErrSignaturesDuplicateKid       = errors.New("Each kid may only sign a token once")
+	ErrSignaturesDeterministicNotES = errors.New("Deterministic signatures require an ES algorithm for every kid")
+)
+
+// UnknownSignatureKidError is returned at startup when a kid configured for multiple signatures is not in the key Registry
+type UnknownSignatureKidError struct {
+	Kid string
+}
+
+func (uske UnknownSignatureKidError) Error() string {
+	return fmt.Sprintf("No key with kid %s is available for multiple signatures", uske.Kid)
+}
+
+// Signatures describes tokens signed by several keys at once.  Such tokens use the JWS general JSON serialization
+// of RFC 7515, section 7.2.1, rather than the compact form: a JSON object with the base64url-encoded claims as its
+// payload, and one entry in its signatures array per key.  Each signature's protected header holds that key's alg
+// and kid.  Verifiers check whichever signatures they have keys for.
+//
+// Because the token is JSON, the issue handler's response content type should usually be set to GeneralJWSContentType.
+type Signatures struct {
+	// Kids are the key identifiers of the keys that sign each token, in signature order.  Every kid must already be in
+	// the factory's key Registry, e.g. the factory's own Key or a key from another factory that shares the Registry.
+	Kids []string
+
+	// Algs maps kids onto their signing algorithms.  A kid that is not listed signs with the factory's Alg.
+	Algs map[string]string
+}
+
+// generalSigner is one of the keys that signs every token, identified by kid so that the current Pair is
+// looked up for each token
+type generalSigner struct {
+	kid    string
+	method jwt.SigningMethod
+}
+
+// generalJWS produces tokens in the JWS general JSON serialization
+type generalJWS struct {
+	keys      key.Registry
+	canonical bool
+	signers   []generalSigner
+}
+
+type generalSignature struct {
+	Protected string `json:"protected"`
+	Signature string `json:"signature"`
+}
+
+type generalSerialization struct {
+	Payload    string             `json:"payload"`
+	Signatures []generalSignature `json:"signatures"`
+}
+
+// newGeneralJWS validates the configured Signatures against the rest of the Options and the keys in the Registry
+func newGeneralJWS(o Options, method jwt.SigningMethod, kr key.Registry) (*generalJWS, error) {
+	s := o.Signatures
+	switch {
+	case len(s.Kids) == 0:
+		return nil, ErrSignaturesKidRequired
+	case o.CompressClaims:
+		return nil, ErrSignaturesWithCompression
+	case o.Tenant != nil:
+		return nil, ErrSignaturesWithTenants
+	case o.Algorithms != nil:
+		return nil, ErrSignaturesWithAlgorithms
+	case o.Key.RotateInterval > 0:
+		return nil, ErrSignaturesWithRotation
+	}
+
+	g := &generalJWS{
+		keys:      kr,
+		canonical: o.CanonicalClaims,
+		signers:   make([]generalSigner, 0, len(s.Kids)),
+	}
+
+	seen := make(map[string]bool, len(s.Kids))
+	for _, kid := range s.Kids {
+		if seen[kid] {
+			return nil, ErrSignaturesDuplicateKid
+		}
+
+		seen[kid] = true
+		if _, ok := kr.Get(kid); !ok {
+			return nil, UnknownSignatureKidError{Kid: kid}
+		}
+
+		m := method
+		if alg, ok := s.Algs[kid]; ok {
+			if m = getSigningMethod(alg); m == nil {
+				return nil, fmt.Errorf("No such signing method: %s", alg)
+			}
+
+			if o.DeterministicSignatures {
+				var err error
+				if m, err = newDeterministicMethod(m); err != nil {
+					return nil, ErrSignaturesDeterministicNotES
+				}
+			}
+		}
+
+		if err := checkAlgorithm(kr, kid, m); err != nil {
+			return nil, err
+		}
+
+		g.signers = append(g.signers, generalSigner{kid: kid, method: m})
+	}
+
+	return g, nil
+}
+
+// kid is the kid reported for tokens signed by every key, i.e. the first signer's
+func (g *generalJWS) kid() string {
+	return g.signers[0].kid
+}
+
+func (g *generalJWS) encode(v map[string]interface{}) ([]byte, error) {
+	if g.canonical {
+		return CanonicalJSON(v)
+	}
+
+	return json.Marshal(v)
+}
+
+// sign produces the general JSON serialization of a token.  Each signature's protected header is the given
+// header with that signer's alg and kid.
+func (g *generalJWS) sign(header map[string]interface{}, claims map[string]interface{}) (string, error) {
+	payload, err := g.encode(claims)
+	if err != nil {
+		return "", err
+	}
+
+	output := generalSerialization{
+		Payload:    jwt.EncodeSegment(payload),
+		Signatures: make([]generalSignature, 0, len(g.signers)),
+	}
+
+	for _, s := range g.signers {
+		pair, ok := g.keys.Get(s.kid)
+		if !ok {
+			return "", NoSigningKeyError{Kid: s.kid}
+		}
+
+		protected := make(map[string]interface{}, len(header)+2)
+		for k, v := range header {
+			protected[k] = v
+		}
+
+		protected["alg"] = s.method.Alg()
+		protected["kid"] = s.kid
+		h, err := g.encode(protected)
+		if err != nil {
+			return "", err
+		}
+
+		encodedHeader := jwt.EncodeSegment(h)
+		signature, err := s.method.Sign(encodedHeader+"."+output.Payload, pair.Sign())
+		if err != nil {
+			return "", err
+		}
+
+		output.Signatures = append(output.Signatures, generalSignature{
+			Protected: encodedHeader,
+			Signature: signature,
+		})
+	}
+
+	data, err := json.Marshal(output)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
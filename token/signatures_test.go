@@ -0,0 +1,206 @@
+package token
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/xmidt-org/themis/key"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSignaturesFactory(t *testing.T, o Options) (Factory, key.Registry) {
+	registry := key.NewRegistry(rand.Reader)
+	_, err := registry.Register(key.Descriptor{Kid: "second", Type: key.KeyTypeECDSA, Bits: 256})
+	require.NoError(t, err)
+
+	f, err := NewFactory(o, ClaimBuilders{requestClaimBuilder{}}, registry)
+	require.NoError(t, err)
+	return f, registry
+}
+
+func testSignaturesToken(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		f, registry = newTestSignaturesFactory(t, Options{
+			Alg: "RS256",
+			Key: key.Descriptor{Kid: "first", Bits: 1024},
+			Signatures: &Signatures{
+				Kids: []string{"first", "second"},
+				Algs: map[string]string{"second": "es256"},
+			},
+		})
+	)
+
+	r := NewRequest()
+	r.Claims["sub"] = "test"
+	signed, err := f.NewToken(context.Background(), r)
+	require.NoError(err)
+
+	var general struct {
+		Payload    string `json:"payload"`
+		Signatures []struct {
+			Protected string `json:"protected"`
+			Signature string `json:"signature"`
+		} `json:"signatures"`
+	}
+
+	require.NoError(json.Unmarshal([]byte(signed), &general))
+	require.Len(general.Signatures, 2)
+
+	payload, err := jwt.DecodeSegment(general.Payload)
+	require.NoError(err)
+	assert.JSONEq(`{"sub": "test"}`, string(payload))
+
+	first, ok := registry.Get("first")
+	require.True(ok)
+	second, ok := registry.Get("second")
+	require.True(ok)
+
+	testData := []struct {
+		kid    string
+		method jwt.SigningMethod
+		verify interface{}
+	}{
+		{"first", jwt.SigningMethodRS256, &first.Sign().(*rsa.PrivateKey).PublicKey},
+		{"second", jwt.SigningMethodES256, &second.Sign().(*ecdsa.PrivateKey).PublicKey},
+	}
+
+	for i, record := range testData {
+		s := general.Signatures[i]
+		data, err := jwt.DecodeSegment(s.Protected)
+		require.NoError(err)
+
+		var header map[string]interface{}
+		require.NoError(json.Unmarshal(data, &header))
+		assert.Equal(record.kid, header["kid"])
+		assert.Equal(record.method.Alg(), header["alg"])
+
+		// each signature verifies on its own, against only its own key
+		assert.NoError(record.method.Verify(s.Protected+"."+general.Payload, s.Signature, record.verify))
+		assert.Error(record.method.Verify(s.Protected+"."+general.Payload, general.Signatures[1-i].Signature, record.verify))
+	}
+
+	assert.NoError(f.(SelfTester).SelfTest())
+
+	// the response headers read the first signature's protected header
+	header, claims, err := decodeUnverified(signed)
+	require.NoError(err)
+	assert.Equal("first", header["kid"])
+	assert.Equal("test", claims["sub"])
+}
+
+func testSignaturesRemovedKey(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		f, registry = newTestSignaturesFactory(t, Options{
+			Key:        key.Descriptor{Kid: "first", Bits: 1024},
+			Signatures: &Signatures{Kids: []string{"first", "second"}, Algs: map[string]string{"second": "ES256"}},
+		})
+	)
+
+	require.True(registry.Remove("second"))
+	signed, err := f.NewToken(context.Background(), NewRequest())
+	assert.Empty(signed)
+	assert.Equal(NoSigningKeyError{Kid: "second"}, err)
+	assert.Equal(SelfTestError{Kid: "second", Err: NoSigningKeyError{Kid: "second"}}, f.(SelfTester).SelfTest())
+}
+
+func testSignaturesInvalid(t *testing.T) {
+	testData := []struct {
+		name     string
+		options  Options
+		expected error
+	}{
+		{
+			name:     "NoKids",
+			options:  Options{Signatures: &Signatures{}},
+			expected: ErrSignaturesKidRequired,
+		},
+		{
+			name:     "UnknownKid",
+			options:  Options{Signatures: &Signatures{Kids: []string{"first", "missing"}}},
+			expected: UnknownSignatureKidError{Kid: "missing"},
+		},
+		{
+			name:     "DuplicateKid",
+			options:  Options{Signatures: &Signatures{Kids: []string{"first", "first"}}},
+			expected: ErrSignaturesDuplicateKid,
+		},
+		{
+			name:     "Compression",
+			options:  Options{CompressClaims: true, Signatures: &Signatures{Kids: []string{"first"}}},
+			expected: ErrSignaturesWithCompression,
+		},
+		{
+			name:     "Tenants",
+			options:  Options{Tenant: &Tenant{Header: "X-Tenant"}, Signatures: &Signatures{Kids: []string{"first"}}},
+			expected: ErrSignaturesWithTenants,
+		},
+		{
+			name:     "Algorithms",
+			options:  Options{Algorithms: &Algorithms{Header: "X-Alg"}, Signatures: &Signatures{Kids: []string{"first"}}},
+			expected: ErrSignaturesWithAlgorithms,
+		},
+		{
+			name:     "Rotation",
+			options:  Options{Key: key.Descriptor{RotateInterval: time.Hour}, Signatures: &Signatures{Kids: []string{"first"}}},
+			expected: ErrSignaturesWithRotation,
+		},
+		{
+			name: "Deterministic",
+			options: Options{
+				Alg:                     "ES256",
+				DeterministicSignatures: true,
+				Signatures:              &Signatures{Kids: []string{"second"}, Algs: map[string]string{"second": "RS256"}},
+			},
+			expected: ErrSignaturesDeterministicNotES,
+		},
+	}
+
+	for _, record := range testData {
+		t.Run(record.name, func(t *testing.T) {
+			registry := key.NewRegistry(rand.Reader)
+			_, err := registry.Register(key.Descriptor{Kid: "second", Type: key.KeyTypeECDSA})
+			require.NoError(t, err)
+
+			record.options.Key.Kid = "first"
+			if record.options.Alg == "ES256" {
+				record.options.Key.Type = key.KeyTypeECDSA
+				record.options.Key.Bits = 256
+			} else {
+				record.options.Key.Bits = 512
+			}
+
+			f, err := NewFactory(record.options, ClaimBuilders{requestClaimBuilder{}}, registry)
+			assert.Nil(t, f)
+			assert.Equal(t, record.expected, err)
+			assert.NotEmpty(t, err.Error())
+		})
+	}
+
+	_, err := NewFactory(
+		Options{Key: key.Descriptor{Kid: "first", Bits: 512}, Signatures: &Signatures{Kids: []string{"first"}, Algs: map[string]string{"first": "nosuch"}}},
+		ClaimBuilders{requestClaimBuilder{}},
+		key.NewRegistry(rand.Reader),
+	)
+
+	assert.Error(t, err)
+}
+
+func TestSignatures(t *testing.T) {
+	t.Run("Token", testSignaturesToken)
+	t.Run("RemovedKey", testSignaturesRemovedKey)
+	t.Run("Invalid", testSignaturesInvalid)
+}
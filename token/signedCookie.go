@@ -0,0 +1,181 @@
+package token
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrSignedCookieNameRequired   = errors.New("A signed cookie must have a name")
+	ErrSignedCookieSecretRequired = errors.New("A signed cookie must have a secret")
+)
+
+// SignedCookieError indicates that a signed cookie was missing, malformed, or failed verification.
+// This error produces a 401 response.
+type SignedCookieError struct {
+	Name   string
+	Reason string
+}
+
+func (sce SignedCookieError) Error() string {
+	return fmt.Sprintf("Invalid signed cookie %s: %s", sce.Name, sce.Reason)
+}
+
+func (sce SignedCookieError) StatusCode() int {
+	return http.StatusUnauthorized
+}
+
+// SignedCookie describes an HMAC-signed cookie whose fields are mapped into claims, for browser flows that use a
+// signed double-submit cookie to resist CSRF.  The cookie value is the base64url-encoded JSON object of fields, a
+// period, the expiry in seconds since the epoch, a period, and the base64url-encoded HMAC-SHA256 of everything
+// before the last period.  Since the expiry is signed, a captured cookie cannot be replayed once it expires.
+// SignCookieValue produces such values.
+type SignedCookie struct {
+	// Name is the name of the cookie, which is required
+	Name string
+
+	// Secret is the HMAC key, which is required
+	Secret string
+
+	// Claims maps each claim name onto the cookie field that supplies it.  If unset, every field of the cookie
+	// becomes a claim of the same name.  Fields that the cookie does not have are skipped.
+	Claims map[string]string
+
+	// Header is the optional HTTP header that must repeat the cookie value exactly.  Since a cross-site request
+	// cannot read the cookie, it cannot supply a matching header.
+	Header string
+
+	// Required indicates that token requests must send the cookie.  By default, a request without the cookie
+	// has none of its claims.  A cookie that is present but fails verification is always rejected.
+	Required bool
+}
+
+// SignCookieValue produces the value of a cookie holding the given fields, which expires at the given time,
+// signed with the given secret, in the form expected by a SignedCookie
+func SignCookieValue(secret []byte, fields map[string]interface{}, expires time.Time) (string, error) {
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(data) + "." + strconv.FormatInt(expires.Unix(), 10)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(cookieMAC(secret, payload)), nil
+}
+
+func cookieMAC(secret []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+type signedCookieRequestBuilder struct {
+	SignedCookie
+	secret []byte
+	header string
+	now    func() time.Time
+}
+
+// verify checks the signature and expiry of a cookie value and returns its decoded fields
+func (scrb signedCookieRequestBuilder) verify(value string) (map[string]interface{}, error) {
+	dot := strings.LastIndexByte(value, '.')
+	if dot < 0 {
+		return nil, SignedCookieError{Name: scrb.Name, Reason: "malformed value"}
+	}
+
+	payload := value[:dot]
+	signature, err := base64.RawURLEncoding.DecodeString(value[dot+1:])
+	if err != nil || !hmac.Equal(signature, cookieMAC(scrb.secret, payload)) {
+		return nil, SignedCookieError{Name: scrb.Name, Reason: "signature mismatch"}
+	}
+
+	dot = strings.IndexByte(payload, '.')
+	if dot < 0 {
+		return nil, SignedCookieError{Name: scrb.Name, Reason: "malformed value"}
+	}
+
+	expires, err := strconv.ParseInt(payload[dot+1:], 10, 64)
+	if err != nil {
+		return nil, SignedCookieError{Name: scrb.Name, Reason: "malformed value"}
+	}
+
+	if !scrb.now().Before(time.Unix(expires, 0)) {
+		return nil, SignedCookieError{Name: scrb.Name, Reason: "expired"}
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload[:dot])
+	if err != nil {
+		return nil, SignedCookieError{Name: scrb.Name, Reason: "malformed value"}
+	}
+
+	var fields map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&fields); err != nil {
+		return nil, SignedCookieError{Name: scrb.Name, Reason: "malformed value"}
+	}
+
+	return fields, nil
+}
+
+func (scrb signedCookieRequestBuilder) Build(original *http.Request, tr *Request) error {
+	c, err := original.Cookie(scrb.Name)
+	if err != nil || len(c.Value) == 0 {
+		if scrb.Required {
+			return SignedCookieError{Name: scrb.Name, Reason: "missing"}
+		}
+
+		return nil
+	}
+
+	fields, err := scrb.verify(c.Value)
+	if err != nil {
+		return err
+	}
+
+	if len(scrb.header) > 0 && subtle.ConstantTimeCompare([]byte(original.Header.Get(scrb.header)), []byte(c.Value)) != 1 {
+		return SignedCookieError{Name: scrb.Name, Reason: "header " + scrb.header + " does not match"}
+	}
+
+	if len(scrb.Claims) == 0 {
+		for name, v := range fields {
+			tr.Claims[name] = v
+		}
+
+		return nil
+	}
+
+	for claim, field := range scrb.Claims {
+		if v, ok := fields[field]; ok {
+			tr.Claims[claim] = v
+		}
+	}
+
+	return nil
+}
+
+func newSignedCookieRequestBuilder(sc SignedCookie, now func() time.Time) (RequestBuilder, error) {
+	if len(sc.Name) == 0 {
+		return nil, ErrSignedCookieNameRequired
+	}
+
+	if len(sc.Secret) == 0 {
+		return nil, ErrSignedCookieSecretRequired
+	}
+
+	return signedCookieRequestBuilder{
+		SignedCookie: sc,
+		secret:       []byte(sc.Secret),
+		header:       http.CanonicalHeaderKey(sc.Header),
+		now:          now,
+	}, nil
+}
@@ -0,0 +1,206 @@
+package token
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testCookieSecret  = []byte("cookie-secret")
+	testCookieExpires = time.Now().Add(time.Hour)
+)
+
+func newTestSignedCookieRequest(t *testing.T, value string) *http.Request {
+	request := httptest.NewRequest("POST", "/issue", nil)
+	if len(value) > 0 {
+		request.AddCookie(&http.Cookie{Name: "session", Value: value})
+	}
+
+	return request
+}
+
+func testSignedCookieValid(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	value, err := SignCookieValue(testCookieSecret, map[string]interface{}{"sub": "user-123", "tenant": "acme", "csrf": "abc"}, testCookieExpires)
+	require.NoError(err)
+
+	rb, err := NewRequestBuilders(Options{
+		SignedCookie: &SignedCookie{
+			Name:   "session",
+			Secret: string(testCookieSecret),
+			Claims: map[string]string{"sub": "sub", "org": "tenant", "missing": "nosuchfield"},
+		},
+	})
+
+	require.NoError(err)
+	tr, err := BuildRequest(newTestSignedCookieRequest(t, value), rb)
+	require.NoError(err)
+	assert.Equal(map[string]interface{}{"sub": "user-123", "org": "acme"}, tr.Claims)
+}
+
+func testSignedCookieAllFields(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	value, err := SignCookieValue(testCookieSecret, map[string]interface{}{"sub": "user-123", "level": 2}, testCookieExpires)
+	require.NoError(err)
+
+	builder, err := newSignedCookieRequestBuilder(SignedCookie{Name: "session", Secret: string(testCookieSecret)}, time.Now)
+	require.NoError(err)
+
+	tr := NewRequest()
+	require.NoError(builder.Build(newTestSignedCookieRequest(t, value), tr))
+	assert.Equal(map[string]interface{}{"sub": "user-123", "level": json.Number("2")}, tr.Claims)
+}
+
+func testSignedCookieTampered(t *testing.T) {
+	value, err := SignCookieValue(testCookieSecret, map[string]interface{}{"sub": "user-123"}, testCookieExpires)
+	require.NoError(t, err)
+
+	forged, err := SignCookieValue([]byte("attacker"), map[string]interface{}{"sub": "admin"}, testCookieExpires)
+	require.NoError(t, err)
+
+	var (
+		dot     = strings.IndexByte(value, '.')
+		last    = strings.LastIndexByte(value, '.')
+		extends = strconv.FormatInt(testCookieExpires.Add(24*time.Hour).Unix(), 10)
+	)
+
+	testData := map[string]string{
+		"WrongSecret":      forged,
+		"SwappedPayload":   forged[:strings.IndexByte(forged, '.')] + value[dot:],
+		"ExtendedExpiry":   value[:dot+1] + extends + value[last:],
+		"MissingExpiry":    value[:dot] + value[last:],
+		"MissingSignature": value[:dot],
+		"BadSignature":     value[:dot] + ".!!!",
+	}
+
+	builder, err := newSignedCookieRequestBuilder(SignedCookie{Name: "session", Secret: string(testCookieSecret)}, time.Now)
+	require.NoError(t, err)
+
+	for name, tampered := range testData {
+		t.Run(name, func(t *testing.T) {
+			var (
+				assert = assert.New(t)
+				tr     = NewRequest()
+			)
+
+			err := builder.Build(newTestSignedCookieRequest(t, tampered), tr)
+			require.Error(t, err)
+			assert.Equal(http.StatusUnauthorized, err.(SignedCookieError).StatusCode())
+			assert.Empty(tr.Claims)
+		})
+	}
+}
+
+func testSignedCookieExpired(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		now = time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	)
+
+	value, err := SignCookieValue(testCookieSecret, map[string]interface{}{"sub": "user-123"}, now.Add(time.Minute))
+	require.NoError(err)
+
+	builder, err := newSignedCookieRequestBuilder(
+		SignedCookie{Name: "session", Secret: string(testCookieSecret)},
+		func() time.Time { return now },
+	)
+
+	require.NoError(err)
+
+	tr := NewRequest()
+	assert.NoError(builder.Build(newTestSignedCookieRequest(t, value), tr))
+	assert.Equal("user-123", tr.Claims["sub"])
+
+	// the same cookie, captured and replayed after its signed expiry, is rejected
+	now = now.Add(time.Minute)
+	tr = NewRequest()
+	assert.Equal(
+		SignedCookieError{Name: "session", Reason: "expired"},
+		builder.Build(newTestSignedCookieRequest(t, value), tr),
+	)
+
+	assert.Empty(tr.Claims)
+}
+
+func testSignedCookieHeader(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	value, err := SignCookieValue(testCookieSecret, map[string]interface{}{"sub": "user-123"}, testCookieExpires)
+	require.NoError(err)
+
+	builder, err := newSignedCookieRequestBuilder(SignedCookie{Name: "session", Secret: string(testCookieSecret), Header: "x-csrf-token"}, time.Now)
+	require.NoError(err)
+
+	request := newTestSignedCookieRequest(t, value)
+	assert.Equal(
+		SignedCookieError{Name: "session", Reason: "header X-Csrf-Token does not match"},
+		builder.Build(request, NewRequest()),
+	)
+
+	request.Header.Set("X-CSRF-Token", value)
+	tr := NewRequest()
+	assert.NoError(builder.Build(request, tr))
+	assert.Equal("user-123", tr.Claims["sub"])
+}
+
+func testSignedCookieMissing(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	optional, err := newSignedCookieRequestBuilder(SignedCookie{Name: "session", Secret: "secret"}, time.Now)
+	require.NoError(err)
+
+	tr := NewRequest()
+	assert.NoError(optional.Build(newTestSignedCookieRequest(t, ""), tr))
+	assert.Empty(tr.Claims)
+
+	required, err := newSignedCookieRequestBuilder(SignedCookie{Name: "session", Secret: "secret", Required: true}, time.Now)
+	require.NoError(err)
+	assert.Equal(
+		SignedCookieError{Name: "session", Reason: "missing"},
+		required.Build(newTestSignedCookieRequest(t, ""), NewRequest()),
+	)
+}
+
+func testSignedCookieInvalidConfiguration(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewRequestBuilders(Options{SignedCookie: &SignedCookie{Secret: "secret"}})
+	assert.Equal(ErrSignedCookieNameRequired, err)
+
+	_, err = NewRequestBuilders(Options{SignedCookie: &SignedCookie{Name: "session"}})
+	assert.Equal(ErrSignedCookieSecretRequired, err)
+}
+
+func TestSignedCookie(t *testing.T) {
+	t.Run("Valid", testSignedCookieValid)
+	t.Run("AllFields", testSignedCookieAllFields)
+	t.Run("Tampered", testSignedCookieTampered)
+	t.Run("Expired", testSignedCookieExpired)
+	t.Run("Header", testSignedCookieHeader)
+	t.Run("Missing", testSignedCookieMissing)
+	t.Run("InvalidConfiguration", testSignedCookieInvalidConfiguration)
+}
@@ -0,0 +1,113 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/xmidt-org/themis/xhttp/xhttpserver"
+)
+
+var (
+	ErrSourcesNotAllowed = errors.New("Sources cannot be combined with a header, parameter, cookie, variable, server name, client IP, scheme, or body path")
+	ErrNestedSources     = errors.New("A source cannot itself have sources")
+)
+
+// MissingSourcesError is returned when a required value with Sources was supplied by none of them
+type MissingSourcesError struct {
+	Name string
+}
+
+func (mse MissingSourcesError) Error() string {
+	return fmt.Sprintf("None of the sources for %s supplied a value", mse.Name)
+}
+
+func (mse MissingSourcesError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// sourcesRequestBuilder tries each of an ordered list of RequestBuilders in turn, using the first
+// one that supplies a value
+type sourcesRequestBuilder struct {
+	key          string
+	sources      []RequestBuilder
+	required     bool
+	defaultValue interface{}
+	normalize    func(string) (string, error)
+	setter       func(string, interface{}, *Request)
+}
+
+func (srb sourcesRequestBuilder) Build(original *http.Request, tr *Request) error {
+	for _, source := range srb.sources {
+		candidate := NewRequest()
+		err := source.Build(original, candidate)
+		if _, ok := err.(xhttpserver.MissingVariableError); ok {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		value, ok := candidate.Claims[srb.key].(string)
+		if !ok || len(value) == 0 {
+			continue
+		}
+
+		value, ok, err = normalize(srb.normalize, srb.required, value)
+		if err != nil {
+			return err
+		} else if ok {
+			srb.setter(srb.key, value, tr)
+			return nil
+		}
+	}
+
+	if srb.defaultValue != nil {
+		srb.setter(srb.key, srb.defaultValue, tr)
+		return nil
+	}
+
+	if srb.required {
+		return MissingSourcesError{Name: srb.key}
+	}
+
+	return nil
+}
+
+// newSourcesRequestBuilder creates the RequestBuilder for a Value that is taken from the first of its Sources
+// that supplies anything.  Each source is an optional Value, and its own Capture and MAC are applied before
+// the source is considered to have supplied a value.
+func newSourcesRequestBuilder(name string, value Value, setter func(string, interface{}, *Request)) (RequestBuilder, error) {
+	if len(value.Header) > 0 || len(value.Parameter) > 0 || len(value.Cookie) > 0 || len(value.Variable) > 0 || value.ServerName || value.ClientIP || value.Scheme || len(value.Body) > 0 {
+		return nil, ErrSourcesNotAllowed
+	}
+
+	n, err := value.normalizer()
+	if err != nil {
+		return nil, err
+	}
+
+	srb := sourcesRequestBuilder{
+		key:          name,
+		required:     value.Required,
+		defaultValue: value.Value,
+		normalize:    n,
+		setter:       setter,
+	}
+
+	for _, source := range value.Sources {
+		if len(source.Sources) > 0 {
+			return nil, ErrNestedSources
+		}
+
+		// each source is optional on its own, since a later source may supply the value
+		source.Required = false
+		rb, err := newValueRequestBuilder(name, source, claimsSetter)
+		if err != nil {
+			return nil, err
+		} else if rb != nil {
+			srb.sources = append(srb.sources, rb)
+		}
+	}
+
+	return srb, nil
+}
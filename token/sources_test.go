@@ -0,0 +1,161 @@
+package token
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testSourcesFirstNonEmpty(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	rb, err := NewRequestBuilders(Options{
+		Claims: map[string]Value{
+			"deviceId": Value{
+				Sources: []Value{
+					{Header: "X-Device-Id"},
+					{Header: "X-Legacy-Device", Capture: &Capture{Pattern: "^device:(.+)$"}},
+					{Parameter: "device"},
+				},
+			},
+		},
+	})
+
+	require.NoError(err)
+
+	testData := []struct {
+		header   http.Header
+		query    string
+		expected string
+	}{
+		{
+			header:   http.Header{"X-Device-Id": {"first"}, "X-Legacy-Device": {"device:second"}},
+			query:    "device=third",
+			expected: "first",
+		},
+		{
+			header:   http.Header{"X-Device-Id": {""}, "X-Legacy-Device": {"device:second"}},
+			query:    "device=third",
+			expected: "second",
+		},
+		{
+			// the second source doesn't match its capture, so it doesn't supply anything
+			header:   http.Header{"X-Legacy-Device": {"nomatch"}},
+			query:    "device=third",
+			expected: "third",
+		},
+	}
+
+	for _, record := range testData {
+		request := httptest.NewRequest("GET", "/?"+record.query, nil)
+		request.Header = record.header
+		require.NoError(request.ParseForm())
+
+		tr, err := BuildRequest(request, rb)
+		require.NoError(err)
+		assert.Equal(record.expected, tr.Claims["deviceId"])
+	}
+}
+
+func testSourcesAllEmpty(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		sources = []Value{
+			{Header: "X-Device-Id"},
+			{Parameter: "device"},
+			{Variable: "device"},
+		}
+	)
+
+	rb, err := NewRequestBuilders(Options{
+		Claims: map[string]Value{
+			"omitted":   Value{Sources: sources},
+			"defaulted": Value{Sources: sources, Value: "unknown"},
+		},
+	})
+
+	require.NoError(err)
+
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set("X-Device-Id", "")
+	require.NoError(request.ParseForm())
+
+	tr, err := BuildRequest(request, rb)
+	require.NoError(err)
+	assert.NotContains(tr.Claims, "omitted")
+	assert.Equal("unknown", tr.Claims["defaulted"])
+}
+
+func testSourcesRequired(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	rb, err := NewRequestBuilders(Options{
+		Claims: map[string]Value{
+			"deviceId": Value{
+				Required: true,
+				Sources: []Value{
+					{Header: "X-Device-Id"},
+					{Parameter: "device"},
+				},
+			},
+		},
+	})
+
+	require.NoError(err)
+
+	request := httptest.NewRequest("GET", "/", nil)
+	require.NoError(request.ParseForm())
+
+	tr, err := BuildRequest(request, rb)
+	assert.Nil(tr)
+	require.Error(err)
+
+	var mse MissingSourcesError
+	require.True(errors.As(err, &mse))
+	assert.Equal("deviceId", mse.Name)
+	assert.Equal(http.StatusBadRequest, mse.StatusCode())
+}
+
+func testSourcesInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewRequestBuilders(Options{
+		Claims: map[string]Value{
+			"deviceId": Value{
+				Header:  "X-Device-Id",
+				Sources: []Value{{Parameter: "device"}},
+			},
+		},
+	})
+
+	assert.Equal(ErrSourcesNotAllowed, err)
+
+	_, err = NewRequestBuilders(Options{
+		Claims: map[string]Value{
+			"deviceId": Value{
+				Sources: []Value{{Sources: []Value{{Parameter: "device"}}}},
+			},
+		},
+	})
+
+	assert.Equal(ErrNestedSources, err)
+}
+
+func TestSources(t *testing.T) {
+	t.Run("FirstNonEmpty", testSourcesFirstNonEmpty)
+	t.Run("AllEmpty", testSourcesAllEmpty)
+	t.Run("Required", testSourcesRequired)
+	t.Run("Invalid", testSourcesInvalid)
+}
@@ -0,0 +1,68 @@
+package token
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// NoClaimsError is returned in strict mode when a token request supplied none of the claims
+// that are configured to come from the HTTP request
+type NoClaimsError struct {
+	Claims []string
+}
+
+func (nce NoClaimsError) Error() string {
+	return fmt.Sprintf("None of the claims [%s] were supplied", strings.Join(nce.Claims, ", "))
+}
+
+func (nce NoClaimsError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// strictRequestBuilder rejects token requests in which none of a set of claims was populated.  It must
+// run after every other RequestBuilder that sets those claims.
+type strictRequestBuilder struct {
+	claims []string
+}
+
+func (srb strictRequestBuilder) Build(_ *http.Request, tr *Request) error {
+	for _, name := range srb.claims {
+		if _, ok := tr.Claims[name]; ok {
+			return nil
+		}
+	}
+
+	return NoClaimsError{Claims: srb.claims}
+}
+
+// newStrictRequestBuilder creates the strict mode RequestBuilder for the request-derived claims in the given
+// options.  If no claims come from the HTTP request, there is nothing to enforce and this function returns nil.
+func newStrictRequestBuilder(o Options) RequestBuilder {
+	var claims []string
+	for name, value := range o.Claims {
+		if value.fromRequest() {
+			claims = append(claims, name)
+		}
+	}
+
+	if o.PartnerID != nil && len(o.PartnerID.Claim) > 0 {
+		claims = append(claims, o.PartnerID.Claim)
+	}
+
+	if o.BasicAuth != nil {
+		if len(o.BasicAuth.Claim) > 0 {
+			claims = append(claims, o.BasicAuth.Claim)
+		} else {
+			claims = append(claims, DefaultBasicAuthClaim)
+		}
+	}
+
+	if len(claims) == 0 {
+		return nil
+	}
+
+	sort.Strings(claims)
+	return strictRequestBuilder{claims: claims}
+}
@@ -0,0 +1,128 @@
+package token
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNoClaimsError(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		err error = NoClaimsError{Claims: []string{"mac", "serial"}}
+	)
+
+	assert.Contains(err.Error(), "mac, serial")
+	assert.Equal(http.StatusBadRequest, err.(NoClaimsError).StatusCode())
+}
+
+func newStrictTestOptions(strict bool) Options {
+	return Options{
+		Strict: strict,
+		Claims: map[string]Value{
+			"static": Value{Value: "always present"},
+			"mac":    Value{Header: "X-Mac"},
+			"serial": Value{Parameter: "serial"},
+		},
+		PartnerID: &PartnerID{
+			Claim:  "partner-id",
+			Header: "X-Partner-ID",
+		},
+	}
+}
+
+func testStrictRejectsEmpty(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		rb, err = NewRequestBuilders(newStrictTestOptions(true))
+	)
+
+	require.NoError(err)
+	tr, err := BuildRequest(httptest.NewRequest("GET", "/", nil), rb)
+	assert.Nil(tr)
+	require.Error(err)
+	assert.Equal(http.StatusBadRequest, err.(BuildError).StatusCode())
+	assert.Equal(NoClaimsError{Claims: []string{"mac", "partner-id", "serial"}}, err.(BuildError).Unwrap())
+}
+
+func testStrictAllowsAny(t *testing.T, request *http.Request, expectedClaim string) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		rb, err = NewRequestBuilders(newStrictTestOptions(true))
+	)
+
+	require.NoError(err)
+	tr, err := BuildRequest(request, rb)
+	require.NoError(err)
+	require.NotNil(tr)
+	assert.Contains(tr.Claims, expectedClaim)
+}
+
+func testStrictPermissive(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		rb, err = NewRequestBuilders(newStrictTestOptions(false))
+	)
+
+	require.NoError(err)
+	tr, err := BuildRequest(httptest.NewRequest("GET", "/", nil), rb)
+	require.NoError(err)
+	require.NotNil(tr)
+	assert.Empty(tr.Claims)
+}
+
+func testStrictNoRequestClaims(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		rb, err = NewRequestBuilders(Options{
+			Strict: true,
+			Claims: map[string]Value{
+				"static": Value{Value: "always present"},
+			},
+		})
+	)
+
+	require.NoError(err)
+	assert.Empty(rb)
+
+	tr, err := BuildRequest(httptest.NewRequest("GET", "/", nil), rb)
+	assert.NoError(err)
+	assert.NotNil(tr)
+}
+
+func TestStrict(t *testing.T) {
+	t.Run("RejectsEmpty", testStrictRejectsEmpty)
+
+	t.Run("Header", func(t *testing.T) {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.Header.Set("X-Mac", "112233aabbcc")
+		testStrictAllowsAny(t, request, "mac")
+	})
+
+	t.Run("Parameter", func(t *testing.T) {
+		request := httptest.NewRequest("GET", "/?serial=1234", nil)
+		require.NoError(t, request.ParseForm())
+		testStrictAllowsAny(t, request, "serial")
+	})
+
+	t.Run("PartnerID", func(t *testing.T) {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.Header.Set("X-Partner-ID", "comcast")
+		testStrictAllowsAny(t, request, "partner-id")
+	})
+
+	t.Run("Permissive", testStrictPermissive)
+	t.Run("NoRequestClaims", testStrictNoRequestClaims)
+}
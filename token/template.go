@@ -0,0 +1,158 @@
+package token
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"text/template"
+
+	"github.com/xmidt-org/themis/config"
+	"github.com/xmidt-org/themis/xlog"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// InvalidTemplateError indicates that a claim template could not be parsed
+type InvalidTemplateError struct {
+	Claim string
+	Err   error
+}
+
+func (ite InvalidTemplateError) Error() string {
+	return fmt.Sprintf("Invalid template for claim %s: %s", ite.Claim, ite.Err)
+}
+
+func (ite InvalidTemplateError) Unwrap() error {
+	return ite.Err
+}
+
+// TemplateClaimError is returned when a claim template cannot be rendered for a token request, typically
+// because the request did not supply a claim the template refers to
+type TemplateClaimError struct {
+	Claim string
+	Err   error
+}
+
+func (tce TemplateClaimError) Error() string {
+	return fmt.Sprintf("Unable to render template for claim %s: %s", tce.Claim, tce.Err)
+}
+
+func (tce TemplateClaimError) Unwrap() error {
+	return tce.Err
+}
+
+func (tce TemplateClaimError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// compileTemplates parses every claim template.  If any template is invalid, no templates are returned.
+func compileTemplates(src map[string]string) (map[string]*template.Template, error) {
+	names := make([]string, 0, len(src))
+	for name := range src {
+		names = append(names, name)
+	}
+
+	// sort so that the same invalid configuration always reports the same error
+	sort.Strings(names)
+	compiled := make(map[string]*template.Template, len(src))
+	for _, name := range names {
+		t, err := template.New(name).Option("missingkey=error").Parse(src[name])
+		if err != nil {
+			return nil, InvalidTemplateError{Claim: name, Err: err}
+		}
+
+		compiled[name] = t
+	}
+
+	return compiled, nil
+}
+
+// templateClaimBuilder renders string claims from text/template templates, using the claims built so far as
+// the template data.  The compiled templates are swapped atomically, so a reload never affects a token request
+// in progress.
+type templateClaimBuilder struct {
+	templates atomic.Value
+}
+
+func newTemplateClaimBuilder(src map[string]string) (*templateClaimBuilder, error) {
+	tcb := new(templateClaimBuilder)
+	if err := tcb.update(src); err != nil {
+		return nil, err
+	}
+
+	return tcb, nil
+}
+
+// update compiles a new set of templates and, only if every one is valid, replaces the current set with it
+func (tcb *templateClaimBuilder) update(src map[string]string) error {
+	compiled, err := compileTemplates(src)
+	if err != nil {
+		return err
+	}
+
+	tcb.templates.Store(compiled)
+	return nil
+}
+
+func (tcb *templateClaimBuilder) AddClaims(_ context.Context, _ *Request, target map[string]interface{}) error {
+	var (
+		templates = tcb.templates.Load().(map[string]*template.Template)
+		rendered  = make(map[string]interface{}, len(templates))
+		output    bytes.Buffer
+	)
+
+	// every template sees the same claims, regardless of the order in which templates are rendered
+	for name, t := range templates {
+		output.Reset()
+		if err := t.Execute(&output, target); err != nil {
+			return TemplateClaimError{Claim: name, Err: err}
+		}
+
+		rendered[name] = output.String()
+	}
+
+	for name, v := range rendered {
+		target[name] = v
+	}
+
+	return nil
+}
+
+// reloadable produces the Reloadable that rereads the templates under the given configuration key.  Invalid
+// templates are logged and rejected, and the previous templates stay in use.
+func (tcb *templateClaimBuilder) reloadable(configKey string, logger log.Logger) config.Reloadable {
+	if logger == nil {
+		logger = xlog.Default()
+	}
+
+	return config.ReloadableFunc(func(u config.Unmarshaller) error {
+		var src map[string]string
+		if err := u.UnmarshalKey(configKey, &src); err != nil {
+			return err
+		}
+
+		if err := tcb.update(src); err != nil {
+			logger.Log(
+				level.Key(), level.ErrorValue(),
+				xlog.MessageKey(), "rejected claim templates, keeping the previous templates",
+				"key", configKey,
+				xlog.ErrorKey(), err,
+			)
+
+			return err
+		}
+
+		logger.Log(
+			level.Key(), level.InfoValue(),
+			xlog.MessageKey(), "reloaded claim templates",
+			"key", configKey,
+			"count", len(src),
+		)
+
+		return nil
+	})
+}
@@ -0,0 +1,211 @@
+package token
+
+import (
+	"context"
+	"testing"
+
+	"github.com/xmidt-org/themis/config"
+	"github.com/xmidt-org/themis/key"
+	"github.com/xmidt-org/themis/xlog"
+
+	"github.com/go-kit/kit/log"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+func testTemplateClaimBuilder(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	tcb, err := newTemplateClaimBuilder(map[string]string{
+		"principal": "{{.sub}}@{{.region}}",
+		"sub":       "device-{{.sub}}",
+	})
+
+	require.NoError(err)
+	claims := map[string]interface{}{"sub": "abc", "region": "east"}
+	require.NoError(tcb.AddClaims(context.Background(), NewRequest(), claims))
+
+	// templates see the claims as they were before any template was rendered
+	assert.Equal(
+		map[string]interface{}{"sub": "device-abc", "region": "east", "principal": "abc@east"},
+		claims,
+	)
+
+	err = tcb.AddClaims(context.Background(), NewRequest(), map[string]interface{}{"sub": "abc"})
+	require.IsType(TemplateClaimError{}, err)
+	assert.Equal("principal", err.(TemplateClaimError).Claim)
+	assert.Equal(400, err.(TemplateClaimError).StatusCode())
+	assert.NotNil(err.(TemplateClaimError).Unwrap())
+	assert.NotEmpty(err.Error())
+}
+
+func testTemplateClaimBuilderInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	tcb, err := newTemplateClaimBuilder(map[string]string{
+		"good": "{{.sub}}",
+		"bad":  "{{.sub",
+	})
+
+	assert.Nil(tcb)
+	require.IsType(t, InvalidTemplateError{}, err)
+	assert.Equal("bad", err.(InvalidTemplateError).Claim)
+	assert.NotNil(err.(InvalidTemplateError).Unwrap())
+	assert.NotEmpty(err.Error())
+}
+
+func testTemplateClaimBuilderReload(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		v        = viper.New()
+		reloader = config.NewReloader(nil, config.ViperUnmarshaller{Viper: v})
+	)
+
+	tcb, err := newTemplateClaimBuilder(map[string]string{"principal": "{{.sub}}"})
+	require.NoError(err)
+	reloader.Register(tcb.reloadable("token.templates", log.NewNopLogger()))
+
+	render := func() map[string]interface{} {
+		claims := map[string]interface{}{"sub": "abc"}
+		require.NoError(tcb.AddClaims(context.Background(), NewRequest(), claims))
+		return claims
+	}
+
+	// an invalid template is rejected, and the previous templates stay in use
+	v.Set("token.templates", map[string]string{"principal": "{{.sub", "other": "{{.sub}}"})
+	errs := reloader.Reload()
+	require.Len(errs, 1)
+	assert.IsType(InvalidTemplateError{}, errs[0])
+	assert.Equal(map[string]interface{}{"sub": "abc", "principal": "abc"}, render())
+
+	// a valid template set replaces the previous one entirely
+	v.Set("token.templates", map[string]string{"other": "user:{{.sub}}"})
+	assert.Empty(reloader.Reload())
+	assert.Equal(map[string]interface{}{"sub": "abc", "other": "user:abc"}, render())
+}
+
+func testTemplateUnmarshal(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		v        *viper.Viper
+		reloader *config.Reloader
+		cb       ClaimBuilder
+		app      = fxtest.New(t,
+			fx.Logger(xlog.DiscardPrinter{}),
+			fx.Provide(
+				config.ProvideViper(
+					config.Json(`
+						{
+							"token": {
+								"key": {
+									"kid": "test",
+									"bits": 512
+								},
+								"templates": {
+									"principal": "{{.sub}}"
+								}
+							}
+						}
+					`),
+				),
+				func(u config.Unmarshaller) *config.Reloader {
+					return config.NewReloader(nil, u)
+				},
+				func() key.Registry { return key.NewRegistry(nil) },
+				Unmarshal("token"),
+			),
+			fx.Populate(&v, &reloader, &cb),
+		)
+	)
+
+	app.RequireStart()
+	defer app.RequireStop()
+
+	claims := func() map[string]interface{} {
+		r := NewRequest()
+		r.Claims["sub"] = "abc"
+		target := make(map[string]interface{})
+		require.NoError(cb.AddClaims(context.Background(), r, target))
+		return target
+	}
+
+	assert.Equal("abc", claims()["principal"])
+
+	v.Set("token.templates", map[string]string{"principal": "{{.sub"})
+	assert.Len(reloader.Reload(), 1)
+	assert.Equal("abc", claims()["principal"])
+
+	v.Set("token.templates", map[string]string{"principal": "device-{{.sub}}"})
+	assert.Empty(reloader.Reload())
+	assert.Equal("device-abc", claims()["principal"])
+}
+
+func testTemplateUnmarshalAdded(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		v        *viper.Viper
+		reloader *config.Reloader
+		cb       ClaimBuilder
+		app      = fxtest.New(t,
+			fx.Logger(xlog.DiscardPrinter{}),
+			fx.Provide(
+				config.ProvideViper(
+					config.Json(`
+						{
+							"token": {
+								"key": {
+									"kid": "test",
+									"bits": 512
+								}
+							}
+						}
+					`),
+				),
+				func(u config.Unmarshaller) *config.Reloader {
+					return config.NewReloader(nil, u)
+				},
+				func() key.Registry { return key.NewRegistry(nil) },
+				Unmarshal("token"),
+			),
+			fx.Populate(&v, &reloader, &cb),
+		)
+	)
+
+	app.RequireStart()
+	defer app.RequireStop()
+
+	claims := func() map[string]interface{} {
+		r := NewRequest()
+		r.Claims["sub"] = "abc"
+		target := make(map[string]interface{})
+		require.NoError(cb.AddClaims(context.Background(), r, target))
+		return target
+	}
+
+	assert.NotContains(claims(), "principal")
+
+	// templates added after startup take effect on reload
+	v.Set("token.templates", map[string]string{"principal": "device-{{.sub}}"})
+	assert.Empty(reloader.Reload())
+	assert.Equal("device-abc", claims()["principal"])
+}
+
+func TestTemplate(t *testing.T) {
+	t.Run("ClaimBuilder", testTemplateClaimBuilder)
+	t.Run("Invalid", testTemplateClaimBuilderInvalid)
+	t.Run("Reload", testTemplateClaimBuilderReload)
+	t.Run("Unmarshal", testTemplateUnmarshal)
+	t.Run("UnmarshalAdded", testTemplateUnmarshalAdded)
+}
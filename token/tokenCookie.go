@@ -0,0 +1,145 @@
+package token
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+// DefaultTokenCookieName is the name of the cookie holding an issued token when none is configured
+const DefaultTokenCookieName = "themis_token"
+
+var (
+	ErrSameSiteNoneRequiresSecure = errors.New("A token cookie with SameSite=None must be Secure")
+)
+
+// InvalidTokenCookieError indicates that the configured token cookie name or SameSite mode is not valid
+type InvalidTokenCookieError struct {
+	Field string
+	Value string
+}
+
+func (itce InvalidTokenCookieError) Error() string {
+	return fmt.Sprintf("Invalid token cookie %s: %s", itce.Field, itce.Value)
+}
+
+// TokenCookie describes how an issued token is delivered in a Set-Cookie header rather than the response body,
+// for browser-based flows.  The cookie is HttpOnly and Secure, with SameSite=Strict, unless configured otherwise.
+// Its Expires and Max-Age attributes are derived from the token's exp claim, so the browser discards the cookie
+// when the token expires.  A token without an exp claim produces a session cookie.  The response has no body.
+type TokenCookie struct {
+	// Name is the cookie name.  If unset, DefaultTokenCookieName is used.
+	Name string
+
+	// Domain is the optional Domain attribute of the cookie
+	Domain string
+
+	// Path is the Path attribute of the cookie.  If unset, the cookie applies to every path.
+	Path string
+
+	// SameSite is one of strict, lax, or none.  If unset, strict is used.  None requires a Secure cookie.
+	SameSite string
+
+	// DisableSecure allows the cookie to be sent over plain HTTP, which should only be done in development
+	DisableSecure bool
+
+	// DisableHTTPOnly allows scripts in the browser to read the cookie
+	DisableHTTPOnly bool
+}
+
+// parseSameSite converts the configured SameSite text into its net/http mode
+func parseSameSite(v string) (http.SameSite, error) {
+	switch strings.ToLower(v) {
+	case "", "strict":
+		return http.SameSiteStrictMode, nil
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	default:
+		return http.SameSiteDefaultMode, InvalidTokenCookieError{Field: "sameSite", Value: v}
+	}
+}
+
+// numericClaim returns the integer value of a time claim decoded by decodeUnverified
+func numericClaim(claims map[string]interface{}, name string) (int64, bool) {
+	n, ok := claims[name].(json.Number)
+	if !ok {
+		return 0, false
+	}
+
+	v, err := n.Int64()
+	return v, err == nil
+}
+
+// newEncoder validates this cookie configuration and returns the encoder that writes issued tokens as cookies
+func (tc TokenCookie) newEncoder(now func() time.Time) (kithttp.EncodeResponseFunc, error) {
+	name := tc.Name
+	if len(name) == 0 {
+		name = DefaultTokenCookieName
+	}
+
+	if strings.ContainsAny(name, "()<>@,;:\\\"/[]?={} \t\r\n") {
+		return nil, InvalidTokenCookieError{Field: "name", Value: name}
+	}
+
+	sameSite, err := parseSameSite(tc.SameSite)
+	if err != nil {
+		return nil, err
+	}
+
+	if sameSite == http.SameSiteNoneMode && tc.DisableSecure {
+		return nil, ErrSameSiteNoneRequiresSecure
+	}
+
+	path := tc.Path
+	if len(path) == 0 {
+		path = "/"
+	}
+
+	return func(_ context.Context, response http.ResponseWriter, value interface{}) error {
+		signed := value.(string)
+		_, claims, err := decodeUnverified(signed)
+		if err != nil {
+			return err
+		}
+
+		cookie := &http.Cookie{
+			Name:     name,
+			Value:    signed,
+			Path:     path,
+			Domain:   tc.Domain,
+			Secure:   !tc.DisableSecure,
+			HttpOnly: !tc.DisableHTTPOnly,
+			SameSite: sameSite,
+		}
+
+		if exp, ok := numericClaim(claims, "exp"); ok {
+			cookie.Expires = time.Unix(exp, 0).UTC()
+
+			// the token's own iat is preferred, so that the lifetime matches the token exactly
+			var maxAge int64
+			if iat, ok := numericClaim(claims, "iat"); ok {
+				maxAge = exp - iat
+			} else {
+				maxAge = exp - now().Unix()
+			}
+
+			if maxAge > 0 {
+				cookie.MaxAge = int(maxAge)
+			} else {
+				cookie.MaxAge = -1
+			}
+		}
+
+		http.SetCookie(response, cookie)
+		response.WriteHeader(http.StatusNoContent)
+		return nil
+	}, nil
+}
@@ -0,0 +1,163 @@
+package token
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xmidt-org/themis/key"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testTokenCookieDefaults(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		handler = newTestResponseHeadersHandler(t, Options{
+			Key:      key.Descriptor{Kid: "cookie", Bits: 512},
+			Duration: 15 * time.Minute,
+			Issue:    Issue{Cookie: &TokenCookie{}},
+		})
+
+		response = httptest.NewRecorder()
+	)
+
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/issue", nil))
+	require.Equal(http.StatusNoContent, response.Code)
+	assert.Empty(response.Body.String())
+
+	setCookie := response.Header().Get("Set-Cookie")
+	for _, attribute := range []string{"Path=/", "Max-Age=900", "HttpOnly", "Secure", "SameSite=Strict"} {
+		assert.Contains(setCookie, attribute)
+	}
+
+	cookies := response.Result().Cookies()
+	require.Len(cookies, 1)
+	assert.Equal(DefaultTokenCookieName, cookies[0].Name)
+
+	_, claims, err := decodeUnverified(cookies[0].Value)
+	require.NoError(err)
+	exp, ok := numericClaim(claims, "exp")
+	require.True(ok)
+	assert.Equal(time.Unix(exp, 0).UTC(), cookies[0].Expires)
+	assert.Equal(900, cookies[0].MaxAge)
+	assert.True(cookies[0].HttpOnly)
+	assert.True(cookies[0].Secure)
+	assert.Equal(http.SameSiteStrictMode, cookies[0].SameSite)
+}
+
+func testTokenCookieConfigured(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		handler = newTestResponseHeadersHandler(t, Options{
+			Key:      key.Descriptor{Kid: "cookie", Bits: 512},
+			Duration: time.Hour,
+			Issue: Issue{
+				Cookie: &TokenCookie{
+					Name:            "session",
+					Domain:          "example.com",
+					Path:            "/app",
+					SameSite:        "Lax",
+					DisableHTTPOnly: true,
+				},
+			},
+		})
+
+		response = httptest.NewRecorder()
+	)
+
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/issue", nil))
+	require.Equal(http.StatusNoContent, response.Code)
+
+	cookies := response.Result().Cookies()
+	require.Len(cookies, 1)
+	assert.Equal("session", cookies[0].Name)
+	assert.Equal(3, strings.Count(cookies[0].Value, ".")+1)
+	assert.Equal("example.com", cookies[0].Domain)
+	assert.Equal("/app", cookies[0].Path)
+	assert.Equal(3600, cookies[0].MaxAge)
+	assert.False(cookies[0].HttpOnly)
+	assert.True(cookies[0].Secure)
+	assert.Equal(http.SameSiteLaxMode, cookies[0].SameSite)
+}
+
+func testTokenCookieSession(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		handler = newTestResponseHeadersHandler(t, Options{
+			Key:         key.Descriptor{Kid: "cookie", Bits: 512},
+			DisableTime: true,
+			Issue:       Issue{Cookie: &TokenCookie{}},
+		})
+
+		response = httptest.NewRecorder()
+	)
+
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/issue", nil))
+	require.Equal(http.StatusNoContent, response.Code)
+
+	setCookie := response.Header().Get("Set-Cookie")
+	assert.NotContains(setCookie, "Max-Age")
+	assert.NotContains(setCookie, "Expires")
+}
+
+func testTokenCookieInvalid(t *testing.T) {
+	testData := []struct {
+		name     string
+		cookie   TokenCookie
+		expected error
+	}{
+		{"Name", TokenCookie{Name: "bad name"}, InvalidTokenCookieError{Field: "name", Value: "bad name"}},
+		{"SameSite", TokenCookie{SameSite: "sometimes"}, InvalidTokenCookieError{Field: "sameSite", Value: "sometimes"}},
+		{"NoneInsecure", TokenCookie{SameSite: "none", DisableSecure: true}, ErrSameSiteNoneRequiresSecure},
+	}
+
+	for _, record := range testData {
+		t.Run(record.name, func(t *testing.T) {
+			handler, err := Issue{Cookie: &record.cookie}.NewHandler(NewIssueEndpoint(nil), RequestBuilders{})
+			assert.Nil(t, handler)
+			assert.Equal(t, record.expected, err)
+		})
+	}
+}
+
+func testTokenCookieClock(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		now      = time.Date(2020, 10, 14, 12, 0, 0, 0, time.UTC)
+		response = httptest.NewRecorder()
+	)
+
+	encoder, err := TokenCookie{}.newEncoder(func() time.Time { return now })
+	require.NoError(err)
+
+	// without an iat, the cookie's lifetime is measured from the supplied clock
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"exp": now.Add(10 * time.Minute).Unix()}).SignedString([]byte("key"))
+	require.NoError(err)
+	require.NoError(encoder(context.Background(), response, signed))
+
+	cookies := response.Result().Cookies()
+	require.Len(cookies, 1)
+	assert.Equal(600, cookies[0].MaxAge)
+}
+
+func TestTokenCookie(t *testing.T) {
+	t.Run("Defaults", testTokenCookieDefaults)
+	t.Run("Configured", testTokenCookieConfigured)
+	t.Run("Session", testTokenCookieSession)
+	t.Run("Clock", testTokenCookieClock)
+	t.Run("Invalid", testTokenCookieInvalid)
+}
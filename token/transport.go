@@ -18,7 +18,8 @@ import (
 )
 
 var (
-	ErrVariableNotAllowed = errors.New("Either header/parameter or variable can specified, but not all three")
+	ErrVariableNotAllowed   = errors.New("Either header/parameter/cookie or variable can specified, but not both")
+	ErrTenantSourceRequired = errors.New("A tenant header, parameter, or server name is required")
 )
 
 // InvalidPartnerIDError is the error object returned when a blank, wildcard, or otherwise
@@ -68,6 +69,25 @@ func (be BuildError) StatusCode() int {
 	return statusCode
 }
 
+// Headers returns the merged headers of any embedded errors that supply them, such as
+// an authentication challenge.  If no embedded error has headers, this method returns nil.
+func (be BuildError) Headers() http.Header {
+	var headers http.Header
+	for _, err := range multierr.Errors(be.Err) {
+		if h, ok := err.(kithttp.Headerer); ok {
+			if headers == nil {
+				headers = make(http.Header)
+			}
+
+			for k, values := range h.Headers() {
+				headers[k] = append(headers[k], values...)
+			}
+		}
+	}
+
+	return headers
+}
+
 // RequestBuilder is a strategy for building a token factory Request from an HTTP request.
 //
 // Note: before invoking a RequestBuilder, calling code should parse the HTTP request form.
@@ -106,27 +126,122 @@ func metadataSetter(key string, value interface{}, tr *Request) {
 	tr.Metadata[key] = value
 }
 
+// normalizer returns the strategy for transforming a request-derived value, or nil if the value is used as is.
+// A Capture is applied before any MAC normalization.
+func (v Value) normalizer() (func(string) (string, error), error) {
+	var transforms []func(string) (string, error)
+	if v.Capture != nil {
+		t, err := v.Capture.NewTransform()
+		if err != nil {
+			return nil, err
+		}
+
+		transforms = append(transforms, t)
+	}
+
+	if v.MAC != nil {
+		transforms = append(transforms, v.MAC.Normalize)
+	}
+
+	switch len(transforms) {
+	case 0:
+		return nil, nil
+	case 1:
+		return transforms[0], nil
+	default:
+		return func(value string) (string, error) {
+			var err error
+			for _, t := range transforms {
+				if value, err = t(value); err != nil {
+					return "", err
+				}
+			}
+
+			return value, nil
+		}, nil
+	}
+}
+
+// normalize applies a normalizer to a value.  A value that does not match a Capture pattern is
+// omitted, rather than rejected, unless it is required.
+func normalize(n func(string) (string, error), required bool, value string) (string, bool, error) {
+	if n == nil {
+		return value, true, nil
+	}
+
+	value, err := n(value)
+	if _, ok := err.(NoMatchError); ok && !required {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+
+	return value, true, nil
+}
+
 type headerParameterRequestBuilder struct {
-	key       string
-	header    string
-	parameter string
-	setter    func(string, interface{}, *Request)
+	key        string
+	header     string
+	parameter  string
+	cookie     string
+	serverName bool
+	clientIP   bool
+	scheme     bool
+	required   bool
+	normalize  func(string) (string, error)
+	setter     func(string, interface{}, *Request)
+}
+
+func (hprb headerParameterRequestBuilder) set(value string, tr *Request) error {
+	value, ok, err := normalize(hprb.normalize, hprb.required, value)
+	if ok {
+		hprb.setter(hprb.key, value, tr)
+	}
+
+	return err
 }
 
 func (hprb headerParameterRequestBuilder) Build(original *http.Request, tr *Request) error {
 	if len(hprb.header) > 0 {
 		value := original.Header[hprb.header]
 		if len(value) > 0 {
-			hprb.setter(hprb.key, value[0], tr)
-			return nil
+			return hprb.set(value[0], tr)
 		}
 	}
 
 	if len(hprb.parameter) > 0 {
 		value := original.Form[hprb.parameter]
 		if len(value) > 0 {
-			hprb.setter(hprb.key, value[0], tr)
-			return nil
+			return hprb.set(value[0], tr)
+		}
+	}
+
+	if len(hprb.cookie) > 0 {
+		if c, err := original.Cookie(hprb.cookie); err == nil && len(c.Value) > 0 {
+			return hprb.set(c.Value, tr)
+		}
+	}
+
+	if hprb.serverName && original.TLS != nil && len(original.TLS.ServerName) > 0 {
+		return hprb.set(original.TLS.ServerName, tr)
+	}
+
+	if hprb.clientIP {
+		if clientIP := xhttpserver.ClientIP(original); len(clientIP) > 0 {
+			return hprb.set(clientIP, tr)
+		}
+	}
+
+	if hprb.scheme {
+		return hprb.set(xhttpserver.Scheme(original), tr)
+	}
+
+	if hprb.required {
+		return xhttpserver.MissingValueError{
+			Header:     hprb.header,
+			Parameter:  hprb.parameter,
+			Cookie:     hprb.cookie,
+			ServerName: hprb.serverName,
 		}
 	}
 
@@ -134,16 +249,22 @@ func (hprb headerParameterRequestBuilder) Build(original *http.Request, tr *Requ
 }
 
 type variableRequestBuilder struct {
-	key      string
-	variable string
-	setter   func(string, interface{}, *Request)
+	key       string
+	variable  string
+	required  bool
+	normalize func(string) (string, error)
+	setter    func(string, interface{}, *Request)
 }
 
 func (vrb variableRequestBuilder) Build(original *http.Request, tr *Request) error {
 	value := mux.Vars(original)[vrb.variable]
 	if len(value) > 0 {
-		vrb.setter(vrb.key, value, tr)
-		return nil
+		value, ok, err := normalize(vrb.normalize, vrb.required, value)
+		if ok {
+			vrb.setter(vrb.key, value, tr)
+		}
+
+		return err
 	}
 
 	return xhttpserver.MissingVariableError{Variable: vrb.variable}
@@ -204,59 +325,129 @@ func (prb partnerIDRequestBuilder) Build(original *http.Request, tr *Request) er
 	return nil
 }
 
+// newValueRequestBuilder creates the RequestBuilder for a single claim or metadata Value.  If the Value
+// is not taken from the HTTP request, this function returns nil.
+func newValueRequestBuilder(name string, value Value, setter func(string, interface{}, *Request)) (RequestBuilder, error) {
+	if !value.fromRequest() {
+		return nil, nil
+	}
+
+	if len(value.Env) > 0 {
+		return nil, ErrEnvNotAllowed
+	}
+
+	if len(value.Sources) > 0 {
+		return newSourcesRequestBuilder(name, value, setter)
+	}
+
+	if len(value.Body) > 0 {
+		return newBodyRequestBuilder(name, value, setter)
+	}
+
+	if len(value.Variable) > 0 && (len(value.Header) > 0 || len(value.Parameter) > 0 || len(value.Cookie) > 0 || value.ServerName || value.ClientIP || value.Scheme) {
+		return nil, ErrVariableNotAllowed
+	}
+
+	n, err := value.normalizer()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(value.Variable) > 0 {
+		return variableRequestBuilder{
+			key:       name,
+			variable:  value.Variable,
+			required:  value.Required,
+			normalize: n,
+			setter:    setter,
+		}, nil
+	}
+
+	return headerParameterRequestBuilder{
+		key:        name,
+		header:     http.CanonicalHeaderKey(value.Header),
+		parameter:  value.Parameter,
+		cookie:     value.Cookie,
+		serverName: value.ServerName,
+		clientIP:   value.ClientIP,
+		scheme:     value.Scheme,
+		required:   value.Required,
+		normalize:  n,
+		setter:     setter,
+	}, nil
+}
+
 // NewRequestBuilders creates a RequestBuilders sequence given an Options configuration.  Only claims
 // and metadata that are HTTP-based are included in the results.  Claims and metadata that are statically
 // assigned values are handled by ClaimBuilder objects and are part of the Factory configuration.
 func NewRequestBuilders(o Options) (RequestBuilders, error) {
 	var rb RequestBuilders
-	for name, value := range o.Claims {
-		if len(value.Header) > 0 || len(value.Parameter) > 0 {
-			if len(value.Variable) > 0 {
-				return nil, ErrVariableNotAllowed
-			}
+	if o.GRPCMetadata != nil {
+		gmrb, err := newGRPCMetadataRequestBuilder(o)
+		if err != nil {
+			return nil, err
+		}
+
+		rb = append(rb, gmrb)
+	}
 
-			rb = append(rb,
-				headerParameterRequestBuilder{
-					key:       name,
-					header:    http.CanonicalHeaderKey(value.Header),
-					parameter: value.Parameter,
-					setter:    claimsSetter,
-				},
-			)
-		} else if len(value.Variable) > 0 {
-			rb = append(rb,
-				variableRequestBuilder{
-					key:      name,
-					variable: value.Variable,
-					setter:   claimsSetter,
-				},
-			)
+	for name, value := range o.Claims {
+		vrb, err := newValueRequestBuilder(name, value, claimsSetter)
+		if err != nil {
+			return nil, err
+		} else if vrb != nil {
+			rb = append(rb, vrb)
 		}
 	}
 
 	for name, value := range o.Metadata {
-		if len(value.Header) > 0 || len(value.Parameter) > 0 {
-			if len(value.Variable) > 0 {
-				return nil, ErrVariableNotAllowed
-			}
+		vrb, err := newValueRequestBuilder(name, value, metadataSetter)
+		if err != nil {
+			return nil, err
+		} else if vrb != nil {
+			rb = append(rb, vrb)
+		}
+	}
 
-			rb = append(rb,
-				headerParameterRequestBuilder{
-					key:       name,
-					header:    http.CanonicalHeaderKey(value.Header),
-					parameter: value.Parameter,
-					setter:    metadataSetter,
-				},
-			)
-		} else if len(value.Variable) > 0 {
-			rb = append(rb,
-				variableRequestBuilder{
-					key:      name,
-					variable: value.Variable,
-					setter:   metadataSetter,
-				},
-			)
+	if o.Tenant != nil {
+		if len(o.Tenant.Header) == 0 && len(o.Tenant.Parameter) == 0 && !o.Tenant.ServerName {
+			return nil, ErrTenantSourceRequired
 		}
+
+		rb = append(rb,
+			headerParameterRequestBuilder{
+				key:        TenantMetadata,
+				header:     http.CanonicalHeaderKey(o.Tenant.Header),
+				parameter:  o.Tenant.Parameter,
+				serverName: o.Tenant.ServerName,
+				required:   true,
+				setter:     metadataSetter,
+			},
+		)
+	}
+
+	if o.Algorithms != nil {
+		if len(o.Algorithms.Header) == 0 && len(o.Algorithms.Parameter) == 0 {
+			return nil, ErrAlgorithmSourceRequired
+		}
+
+		rb = append(rb,
+			headerParameterRequestBuilder{
+				key:       AlgorithmMetadata,
+				header:    http.CanonicalHeaderKey(o.Algorithms.Header),
+				parameter: o.Algorithms.Parameter,
+				setter:    metadataSetter,
+			},
+		)
+	}
+
+	if o.BasicAuth != nil {
+		barb, err := newBasicAuthRequestBuilder(*o.BasicAuth)
+		if err != nil {
+			return nil, err
+		}
+
+		rb = append(rb, barb)
 	}
 
 	if o.PartnerID != nil && (len(o.PartnerID.Claim) > 0 || len(o.PartnerID.Metadata) > 0) {
@@ -267,13 +458,64 @@ func NewRequestBuilders(o Options) (RequestBuilders, error) {
 		)
 	}
 
+	if o.Locale != nil {
+		lrb := localeRequestBuilder{Locale: *o.Locale}
+		if len(lrb.Claim) == 0 {
+			lrb.Claim = DefaultLocaleClaim
+		}
+
+		rb = append(rb, lrb)
+	}
+
+	if o.AuthTime != nil {
+		rb = append(rb, newAuthTimeRequestBuilder(*o.AuthTime, o.now()))
+	}
+
+	if o.AMR != nil {
+		rb = append(rb, newAMRRequestBuilder(*o.AMR))
+	}
+
+	if o.AtHash != nil {
+		ahrb, err := newAtHashRequestBuilder(*o.AtHash, o.alg())
+		if err != nil {
+			return nil, err
+		}
+
+		rb = append(rb, ahrb)
+	}
+
+	if o.SignedCookie != nil {
+		scrb, err := newSignedCookieRequestBuilder(*o.SignedCookie, o.now())
+		if err != nil {
+			return nil, err
+		}
+
+		rb = append(rb, scrb)
+	}
+
+	if o.Confirmation != nil {
+		crb, err := newConfirmationRequestBuilder(*o.Confirmation)
+		if err != nil {
+			return nil, err
+		}
+
+		rb = append(rb, crb)
+	}
+
+	if o.Strict {
+		if srb := newStrictRequestBuilder(o); srb != nil {
+			rb = append(rb, srb)
+		}
+	}
+
 	return rb, nil
 }
 
-// BuildRequest applies a sequence of RequestBuilder instances to produce a token factory Request
+// BuildRequest applies a sequence of RequestBuilder instances to produce a token factory Request.  The request
+// body is decoded at most once, no matter how many claims are taken from it.
 func BuildRequest(original *http.Request, rb RequestBuilders) (*Request, error) {
 	tr := NewRequest()
-	if err := rb.Build(original, tr); err != nil {
+	if err := rb.Build(withDecodedBody(original), tr); err != nil {
 		return nil, err
 	}
 
@@ -281,8 +523,13 @@ func BuildRequest(original *http.Request, rb RequestBuilders) (*Request, error)
 }
 
 func DecodeServerRequest(rb RequestBuilders) func(context.Context, *http.Request) (interface{}, error) {
+	return DecodeServerRequestWith(ParseForm, rb)
+}
+
+// DecodeServerRequestWith is like DecodeServerRequest, but uses a custom RequestParser to prepare the HTTP request
+func DecodeServerRequestWith(p RequestParser, rb RequestBuilders) func(context.Context, *http.Request) (interface{}, error) {
 	return func(ctx context.Context, hr *http.Request) (interface{}, error) {
-		if err := hr.ParseForm(); err != nil {
+		if err := p(hr); err != nil {
 			return nil, err
 		}
 
@@ -295,10 +542,21 @@ func DecodeServerRequest(rb RequestBuilders) func(context.Context, *http.Request
 	}
 }
 
-func EncodeIssueResponse(_ context.Context, response http.ResponseWriter, value interface{}) error {
-	response.Header().Set("Content-Type", "application/jose")
-	_, err := response.Write([]byte(value.(string)))
-	return err
+// DefaultResponseContentType is the media type of issued tokens, as registered by RFC 7519
+const DefaultResponseContentType = "application/jwt"
+
+// NewEncodeIssueResponse returns a go-kit response encoder that writes an issued token with the given Content-Type
+func NewEncodeIssueResponse(contentType string) kithttp.EncodeResponseFunc {
+	return func(_ context.Context, response http.ResponseWriter, value interface{}) error {
+		response.Header().Set("Content-Type", contentType)
+		_, err := response.Write([]byte(value.(string)))
+		return err
+	}
+}
+
+// EncodeIssueResponse writes an issued token with the DefaultResponseContentType
+func EncodeIssueResponse(ctx context.Context, response http.ResponseWriter, value interface{}) error {
+	return NewEncodeIssueResponse(DefaultResponseContentType)(ctx, response, value)
 }
 
 type DecodeClaimsError struct {
@@ -322,7 +580,7 @@ func (dce *DecodeClaimsError) nestedErrorText() string {
 func (dce *DecodeClaimsError) Error() string {
 	return fmt.Sprintf(
 		"Failed to decode remote claims from [%s]: statusCode=%d, err=%s",
-		dce.URL,
+		redactURL(dce.URL),
 		dce.StatusCode,
 		dce.nestedErrorText(),
 	)
@@ -333,7 +591,7 @@ func (dce *DecodeClaimsError) MarshalJSON() ([]byte, error) {
 	fmt.Fprintf(
 		&output,
 		`{"url": "%s", "statusCode": %d, "err": "%s"}`,
-		dce.URL,
+		redactURL(dce.URL),
 		dce.StatusCode,
 		dce.nestedErrorText(),
 	)
@@ -359,10 +617,13 @@ func DecodeRemoteClaimsResponse(_ context.Context, response *http.Response) (int
 		return nil, err
 	}
 
-	// allow empty bodies
+	// allow empty bodies.  numbers are kept as json.Number, so that large integers such as
+	// 64-bit device identifiers are not rounded through float64 on their way into a token.
 	var claims map[string]interface{}
 	if len(body) > 0 {
-		if err := json.Unmarshal(body, &claims); err != nil {
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		if err := decoder.Decode(&claims); err != nil {
 			return nil, err
 		}
 	}
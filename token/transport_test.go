@@ -12,6 +12,8 @@ import (
 	"testing"
 	"testing/iotest"
 
+	"github.com/xmidt-org/themis/xhttp/xhttpserver"
+
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -291,12 +293,260 @@ func testNewRequestBuildersInvalidPartnerID(t *testing.T) {
 	}
 }
 
+func testNewRequestBuildersCookie(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		rb, err = NewRequestBuilders(Options{
+			Claims: map[string]Value{
+				"session": Value{
+					Cookie: "session",
+				},
+				"optional": Value{
+					Cookie: "optional",
+				},
+			},
+			Metadata: map[string]Value{
+				"fromHeader": Value{
+					Header: "X-Metadata",
+					Cookie: "metadata",
+				},
+				"fromCookie": Value{
+					Header: "X-Missing",
+					Cookie: "metadata",
+				},
+			},
+		})
+	)
+
+	require.NoError(err)
+
+	original := httptest.NewRequest("GET", "/test", nil)
+	original.Header.Set("X-Metadata", "header value")
+	original.AddCookie(&http.Cookie{Name: "session", Value: "abc123"})
+	original.AddCookie(&http.Cookie{Name: "metadata", Value: "cookie value"})
+	require.NoError(original.ParseForm())
+
+	actual := NewRequest()
+	require.NoError(rb.Build(original, actual))
+	assert.Equal(
+		Request{
+			Claims: map[string]interface{}{
+				"session": "abc123",
+			},
+			Metadata: map[string]interface{}{
+				"fromHeader": "header value",
+				"fromCookie": "cookie value",
+			},
+		},
+		*actual,
+	)
+}
+
+func testNewRequestBuildersMissingRequiredCookie(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		rb, err = NewRequestBuilders(Options{
+			Claims: map[string]Value{
+				"session": Value{
+					Cookie:   "session",
+					Required: true,
+				},
+			},
+		})
+	)
+
+	require.NoError(err)
+
+	original := httptest.NewRequest("GET", "/test", nil)
+	original.AddCookie(&http.Cookie{Name: "other", Value: "value"})
+	require.NoError(original.ParseForm())
+
+	err = rb.Build(original, NewRequest())
+	require.Error(err)
+
+	buildErr, ok := err.(BuildError)
+	require.True(ok)
+	assert.Equal(http.StatusBadRequest, buildErr.StatusCode())
+	assert.Equal(xhttpserver.MissingValueError{Cookie: "session"}, buildErr.Err)
+}
+
+func testNewRequestBuildersCookieAndVariable(t *testing.T) {
+	assert := assert.New(t)
+	rb, err := NewRequestBuilders(Options{
+		Claims: map[string]Value{
+			"bad": Value{
+				Cookie:   "xxx",
+				Variable: "zzz",
+			},
+		},
+	})
+
+	assert.Equal(ErrVariableNotAllowed, err)
+	assert.Empty(rb)
+}
+
+// serverNameRequest performs an HTTPS request with the given SNI server name, returning the token Request
+// built from the request the server received
+func serverNameRequest(t *testing.T, rb RequestBuilders, serverName string) (*Request, error) {
+	var (
+		require = require.New(t)
+
+		tr       *Request
+		buildErr error
+		server   = httptest.NewTLSServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			require.NoError(request.ParseForm())
+			tr, buildErr = BuildRequest(request, rb)
+		}))
+	)
+
+	defer server.Close()
+	client := server.Client()
+	transport := client.Transport.(*http.Transport)
+	transport.TLSClientConfig.ServerName = serverName
+	transport.TLSClientConfig.InsecureSkipVerify = true
+
+	response, err := client.Get(server.URL)
+	require.NoError(err)
+	response.Body.Close()
+	return tr, buildErr
+}
+
+func testNewRequestBuildersServerName(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		rb, err = NewRequestBuilders(Options{
+			Claims: map[string]Value{
+				"host": Value{
+					ServerName: true,
+				},
+				"preferHeader": Value{
+					Header:     "X-Host",
+					ServerName: true,
+				},
+			},
+			Tenant: &Tenant{
+				ServerName: true,
+			},
+		})
+	)
+
+	require.NoError(err)
+	tr, err := serverNameRequest(t, rb, "acme.example.com")
+	require.NoError(err)
+	require.NotNil(tr)
+	assert.Equal("acme.example.com", tr.Claims["host"])
+	assert.Equal("acme.example.com", tr.Claims["preferHeader"])
+	assert.Equal("acme.example.com", tr.Metadata[TenantMetadata])
+
+	original := httptest.NewRequest("GET", "https://acme.example.com/test", nil)
+	original.TLS.ServerName = "ignored.example.com"
+	original.Header.Set("X-Host", "header.example.com")
+	tr, err = BuildRequest(original, rb)
+	require.NoError(err)
+	assert.Equal("header.example.com", tr.Claims["preferHeader"])
+	assert.Equal("ignored.example.com", tr.Claims["host"])
+
+	// a non-TLS request has no server name, so the required tenant is missing
+	tr, err = BuildRequest(httptest.NewRequest("GET", "http://acme.example.com/test", nil), rb)
+	assert.Nil(tr)
+	require.Error(err)
+	assert.Equal(xhttpserver.MissingValueError{ServerName: true}, err.(BuildError).Err)
+}
+
+func testNewRequestBuildersNoServerName(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		rb, err = NewRequestBuilders(Options{
+			Claims: map[string]Value{
+				"host": Value{
+					ServerName: true,
+				},
+			},
+		})
+	)
+
+	require.NoError(err)
+
+	// an IP address is never sent via SNI
+	tr, err := serverNameRequest(t, rb, "")
+	require.NoError(err)
+	require.NotNil(tr)
+	assert.NotContains(tr.Claims, "host")
+}
+
+func testNewRequestBuildersClientIPAndScheme(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		rb, err = NewRequestBuilders(Options{
+			Claims: map[string]Value{
+				"ip": Value{
+					ClientIP: true,
+				},
+				"scheme": Value{
+					Scheme: true,
+				},
+				"preferHeader": Value{
+					Header:   "X-Client-IP",
+					ClientIP: true,
+				},
+			},
+		})
+	)
+
+	require.NoError(err)
+	original := httptest.NewRequest("GET", "/test", nil)
+	original.RemoteAddr = "203.0.113.5:4711"
+	tr, err := BuildRequest(original, rb)
+	require.NoError(err)
+	require.NotNil(tr)
+	assert.Equal("203.0.113.5", tr.Claims["ip"])
+	assert.Equal("203.0.113.5", tr.Claims["preferHeader"])
+	assert.Equal("http", tr.Claims["scheme"])
+
+	original = httptest.NewRequest("GET", "/test", nil)
+	original.RemoteAddr = "2001:db8::17"
+	original.URL.Scheme = "https"
+	original.Header.Set("X-Client-IP", "198.51.100.1")
+	tr, err = BuildRequest(original, rb)
+	require.NoError(err)
+	assert.Equal("2001:db8::17", tr.Claims["ip"])
+	assert.Equal("198.51.100.1", tr.Claims["preferHeader"])
+	assert.Equal("https", tr.Claims["scheme"])
+
+	_, err = NewRequestBuilders(Options{
+		Claims: map[string]Value{
+			"ip": Value{
+				Variable: "ip",
+				ClientIP: true,
+			},
+		},
+	})
+
+	assert.Equal(ErrVariableNotAllowed, err)
+}
+
 func TestNewRequestBuilders(t *testing.T) {
 	t.Run("InvalidClaim", testNewRequestBuildersInvalidClaim)
 	t.Run("InvalidMetadata", testNewRequestBuildersInvalidMetadata)
 	t.Run("MissingVariable", testNewRequestBuildersMissingVariable)
 	t.Run("InvalidPartnerID", testNewRequestBuildersInvalidPartnerID)
 	t.Run("Success", testNewRequestBuildersSuccess)
+	t.Run("Cookie", testNewRequestBuildersCookie)
+	t.Run("MissingRequiredCookie", testNewRequestBuildersMissingRequiredCookie)
+	t.Run("CookieAndVariable", testNewRequestBuildersCookieAndVariable)
+	t.Run("ServerName", testNewRequestBuildersServerName)
+	t.Run("NoServerName", testNewRequestBuildersNoServerName)
+	t.Run("ClientIPAndScheme", testNewRequestBuildersClientIPAndScheme)
 }
 
 func testBuildRequestSuccess(t *testing.T) {
@@ -595,7 +845,7 @@ func TestEncodeIssueResponse(t *testing.T) {
 		EncodeIssueResponse(context.Background(), response, expectedValue),
 	)
 
-	assert.Equal("application/jose", response.HeaderMap.Get("Content-Type"))
+	assert.Equal(DefaultResponseContentType, response.HeaderMap.Get("Content-Type"))
 	assert.Equal(expectedValue, response.Body.String())
 }
 
@@ -615,6 +865,10 @@ func testDecodeRemoteClaimsResponseSuccess(t *testing.T) {
 			body:     `{"key1": "value1"}`,
 			expected: map[string]interface{}{"key1": "value1"},
 		},
+		{
+			body:     `{"deviceId": 9007199254740993, "ratio": 0.5}`,
+			expected: map[string]interface{}{"deviceId": json.Number("9007199254740993"), "ratio": json.Number("0.5")},
+		},
 	}
 
 	for i, record := range testData {
@@ -1,11 +1,18 @@
 package token
 
 import (
+	"context"
+
+	"github.com/xmidt-org/themis/clock"
 	"github.com/xmidt-org/themis/config"
 	"github.com/xmidt-org/themis/key"
 	"github.com/xmidt-org/themis/random"
 	"github.com/xmidt-org/themis/xhttp/xhttpclient"
+	"github.com/xmidt-org/themis/xlog"
 
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	kithttp "github.com/go-kit/kit/transport/http"
 	"go.uber.org/fx"
 )
 
@@ -16,6 +23,45 @@ type TokenIn struct {
 	Keys         key.Registry
 	Unmarshaller config.Unmarshaller
 	Client       xhttpclient.Interface `optional:"true"`
+	Lifecycle    fx.Lifecycle
+
+	// Reloader is the optional component that rereads any claim templates at runtime
+	Reloader *config.Reloader `optional:"true"`
+
+	// SequenceStore is the optional persistence hook for the sequence claim.  It is ignored unless
+	// a sequence is configured.
+	SequenceStore SequenceStore `optional:"true"`
+
+	// ReplayStore is the optional store of client nonces used for replay protection.  If not supplied,
+	// an in-memory store is used.  It is ignored unless replay protection is configured.
+	ReplayStore ReplayStore `optional:"true"`
+
+	// ChallengeStore is the optional store of issued challenge nonces.  If not supplied, an in-memory store
+	// is used.  It is ignored unless a challenge is configured.
+	ChallengeStore ChallengeStore `optional:"true"`
+
+	// AuditStore is the optional store that receives a record of each issued token.  If not supplied, records
+	// are discarded.  It is ignored unless auditing is configured.
+	AuditStore AuditStore `optional:"true"`
+
+	// QuotaStore is the optional store of per-claim issuance counts.  If not supplied, an in-memory store is
+	// used.  It is ignored unless a quota is configured, and is only used for access tokens.
+	QuotaStore QuotaStore `optional:"true"`
+
+	// BodyDecoders are the optional decoders, keyed by media type, for request bodies in formats beyond JSON and
+	// form encoding.  They are ignored unless the issue handler's body mode is BodyContent.
+	BodyDecoders BodyDecoders `optional:"true"`
+
+	// KeyGroups are the optional key groups, one of which may be selected via Options.KeyGroup
+	KeyGroups key.Registries `optional:"true"`
+
+	// Clock is the optional source of the current time for time-based claims, replay protection, and rate
+	// limiting.  If not supplied, the system time is used.
+	Clock clock.Clock `optional:"true"`
+
+	// Logger is the optional logger that receives the startup banner, i.e. the effective token Options
+	// with secrets redacted.  If not supplied, no banner is logged.
+	Logger log.Logger `optional:"true"`
 }
 
 type TokenOut struct {
@@ -24,7 +70,106 @@ type TokenOut struct {
 	ClaimBuilder  ClaimBuilder
 	Factory       Factory
 	IssueHandler  IssueHandler
+	BatchHandler  BatchHandler
 	ClaimsHandler ClaimsHandler
+	PairHandler   PairHandler
+
+	// ChallengeHandler issues challenge nonces, and is nil unless a challenge is configured
+	ChallengeHandler ChallengeHandler
+}
+
+// appendSelfTest runs a Factory's self test when the application starts
+func appendSelfTest(l fx.Lifecycle, f Factory) {
+	l.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			return f.(SelfTester).SelfTest()
+		},
+	})
+}
+
+// appendWebhook drains and stops a Factory's webhook, if any, when the application stops
+func appendWebhook(l fx.Lifecycle, f Factory) {
+	if wn := f.(*factory).webhook; wn != nil {
+		l.Append(fx.Hook{
+			OnStop: func(context.Context) error {
+				wn.stop()
+				return nil
+			},
+		})
+	}
+}
+
+// appendRotation starts a Factory's key rotation, if any, when the application starts and stops it when the
+// application stops
+func appendRotation(l fx.Lifecycle, f Factory) {
+	if rr := f.(*factory).rotator; rr != nil {
+		l.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				rr.Start()
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				rr.Stop()
+				return nil
+			},
+		})
+	}
+}
+
+// newFactory creates the claim builders and token Factory for a single set of Options, found under configKey.
+// The returned claim builders omit any sequence, so that previewing claims does not consume sequence numbers.
+func newFactory(in TokenIn, configKey string, o Options, ss SequenceStore) (ClaimBuilders, Factory, error) {
+	cb, err := NewClaimBuilders(in.Noncer, in.Client, o)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var sb ClaimBuilder
+	if o.Sequence != nil {
+		if sb, err = NewSequenceClaimBuilder(*o.Sequence, ss); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// with a Reloader, templates are always registered, so that a reload can add them where there were none
+	var tcb *templateClaimBuilder
+	if len(o.Templates) > 0 || in.Reloader != nil {
+		if tcb, err = newTemplateClaimBuilder(o.Templates); err != nil {
+			return nil, nil, err
+		}
+
+		if in.Reloader != nil {
+			in.Reloader.Register(tcb.reloadable(configKey+".templates", in.Logger))
+		}
+	}
+
+	// templates run last in both sequences, so that they can refer to the sequence claim of an issued token
+	fcb := append(ClaimBuilders{}, cb...)
+	if sb != nil {
+		fcb = append(fcb, sb)
+	}
+
+	if tcb != nil {
+		cb = append(cb, tcb)
+		fcb = append(fcb, tcb)
+	}
+
+	kr := in.Keys
+	if len(o.KeyGroup) > 0 {
+		if kr, err = in.KeyGroups.Get(o.KeyGroup); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	o.client = in.Client
+	f, err := NewFactory(o, fcb, kr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	appendWebhook(in.Lifecycle, f)
+	appendRotation(in.Lifecycle, f)
+	return cb, f, nil
 }
 
 // Unmarshal returns an uber/fx style factory that produces the relevant components for
@@ -36,32 +181,148 @@ func Unmarshal(configKey string, b ...RequestBuilder) func(TokenIn) (TokenOut, e
 			return TokenOut{}, err
 		}
 
-		cb, err := NewClaimBuilders(in.Noncer, in.Client, o)
-		if err != nil {
-			return TokenOut{}, err
+		o.clock = in.Clock
+		o.auditStore = in.AuditStore
+		o.quotaStore = in.QuotaStore
+		o.Issue.decoders = in.BodyDecoders
+		o.Issue.clock = in.Clock
+		if o.Refresh != nil {
+			o.Refresh.clock = in.Clock
+			o.Refresh.auditStore = in.AuditStore
+		}
+
+		if in.Logger != nil {
+			in.Logger.Log(
+				level.Key(), level.InfoValue(),
+				xlog.MessageKey(), "token configuration",
+				"key", configKey,
+				"options", o.LogValue(),
+			)
 		}
 
-		f, err := NewFactory(o, cb, in.Keys)
+		cb, f, err := newFactory(in, configKey, o, in.SequenceStore)
 		if err != nil {
 			return TokenOut{}, err
 		}
 
+		if o.SelfTest {
+			appendSelfTest(in.Lifecycle, f)
+		}
+
 		rb, err := NewRequestBuilders(o)
 		if err != nil {
 			return TokenOut{}, err
 		}
 
 		rb = append(rb, b...)
+		var (
+			options      []kithttp.ServerOption
+			errorEncoder kithttp.ErrorEncoder
+		)
+
+		if o.SignErrors {
+			errorEncoder = NewSignedErrorEncoder(f.(DetachedSigner))
+			options = append(options, kithttp.ServerErrorEncoder(errorEncoder))
+		} else if o.ProblemErrors {
+			errorEncoder = NewProblemErrorEncoder()
+			options = append(options, kithttp.ServerErrorEncoder(errorEncoder))
+		}
+
+		ih, err := o.Issue.NewHandler(NewIssueEndpoint(f), rb, options...)
+		if err != nil {
+			return TokenOut{}, err
+		}
+
+		var bh BatchHandler
+		if o.Batch != nil {
+			b := *o.Batch
+			b.errorEncoder = errorEncoder
+			b.maxBodySize = o.Issue.MaxBodySize
+			bh = NewBatchHandler(f, rb, b)
+		}
+
+		var ph PairHandler
+		if o.Refresh != nil {
+			// the SequenceStore is only used for access tokens, so refresh token sequences are per-process
+			_, rf, err := newFactory(in, configKey+".refresh", *o.Refresh, nil)
+			if err != nil {
+				return TokenOut{}, err
+			}
+
+			if o.Refresh.SelfTest {
+				appendSelfTest(in.Lifecycle, rf)
+			}
+
+			rrb, err := NewRequestBuilders(*o.Refresh)
+			if err != nil {
+				return TokenOut{}, err
+			}
+
+			ph, err = o.Issue.NewPairHandler(NewPairEndpoint(f, rf), rb, append(rrb, b...), options...)
+			if err != nil {
+				return TokenOut{}, err
+			}
+		}
+
+		if o.Replay != nil {
+			rg := ReplayGuard{
+				Replay:       *o.Replay,
+				Store:        in.ReplayStore,
+				ErrorEncoder: errorEncoder,
+			}
+
+			if rg.Store == nil {
+				rg.Store = newMemoryReplayStore(o.Replay.TTL, o.now())
+			}
+
+			ih = rg.Then(ih)
+			if bh != nil {
+				bh = rg.Then(bh)
+			}
+
+			if ph != nil {
+				ph = rg.Then(ph)
+			}
+		}
+
+		var ch ChallengeHandler
+		if o.Challenge != nil {
+			if in.Noncer == nil {
+				return TokenOut{}, ErrChallengeRequiresNoncer
+			}
+
+			cg := ChallengeGuard{
+				Challenge:    *o.Challenge,
+				Store:        in.ChallengeStore,
+				ErrorEncoder: errorEncoder,
+			}
+
+			if cg.Store == nil {
+				cg.Store = newMemoryChallengeStore(o.Challenge.TTL, o.Challenge.MaxOutstanding, o.now())
+			}
+
+			ch = NewChallengeHandler(*o.Challenge, in.Noncer, cg.Store, errorEncoder)
+			ih = cg.Then(ih)
+			if bh != nil {
+				bh = cg.Then(bh)
+			}
+
+			if ph != nil {
+				ph = cg.Then(ph)
+			}
+		}
+
 		return TokenOut{
-			ClaimBuilder: cb,
-			Factory:      f,
-			IssueHandler: NewIssueHandler(
-				NewIssueEndpoint(f),
-				rb,
-			),
+			ClaimBuilder:     cb,
+			Factory:          f,
+			IssueHandler:     ih,
+			BatchHandler:     bh,
+			PairHandler:      ph,
+			ChallengeHandler: ch,
 			ClaimsHandler: NewClaimsHandler(
 				NewClaimsEndpoint(cb),
 				rb,
+				options...,
 			),
 		}, nil
 	}
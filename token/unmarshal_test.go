@@ -1,13 +1,26 @@
 package token
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/xmidt-org/themis/clock"
+	"github.com/xmidt-org/themis/clock/clocktest"
 	"github.com/xmidt-org/themis/config"
 	"github.com/xmidt-org/themis/key"
+	"github.com/xmidt-org/themis/random"
 	"github.com/xmidt-org/themis/xlog"
 
+	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/fx"
 	"go.uber.org/fx/fxtest"
 )
@@ -167,10 +180,372 @@ func testUnmarshalSuccess(t *testing.T) {
 	assert.NotNil(factory)
 }
 
+func testUnmarshalKeyGroup(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		defaultRegistry = key.NewRegistry(nil)
+		groups          = key.Registries{
+			"access":  key.NewRegistry(nil),
+			"refresh": key.NewRegistry(nil),
+		}
+
+		factory Factory
+		app     = fxtest.New(t,
+			fx.Provide(
+				config.ProvideViper(
+					config.Json(`
+						{
+							"token": {
+								"key": {"kid": "access-key", "bits": 512},
+								"keyGroup": "access"
+							}
+						}
+					`),
+				),
+				func() key.Registry { return defaultRegistry },
+				func() key.Registries { return groups },
+				Unmarshal("token"),
+			),
+			fx.Populate(&factory),
+		)
+	)
+
+	require.NoError(app.Err())
+	require.NotNil(factory)
+	assert.Equal([]string{"access-key"}, groups["access"].Kids())
+	assert.Empty(groups["refresh"].Kids())
+	assert.Empty(defaultRegistry.Kids())
+}
+
+func testUnmarshalUnknownKeyGroup(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		factory Factory
+
+		app = fx.New(
+			fx.Logger(xlog.DiscardPrinter{}),
+			fx.Provide(
+				config.ProvideViper(
+					config.Json(`
+						{
+							"token": {
+								"keyGroup": "nosuch"
+							}
+						}
+					`),
+				),
+				func() key.Registry { return key.NewRegistry(nil) },
+				Unmarshal("token"),
+			),
+			fx.Populate(&factory),
+		)
+	)
+
+	assert.Error(app.Err())
+	assert.Nil(factory)
+}
+
+func testUnmarshalClock(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		start    = time.Date(2020, 10, 14, 12, 0, 0, 0, time.UTC)
+		fake     = clocktest.NewFake(start)
+		registry = key.NewRegistry(nil)
+
+		issueHandler IssueHandler
+		app          = fxtest.New(t,
+			fx.Provide(
+				config.ProvideViper(
+					config.Json(`
+						{
+							"token": {
+								"key": {"kid": "clock", "bits": 512},
+								"claims": {
+									"sub": {"parameter": "sub"}
+								},
+								"duration": "5m",
+								"notBeforeDelta": "-15s",
+								"authTime": {},
+								"rateLimit": {"claim": "sub", "rate": 1}
+							}
+						}
+					`),
+				),
+				func() key.Registry { return registry },
+				func() clock.Clock { return fake },
+				Unmarshal("token"),
+			),
+			fx.Populate(&issueHandler),
+		)
+	)
+
+	require.NoError(app.Err())
+
+	issue := func() (*httptest.ResponseRecorder, jwt.MapClaims) {
+		response := httptest.NewRecorder()
+		issueHandler.ServeHTTP(response, httptest.NewRequest("GET", "/?sub=device", nil))
+		if response.Code != http.StatusOK {
+			return response, nil
+		}
+
+		pair, ok := registry.Get("clock")
+		require.True(ok)
+
+		// the fake time is long past, so only the signature is verified here
+		parser := jwt.Parser{SkipClaimsValidation: true}
+		parsed, err := parser.Parse(response.Body.String(), func(*jwt.Token) (interface{}, error) {
+			return &pair.Sign().(*rsa.PrivateKey).PublicKey, nil
+		})
+
+		require.NoError(err)
+		return response, parsed.Claims.(jwt.MapClaims)
+	}
+
+	response, claims := issue()
+	require.Equal(http.StatusOK, response.Code)
+	assert.Equal(float64(start.Unix()), claims["iat"])
+	assert.Equal(float64(start.Unix()), claims["auth_time"])
+	assert.Equal(float64(start.Add(-15*time.Second).Unix()), claims["nbf"])
+	assert.Equal(float64(start.Add(5*time.Minute).Unix()), claims["exp"])
+
+	_, ok := registry.LastUsed("clock")
+	assert.True(ok)
+
+	// the bucket only refills as the fake clock advances
+	response, _ = issue()
+	assert.Equal(http.StatusTooManyRequests, response.Code)
+
+	fake.Add(time.Second)
+	response, claims = issue()
+	require.Equal(http.StatusOK, response.Code)
+	assert.Equal(float64(start.Add(time.Second).Unix()), claims["iat"])
+	assert.Equal(claims["iat"], claims["auth_time"])
+}
+
+func testUnmarshalChallenge(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		issueHandler     IssueHandler
+		challengeHandler ChallengeHandler
+
+		app = fxtest.New(t,
+			fx.Provide(
+				config.ProvideViper(
+					config.Json(`
+						{
+							"token": {
+								"claims": {
+									"sub": {"header": "X-Sub", "required": true}
+								},
+								"challenge": {
+									"header": "X-Challenge",
+									"ttl": "1m"
+								}
+							}
+						}
+					`),
+				),
+				func() key.Registry { return key.NewRegistry(nil) },
+				func() random.Noncer { return random.NewBase64Noncer(rand.Reader, 16, base64.RawURLEncoding) },
+				Unmarshal("token"),
+			),
+			fx.Populate(&issueHandler, &challengeHandler),
+		)
+	)
+
+	require.NoError(app.Err())
+	require.NotNil(challengeHandler)
+
+	challenge := httptest.NewRecorder()
+	challengeHandler.ServeHTTP(challenge, httptest.NewRequest("GET", "/issue/challenge", nil))
+	require.Equal(http.StatusNoContent, challenge.Code)
+	nonce := challenge.Header().Get("X-Challenge")
+	require.NotEmpty(nonce)
+
+	// a request missing a required claim is rejected without using up the nonce
+	request := httptest.NewRequest("GET", "/issue", nil)
+	request.Header.Set("X-Challenge", nonce)
+	response := httptest.NewRecorder()
+	issueHandler.ServeHTTP(response, request)
+	assert.Equal(http.StatusBadRequest, response.Code)
+
+	request.Header.Set("X-Sub", "test")
+	response = httptest.NewRecorder()
+	issueHandler.ServeHTTP(response, request)
+	assert.Equal(http.StatusOK, response.Code)
+
+	response = httptest.NewRecorder()
+	issueHandler.ServeHTTP(response, request)
+	assert.Equal(http.StatusUnauthorized, response.Code)
+}
+
+func testUnmarshalChallengeNoNoncer(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		factory Factory
+	)
+
+	app := fx.New(
+		fx.Logger(xlog.DiscardPrinter{}),
+		fx.Provide(
+			config.ProvideViper(
+				config.Json(`
+					{
+						"token": {
+							"challenge": {}
+						}
+					}
+				`),
+			),
+			func() key.Registry { return key.NewRegistry(nil) },
+			Unmarshal("token"),
+		),
+		fx.Populate(&factory),
+	)
+
+	assert.Error(app.Err())
+	assert.Contains(app.Err().Error(), ErrChallengeRequiresNoncer.Error())
+	assert.Nil(factory)
+}
+
+func testUnmarshalBatchProblemErrors(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		batchHandler BatchHandler
+
+		app = fxtest.New(t,
+			fx.Provide(
+				config.ProvideViper(
+					config.Json(`
+						{
+							"token": {
+								"problemErrors": true,
+								"batch": {}
+							}
+						}
+					`),
+				),
+				func() key.Registry { return key.NewRegistry(nil) },
+				Unmarshal("token"),
+			),
+			fx.Populate(&batchHandler),
+		)
+	)
+
+	require.NoError(app.Err())
+	require.NotNil(batchHandler)
+
+	response := httptest.NewRecorder()
+	batchHandler.ServeHTTP(response, httptest.NewRequest("POST", "/issue/batch", strings.NewReader(`{"not": "an array"}`)))
+	assert.Equal(http.StatusBadRequest, response.Code)
+	assert.Equal(ContentTypeProblemJSON, response.Header().Get("Content-Type"))
+}
+
+func testUnmarshalBatchMaxBodySize(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		batchHandler BatchHandler
+
+		app = fxtest.New(t,
+			fx.Provide(
+				config.ProvideViper(
+					config.Json(`
+						{
+							"token": {
+								"issue": {
+									"maxBodySize": 16
+								},
+								"batch": {}
+							}
+						}
+					`),
+				),
+				func() key.Registry { return key.NewRegistry(nil) },
+				Unmarshal("token"),
+			),
+			fx.Populate(&batchHandler),
+		)
+	)
+
+	require.NoError(app.Err())
+	require.NotNil(batchHandler)
+
+	response := httptest.NewRecorder()
+	batchHandler.ServeHTTP(response, httptest.NewRequest("POST", "/issue/batch", strings.NewReader(`[{"sub": "first"}, {"sub": "second"}]`)))
+	assert.Equal(http.StatusRequestEntityTooLarge, response.Code)
+}
+
+func testUnmarshalSequenceClaims(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		issueHandler  IssueHandler
+		claimsHandler ClaimsHandler
+
+		app = fxtest.New(t,
+			fx.Provide(
+				config.ProvideViper(
+					config.Json(`
+						{
+							"token": {
+								"sequence": {
+									"seed": 10
+								}
+							}
+						}
+					`),
+				),
+				func() key.Registry { return key.NewRegistry(nil) },
+				Unmarshal("token"),
+			),
+			fx.Populate(&issueHandler, &claimsHandler),
+		)
+	)
+
+	require.NoError(app.Err())
+
+	// previewing claims neither shows nor consumes a sequence number
+	for i := 0; i < 3; i++ {
+		response := httptest.NewRecorder()
+		claimsHandler.ServeHTTP(response, httptest.NewRequest("GET", "/claims", nil))
+		require.Equal(http.StatusOK, response.Code)
+
+		var claims map[string]interface{}
+		require.NoError(json.Unmarshal(response.Body.Bytes(), &claims))
+		assert.NotContains(claims, DefaultSequenceClaim)
+	}
+
+	response := httptest.NewRecorder()
+	issueHandler.ServeHTTP(response, httptest.NewRequest("GET", "/issue", nil))
+	require.Equal(http.StatusOK, response.Code)
+
+	_, claims, err := decodeUnverified(response.Body.String())
+	require.NoError(err)
+	assert.Equal(json.Number("11"), claims[DefaultSequenceClaim])
+}
+
 func TestUnmarshal(t *testing.T) {
 	t.Run("Error", testUnmarshalError)
 	t.Run("ClaimBuilderError", testUnmarshalClaimBuilderError)
 	t.Run("FactoryError", testUnmarshalFactoryError)
 	t.Run("RequestBuilderError", testUnmarshalRequestBuilderError)
 	t.Run("Success", testUnmarshalSuccess)
+	t.Run("KeyGroup", testUnmarshalKeyGroup)
+	t.Run("UnknownKeyGroup", testUnmarshalUnknownKeyGroup)
+	t.Run("Clock", testUnmarshalClock)
+	t.Run("Challenge", testUnmarshalChallenge)
+	t.Run("ChallengeNoNoncer", testUnmarshalChallengeNoNoncer)
+	t.Run("BatchProblemErrors", testUnmarshalBatchProblemErrors)
+	t.Run("BatchMaxBodySize", testUnmarshalBatchMaxBodySize)
+	t.Run("SequenceClaims", testUnmarshalSequenceClaims)
 }
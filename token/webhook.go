@@ -0,0 +1,222 @@
+package token
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xmidt-org/themis/xhttp/xhttpclient"
+	"github.com/xmidt-org/themis/xlog"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+const (
+	// DefaultWebhookTimeout is the maximum time a single webhook delivery may take when none is configured
+	DefaultWebhookTimeout = 5 * time.Second
+
+	// DefaultWebhookConcurrency is the number of concurrent webhook deliveries when none is configured
+	DefaultWebhookConcurrency = 4
+
+	// DefaultWebhookQueueSize is the number of events that may await delivery when none is configured
+	DefaultWebhookQueueSize = 100
+)
+
+// InvalidWebhookURLError is returned when the configured webhook URL is not an absolute http or https URL
+type InvalidWebhookURLError struct {
+	URL string
+}
+
+func (iwue InvalidWebhookURLError) Error() string {
+	return fmt.Sprintf("Invalid webhook URL %q: must be an absolute http or https URL", iwue.URL)
+}
+
+// WebhookEvent is the JSON body posted to the webhook for each issued token.  Fields for claims that the
+// token does not have are omitted.
+type WebhookEvent struct {
+	JTI      string `json:"jti,omitempty"`
+	Subject  string `json:"sub,omitempty"`
+	Kid      string `json:"kid"`
+	IssuedAt int64  `json:"iat,omitempty"`
+}
+
+// Webhook describes an external system that is notified each time a token is issued.  Delivery is fire and
+// forget: events are queued and posted in the background, so a slow or unavailable webhook never delays
+// issuance.  When the queue is full, new events are dropped.  Failed deliveries are logged, not retried.
+type Webhook struct {
+	// URL is the absolute URL to which each WebhookEvent is POSTed
+	URL string
+
+	// Timeout is the maximum time a single delivery may take.  If unset, DefaultWebhookTimeout is used.
+	Timeout time.Duration
+
+	// Concurrency is the maximum number of deliveries in flight at once.  If unset, DefaultWebhookConcurrency is used.
+	Concurrency int
+
+	// QueueSize is the maximum number of events awaiting delivery.  If unset, DefaultWebhookQueueSize is used.
+	QueueSize int
+}
+
+// webhookNotifier delivers WebhookEvents with a fixed pool of workers reading from a bounded queue
+type webhookNotifier struct {
+	url     string
+	timeout time.Duration
+	client  xhttpclient.Interface
+	logger  log.Logger
+
+	// lock guards stopped, so that no event is sent on the queue once it has been closed
+	lock    sync.RWMutex
+	queue   chan WebhookEvent
+	dropped uint64
+	stopped bool
+	done    sync.WaitGroup
+}
+
+// newWebhookNotifier validates the webhook configuration and starts its workers.  If client is nil, a default
+// http.Client is used.
+func newWebhookNotifier(w Webhook, client xhttpclient.Interface) (*webhookNotifier, error) {
+	if u, err := url.Parse(w.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return nil, InvalidWebhookURLError{URL: w.URL}
+	}
+
+	wn := &webhookNotifier{
+		url:     w.URL,
+		timeout: w.Timeout,
+		client:  client,
+		logger:  xlog.Default(),
+	}
+
+	if wn.timeout <= 0 {
+		wn.timeout = DefaultWebhookTimeout
+	}
+
+	if wn.client == nil {
+		wn.client = new(http.Client)
+	}
+
+	queueSize := w.QueueSize
+	if queueSize <= 0 {
+		queueSize = DefaultWebhookQueueSize
+	}
+
+	concurrency := w.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultWebhookConcurrency
+	}
+
+	wn.queue = make(chan WebhookEvent, queueSize)
+	wn.done.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go wn.run()
+	}
+
+	return wn, nil
+}
+
+// notify queues an event for delivery without blocking.  If the queue is full, or if the notifier has been
+// stopped, the event is dropped.
+func (wn *webhookNotifier) notify(e WebhookEvent) {
+	wn.lock.RLock()
+	defer wn.lock.RUnlock()
+
+	if wn.stopped {
+		atomic.AddUint64(&wn.dropped, 1)
+		wn.logger.Log(
+			level.Key(), level.WarnValue(),
+			xlog.MessageKey(), "webhook is stopped, dropping event",
+			"kid", e.Kid,
+			"jti", e.JTI,
+		)
+
+		return
+	}
+
+	select {
+	case wn.queue <- e:
+	default:
+		atomic.AddUint64(&wn.dropped, 1)
+		wn.logger.Log(
+			level.Key(), level.WarnValue(),
+			xlog.MessageKey(), "webhook queue is full, dropping event",
+			"kid", e.Kid,
+			"jti", e.JTI,
+		)
+	}
+}
+
+// stop delivers any queued events and waits for the workers to exit.  Events are dropped afterward.
+func (wn *webhookNotifier) stop() {
+	wn.lock.Lock()
+	if !wn.stopped {
+		wn.stopped = true
+		close(wn.queue)
+	}
+
+	wn.lock.Unlock()
+	wn.done.Wait()
+}
+
+func (wn *webhookNotifier) run() {
+	defer wn.done.Done()
+	for e := range wn.queue {
+		if err := wn.deliver(e); err != nil {
+			wn.logger.Log(
+				level.Key(), level.ErrorValue(),
+				xlog.MessageKey(), "unable to deliver webhook event",
+				"kid", e.Kid,
+				"jti", e.JTI,
+				xlog.ErrorKey(), err,
+			)
+		}
+	}
+}
+
+func (wn *webhookNotifier) deliver(e WebhookEvent) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), wn.timeout)
+	defer cancel()
+
+	request, err := http.NewRequest(http.MethodPost, wn.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	response, err := wn.client.Do(request.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	io.Copy(ioutil.Discard, response.Body)
+	response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("Webhook responded with status %d", response.StatusCode)
+	}
+
+	return nil
+}
+
+// newWebhookEvent extracts the event fields from the claims of a signed token
+func newWebhookEvent(kid string, claims map[string]interface{}) WebhookEvent {
+	e := WebhookEvent{Kid: kid}
+	if iat := auditTime(claims["iat"]); !iat.IsZero() {
+		e.IssuedAt = iat.Unix()
+	}
+
+	e.JTI, _ = claims["jti"].(string)
+	e.Subject, _ = claims["sub"].(string)
+	return e
+}
@@ -0,0 +1,164 @@
+package token
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xmidt-org/themis/clock/clocktest"
+	"github.com/xmidt-org/themis/key"
+	"github.com/xmidt-org/themis/random"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestWebhookFactory(t *testing.T, w Webhook) *factory {
+	o := Options{
+		Key:      key.Descriptor{Kid: "webhook", Bits: 512},
+		Nonce:    true,
+		Duration: time.Hour,
+		Webhook:  &w,
+		clock:    clocktest.NewFake(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)),
+		Claims: map[string]Value{
+			"sub": Value{Value: "device"},
+		},
+	}
+
+	cb, err := NewClaimBuilders(random.NewBase64Noncer(rand.Reader, 16, base64.RawURLEncoding), nil, o)
+	require.NoError(t, err)
+
+	f, err := NewFactory(o, cb, key.NewRegistry(nil))
+	require.NoError(t, err)
+	return f.(*factory)
+}
+
+func testWebhookDelivered(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		events  = make(chan WebhookEvent, 1)
+
+		server = httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+			assert.Equal("POST", request.Method)
+			assert.Equal("application/json", request.Header.Get("Content-Type"))
+
+			var e WebhookEvent
+			assert.NoError(json.NewDecoder(request.Body).Decode(&e))
+			events <- e
+		}))
+	)
+
+	defer server.Close()
+	f := newTestWebhookFactory(t, Webhook{URL: server.URL})
+	defer f.webhook.stop()
+
+	signed, err := f.NewToken(context.Background(), NewRequest())
+	require.NoError(err)
+
+	_, claims, err := decodeUnverified(signed)
+	require.NoError(err)
+
+	select {
+	case e := <-events:
+		assert.Equal(
+			WebhookEvent{
+				JTI:      claims["jti"].(string),
+				Subject:  "device",
+				Kid:      "webhook",
+				IssuedAt: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC).Unix(),
+			},
+			e,
+		)
+
+	case <-time.After(time.Second):
+		require.FailNow("the webhook did not receive the event")
+	}
+}
+
+func testWebhookSlow(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		release  = make(chan struct{})
+		received int32
+
+		server = httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+			atomic.AddInt32(&received, 1)
+			<-release
+		}))
+	)
+
+	defer server.Close()
+	f := newTestWebhookFactory(t, Webhook{URL: server.URL, Timeout: time.Minute, Concurrency: 1, QueueSize: 1})
+
+	// with the only delivery stuck, issuance continues without waiting for the webhook
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		signed, err := f.NewToken(context.Background(), NewRequest())
+		require.NoError(err)
+		assert.NotEmpty(signed)
+	}
+
+	assert.Less(int64(time.Since(start)), int64(time.Second))
+
+	// at most one event is in flight and one is queued, so the rest are dropped
+	assert.True(atomic.LoadUint64(&f.webhook.dropped) >= 8)
+
+	close(release)
+	f.webhook.stop()
+	assert.True(atomic.LoadInt32(&received) <= 2)
+}
+
+func testWebhookNotifyAfterStop(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		received int32
+
+		server = httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+			atomic.AddInt32(&received, 1)
+		}))
+	)
+
+	defer server.Close()
+	f := newTestWebhookFactory(t, Webhook{URL: server.URL})
+	f.webhook.stop()
+
+	// tokens issued after the application stops, e.g. during the drain window, must not panic
+	for i := 0; i < 10; i++ {
+		signed, err := f.NewToken(context.Background(), NewRequest())
+		require.NoError(err)
+		assert.NotEmpty(signed)
+	}
+
+	f.webhook.stop() // idempotent
+	assert.Equal(uint64(10), atomic.LoadUint64(&f.webhook.dropped))
+	assert.Zero(atomic.LoadInt32(&received))
+}
+
+func testWebhookInvalidURL(t *testing.T) {
+	for _, u := range []string{"", "/relative", "ftp://example.com/hook", "https://"} {
+		f, err := NewFactory(
+			Options{Key: key.Descriptor{Kid: "webhook", Bits: 512}, Webhook: &Webhook{URL: u}},
+			ClaimBuilders{},
+			key.NewRegistry(nil),
+		)
+
+		assert.Nil(t, f)
+		assert.Equal(t, InvalidWebhookURLError{URL: u}, err)
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	t.Run("Delivered", testWebhookDelivered)
+	t.Run("Slow", testWebhookSlow)
+	t.Run("NotifyAfterStop", testWebhookNotifyAfterStop)
+	t.Run("InvalidURL", testWebhookInvalidURL)
+}
@@ -0,0 +1,257 @@
+package verify
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/xmidt-org/themis/key"
+	"github.com/xmidt-org/themis/xhttp/xhttpclient"
+	"github.com/xmidt-org/themis/xlog"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/go-kit/kit/metrics"
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+var (
+	ErrNoKeys    = errors.New("No verification keys have been loaded")
+	ErrStaleKeys = errors.New("The verification keys are stale")
+)
+
+const (
+	// OutcomeLabel is the metric label for the result of a key set refresh
+	OutcomeLabel = "outcome"
+
+	SuccessOutcome = "success"
+	FailureOutcome = "failure"
+)
+
+// Metrics holds the optional metrics a Verifier updates as it refreshes its key set
+type Metrics struct {
+	// RefreshCount is incremented after each attempt to fetch the key set.  It must accept an OutcomeLabel label.
+	RefreshCount metrics.Counter
+}
+
+// FetchError indicates that a JWK set could not be retrieved from its URL
+type FetchError struct {
+	URL        string
+	StatusCode int
+}
+
+func (fe FetchError) Error() string {
+	return fmt.Sprintf("Unable to fetch keys from [%s]: statusCode=%d", fe.URL, fe.StatusCode)
+}
+
+// fetchedSet is a JWK set along with the time it was fetched
+type fetchedSet struct {
+	set     *jwk.Set
+	fetched time.Time
+
+	// ed25519 holds the set's Ed25519 keys, by kid, which the jwk package cannot parse
+	ed25519 map[string]ed25519.PublicKey
+}
+
+// parseKeySet parses a JWK set, or a single JWK.  RFC 8037 OKP keys are removed from a set before it is
+// given to the jwk package, and are returned separately.
+func parseKeySet(r io.Reader) (fetchedSet, error) {
+	var raw map[string]interface{}
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return fetchedSet{}, err
+	}
+
+	var fs fetchedSet
+	if keys, ok := raw["keys"].([]interface{}); ok {
+		others := make([]interface{}, 0, len(keys))
+		for _, k := range keys {
+			jwk, ok := k.(map[string]interface{})
+			if !ok || jwk["kty"] != "OKP" {
+				others = append(others, k)
+				continue
+			}
+
+			public, err := key.ParseEd25519JWK(jwk)
+			if err != nil {
+				return fetchedSet{}, err
+			}
+
+			if fs.ed25519 == nil {
+				fs.ed25519 = make(map[string]ed25519.PublicKey)
+			}
+
+			kid, _ := jwk["kid"].(string)
+			fs.ed25519[kid] = public
+		}
+
+		raw["keys"] = others
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return fetchedSet{}, err
+	}
+
+	if fs.set, err = jwk.ParseBytes(data); err != nil {
+		return fetchedSet{}, err
+	}
+
+	return fs, nil
+}
+
+// keySet holds the most recently fetched JWK set.  A failed refresh never discards a set
+// that was previously fetched successfully.
+type keySet struct {
+	url        string
+	client     xhttpclient.Interface
+	maxAge     time.Duration
+	failClosed bool
+	metrics    Metrics
+	now        func() time.Time
+	current    atomic.Value
+}
+
+func newKeySet(o Options, client xhttpclient.Interface, m Metrics) *keySet {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &keySet{
+		url:        o.URL,
+		client:     client,
+		maxAge:     o.MaxAge,
+		failClosed: o.FailClosed,
+		metrics:    m,
+		now:        o.now(),
+	}
+}
+
+// stale tests whether the current set, if any, was fetched longer ago than the configured max age
+func (ks *keySet) stale() bool {
+	fs, ok := ks.current.Load().(fetchedSet)
+	return ok && ks.maxAge > 0 && ks.now().Sub(fs.fetched) > ks.maxAge
+}
+
+// refresh fetches the JWK set, replacing the current set only if the fetch succeeds
+func (ks *keySet) refresh(ctx context.Context) error {
+	request, err := http.NewRequest(http.MethodGet, ks.url, nil)
+	if err != nil {
+		return err
+	}
+
+	response, err := ks.client.Do(request.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return FetchError{URL: ks.url, StatusCode: response.StatusCode}
+	}
+
+	fs, err := parseKeySet(response.Body)
+	if err != nil {
+		return err
+	}
+
+	fs.fetched = ks.now()
+	ks.current.Store(fs)
+	return nil
+}
+
+// get returns the public key material for the given key id
+func (ks *keySet) get(kid string) (interface{}, error) {
+	fs, ok := ks.current.Load().(fetchedSet)
+	if !ok {
+		return nil, ErrNoKeys
+	}
+
+	if ks.failClosed && ks.stale() {
+		return nil, ErrStaleKeys
+	}
+
+	if public, ok := fs.ed25519[kid]; ok {
+		return public, nil
+	}
+
+	keys := fs.set.LookupKeyID(kid)
+	if len(keys) == 0 {
+		return nil, KeyNotFoundError{KID: kid}
+	}
+
+	raw, err := keys[0].Materialize()
+	if err != nil {
+		return nil, err
+	}
+
+	// guard against key sets that mistakenly publish private keys
+	switch k := raw.(type) {
+	case *rsa.PrivateKey:
+		return &k.PublicKey, nil
+	case *ecdsa.PrivateKey:
+		return &k.PublicKey, nil
+	default:
+		return raw, nil
+	}
+}
+
+// record updates the refresh metric, if configured, with the outcome of a refresh
+func (ks *keySet) record(err error) {
+	if ks.metrics.RefreshCount == nil {
+		return
+	}
+
+	outcome := SuccessOutcome
+	if err != nil {
+		outcome = FailureOutcome
+	}
+
+	ks.metrics.RefreshCount.With(OutcomeLabel, outcome).Add(1.0)
+}
+
+// run refreshes the key set until the given context is canceled.  The first refresh happens immediately.
+// Retries after failures back off exponentially, with jitter.
+func (ks *keySet) run(ctx context.Context, o Options, logger log.Logger) {
+	var (
+		failures = 0
+		random   = rand.New(rand.NewSource(time.Now().UnixNano()))
+	)
+
+	for {
+		var wait time.Duration
+		err := ks.refresh(ctx)
+		ks.record(err)
+		if err != nil {
+			failures++
+			wait = o.jitter(o.retryInterval(failures), random)
+			logger.Log(
+				level.Key(), level.ErrorValue(),
+				xlog.MessageKey(), "unable to refresh verification keys",
+				xlog.ErrorKey(), err,
+				"url", ks.url,
+				"retry", wait,
+				"stale", ks.stale(),
+			)
+		} else {
+			failures = 0
+			wait = o.refreshInterval()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
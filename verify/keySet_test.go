@@ -0,0 +1,325 @@
+package verify
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xmidt-org/themis/clock/clocktest"
+	"github.com/xmidt-org/themis/key"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestKey generates an RSA key suitable for signing test tokens
+func newTestKey(t *testing.T) *rsa.PrivateKey {
+	k, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	return k
+}
+
+// newTestKeySet produces the JSON for a JWK set containing the public keys of the given private keys
+func newTestKeySet(t *testing.T, keys map[string]*rsa.PrivateKey) []byte {
+	var set jwk.Set
+	for kid, k := range keys {
+		jwkKey, err := jwk.New(&k.PublicKey)
+		require.NoError(t, err)
+		require.NoError(t, jwkKey.Set(jwk.KeyIDKey, kid))
+		set.Keys = append(set.Keys, jwkKey)
+	}
+
+	data, err := json.Marshal(set)
+	require.NoError(t, err)
+	return data
+}
+
+// keySetServer is an httptest server whose JWK set response can be changed, or made to fail
+type keySetServer struct {
+	*httptest.Server
+	body atomic.Value
+}
+
+func newKeySetServer(t *testing.T, initial []byte) *keySetServer {
+	kss := new(keySetServer)
+	kss.body.Store(initial)
+	kss.Server = httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, _ *http.Request) {
+		body := kss.body.Load().([]byte)
+		if body == nil {
+			response.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		response.Header().Set("Content-Type", "application/json")
+		response.Write(body)
+	}))
+
+	return kss
+}
+
+func testKeySetRefreshSuccess(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		first  = newTestKey(t)
+		second = newTestKey(t)
+		server = newKeySetServer(t, newTestKeySet(t, map[string]*rsa.PrivateKey{"first": first}))
+		ks     = newKeySet(Options{URL: server.URL}, nil, Metrics{})
+	)
+
+	defer server.Close()
+
+	_, err := ks.get("first")
+	assert.Equal(ErrNoKeys, err)
+
+	require.NoError(ks.refresh(context.Background()))
+	k, err := ks.get("first")
+	require.NoError(err)
+	assert.Equal(&first.PublicKey, k)
+
+	_, err = ks.get("second")
+	assert.Equal(KeyNotFoundError{KID: "second"}, err)
+
+	server.body.Store(newTestKeySet(t, map[string]*rsa.PrivateKey{"second": second}))
+	require.NoError(ks.refresh(context.Background()))
+	k, err = ks.get("second")
+	require.NoError(err)
+	assert.Equal(&second.PublicKey, k)
+
+	_, err = ks.get("first")
+	assert.Equal(KeyNotFoundError{KID: "first"}, err)
+}
+
+func testKeySetRefreshFailure(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		first  = newTestKey(t)
+		server = newKeySetServer(t, newTestKeySet(t, map[string]*rsa.PrivateKey{"first": first}))
+		ks     = newKeySet(Options{URL: server.URL}, nil, Metrics{})
+	)
+
+	defer server.Close()
+	require.NoError(ks.refresh(context.Background()))
+
+	server.body.Store([]byte(nil))
+	err := ks.refresh(context.Background())
+	assert.Equal(FetchError{URL: server.URL, StatusCode: http.StatusServiceUnavailable}, err)
+
+	server.body.Store([]byte("this is not a JWK set"))
+	assert.Error(ks.refresh(context.Background()))
+
+	// the last good key set is retained
+	k, err := ks.get("first")
+	require.NoError(err)
+	assert.Equal(&first.PublicKey, k)
+}
+
+func testKeySetStale(t *testing.T, failClosed bool) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		first  = newTestKey(t)
+		server = newKeySetServer(t, newTestKeySet(t, map[string]*rsa.PrivateKey{"first": first}))
+		ks     = newKeySet(Options{URL: server.URL, MaxAge: time.Minute, FailClosed: failClosed}, nil, Metrics{})
+		now    = time.Now()
+	)
+
+	defer server.Close()
+	ks.now = func() time.Time { return now }
+	assert.False(ks.stale())
+
+	require.NoError(ks.refresh(context.Background()))
+	assert.False(ks.stale())
+	_, err := ks.get("first")
+	assert.NoError(err)
+
+	// fetches keep failing until the set is older than its max age
+	server.body.Store([]byte(nil))
+	now = now.Add(2 * time.Minute)
+	assert.Error(ks.refresh(context.Background()))
+	assert.True(ks.stale())
+
+	k, err := ks.get("first")
+	if failClosed {
+		assert.Nil(k)
+		assert.Equal(ErrStaleKeys, err)
+	} else {
+		assert.Equal(&first.PublicKey, k)
+		assert.NoError(err)
+	}
+
+	// a successful refresh makes the set fresh again
+	server.body.Store(newTestKeySet(t, map[string]*rsa.PrivateKey{"first": first}))
+	require.NoError(ks.refresh(context.Background()))
+	assert.False(ks.stale())
+	k, err = ks.get("first")
+	assert.Equal(&first.PublicKey, k)
+	assert.NoError(err)
+}
+
+// outcomeCounter is a metrics.Counter that tallies its value by OutcomeLabel
+type outcomeCounter struct {
+	lock    *sync.Mutex
+	counts  map[string]float64
+	outcome string
+}
+
+func newOutcomeCounter() outcomeCounter {
+	return outcomeCounter{lock: new(sync.Mutex), counts: make(map[string]float64)}
+}
+
+func (oc outcomeCounter) With(labelValues ...string) metrics.Counter {
+	for i := 0; i+1 < len(labelValues); i += 2 {
+		if labelValues[i] == OutcomeLabel {
+			oc.outcome = labelValues[i+1]
+		}
+	}
+
+	return oc
+}
+
+func (oc outcomeCounter) Add(delta float64) {
+	oc.lock.Lock()
+	oc.counts[oc.outcome] += delta
+	oc.lock.Unlock()
+}
+
+func (oc outcomeCounter) value(outcome string) float64 {
+	oc.lock.Lock()
+	defer oc.lock.Unlock()
+	return oc.counts[outcome]
+}
+
+func testKeySetRunMetrics(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		counter = newOutcomeCounter()
+		server  = newKeySetServer(t, nil)
+		o       = Options{URL: server.URL, MinRetryInterval: time.Millisecond, MaxRetryInterval: 5 * time.Millisecond}
+		ks      = newKeySet(o, nil, Metrics{RefreshCount: counter})
+
+		ctx, cancel = context.WithCancel(context.Background())
+		done        = make(chan struct{})
+	)
+
+	defer server.Close()
+	go func() {
+		defer close(done)
+		ks.run(ctx, o, log.NewNopLogger())
+	}()
+
+	assert.Eventually(
+		func() bool { return counter.value(FailureOutcome) >= 3 },
+		5*time.Second,
+		time.Millisecond,
+	)
+
+	assert.Zero(counter.value(SuccessOutcome))
+	server.body.Store(newTestKeySet(t, map[string]*rsa.PrivateKey{"test": newTestKey(t)}))
+	assert.Eventually(
+		func() bool { return counter.value(SuccessOutcome) == 1 },
+		5*time.Second,
+		time.Millisecond,
+	)
+
+	cancel()
+	<-done
+
+	_, err := ks.get("test")
+	assert.NoError(err)
+}
+
+func testKeySetEd25519(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		rsaKey = newTestKey(t)
+	)
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(err)
+
+	// the jwk package cannot parse OKP keys, so they must not spoil the rest of the set
+	var set map[string][]map[string]interface{}
+	require.NoError(json.Unmarshal(newTestKeySet(t, map[string]*rsa.PrivateKey{"rsa": rsaKey}), &set))
+	set["keys"] = append(set["keys"], map[string]interface{}{
+		"kty": "OKP",
+		"crv": "Ed25519",
+		"kid": "ed25519",
+		"x":   base64.RawURLEncoding.EncodeToString(public),
+	})
+
+	data, err := json.Marshal(set)
+	require.NoError(err)
+
+	var (
+		server = newKeySetServer(t, data)
+		ks     = newKeySet(Options{URL: server.URL}, nil, Metrics{})
+	)
+
+	defer server.Close()
+	require.NoError(ks.refresh(context.Background()))
+
+	k, err := ks.get("ed25519")
+	require.NoError(err)
+	assert.Equal(public, k)
+
+	k, err = ks.get("rsa")
+	require.NoError(err)
+	assert.Equal(&rsaKey.PublicKey, k)
+
+	claims, err := newVerifier(Options{}, ks).Verify(
+		signTestToken(t, key.SigningMethodEdDSA, "ed25519", private, jwt.MapClaims{"sub": "test"}),
+	)
+
+	require.NoError(err)
+	assert.Equal("test", claims["sub"])
+}
+
+func testKeySetClock(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		first  = newTestKey(t)
+		server = newKeySetServer(t, newTestKeySet(t, map[string]*rsa.PrivateKey{"first": first}))
+		fake   = clocktest.NewFake(time.Now())
+		ks     = newKeySet(Options{URL: server.URL, MaxAge: time.Minute, clock: fake}, nil, Metrics{})
+	)
+
+	defer server.Close()
+	require.NoError(ks.refresh(context.Background()))
+	assert.False(ks.stale())
+
+	fake.Add(2 * time.Minute)
+	assert.True(ks.stale(), "the key set ages with the application clock")
+}
+
+func TestKeySet(t *testing.T) {
+	t.Run("RefreshSuccess", testKeySetRefreshSuccess)
+	t.Run("RefreshFailure", testKeySetRefreshFailure)
+	t.Run("StaleFailOpen", func(t *testing.T) { testKeySetStale(t, false) })
+	t.Run("StaleFailClosed", func(t *testing.T) { testKeySetStale(t, true) })
+	t.Run("Clock", testKeySetClock)
+	t.Run("RunMetrics", testKeySetRunMetrics)
+	t.Run("Ed25519", testKeySetEd25519)
+}
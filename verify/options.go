@@ -0,0 +1,112 @@
+package verify
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/xmidt-org/themis/clock"
+)
+
+const (
+	DefaultRefreshInterval  = 5 * time.Minute
+	DefaultMinRetryInterval = time.Second
+
+	// DefaultJitter is the fraction of each retry interval that is randomized when Jitter is unset
+	DefaultJitter = 0.2
+)
+
+// Options describes how a Verifier obtains and refreshes the keys used to verify tokens
+type Options struct {
+	// URL is the required location of a JWK set, e.g. https://themis.example.com/keys.  The document
+	// at this URL must be a JSON object with a "keys" array, as described in RFC 7517.
+	URL string
+
+	// RefreshInterval is how often the key set is refetched after a successful fetch.  If unset,
+	// DefaultRefreshInterval is used.
+	RefreshInterval time.Duration
+
+	// MinRetryInterval is the time to wait before retrying after the first failed fetch.  Each consecutive
+	// failure doubles this interval, up to MaxRetryInterval.  If unset, DefaultMinRetryInterval is used.
+	MinRetryInterval time.Duration
+
+	// MaxRetryInterval is the upper bound on the time between retries of failed fetches.  If unset,
+	// the RefreshInterval is used.
+	MaxRetryInterval time.Duration
+
+	// Jitter is the fraction, between 0 and 1, of each retry interval that is randomized so that many verifiers
+	// do not retry in lockstep.  A retry waits somewhere between (1 - Jitter) and the full interval.  If unset,
+	// DefaultJitter is used.  A negative value disables jitter.
+	Jitter float64
+
+	// MaxAge is how long a key set remains fresh after it was last fetched successfully.  A key set that has
+	// not been refreshed within MaxAge is stale.  If unset, key sets never become stale.
+	MaxAge time.Duration
+
+	// FailClosed causes every token to fail verification with ErrStaleKeys while the key set is stale.  By
+	// default, a stale key set continues to be used until a refresh succeeds.  This field has no effect unless
+	// MaxAge is set.
+	FailClosed bool
+
+	// Algorithms is an optional allow-list of JWT signing algorithms, e.g. RS256.  If unset, any
+	// algorithm compatible with the verification key is accepted.
+	Algorithms []string
+
+	// Leeway is the clock skew tolerated when validating a token's exp, nbf, and iat claims.  A token that
+	// expired less than Leeway ago is still accepted, as is one that becomes valid less than Leeway from now.
+	// If unset, no skew is tolerated.
+	Leeway time.Duration
+
+	// clock is the application's Clock, supplied by Unmarshal rather than configuration.  If nil, the
+	// system time is used.
+	clock clock.Clock
+}
+
+// now returns the source of the current time for everything built from these Options
+func (o Options) now() func() time.Time {
+	return clock.NowFunc(o.clock)
+}
+
+func (o Options) refreshInterval() time.Duration {
+	if o.RefreshInterval > 0 {
+		return o.RefreshInterval
+	}
+
+	return DefaultRefreshInterval
+}
+
+// retryInterval computes the time to wait after the given number of consecutive failures, which must be positive
+func (o Options) retryInterval(failures int) time.Duration {
+	max := o.MaxRetryInterval
+	if max <= 0 {
+		max = o.refreshInterval()
+	}
+
+	interval := o.MinRetryInterval
+	if interval <= 0 {
+		interval = DefaultMinRetryInterval
+	}
+
+	for i := 1; i < failures && interval < max; i++ {
+		interval *= 2
+	}
+
+	if interval > max {
+		return max
+	}
+
+	return interval
+}
+
+// jitter randomly shortens a retry interval by up to the configured fraction
+func (o Options) jitter(interval time.Duration, random *rand.Rand) time.Duration {
+	j := o.Jitter
+	if j == 0 {
+		j = DefaultJitter
+	} else if j < 0 {
+		return interval
+	} else if j > 1 {
+		j = 1
+	}
+
+	return interval - time.Duration(j*random.Float64()*float64(interval))
+}
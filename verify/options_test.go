@@ -0,0 +1,71 @@
+package verify
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptionsRetryInterval(t *testing.T) {
+	testData := []struct {
+		options  Options
+		failures int
+		expected time.Duration
+	}{
+		{Options{}, 1, DefaultMinRetryInterval},
+		{Options{}, 2, 2 * DefaultMinRetryInterval},
+		{Options{}, 100, DefaultRefreshInterval},
+		{Options{MinRetryInterval: 10 * time.Second}, 1, 10 * time.Second},
+		{Options{MinRetryInterval: 10 * time.Second}, 3, 40 * time.Second},
+		{Options{MinRetryInterval: 10 * time.Second, MaxRetryInterval: 30 * time.Second}, 3, 30 * time.Second},
+		{Options{RefreshInterval: time.Minute, MinRetryInterval: 40 * time.Second}, 2, time.Minute},
+	}
+
+	for i, record := range testData {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, record.expected, record.options.retryInterval(record.failures))
+		})
+	}
+}
+
+func TestOptionsJitter(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		random = rand.New(rand.NewSource(1234))
+
+		o = Options{
+			MinRetryInterval: time.Second,
+			MaxRetryInterval: 16 * time.Second,
+		}
+	)
+
+	// each wait stays within the jittered range of its backoff interval
+	for failures, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 16 * time.Second} {
+		interval := o.retryInterval(failures + 1)
+		assert.Equal(expected, interval)
+
+		wait := o.jitter(interval, random)
+		assert.True(wait <= interval, "wait %s exceeds %s", wait, interval)
+		assert.True(wait >= interval-time.Duration(DefaultJitter*float64(interval)), "wait %s too short for %s", wait, interval)
+	}
+
+	// jitter actually varies the wait
+	waits := make(map[time.Duration]bool)
+	for i := 0; i < 10; i++ {
+		waits[o.jitter(time.Minute, random)] = true
+	}
+
+	assert.True(len(waits) > 1)
+
+	o.Jitter = -1
+	assert.Equal(time.Minute, o.jitter(time.Minute, random))
+
+	o.Jitter = 5
+	for i := 0; i < 10; i++ {
+		wait := o.jitter(time.Minute, random)
+		assert.True(wait >= 0 && wait <= time.Minute)
+	}
+}
@@ -0,0 +1,91 @@
+package verify
+
+import (
+	"context"
+	"errors"
+
+	"github.com/xmidt-org/themis/clock"
+	"github.com/xmidt-org/themis/config"
+	"github.com/xmidt-org/themis/xhttp/xhttpclient"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"go.uber.org/fx"
+)
+
+var (
+	ErrURLRequired    = errors.New("A key set URL is required")
+	ErrMaxAgeTooShort = errors.New("The key set max age must be at least the refresh interval")
+)
+
+// VerifyIn describes the dependencies for unmarshalling a Verifier
+type VerifyIn struct {
+	fx.In
+
+	Logger       log.Logger
+	Unmarshaller config.Unmarshaller
+	Lifecycle    fx.Lifecycle
+
+	// Client is the optional HTTP client used to fetch keys.  If unset, http.DefaultClient is used.
+	Client xhttpclient.Interface `optional:"true"`
+
+	// RefreshCount is the optional counter incremented each time the key set is fetched.  It must accept
+	// an OutcomeLabel label.
+	RefreshCount metrics.Counter `name:"verify_refresh_count" optional:"true"`
+
+	// Clock is the optional source of the current time for validating time-based claims.  If unset,
+	// the system time is used.
+	Clock clock.Clock `optional:"true"`
+}
+
+// Unmarshal returns an uber/fx provider that reads Options from the given configuration key and emits a Verifier.
+// The key set is fetched in the background for the lifetime of the application, beginning when the application
+// starts.  Until the first fetch succeeds, every token fails verification.
+//
+// Applications that only need to verify themis tokens can use this provider without any of themis's
+// issuance components.
+func Unmarshal(configKey string) func(VerifyIn) (Verifier, error) {
+	return func(in VerifyIn) (Verifier, error) {
+		var o Options
+		if err := in.Unmarshaller.UnmarshalKey(configKey, &o); err != nil {
+			return nil, err
+		}
+
+		if len(o.URL) == 0 {
+			return nil, ErrURLRequired
+		}
+
+		if o.MaxAge > 0 && o.MaxAge < o.refreshInterval() {
+			return nil, ErrMaxAgeTooShort
+		}
+
+		o.clock = in.Clock
+		var (
+			ks          = newKeySet(o, in.Client, Metrics{RefreshCount: in.RefreshCount})
+			ctx, cancel = context.WithCancel(context.Background())
+			done        = make(chan struct{})
+		)
+
+		in.Lifecycle.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				go func() {
+					defer close(done)
+					ks.run(ctx, o, in.Logger)
+				}()
+
+				return nil
+			},
+			OnStop: func(stopCtx context.Context) error {
+				cancel()
+				select {
+				case <-done:
+					return nil
+				case <-stopCtx.Done():
+					return stopCtx.Err()
+				}
+			},
+		})
+
+		return newVerifier(o, ks), nil
+	}
+}
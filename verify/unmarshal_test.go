@@ -0,0 +1,99 @@
+package verify
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/xmidt-org/themis/config"
+	"github.com/xmidt-org/themis/xlog"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+func testUnmarshalSuccess(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		signingKey = newTestKey(t)
+		server     = newKeySetServer(t, newTestKeySet(t, map[string]*rsa.PrivateKey{"test": signingKey}))
+
+		verifier Verifier
+	)
+
+	defer server.Close()
+	app := fxtest.New(t,
+		fx.Provide(
+			xlog.Provide(log.NewNopLogger()),
+			config.ProvideViper(
+				config.Json(fmt.Sprintf(`{"verify": {"url": "%s"}}`, server.URL)),
+			),
+			Unmarshal("verify"),
+		),
+		fx.Populate(&verifier),
+	)
+
+	require.NotNil(verifier)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	token := signTestToken(t, jwt.SigningMethodRS256, "test", signingKey, jwt.MapClaims{"sub": "test"})
+	assert.Eventually(
+		func() bool {
+			_, err := verifier.Verify(token)
+			return err == nil
+		},
+		5*time.Second,
+		10*time.Millisecond,
+	)
+}
+
+func testUnmarshalNoURL(t *testing.T) {
+	app := fx.New(
+		fx.Logger(xlog.DiscardPrinter{}),
+		fx.Provide(
+			xlog.Provide(log.NewNopLogger()),
+			config.ProvideViper(
+				config.Json(`{"verify": {"refreshInterval": "1m"}}`),
+			),
+			Unmarshal("verify"),
+		),
+		fx.Invoke(
+			func(Verifier) {},
+		),
+	)
+
+	assert.Error(t, app.Err())
+}
+
+func testUnmarshalMaxAgeTooShort(t *testing.T) {
+	app := fx.New(
+		fx.Logger(xlog.DiscardPrinter{}),
+		fx.Provide(
+			xlog.Provide(log.NewNopLogger()),
+			config.ProvideViper(
+				config.Json(`{"verify": {"url": "https://themis.example.com/keys", "refreshInterval": "5m", "maxAge": "1m"}}`),
+			),
+			Unmarshal("verify"),
+		),
+		fx.Invoke(
+			func(Verifier) {},
+		),
+	)
+
+	require.Error(t, app.Err())
+	assert.Contains(t, app.Err().Error(), ErrMaxAgeTooShort.Error())
+}
+
+func TestUnmarshal(t *testing.T) {
+	t.Run("Success", testUnmarshalSuccess)
+	t.Run("NoURL", testUnmarshalNoURL)
+	t.Run("MaxAgeTooShort", testUnmarshalMaxAgeTooShort)
+}
@@ -0,0 +1,131 @@
+package verify
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+var (
+	ErrMissingKID          = errors.New("The token has no kid header")
+	ErrAlgorithmNotAllowed = errors.New("The token signing algorithm is not allowed")
+)
+
+// KeyNotFoundError indicates that a token was signed with a key that is not in the current key set
+type KeyNotFoundError struct {
+	KID string
+}
+
+func (knfe KeyNotFoundError) Error() string {
+	return fmt.Sprintf("No verification key with kid %s", knfe.KID)
+}
+
+// TokenTimeError indicates that a token's exp, nbf, or iat claim is violated by more than the allowed Leeway,
+// i.e. that the token is expired or not yet valid even allowing for clock skew.  This error produces a 401 response.
+type TokenTimeError struct {
+	Claim string
+}
+
+func (tte TokenTimeError) Error() string {
+	switch tte.Claim {
+	case "exp":
+		return "The token has expired"
+	case "nbf":
+		return "The token is not yet valid"
+	default:
+		return fmt.Sprintf("The token's %s claim is in the future", tte.Claim)
+	}
+}
+
+func (tte TokenTimeError) StatusCode() int {
+	return http.StatusUnauthorized
+}
+
+// Verifier validates tokens issued by themis
+type Verifier interface {
+	// Verify parses the given signed token, checks its signature against the key identified by its kid header,
+	// and validates the standard time-based claims, allowing for the configured Leeway.  The token's claims are
+	// returned if it is valid.
+	Verify(token string) (jwt.MapClaims, error)
+}
+
+type verifier struct {
+	keys       *keySet
+	algorithms map[string]bool
+	leeway     time.Duration
+	now        func() time.Time
+	parser     *jwt.Parser
+}
+
+func (v *verifier) keyFunc(token *jwt.Token) (interface{}, error) {
+	if len(v.algorithms) > 0 && !v.algorithms[token.Method.Alg()] {
+		return nil, ErrAlgorithmNotAllowed
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	if len(kid) == 0 {
+		return nil, ErrMissingKID
+	}
+
+	return v.keys.get(kid)
+}
+
+// checkTime validates the standard time-based claims, each of which is optional, against the current time
+// give or take the leeway
+func (v *verifier) checkTime(claims jwt.MapClaims) error {
+	var (
+		now      = v.now()
+		earliest = now.Add(-v.leeway).Unix()
+		latest   = now.Add(v.leeway).Unix()
+	)
+
+	if !claims.VerifyExpiresAt(earliest, false) {
+		return TokenTimeError{Claim: "exp"}
+	}
+
+	if !claims.VerifyNotBefore(latest, false) {
+		return TokenTimeError{Claim: "nbf"}
+	}
+
+	if !claims.VerifyIssuedAt(latest, false) {
+		return TokenTimeError{Claim: "iat"}
+	}
+
+	return nil
+}
+
+func (v *verifier) Verify(token string) (jwt.MapClaims, error) {
+	claims := make(jwt.MapClaims)
+	if _, err := v.parser.ParseWithClaims(token, claims, v.keyFunc); err != nil {
+		return nil, err
+	}
+
+	if err := v.checkTime(claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func newVerifier(o Options, ks *keySet) *verifier {
+	v := &verifier{
+		keys:   ks,
+		leeway: o.Leeway,
+		now:    o.now(),
+
+		// time-based claims are checked separately, since this parser has no notion of leeway
+		parser: &jwt.Parser{SkipClaimsValidation: true},
+	}
+
+	if len(o.Algorithms) > 0 {
+		v.algorithms = make(map[string]bool, len(o.Algorithms))
+		for _, alg := range o.Algorithms {
+			v.algorithms[alg] = true
+		}
+	}
+
+	return v
+}
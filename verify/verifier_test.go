@@ -0,0 +1,136 @@
+package verify
+
+import (
+	"context"
+	"crypto/rsa"
+	"net/http"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func signTestToken(t *testing.T, method jwt.SigningMethod, kid string, k interface{}, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if len(kid) > 0 {
+		token.Header["kid"] = kid
+	}
+
+	signed, err := token.SignedString(k)
+	require.NoError(t, err)
+	return signed
+}
+
+func TestKeyNotFoundError(t *testing.T) {
+	assert.Contains(t, KeyNotFoundError{KID: "test"}.Error(), "test")
+}
+
+func TestVerifier(t *testing.T) {
+	var (
+		signingKey = newTestKey(t)
+		otherKey   = newTestKey(t)
+		server     = newKeySetServer(t, newTestKeySet(t, map[string]*rsa.PrivateKey{"test": signingKey}))
+		ks         = newKeySet(Options{URL: server.URL}, nil, Metrics{})
+	)
+
+	defer server.Close()
+
+	t.Run("NoKeys", func(t *testing.T) {
+		v := newVerifier(Options{}, newKeySet(Options{URL: server.URL}, nil, Metrics{}))
+		_, err := v.Verify(signTestToken(t, jwt.SigningMethodRS256, "test", signingKey, jwt.MapClaims{"sub": "test"}))
+		assert.Error(t, err)
+	})
+
+	require.NoError(t, ks.refresh(context.Background()))
+
+	t.Run("Valid", func(t *testing.T) {
+		var (
+			assert  = assert.New(t)
+			require = require.New(t)
+			v       = newVerifier(Options{}, ks)
+		)
+
+		claims, err := v.Verify(signTestToken(t, jwt.SigningMethodRS256, "test", signingKey, jwt.MapClaims{"sub": "test"}))
+		require.NoError(err)
+		assert.Equal("test", claims["sub"])
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		v := newVerifier(Options{}, ks)
+		_, err := v.Verify(signTestToken(t, jwt.SigningMethodRS256, "test", signingKey, jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}))
+		assert.Error(t, err)
+	})
+
+	t.Run("WrongKey", func(t *testing.T) {
+		v := newVerifier(Options{}, ks)
+		_, err := v.Verify(signTestToken(t, jwt.SigningMethodRS256, "test", otherKey, jwt.MapClaims{"sub": "test"}))
+		assert.Error(t, err)
+	})
+
+	t.Run("UnknownKID", func(t *testing.T) {
+		v := newVerifier(Options{}, ks)
+		_, err := v.Verify(signTestToken(t, jwt.SigningMethodRS256, "nosuch", signingKey, jwt.MapClaims{"sub": "test"}))
+		require.Error(t, err)
+		assert.Equal(t, KeyNotFoundError{KID: "nosuch"}, err.(*jwt.ValidationError).Inner)
+	})
+
+	t.Run("MissingKID", func(t *testing.T) {
+		v := newVerifier(Options{}, ks)
+		_, err := v.Verify(signTestToken(t, jwt.SigningMethodRS256, "", signingKey, jwt.MapClaims{"sub": "test"}))
+		require.Error(t, err)
+		assert.Equal(t, ErrMissingKID, err.(*jwt.ValidationError).Inner)
+	})
+
+	t.Run("AlgorithmNotAllowed", func(t *testing.T) {
+		v := newVerifier(Options{Algorithms: []string{"RS512"}}, ks)
+		_, err := v.Verify(signTestToken(t, jwt.SigningMethodRS256, "test", signingKey, jwt.MapClaims{"sub": "test"}))
+		require.Error(t, err)
+		assert.Equal(t, ErrAlgorithmNotAllowed, err.(*jwt.ValidationError).Inner)
+	})
+
+	t.Run("Leeway", func(t *testing.T) {
+		var (
+			now = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+			v   = newVerifier(Options{Leeway: time.Minute}, ks)
+		)
+
+		v.now = func() time.Time { return now }
+		testData := []struct {
+			name   string
+			claims jwt.MapClaims
+			err    error
+		}{
+			{"ExpiredWithinLeeway", jwt.MapClaims{"exp": now.Add(-30 * time.Second).Unix()}, nil},
+			{"ExpiredBeyondLeeway", jwt.MapClaims{"exp": now.Add(-2 * time.Minute).Unix()}, TokenTimeError{Claim: "exp"}},
+			{"NotBeforeWithinLeeway", jwt.MapClaims{"nbf": now.Add(30 * time.Second).Unix()}, nil},
+			{"NotBeforeBeyondLeeway", jwt.MapClaims{"nbf": now.Add(2 * time.Minute).Unix()}, TokenTimeError{Claim: "nbf"}},
+			{"IssuedWithinLeeway", jwt.MapClaims{"iat": now.Add(30 * time.Second).Unix()}, nil},
+			{"IssuedBeyondLeeway", jwt.MapClaims{"iat": now.Add(2 * time.Minute).Unix()}, TokenTimeError{Claim: "iat"}},
+		}
+
+		for _, record := range testData {
+			t.Run(record.name, func(t *testing.T) {
+				assert := assert.New(t)
+				claims, err := v.Verify(signTestToken(t, jwt.SigningMethodRS256, "test", signingKey, record.claims))
+				if record.err == nil {
+					assert.NoError(err)
+					assert.NotEmpty(claims)
+					return
+				}
+
+				assert.Nil(claims)
+				assert.Equal(record.err, err)
+				assert.Equal(http.StatusUnauthorized, err.(TokenTimeError).StatusCode())
+				assert.NotEmpty(err.Error())
+			})
+		}
+	})
+
+	t.Run("NoLeeway", func(t *testing.T) {
+		v := newVerifier(Options{}, ks)
+		_, err := v.Verify(signTestToken(t, jwt.SigningMethodRS256, "test", signingKey, jwt.MapClaims{"exp": time.Now().Add(-5 * time.Second).Unix()}))
+		assert.Equal(t, TokenTimeError{Claim: "exp"}, err)
+	})
+}
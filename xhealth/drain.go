@@ -0,0 +1,114 @@
+package xhealth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/xmidt-org/themis/xlog"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"go.uber.org/fx"
+)
+
+var (
+	ErrDraining = errors.New("The application is draining prior to shutdown")
+)
+
+// Drainer tracks whether the application has begun shutting down.  While draining, health endpoints
+// decorated by a Drainer report 503 so that load balancers stop sending traffic, even though the servers
+// themselves are still accepting connections.  A Drainer is safe for concurrent use.
+type Drainer struct {
+	grace    time.Duration
+	draining int32
+}
+
+// NewDrainer creates a Drainer that waits the given grace period between marking the application
+// unhealthy and allowing shutdown to proceed
+func NewDrainer(grace time.Duration) *Drainer {
+	return &Drainer{grace: grace}
+}
+
+// Drain marks the application as draining.  There is no way to undo this.
+func (d *Drainer) Drain() {
+	atomic.StoreInt32(&d.draining, 1)
+}
+
+// Draining tests whether Drain has been called
+func (d *Drainer) Draining() bool {
+	return atomic.LoadInt32(&d.draining) == 1
+}
+
+// Check is a ReadyCheck that fails with ErrDraining once the application is draining
+func (d *Drainer) Check() error {
+	if d.Draining() {
+		return ErrDraining
+	}
+
+	return nil
+}
+
+// Then decorates a health handler so that it responds with a 503 once the application is draining
+func (d *Drainer) Then(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		if d.Draining() {
+			response.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		next.ServeHTTP(response, request)
+	})
+}
+
+// OnStop returns an uber/fx Lifecycle hook that marks the application as draining, then waits out the grace
+// period before returning.  If the context is canceled first, the hook stops waiting so that shutdown can
+// proceed within the uber/fx stop timeout.
+func (d *Drainer) OnStop(logger log.Logger) func(context.Context) error {
+	return func(ctx context.Context) error {
+		d.Drain()
+		logger.Log(
+			level.Key(), level.InfoValue(),
+			xlog.MessageKey(), "draining before shutdown",
+			"grace", d.grace,
+		)
+
+		timer := time.NewTimer(d.grace)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			logger.Log(
+				level.Key(), level.WarnValue(),
+				xlog.MessageKey(), "drain grace period cut short",
+				xlog.ErrorKey(), ctx.Err(),
+			)
+		}
+
+		return nil
+	}
+}
+
+// PreDrainIn holds the dependencies for the pre-drain hook
+type PreDrainIn struct {
+	fx.In
+
+	Logger    log.Logger
+	Lifecycle fx.Lifecycle
+	Drainer   *Drainer `optional:"true"`
+}
+
+// PreDrain is an uber/fx Invoke function that appends the Drainer's OnStop hook to the application lifecycle.
+// uber/fx runs OnStop hooks in the reverse order they were appended, so this must be invoked after every
+// server has been created in order for the grace period to elapse before any server begins shutting down.
+// If no Drainer was configured, this function does nothing.
+func PreDrain(in PreDrainIn) {
+	if in.Drainer != nil {
+		in.Lifecycle.Append(fx.Hook{
+			OnStop: in.Drainer.OnStop(in.Logger),
+		})
+	}
+}
@@ -2,6 +2,7 @@ package xhealth
 
 import (
 	"context"
+	"time"
 
 	health "github.com/InVisionApp/go-health"
 	"github.com/go-kit/kit/log"
@@ -17,6 +18,11 @@ type Options struct {
 
 	// Custom is an optional map passed to NewHandler that is included in all responses to health checks
 	Custom map[string]interface{}
+
+	// PreDrain is the grace period between marking the application unhealthy at shutdown and actually stopping
+	// its servers.  This gives load balancers time to deregister the application before connections are closed.
+	// If unset, shutdown begins immediately.  See PreDrain.
+	PreDrain time.Duration
 }
 
 // New constructs an IHealth instance for the given environment.  If either the DisableLogging option field
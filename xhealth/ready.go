@@ -0,0 +1,41 @@
+package xhealth
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ReadyCheck tests whether some component is ready for the application to receive traffic.  A nil
+// error indicates readiness.
+type ReadyCheck func() error
+
+// ReadyHandler is an http.Handler that reports application readiness
+type ReadyHandler http.Handler
+
+// Readiness is the JSON body written by a ReadyHandler
+type Readiness struct {
+	Ready  bool     `json:"ready"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+// NewReadyHandler creates a ReadyHandler which runs each check on every request.  If every check passes,
+// the response is a 200.  Otherwise, the response is a 503 listing the text of each failed check.  Load
+// balancers and orchestrators can poll this handler to hold back traffic until the application can serve it.
+func NewReadyHandler(checks ...ReadyCheck) ReadyHandler {
+	return http.HandlerFunc(func(response http.ResponseWriter, _ *http.Request) {
+		r := Readiness{Ready: true}
+		for _, c := range checks {
+			if err := c(); err != nil {
+				r.Ready = false
+				r.Errors = append(r.Errors, err.Error())
+			}
+		}
+
+		response.Header().Set("Content-Type", "application/json")
+		if !r.Ready {
+			response.WriteHeader(http.StatusServiceUnavailable)
+		}
+
+		json.NewEncoder(response).Encode(r)
+	})
+}
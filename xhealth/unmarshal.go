@@ -41,6 +41,9 @@ type HealthOut struct {
 
 	Health  health.IHealth
 	Handler Handler
+
+	// Drainer is only emitted when a PreDrain grace period is configured
+	Drainer *Drainer
 }
 
 // Unmarshal returns an uber/fx provider that reads configuration from a Viper
@@ -74,9 +77,15 @@ func Unmarshal(configKey string) func(HealthIn) (HealthOut, error) {
 			OnStop:  OnStop(in.Logger, h),
 		})
 
+		var d *Drainer
+		if o.PreDrain > 0 {
+			d = NewDrainer(o.PreDrain)
+		}
+
 		return HealthOut{
 			Health:  h,
 			Handler: NewHandler(h, o.Custom),
+			Drainer: d,
 		}, nil
 	}
 }
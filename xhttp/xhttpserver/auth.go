@@ -0,0 +1,342 @@
+package xhttpserver
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/xmidt-org/themis/config"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+	"go.uber.org/fx"
+)
+
+// AuthenticatorsGroup is the uber/fx value group from which custom RouteAuthenticators are collected
+const AuthenticatorsGroup = "xhttpserver.authenticators"
+
+// DefaultChallengeScheme is the authentication scheme of a Challenge when none is configured
+const DefaultChallengeScheme = "Bearer"
+
+var (
+	ErrAPIKeyHeaderRequired   = errors.New("An API key header is required")
+	ErrAPIKeysRequired        = errors.New("At least one API key is required")
+	ErrInvalidChallengeScheme = errors.New("A challenge scheme must be a single HTTP token, such as Bearer or Basic")
+)
+
+// UnauthorizedError indicates that a request did not supply any credentials
+type UnauthorizedError struct {
+	Reason string
+
+	// Challenge is the optional WWW-Authenticate challenge describing the credentials the client must supply
+	Challenge string
+}
+
+func (ue UnauthorizedError) Error() string {
+	return fmt.Sprintf("Unauthorized: %s", ue.Reason)
+}
+
+func (ue UnauthorizedError) StatusCode() int {
+	return http.StatusUnauthorized
+}
+
+// Headers supplies the WWW-Authenticate challenge, if any
+func (ue UnauthorizedError) Headers() http.Header {
+	if len(ue.Challenge) == 0 {
+		return nil
+	}
+
+	return http.Header{
+		"Www-Authenticate": []string{ue.Challenge},
+	}
+}
+
+// Challenge describes the WWW-Authenticate challenge of RFC 7235 that is sent with 401 responses, so
+// that clients can tell which credentials a route requires
+type Challenge struct {
+	// Scheme is the authentication scheme, e.g. Bearer or Basic.  If unset, DefaultChallengeScheme is used.
+	Scheme string
+
+	// Realm is the optional protection space of the route.  If unset, the challenge has no realm parameter.
+	Realm string
+}
+
+// isToken tests whether a value is an HTTP token, as defined by RFC 7230 section 3.2.6
+func isToken(v string) bool {
+	if len(v) == 0 {
+		return false
+	}
+
+	for _, c := range v {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", c):
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// NewChallenge produces the WWW-Authenticate header value for this Challenge
+func (c Challenge) NewChallenge() (string, error) {
+	scheme := c.Scheme
+	if len(scheme) == 0 {
+		scheme = DefaultChallengeScheme
+	}
+
+	if !isToken(scheme) {
+		return "", ErrInvalidChallengeScheme
+	}
+
+	if len(c.Realm) == 0 {
+		return scheme, nil
+	}
+
+	return fmt.Sprintf("%s realm=%q", scheme, c.Realm), nil
+}
+
+// ForbiddenError indicates that a request supplied credentials that were not accepted
+type ForbiddenError struct {
+	Reason string
+}
+
+func (fe ForbiddenError) Error() string {
+	return fmt.Sprintf("Forbidden: %s", fe.Reason)
+}
+
+func (fe ForbiddenError) StatusCode() int {
+	return http.StatusForbidden
+}
+
+// Authenticator is a strategy for validating the caller of an HTTP request.  Authenticate returns nil
+// if the caller is allowed to proceed.  Implementations should return an UnauthorizedError when no credentials
+// were supplied and a ForbiddenError when the credentials were rejected, though any error is permitted.
+// Errors without a status code result in http.StatusInternalServerError.
+type Authenticator interface {
+	Authenticate(*http.Request) error
+}
+
+type AuthenticatorFunc func(*http.Request) error
+
+func (af AuthenticatorFunc) Authenticate(request *http.Request) error {
+	return af(request)
+}
+
+// APIKey describes an Authenticator that requires one of a fixed set of keys in a request header
+type APIKey struct {
+	// Header is the HTTP header carrying the API key.  This field is required.
+	Header string
+
+	// Keys is the set of accepted API keys.  At least one key is required.
+	Keys []string
+
+	// Challenge is the optional WWW-Authenticate challenge sent when a request is missing the API key.
+	// If unset, 401 responses have no WWW-Authenticate header.
+	Challenge *Challenge
+}
+
+type apiKeyAuthenticator struct {
+	header    string
+	keys      [][]byte
+	challenge string
+}
+
+func (aka apiKeyAuthenticator) Authenticate(request *http.Request) error {
+	supplied := request.Header.Get(aka.header)
+	if len(supplied) == 0 {
+		return UnauthorizedError{
+			Reason:    fmt.Sprintf("missing %s header", aka.header),
+			Challenge: aka.challenge,
+		}
+	}
+
+	// compare against every key so the time taken does not reveal which key, if any, matched
+	matched := 0
+	for _, k := range aka.keys {
+		matched |= subtle.ConstantTimeCompare(k, []byte(supplied))
+	}
+
+	if matched == 0 {
+		return ForbiddenError{Reason: "invalid API key"}
+	}
+
+	return nil
+}
+
+// NewAuthenticator creates the Authenticator described by this APIKey configuration
+func (ak APIKey) NewAuthenticator() (Authenticator, error) {
+	if len(ak.Header) == 0 {
+		return nil, ErrAPIKeyHeaderRequired
+	}
+
+	if len(ak.Keys) == 0 {
+		return nil, ErrAPIKeysRequired
+	}
+
+	aka := apiKeyAuthenticator{
+		header: http.CanonicalHeaderKey(ak.Header),
+		keys:   make([][]byte, 0, len(ak.Keys)),
+	}
+
+	for _, k := range ak.Keys {
+		aka.keys = append(aka.keys, []byte(k))
+	}
+
+	if ak.Challenge != nil {
+		var err error
+		if aka.challenge, err = ak.Challenge.NewChallenge(); err != nil {
+			return nil, err
+		}
+	}
+
+	return aka, nil
+}
+
+// Authenticate is an Alice-style decorator that only passes requests to the decorated handler once the
+// Authenticator accepts the caller
+type Authenticate struct {
+	// Authenticator validates each request.  If unset, the next handler is returned undecorated.
+	Authenticator Authenticator
+
+	// ErrorEncoder writes the response for rejected requests.  If unset, kithttp.DefaultErrorEncoder is used.
+	ErrorEncoder kithttp.ErrorEncoder
+}
+
+func (a Authenticate) Then(next http.Handler) http.Handler {
+	if a.Authenticator == nil {
+		return next
+	}
+
+	errorEncoder := a.ErrorEncoder
+	if errorEncoder == nil {
+		errorEncoder = kithttp.DefaultErrorEncoder
+	}
+
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		if err := a.Authenticator.Authenticate(request); err != nil {
+			errorEncoder(request.Context(), err, response)
+			return
+		}
+
+		next.ServeHTTP(response, request)
+	})
+}
+
+func (a Authenticate) ThenFunc(next http.HandlerFunc) http.Handler {
+	return a.Then(next)
+}
+
+// RouteAuthenticator associates a custom Authenticator with a route.  Applications supply these to the
+// AuthenticatorsGroup value group to protect routes with something other than API keys.
+type RouteAuthenticator struct {
+	// Route is the path of the route being protected, e.g. /issue
+	Route string
+
+	// Authenticator validates callers of the route
+	Authenticator Authenticator
+}
+
+// Annotated emits this RouteAuthenticator into the AuthenticatorsGroup value group
+func (ra RouteAuthenticator) Annotated() fx.Annotated {
+	return fx.Annotated{
+		Group:  AuthenticatorsGroup,
+		Target: func() RouteAuthenticator { return ra },
+	}
+}
+
+// DuplicateAuthenticatorError indicates that more than one Authenticator was supplied for the same route
+type DuplicateAuthenticatorError struct {
+	Route string
+}
+
+func (dae DuplicateAuthenticatorError) Error() string {
+	return fmt.Sprintf("More than one authenticator is configured for route %s", dae.Route)
+}
+
+// UnknownRouteError indicates that an Authenticator was configured for a route that is not served, e.g. because
+// of a typo, which would otherwise leave the route it was meant to protect unprotected
+type UnknownRouteError struct {
+	Route string
+}
+
+func (ure UnknownRouteError) Error() string {
+	return fmt.Sprintf("An authenticator is configured for unknown route %s", ure.Route)
+}
+
+// Authenticators holds the Authenticator for each protected route, keyed by route path.  Routes without
+// an Authenticator are not protected.
+type Authenticators map[string]Authenticator
+
+// Then decorates the handler for the given route with that route's Authenticator, if any
+func (a Authenticators) Then(route string, next http.Handler) http.Handler {
+	return Authenticate{Authenticator: a[route]}.Then(next)
+}
+
+// CheckRoutes returns an UnknownRouteError if any Authenticator is for a route other than the given ones
+func (a Authenticators) CheckRoutes(routes ...string) error {
+	known := make(map[string]bool, len(routes))
+	for _, r := range routes {
+		known[r] = true
+	}
+
+	unknown := make([]string, 0, len(a))
+	for r := range a {
+		if !known[r] {
+			unknown = append(unknown, r)
+		}
+	}
+
+	if len(unknown) > 0 {
+		// report the same route on every startup
+		sort.Strings(unknown)
+		return UnknownRouteError{Route: unknown[0]}
+	}
+
+	return nil
+}
+
+// AuthenticatorsIn holds the dependencies for building Authenticators
+type AuthenticatorsIn struct {
+	fx.In
+
+	Unmarshaller config.Unmarshaller
+
+	// Custom are the application-supplied Authenticators for particular routes
+	Custom []RouteAuthenticator `group:"xhttpserver.authenticators"`
+}
+
+// UnmarshalAuthenticators returns an uber/fx provider of Authenticators.  The configuration key, if present, holds
+// a map of route paths to APIKey configurations.  Any RouteAuthenticators in the AuthenticatorsGroup value group
+// are added as well.  A route may only have one Authenticator.
+func UnmarshalAuthenticators(configKey string) func(AuthenticatorsIn) (Authenticators, error) {
+	return func(in AuthenticatorsIn) (Authenticators, error) {
+		var apiKeys map[string]APIKey
+		if err := in.Unmarshaller.UnmarshalKey(configKey, &apiKeys); err != nil {
+			return nil, err
+		}
+
+		a := make(Authenticators, len(apiKeys)+len(in.Custom))
+		for route, ak := range apiKeys {
+			authenticator, err := ak.NewAuthenticator()
+			if err != nil {
+				return nil, fmt.Errorf("Invalid API key configuration for route %s: %s", route, err)
+			}
+
+			a[route] = authenticator
+		}
+
+		for _, ra := range in.Custom {
+			if _, exists := a[ra.Route]; exists {
+				return nil, DuplicateAuthenticatorError{Route: ra.Route}
+			}
+
+			a[ra.Route] = ra.Authenticator
+		}
+
+		return a, nil
+	}
+}
@@ -0,0 +1,378 @@
+package xhttpserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/xmidt-org/themis/config"
+	"github.com/xmidt-org/themis/xlog"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+func TestUnauthorizedError(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		err error = UnauthorizedError{Reason: "no credentials"}
+	)
+
+	assert.Contains(err.Error(), "no credentials")
+	assert.Equal(http.StatusUnauthorized, err.(UnauthorizedError).StatusCode())
+	assert.Nil(err.(UnauthorizedError).Headers())
+
+	err = UnauthorizedError{Reason: "no credentials", Challenge: `Bearer realm="themis"`}
+	assert.Equal(
+		http.Header{"Www-Authenticate": []string{`Bearer realm="themis"`}},
+		err.(UnauthorizedError).Headers(),
+	)
+}
+
+func TestChallenge(t *testing.T) {
+	testData := []struct {
+		challenge Challenge
+		expected  string
+	}{
+		{Challenge{}, "Bearer"},
+		{Challenge{Realm: "themis"}, `Bearer realm="themis"`},
+		{Challenge{Scheme: "Basic", Realm: "themis"}, `Basic realm="themis"`},
+		{Challenge{Scheme: "Basic", Realm: `a "quoted" realm`}, `Basic realm="a \"quoted\" realm"`},
+		{Challenge{Scheme: "Custom-Scheme"}, "Custom-Scheme"},
+	}
+
+	for _, record := range testData {
+		t.Run(record.expected, func(t *testing.T) {
+			challenge, err := record.challenge.NewChallenge()
+			assert.NoError(t, err)
+			assert.Equal(t, record.expected, challenge)
+		})
+	}
+
+	for _, scheme := range []string{"Bearer realm", `"Bearer"`, "Bearer,Basic"} {
+		t.Run("Invalid", func(t *testing.T) {
+			challenge, err := Challenge{Scheme: scheme}.NewChallenge()
+			assert.Empty(t, challenge)
+			assert.Equal(t, ErrInvalidChallengeScheme, err)
+		})
+	}
+}
+
+func TestForbiddenError(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		err error = ForbiddenError{Reason: "bad credentials"}
+	)
+
+	assert.Contains(err.Error(), "bad credentials")
+	assert.Equal(http.StatusForbidden, err.(ForbiddenError).StatusCode())
+}
+
+func TestDuplicateAuthenticatorError(t *testing.T) {
+	assert.Contains(t, DuplicateAuthenticatorError{Route: "/issue"}.Error(), "/issue")
+}
+
+func testAPIKeyInvalid(t *testing.T, ak APIKey, expectedErr error) {
+	assert := assert.New(t)
+	a, err := ak.NewAuthenticator()
+	assert.Nil(a)
+	assert.Equal(expectedErr, err)
+}
+
+func testAPIKeyAuthenticate(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		a, err = APIKey{Header: "x-api-key", Keys: []string{"first", "second"}}.NewAuthenticator()
+	)
+
+	require.NoError(err)
+	require.NotNil(a)
+
+	for _, k := range []string{"first", "second"} {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.Header.Set("X-Api-Key", k)
+		assert.NoError(a.Authenticate(request))
+	}
+
+	request := httptest.NewRequest("GET", "/", nil)
+	assert.IsType(UnauthorizedError{}, a.Authenticate(request))
+
+	request.Header.Set("X-Api-Key", "firs")
+	assert.IsType(ForbiddenError{}, a.Authenticate(request))
+
+	request.Header.Set("X-Api-Key", "unknown")
+	assert.IsType(ForbiddenError{}, a.Authenticate(request))
+}
+
+func testAPIKeyChallenge(t *testing.T, scheme string) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		ak = APIKey{Header: "X-Api-Key", Keys: []string{"key"}}
+	)
+
+	if len(scheme) > 0 {
+		ak.Challenge = &Challenge{Scheme: scheme, Realm: "themis"}
+	}
+
+	a, err := ak.NewAuthenticator()
+	require.NoError(err)
+
+	handler := Authenticate{Authenticator: a}.ThenFunc(func(response http.ResponseWriter, _ *http.Request) {
+		response.WriteHeader(299)
+	})
+
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/issue", nil))
+	assert.Equal(http.StatusUnauthorized, response.Code)
+	if len(scheme) > 0 {
+		assert.Equal([]string{scheme + ` realm="themis"`}, response.HeaderMap["Www-Authenticate"])
+	} else {
+		assert.NotContains(response.HeaderMap, "Www-Authenticate")
+	}
+
+	// rejected keys produce a 403, which carries no challenge
+	response = httptest.NewRecorder()
+	request := httptest.NewRequest("GET", "/issue", nil)
+	request.Header.Set("X-Api-Key", "unknown")
+	handler.ServeHTTP(response, request)
+	assert.Equal(http.StatusForbidden, response.Code)
+	assert.NotContains(response.HeaderMap, "Www-Authenticate")
+
+	response = httptest.NewRecorder()
+	request.Header.Set("X-Api-Key", "key")
+	handler.ServeHTTP(response, request)
+	assert.Equal(299, response.Code)
+}
+
+func TestAPIKey(t *testing.T) {
+	t.Run("NoHeader", func(t *testing.T) {
+		testAPIKeyInvalid(t, APIKey{Keys: []string{"key"}}, ErrAPIKeyHeaderRequired)
+	})
+
+	t.Run("NoKeys", func(t *testing.T) {
+		testAPIKeyInvalid(t, APIKey{Header: "X-Api-Key"}, ErrAPIKeysRequired)
+	})
+
+	t.Run("InvalidChallenge", func(t *testing.T) {
+		testAPIKeyInvalid(t, APIKey{Header: "X-Api-Key", Keys: []string{"key"}, Challenge: &Challenge{Scheme: "not a token"}}, ErrInvalidChallengeScheme)
+	})
+
+	t.Run("Authenticate", testAPIKeyAuthenticate)
+
+	for _, scheme := range []string{"Bearer", "Basic"} {
+		t.Run(scheme+"Challenge", func(t *testing.T) { testAPIKeyChallenge(t, scheme) })
+	}
+
+	t.Run("NoChallenge", func(t *testing.T) { testAPIKeyChallenge(t, "") })
+}
+
+func testAuthenticateNil(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		response = httptest.NewRecorder()
+		handler  = Authenticate{}.ThenFunc(func(response http.ResponseWriter, _ *http.Request) {
+			response.WriteHeader(299)
+		})
+	)
+
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(299, response.Code)
+}
+
+func testAuthenticate(t *testing.T, a Authenticate, authErr error, expectedStatusCode int) {
+	var (
+		assert = assert.New(t)
+
+		called   bool
+		response = httptest.NewRecorder()
+		request  = httptest.NewRequest("GET", "/", nil)
+	)
+
+	a.Authenticator = AuthenticatorFunc(func(actual *http.Request) error {
+		assert.Equal(request, actual)
+		return authErr
+	})
+
+	handler := a.ThenFunc(func(response http.ResponseWriter, _ *http.Request) {
+		called = true
+		response.WriteHeader(299)
+	})
+
+	handler.ServeHTTP(response, request)
+	assert.Equal(expectedStatusCode, response.Code)
+	assert.Equal(authErr == nil, called)
+}
+
+func TestAuthenticate(t *testing.T) {
+	t.Run("Nil", testAuthenticateNil)
+
+	t.Run("Authorized", func(t *testing.T) {
+		testAuthenticate(t, Authenticate{}, nil, 299)
+	})
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		testAuthenticate(t, Authenticate{}, UnauthorizedError{}, http.StatusUnauthorized)
+	})
+
+	t.Run("Forbidden", func(t *testing.T) {
+		testAuthenticate(t, Authenticate{}, ForbiddenError{}, http.StatusForbidden)
+	})
+
+	t.Run("NoStatusCode", func(t *testing.T) {
+		testAuthenticate(t, Authenticate{}, errors.New("expected"), http.StatusInternalServerError)
+	})
+
+	t.Run("CustomErrorEncoder", func(t *testing.T) {
+		testAuthenticate(
+			t,
+			Authenticate{
+				ErrorEncoder: func(_ context.Context, _ error, response http.ResponseWriter) {
+					response.WriteHeader(477)
+				},
+			},
+			ForbiddenError{},
+			477,
+		)
+	})
+}
+
+func testUnmarshalAuthenticatorsSuccess(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		authenticators Authenticators
+		app            = fxtest.New(t,
+			fx.Provide(
+				config.ProvideViper(
+					config.Json(`
+						{
+							"authentication": {
+								"/issue": {
+									"header": "X-Api-Key",
+									"keys": ["issue-key"]
+								}
+							}
+						}
+					`),
+				),
+				RouteAuthenticator{
+					Route: "/claims",
+					Authenticator: AuthenticatorFunc(func(request *http.Request) error {
+						if request.Header.Get("Authorization") != "Bearer claims-token" {
+							return UnauthorizedError{Reason: "bearer token required"}
+						}
+
+						return nil
+					}),
+				}.Annotated(),
+				UnmarshalAuthenticators("authentication"),
+			),
+			fx.Populate(&authenticators),
+		)
+	)
+
+	app.RequireStart()
+	defer app.RequireStop()
+	require.Len(authenticators, 2)
+
+	next := http.HandlerFunc(func(response http.ResponseWriter, _ *http.Request) {
+		response.WriteHeader(299)
+	})
+
+	testData := []struct {
+		route              string
+		header             string
+		value              string
+		expectedStatusCode int
+	}{
+		{"/issue", "X-Api-Key", "issue-key", 299},
+		{"/issue", "", "", http.StatusUnauthorized},
+		{"/issue", "X-Api-Key", "claims-token", http.StatusForbidden},
+		{"/claims", "Authorization", "Bearer claims-token", 299},
+		{"/claims", "X-Api-Key", "issue-key", http.StatusUnauthorized},
+		{"/unprotected", "", "", 299},
+	}
+
+	for _, record := range testData {
+		var (
+			response = httptest.NewRecorder()
+			request  = httptest.NewRequest("GET", record.route, nil)
+		)
+
+		if len(record.header) > 0 {
+			request.Header.Set(record.header, record.value)
+		}
+
+		authenticators.Then(record.route, next).ServeHTTP(response, request)
+		assert.Equal(record.expectedStatusCode, response.Code, record.route)
+	}
+}
+
+func testUnmarshalAuthenticatorsError(t *testing.T, options ...fx.Option) {
+	var (
+		assert = assert.New(t)
+
+		authenticators Authenticators
+		app            = fx.New(
+			append(
+				options,
+				fx.Logger(xlog.DiscardPrinter{}),
+				fx.Provide(UnmarshalAuthenticators("authentication")),
+				fx.Populate(&authenticators),
+			)...,
+		)
+	)
+
+	assert.Error(app.Err())
+	assert.Nil(authenticators)
+}
+
+func TestAuthenticatorsCheckRoutes(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		allow  = AuthenticatorFunc(func(*http.Request) error { return nil })
+	)
+
+	assert.NoError(Authenticators(nil).CheckRoutes("/issue"))
+	assert.NoError(Authenticators{"/issue": allow, "/keys": allow}.CheckRoutes("/issue", "/keys", "/claims"))
+
+	err := Authenticators{"/isue": allow, "/issue": allow, "/keyz": allow}.CheckRoutes("/issue", "/keys")
+	assert.Equal(UnknownRouteError{Route: "/isue"}, err)
+	assert.NotEmpty(err.Error())
+}
+
+func TestUnmarshalAuthenticators(t *testing.T) {
+	t.Run("Success", testUnmarshalAuthenticatorsSuccess)
+
+	t.Run("InvalidAPIKey", func(t *testing.T) {
+		testUnmarshalAuthenticatorsError(t,
+			fx.Provide(
+				config.ProvideViper(
+					config.Json(`{"authentication": {"/issue": {"keys": ["key"]}}}`),
+				),
+			),
+		)
+	})
+
+	t.Run("Duplicate", func(t *testing.T) {
+		testUnmarshalAuthenticatorsError(t,
+			fx.Provide(
+				config.ProvideViper(
+					config.Json(`{"authentication": {"/issue": {"header": "X-Api-Key", "keys": ["key"]}}}`),
+				),
+				RouteAuthenticator{Route: "/issue", Authenticator: AuthenticatorFunc(func(*http.Request) error { return nil })}.Annotated(),
+			),
+		)
+	})
+}
@@ -0,0 +1,100 @@
+package xhttpserver
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/xmidt-org/themis/xlog"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+const (
+	// DefaultBindRetryInterval is the time to wait before the first retry when no interval is configured
+	DefaultBindRetryInterval time.Duration = 500 * time.Millisecond
+
+	// DefaultBindRetryMaxInterval is the upper bound on the time between retries when none is configured
+	DefaultBindRetryMaxInterval time.Duration = 5 * time.Second
+)
+
+// BindRetry describes how a server retries binding to an address that is still in use, as happens when
+// a restarted container's previous process has not yet released its port.  Other bind errors are never retried.
+type BindRetry struct {
+	// Attempts is the number of retries after the initial bind fails.  If nonpositive, no retries are made.
+	Attempts int
+
+	// Interval is the time to wait before the first retry.  Each subsequent wait is doubled, up to MaxInterval.
+	// If unset, DefaultBindRetryInterval is used.
+	Interval time.Duration
+
+	// MaxInterval is the upper bound on the time between retries.  If unset, DefaultBindRetryMaxInterval is used.
+	MaxInterval time.Duration
+}
+
+func (br BindRetry) interval() time.Duration {
+	if br.Interval > 0 {
+		return br.Interval
+	}
+
+	return DefaultBindRetryInterval
+}
+
+func (br BindRetry) maxInterval() time.Duration {
+	if br.MaxInterval > 0 {
+		return br.MaxInterval
+	}
+
+	return DefaultBindRetryMaxInterval
+}
+
+// isAddressInUse tests if a bind error is due to the address already being in use
+func isAddressInUse(err error) bool {
+	return errors.Is(err, syscall.EADDRINUSE)
+}
+
+// listen binds a Listener for the given options, retrying as configured by o.BindRetry.  Waiting
+// between retries is interrupted if the context is canceled, in which case the last bind error is returned.
+func listen(ctx context.Context, o Options, lcfg net.ListenConfig, tcfg *tls.Config, logger log.Logger) (net.Listener, error) {
+	l, err := NewListener(ctx, o, lcfg, tcfg)
+	if err == nil {
+		return l, nil
+	} else if o.BindRetry == nil {
+		return nil, err
+	}
+
+	interval := o.BindRetry.interval()
+	for attempt := 1; attempt <= o.BindRetry.Attempts && isAddressInUse(err); attempt++ {
+		logger.Log(
+			level.Key(), level.WarnValue(),
+			AddressKey(), o.Address,
+			xlog.MessageKey(), "address in use, retrying bind",
+			xlog.ErrorKey(), err,
+			"attempt", attempt,
+			"interval", interval,
+		)
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+
+		case <-timer.C:
+		}
+
+		if l, err = NewListener(ctx, o, lcfg, tcfg); err == nil {
+			return l, nil
+		}
+
+		if interval *= 2; interval > o.BindRetry.maxInterval() {
+			interval = o.BindRetry.maxInterval()
+		}
+	}
+
+	return nil, err
+}
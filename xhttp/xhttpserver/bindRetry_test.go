@@ -0,0 +1,160 @@
+package xhttpserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/xmidt-org/themis/xlog/xlogtest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBindRetry(t *testing.T) {
+	var (
+		assert = assert.New(t)
+	)
+
+	assert.Equal(DefaultBindRetryInterval, BindRetry{}.interval())
+	assert.Equal(DefaultBindRetryMaxInterval, BindRetry{}.maxInterval())
+	assert.Equal(time.Second, BindRetry{Interval: time.Second}.interval())
+	assert.Equal(time.Minute, BindRetry{MaxInterval: time.Minute}.maxInterval())
+}
+
+// holdAddress binds an ephemeral port, returning the listener holding it
+func holdAddress(t *testing.T) net.Listener {
+	held, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	return held
+}
+
+func testListenNoRetry(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		held   = holdAddress(t)
+	)
+
+	defer held.Close()
+	l, err := listen(context.Background(), Options{Address: held.Addr().String()}, net.ListenConfig{}, nil, xlogtest.New(t))
+	assert.Nil(l)
+	assert.True(isAddressInUse(err))
+}
+
+func testListenRetriesExhausted(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		held   = holdAddress(t)
+
+		o = Options{
+			Address:   held.Addr().String(),
+			BindRetry: &BindRetry{Attempts: 2, Interval: 10 * time.Millisecond},
+		}
+	)
+
+	defer held.Close()
+	start := time.Now()
+	l, err := listen(context.Background(), o, net.ListenConfig{}, nil, xlogtest.New(t))
+	assert.Nil(l)
+	assert.True(isAddressInUse(err))
+	assert.True(time.Since(start) >= 30*time.Millisecond)
+}
+
+func testListenCanceled(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		held   = holdAddress(t)
+
+		o = Options{
+			Address:   held.Addr().String(),
+			BindRetry: &BindRetry{Attempts: 100, Interval: time.Hour},
+		}
+
+		ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	)
+
+	defer cancel()
+	defer held.Close()
+	l, err := listen(ctx, o, net.ListenConfig{}, nil, xlogtest.New(t))
+	assert.Nil(l)
+	assert.True(isAddressInUse(err))
+}
+
+func testListenNotRetryable(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		o = Options{
+			Address:   "this is not a valid address",
+			BindRetry: &BindRetry{Attempts: 100, Interval: time.Hour},
+		}
+	)
+
+	l, err := listen(context.Background(), o, net.ListenConfig{}, nil, xlogtest.New(t))
+	assert.Nil(l)
+	assert.Error(err)
+	assert.False(isAddressInUse(err))
+}
+
+func TestListen(t *testing.T) {
+	t.Run("NoRetry", testListenNoRetry)
+	t.Run("RetriesExhausted", testListenRetriesExhausted)
+	t.Run("Canceled", testListenCanceled)
+	t.Run("NotRetryable", testListenNotRetryable)
+}
+
+func TestOnStartBindRetry(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		held    = holdAddress(t)
+		address = held.Addr().String()
+		serve   = make(chan net.Listener, 1)
+		s       = new(mockServer)
+		onStart = OnStart(
+			Options{
+				Address:   address,
+				BindRetry: &BindRetry{Attempts: 20, Interval: 10 * time.Millisecond, MaxInterval: 50 * time.Millisecond},
+			},
+			s,
+			xlogtest.New(t),
+			nil,
+			nil,
+		)
+	)
+
+	s.ExpectServe(mock.MatchedBy(func(net.Listener) bool { return true })).Once().Return(http.ErrServerClosed).
+		Run(func(arguments mock.Arguments) {
+			serve <- arguments.Get(0).(net.Listener)
+		})
+
+	// the previous process lets go of the port shortly after startup begins
+	time.AfterFunc(100*time.Millisecond, func() { held.Close() })
+
+	require.NoError(onStart(context.Background()))
+	select {
+	case l := <-serve:
+		assert.Equal(address, l.Addr().String())
+		l.Close()
+	case <-time.After(time.Second):
+		assert.Fail("Serve was not called")
+	}
+
+	s.AssertExpectations(t)
+}
+
+func TestIsAddressInUse(t *testing.T) {
+	var (
+		assert = assert.New(t)
+	)
+
+	assert.True(isAddressInUse(&net.OpError{Op: "listen", Err: os.NewSyscallError("bind", syscall.EADDRINUSE)}))
+	assert.False(isAddressInUse(errors.New("expected")))
+}
@@ -1,10 +1,18 @@
 package xhttpserver
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"io/ioutil"
+	"math/big"
 	"os"
 	"testing"
+	"time"
 )
 
 // serverPrivateKey is a pregenerated RSA key for testing TLS connections
@@ -142,3 +150,68 @@ func createServerFiles(t *testing.T) (certificateFilePath, keyFilePath string) {
 
 	return
 }
+
+// writeGeneratedServerFiles generates a self-signed certificate with the given common name and
+// writes it, along with its key, to the given paths.  Existing files are overwritten.
+func writeGeneratedServerFiles(t *testing.T, commonName, certificateFilePath, keyFilePath string) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate server key: %s", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		t.Fatalf("Unable to create server certificate: %s", err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(privateKey)
+	if err != nil {
+		t.Fatalf("Unable to marshal server key: %s", err)
+	}
+
+	err = ioutil.WriteFile(certificateFilePath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	if err != nil {
+		t.Fatalf("Unable to write server certificate file '%s': %s", certificateFilePath, err)
+	}
+
+	err = ioutil.WriteFile(keyFilePath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	if err != nil {
+		t.Fatalf("Unable to write server key file '%s': %s", keyFilePath, err)
+	}
+}
+
+// createGeneratedServerFiles is like createServerFiles, except that a freshly generated certificate
+// with the given common name is used instead of the prebaked certificate.
+func createGeneratedServerFiles(t *testing.T, commonName string) (certificateFilePath, keyFilePath string) {
+	certificateFilePath, keyFilePath = createServerFiles(t)
+	writeGeneratedServerFiles(t, commonName, certificateFilePath, keyFilePath)
+	return
+}
+
+// createOCSPStapleFile writes an arbitrary OCSP response to a temporary file.  The contents are not
+// a valid OCSP response, since the TLS stack staples the bytes without interpreting them.
+func createOCSPStapleFile(t *testing.T, staple []byte) string {
+	stapleFile, err := ioutil.TempFile("", "server.*.ocsp")
+	if err != nil {
+		t.Fatalf("Unable to create OCSP staple file: %s", err)
+	}
+
+	stapleFilePath := stapleFile.Name()
+	_, err = stapleFile.Write(staple)
+	stapleFile.Close()
+	if err != nil {
+		os.Remove(stapleFilePath)
+		t.Fatalf("Unable to write OCSP staple file '%s': %s", stapleFilePath, err)
+	}
+
+	return stapleFilePath
+}
@@ -0,0 +1,48 @@
+package xhttpserver
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// ConnCache holds arbitrary values derived from a single connection, such as claims computed from the
+// peer's TLS certificate, so that every request over a kept-alive connection can reuse them.  A ConnCache
+// is discarded along with its connection.  It is safe for concurrent use, e.g. by HTTP/2 streams.
+type ConnCache struct {
+	lock   sync.Mutex
+	values map[interface{}]interface{}
+}
+
+// Get returns the value cached under the given key
+func (cc *ConnCache) Get(key interface{}) (interface{}, bool) {
+	cc.lock.Lock()
+	v, ok := cc.values[key]
+	cc.lock.Unlock()
+	return v, ok
+}
+
+// Set caches a value under the given key, replacing any existing value
+func (cc *ConnCache) Set(key, value interface{}) {
+	cc.lock.Lock()
+	if cc.values == nil {
+		cc.values = make(map[interface{}]interface{})
+	}
+
+	cc.values[key] = value
+	cc.lock.Unlock()
+}
+
+type connCacheKey struct{}
+
+// NewConnContext is an http.Server ConnContext function that gives each connection its own ConnCache
+func NewConnContext(ctx context.Context, _ net.Conn) context.Context {
+	return context.WithValue(ctx, connCacheKey{}, new(ConnCache))
+}
+
+// GetConnCache returns the ConnCache for the connection a request arrived over.  If the server does not
+// cache connection values, this function returns false.
+func GetConnCache(ctx context.Context) (*ConnCache, bool) {
+	cc, ok := ctx.Value(connCacheKey{}).(*ConnCache)
+	return cc, ok
+}
@@ -0,0 +1,70 @@
+package xhttpserver
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testConnCacheGetSet(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		cc     = new(ConnCache)
+	)
+
+	v, ok := cc.Get("key")
+	assert.Nil(v)
+	assert.False(ok)
+
+	cc.Set("key", "value")
+	v, ok = cc.Get("key")
+	assert.Equal("value", v)
+	assert.True(ok)
+
+	cc.Set("key", "replaced")
+	v, ok = cc.Get("key")
+	assert.Equal("replaced", v)
+	assert.True(ok)
+}
+
+func testConnCacheContext(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	cc, ok := GetConnCache(context.Background())
+	assert.Nil(cc)
+	assert.False(ok)
+
+	first, ok := GetConnCache(NewConnContext(context.Background(), nil))
+	require.True(ok)
+	require.NotNil(first)
+
+	// each connection has its own cache
+	second, ok := GetConnCache(NewConnContext(context.Background(), nil))
+	require.True(ok)
+	first.Set("key", "value")
+	_, ok = second.Get("key")
+	assert.False(ok)
+}
+
+func testConnCacheServer(t *testing.T) {
+	assert := assert.New(t)
+
+	s := New(Options{}, log.NewNopLogger(), http.NotFoundHandler())
+	assert.Nil(s.(*http.Server).ConnContext)
+
+	s = New(Options{ConnectionCache: true}, log.NewNopLogger(), http.NotFoundHandler())
+	assert.NotNil(s.(*http.Server).ConnContext)
+}
+
+func TestConnCache(t *testing.T) {
+	t.Run("GetSet", testConnCacheGetSet)
+	t.Run("Context", testConnCacheContext)
+	t.Run("Server", testConnCacheServer)
+}
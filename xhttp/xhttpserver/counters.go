@@ -0,0 +1,90 @@
+package xhttpserver
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Counters are the runtime counters for a single server.  All methods are safe for concurrent use.
+type Counters struct {
+	panics       uint64
+	serverErrors uint64
+}
+
+// AddPanic records a panic recovered from a handler
+func (c *Counters) AddPanic() {
+	atomic.AddUint64(&c.panics, 1)
+}
+
+// Panics returns the number of panics recovered from handlers
+func (c *Counters) Panics() uint64 {
+	return atomic.LoadUint64(&c.panics)
+}
+
+// AddServerError records a response with a 5xx status code
+func (c *Counters) AddServerError() {
+	atomic.AddUint64(&c.serverErrors, 1)
+}
+
+// ServerErrors returns the number of responses sent with a 5xx status code, including those
+// sent because a handler panicked
+func (c *Counters) ServerErrors() uint64 {
+	return atomic.LoadUint64(&c.serverErrors)
+}
+
+// CounterValues is a point-in-time copy of a server's Counters
+type CounterValues struct {
+	Panics       uint64 `json:"panics"`
+	ServerErrors uint64 `json:"serverErrors"`
+}
+
+// ServerCounters holds the Counters for each server in an application, keyed by server name.  Supplying
+// a *ServerCounters component enables panic recovery and error counting for every server created with Unmarshal.
+// This is an alternative to metrics for code that needs programmatic access to these counts.
+type ServerCounters struct {
+	lock    sync.RWMutex
+	servers map[string]*Counters
+}
+
+// NewServerCounters creates an empty ServerCounters.  This function can be used directly as an uber/fx provider.
+func NewServerCounters() *ServerCounters {
+	return &ServerCounters{
+		servers: make(map[string]*Counters),
+	}
+}
+
+// Get returns the Counters for the given server, creating them if necessary
+func (sc *ServerCounters) Get(server string) *Counters {
+	sc.lock.RLock()
+	c, ok := sc.servers[server]
+	sc.lock.RUnlock()
+
+	if ok {
+		return c
+	}
+
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+	if c, ok = sc.servers[server]; !ok {
+		c = new(Counters)
+		sc.servers[server] = c
+	}
+
+	return c
+}
+
+// Values returns the current counter values for every server
+func (sc *ServerCounters) Values() map[string]CounterValues {
+	sc.lock.RLock()
+	defer sc.lock.RUnlock()
+
+	values := make(map[string]CounterValues, len(sc.servers))
+	for server, c := range sc.servers {
+		values[server] = CounterValues{
+			Panics:       c.Panics(),
+			ServerErrors: c.ServerErrors(),
+		}
+	}
+
+	return values
+}
@@ -0,0 +1,56 @@
+package xhttpserver
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounters(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		c      = new(Counters)
+		wg     sync.WaitGroup
+	)
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.AddPanic()
+			c.AddServerError()
+			c.AddServerError()
+		}()
+	}
+
+	wg.Wait()
+	assert.Equal(uint64(10), c.Panics())
+	assert.Equal(uint64(20), c.ServerErrors())
+}
+
+func TestServerCounters(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		sc     = NewServerCounters()
+	)
+
+	assert.Empty(sc.Values())
+
+	first := sc.Get("first")
+	assert.NotNil(first)
+	assert.True(first == sc.Get("first"))
+
+	second := sc.Get("second")
+	assert.False(first == second)
+
+	first.AddPanic()
+	second.AddServerError()
+	assert.Equal(
+		map[string]CounterValues{
+			"first":  CounterValues{Panics: 1},
+			"second": CounterValues{ServerErrors: 1},
+		},
+		sc.Values(),
+	)
+}
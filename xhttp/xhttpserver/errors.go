@@ -5,29 +5,36 @@ import (
 	"net/http"
 )
 
-// MissingValueError indicates a missing header or parameter in a request (or both)
+// MissingValueError indicates a missing header, parameter, cookie, or TLS server name in a request (or any combination)
 type MissingValueError struct {
-	Header    string
-	Parameter string
+	Header     string
+	Parameter  string
+	Cookie     string
+	ServerName bool
 }
 
 func (mve MissingValueError) Error() string {
 	var output bytes.Buffer
 	output.WriteString("Missing value from")
-	if len(mve.Header) > 0 {
-		output.WriteString(" header '")
-		output.WriteString(mve.Header)
-		output.WriteString("'")
-
-		if len(mve.Parameter) > 0 {
-			output.WriteString(" or parameter '")
-			output.WriteString(mve.Parameter)
+
+	separator := " "
+	writeSource := func(kind, name string) {
+		if len(name) > 0 {
+			output.WriteString(separator)
+			output.WriteString(kind)
+			output.WriteString(" '")
+			output.WriteString(name)
 			output.WriteString("'")
+			separator = " or "
 		}
-	} else if len(mve.Parameter) > 0 {
-		output.WriteString(" parameter '")
-		output.WriteString(mve.Parameter)
-		output.WriteString("'")
+	}
+
+	writeSource("header", mve.Header)
+	writeSource("parameter", mve.Parameter)
+	writeSource("cookie", mve.Cookie)
+	if mve.ServerName {
+		output.WriteString(separator)
+		output.WriteString("TLS server name")
 	}
 
 	return output.String()
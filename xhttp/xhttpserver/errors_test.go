@@ -45,6 +45,57 @@ func TestMissingValueError(t *testing.T) {
 		assert.Contains(mve.Error(), "stuff")
 		assert.Equal(http.StatusBadRequest, mve.StatusCode())
 	})
+
+	t.Run("Cookie", func(t *testing.T) {
+		var (
+			assert = assert.New(t)
+			mve    = MissingValueError{
+				Cookie: "session",
+			}
+		)
+
+		assert.Equal("Missing value from cookie 'session'", mve.Error())
+		assert.Equal(http.StatusBadRequest, mve.StatusCode())
+	})
+
+	t.Run("All", func(t *testing.T) {
+		var (
+			assert = assert.New(t)
+			mve    = MissingValueError{
+				Header:    "X-Stuff",
+				Parameter: "stuff",
+				Cookie:    "session",
+			}
+		)
+
+		assert.Equal("Missing value from header 'X-Stuff' or parameter 'stuff' or cookie 'session'", mve.Error())
+		assert.Equal(http.StatusBadRequest, mve.StatusCode())
+	})
+
+	t.Run("ServerName", func(t *testing.T) {
+		var (
+			assert = assert.New(t)
+			mve    = MissingValueError{
+				ServerName: true,
+			}
+		)
+
+		assert.Equal("Missing value from TLS server name", mve.Error())
+		assert.Equal(http.StatusBadRequest, mve.StatusCode())
+	})
+
+	t.Run("HeaderAndServerName", func(t *testing.T) {
+		var (
+			assert = assert.New(t)
+			mve    = MissingValueError{
+				Header:     "X-Stuff",
+				ServerName: true,
+			}
+		)
+
+		assert.Equal("Missing value from header 'X-Stuff' or TLS server name", mve.Error())
+		assert.Equal(http.StatusBadRequest, mve.StatusCode())
+	})
 }
 
 func TestMissingVariableError(t *testing.T) {
@@ -0,0 +1,291 @@
+package xhttpserver
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const ForwardedHeader = "Forwarded"
+
+var (
+	ErrInvalidForwarded = errors.New("Invalid Forwarded header")
+)
+
+// InvalidTrustedProxyError indicates that a configured trusted proxy is neither an IP address nor a CIDR block
+type InvalidTrustedProxyError struct {
+	Value string
+}
+
+func (e InvalidTrustedProxyError) Error() string {
+	return fmt.Sprintf("Invalid trusted proxy %s: must be an IP address or CIDR block", e.Value)
+}
+
+// TrustedProxies is a set of networks whose requests are allowed to describe the original client
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies parses each value as either a CIDR block or a single IP address
+func ParseTrustedProxies(values []string) (TrustedProxies, error) {
+	var tp TrustedProxies
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if _, n, err := net.ParseCIDR(v); err == nil {
+			tp = append(tp, n)
+			continue
+		}
+
+		ip := net.ParseIP(v)
+		if ip == nil {
+			return nil, InvalidTrustedProxyError{Value: v}
+		}
+
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+
+		tp = append(tp, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+	}
+
+	return tp, nil
+}
+
+// Contains tests if the given IP is within any of these trusted networks
+func (tp TrustedProxies) Contains(ip net.IP) bool {
+	for _, n := range tp {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ForwardedElement is a single hop from an RFC 7239 Forwarded header.  Only the for, proto, and host
+// parameters are retained.
+type ForwardedElement struct {
+	For   string
+	Proto string
+	Host  string
+}
+
+// forIP returns the IP address and port, if any, of this element's for parameter.  Obfuscated
+// identifiers and "unknown" produce a nil IP.
+func (fe ForwardedElement) forIP() (net.IP, string) {
+	host, port := fe.For, ""
+	if h, p, err := net.SplitHostPort(fe.For); err == nil {
+		host, port = h, p
+	} else if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		host = host[1 : len(host)-1]
+	}
+
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		port = ""
+	}
+
+	return net.ParseIP(host), port
+}
+
+// splitQuoted splits v on sep, ignoring any separators that occur within a quoted-string
+func splitQuoted(v string, sep byte) ([]string, error) {
+	var (
+		parts  []string
+		start  int
+		quoted bool
+	)
+
+	for i := 0; i < len(v); i++ {
+		switch {
+		case quoted && v[i] == '\\':
+			i++
+		case v[i] == '"':
+			quoted = !quoted
+		case !quoted && v[i] == sep:
+			parts = append(parts, v[start:i])
+			start = i + 1
+		}
+	}
+
+	if quoted {
+		return nil, ErrInvalidForwarded
+	}
+
+	return append(parts, v[start:]), nil
+}
+
+// unquote removes the quotes and escapes from an RFC 7230 quoted-string.  Tokens are returned as is.
+func unquote(v string) string {
+	if len(v) < 2 || v[0] != '"' || v[len(v)-1] != '"' {
+		return v
+	}
+
+	var output strings.Builder
+	for i := 1; i < len(v)-1; i++ {
+		if v[i] == '\\' && i+1 < len(v)-1 {
+			i++
+		}
+
+		output.WriteByte(v[i])
+	}
+
+	return output.String()
+}
+
+// ParseForwarded parses the values of one or more Forwarded headers into the hops they describe, in the
+// order they were appended by proxies.  The first element is nearest to the original client.
+func ParseForwarded(values []string) ([]ForwardedElement, error) {
+	var elements []ForwardedElement
+	for _, value := range values {
+		hops, err := splitQuoted(value, ',')
+		if err != nil {
+			return nil, err
+		}
+
+		for _, hop := range hops {
+			pairs, err := splitQuoted(hop, ';')
+			if err != nil {
+				return nil, err
+			}
+
+			var fe ForwardedElement
+			for _, pair := range pairs {
+				pair = strings.TrimSpace(pair)
+				if len(pair) == 0 {
+					continue
+				}
+
+				i := strings.IndexByte(pair, '=')
+				if i < 1 {
+					return nil, ErrInvalidForwarded
+				}
+
+				v := unquote(pair[i+1:])
+				switch strings.ToLower(pair[:i]) {
+				case "for":
+					fe.For = v
+				case "proto":
+					fe.Proto = strings.ToLower(v)
+				case "host":
+					fe.Host = v
+				}
+			}
+
+			elements = append(elements, fe)
+		}
+	}
+
+	return elements, nil
+}
+
+// peerIP returns the IP address of the immediate peer that sent a request
+func peerIP(request *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		host = request.RemoteAddr
+	}
+
+	return net.ParseIP(host)
+}
+
+// ClientIP returns the IP address, as a string, of the client that sent a request.  When a request
+// has passed through the Forwarded decorator, this is the original client rather than the proxy.
+func ClientIP(request *http.Request) string {
+	if host, _, err := net.SplitHostPort(request.RemoteAddr); err == nil {
+		return host
+	}
+
+	return request.RemoteAddr
+}
+
+// Scheme returns the URI scheme, http or https, that a client used to send a request.  When a request
+// has passed through the Forwarded decorator, this is the scheme the original client used.
+func Scheme(request *http.Request) string {
+	if len(request.URL.Scheme) > 0 {
+		return request.URL.Scheme
+	}
+
+	if request.TLS != nil {
+		return "https"
+	}
+
+	return "http"
+}
+
+// Forwarded is an Alice-style decorator that honors RFC 7239 Forwarded headers sent by trusted proxies.
+// The header is only examined when the immediate peer is one of the TrustedProxies.  Hops are then walked
+// from the nearest proxy outward, skipping any that are themselves trusted, and the first remaining hop
+// describes the client.  That hop's address becomes the request's RemoteAddr, and its proto and host
+// become the request's URL scheme and Host.  Downstream code, including request logging, sees the
+// original client as a result.
+//
+// Requests from untrusted peers, and requests with a malformed Forwarded header, are passed along unchanged.
+type Forwarded struct {
+	TrustedProxies TrustedProxies
+}
+
+func (f Forwarded) client(request *http.Request) (ForwardedElement, bool) {
+	values := request.Header[ForwardedHeader]
+	if len(values) == 0 {
+		return ForwardedElement{}, false
+	}
+
+	if peer := peerIP(request); peer == nil || !f.TrustedProxies.Contains(peer) {
+		return ForwardedElement{}, false
+	}
+
+	elements, err := ParseForwarded(values)
+	if err != nil || len(elements) == 0 {
+		return ForwardedElement{}, false
+	}
+
+	i := len(elements) - 1
+	for ; i > 0; i-- {
+		if ip, _ := elements[i].forIP(); ip == nil || !f.TrustedProxies.Contains(ip) {
+			break
+		}
+	}
+
+	return elements[i], true
+}
+
+func (f Forwarded) Then(next http.Handler) http.Handler {
+	if len(f.TrustedProxies) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		fe, ok := f.client(request)
+		if !ok {
+			next.ServeHTTP(response, request)
+			return
+		}
+
+		forwarded := request.WithContext(request.Context())
+		url := *request.URL
+		forwarded.URL = &url
+
+		if ip, port := fe.forIP(); ip != nil {
+			if len(port) > 0 {
+				forwarded.RemoteAddr = net.JoinHostPort(ip.String(), port)
+			} else {
+				forwarded.RemoteAddr = ip.String()
+			}
+		}
+
+		if fe.Proto == "http" || fe.Proto == "https" {
+			forwarded.URL.Scheme = fe.Proto
+		}
+
+		if len(fe.Host) > 0 && !strings.ContainsAny(fe.Host, " \t/") {
+			forwarded.Host = fe.Host
+		}
+
+		next.ServeHTTP(response, forwarded)
+	})
+}
+
+func (f Forwarded) ThenFunc(next http.HandlerFunc) http.Handler {
+	return f.Then(next)
+}
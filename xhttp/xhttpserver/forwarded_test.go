@@ -0,0 +1,235 @@
+package xhttpserver
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testParseTrustedProxiesSuccess(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	tp, err := ParseTrustedProxies([]string{"10.0.0.0/8", " 192.0.2.1 ", "2001:db8::/32", "::1"})
+	require.NoError(err)
+	require.Len(tp, 4)
+
+	for _, trusted := range []string{"10.1.2.3", "192.0.2.1", "2001:db8::17", "::1"} {
+		assert.True(tp.Contains(net.ParseIP(trusted)), trusted)
+	}
+
+	for _, untrusted := range []string{"11.0.0.1", "192.0.2.2", "2001:db9::1", "::2"} {
+		assert.False(tp.Contains(net.ParseIP(untrusted)), untrusted)
+	}
+}
+
+func testParseTrustedProxiesInvalid(t *testing.T) {
+	var (
+		assert = assert.New(t)
+	)
+
+	tp, err := ParseTrustedProxies([]string{"10.0.0.0/8", "10.0.0.0/99"})
+	assert.Empty(tp)
+	assert.Equal(InvalidTrustedProxyError{Value: "10.0.0.0/99"}, err)
+	assert.Contains(err.Error(), "10.0.0.0/99")
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	t.Run("Success", testParseTrustedProxiesSuccess)
+	t.Run("Invalid", testParseTrustedProxiesInvalid)
+}
+
+func TestParseForwarded(t *testing.T) {
+	testData := []struct {
+		values   []string
+		expected []ForwardedElement
+	}{
+		{
+			values:   []string{"for=192.0.2.60;proto=http;by=203.0.113.43"},
+			expected: []ForwardedElement{{For: "192.0.2.60", Proto: "http"}},
+		},
+		{
+			values: []string{`For="[2001:db8:cafe::17]:4711"; Proto=HTTPS; host="themis.example.com"`},
+			expected: []ForwardedElement{
+				{For: "[2001:db8:cafe::17]:4711", Proto: "https", Host: "themis.example.com"},
+			},
+		},
+		{
+			values: []string{"for=192.0.2.43, for=198.51.100.17", `for="_hidden;quoted,value"`},
+			expected: []ForwardedElement{
+				{For: "192.0.2.43"},
+				{For: "198.51.100.17"},
+				{For: "_hidden;quoted,value"},
+			},
+		},
+	}
+
+	for _, record := range testData {
+		t.Run(record.values[0], func(t *testing.T) {
+			var (
+				assert  = assert.New(t)
+				require = require.New(t)
+			)
+
+			actual, err := ParseForwarded(record.values)
+			require.NoError(err)
+			assert.Equal(record.expected, actual)
+		})
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, invalid := range []string{`for="192.0.2.43`, "for", "=192.0.2.43", "for=192.0.2.43;proto"} {
+			_, err := ParseForwarded([]string{invalid})
+			assert.Equal(t, ErrInvalidForwarded, err, invalid)
+		}
+	})
+}
+
+func TestClientIP(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		request = httptest.NewRequest("GET", "/", nil)
+	)
+
+	request.RemoteAddr = "192.0.2.1:1234"
+	assert.Equal("192.0.2.1", ClientIP(request))
+
+	request.RemoteAddr = "[2001:db8::1]:1234"
+	assert.Equal("2001:db8::1", ClientIP(request))
+
+	request.RemoteAddr = "2001:db8::1"
+	assert.Equal("2001:db8::1", ClientIP(request))
+}
+
+func TestScheme(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		request = httptest.NewRequest("GET", "/", nil)
+	)
+
+	assert.Equal("http", Scheme(request))
+
+	request = httptest.NewRequest("GET", "https://themis.example.com/", nil)
+	request.URL.Scheme = ""
+	assert.Equal("https", Scheme(request))
+
+	request.URL.Scheme = "http"
+	assert.Equal("http", Scheme(request))
+}
+
+// forwardedRequest runs a request with the given peer and Forwarded headers through the decorator,
+// returning the request seen by the decorated handler
+func forwardedRequest(t *testing.T, f Forwarded, remoteAddr string, forwarded ...string) *http.Request {
+	var (
+		seen    *http.Request
+		handler = f.ThenFunc(func(_ http.ResponseWriter, request *http.Request) {
+			seen = request
+		})
+
+		original = httptest.NewRequest("GET", "/", nil)
+	)
+
+	original.RemoteAddr = remoteAddr
+	original.Host = "proxy.example.com"
+	for _, v := range forwarded {
+		original.Header.Add(ForwardedHeader, v)
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), original)
+	require.NotNil(t, seen)
+	return seen
+}
+
+func newTestForwarded(t *testing.T) Forwarded {
+	tp, err := ParseTrustedProxies([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+	return Forwarded{TrustedProxies: tp}
+}
+
+func testForwardedNoDecoration(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		next      = Constant{}.NewHandler()
+		forwarded = Forwarded{}.Then(next)
+	)
+
+	assert.Equal(next, forwarded)
+}
+
+func testForwardedTrusted(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		seen   = forwardedRequest(t, newTestForwarded(t), "10.1.1.1:5678", `for="[2001:db8:cafe::17]:4711";proto=https;host=themis.example.com`)
+	)
+
+	assert.Equal("[2001:db8:cafe::17]:4711", seen.RemoteAddr)
+	assert.Equal("2001:db8:cafe::17", ClientIP(seen))
+	assert.Equal("https", Scheme(seen))
+	assert.Equal("themis.example.com", seen.Host)
+}
+
+func testForwardedChain(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		// the first hop was appended by an untrusted proxy, so a client cannot spoof its address by
+		// sending its own Forwarded header
+		seen = forwardedRequest(t, newTestForwarded(t), "10.1.1.1:5678", "for=192.0.2.99", "for=198.51.100.17;proto=http, for=10.2.2.2;proto=https")
+	)
+
+	assert.Equal("198.51.100.17", seen.RemoteAddr)
+	assert.Equal("http", Scheme(seen))
+	assert.Equal("proxy.example.com", seen.Host)
+
+	// when every hop is trusted, the first hop is the client
+	seen = forwardedRequest(t, newTestForwarded(t), "10.1.1.1:5678", "for=10.3.3.3, for=10.2.2.2")
+	assert.Equal("10.3.3.3", seen.RemoteAddr)
+}
+
+func testForwardedObfuscated(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		seen   = forwardedRequest(t, newTestForwarded(t), "10.1.1.1:5678", "for=_hidden;proto=https")
+	)
+
+	assert.Equal("10.1.1.1:5678", seen.RemoteAddr)
+	assert.Equal("https", Scheme(seen))
+}
+
+func testForwardedUntrusted(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		seen   = forwardedRequest(t, newTestForwarded(t), "192.0.2.1:5678", "for=198.51.100.17;proto=https;host=themis.example.com")
+	)
+
+	assert.Equal("192.0.2.1:5678", seen.RemoteAddr)
+	assert.Equal("192.0.2.1", ClientIP(seen))
+	assert.Equal("http", Scheme(seen))
+	assert.Equal("proxy.example.com", seen.Host)
+}
+
+func testForwardedInvalid(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		seen   = forwardedRequest(t, newTestForwarded(t), "10.1.1.1:5678", `for="198.51.100.17;proto=https`)
+	)
+
+	assert.Equal("10.1.1.1:5678", seen.RemoteAddr)
+	assert.Equal("http", Scheme(seen))
+}
+
+func TestForwarded(t *testing.T) {
+	t.Run("NoDecoration", testForwardedNoDecoration)
+	t.Run("Trusted", testForwardedTrusted)
+	t.Run("Chain", testForwardedChain)
+	t.Run("Obfuscated", testForwardedObfuscated)
+	t.Run("Untrusted", testForwardedUntrusted)
+	t.Run("Invalid", testForwardedInvalid)
+}
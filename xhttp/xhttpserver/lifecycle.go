@@ -2,6 +2,7 @@ package xhttpserver
 
 import (
 	"context"
+	"crypto/tls"
 	"net"
 
 	"github.com/xmidt-org/themis/xlog"
@@ -10,24 +11,53 @@ import (
 	"github.com/go-kit/kit/log/level"
 )
 
-// OnStart produces a closure that will start the given server appropriately
-func OnStart(o Options, s Interface, logger log.Logger, onExit func()) func(context.Context) error {
+// OnStart produces a closure that will start the given server appropriately.  If rc is non-nil and the server
+// is configured for TLS, the server certificate is served from rc so that it can be reloaded later.  If session
+// tickets are configured, their keys are rotated for as long as the server is running.  If bind retries are configured,
+// binding to an address that is still in use is retried before this closure fails.
+func OnStart(o Options, s Interface, logger log.Logger, rc *ReloadableCertificate, onExit func()) func(context.Context) error {
 	return func(ctx context.Context) error {
-		tcfg, err := NewTlsConfig(o.Tls)
+		var (
+			tcfg *tls.Config
+			err  error
+		)
+
+		if rc != nil {
+			tcfg, err = NewReloadableTlsConfig(o.Tls, rc)
+		} else {
+			tcfg, err = NewTlsConfig(o.Tls)
+		}
+
 		if err != nil {
 			return err
 		}
 
-		l, err := NewListener(ctx, o, net.ListenConfig{}, tcfg)
+		var rotator *SessionTicketRotator
+		if tcfg != nil && o.Tls.SessionTickets != nil {
+			rotator, err = NewSessionTicketRotator(tcfg, *o.Tls.SessionTickets, nil)
+			if err != nil {
+				return err
+			}
+		}
+
+		l, err := listen(ctx, o, net.ListenConfig{}, tcfg, logger)
 		if err != nil {
 			return err
 		}
 
+		if rotator != nil {
+			rotator.Start()
+		}
+
 		go func() {
 			if onExit != nil {
 				defer onExit()
 			}
 
+			if rotator != nil {
+				defer rotator.Stop()
+			}
+
 			address := l.Addr().String()
 			logger.Log(
 				level.Key(), level.InfoValue(),
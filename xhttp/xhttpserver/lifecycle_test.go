@@ -31,6 +31,7 @@ func testOnStartNewListenerError(t *testing.T) {
 			},
 			s,
 			log.NewJSONLogger(&output),
+			nil,
 			func() {
 				assert.Fail("onExit should not have been called")
 			},
@@ -56,6 +57,7 @@ func testOnStartSuccess(t *testing.T) {
 			Options{},
 			s,
 			xlogtest.New(t),
+			nil,
 			func() {
 				close(onExitCalled)
 			},
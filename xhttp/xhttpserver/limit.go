@@ -0,0 +1,97 @@
+package xhttpserver
+
+import (
+	"net/http"
+	"time"
+)
+
+// limitHandler is the internal http.Handler implementation that queues requests until one of a fixed
+// number of processing slots is available
+type limitHandler struct {
+	next      http.Handler
+	onTimeout http.Handler
+
+	slots        chan struct{}
+	queueTimeout time.Duration
+}
+
+// acquire waits for a processing slot, returning false if the queue timeout elapses or the request is canceled first
+func (lh *limitHandler) acquire(request *http.Request) bool {
+	select {
+	case lh.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	var expired <-chan time.Time
+	if lh.queueTimeout > 0 {
+		timer := time.NewTimer(lh.queueTimeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case lh.slots <- struct{}{}:
+		return true
+	case <-expired:
+		return false
+	case <-request.Context().Done():
+		return false
+	}
+}
+
+func (lh *limitHandler) release() {
+	<-lh.slots
+}
+
+func (lh *limitHandler) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	if !lh.acquire(request) {
+		lh.onTimeout.ServeHTTP(response, request)
+		return
+	}
+
+	defer lh.release()
+	lh.next.ServeHTTP(response, request)
+}
+
+// Limit is an Alice-style decorator that caps the number of HTTP transactions being processed concurrently.
+// Unlike Busy, which rejects excess requests immediately, Limit queues excess requests until a slot becomes
+// available or until QueueTimeout elapses.  This is useful when request processing is dominated by the latency
+// of some downstream resource, such as a remote signing service.
+type Limit struct {
+	// MaxInFlightRequests is the maximum number of requests processed at any one time.  If this
+	// field is nonpositive, no limit is enforced and the next handler is returned undecorated.
+	MaxInFlightRequests int
+
+	// QueueTimeout is the maximum time a request waits for a processing slot.  If unset, a request waits
+	// until either a slot is available or the request is canceled.
+	QueueTimeout time.Duration
+
+	// OnTimeout is the optional handler for requests that could not obtain a slot.  By default,
+	// a http.StatusServiceUnavailable is returned.
+	OnTimeout http.Handler
+}
+
+func (l Limit) Then(next http.Handler) http.Handler {
+	if l.MaxInFlightRequests < 1 {
+		return next
+	}
+
+	lh := &limitHandler{
+		next:         next,
+		slots:        make(chan struct{}, l.MaxInFlightRequests),
+		queueTimeout: l.QueueTimeout,
+	}
+
+	if l.OnTimeout != nil {
+		lh.onTimeout = l.OnTimeout
+	} else {
+		lh.onTimeout = Constant{StatusCode: http.StatusServiceUnavailable}.NewHandler()
+	}
+
+	return lh
+}
+
+func (l Limit) ThenFunc(next http.HandlerFunc) http.Handler {
+	return l.Then(next)
+}
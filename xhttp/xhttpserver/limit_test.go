@@ -0,0 +1,157 @@
+package xhttpserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testLimitNoDecoration(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		next  = Constant{}.NewHandler()
+		limit = Limit{}.Then(next)
+	)
+
+	assert.Equal(next, limit)
+}
+
+// saturate starts a request that occupies the single slot of the given handler.  The returned
+// closure unblocks that request and waits for it to finish.
+func saturate(t *testing.T, limit http.Handler, nextInServeHTTP <-chan struct{}, nextBlock chan struct{}) func() {
+	nextFinish := new(sync.WaitGroup)
+	nextFinish.Add(1)
+
+	go func() {
+		defer nextFinish.Done()
+		response := httptest.NewRecorder()
+		limit.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+		assert.Equal(t, 288, response.Code)
+	}()
+
+	select {
+	case <-nextInServeHTTP:
+		// passing
+	case <-time.After(time.Second):
+		assert.Fail(t, "Limit did not call next.ServeHTTP")
+	}
+
+	return func() {
+		close(nextBlock)
+		nextFinish.Wait()
+	}
+}
+
+func testLimitQueueTimeout(t *testing.T, onTimeout http.Handler, expectedStatusCode int) {
+	var (
+		assert = assert.New(t)
+
+		nextInServeHTTP = make(chan struct{}, 1)
+		nextBlock       = make(chan struct{})
+		next            = func(response http.ResponseWriter, request *http.Request) {
+			nextInServeHTTP <- struct{}{}
+			<-nextBlock
+			response.WriteHeader(288)
+		}
+
+		limit = Limit{
+			MaxInFlightRequests: 1,
+			QueueTimeout:        50 * time.Millisecond,
+			OnTimeout:           onTimeout,
+		}.ThenFunc(next)
+	)
+
+	finish := saturate(t, limit, nextInServeHTTP, nextBlock)
+	defer finish()
+
+	start := time.Now()
+	response := httptest.NewRecorder()
+	limit.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(expectedStatusCode, response.Code)
+	assert.True(time.Since(start) >= 50*time.Millisecond)
+}
+
+func testLimitQueued(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		nextInServeHTTP = make(chan struct{}, 2)
+		nextBlock       = make(chan struct{})
+		next            = func(response http.ResponseWriter, request *http.Request) {
+			nextInServeHTTP <- struct{}{}
+			<-nextBlock
+			response.WriteHeader(288)
+		}
+
+		limit = Limit{
+			MaxInFlightRequests: 1,
+			QueueTimeout:        5 * time.Second,
+		}.ThenFunc(next)
+
+		queued = make(chan int, 1)
+	)
+
+	finish := saturate(t, limit, nextInServeHTTP, nextBlock)
+	go func() {
+		response := httptest.NewRecorder()
+		limit.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+		queued <- response.Code
+	}()
+
+	// the queued request can only proceed once the first has finished
+	finish()
+
+	select {
+	case statusCode := <-queued:
+		assert.Equal(288, statusCode)
+	case <-time.After(time.Second):
+		assert.Fail("The queued request did not complete")
+	}
+}
+
+func testLimitCanceled(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		nextInServeHTTP = make(chan struct{}, 1)
+		nextBlock       = make(chan struct{})
+		next            = func(response http.ResponseWriter, request *http.Request) {
+			nextInServeHTTP <- struct{}{}
+			<-nextBlock
+			response.WriteHeader(288)
+		}
+
+		limit = Limit{MaxInFlightRequests: 1}.ThenFunc(next)
+	)
+
+	finish := saturate(t, limit, nextInServeHTTP, nextBlock)
+	defer finish()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	response := httptest.NewRecorder()
+	limit.ServeHTTP(response, httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+	assert.Equal(http.StatusServiceUnavailable, response.Code)
+}
+
+func TestLimit(t *testing.T) {
+	t.Run("NoDecoration", testLimitNoDecoration)
+
+	t.Run("DefaultOnTimeout", func(t *testing.T) {
+		testLimitQueueTimeout(t, nil, http.StatusServiceUnavailable)
+	})
+
+	t.Run("CustomOnTimeout", func(t *testing.T) {
+		testLimitQueueTimeout(t, Constant{StatusCode: 476}.NewHandler(), 476)
+	})
+
+	t.Run("Queued", testLimitQueued)
+	t.Run("Canceled", testLimitCanceled)
+}
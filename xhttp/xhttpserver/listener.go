@@ -34,6 +34,7 @@ type Listener struct {
 	tcpListener        *net.TCPListener
 	tcpKeepAlivePeriod time.Duration
 	tlsConfig          *tls.Config
+	proxyProtocol      *ProxyProtocol
 }
 
 func (l *Listener) Accept() (net.Conn, error) {
@@ -54,11 +55,17 @@ func (l *Listener) Accept() (net.Conn, error) {
 		}
 	}
 
+	var c net.Conn = conn
+	if l.proxyProtocol != nil {
+		// the PROXY header precedes any TLS handshake
+		c = newProxyConn(c, *l.proxyProtocol)
+	}
+
 	if l.tlsConfig != nil {
-		return tls.Server(conn, l.tlsConfig), nil
+		return tls.Server(c, l.tlsConfig), nil
 	}
 
-	return conn, nil
+	return c, nil
 }
 
 func (l *Listener) Close() error {
@@ -90,8 +97,9 @@ func NewListener(ctx context.Context, o Options, lcfg net.ListenConfig, tcfg *tl
 	}
 
 	listener := &Listener{
-		tcpListener: tcpListener,
-		tlsConfig:   tcfg,
+		tcpListener:   tcpListener,
+		tlsConfig:     tcfg,
+		proxyProtocol: o.ProxyProtocol,
 	}
 
 	if !o.DisableTCPKeepAlives {
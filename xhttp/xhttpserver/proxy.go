@@ -0,0 +1,218 @@
+package xhttpserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultProxyHeaderTimeout is the time allowed for a client to send a PROXY header when
+	// no timeout is configured
+	DefaultProxyHeaderTimeout time.Duration = 10 * time.Second
+
+	// proxyV1MaxLength is the maximum length of a v1 header, including the trailing CRLF
+	proxyV1MaxLength = 107
+)
+
+var (
+	// proxyV1Prefix is how every PROXY protocol v1 header begins
+	proxyV1Prefix = []byte("PROXY ")
+
+	// proxyV2Signature is the fixed 12-byte prefix of every PROXY protocol v2 header
+	proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+	ErrProxyHeaderRequired = errors.New("A PROXY protocol header is required")
+	ErrInvalidProxyHeader  = errors.New("Invalid PROXY protocol header")
+)
+
+// ProxyProtocol describes how a listener handles the PROXY protocol, as used by load balancers such as
+// the AWS NLB to pass along the original client address.  Both v1 (text) and v2 (binary) headers are supported.
+// When a header is present, the connection's RemoteAddr is the client address from the header.
+type ProxyProtocol struct {
+	// AllowNonProxy permits connections that do not begin with a PROXY header.  Such connections are
+	// passed through unchanged.  By default, these connections are rejected.
+	AllowNonProxy bool
+
+	// HeaderTimeout is the time allowed for a client to send a PROXY header.  If unset,
+	// DefaultProxyHeaderTimeout is used.
+	HeaderTimeout time.Duration
+}
+
+// proxyConn is a net.Conn that lazily consumes a PROXY protocol header.  The header is read on
+// first use rather than in Accept, so that a slow client cannot stall the accept loop.
+type proxyConn struct {
+	net.Conn
+	reader        *bufio.Reader
+	allowNonProxy bool
+	headerTimeout time.Duration
+
+	once       sync.Once
+	remoteAddr net.Addr
+	err        error
+}
+
+func newProxyConn(c net.Conn, pp ProxyProtocol) *proxyConn {
+	timeout := pp.HeaderTimeout
+	if timeout <= 0 {
+		timeout = DefaultProxyHeaderTimeout
+	}
+
+	return &proxyConn{
+		Conn:          c,
+		reader:        bufio.NewReader(c),
+		allowNonProxy: pp.AllowNonProxy,
+		headerTimeout: timeout,
+	}
+}
+
+func (pc *proxyConn) init() {
+	pc.once.Do(func() {
+		pc.Conn.SetReadDeadline(time.Now().Add(pc.headerTimeout))
+		pc.remoteAddr, pc.err = readProxyHeader(pc.reader, pc.allowNonProxy)
+		pc.Conn.SetReadDeadline(time.Time{})
+
+		if pc.err != nil {
+			pc.Conn.Close()
+		}
+	})
+}
+
+func (pc *proxyConn) Read(b []byte) (int, error) {
+	pc.init()
+	if pc.err != nil {
+		return 0, pc.err
+	}
+
+	return pc.reader.Read(b)
+}
+
+// RemoteAddr returns the client address from the PROXY header, if one was sent.  Otherwise,
+// the address of the peer is returned.
+func (pc *proxyConn) RemoteAddr() net.Addr {
+	pc.init()
+	if pc.remoteAddr != nil {
+		return pc.remoteAddr
+	}
+
+	return pc.Conn.RemoteAddr()
+}
+
+// readProxyHeader consumes a PROXY header, if present, returning the client address it describes.  A nil
+// address with a nil error means that the connection's own address should be used, as happens with
+// pass-through connections and headers that carry no address, e.g. v1 UNKNOWN or v2 LOCAL.
+func readProxyHeader(r *bufio.Reader, allowNonProxy bool) (net.Addr, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	switch first[0] {
+	case proxyV1Prefix[0]:
+		if prefix, err := r.Peek(len(proxyV1Prefix)); err == nil && bytes.Equal(prefix, proxyV1Prefix) {
+			return readProxyV1(r)
+		}
+
+	case proxyV2Signature[0]:
+		if prefix, err := r.Peek(len(proxyV2Signature)); err == nil && bytes.Equal(prefix, proxyV2Signature) {
+			return readProxyV2(r)
+		}
+	}
+
+	if allowNonProxy {
+		return nil, nil
+	}
+
+	return nil, ErrProxyHeaderRequired
+}
+
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < proxyV1MaxLength {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		line = append(line, b)
+		if bytes.HasSuffix(line, []byte("\r\n")) {
+			break
+		}
+	}
+
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, ErrInvalidProxyHeader
+	}
+
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, ErrInvalidProxyHeader
+	}
+
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil {
+		return nil, ErrInvalidProxyHeader
+	}
+
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	if header[12]>>4 != 0x2 {
+		return nil, ErrInvalidProxyHeader
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+
+	switch header[12] & 0x0F {
+	case 0x0:
+		// LOCAL: the connection was made by the proxy itself, e.g. for health checks
+		return nil, nil
+
+	case 0x1:
+		// PROXY
+
+	default:
+		return nil, ErrInvalidProxyHeader
+	}
+
+	switch header[13] {
+	case 0x11: // TCP over IPv4
+		if len(payload) < 12 {
+			return nil, ErrInvalidProxyHeader
+		}
+
+		return &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}, nil
+
+	case 0x21: // TCP over IPv6
+		if len(payload) < 36 {
+			return nil, ErrInvalidProxyHeader
+		}
+
+		return &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}, nil
+
+	default:
+		// unsupported or unspecified families carry no usable address
+		return nil, nil
+	}
+}
@@ -0,0 +1,238 @@
+package xhttpserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func proxyV2Header(cmd byte, src net.IP, srcPort uint16) []byte {
+	var (
+		header  bytes.Buffer
+		payload bytes.Buffer
+		family  byte = 0x11
+		dst          = net.IPv4(192, 0, 2, 100).To4()
+	)
+
+	if src.To4() == nil {
+		family = 0x21
+		dst = net.ParseIP("2001:db8::100")
+	} else {
+		src = src.To4()
+	}
+
+	payload.Write(src)
+	payload.Write(dst)
+	binary.Write(&payload, binary.BigEndian, srcPort)
+	binary.Write(&payload, binary.BigEndian, uint16(443))
+
+	header.Write(proxyV2Signature)
+	header.WriteByte(0x20 | cmd)
+	header.WriteByte(family)
+	binary.Write(&header, binary.BigEndian, uint16(payload.Len()))
+	header.Write(payload.Bytes())
+	return header.Bytes()
+}
+
+// acceptProxy writes the given bytes to a listener configured for the PROXY protocol, returning
+// the accepted connection's RemoteAddr along with whatever could be read from that connection
+func acceptProxy(t *testing.T, pp ProxyProtocol, data []byte) (net.Addr, net.Addr, []byte, error) {
+	require := require.New(t)
+	l, err := NewListener(context.Background(), Options{Address: "127.0.0.1:0", ProxyProtocol: &pp}, net.ListenConfig{}, nil)
+	require.NoError(err)
+	defer l.Close()
+
+	client, err := net.DialTimeout("tcp", l.Addr().String(), 5*time.Second)
+	require.NoError(err)
+	defer client.Close()
+
+	_, err = client.Write(data)
+	require.NoError(err)
+	client.(*net.TCPConn).CloseWrite()
+
+	c, err := l.Accept()
+	require.NoError(err)
+	defer c.Close()
+
+	remoteAddr := c.RemoteAddr()
+	received, err := ioutil.ReadAll(c)
+	return client.LocalAddr(), remoteAddr, received, err
+}
+
+func testProxyProtocolV1(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	_, remoteAddr, received, err := acceptProxy(t, ProxyProtocol{}, []byte("PROXY TCP4 192.0.2.1 192.0.2.100 56324 443\r\nhello"))
+	require.NoError(err)
+	assert.Equal("192.0.2.1:56324", remoteAddr.String())
+	assert.Equal("hello", string(received))
+
+	_, remoteAddr, received, err = acceptProxy(t, ProxyProtocol{}, []byte("PROXY TCP6 2001:db8::1 2001:db8::100 56324 443\r\nhello"))
+	require.NoError(err)
+	assert.Equal("[2001:db8::1]:56324", remoteAddr.String())
+	assert.Equal("hello", string(received))
+}
+
+func testProxyProtocolV1Unknown(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	clientAddr, remoteAddr, received, err := acceptProxy(t, ProxyProtocol{}, []byte("PROXY UNKNOWN\r\nhello"))
+	require.NoError(err)
+	assert.Equal(clientAddr.String(), remoteAddr.String())
+	assert.Equal("hello", string(received))
+}
+
+func testProxyProtocolV2(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	_, remoteAddr, received, err := acceptProxy(t, ProxyProtocol{}, append(proxyV2Header(0x1, net.IPv4(192, 0, 2, 1), 56324), "hello"...))
+	require.NoError(err)
+	assert.Equal("192.0.2.1:56324", remoteAddr.String())
+	assert.Equal("hello", string(received))
+
+	_, remoteAddr, received, err = acceptProxy(t, ProxyProtocol{}, append(proxyV2Header(0x1, net.ParseIP("2001:db8::1"), 56324), "hello"...))
+	require.NoError(err)
+	assert.Equal("[2001:db8::1]:56324", remoteAddr.String())
+	assert.Equal("hello", string(received))
+}
+
+func testProxyProtocolV2Local(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	clientAddr, remoteAddr, received, err := acceptProxy(t, ProxyProtocol{}, append(proxyV2Header(0x0, net.IPv4(192, 0, 2, 1), 56324), "hello"...))
+	require.NoError(err)
+	assert.Equal(clientAddr.String(), remoteAddr.String())
+	assert.Equal("hello", string(received))
+}
+
+func testProxyProtocolInvalid(t *testing.T) {
+	for i, data := range []string{
+		"PROXY TCP4 not.an.ip 192.0.2.100 56324 443\r\nhello",
+		"PROXY TCP4 192.0.2.1\r\nhello",
+		"PROXY TCP4 192.0.2.1 192.0.2.100 56324 443 but this line is far too long to be a valid header and keeps going on and on\r\n",
+	} {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			_, _, received, err := acceptProxy(t, ProxyProtocol{}, []byte(data))
+			assert.Equal(t, ErrInvalidProxyHeader, err)
+			assert.Empty(t, received)
+		})
+	}
+}
+
+func testProxyProtocolNonProxy(t *testing.T) {
+	t.Run("Rejected", func(t *testing.T) {
+		assert := assert.New(t)
+		_, _, received, err := acceptProxy(t, ProxyProtocol{}, []byte("GET / HTTP/1.1\r\n\r\n"))
+		assert.Equal(ErrProxyHeaderRequired, err)
+		assert.Empty(received)
+	})
+
+	t.Run("PassedThrough", func(t *testing.T) {
+		var (
+			assert  = assert.New(t)
+			require = require.New(t)
+		)
+
+		clientAddr, remoteAddr, received, err := acceptProxy(t, ProxyProtocol{AllowNonProxy: true}, []byte("GET / HTTP/1.1\r\n\r\n"))
+		require.NoError(err)
+		assert.Equal(clientAddr.String(), remoteAddr.String())
+		assert.Equal("GET / HTTP/1.1\r\n\r\n", string(received))
+	})
+}
+
+func testProxyProtocolHeaderTimeout(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	l, err := NewListener(
+		context.Background(),
+		Options{Address: "127.0.0.1:0", ProxyProtocol: &ProxyProtocol{HeaderTimeout: 50 * time.Millisecond}},
+		net.ListenConfig{},
+		nil,
+	)
+
+	require.NoError(err)
+	defer l.Close()
+
+	client, err := net.DialTimeout("tcp", l.Addr().String(), 5*time.Second)
+	require.NoError(err)
+	defer client.Close()
+
+	c, err := l.Accept()
+	require.NoError(err)
+	defer c.Close()
+
+	_, err = c.Read(make([]byte, 1))
+	require.Error(err)
+	netErr, ok := err.(net.Error)
+	require.True(ok)
+	assert.True(netErr.Timeout())
+}
+
+func testProxyProtocolServer(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		remoteAddr = make(chan string, 1)
+		server     = &http.Server{
+			Handler: http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+				remoteAddr <- request.RemoteAddr
+			}),
+		}
+	)
+
+	l, err := NewListener(context.Background(), Options{Address: "127.0.0.1:0", ProxyProtocol: &ProxyProtocol{}}, net.ListenConfig{}, nil)
+	require.NoError(err)
+	go server.Serve(l)
+	defer server.Close()
+
+	client, err := net.DialTimeout("tcp", l.Addr().String(), 5*time.Second)
+	require.NoError(err)
+	defer client.Close()
+
+	_, err = io.WriteString(client, "PROXY TCP4 203.0.113.7 192.0.2.100 40000 80\r\nGET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(err)
+
+	select {
+	case actual := <-remoteAddr:
+		assert.Equal("203.0.113.7:40000", actual)
+	case <-time.After(5 * time.Second):
+		assert.Fail("The handler was not called")
+	}
+}
+
+func TestProxyProtocol(t *testing.T) {
+	t.Run("V1", testProxyProtocolV1)
+	t.Run("V1Unknown", testProxyProtocolV1Unknown)
+	t.Run("V2", testProxyProtocolV2)
+	t.Run("V2Local", testProxyProtocolV2Local)
+	t.Run("Invalid", testProxyProtocolInvalid)
+	t.Run("NonProxy", testProxyProtocolNonProxy)
+	t.Run("HeaderTimeout", testProxyProtocolHeaderTimeout)
+	t.Run("Server", testProxyProtocolServer)
+}
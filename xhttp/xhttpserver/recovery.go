@@ -0,0 +1,119 @@
+package xhttpserver
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/xmidt-org/themis/xlog"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+// PanicError is the error sent to clients when a handler panics
+type PanicError struct {
+	Value interface{}
+}
+
+func (pe PanicError) Error() string {
+	return fmt.Sprintf("Internal server error: %v", pe.Value)
+}
+
+func (pe PanicError) StatusCode() int {
+	return http.StatusInternalServerError
+}
+
+// committed tests if any part of a response has been sent
+func committed(tw TrackingWriter) bool {
+	if t, ok := tw.(*trackingWriter); ok {
+		return t.statusCode > 0 || t.bytesWritten > 0 || t.hijacked
+	}
+
+	return tw.Hijacked() || tw.BytesWritten() > 0
+}
+
+// Recovery is an Alice-style decorator that recovers panics from the decorated handler.  Unless some of the
+// response has already been sent, the client receives the error produced by ErrorEncoder, which is
+// http.StatusInternalServerError by default.  As with net/http, a panic with http.ErrAbortHandler is not recovered.
+type Recovery struct {
+	// Counters are the optional counters updated for each recovered panic
+	Counters *Counters
+
+	// Logger is the optional logger for recovered panics, which are logged with their stack traces
+	Logger log.Logger
+
+	// ErrorEncoder writes the response for a recovered panic.  If unset, kithttp.DefaultErrorEncoder is used
+	// with a PanicError.
+	ErrorEncoder kithttp.ErrorEncoder
+}
+
+func (r Recovery) Then(next http.Handler) http.Handler {
+	encoder := r.ErrorEncoder
+	if encoder == nil {
+		encoder = kithttp.DefaultErrorEncoder
+	}
+
+	logger := r.Logger
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		tw := NewTrackingWriter(response)
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			} else if p == http.ErrAbortHandler {
+				panic(p)
+			}
+
+			if r.Counters != nil {
+				r.Counters.AddPanic()
+			}
+
+			logger.Log(
+				level.Key(), level.ErrorValue(),
+				xlog.MessageKey(), "recovered handler panic",
+				xlog.ErrorKey(), p,
+				"stack", string(debug.Stack()),
+			)
+
+			if !committed(tw) {
+				encoder(request.Context(), PanicError{Value: p}, tw)
+			}
+		}()
+
+		next.ServeHTTP(tw, request)
+	})
+}
+
+func (r Recovery) ThenFunc(next http.HandlerFunc) http.Handler {
+	return r.Then(next)
+}
+
+// CountServerErrors is an Alice-style decorator that counts the responses with a 5xx status code.  Hijacked
+// connections are not counted.  If Counters is nil, the next handler is returned undecorated.
+type CountServerErrors struct {
+	Counters *Counters
+}
+
+func (cse CountServerErrors) Then(next http.Handler) http.Handler {
+	if cse.Counters == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		tw := NewTrackingWriter(response)
+		next.ServeHTTP(tw, request)
+		if !tw.Hijacked() && tw.StatusCode() >= 500 {
+			cse.Counters.AddServerError()
+		}
+	})
+}
+
+func (cse CountServerErrors) ThenFunc(next http.HandlerFunc) http.Handler {
+	return cse.Then(next)
+}
@@ -0,0 +1,151 @@
+package xhttpserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPanicError(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		err = PanicError{Value: "expected"}
+	)
+
+	assert.Contains(err.Error(), "expected")
+	assert.Equal(http.StatusInternalServerError, err.StatusCode())
+}
+
+func testRecoveryNoPanic(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		counters = new(Counters)
+		response = httptest.NewRecorder()
+
+		handler = Recovery{Counters: counters}.ThenFunc(func(response http.ResponseWriter, _ *http.Request) {
+			response.WriteHeader(287)
+		})
+	)
+
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(287, response.Code)
+	assert.Zero(counters.Panics())
+}
+
+func testRecoveryPanic(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		counters = new(Counters)
+		response = httptest.NewRecorder()
+
+		handler = Recovery{Counters: counters}.ThenFunc(func(http.ResponseWriter, *http.Request) {
+			panic("expected")
+		})
+	)
+
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(http.StatusInternalServerError, response.Code)
+	assert.Equal(uint64(1), counters.Panics())
+}
+
+func testRecoveryCustomErrorEncoder(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		response = httptest.NewRecorder()
+
+		handler = Recovery{
+			ErrorEncoder: func(_ context.Context, err error, response http.ResponseWriter) {
+				assert.Equal(PanicError{Value: "expected"}, err)
+				response.WriteHeader(599)
+			},
+		}.ThenFunc(func(http.ResponseWriter, *http.Request) {
+			panic("expected")
+		})
+	)
+
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(599, response.Code)
+}
+
+func testRecoveryCommitted(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		counters = new(Counters)
+		response = httptest.NewRecorder()
+
+		handler = Recovery{Counters: counters}.ThenFunc(func(response http.ResponseWriter, _ *http.Request) {
+			response.WriteHeader(http.StatusAccepted)
+			panic("expected")
+		})
+	)
+
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(http.StatusAccepted, response.Code)
+	assert.Equal(uint64(1), counters.Panics())
+}
+
+func testRecoveryAbortHandler(t *testing.T) {
+	var (
+		assert   = assert.New(t)
+		counters = new(Counters)
+
+		handler = Recovery{Counters: counters}.ThenFunc(func(http.ResponseWriter, *http.Request) {
+			panic(http.ErrAbortHandler)
+		})
+	)
+
+	assert.PanicsWithValue(http.ErrAbortHandler, func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	})
+
+	assert.Zero(counters.Panics())
+}
+
+func TestRecovery(t *testing.T) {
+	t.Run("NoPanic", testRecoveryNoPanic)
+	t.Run("Panic", testRecoveryPanic)
+	t.Run("CustomErrorEncoder", testRecoveryCustomErrorEncoder)
+	t.Run("Committed", testRecoveryCommitted)
+	t.Run("AbortHandler", testRecoveryAbortHandler)
+}
+
+func TestCountServerErrors(t *testing.T) {
+	t.Run("NoDecoration", func(t *testing.T) {
+		var (
+			next    = Constant{}.NewHandler()
+			handler = CountServerErrors{}.Then(next)
+		)
+
+		assert.Equal(t, next, handler)
+	})
+
+	t.Run("Count", func(t *testing.T) {
+		var (
+			assert   = assert.New(t)
+			counters = new(Counters)
+
+			handler = CountServerErrors{Counters: counters}.ThenFunc(func(response http.ResponseWriter, request *http.Request) {
+				switch request.URL.Path {
+				case "/ok":
+					response.Write([]byte("ok"))
+				case "/notFound":
+					response.WriteHeader(http.StatusNotFound)
+				default:
+					http.Error(response, errors.New("expected").Error(), http.StatusBadGateway)
+				}
+			})
+		)
+
+		for _, path := range []string{"/ok", "/notFound", "/badGateway", "/ok", "/badGateway"} {
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+		}
+
+		assert.Equal(uint64(2), counters.ServerErrors())
+		assert.Zero(counters.Panics())
+	})
+}
@@ -0,0 +1,54 @@
+package xhttpserver
+
+import (
+	"sort"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/fx"
+)
+
+// RoutesGroup is the uber/fx value group from which servers collect their Routes
+const RoutesGroup = "xhttpserver.routes"
+
+// Routes is a set of routes, typically built by a separate module, that is mounted onto a server's *mux.Router
+// before that server starts.  Any number of Routes may be supplied to the RoutesGroup value group.
+type Routes struct {
+	// Server is the name of the server whose router these routes are registered with.  This must match
+	// the Name of the Unmarshal, or the Key if Name is unset.
+	Server string
+
+	// Priority determines the order in which Routes are registered with a server's router.  Routes with
+	// lower priorities are registered first, which matters because gorilla/mux dispatches to the first matching
+	// route.  Routes with the same priority are registered in the order uber/fx supplies them.
+	Priority int
+
+	// Register is the closure which adds routes to the router
+	Register func(*mux.Router)
+}
+
+// Annotated emits these Routes into the RoutesGroup value group
+func (r Routes) Annotated() fx.Annotated {
+	return fx.Annotated{
+		Group:  RoutesGroup,
+		Target: func() Routes { return r },
+	}
+}
+
+// RegisterRoutes applies each Routes for the given server to a router, in priority order.
+// Routes for other servers, or with no Register closure, are ignored.
+func RegisterRoutes(server string, router *mux.Router, routes []Routes) {
+	var matching []Routes
+	for _, r := range routes {
+		if r.Server == server && r.Register != nil {
+			matching = append(matching, r)
+		}
+	}
+
+	sort.SliceStable(matching, func(i, j int) bool {
+		return matching[i].Priority < matching[j].Priority
+	})
+
+	for _, r := range matching {
+		r.Register(router)
+	}
+}
@@ -0,0 +1,161 @@
+package xhttpserver
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/xmidt-org/themis/config"
+	"github.com/xmidt-org/themis/xlog"
+
+	"github.com/go-kit/kit/log"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+func statusRoute(path string, statusCode int) func(*mux.Router) {
+	return func(r *mux.Router) {
+		r.HandleFunc(path, func(response http.ResponseWriter, _ *http.Request) {
+			response.WriteHeader(statusCode)
+		})
+	}
+}
+
+func TestRegisterRoutes(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		router = mux.NewRouter()
+		order  []int
+	)
+
+	RegisterRoutes(
+		"server",
+		router,
+		[]Routes{
+			{Server: "server", Priority: 2, Register: func(*mux.Router) { order = append(order, 2) }},
+			{Server: "server", Priority: 1, Register: statusRoute("/test", 201)},
+			{Server: "server", Priority: 1, Register: func(*mux.Router) { order = append(order, 1) }},
+			{Server: "server", Priority: 0, Register: func(*mux.Router) { order = append(order, 0) }},
+			{Server: "server", Priority: 3, Register: statusRoute("/test", 202)},
+			{Server: "other", Priority: -1, Register: func(*mux.Router) { order = append(order, -1) }},
+			{Server: "server", Priority: -2},
+		},
+	)
+
+	assert.Equal([]int{0, 1, 2}, order)
+
+	// the lower priority route was registered first, so it wins
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest("GET", "/test", nil))
+	assert.Equal(201, response.Code)
+}
+
+func TestUnmarshalRoutes(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := l.Addr().String()
+	l.Close()
+
+	var (
+		assert = assert.New(t)
+
+		app = fxtest.New(t,
+			fx.Provide(
+				xlog.Provide(log.NewNopLogger()),
+				config.ProvideViper(
+					config.Json(fmt.Sprintf(`
+						{
+							"server": {
+								"address": "%s",
+								"disableHTTPKeepAlives": true
+							}
+						}
+					`, address)),
+				),
+				Routes{Server: "server", Priority: 1, Register: statusRoute("/first", 201)}.Annotated(),
+				Routes{Server: "server", Priority: 2, Register: statusRoute("/second", 202)}.Annotated(),
+				Routes{Server: "another", Register: statusRoute("/another", 203)}.Annotated(),
+				Unmarshal{Key: "server"}.Provide,
+			),
+			fx.Invoke(
+				func(*mux.Router) {},
+			),
+		)
+	)
+
+	app.RequireStart()
+	defer app.RequireStop()
+
+	for path, expectedStatusCode := range map[string]int{"/first": 201, "/second": 202, "/another": 404} {
+		response, err := http.Get("http://" + address + path)
+		if assert.NoError(err, path) {
+			response.Body.Close()
+			assert.Equal(expectedStatusCode, response.StatusCode, path)
+		}
+	}
+}
+
+func TestUnmarshalCounters(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := l.Addr().String()
+	l.Close()
+
+	var (
+		assert = assert.New(t)
+
+		counters *ServerCounters
+		app      = fxtest.New(t,
+			fx.Provide(
+				xlog.Provide(log.NewNopLogger()),
+				config.ProvideViper(
+					config.Json(fmt.Sprintf(`
+						{
+							"server": {
+								"address": "%s",
+								"disableHTTPKeepAlives": true
+							}
+						}
+					`, address)),
+				),
+				NewServerCounters,
+				Routes{Server: "server", Register: statusRoute("/ok", 200)}.Annotated(),
+				Routes{Server: "server", Register: statusRoute("/error", 500)}.Annotated(),
+				Routes{
+					Server: "server",
+					Register: func(r *mux.Router) {
+						r.HandleFunc("/panic", func(http.ResponseWriter, *http.Request) {
+							panic("expected")
+						})
+					},
+				}.Annotated(),
+				Unmarshal{Key: "server"}.Provide,
+			),
+			fx.Invoke(
+				func(*mux.Router) {},
+			),
+			fx.Populate(&counters),
+		)
+	)
+
+	app.RequireStart()
+	defer app.RequireStop()
+
+	for path, expectedStatusCode := range map[string]int{"/ok": 200, "/error": 500, "/panic": 500} {
+		response, err := http.Get("http://" + address + path)
+		if assert.NoError(err, path) {
+			response.Body.Close()
+			assert.Equal(expectedStatusCode, response.StatusCode, path)
+		}
+	}
+
+	c := counters.Get("server")
+	assert.Equal(uint64(1), c.Panics())
+	assert.Equal(uint64(2), c.ServerErrors())
+}
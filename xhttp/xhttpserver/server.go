@@ -2,6 +2,7 @@ package xhttpserver
 
 import (
 	"context"
+	"encoding/json"
 	"net"
 	"net/http"
 	"time"
@@ -30,6 +31,26 @@ type Options struct {
 	Network string
 	Tls     *Tls
 
+	// ProxyProtocol enables the PROXY protocol on this server's listener.  If unset, PROXY headers are
+	// not recognized.
+	ProxyProtocol *ProxyProtocol
+
+	// BindRetry enables retrying the bind when the server's address is still in use at startup.  If unset,
+	// startup fails immediately.
+	BindRetry *BindRetry
+
+	// TrustedProxies are the IP addresses or CIDR blocks of proxies whose RFC 7239 Forwarded headers are honored.
+	// If unset, Forwarded headers are ignored and requests are always attributed to the immediate peer.
+	TrustedProxies []string
+
+	// StripHeaders are the names of sensitive headers, such as those mapped onto claims, that are removed from
+	// every request whose immediate peer is not one of the TrustedProxies.  If unset, no headers are removed.
+	StripHeaders []string
+
+	// ConnectionCache gives each connection a ConnCache, so that values derived from the connection, such as
+	// client certificate claims, are computed once for all the requests over it rather than once per request.
+	ConnectionCache bool
+
 	LogConnectionState    bool
 	DisableHTTPKeepAlives bool
 	MaxHeaderBytes        int
@@ -39,6 +60,14 @@ type Options struct {
 	ReadTimeout           time.Duration
 	WriteTimeout          time.Duration
 	MaxConcurrentRequests int
+	MaxInFlightRequests   int
+	QueueTimeout          time.Duration
+
+	// RequestTimeout is the maximum time allowed to process each request, after which the client receives
+	// a http.StatusServiceUnavailable.  Requests whose URL path begins with one of RequestTimeoutBypass are
+	// exempt, which is necessary for streaming endpoints.
+	RequestTimeout       time.Duration
+	RequestTimeoutBypass []string
 
 	DisableTCPKeepAlives bool
 	TCPKeepAlivePeriod   time.Duration
@@ -48,11 +77,24 @@ type Options struct {
 	DisableHandlerLogger bool
 }
 
+// LogValue produces the representation of these Options used in the startup banner, which is their JSON form.
+// Server options refer to certificates and keys only by file path, so there is no key material to redact.
+func (o Options) LogValue() string {
+	data, err := json.Marshal(o)
+	if err != nil {
+		return err.Error()
+	}
+
+	return string(data)
+}
+
 // NewServerChain produces the standard constructor chain for a server, primarily using configuration.
 func NewServerChain(o Options, l log.Logger, pb ...xloghttp.ParameterBuilder) alice.Chain {
 	chain := alice.New(
 		ResponseHeaders{Header: o.Header}.Then,
 		Busy{MaxConcurrentRequests: o.MaxConcurrentRequests}.Then,
+		Limit{MaxInFlightRequests: o.MaxInFlightRequests, QueueTimeout: o.QueueTimeout}.Then,
+		Timeout{Timeout: o.RequestTimeout, Bypass: o.RequestTimeoutBypass}.Then,
 	)
 
 	if !o.DisableTracking {
@@ -89,6 +131,10 @@ func New(o Options, l log.Logger, h http.Handler) Interface {
 		),
 	}
 
+	if o.ConnectionCache {
+		s.ConnContext = NewConnContext
+	}
+
 	if o.LogConnectionState {
 		s.ConnState = xloghttp.NewConnStateLogger(
 			l,
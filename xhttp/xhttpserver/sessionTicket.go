@@ -0,0 +1,132 @@
+package xhttpserver
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultSessionTicketRotationInterval is how often session ticket keys are rotated when no interval is configured
+	DefaultSessionTicketRotationInterval time.Duration = time.Hour
+
+	// DefaultSessionTicketKeys is the number of session ticket keys retained when no count is configured
+	DefaultSessionTicketKeys = 2
+)
+
+// SessionTickets describes how TLS session ticket keys are generated and rotated.  The newest key encrypts
+// new tickets, while older keys are retained so that existing tickets can still be resumed until their key is
+// rotated out.
+type SessionTickets struct {
+	// RotationInterval is how often a new key is generated.  If unset, DefaultSessionTicketRotationInterval is used.
+	RotationInterval time.Duration
+
+	// Keys is the number of keys retained, including the current key.  If unset, DefaultSessionTicketKeys is used.
+	Keys int
+}
+
+// SessionTicketRotator manages the session ticket keys of a single tls.Config
+type SessionTicketRotator struct {
+	lock     sync.Mutex
+	config   *tls.Config
+	random   io.Reader
+	interval time.Duration
+	maxKeys  int
+	keys     [][32]byte
+	stop     chan struct{}
+}
+
+// NewSessionTicketRotator creates a SessionTicketRotator for the given tls.Config and immediately installs
+// an initial key.  If random is nil, crypto/rand.Reader is used.  Keys are not rotated until Start is called.
+func NewSessionTicketRotator(tc *tls.Config, st SessionTickets, random io.Reader) (*SessionTicketRotator, error) {
+	if random == nil {
+		random = rand.Reader
+	}
+
+	r := &SessionTicketRotator{
+		config:   tc,
+		random:   random,
+		interval: st.RotationInterval,
+		maxKeys:  st.Keys,
+	}
+
+	if r.interval <= 0 {
+		r.interval = DefaultSessionTicketRotationInterval
+	}
+
+	if r.maxKeys < 1 {
+		r.maxKeys = DefaultSessionTicketKeys
+	}
+
+	if err := r.Rotate(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Rotate generates a new current key.  The oldest key is discarded if the maximum number of keys is exceeded.
+func (r *SessionTicketRotator) Rotate() error {
+	var next [32]byte
+	if _, err := io.ReadFull(r.random, next[:]); err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	keys := append([][32]byte{next}, r.keys...)
+	if len(keys) > r.maxKeys {
+		keys = keys[:r.maxKeys]
+	}
+
+	r.keys = keys
+	r.config.SetSessionTicketKeys(keys)
+	return nil
+}
+
+// Keys returns a copy of the current keys, newest first
+func (r *SessionTicketRotator) Keys() [][32]byte {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([][32]byte{}, r.keys...)
+}
+
+// Start begins rotating keys on the configured interval.  Calling Start on a running rotator does nothing.
+func (r *SessionTicketRotator) Start() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.stop != nil {
+		return
+	}
+
+	r.stop = make(chan struct{})
+	go func(stop <-chan struct{}) {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				// on failure, keep the current keys and try again on the next tick
+				r.Rotate()
+			}
+		}
+	}(r.stop)
+}
+
+// Stop halts key rotation.  The current keys remain installed.
+func (r *SessionTicketRotator) Stop() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.stop != nil {
+		close(r.stop)
+		r.stop = nil
+	}
+}
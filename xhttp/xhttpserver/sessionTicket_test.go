@@ -0,0 +1,163 @@
+package xhttpserver
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sequentialReader produces bytes that increase by one on each call, so that every generated key is distinct and predictable
+type sequentialReader struct {
+	next byte
+}
+
+func (sr *sequentialReader) Read(p []byte) (int, error) {
+	sr.next++
+	copy(p, bytes.Repeat([]byte{sr.next}, len(p)))
+	return len(p), nil
+}
+
+type errorReader struct{}
+
+func (errorReader) Read([]byte) (int, error) {
+	return 0, errors.New("expected")
+}
+
+func sessionTicketKey(b byte) (k [32]byte) {
+	copy(k[:], bytes.Repeat([]byte{b}, len(k)))
+	return
+}
+
+func testSessionTicketRotatorDefaults(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	r, err := NewSessionTicketRotator(new(tls.Config), SessionTickets{}, nil)
+	require.NoError(err)
+	assert.Equal(DefaultSessionTicketRotationInterval, r.interval)
+	assert.Equal(DefaultSessionTicketKeys, r.maxKeys)
+	assert.Len(r.Keys(), 1)
+}
+
+func testSessionTicketRotatorRotate(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	r, err := NewSessionTicketRotator(new(tls.Config), SessionTickets{Keys: 3}, new(sequentialReader))
+	require.NoError(err)
+	assert.Equal([][32]byte{sessionTicketKey(1)}, r.Keys())
+
+	require.NoError(r.Rotate())
+	assert.Equal([][32]byte{sessionTicketKey(2), sessionTicketKey(1)}, r.Keys())
+
+	require.NoError(r.Rotate())
+	require.NoError(r.Rotate())
+	assert.Equal([][32]byte{sessionTicketKey(4), sessionTicketKey(3), sessionTicketKey(2)}, r.Keys())
+}
+
+func testSessionTicketRotatorRandomError(t *testing.T) {
+	assert := assert.New(t)
+	r, err := NewSessionTicketRotator(new(tls.Config), SessionTickets{}, errorReader{})
+	assert.Nil(r)
+	assert.Error(err)
+}
+
+func testSessionTicketRotatorStartStop(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+	)
+
+	r, err := NewSessionTicketRotator(new(tls.Config), SessionTickets{RotationInterval: 10 * time.Millisecond}, new(sequentialReader))
+	require.NoError(err)
+
+	r.Start()
+	r.Start() // idempotent
+	assert.Eventually(
+		func() bool { return r.Keys()[0] != sessionTicketKey(1) },
+		5*time.Second,
+		5*time.Millisecond,
+	)
+
+	r.Stop()
+	r.Stop() // idempotent
+	stopped := r.Keys()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(stopped, r.Keys())
+}
+
+// testSessionTicketRotatorResumption verifies that the installed keys are actually used by the TLS stack: a session
+// remains resumable across a rotation, since the previous key is retained, but not once that key is rotated out.
+func testSessionTicketRotatorResumption(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		certificateFile, keyFile = createGeneratedServerFiles(t, "tickets")
+	)
+
+	defer os.Remove(certificateFile)
+	defer os.Remove(keyFile)
+
+	tc, err := NewTlsConfig(&Tls{CertificateFile: certificateFile, KeyFile: keyFile, MaxVersion: tls.VersionTLS12})
+	require.NoError(err)
+	r, err := NewSessionTicketRotator(tc, SessionTickets{Keys: 2}, nil)
+	require.NoError(err)
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", tc)
+	require.NoError(err)
+	defer l.Close()
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			c.(*tls.Conn).Handshake()
+			c.Close()
+		}
+	}()
+
+	clientConfig := &tls.Config{
+		InsecureSkipVerify: true,
+		ClientSessionCache: tls.NewLRUClientSessionCache(1),
+	}
+
+	resumed := func() bool {
+		c, err := tls.Dial("tcp", l.Addr().String(), clientConfig)
+		require.NoError(err)
+		defer c.Close()
+		return c.ConnectionState().DidResume
+	}
+
+	assert.False(resumed())
+	assert.True(resumed())
+
+	require.NoError(r.Rotate())
+	assert.True(resumed(), "the previous key should still decrypt tickets")
+
+	// each resumption above reissued a ticket with the current key, so two rotations are needed
+	require.NoError(r.Rotate())
+	require.NoError(r.Rotate())
+	assert.False(resumed(), "a ticket encrypted with a discarded key should not resume")
+}
+
+func TestSessionTicketRotator(t *testing.T) {
+	t.Run("Defaults", testSessionTicketRotatorDefaults)
+	t.Run("Rotate", testSessionTicketRotatorRotate)
+	t.Run("RandomError", testSessionTicketRotatorRandomError)
+	t.Run("StartStop", testSessionTicketRotatorStartStop)
+	t.Run("Resumption", testSessionTicketRotatorResumption)
+}
@@ -0,0 +1,65 @@
+package xhttpserver
+
+import "net/http"
+
+// StripHeaders is an Alice-style decorator that removes sensitive headers, such as those mapped onto claims,
+// from requests that do not come directly from one of the TrustedProxies.  This prevents external clients from
+// spoofing headers that only an internal proxy is supposed to set.  The immediate peer is always used to decide
+// trust, so this decorator must run before Forwarded rewrites the request's RemoteAddr.
+//
+// Requests from trusted peers, and requests that carry none of the headers, are passed along unchanged.
+type StripHeaders struct {
+	// Headers are the names of the headers to strip.  Names are matched case insensitively.
+	Headers []string
+
+	// TrustedProxies are the peers whose requests keep the headers.  If empty, the headers are always stripped.
+	TrustedProxies TrustedProxies
+}
+
+// present returns the canonical names of the configured headers that a request actually carries
+func (sh StripHeaders) present(request *http.Request) []string {
+	var names []string
+	for _, name := range sh.Headers {
+		name = http.CanonicalHeaderKey(name)
+		if _, ok := request.Header[name]; ok {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+func (sh StripHeaders) Then(next http.Handler) http.Handler {
+	if len(sh.Headers) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		names := sh.present(request)
+		if len(names) == 0 {
+			next.ServeHTTP(response, request)
+			return
+		}
+
+		if peer := peerIP(request); peer != nil && sh.TrustedProxies.Contains(peer) {
+			next.ServeHTTP(response, request)
+			return
+		}
+
+		stripped := request.WithContext(request.Context())
+		stripped.Header = make(http.Header, len(request.Header))
+		for name, values := range request.Header {
+			stripped.Header[name] = values
+		}
+
+		for _, name := range names {
+			delete(stripped.Header, name)
+		}
+
+		next.ServeHTTP(response, stripped)
+	})
+}
+
+func (sh StripHeaders) ThenFunc(next http.HandlerFunc) http.Handler {
+	return sh.Then(next)
+}
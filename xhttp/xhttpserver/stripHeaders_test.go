@@ -0,0 +1,105 @@
+package xhttpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// strippedRequest runs a request from the given peer, with X-Tenant and X-Other headers, through the decorator,
+// returning the request seen by the decorated handler
+func strippedRequest(t *testing.T, sh StripHeaders, remoteAddr string) (original, seen *http.Request) {
+	handler := sh.ThenFunc(func(_ http.ResponseWriter, request *http.Request) {
+		seen = request
+	})
+
+	original = httptest.NewRequest("GET", "/", nil)
+	original.RemoteAddr = remoteAddr
+	original.Header.Set("X-Tenant", "acme")
+	original.Header.Set("X-Other", "value")
+
+	handler.ServeHTTP(httptest.NewRecorder(), original)
+	require.NotNil(t, seen)
+	return
+}
+
+func newTestStripHeaders(t *testing.T) StripHeaders {
+	tp, err := ParseTrustedProxies([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+	return StripHeaders{Headers: []string{"x-tenant", "X-Missing"}, TrustedProxies: tp}
+}
+
+func testStripHeadersNoDecoration(t *testing.T) {
+	var (
+		next     = Constant{}.NewHandler()
+		stripped = StripHeaders{TrustedProxies: TrustedProxies{}}.Then(next)
+	)
+
+	assert.Equal(t, next, stripped)
+}
+
+func testStripHeadersUntrusted(t *testing.T) {
+	var (
+		assert         = assert.New(t)
+		original, seen = strippedRequest(t, newTestStripHeaders(t), "192.0.2.1:1234")
+	)
+
+	assert.Empty(seen.Header.Get("X-Tenant"))
+	assert.Equal("value", seen.Header.Get("X-Other"))
+
+	// the original request is not modified
+	assert.Equal("acme", original.Header.Get("X-Tenant"))
+}
+
+func testStripHeadersTrusted(t *testing.T) {
+	var (
+		assert         = assert.New(t)
+		original, seen = strippedRequest(t, newTestStripHeaders(t), "10.1.1.1:5678")
+	)
+
+	assert.Equal(original, seen)
+	assert.Equal("acme", seen.Header.Get("X-Tenant"))
+	assert.Equal("value", seen.Header.Get("X-Other"))
+}
+
+func testStripHeadersNoTrustedProxies(t *testing.T) {
+	_, seen := strippedRequest(t, StripHeaders{Headers: []string{"X-Tenant"}}, "10.1.1.1:5678")
+	assert.Empty(t, seen.Header.Get("X-Tenant"))
+}
+
+func testStripHeadersForwarded(t *testing.T) {
+	var (
+		assert = assert.New(t)
+		sh     = newTestStripHeaders(t)
+		seen   *http.Request
+
+		// a trusted proxy describes an untrusted client, which must not cause the proxy's headers to be stripped
+		handler = sh.Then(
+			Forwarded{TrustedProxies: sh.TrustedProxies}.ThenFunc(func(_ http.ResponseWriter, request *http.Request) {
+				seen = request
+			}),
+		)
+
+		request = httptest.NewRequest("GET", "/", nil)
+	)
+
+	request.RemoteAddr = "10.1.1.1:5678"
+	request.Header.Set("X-Tenant", "acme")
+	request.Header.Set(ForwardedHeader, "for=192.0.2.43")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	require.NotNil(t, seen)
+	assert.Equal("192.0.2.43", ClientIP(seen))
+	assert.Equal("acme", seen.Header.Get("X-Tenant"))
+}
+
+func TestStripHeaders(t *testing.T) {
+	t.Run("NoDecoration", testStripHeadersNoDecoration)
+	t.Run("Untrusted", testStripHeadersUntrusted)
+	t.Run("Trusted", testStripHeadersTrusted)
+	t.Run("NoTrustedProxies", testStripHeadersNoTrustedProxies)
+	t.Run("Forwarded", testStripHeadersForwarded)
+}
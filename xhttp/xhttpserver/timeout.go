@@ -0,0 +1,182 @@
+package xhttpserver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+// RequestTimeoutError is the error passed to a Timeout's error encoder when a request does not complete in time
+type RequestTimeoutError struct {
+	Timeout time.Duration
+}
+
+func (rte RequestTimeoutError) Error() string {
+	return fmt.Sprintf("The request did not complete within %s", rte.Timeout)
+}
+
+func (rte RequestTimeoutError) StatusCode() int {
+	return http.StatusServiceUnavailable
+}
+
+// timeoutWriter buffers a response so that it can be discarded if the request times out
+type timeoutWriter struct {
+	lock     sync.Mutex
+	header   http.Header
+	body     bytes.Buffer
+	code     int
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.lock.Lock()
+	defer tw.lock.Unlock()
+
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+
+	if tw.code == 0 {
+		tw.code = http.StatusOK
+	}
+
+	return tw.body.Write(p)
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.lock.Lock()
+	defer tw.lock.Unlock()
+
+	if !tw.timedOut && tw.code == 0 {
+		tw.code = code
+	}
+}
+
+// timeoutHandler is the internal http.Handler implementation that enforces a processing deadline
+type timeoutHandler struct {
+	next         http.Handler
+	timeout      time.Duration
+	bypass       []string
+	errorEncoder kithttp.ErrorEncoder
+}
+
+func (th *timeoutHandler) bypassed(request *http.Request) bool {
+	for _, prefix := range th.bypass {
+		if strings.HasPrefix(request.URL.Path, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (th *timeoutHandler) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	if th.bypassed(request) {
+		th.next.ServeHTTP(response, request)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(request.Context(), th.timeout)
+	defer cancel()
+
+	var (
+		tw       = &timeoutWriter{header: make(http.Header)}
+		done     = make(chan struct{})
+		panicked = make(chan interface{}, 1)
+	)
+
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				panicked <- p
+			}
+		}()
+
+		th.next.ServeHTTP(tw, request.WithContext(ctx))
+		close(done)
+	}()
+
+	select {
+	case p := <-panicked:
+		panic(p)
+
+	case <-done:
+		tw.lock.Lock()
+		defer tw.lock.Unlock()
+
+		for k, v := range tw.header {
+			response.Header()[k] = v
+		}
+
+		if tw.code == 0 {
+			tw.code = http.StatusOK
+		}
+
+		response.WriteHeader(tw.code)
+		response.Write(tw.body.Bytes())
+
+	case <-ctx.Done():
+		tw.lock.Lock()
+		defer tw.lock.Unlock()
+
+		tw.timedOut = true
+		err := ctx.Err()
+		if err == context.DeadlineExceeded {
+			err = RequestTimeoutError{Timeout: th.timeout}
+		}
+
+		th.errorEncoder(ctx, err, response)
+	}
+}
+
+// Timeout is an Alice-style decorator that enforces a processing deadline on each request, independent of any
+// server read or write timeouts.  The request's context is canceled when the deadline passes, and the client
+// receives the error produced by ErrorEncoder, which is http.StatusServiceUnavailable by default.
+//
+// As with http.TimeoutHandler, the response is buffered until the decorated handler returns, so neither
+// http.Flusher nor http.Hijacker is supported.  Streaming endpoints should be listed in Bypass.
+type Timeout struct {
+	// Timeout is the maximum time allowed to process a request.  If this field is nonpositive,
+	// the next handler is returned undecorated.
+	Timeout time.Duration
+
+	// Bypass is an optional list of URL path prefixes that are not subject to the timeout
+	Bypass []string
+
+	// ErrorEncoder writes the response for requests that time out.  If unset, kithttp.DefaultErrorEncoder
+	// is used with a RequestTimeoutError.
+	ErrorEncoder kithttp.ErrorEncoder
+}
+
+func (t Timeout) Then(next http.Handler) http.Handler {
+	if t.Timeout <= 0 {
+		return next
+	}
+
+	th := &timeoutHandler{
+		next:         next,
+		timeout:      t.Timeout,
+		bypass:       append([]string{}, t.Bypass...),
+		errorEncoder: t.ErrorEncoder,
+	}
+
+	if th.errorEncoder == nil {
+		th.errorEncoder = kithttp.DefaultErrorEncoder
+	}
+
+	return th
+}
+
+func (t Timeout) ThenFunc(next http.HandlerFunc) http.Handler {
+	return t.Then(next)
+}
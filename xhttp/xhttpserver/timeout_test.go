@@ -0,0 +1,175 @@
+package xhttpserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testTimeoutNoDecoration(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		next    = Constant{}.NewHandler()
+		timeout = Timeout{}.Then(next)
+	)
+
+	assert.Equal(next, timeout)
+}
+
+func testTimeoutCompleted(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		handler = Timeout{Timeout: time.Minute}.ThenFunc(func(response http.ResponseWriter, request *http.Request) {
+			_, hasDeadline := request.Context().Deadline()
+			assert.True(hasDeadline)
+
+			response.Header().Set("X-Test", "value")
+			response.WriteHeader(288)
+			response.Write([]byte("completed"))
+		})
+
+		response = httptest.NewRecorder()
+	)
+
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(288, response.Code)
+	assert.Equal("value", response.Header().Get("X-Test"))
+	assert.Equal("completed", response.Body.String())
+}
+
+func testTimeoutImplicitStatus(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		handler = Timeout{Timeout: time.Minute}.ThenFunc(func(http.ResponseWriter, *http.Request) {})
+
+		response = httptest.NewRecorder()
+	)
+
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(http.StatusOK, response.Code)
+}
+
+func testTimeoutExpired(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		canceled   = make(chan error, 1)
+		lateWrite  = make(chan error, 1)
+		nextReturn = make(chan struct{})
+
+		handler = Timeout{Timeout: 20 * time.Millisecond}.ThenFunc(func(response http.ResponseWriter, request *http.Request) {
+			<-request.Context().Done()
+			canceled <- request.Context().Err()
+
+			<-nextReturn
+			_, err := response.Write([]byte("too late"))
+			lateWrite <- err
+		})
+
+		response = httptest.NewRecorder()
+	)
+
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(http.StatusServiceUnavailable, response.Code)
+	assert.Contains(response.Body.String(), RequestTimeoutError{Timeout: 20 * time.Millisecond}.Error())
+
+	select {
+	case err := <-canceled:
+		assert.Equal(context.DeadlineExceeded, err)
+	case <-time.After(5 * time.Second):
+		require.Fail("The request context was not canceled")
+	}
+
+	close(nextReturn)
+	select {
+	case err := <-lateWrite:
+		assert.Equal(http.ErrHandlerTimeout, err)
+	case <-time.After(5 * time.Second):
+		require.Fail("The decorated handler did not return")
+	}
+
+	assert.NotContains(response.Body.String(), "too late")
+}
+
+func testTimeoutBypass(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		handler = Timeout{Timeout: 10 * time.Millisecond, Bypass: []string{"/stream"}}.ThenFunc(func(response http.ResponseWriter, request *http.Request) {
+			_, hasDeadline := request.Context().Deadline()
+			assert.False(hasDeadline)
+
+			_, canFlush := response.(http.Flusher)
+			assert.True(canFlush)
+
+			time.Sleep(30 * time.Millisecond)
+			response.WriteHeader(288)
+		})
+
+		response = httptest.NewRecorder()
+	)
+
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/stream/events", nil))
+	assert.Equal(288, response.Code)
+}
+
+func testTimeoutCustomErrorEncoder(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		handler = Timeout{
+			Timeout: 10 * time.Millisecond,
+			ErrorEncoder: func(_ context.Context, err error, response http.ResponseWriter) {
+				assert.IsType(RequestTimeoutError{}, err)
+				response.WriteHeader(599)
+			},
+		}.ThenFunc(func(response http.ResponseWriter, request *http.Request) {
+			<-request.Context().Done()
+		})
+
+		response = httptest.NewRecorder()
+	)
+
+	handler.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(599, response.Code)
+}
+
+func testTimeoutPanic(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		handler = Timeout{Timeout: time.Minute}.ThenFunc(func(http.ResponseWriter, *http.Request) {
+			panic("expected")
+		})
+	)
+
+	assert.PanicsWithValue("expected", func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	})
+}
+
+func TestTimeout(t *testing.T) {
+	t.Run("NoDecoration", testTimeoutNoDecoration)
+	t.Run("Completed", testTimeoutCompleted)
+	t.Run("ImplicitStatus", testTimeoutImplicitStatus)
+	t.Run("Expired", testTimeoutExpired)
+	t.Run("Bypass", testTimeoutBypass)
+	t.Run("CustomErrorEncoder", testTimeoutCustomErrorEncoder)
+	t.Run("Panic", testTimeoutPanic)
+}
+
+func TestRequestTimeoutError(t *testing.T) {
+	assert := assert.New(t)
+	err := RequestTimeoutError{Timeout: time.Second}
+	assert.Contains(err.Error(), "1s")
+	assert.Equal(http.StatusServiceUnavailable, err.StatusCode())
+}
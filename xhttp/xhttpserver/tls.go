@@ -4,15 +4,28 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"strings"
+	"sync/atomic"
 )
 
 var (
 	ErrTlsCertificateRequired         = errors.New("Both a certificateFile and keyFile are required")
 	ErrUnableToAddClientCACertificate = errors.New("Unable to add client CA certificate")
+	ErrNoCertificateLoaded            = errors.New("No server certificate has been loaded")
 )
 
+// UnknownCipherSuiteError indicates that a configured cipher suite is not one of the secure suites
+// implemented by crypto/tls
+type UnknownCipherSuiteError struct {
+	Name string
+}
+
+func (ucse UnknownCipherSuiteError) Error() string {
+	return fmt.Sprintf("Unknown or insecure cipher suite %s", ucse.Name)
+}
+
 // PeerVerifyError represents a verification error for a particular certificate
 type PeerVerifyError struct {
 	Certificate *x509.Certificate
@@ -164,22 +177,101 @@ type Tls struct {
 	MinVersion              uint16
 	MaxVersion              uint16
 	PeerVerify              PeerVerifyOptions
+
+	// CipherSuites optionally restricts the TLS 1.0-1.2 cipher suites, named as in crypto/tls, e.g.
+	// "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256".  Only secure suites are allowed.  TLS 1.3 suites are not
+	// configurable.  If unset, the crypto/tls defaults are used.
+	CipherSuites []string
+
+	// OCSPStapleFile is the optional path to a DER-encoded OCSP response for the server certificate.  If set,
+	// this response is stapled to every TLS handshake.  The file is reread whenever the certificate is reloaded.
+	OCSPStapleFile string
+
+	// SessionTickets configures server-managed session ticket keys.  If unset, the crypto/tls defaults are used.
+	SessionTickets *SessionTickets
 }
 
-// NewTlsConfig produces a *tls.Config from a set of configuration options.  If the supplied set of options
-// is nil, this function returns nil with no error.
-//
-// If supplied, the PeerVerifier strategies will be executed as part of peer verification.  This allows application-layer
-// logic to be injected.
-func NewTlsConfig(t *Tls, extra ...PeerVerifier) (*tls.Config, error) {
-	if t == nil {
+// loadCertificate reads a certificate and key pair from files, along with an optional stapled OCSP response
+func loadCertificate(certificateFile, keyFile, ocspStapleFile string) (tls.Certificate, error) {
+	if len(certificateFile) == 0 || len(keyFile) == 0 {
+		return tls.Certificate{}, ErrTlsCertificateRequired
+	}
+
+	cert, err := tls.LoadX509KeyPair(certificateFile, keyFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	if len(ocspStapleFile) > 0 {
+		cert.OCSPStaple, err = ioutil.ReadFile(ocspStapleFile)
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+	}
+
+	return cert, nil
+}
+
+// ReloadableCertificate holds a server certificate that can be swapped while a server is running.  Its
+// GetCertificate method is suitable for crypto/tls.Config.GetCertificate.
+type ReloadableCertificate struct {
+	current atomic.Value
+}
+
+// Load reads a certificate and key pair from files and, if successful, makes that pair the current certificate.
+// If an error occurs, the current certificate is left unchanged.
+func (rc *ReloadableCertificate) Load(certificateFile, keyFile string) error {
+	return rc.LoadStapled(certificateFile, keyFile, "")
+}
+
+// LoadStapled is like Load, but also reads a DER-encoded OCSP response to staple to the certificate.
+// If ocspStapleFile is empty, no response is stapled.
+func (rc *ReloadableCertificate) LoadStapled(certificateFile, keyFile, ocspStapleFile string) error {
+	cert, err := loadCertificate(certificateFile, keyFile, ocspStapleFile)
+	if err != nil {
+		return err
+	}
+
+	rc.current.Store(&cert)
+	return nil
+}
+
+// GetCertificate returns the current certificate.  An error is returned if no certificate has been loaded yet.
+func (rc *ReloadableCertificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if cert, ok := rc.current.Load().(*tls.Certificate); ok {
+		return cert, nil
+	}
+
+	return nil, ErrNoCertificateLoaded
+}
+
+// cipherSuites maps cipher suite names onto their crypto/tls identifiers.  No names yields a nil slice,
+// so that the crypto/tls defaults apply.
+func cipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
 		return nil, nil
 	}
 
-	if len(t.CertificateFile) == 0 || len(t.KeyFile) == 0 {
-		return nil, ErrTlsCertificateRequired
+	known := make(map[string]uint16)
+	for _, cs := range tls.CipherSuites() {
+		known[cs.Name] = cs.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[strings.ToUpper(name)]
+		if !ok {
+			return nil, UnknownCipherSuiteError{Name: name}
+		}
+
+		ids = append(ids, id)
 	}
 
+	return ids, nil
+}
+
+// newTlsConfig handles the common configuration for a *tls.Config, excluding the server certificate
+func newTlsConfig(t *Tls, extra ...PeerVerifier) (*tls.Config, error) {
 	var nextProtos []string
 	if len(t.NextProtos) > 0 {
 		for _, np := range t.NextProtos {
@@ -190,23 +282,23 @@ func NewTlsConfig(t *Tls, extra ...PeerVerifier) (*tls.Config, error) {
 		nextProtos = append(nextProtos, "http/1.1")
 	}
 
+	suites, err := cipherSuites(t.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+
 	tc := &tls.Config{
-		MinVersion: t.MinVersion,
-		MaxVersion: t.MaxVersion,
-		ServerName: t.ServerName,
-		NextProtos: nextProtos,
+		MinVersion:   t.MinVersion,
+		MaxVersion:   t.MaxVersion,
+		ServerName:   t.ServerName,
+		NextProtos:   nextProtos,
+		CipherSuites: suites,
 	}
 
 	if pvs := NewPeerVerifiers(t.PeerVerify, extra...); len(pvs) > 0 {
 		tc.VerifyPeerCertificate = pvs.VerifyPeerCertificate
 	}
 
-	if cert, err := tls.LoadX509KeyPair(t.CertificateFile, t.KeyFile); err != nil {
-		return nil, err
-	} else {
-		tc.Certificates = []tls.Certificate{cert}
-	}
-
 	if len(t.ClientCACertificateFile) > 0 {
 		caCert, err := ioutil.ReadFile(t.ClientCACertificateFile)
 		if err != nil {
@@ -222,6 +314,51 @@ func NewTlsConfig(t *Tls, extra ...PeerVerifier) (*tls.Config, error) {
 		tc.ClientAuth = tls.RequireAndVerifyClientCert
 	}
 
+	return tc, nil
+}
+
+// NewTlsConfig produces a *tls.Config from a set of configuration options.  If the supplied set of options
+// is nil, this function returns nil with no error.
+//
+// If supplied, the PeerVerifier strategies will be executed as part of peer verification.  This allows application-layer
+// logic to be injected.
+func NewTlsConfig(t *Tls, extra ...PeerVerifier) (*tls.Config, error) {
+	if t == nil {
+		return nil, nil
+	}
+
+	cert, err := loadCertificate(t.CertificateFile, t.KeyFile, t.OCSPStapleFile)
+	if err != nil {
+		return nil, err
+	}
+
+	tc, err := newTlsConfig(t, extra...)
+	if err != nil {
+		return nil, err
+	}
+
+	tc.Certificates = []tls.Certificate{cert}
 	tc.BuildNameToCertificate()
 	return tc, nil
 }
+
+// NewReloadableTlsConfig is like NewTlsConfig, except that the server certificate is loaded into the given
+// ReloadableCertificate and served through GetCertificate.  Subsequent calls to rc.Load will change the certificate
+// presented to new connections without affecting existing connections.
+func NewReloadableTlsConfig(t *Tls, rc *ReloadableCertificate, extra ...PeerVerifier) (*tls.Config, error) {
+	if t == nil {
+		return nil, nil
+	}
+
+	if err := rc.LoadStapled(t.CertificateFile, t.KeyFile, t.OCSPStapleFile); err != nil {
+		return nil, err
+	}
+
+	tc, err := newTlsConfig(t, extra...)
+	if err != nil {
+		return nil, err
+	}
+
+	tc.GetCertificate = rc.GetCertificate
+	return tc, nil
+}
@@ -565,6 +565,46 @@ func testNewTlsConfigAppendClientCACertificateError(t *testing.T, certificateFil
 	assert.Equal(ErrUnableToAddClientCACertificate, err)
 }
 
+func testNewTlsConfigCipherSuites(t *testing.T, certificateFile, keyFile string) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		tc, err = NewTlsConfig(&Tls{
+			CertificateFile: certificateFile,
+			KeyFile:         keyFile,
+			CipherSuites:    []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "tls_ecdhe_rsa_with_chacha20_poly1305_sha256"},
+		})
+	)
+
+	require.NoError(err)
+	require.NotNil(tc)
+	assert.Equal(
+		[]uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256},
+		tc.CipherSuites,
+	)
+}
+
+func testNewTlsConfigCipherSuiteError(t *testing.T, certificateFile, keyFile string) {
+	for _, name := range []string{"nosuch", "TLS_RSA_WITH_RC4_128_SHA"} {
+		t.Run(name, func(t *testing.T) {
+			var (
+				assert = assert.New(t)
+
+				tc, err = NewTlsConfig(&Tls{
+					CertificateFile: certificateFile,
+					KeyFile:         keyFile,
+					CipherSuites:    []string{name},
+				})
+			)
+
+			assert.Nil(tc)
+			assert.Equal(UnknownCipherSuiteError{Name: name}, err)
+			assert.Contains(err.Error(), name)
+		})
+	}
+}
+
 func TestNewTlsConfig(t *testing.T) {
 	certificateFile, keyFile := createServerFiles(t)
 	defer os.Remove(certificateFile)
@@ -596,4 +636,187 @@ func TestNewTlsConfig(t *testing.T) {
 	t.Run("AppendClientCACertificateError", func(t *testing.T) {
 		testNewTlsConfigAppendClientCACertificateError(t, certificateFile, keyFile)
 	})
+
+	t.Run("CipherSuites", func(t *testing.T) {
+		testNewTlsConfigCipherSuites(t, certificateFile, keyFile)
+	})
+
+	t.Run("CipherSuiteError", func(t *testing.T) {
+		testNewTlsConfigCipherSuiteError(t, certificateFile, keyFile)
+	})
+}
+
+func TestReloadableCertificate(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		rc = new(ReloadableCertificate)
+	)
+
+	certificateFile, keyFile := createGeneratedServerFiles(t, "first")
+	defer os.Remove(certificateFile)
+	defer os.Remove(keyFile)
+
+	cert, err := rc.GetCertificate(nil)
+	assert.Nil(cert)
+	assert.Equal(ErrNoCertificateLoaded, err)
+
+	assert.Equal(ErrTlsCertificateRequired, rc.Load("", keyFile))
+	assert.Equal(ErrTlsCertificateRequired, rc.Load(certificateFile, ""))
+
+	require.NoError(rc.Load(certificateFile, keyFile))
+	first, err := rc.GetCertificate(nil)
+	require.NoError(err)
+	require.NotNil(first)
+
+	// a failed load must leave the current certificate in place
+	assert.Error(rc.Load("nosuch", "nosuch"))
+	current, err := rc.GetCertificate(nil)
+	require.NoError(err)
+	assert.True(first == current)
+
+	writeGeneratedServerFiles(t, "second", certificateFile, keyFile)
+	require.NoError(rc.Load(certificateFile, keyFile))
+	second, err := rc.GetCertificate(nil)
+	require.NoError(err)
+	require.NotNil(second)
+	assert.NotEqual(first.Certificate, second.Certificate)
+}
+
+func TestNewReloadableTlsConfig(t *testing.T) {
+	certificateFile, keyFile := createServerFiles(t)
+	defer os.Remove(certificateFile)
+	defer os.Remove(keyFile)
+
+	t.Run("Nil", func(t *testing.T) {
+		assert := assert.New(t)
+		tc, err := NewReloadableTlsConfig(nil, new(ReloadableCertificate))
+		assert.Nil(tc)
+		assert.NoError(err)
+	})
+
+	t.Run("LoadCertificateError", func(t *testing.T) {
+		assert := assert.New(t)
+		tc, err := NewReloadableTlsConfig(&Tls{CertificateFile: "nosuch", KeyFile: "nosuch"}, new(ReloadableCertificate))
+		assert.Nil(tc)
+		assert.Error(err)
+	})
+
+	t.Run("Simple", func(t *testing.T) {
+		var (
+			assert  = assert.New(t)
+			require = require.New(t)
+
+			rc      = new(ReloadableCertificate)
+			tc, err = NewReloadableTlsConfig(
+				&Tls{
+					CertificateFile: certificateFile,
+					KeyFile:         keyFile,
+				},
+				rc,
+			)
+		)
+
+		require.NoError(err)
+		require.NotNil(tc)
+
+		assert.Empty(tc.Certificates)
+		assert.Equal([]string{"http/1.1"}, tc.NextProtos)
+		require.NotNil(tc.GetCertificate)
+
+		cert, err := tc.GetCertificate(nil)
+		assert.NotNil(cert)
+		assert.NoError(err)
+	})
+}
+
+// stapledResponse performs a handshake against the given server configuration, returning the
+// OCSP response the client received
+func stapledResponse(t *testing.T, tc *tls.Config) []byte {
+	require := require.New(t)
+	l, err := tls.Listen("tcp", "127.0.0.1:0", tc)
+	require.NoError(err)
+	defer l.Close()
+
+	go func() {
+		c, err := l.Accept()
+		if err == nil {
+			c.(*tls.Conn).Handshake()
+			c.Close()
+		}
+	}()
+
+	c, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	require.NoError(err)
+	defer c.Close()
+	return c.ConnectionState().OCSPResponse
+}
+
+func TestOCSPStaple(t *testing.T) {
+	var (
+		expectedStaple = []byte("stapled OCSP response")
+		stapleFile     = createOCSPStapleFile(t, expectedStaple)
+
+		certificateFile, keyFile = createGeneratedServerFiles(t, "stapled")
+	)
+
+	defer os.Remove(stapleFile)
+	defer os.Remove(certificateFile)
+	defer os.Remove(keyFile)
+
+	t.Run("NewTlsConfig", func(t *testing.T) {
+		var (
+			assert  = assert.New(t)
+			require = require.New(t)
+		)
+
+		tc, err := NewTlsConfig(&Tls{CertificateFile: certificateFile, KeyFile: keyFile, OCSPStapleFile: stapleFile})
+		require.NoError(err)
+		require.Len(tc.Certificates, 1)
+		assert.Equal(expectedStaple, tc.Certificates[0].OCSPStaple)
+		assert.Equal(expectedStaple, stapledResponse(t, tc))
+	})
+
+	t.Run("NewReloadableTlsConfig", func(t *testing.T) {
+		var (
+			assert  = assert.New(t)
+			require = require.New(t)
+		)
+
+		tc, err := NewReloadableTlsConfig(
+			&Tls{CertificateFile: certificateFile, KeyFile: keyFile, OCSPStapleFile: stapleFile},
+			new(ReloadableCertificate),
+		)
+
+		require.NoError(err)
+		cert, err := tc.GetCertificate(nil)
+		require.NoError(err)
+		assert.Equal(expectedStaple, cert.OCSPStaple)
+		assert.Equal(expectedStaple, stapledResponse(t, tc))
+	})
+
+	t.Run("NoStaple", func(t *testing.T) {
+		var (
+			assert  = assert.New(t)
+			require = require.New(t)
+		)
+
+		tc, err := NewTlsConfig(&Tls{CertificateFile: certificateFile, KeyFile: keyFile})
+		require.NoError(err)
+		assert.Empty(tc.Certificates[0].OCSPStaple)
+		assert.Empty(stapledResponse(t, tc))
+	})
+
+	t.Run("MissingStapleFile", func(t *testing.T) {
+		assert := assert.New(t)
+		tc, err := NewTlsConfig(&Tls{CertificateFile: certificateFile, KeyFile: keyFile, OCSPStapleFile: "nosuch"})
+		assert.Nil(tc)
+		assert.Error(err)
+
+		rc := new(ReloadableCertificate)
+		assert.Error(rc.LoadStapled(certificateFile, keyFile, "nosuch"))
+		_, err = rc.GetCertificate(nil)
+		assert.Equal(ErrNoCertificateLoaded, err)
+	})
 }
@@ -4,9 +4,11 @@ import (
 	"fmt"
 
 	"github.com/xmidt-org/themis/config"
+	"github.com/xmidt-org/themis/xlog"
 	"github.com/xmidt-org/themis/xlog/xloghttp"
 
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
 	"github.com/gorilla/mux"
 	"github.com/justinas/alice"
 	"go.uber.org/fx"
@@ -55,6 +57,19 @@ type ServerIn struct {
 	// ParameterBuiders is an optional component which is used to create contextual request loggers
 	// for use by http.Handler code.
 	ParameterBuilders xloghttp.ParameterBuilders `optional:"true"`
+
+	// Reloader is an optional component used to reload server state at runtime.  If supplied, each TLS server
+	// registers itself so that its certificate and key files are reread, using the then-current configuration,
+	// whenever the Reloader is triggered.
+	Reloader *config.Reloader `optional:"true"`
+
+	// Counters is an optional component holding runtime counters for each server.  If supplied, each server
+	// recovers panics from its handlers and counts panics and 5xx responses under its name.
+	Counters *ServerCounters `optional:"true"`
+
+	// Routes are the route sets supplied by any module.  Those whose Server matches this server's name are
+	// registered with its *mux.Router, in priority order, before the router is returned.
+	Routes []Routes `group:"xhttpserver.routes"`
 }
 
 // Unmarshal describes how to unmarshal an HTTP server.  This type contains all the non-component information
@@ -86,6 +101,32 @@ func (u Unmarshal) name() string {
 	return u.Key
 }
 
+// reloadable produces the Reloadable that rereads this server's certificate and any stapled OCSP response.  Only the Tls section of the
+// server's configuration is honored during a reload.  Other changes, such as the address, require a restart.
+func (u Unmarshal) reloadable(rc *ReloadableCertificate, logger log.Logger) config.Reloadable {
+	return config.ReloadableFunc(func(cu config.Unmarshaller) error {
+		var o Options
+		if err := cu.UnmarshalKey(u.Key, &o); err != nil {
+			return err
+		}
+
+		if o.Tls == nil {
+			return ErrTlsCertificateRequired
+		}
+
+		if err := rc.LoadStapled(o.Tls.CertificateFile, o.Tls.KeyFile, o.Tls.OCSPStapleFile); err != nil {
+			return err
+		}
+
+		logger.Log(
+			level.Key(), level.InfoValue(),
+			xlog.MessageKey(), "reloaded server certificate",
+		)
+
+		return nil
+	})
+}
+
 // Provide unmarshals a server using the Key field and creates a *mux.Router which is the root handler for
 // that server's requests.  This *mux.Router will be decorated with the constructors from NewServerChain as well
 // as any ChainFactory's constructors.
@@ -103,12 +144,39 @@ func (u Unmarshal) Provide(in ServerIn) (*mux.Router, error) {
 		return nil, err
 	}
 
+	trustedProxies, err := ParseTrustedProxies(o.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
 	var (
 		serverName   = u.name()
 		serverLogger = log.With(in.Logger, ServerKey(), serverName)
-		serverChain  = NewServerChain(o, serverLogger, in.ParameterBuilders...)
+
+		// spoofable headers are stripped based on the immediate peer, before the Forwarded decorator replaces it.
+		// Forwarded is otherwise outermost so that everything else, including logging, sees the original client.
+		serverChain = alice.New(
+			StripHeaders{Headers: o.StripHeaders, TrustedProxies: trustedProxies}.Then,
+			Forwarded{TrustedProxies: trustedProxies}.Then,
+		)
+	)
+
+	serverLogger.Log(
+		level.Key(), level.InfoValue(),
+		xlog.MessageKey(), "server configuration",
+		"options", o.LogValue(),
 	)
 
+	if in.Counters != nil {
+		counters := in.Counters.Get(serverName)
+		serverChain = serverChain.Append(
+			CountServerErrors{Counters: counters}.Then,
+			Recovery{Counters: counters, Logger: serverLogger}.Then,
+		)
+	}
+
+	serverChain = serverChain.Extend(NewServerChain(o, serverLogger, in.ParameterBuilders...))
+
 	if in.ChainFactory != nil {
 		more, err := in.ChainFactory.New(serverName, o)
 		if err != nil {
@@ -127,8 +195,16 @@ func (u Unmarshal) Provide(in ServerIn) (*mux.Router, error) {
 		)
 	)
 
+	RegisterRoutes(serverName, router, in.Routes)
+
+	var rc *ReloadableCertificate
+	if o.Tls != nil && in.Reloader != nil {
+		rc = new(ReloadableCertificate)
+		in.Reloader.Register(u.reloadable(rc, serverLogger))
+	}
+
 	in.Lifecycle.Append(fx.Hook{
-		OnStart: OnStart(o, server, serverLogger, func() { in.Shutdowner.Shutdown() }),
+		OnStart: OnStart(o, server, serverLogger, rc, func() { in.Shutdowner.Shutdown() }),
 		OnStop:  OnStop(server, serverLogger),
 	})
 
@@ -1,8 +1,15 @@
 package xhttpserver
 
 import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"os"
 	"testing"
 
 	"github.com/xmidt-org/themis/config"
@@ -206,6 +213,37 @@ func testUnmarshalProvideChainFactoryError(t *testing.T) {
 	assert.Error(app.Err())
 }
 
+func testUnmarshalProvideInvalidTrustedProxy(t *testing.T) {
+	var (
+		assert = assert.New(t)
+
+		app = fx.New(
+			fx.Logger(xlog.DiscardPrinter{}),
+			fx.Provide(
+				xlog.Provide(log.NewNopLogger()),
+				config.ProvideViper(
+					config.Json(`
+						{
+							"server": {
+								"address": "127.0.0.1:0",
+								"trustedProxies": ["10.0.0.0/8", "not an address"]
+							}
+						}
+					`),
+				),
+				Unmarshal{Key: "server"}.Provide,
+			),
+			fx.Invoke(
+				func(*mux.Router) {
+					assert.Fail("This invoke function should not have been called")
+				},
+			),
+		)
+	)
+
+	assert.Error(app.Err())
+}
+
 type testUnmarshalAnnotatedFullIn struct {
 	fx.In
 
@@ -324,6 +362,120 @@ func testUnmarshalAnnotatedNamed(t *testing.T) {
 	app.RequireStop()
 }
 
+// servedCommonName connects to a TLS server and returns the common name of the certificate it presents
+func servedCommonName(t *testing.T, address string) string {
+	conn, err := tls.Dial("tcp", address, &tls.Config{InsecureSkipVerify: true})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	peerCerts := conn.ConnectionState().PeerCertificates
+	require.NotEmpty(t, peerCerts)
+	return peerCerts[0].Subject.CommonName
+}
+
+func testUnmarshalProvideReload(t *testing.T) {
+	certificateFile, keyFile := createGeneratedServerFiles(t, "original")
+	defer os.Remove(certificateFile)
+	defer os.Remove(keyFile)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := l.Addr().String()
+	l.Close()
+
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+
+		reloader *config.Reloader
+		app      = fxtest.New(t,
+			fx.Provide(
+				xlog.Provide(log.NewNopLogger()),
+				config.ProvideViper(
+					config.Json(fmt.Sprintf(`
+						{
+							"server": {
+								"address": "%s",
+								"tls": {
+									"certificateFile": "%s",
+									"keyFile": "%s"
+								}
+							}
+						}
+					`, address, certificateFile, keyFile)),
+				),
+				func(u config.Unmarshaller) *config.Reloader {
+					return config.NewReloader(nil, u)
+				},
+				Unmarshal{Key: "server"}.Provide,
+			),
+			fx.Invoke(
+				func(*mux.Router) {},
+			),
+			fx.Populate(&reloader),
+		)
+	)
+
+	require.NotNil(reloader)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	assert.Equal("original", servedCommonName(t, address))
+
+	// a failed reload retains the original certificate
+	require.NoError(ioutil.WriteFile(keyFile, []byte("this is not a key"), 0600))
+	assert.Len(reloader.Reload(), 1)
+	assert.Equal("original", servedCommonName(t, address))
+
+	writeGeneratedServerFiles(t, "reloaded", certificateFile, keyFile)
+	assert.Empty(reloader.Reload())
+	assert.Equal("reloaded", servedCommonName(t, address))
+}
+
+func testUnmarshalProvideBanner(t *testing.T) {
+	var (
+		assert  = assert.New(t)
+		require = require.New(t)
+		output  bytes.Buffer
+
+		app = fxtest.New(t,
+			fx.Provide(
+				xlog.Provide(log.NewJSONLogger(&output)),
+				config.ProvideViper(
+					config.Json(`
+						{
+							"server": {
+								"address": ":0",
+								"maxHeaderBytes": 4096,
+								"tls": {
+									"certificateFile": "/etc/themis/server.crt",
+									"keyFile": "/etc/themis/server.key"
+								}
+							}
+						}
+					`),
+				),
+				Unmarshal{Key: "server"}.Provide,
+			),
+			fx.Invoke(func(*mux.Router) {}),
+		)
+	)
+
+	require.NoError(app.Err())
+
+	var entry map[string]interface{}
+	require.NoError(json.NewDecoder(&output).Decode(&entry))
+	assert.Equal("info", entry["level"])
+	assert.Equal("server configuration", entry["msg"])
+	assert.Equal("server", entry[ServerKey().(string)])
+
+	var o Options
+	require.NoError(json.Unmarshal([]byte(entry["options"].(string)), &o))
+	assert.Equal(":0", o.Address)
+	assert.Equal(4096, o.MaxHeaderBytes)
+	assert.Equal("/etc/themis/server.crt", o.Tls.CertificateFile)
+}
+
 func TestUnmarshal(t *testing.T) {
 	t.Run("Provide", func(t *testing.T) {
 		t.Run("Full", testUnmarshalProvideFull)
@@ -331,6 +483,9 @@ func TestUnmarshal(t *testing.T) {
 		t.Run("Required", testUnmarshalProvideRequired)
 		t.Run("UnmarshalError", testUnmarshalProvideUnmarshalError)
 		t.Run("ChainFactoryError", testUnmarshalProvideChainFactoryError)
+		t.Run("InvalidTrustedProxy", testUnmarshalProvideInvalidTrustedProxy)
+		t.Run("Reload", testUnmarshalProvideReload)
+		t.Run("Banner", testUnmarshalProvideBanner)
 	})
 
 	t.Run("Annotated", func(t *testing.T) {